@@ -5,17 +5,28 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"runtime"
+	"runtime/debug"
 	"syscall"
 	"time"
 
 	"github.com/haukened/rr-dns/internal/dns/common/clock"
 	"github.com/haukened/rr-dns/internal/dns/common/log"
 	"github.com/haukened/rr-dns/internal/dns/config"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/gateways/admin"
+	"github.com/haukened/rr-dns/internal/dns/gateways/dnssec"
+	"github.com/haukened/rr-dns/internal/dns/gateways/dnstap"
+	"github.com/haukened/rr-dns/internal/dns/gateways/iterative"
+	"github.com/haukened/rr-dns/internal/dns/gateways/metrics"
+	"github.com/haukened/rr-dns/internal/dns/gateways/querylog"
+	"github.com/haukened/rr-dns/internal/dns/gateways/tracing"
 	"github.com/haukened/rr-dns/internal/dns/gateways/transport"
 	"github.com/haukened/rr-dns/internal/dns/gateways/upstream"
 	"github.com/haukened/rr-dns/internal/dns/gateways/wire"
 	"github.com/haukened/rr-dns/internal/dns/repos/blocklist"
 	"github.com/haukened/rr-dns/internal/dns/repos/dnscache"
+	"github.com/haukened/rr-dns/internal/dns/repos/queryhistory"
 	"github.com/haukened/rr-dns/internal/dns/repos/zone"
 	"github.com/haukened/rr-dns/internal/dns/repos/zonecache"
 	"github.com/haukened/rr-dns/internal/dns/services/resolver"
@@ -27,15 +38,53 @@ const (
 	appName = "rr-dnsd"
 
 	// Default timeouts
-	defaultUpstreamTimeout = 5 * time.Second
-	defaultShutdownTimeout = 10 * time.Second
+	defaultUpstreamTimeout  = 5 * time.Second
+	defaultIterativeTimeout = 2 * time.Second
+	defaultShutdownTimeout  = 10 * time.Second
+
+	// defaultZoneTTL is the TTL of zone file records
+	defaultZoneTTL = 300 * time.Second
 )
 
 // Application holds all the components of the DNS server
 type Application struct {
 	config    *config.AppConfig
 	transport *transport.UDPTransport
+	// tcp answers on the same port as transport, for clients retrying truncated UDP answers.
+	tcp       *transport.TCPTransport
 	resolver  *resolver.Resolver
+	upstreams []*upstream.Resolver
+	signer    *dnssec.Signer
+	// snapshots persists the upstream cache; nil when snapshots are disabled.
+	snapshots cacheSnapshotter
+	// cache flushes and inspects the upstream cache at runtime; nil when caching is disabled.
+	cache resolver.CacheManager
+	// metrics serves Prometheus metrics; nil when no metrics address is configured.
+	metrics *metrics.Server
+	// admin serves the admin API; nil when neither an admin address nor socket is configured.
+	admin *admin.Server
+	// tracer exports trace spans; nil when tracing is disabled.
+	tracer *tracing.Tracer
+	// dnstap exports the DNS messages exchanged with clients and upstream servers; nil when dnstap is disabled.
+	dnstap *dnstap.Logger
+	// queryLog writes every answered query to a file; nil when the query log is disabled.
+	queryLog *querylog.Logger
+	// history keeps answered queries searchable by admin tooling; nil when the query history is disabled.
+	history *queryhistory.Store
+}
+
+// cacheSnapshotter is implemented by caches that can persist their contents across restarts.
+type cacheSnapshotter interface {
+	SaveSnapshot(path string) error
+	LoadSnapshot(path string) (int, error)
+}
+
+// snapshotCache is an upstream cache that can also be managed at runtime and
+// persisted across restarts.
+type snapshotCache interface {
+	resolver.Cache
+	resolver.CacheManager
+	cacheSnapshotter
 }
 
 func main() {
@@ -100,22 +149,93 @@ func buildApplication(cfg *config.AppConfig) (*Application, error) {
 	logger := log.GetLogger()
 
 	// Create DNS wire codec
-	codec := wire.NewUDPCodec(logger)
+	codec := wire.NewUDPCodecWithClock(logger, clk)
 
 	// Build repository layer
-	repos, err := buildRepositories(cfg, logger)
+	repos, err := buildRepositories(cfg, clk, logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build repositories: %w", err)
 	}
 
+	// Trace query handling when an exporter is configured
+	tracer, err := buildTracer(cfg, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build tracer: %w", err)
+	}
+	var queryTracer resolver.Tracer = resolver.NopTracer{}
+	if tracer != nil {
+		queryTracer = tracer
+	}
+
+	// Copy client and upstream messages to dnstap when an output is configured
+	dnstapLogger, err := buildDnstap(cfg, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build dnstap: %w", err)
+	}
+	var messageTap resolver.MessageTap = resolver.NopTap{}
+	if dnstapLogger != nil {
+		messageTap = dnstapLogger
+	}
+
 	// Build gateway layer
-	gateways, err := buildGateways(cfg, codec, logger)
+	gateways, err := buildGateways(cfg, codec, clk, queryTracer, messageTap, logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to build gateways: %w", err)
 	}
 
+	// Collect metrics when a metrics listener is configured
+	var queryMetrics resolver.Metrics = resolver.NopMetrics{}
+	var metricsServer *metrics.Server
+	if cfg.MetricsAddr != "" {
+		registry := buildMetrics(repos, gateways)
+		queryMetrics = registry
+		metricsServer = metrics.NewServer(cfg.MetricsAddr, registry, logger)
+	}
+
+	// Log every answered query when a query log file is configured
+	queryLog, err := buildQueryLog(cfg, clk, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query log: %w", err)
+	}
+
+	// Keep answered queries searchable when a query history directory is configured
+	history, err := buildQueryHistory(cfg, clk, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query history: %w", err)
+	}
+
+	var queryLogs resolver.MultiQueryLog
+	if queryLog != nil {
+		queryLogs = append(queryLogs, queryLog)
+	}
+	if history != nil {
+		queryLogs = append(queryLogs, history)
+	}
+	var queryLogger resolver.QueryLog = resolver.NopQueryLog{}
+	switch len(queryLogs) {
+	case 0:
+	case 1:
+		queryLogger = queryLogs[0]
+	default:
+		queryLogger = queryLogs
+	}
+
+	// Serve the admin API when an admin address or socket is configured
+	var queryHistory resolver.QueryHistory
+	if history != nil {
+		queryHistory = history
+	}
+	adminServer, err := buildAdmin(cfg, repos, gateways, queryHistory, clk, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build admin API: %w", err)
+	}
+
 	// Build service layer
-	resolverService := resolver.NewResolver(resolver.ResolverOptions{
+	ttlOverrides, err := cfg.ParsedTTLOverrides()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cache ttl overrides: %w", err)
+	}
+	resolverOpts := resolver.ResolverOptions{
 		Blocklist:     repos.blocklist,
 		Clock:         clk,
 		Logger:        logger,
@@ -123,63 +243,337 @@ func buildApplication(cfg *config.AppConfig) (*Application, error) {
 		UpstreamCache: repos.upstreamCache,
 		ZoneCache:     repos.zoneCache,
 		MaxRecursion:  cfg.MaxRecursion,
-	})
+		ForwardZones:  gateways.forwardZones,
+		// Serve-stale needs the cache to keep expired answers
+		ServeStale:         repos.upstreamCache != nil && cfg.CacheStaleWindow > 0,
+		StaleAnswerTimeout: cfg.StaleAnswerTimeout,
+		StaleAnswerTTL:     cfg.StaleAnswerTTL,
+		PrefetchMinHits:    cfg.PrefetchMinHits,
+		PrefetchPercent:    cfg.PrefetchPercent,
+		CachePolicy: resolver.CachePolicy{
+			MinTTL:         cfg.CacheMinTTL,
+			MaxTTL:         cfg.CacheMaxTTL,
+			NegativeMinTTL: cfg.CacheNegativeMinTTL,
+			NegativeMaxTTL: cfg.CacheNegativeMaxTTL,
+			TTLOverrides:   ttlOverrides,
+			NeverCache:     cfg.NeverCache,
+		},
+		Metrics:  queryMetrics,
+		Tracer:   queryTracer,
+		QueryLog: queryLogger,
+	}
+	if repos.signer != nil {
+		resolverOpts.ZoneSigner = repos.signer
+	}
+	resolverService := resolver.NewResolver(resolverOpts)
 
 	// Build transport layer
 	addr := fmt.Sprintf(":%d", cfg.Port)
-	udpTransport := transport.NewUDPTransport(addr, codec, logger)
+	udpTransport := transport.NewUDPTransportWithMetrics(addr, codec, logger, queryMetrics)
+	udpTransport.SetTap(messageTap)
+	tcpTransport := transport.NewTCPTransportWithMetrics(addr, codec, logger, queryMetrics)
+	tcpTransport.SetTap(messageTap)
 
 	return &Application{
 		config:    cfg,
 		transport: udpTransport,
+		tcp:       tcpTransport,
 		resolver:  resolverService,
+		upstreams: gateways.upstreams,
+		signer:    repos.signer,
+		snapshots: repos.snapshots,
+		cache:     repos.cacheManager,
+		metrics:   metricsServer,
+		admin:     adminServer,
+		tracer:    tracer,
+		dnstap:    dnstapLogger,
+		queryLog:  queryLog,
+		history:   history,
 	}, nil
 }
 
+// buildQueryLog opens the query log, or returns nil when no file is configured.
+func buildQueryLog(cfg *config.AppConfig, clk clock.Clock, logger log.Logger) (*querylog.Logger, error) {
+	if cfg.QueryLogFile == "" {
+		return nil, nil
+	}
+	queryLog, err := querylog.New(querylog.Options{
+		Path:           cfg.QueryLogFile,
+		MaxBytes:       cfg.QueryLogMaxBytes,
+		RotateInterval: cfg.QueryLogRotateInterval,
+		MaxBackups:     cfg.QueryLogMaxBackups,
+		MaxAge:         cfg.QueryLogMaxAge,
+		Anonymize:      querylog.Anonymization(cfg.QueryLogAnonymize),
+		HashKey:        cfg.QueryLogHashKey,
+		Clock:          clk,
+		Logger:         logger,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info(map[string]any{
+		"file":            cfg.QueryLogFile,
+		"max_bytes":       cfg.QueryLogMaxBytes,
+		"rotate_interval": cfg.QueryLogRotateInterval,
+		"max_backups":     cfg.QueryLogMaxBackups,
+		"anonymize":       cfg.QueryLogAnonymize,
+	}, "Query log configured")
+
+	return queryLog, nil
+}
+
+// buildQueryHistory opens the query history store, or returns nil when no
+// directory is configured.
+func buildQueryHistory(cfg *config.AppConfig, clk clock.Clock, logger log.Logger) (*queryhistory.Store, error) {
+	if cfg.QueryHistoryDir == "" {
+		return nil, nil
+	}
+	history, err := queryhistory.New(queryhistory.Options{
+		Dir:       cfg.QueryHistoryDir,
+		Retention: cfg.QueryHistoryRetention,
+		Clock:     clk,
+		Logger:    logger,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info(map[string]any{
+		"dir":       cfg.QueryHistoryDir,
+		"retention": cfg.QueryHistoryRetention,
+		"records":   history.Len(),
+	}, "Query history configured")
+
+	return history, nil
+}
+
+// buildDnstap creates the dnstap logger for the configured output, or returns
+// nil when dnstap is disabled.
+func buildDnstap(cfg *config.AppConfig, logger log.Logger) (*dnstap.Logger, error) {
+	if cfg.DnstapOutput == "" {
+		return nil, nil
+	}
+	identity := cfg.DnstapIdentity
+	if identity == "" {
+		identity, _ = os.Hostname()
+	}
+	tap, err := dnstap.New(dnstap.Options{
+		Network:  cfg.DnstapOutput,
+		Address:  cfg.DnstapAddress,
+		Identity: identity,
+		Version:  appName + " " + version,
+		Logger:   logger,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info(map[string]any{
+		"output":   cfg.DnstapOutput,
+		"address":  cfg.DnstapAddress,
+		"identity": identity,
+	}, "dnstap configured")
+
+	return tap, nil
+}
+
+// buildTracer creates the tracer for the configured exporter, or returns nil
+// when tracing is disabled.
+func buildTracer(cfg *config.AppConfig, logger log.Logger) (*tracing.Tracer, error) {
+	var exporter tracing.Exporter
+	switch cfg.TracingExporter {
+	case "":
+		return nil, nil
+	case "otlp":
+		exporter = tracing.NewHTTPExporter(cfg.TracingEndpoint, nil)
+	case "stdout":
+		exporter = tracing.NewWriterExporter(os.Stdout)
+	case "file":
+		fileExporter, err := tracing.NewFileExporter(cfg.TracingFile)
+		if err != nil {
+			return nil, err
+		}
+		exporter = fileExporter
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", cfg.TracingExporter)
+	}
+	tracer, err := tracing.NewTracer(tracing.Options{
+		Exporter:       exporter,
+		ServiceName:    appName,
+		ServiceVersion: version,
+		SampleRatio:    cfg.TracingSampleRatio,
+		Logger:         logger,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info(map[string]any{
+		"exporter":     cfg.TracingExporter,
+		"sample_ratio": cfg.TracingSampleRatio,
+	}, "Tracing configured")
+
+	return tracer, nil
+}
+
+// buildMetrics creates the metrics registry, reading cache, zone and upstream
+// state from the repositories and gateways on every scrape.
+func buildMetrics(repos *repositories, gw *gateways) *metrics.Registry {
+	upstreams := make([]metrics.UpstreamHealth, 0, len(gw.upstreams))
+	for _, u := range gw.upstreams {
+		upstreams = append(upstreams, u)
+	}
+	return metrics.NewRegistry(metrics.Options{
+		Cache:     repos.cacheManager,
+		Zones:     repos.zoneCache,
+		Upstreams: upstreams,
+	})
+}
+
+// buildAdmin creates the admin API server, or returns nil when neither an
+// admin address nor socket is configured.
+func buildAdmin(cfg *config.AppConfig, repos *repositories, gw *gateways, history resolver.QueryHistory, clk clock.Clock, logger log.Logger) (*admin.Server, error) {
+	if cfg.AdminAddr == "" && cfg.AdminSocket == "" {
+		return nil, nil
+	}
+	// Readiness depends on the default upstream servers; forward zones are reported apart
+	var upstreams []admin.UpstreamHealth
+	if gw.forwarder != nil {
+		upstreams = append(upstreams, gw.forwarder)
+	}
+	forwards := make(map[string]admin.UpstreamHealth, len(gw.forwardZones))
+	for zone, client := range gw.forwardZones {
+		if u, ok := client.(admin.UpstreamHealth); ok {
+			forwards[zone] = u
+		}
+	}
+	server, err := admin.New(admin.Options{
+		Addr:         cfg.AdminAddr,
+		Socket:       cfg.AdminSocket,
+		Token:        cfg.AdminToken,
+		Build:        buildInfo(),
+		Config:       cfg.Redacted(),
+		Zones:        repos.zoneCache,
+		RequireZones: repos.zoneFiles > 0,
+		Upstreams:    upstreams,
+		ForwardZones: forwards,
+		ZoneEditor:   repos.zoneEditor,
+		Cache:        repos.cacheManager,
+		History:      history,
+		Clock:        clk,
+		Logger:       logger,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info(map[string]any{
+		"address": cfg.AdminAddr,
+		"socket":  cfg.AdminSocket,
+	}, "Admin API configured")
+
+	return server, nil
+}
+
+// buildInfo describes this binary, including the VCS commit when the build recorded it.
+func buildInfo() admin.BuildInfo {
+	info := admin.BuildInfo{Name: appName, Version: version, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				info.Revision = setting.Value
+			case "vcs.time":
+				info.Time = setting.Value
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	return info
+}
+
 // repositories holds all repository implementations
 type repositories struct {
 	blocklist     resolver.Blocklist
 	upstreamCache resolver.Cache
 	zoneCache     resolver.ZoneCache
+	// zoneFiles counts the zones found in the zone directory, which readiness waits for.
+	zoneFiles int
+	// signer wraps zoneCache when zone signing keys are configured; nil otherwise.
+	signer *dnssec.Signer
+	// snapshots is the upstream cache when a snapshot file is configured; nil otherwise.
+	snapshots cacheSnapshotter
+	// cacheManager is the upstream cache; nil when caching is disabled.
+	cacheManager resolver.CacheManager
+	// zoneEditor edits the zone files and applies the changes to zoneCache.
+	zoneEditor resolver.ZoneEditor
 }
 
 // gateways holds all gateway implementations
 type gateways struct {
 	upstream resolver.UpstreamClient
+	// forwardZones maps domain suffixes to their conditional forwarding clients.
+	forwardZones map[string]resolver.UpstreamClient
+	// upstreams lists every concrete upstream resolver so background health checks can be started.
+	upstreams []*upstream.Resolver
+	// forwarder is the client for the default upstream servers; nil in iterative mode.
+	forwarder *upstream.Resolver
 }
 
 // buildRepositories creates and configures all repository implementations
-func buildRepositories(cfg *config.AppConfig, logger log.Logger) (*repositories, error) {
+func buildRepositories(cfg *config.AppConfig, clk clock.Clock, logger log.Logger) (*repositories, error) {
 	// Create blocklist repository
 	blocklistRepo := &blocklist.NoopBlocklist{}
 
 	// Create upstream response cache
 	var upstreamCache resolver.Cache
+	var snapshots cacheSnapshotter
+	var cacheManager resolver.CacheManager
 	var err error
 	if cfg.DisableCache {
 		upstreamCache = nil // No caching
 		log.Info(map[string]any{"disabled": true}, "DNS response caching disabled")
 	} else {
-		// Safely convert uint to int with bounds check
-		cacheSize := cfg.CacheSize
-		if cacheSize > uint(^uint(0)>>1) { // Check if it exceeds max int
-			return nil, fmt.Errorf("cache size too large: %d (max %d)", cacheSize, ^uint(0)>>1)
-		}
-		upstreamCache, err = dnscache.New(int(cacheSize))
+		cache, err := buildUpstreamCache(cfg, clk)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create upstream cache: %w", err)
+			return nil, err
+		}
+		upstreamCache = cache
+		cacheManager = cache
+
+		// Warm the cache from the last snapshot; a bad snapshot only costs a cold start
+		if cfg.CacheSnapshotFile != "" {
+			snapshots = cache
+			loaded, err := cache.LoadSnapshot(cfg.CacheSnapshotFile)
+			if err != nil {
+				log.Warn(map[string]any{
+					"error": err,
+					"file":  cfg.CacheSnapshotFile,
+				}, "Failed to load cache snapshot")
+			} else {
+				log.Info(map[string]any{
+					"file":    cfg.CacheSnapshotFile,
+					"entries": loaded,
+				}, "Cache snapshot loaded")
+			}
 		}
-		log.Info(map[string]any{
-			"type": "LRU",
-			"size": cfg.CacheSize,
-		}, "DNS response cache configured")
 	}
 
-	// Create zone cache
-	zoneCache := zonecache.New()
+	// Create zone cache, signed online when keys are configured
+	var zoneCache resolver.ZoneCache = zonecache.New()
+	var signer *dnssec.Signer
+	if cfg.DNSSECKeyDir != "" {
+		signer, err = buildSigner(cfg, zoneCache, logger)
+		if err != nil {
+			return nil, err
+		}
+		zoneCache = signer
+	}
 
 	// load the zone files from the configured directory
-	zones, err := zone.LoadZoneDirectory(cfg.ZoneDir, 300*time.Second)
+	zones, zoneFiles, err := zone.LoadZoneFiles(cfg.ZoneDir, defaultZoneTTL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load zone directory: %w", err)
 	}
@@ -198,29 +592,273 @@ func buildRepositories(cfg *config.AppConfig, logger log.Logger) (*repositories,
 		blocklist:     blocklistRepo,
 		upstreamCache: upstreamCache,
 		zoneCache:     zoneCache,
+		zoneFiles:     len(zones),
+		signer:        signer,
+		snapshots:     snapshots,
+		cacheManager:  cacheManager,
+		zoneEditor:    zone.NewEditor(zoneFiles, defaultZoneTTL, zoneCache),
 	}, nil
 }
 
+// buildUpstreamCache creates the upstream response cache: a sharded cache bounded
+// by approximate bytes when CacheMaxBytes is set, otherwise an LRU bounded by CacheSize entries.
+func buildUpstreamCache(cfg *config.AppConfig, clk clock.Clock) (snapshotCache, error) {
+	if cfg.CacheMaxBytes > 0 {
+		cache, err := dnscache.NewSharded(dnscache.ShardedOptions{
+			MaxBytes:    cfg.CacheMaxBytes,
+			Shards:      cfg.CacheShards,
+			StaleWindow: cfg.CacheStaleWindow,
+			Clock:       clk,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create upstream cache: %w", err)
+		}
+		log.Info(map[string]any{
+			"type":         "sharded",
+			"max_bytes":    cfg.CacheMaxBytes,
+			"shards":       cfg.CacheShards,
+			"stale_window": cfg.CacheStaleWindow,
+		}, "DNS response cache configured")
+		return cache, nil
+	}
+
+	// Safely convert uint to int with bounds check
+	cacheSize := cfg.CacheSize
+	if cacheSize > uint(^uint(0)>>1) { // Check if it exceeds max int
+		return nil, fmt.Errorf("cache size too large: %d (max %d)", cacheSize, ^uint(0)>>1)
+	}
+	cache, err := dnscache.NewWithOptions(dnscache.Options{
+		Size:        int(cacheSize),
+		StaleWindow: cfg.CacheStaleWindow,
+		Clock:       clk,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create upstream cache: %w", err)
+	}
+	log.Info(map[string]any{
+		"type":         "LRU",
+		"size":         cfg.CacheSize,
+		"stale_window": cfg.CacheStaleWindow,
+	}, "DNS response cache configured")
+	return cache, nil
+}
+
+// buildSigner loads the zone signing keys and wraps the zone cache in a signer
+// that signs every zone with keys as it is loaded.
+func buildSigner(cfg *config.AppConfig, zoneCache resolver.ZoneCache, logger log.Logger) (*dnssec.Signer, error) {
+	keys, err := dnssec.LoadSigningKeys(cfg.DNSSECKeyDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load DNSSEC signing keys: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no DNSSEC signing keys found in %s", cfg.DNSSECKeyDir)
+	}
+	signer, err := dnssec.NewSigner(dnssec.SignerOptions{
+		Zones:    zoneCache,
+		Keys:     keys,
+		NSEC3:    cfg.DNSSECNSEC3,
+		Validity: cfg.DNSSECSignatureValidity,
+		Logger:   logger,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DNSSEC signer: %w", err)
+	}
+
+	log.Info(map[string]any{
+		"key_dir":  cfg.DNSSECKeyDir,
+		"keys":     len(keys),
+		"nsec3":    cfg.DNSSECNSEC3,
+		"validity": cfg.DNSSECSignatureValidity,
+	}, "DNSSEC signing enabled")
+
+	return signer, nil
+}
+
 // buildGateways creates and configures all gateway implementations
-func buildGateways(cfg *config.AppConfig, codec wire.DNSCodec, logger log.Logger) (*gateways, error) {
+func buildGateways(cfg *config.AppConfig, codec wire.DNSCodec, clk clock.Clock, tracer resolver.Tracer, tap resolver.MessageTap, logger log.Logger) (*gateways, error) {
+	gw := &gateways{}
+	if cfg.Iterative {
+		// Resolve from the root instead of forwarding to recursive servers
+		iterativeClient, err := iterative.NewResolver(iterative.Options{
+			RootHints:         cfg.RootHints,
+			Timeout:           defaultIterativeTimeout,
+			QNAMEMinimisation: cfg.QnameMinimisation,
+			Tracer:            tracer,
+			Tap:               tap,
+			Codec:             codec,
+			Clock:             clk,
+			Logger:            logger,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create iterative resolver: %w", err)
+		}
+		gw.upstream = iterativeClient
+
+		log.Info(map[string]any{
+			"root_hints":         len(iterativeClient.RootHints()),
+			"qname_minimisation": cfg.QnameMinimisation,
+		}, "Iterative resolver configured")
+	} else {
+		upstreamClient, err := buildUpstream(cfg, codec, clk, tracer, tap, logger)
+		if err != nil {
+			return nil, err
+		}
+		gw.upstream = upstreamClient
+		gw.upstreams = []*upstream.Resolver{upstreamClient}
+		gw.forwarder = upstreamClient
+		if cfg.DNSSEC {
+			validator, err := buildValidator(cfg, upstreamClient, logger)
+			if err != nil {
+				return nil, err
+			}
+			gw.upstream = validator
+		}
+	}
+
+	// Create one client per conditional forwarding rule
+	zones, err := cfg.ParsedForwardZones()
+	if err != nil {
+		return nil, err
+	}
+	if len(zones) > 0 {
+		gw.forwardZones = make(map[string]resolver.UpstreamClient, len(zones))
+	}
+	for _, zone := range zones {
+		timeout := zone.Timeout
+		if timeout <= 0 {
+			timeout = defaultUpstreamTimeout
+		}
+		client, err := upstream.NewResolver(upstream.Options{
+			Servers: zone.Servers,
+			Timeout: timeout,
+			Network: zone.Network,
+			Health: upstream.HealthOptions{
+				FailureThreshold: cfg.UpstreamFailureThreshold,
+				Backoff:          cfg.UpstreamBackoff,
+				ProbeInterval:    cfg.UpstreamProbeInterval,
+			},
+			CaseRandomization: cfg.UpstreamCaseRandomization,
+			Tracer:            tracer,
+			Tap:               tap,
+			Codec:             codec,
+			Clock:             clk,
+			Logger:            logger,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create forward zone client for %s: %w", zone.Suffix, err)
+		}
+		gw.forwardZones[zone.Suffix] = client
+		gw.upstreams = append(gw.upstreams, client)
+
+		log.Info(map[string]any{
+			"zone":    zone.Suffix,
+			"servers": zone.Servers,
+			"network": zone.Network,
+			"timeout": timeout,
+		}, "Forward zone configured")
+	}
+
+	return gw, nil
+}
+
+// buildUpstream creates the forwarding client for the configured upstream servers.
+func buildUpstream(cfg *config.AppConfig, codec wire.DNSCodec, clk clock.Clock, tracer resolver.Tracer, tap resolver.MessageTap, logger log.Logger) (*upstream.Resolver, error) {
+	weights, err := upstreamWeights(cfg.Servers, cfg.UpstreamWeights)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create upstream client
 	upstreamClient, err := upstream.NewResolver(upstream.Options{
-		Servers: cfg.Servers,
-		Timeout: defaultUpstreamTimeout,
-		Codec:   codec,
+		Servers:   cfg.Servers,
+		Timeout:   defaultUpstreamTimeout,
+		Parallel:  cfg.UpstreamParallel,
+		Strategy:  upstream.Strategy(cfg.UpstreamStrategy),
+		RaceCount: cfg.UpstreamRaceCount,
+		Weights:   weights,
+		Health: upstream.HealthOptions{
+			FailureThreshold: cfg.UpstreamFailureThreshold,
+			Backoff:          cfg.UpstreamBackoff,
+			ProbeInterval:    cfg.UpstreamProbeInterval,
+		},
+		CaseRandomization: cfg.UpstreamCaseRandomization,
+		DNSSEC:            cfg.DNSSEC,
+		Tracer:            tracer,
+		Tap:               tap,
+		Codec:             codec,
+		Clock:             clk,
+		Logger:            logger,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create upstream client: %w", err)
 	}
 
 	log.Info(map[string]any{
-		"servers": cfg.Servers,
-		"timeout": defaultUpstreamTimeout,
+		"servers":           cfg.Servers,
+		"timeout":           defaultUpstreamTimeout,
+		"strategy":          cfg.UpstreamStrategy,
+		"parallel":          cfg.UpstreamParallel,
+		"failure_threshold": cfg.UpstreamFailureThreshold,
+		"backoff":           cfg.UpstreamBackoff,
 	}, "Upstream DNS client configured")
 
-	return &gateways{
-		upstream: upstreamClient,
-	}, nil
+	return upstreamClient, nil
+}
+
+// buildValidator wraps the forwarding client in a DNSSEC validator anchored at
+// the configured trust anchors, or the built-in root anchors when none are set.
+func buildValidator(cfg *config.AppConfig, upstreamClient *upstream.Resolver, logger log.Logger) (*dnssec.Validator, error) {
+	var anchors []domain.ResourceRecord
+	if cfg.DNSSECTrustAnchor != "" {
+		var err error
+		anchors, err = dnssec.LoadTrustAnchors(cfg.DNSSECTrustAnchor)
+		if err != nil {
+			return nil, err
+		}
+	}
+	validator, err := dnssec.NewValidator(dnssec.Options{
+		Upstream: upstreamClient,
+		Anchors:  anchors,
+		Logger:   logger,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DNSSEC validator: %w", err)
+	}
+
+	trustAnchor := cfg.DNSSECTrustAnchor
+	if trustAnchor == "" {
+		trustAnchor = "built-in root"
+	}
+	log.Info(map[string]any{
+		"trust_anchor": trustAnchor,
+	}, "DNSSEC validation enabled")
+
+	return validator, nil
+}
+
+// upstreamWeights pairs the configured weights with their servers by position.
+// An empty weight list means every server weighs the same.
+func upstreamWeights(servers []string, weights []int) (map[string]int, error) {
+	if len(weights) == 0 {
+		return nil, nil
+	}
+	if len(weights) != len(servers) {
+		return nil, fmt.Errorf("upstream weights: got %d weights for %d servers", len(weights), len(servers))
+	}
+	out := make(map[string]int, len(servers))
+	for i, server := range servers {
+		out[server] = weights[i]
+	}
+	return out, nil
+}
+
+// stopTransports stops the UDP and TCP transports, logging any error.
+func (app *Application) stopTransports() {
+	for _, t := range []transport.ServerTransport{app.transport, app.tcp} {
+		if err := t.Stop(); err != nil {
+			log.Warn(map[string]any{"error": err}, "Error during transport shutdown")
+		}
+	}
 }
 
 // Run starts the DNS server and blocks until context is cancelled
@@ -230,29 +868,113 @@ func (app *Application) Run(ctx context.Context) error {
 		return fmt.Errorf("failed to start UDP transport: %w", err)
 	}
 
+	// Start TCP transport, where clients retry truncated UDP answers
+	if err := app.tcp.Start(ctx, app.resolver); err != nil {
+		if stopErr := app.transport.Stop(); stopErr != nil {
+			log.Warn(map[string]any{"error": stopErr}, "Error during transport shutdown")
+		}
+		return fmt.Errorf("failed to start TCP transport: %w", err)
+	}
+
 	log.Info(map[string]any{
 		"address":   app.transport.Address(),
-		"transport": "UDP",
+		"transport": "UDP+TCP",
 	}, "DNS server started")
 
+	// Serve metrics until shutdown
+	if app.metrics != nil {
+		if err := app.metrics.Start(); err != nil {
+			app.stopTransports()
+			return fmt.Errorf("failed to start metrics server: %w", err)
+		}
+	}
+
+	// Serve the admin API until shutdown
+	if app.admin != nil {
+		if err := app.admin.Start(); err != nil {
+			app.stopTransports()
+			if app.metrics != nil {
+				if stopErr := app.metrics.Stop(); stopErr != nil {
+					log.Warn(map[string]any{"error": stopErr}, "Error during metrics server shutdown")
+				}
+			}
+			return fmt.Errorf("failed to start admin server: %w", err)
+		}
+	}
+
+	// Probe sidelined upstream servers in the background until shutdown
+	for _, u := range app.upstreams {
+		u.StartHealthChecks(ctx)
+	}
+
+	// Renew zone signatures before they expire
+	if app.signer != nil {
+		app.signer.StartRefresh(ctx)
+	}
+
+	// Save cache snapshots periodically so a crash loses little
+	if app.snapshots != nil && app.config.CacheSnapshotInterval > 0 {
+		go app.saveCacheSnapshots(ctx, app.config.CacheSnapshotInterval)
+	}
+
+	// Zones are loaded and queries are being answered
+	if app.admin != nil {
+		app.admin.SetServing(true)
+	}
+
 	// Wait for shutdown signal
 	<-ctx.Done()
 
 	log.Info(nil, "Shutdown initiated")
+	if app.admin != nil {
+		app.admin.SetServing(false)
+	}
 
 	// Create shutdown context with timeout
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), defaultShutdownTimeout)
 	defer cancel()
 
-	// Stop transport gracefully
-	if err := app.transport.Stop(); err != nil {
-		log.Warn(map[string]any{"error": err}, "Error during transport shutdown")
+	// Stop transports gracefully
+	app.stopTransports()
+	if app.metrics != nil {
+		if err := app.metrics.Stop(); err != nil {
+			log.Warn(map[string]any{"error": err}, "Error during metrics server shutdown")
+		}
+	}
+	if app.admin != nil {
+		if err := app.admin.Stop(); err != nil {
+			log.Warn(map[string]any{"error": err}, "Error during admin server shutdown")
+		}
+	}
+	if app.tracer != nil {
+		if err := app.tracer.Shutdown(shutdownCtx); err != nil {
+			log.Warn(map[string]any{"error": err}, "Error during tracer shutdown")
+		}
+	}
+	if app.dnstap != nil {
+		if err := app.dnstap.Close(); err != nil {
+			log.Warn(map[string]any{"error": err}, "Error closing dnstap output")
+		}
+		if dropped, lost := app.dnstap.Dropped(), app.dnstap.Lost(); dropped+lost > 0 {
+			log.Warn(map[string]any{"dropped": dropped, "lost": lost}, "dnstap messages were discarded")
+		}
 	}
+	if app.queryLog != nil {
+		if err := app.queryLog.Close(); err != nil {
+			log.Warn(map[string]any{"error": err}, "Error closing query log")
+		}
+	}
+	if app.history != nil {
+		if err := app.history.Close(); err != nil {
+			log.Warn(map[string]any{"error": err}, "Error closing query history")
+		}
+	}
+	app.logCacheStats()
 
 	// Wait for shutdown completion or timeout
 	done := make(chan struct{})
 	go func() {
-		// Additional cleanup could go here
+		app.saveCacheSnapshot()
 		close(done)
 	}()
 
@@ -265,3 +987,50 @@ func (app *Application) Run(ctx context.Context) error {
 		return fmt.Errorf("shutdown timeout")
 	}
 }
+
+// logCacheStats logs the upstream cache counters, to help size the cache.
+func (app *Application) logCacheStats() {
+	if app.cache == nil {
+		return
+	}
+	stats := app.cache.Stats()
+	log.Info(map[string]any{
+		"entries":         stats.Entries,
+		"bytes":           stats.Bytes,
+		"hits":            stats.Hits,
+		"misses":          stats.Misses,
+		"expired_on_read": stats.ExpiredOnRead,
+		"evictions":       stats.Evictions,
+		"inserts":         stats.Inserts,
+	}, "Upstream cache statistics")
+}
+
+// saveCacheSnapshots saves a cache snapshot every interval until ctx is done.
+func (app *Application) saveCacheSnapshots(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			app.saveCacheSnapshot()
+		}
+	}
+}
+
+// saveCacheSnapshot writes the upstream cache to the configured snapshot file.
+// Failures are logged; losing a snapshot only means a cold cache on the next start.
+func (app *Application) saveCacheSnapshot() {
+	if app.snapshots == nil {
+		return
+	}
+	if err := app.snapshots.SaveSnapshot(app.config.CacheSnapshotFile); err != nil {
+		log.Warn(map[string]any{
+			"error": err,
+			"file":  app.config.CacheSnapshotFile,
+		}, "Failed to save cache snapshot")
+		return
+	}
+	log.Debug(map[string]any{"file": app.config.CacheSnapshotFile}, "Cache snapshot saved")
+}
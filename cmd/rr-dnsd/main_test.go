@@ -3,9 +3,12 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -13,6 +16,9 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/haukened/rr-dns/internal/dns/config"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/gateways/admin"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
 )
 
 // TestApplication_Integration tests the full application lifecycle
@@ -140,14 +146,195 @@ func TestBuildApplication_ConfigurationVariations(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "serve stale and prefetch",
+			setupEnv: func() {
+				require.NoError(t, os.Setenv("DNS_ZONE_DIR", t.TempDir()))
+				require.NoError(t, os.Setenv("DNS_CACHE_STALE_WINDOW", "24h"))
+				require.NoError(t, os.Setenv("DNS_STALE_ANSWER_TIMEOUT", "1s"))
+				require.NoError(t, os.Setenv("DNS_PREFETCH_MIN_HITS", "3"))
+			},
+			wantErr: false,
+		},
+		{
+			name: "byte-bounded sharded cache",
+			setupEnv: func() {
+				require.NoError(t, os.Setenv("DNS_ZONE_DIR", t.TempDir()))
+				require.NoError(t, os.Setenv("DNS_CACHE_MAX_BYTES", "1048576"))
+			},
+			wantErr: false,
+		},
+		{
+			name: "cache policy",
+			setupEnv: func() {
+				require.NoError(t, os.Setenv("DNS_ZONE_DIR", t.TempDir()))
+				require.NoError(t, os.Setenv("DNS_CACHE_MIN_TTL", "30s"))
+				require.NoError(t, os.Setenv("DNS_CACHE_NEGATIVE_MIN_TTL", "1m"))
+				require.NoError(t, os.Setenv("DNS_CACHE_TTL_OVERRIDES", "corp.example=5s"))
+				require.NoError(t, os.Setenv("DNS_NEVER_CACHE", "dyn.example"))
+			},
+			wantErr: false,
+		},
+		{
+			name: "weighted parallel upstreams",
+			setupEnv: func() {
+				require.NoError(t, os.Setenv("DNS_ZONE_DIR", t.TempDir()))
+				require.NoError(t, os.Setenv("DNS_UPSTREAM_STRATEGY", "weighted"))
+				require.NoError(t, os.Setenv("DNS_UPSTREAM_PARALLEL", "true"))
+				require.NoError(t, os.Setenv("DNS_UPSTREAM_WEIGHTS", "3,1"))
+				require.NoError(t, os.Setenv("DNS_UPSTREAM_CASE_RANDOMIZATION", "true"))
+			},
+			wantErr: false,
+		},
+		{
+			name: "forward zones",
+			setupEnv: func() {
+				require.NoError(t, os.Setenv("DNS_ZONE_DIR", t.TempDir()))
+				require.NoError(t, os.Setenv("DNS_FORWARD_ZONES", "corp.example=10.8.0.1:53 consul=127.0.0.1:8600;tcp;2s"))
+			},
+			wantErr: false,
+		},
+		{
+			name: "iterative resolution",
+			setupEnv: func() {
+				require.NoError(t, os.Setenv("DNS_ZONE_DIR", t.TempDir()))
+				require.NoError(t, os.Setenv("DNS_ITERATIVE", "true"))
+				require.NoError(t, os.Setenv("DNS_ROOT_HINTS", "198.41.0.4:53"))
+				require.NoError(t, os.Setenv("DNS_FORWARD_ZONES", "corp.example=10.8.0.1:53"))
+			},
+			wantErr: false,
+		},
+		{
+			name: "dnssec validation with a trust anchor file",
+			setupEnv: func() {
+				anchors := filepath.Join(t.TempDir(), "anchors.conf")
+				require.NoError(t, os.WriteFile(anchors, []byte(". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D\n"), 0o600))
+				require.NoError(t, os.Setenv("DNS_ZONE_DIR", t.TempDir()))
+				require.NoError(t, os.Setenv("DNS_DNSSEC", "true"))
+				require.NoError(t, os.Setenv("DNS_DNSSEC_TRUST_ANCHOR", anchors))
+			},
+			wantErr: false,
+		},
+		{
+			name: "dnssec trust anchor file missing",
+			setupEnv: func() {
+				require.NoError(t, os.Setenv("DNS_ZONE_DIR", t.TempDir()))
+				require.NoError(t, os.Setenv("DNS_DNSSEC", "true"))
+				require.NoError(t, os.Setenv("DNS_DNSSEC_TRUST_ANCHOR", "/nonexistent/anchors.conf"))
+			},
+			wantErr:       true,
+			errorContains: "failed to read trust anchors",
+		},
+		{
+			name: "dnssec zone signing",
+			setupEnv: func() {
+				zones, keys := t.TempDir(), t.TempDir()
+				require.NoError(t, os.WriteFile(filepath.Join(zones, "test.yaml"), []byte("zone_root: test.local\nwww:\n  A: \"127.0.0.1\"\n"), 0o600))
+				require.NoError(t, os.WriteFile(filepath.Join(keys, "Ktest.local.+015+00001.key"),
+					[]byte("test.local. IN DNSKEY 257 3 15 ebVWLo/mVPlAeLES6KmLp5AfhTrmlb7X4OORC60ElmQ=\n"), 0o600))
+				require.NoError(t, os.WriteFile(filepath.Join(keys, "Ktest.local.+015+00001.private"),
+					[]byte("Private-key-format: v1.3\nAlgorithm: 15 (ED25519)\nPrivateKey: AQIDBAUGBwgJCgsMDQ4PEBESExQVFhcYGRobHB0eHyA=\n"), 0o600))
+				require.NoError(t, os.Setenv("DNS_ZONE_DIR", zones))
+				require.NoError(t, os.Setenv("DNS_DNSSEC_KEY_DIR", keys))
+				require.NoError(t, os.Setenv("DNS_DNSSEC_NSEC3", "true"))
+			},
+			wantErr: false,
+		},
+		{
+			name: "dnssec key directory without keys",
+			setupEnv: func() {
+				require.NoError(t, os.Setenv("DNS_ZONE_DIR", t.TempDir()))
+				require.NoError(t, os.Setenv("DNS_DNSSEC_KEY_DIR", t.TempDir()))
+			},
+			wantErr:       true,
+			errorContains: "no DNSSEC signing keys found",
+		},
+		{
+			name: "metrics listener",
+			setupEnv: func() {
+				require.NoError(t, os.Setenv("DNS_ZONE_DIR", t.TempDir()))
+				require.NoError(t, os.Setenv("DNS_METRICS_ADDR", ":9153"))
+			},
+			wantErr: false,
+		},
+		{
+			name: "admin listener without token",
+			setupEnv: func() {
+				require.NoError(t, os.Setenv("DNS_ZONE_DIR", t.TempDir()))
+				require.NoError(t, os.Setenv("DNS_ADMIN_ADDR", "127.0.0.1:8053"))
+			},
+			wantErr:       true,
+			errorContains: "AdminToken",
+		},
+		{
+			name: "trace file in missing directory",
+			setupEnv: func() {
+				require.NoError(t, os.Setenv("DNS_ZONE_DIR", t.TempDir()))
+				require.NoError(t, os.Setenv("DNS_TRACING_EXPORTER", "file"))
+				require.NoError(t, os.Setenv("DNS_TRACING_FILE", filepath.Join(t.TempDir(), "missing", "traces.jsonl")))
+			},
+			wantErr:       true,
+			errorContains: "failed to open trace file",
+		},
+		{
+			name: "query log in missing directory",
+			setupEnv: func() {
+				require.NoError(t, os.Setenv("DNS_ZONE_DIR", t.TempDir()))
+				require.NoError(t, os.Setenv("DNS_QUERY_LOG_FILE", filepath.Join(t.TempDir(), "missing", "queries.log")))
+			},
+			wantErr:       true,
+			errorContains: "failed to open query log",
+		},
+		{
+			name: "query history directory is a file",
+			setupEnv: func() {
+				file := filepath.Join(t.TempDir(), "history")
+				require.NoError(t, os.WriteFile(file, nil, 0600))
+				require.NoError(t, os.Setenv("DNS_ZONE_DIR", t.TempDir()))
+				require.NoError(t, os.Setenv("DNS_QUERY_HISTORY_DIR", file))
+			},
+			wantErr:       true,
+			errorContains: "failed to build query history",
+		},
+		{
+			name: "dnstap file in missing directory",
+			setupEnv: func() {
+				require.NoError(t, os.Setenv("DNS_ZONE_DIR", t.TempDir()))
+				require.NoError(t, os.Setenv("DNS_DNSTAP_OUTPUT", "file"))
+				require.NoError(t, os.Setenv("DNS_DNSTAP_ADDRESS", filepath.Join(t.TempDir(), "missing", "rr-dns.dnstap")))
+			},
+			wantErr:       true,
+			errorContains: "failed to open dnstap file",
+		},
+		{
+			name: "upstream weights do not match servers",
+			setupEnv: func() {
+				require.NoError(t, os.Setenv("DNS_ZONE_DIR", t.TempDir()))
+				require.NoError(t, os.Setenv("DNS_UPSTREAM_WEIGHTS", "3,1,1"))
+			},
+			wantErr:       true,
+			errorContains: "got 3 weights for 2 servers",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Clean environment
-			for _, key := range []string{"DNS_PORT", "DNS_ZONE_DIR", "DNS_DISABLE_CACHE"} {
+			// Clean environment before and after each case
+			keys := []string{"DNS_PORT", "DNS_ZONE_DIR", "DNS_DISABLE_CACHE",
+				"DNS_UPSTREAM_STRATEGY", "DNS_UPSTREAM_PARALLEL", "DNS_UPSTREAM_WEIGHTS", "DNS_UPSTREAM_CASE_RANDOMIZATION", "DNS_FORWARD_ZONES",
+				"DNS_ITERATIVE", "DNS_ROOT_HINTS", "DNS_DNSSEC", "DNS_DNSSEC_TRUST_ANCHOR",
+				"DNS_DNSSEC_KEY_DIR", "DNS_DNSSEC_NSEC3", "DNS_CACHE_STALE_WINDOW", "DNS_STALE_ANSWER_TIMEOUT", "DNS_STALE_ANSWER_TTL",
+				"DNS_PREFETCH_MIN_HITS", "DNS_CACHE_MAX_BYTES", "DNS_CACHE_MIN_TTL", "DNS_CACHE_NEGATIVE_MIN_TTL", "DNS_CACHE_TTL_OVERRIDES", "DNS_NEVER_CACHE", "DNS_METRICS_ADDR",
+				"DNS_TRACING_EXPORTER", "DNS_TRACING_FILE", "DNS_QUERY_LOG_FILE", "DNS_QUERY_HISTORY_DIR",
+				"DNS_DNSTAP_OUTPUT", "DNS_DNSTAP_ADDRESS", "DNS_ADMIN_ADDR"}
+			for _, key := range keys {
 				_ = os.Unsetenv(key)
 			}
+			t.Cleanup(func() {
+				for _, key := range keys {
+					_ = os.Unsetenv(key)
+				}
+			})
 
 			tt.setupEnv()
 
@@ -207,9 +394,374 @@ web:
 	// Verify components are wired correctly
 	assert.NotNil(t, app.config)
 	assert.NotNil(t, app.transport)
+	assert.NotNil(t, app.tcp)
+	assert.Equal(t, app.transport.Address(), app.tcp.Address())
 	assert.NotNil(t, app.resolver)
 
 	// Verify zone loading worked
 	assert.Equal(t, tempDir, app.config.ZoneDir)
 	assert.Equal(t, uint(50), app.config.CacheSize)
 }
+
+func TestApplication_CacheManager(t *testing.T) {
+	t.Setenv("DNS_ZONE_DIR", t.TempDir())
+
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	app, err := buildApplication(cfg)
+	require.NoError(t, err)
+	require.NotNil(t, app.cache, "the upstream cache is manageable when caching is enabled")
+	assert.Equal(t, 0, app.cache.Stats().Entries)
+	assert.NotPanics(t, app.logCacheStats)
+
+	t.Setenv("DNS_DISABLE_CACHE", "true")
+	cfg, err = config.Load()
+	require.NoError(t, err)
+	app, err = buildApplication(cfg)
+	require.NoError(t, err)
+	assert.Nil(t, app.cache)
+	assert.NotPanics(t, app.logCacheStats)
+}
+
+func TestApplication_Metrics(t *testing.T) {
+	zoneDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(zoneDir, "test.yaml"), []byte("zone_root: test.local\nwww:\n  A: \"127.0.0.1\"\n"), 0644))
+	t.Setenv("DNS_ZONE_DIR", zoneDir)
+
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	app, err := buildApplication(cfg)
+	require.NoError(t, err)
+	assert.Nil(t, app.metrics, "metrics are disabled without an address")
+
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.LocalAddr().(*net.UDPAddr).Port
+	require.NoError(t, listener.Close())
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	metricsAddr := tcpListener.Addr().String()
+	require.NoError(t, tcpListener.Close())
+	t.Setenv("DNS_PORT", fmt.Sprintf("%d", port))
+	t.Setenv("DNS_METRICS_ADDR", metricsAddr)
+
+	cfg, err = config.Load()
+	require.NoError(t, err)
+	app, err = buildApplication(cfg)
+	require.NoError(t, err)
+	require.NotNil(t, app.metrics)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	appErr := make(chan error, 1)
+	go func() { appErr <- app.Run(ctx) }()
+
+	var body string
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://" + app.metrics.Address() + "/metrics")
+		if err != nil {
+			return false
+		}
+		data, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		body = string(data)
+		return err == nil && resp.StatusCode == http.StatusOK
+	}, 2*time.Second, 10*time.Millisecond)
+	assert.Contains(t, body, "rrdns_zones 1")
+	assert.Contains(t, body, "rrdns_cache_entries 0")
+	assert.Contains(t, body, `rrdns_upstream_queries_total{server="1.1.1.1:53"} 0`)
+
+	cancel()
+	select {
+	case err := <-appErr:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Application failed to shutdown within timeout")
+	}
+}
+
+func TestApplication_Admin(t *testing.T) {
+	zoneDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(zoneDir, "test.yaml"), []byte("zone_root: test.local\nwww:\n  A: \"127.0.0.1\"\n"), 0644))
+	t.Setenv("DNS_ZONE_DIR", zoneDir)
+
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	app, err := buildApplication(cfg)
+	require.NoError(t, err)
+	assert.Nil(t, app.admin, "the admin API is disabled without an address or socket")
+
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.LocalAddr().(*net.UDPAddr).Port
+	require.NoError(t, listener.Close())
+	socketDir, err := os.MkdirTemp("", "rr-dnsd")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(socketDir) })
+	socket := filepath.Join(socketDir, "admin.sock")
+	t.Setenv("DNS_PORT", fmt.Sprintf("%d", port))
+	t.Setenv("DNS_ADMIN_SOCKET", socket)
+	t.Setenv("DNS_ADMIN_TOKEN", "s3cret-token")
+
+	cfg, err = config.Load()
+	require.NoError(t, err)
+	app, err = buildApplication(cfg)
+	require.NoError(t, err)
+	require.NotNil(t, app.admin)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	appErr := make(chan error, 1)
+	go func() { appErr <- app.Run(ctx) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}}
+	get := func(path string) (int, string) {
+		req, err := http.NewRequest(http.MethodGet, "http://admin"+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer s3cret-token")
+		resp, err := client.Do(req)
+		if err != nil {
+			return 0, ""
+		}
+		data, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		require.NoError(t, err)
+		return resp.StatusCode, string(data)
+	}
+
+	require.Eventually(t, func() bool {
+		status, _ := get(admin.PathReady)
+		return status == http.StatusOK
+	}, 2*time.Second, 10*time.Millisecond)
+
+	status, body := get(admin.PathZones)
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"zones":[{"zone":"test.local","records":1}]}`, body)
+
+	status, body = get(admin.PathUpstreams)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"server":"1.1.1.1:53"`)
+
+	status, body = get(admin.PathConfig)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"admin_socket":"`+socket+`"`)
+	assert.NotContains(t, body, "s3cret-token")
+
+	status, body = get(admin.PathVersion)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"version":"`+version+`"`)
+
+	// Records added through the API are served and written to the zone file
+	req, err := http.NewRequest(http.MethodPost, "http://admin/api/v1/zones/test.local/records",
+		strings.NewReader(`{"name":"mail","type":"A","value":"127.0.0.2"}`))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer s3cret-token")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.NotEmpty(t, resp.Header.Get("ETag"))
+
+	status, body = get(admin.PathZones)
+	assert.Equal(t, http.StatusOK, status)
+	assert.JSONEq(t, `{"zones":[{"zone":"test.local","records":2}]}`, body)
+	data, err := os.ReadFile(filepath.Join(zoneDir, "test.yaml"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "127.0.0.2")
+
+	cancel()
+	select {
+	case err := <-appErr:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Application failed to shutdown within timeout")
+	}
+	_, err = os.Stat(socket)
+	assert.True(t, os.IsNotExist(err), "the admin socket is removed on shutdown")
+}
+
+func TestApplication_Tracing(t *testing.T) {
+	zoneDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(zoneDir, "test.yaml"), []byte("zone_root: test.local\nwww:\n  A: \"127.0.0.1\"\n"), 0644))
+	traceFile := filepath.Join(t.TempDir(), "traces.jsonl")
+	t.Setenv("DNS_ZONE_DIR", zoneDir)
+
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	app, err := buildApplication(cfg)
+	require.NoError(t, err)
+	assert.Nil(t, app.tracer, "tracing is disabled without an exporter")
+
+	t.Setenv("DNS_TRACING_EXPORTER", "file")
+	t.Setenv("DNS_TRACING_FILE", traceFile)
+	cfg, err = config.Load()
+	require.NoError(t, err)
+	app, err = buildApplication(cfg)
+	require.NoError(t, err)
+	require.NotNil(t, app.tracer)
+
+	query, err := domain.NewQuestion(1, "www.test.local.", domain.RRTypeA, domain.RRClassIN)
+	require.NoError(t, err)
+	resp, err := app.resolver.HandleQuery(context.Background(), query, nil)
+	require.NoError(t, err)
+	require.Len(t, resp.Answers, 1)
+	require.NoError(t, app.tracer.Shutdown(context.Background()))
+
+	data, err := os.ReadFile(traceFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"name":"dns.query"`)
+	assert.Contains(t, string(data), `"name":"dns.zone.lookup"`)
+	assert.Contains(t, string(data), `{"key":"service.name","value":{"stringValue":"rr-dnsd"}}`)
+}
+
+func TestApplication_QueryLog(t *testing.T) {
+	zoneDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(zoneDir, "test.yaml"), []byte("zone_root: test.local\nwww:\n  A: \"127.0.0.1\"\n"), 0644))
+	queryLogFile := filepath.Join(t.TempDir(), "queries.log")
+	t.Setenv("DNS_ZONE_DIR", zoneDir)
+
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	app, err := buildApplication(cfg)
+	require.NoError(t, err)
+	assert.Nil(t, app.queryLog, "the query log is disabled without a file")
+
+	t.Setenv("DNS_QUERY_LOG_FILE", queryLogFile)
+	t.Setenv("DNS_QUERY_LOG_ANONYMIZE", "truncate")
+	cfg, err = config.Load()
+	require.NoError(t, err)
+	app, err = buildApplication(cfg)
+	require.NoError(t, err)
+	require.NotNil(t, app.queryLog)
+
+	query, err := domain.NewQuestion(1, "www.test.local.", domain.RRTypeA, domain.RRClassIN)
+	require.NoError(t, err)
+	client := &net.UDPAddr{IP: net.ParseIP("192.0.2.10"), Port: 5353}
+	_, err = app.resolver.HandleQuery(context.Background(), query, client)
+	require.NoError(t, err)
+	require.NoError(t, app.queryLog.Close())
+
+	data, err := os.ReadFile(queryLogFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"client":"192.0.2.0"`)
+	assert.Contains(t, string(data), `"name":"www.test.local."`)
+	assert.Contains(t, string(data), `"source":"zone"`)
+}
+
+func TestApplication_QueryHistory(t *testing.T) {
+	zoneDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(zoneDir, "test.yaml"), []byte("zone_root: test.local\nwww:\n  A: \"127.0.0.1\"\n"), 0644))
+	t.Setenv("DNS_ZONE_DIR", zoneDir)
+
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	app, err := buildApplication(cfg)
+	require.NoError(t, err)
+	assert.Nil(t, app.history, "the query history is disabled without a directory")
+
+	// The query log and the query history both receive every query
+	queryLogFile := filepath.Join(t.TempDir(), "queries.log")
+	t.Setenv("DNS_QUERY_LOG_FILE", queryLogFile)
+	t.Setenv("DNS_QUERY_HISTORY_DIR", t.TempDir())
+	cfg, err = config.Load()
+	require.NoError(t, err)
+	app, err = buildApplication(cfg)
+	require.NoError(t, err)
+	require.NotNil(t, app.history)
+
+	query, err := domain.NewQuestion(1, "www.test.local.", domain.RRTypeA, domain.RRClassIN)
+	require.NoError(t, err)
+	client := &net.UDPAddr{IP: net.ParseIP("192.0.2.10"), Port: 5353}
+	_, err = app.resolver.HandleQuery(context.Background(), query, client)
+	require.NoError(t, err)
+	require.NoError(t, app.queryLog.Close())
+	require.NoError(t, app.history.Close())
+
+	records := app.history.Search(resolver.QueryFilter{Client: "192.0.2.10", Domain: "test.local"})
+	require.Len(t, records, 1)
+	assert.Equal(t, "www.test.local.", records[0].Name)
+	assert.Equal(t, resolver.SourceZone, records[0].Source)
+
+	data, err := os.ReadFile(queryLogFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"name":"www.test.local."`)
+}
+
+func TestApplication_Dnstap(t *testing.T) {
+	t.Setenv("DNS_ZONE_DIR", t.TempDir())
+
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	app, err := buildApplication(cfg)
+	require.NoError(t, err)
+	assert.Nil(t, app.dnstap, "dnstap is disabled without an output")
+
+	tapFile := filepath.Join(t.TempDir(), "rr-dns.dnstap")
+	t.Setenv("DNS_DNSTAP_OUTPUT", "file")
+	t.Setenv("DNS_DNSTAP_ADDRESS", tapFile)
+	t.Setenv("DNS_DNSTAP_IDENTITY", "ns1.test")
+	cfg, err = config.Load()
+	require.NoError(t, err)
+	app, err = buildApplication(cfg)
+	require.NoError(t, err)
+	require.NotNil(t, app.dnstap)
+
+	app.dnstap.Tap(resolver.TapMessage{
+		Type:         resolver.TapClientQuery,
+		Protocol:     "udp",
+		QueryAddr:    &net.UDPAddr{IP: net.ParseIP("192.0.2.10"), Port: 5353},
+		ResponseAddr: &net.UDPAddr{IP: net.ParseIP("192.0.2.53"), Port: 53},
+		QueryTime:    time.Now(),
+		Message:      []byte{0, 1},
+	})
+	require.NoError(t, app.dnstap.Close())
+
+	data, err := os.ReadFile(tapFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "protobuf:dnstap.Dnstap")
+	assert.Contains(t, string(data), "ns1.test")
+	assert.Contains(t, string(data), appName+" "+version)
+}
+
+func TestApplication_CacheSnapshot(t *testing.T) {
+	snapshotFile := filepath.Join(t.TempDir(), "cache.snapshot")
+	t.Setenv("DNS_ZONE_DIR", t.TempDir())
+	t.Setenv("DNS_CACHE_SNAPSHOT_FILE", snapshotFile)
+
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	app, err := buildApplication(cfg)
+	require.NoError(t, err)
+	require.NotNil(t, app.snapshots)
+
+	record, err := domain.NewCachedResourceRecord("www.example.com.", domain.RRTypeA, domain.RRClass(1), 300, []byte{192, 0, 2, 1}, "192.0.2.1", time.Now())
+	require.NoError(t, err)
+	cache, ok := app.snapshots.(resolver.Cache)
+	require.True(t, ok)
+	require.NoError(t, cache.Set([]domain.ResourceRecord{record}))
+	app.saveCacheSnapshot()
+	require.FileExists(t, snapshotFile)
+
+	restarted, err := buildApplication(cfg)
+	require.NoError(t, err)
+	restored, found := restarted.snapshots.(resolver.Cache).Get(record.CacheKey())
+	assert.True(t, found, "the cache is warm after a restart")
+	assert.Len(t, restored, 1)
+
+	// A corrupt snapshot costs a cold cache, not the startup
+	require.NoError(t, os.WriteFile(snapshotFile, []byte("garbage"), 0600))
+	cold, err := buildApplication(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, 0, cold.snapshots.(resolver.Cache).Len())
+
+	t.Setenv("DNS_CACHE_SNAPSHOT_FILE", "")
+	cfg, err = config.Load()
+	require.NoError(t, err)
+	app, err = buildApplication(cfg)
+	require.NoError(t, err)
+	assert.Nil(t, app.snapshots)
+	app.saveCacheSnapshot()
+}
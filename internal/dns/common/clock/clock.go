@@ -1,9 +1,15 @@
 package clock
 
-import "time"
+import (
+	"sync"
+	"time"
+)
 
 type Clock interface {
 	Now() time.Time
+	// After waits for d to pass and then sends the current time on the
+	// returned channel, like time.After.
+	After(d time.Duration) <-chan time.Time
 }
 
 type RealClock struct{}
@@ -12,14 +18,63 @@ func (c *RealClock) Now() time.Time {
 	return time.Now()
 }
 
+func (c *RealClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// MockClock only moves when it is advanced. Channels from After fire once
+// Advance moves the time past their deadline; setting CurrentTime directly
+// does not fire them.
 type MockClock struct {
 	CurrentTime time.Time
+
+	mu      sync.Mutex
+	waiters []waiter
+}
+
+// waiter is a pending After call on a MockClock.
+type waiter struct {
+	at time.Time
+	ch chan time.Time
 }
 
 func (c *MockClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.CurrentTime
 }
 
 func (c *MockClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.CurrentTime = c.CurrentTime.Add(d)
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.CurrentTime) {
+			pending = append(pending, w)
+			continue
+		}
+		w.ch <- c.CurrentTime
+	}
+	c.waiters = pending
+}
+
+func (c *MockClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.CurrentTime
+		return ch
+	}
+	c.waiters = append(c.waiters, waiter{at: c.CurrentTime.Add(d), ch: ch})
+	return ch
+}
+
+// Waiting returns the number of After channels that have not fired yet, so a
+// test can wait for a goroutine to start waiting before advancing the clock.
+func (c *MockClock) Waiting() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
 }
@@ -226,3 +226,62 @@ func TestMockClock_Concurrent_Access(t *testing.T) {
 		<-done
 	}
 }
+
+func TestRealClock_After(t *testing.T) {
+	clock := &RealClock{}
+
+	select {
+	case <-clock.After(time.Millisecond):
+	case <-time.After(time.Second):
+		t.Error("RealClock.After did not fire")
+	}
+}
+
+func TestMockClock_After(t *testing.T) {
+	startTime := time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC)
+	clock := &MockClock{CurrentTime: startTime}
+
+	ch := clock.After(10 * time.Second)
+	if clock.Waiting() != 1 {
+		t.Fatalf("Expected 1 waiter, got %d", clock.Waiting())
+	}
+
+	// Not yet due
+	clock.Advance(9 * time.Second)
+	select {
+	case <-ch:
+		t.Fatal("After fired before its deadline")
+	default:
+	}
+
+	// Due: fires with the clock's time and is no longer waiting
+	clock.Advance(time.Second)
+	select {
+	case got := <-ch:
+		if expected := startTime.Add(10 * time.Second); !got.Equal(expected) {
+			t.Errorf("Expected %v, got %v", expected, got)
+		}
+	default:
+		t.Fatal("After did not fire at its deadline")
+	}
+	if clock.Waiting() != 0 {
+		t.Errorf("Expected no waiters, got %d", clock.Waiting())
+	}
+}
+
+func TestMockClock_After_NonPositive(t *testing.T) {
+	startTime := time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC)
+	clock := &MockClock{CurrentTime: startTime}
+
+	select {
+	case got := <-clock.After(0):
+		if !got.Equal(startTime) {
+			t.Errorf("Expected %v, got %v", startTime, got)
+		}
+	default:
+		t.Fatal("After(0) should fire immediately")
+	}
+	if clock.Waiting() != 0 {
+		t.Errorf("Expected no waiters, got %d", clock.Waiting())
+	}
+}
@@ -3,9 +3,11 @@ package rrdata
 import (
 	"fmt"
 	"net"
+	"strconv"
 	"strings"
 
 	"github.com/haukened/rr-dns/internal/dns/common/utils"
+	"github.com/haukened/rr-dns/internal/dns/domain"
 )
 
 // encodeDomainName encodes a domain name into wire format (length-prefixed labels ending in 0).
@@ -58,3 +60,50 @@ func isIPv4(ip net.IP) bool {
 func isIPv6(ip net.IP) bool {
 	return ip != nil && ip.To16() != nil && ip.To4() == nil
 }
+
+// splitDomainName decodes the uncompressed domain name at the start of b and
+// returns it together with the bytes that follow it. The root name is returned as ".".
+func splitDomainName(b []byte) (string, []byte, error) {
+	i := 0
+	for {
+		if i >= len(b) {
+			return "", nil, fmt.Errorf("invalid domain name encoding")
+		}
+		labelLen := int(b[i])
+		if labelLen == 0 {
+			break
+		}
+		i += 1 + labelLen
+	}
+	name, err := decodeDomainName(b[:i+1])
+	if err != nil {
+		return "", nil, err
+	}
+	if name == "" {
+		name = "."
+	}
+	return name, b[i+1:], nil
+}
+
+// typeMnemonic returns the presentation name of an RR type, falling back to
+// the generic TYPEnnn form of RFC 3597 §5 for types without a mnemonic.
+func typeMnemonic(t domain.RRType) string {
+	if !t.IsValid() {
+		return fmt.Sprintf("TYPE%d", t)
+	}
+	return t.String()
+}
+
+// parseTypeMnemonic is the inverse of typeMnemonic.
+func parseTypeMnemonic(s string) (domain.RRType, error) {
+	if t := domain.RRTypeFromString(strings.ToUpper(s)); t != 0 {
+		return t, nil
+	}
+	if n, ok := strings.CutPrefix(strings.ToUpper(s), "TYPE"); ok {
+		v, err := strconv.ParseUint(n, 10, 16)
+		if err == nil {
+			return domain.RRType(v), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown record type: %s", s)
+}
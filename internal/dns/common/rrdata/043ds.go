@@ -0,0 +1,49 @@
+package rrdata
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// encodeDSData encodes a DS record string into its binary representation (RFC 4034 §5).
+func encodeDSData(data string) ([]byte, error) {
+	// data = "20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D"
+	parts := strings.Fields(data)
+	if len(parts) < 4 {
+		return nil, fmt.Errorf("invalid DS record format (expected: keytag algorithm digesttype digest): %s", data)
+	}
+	keyTag, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DS key tag: %s", parts[0])
+	}
+	algorithm, err := strconv.ParseUint(parts[1], 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DS algorithm: %s", parts[1])
+	}
+	digestType, err := strconv.ParseUint(parts[2], 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DS digest type: %s", parts[2])
+	}
+	// The digest may be split into several whitespace-separated chunks.
+	digest, err := hex.DecodeString(strings.Join(parts[3:], ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DS digest: %v", err)
+	}
+	encoded := make([]byte, 4, 4+len(digest))
+	binary.BigEndian.PutUint16(encoded, uint16(keyTag))
+	encoded[2] = byte(algorithm)
+	encoded[3] = byte(digestType)
+	return append(encoded, digest...), nil
+}
+
+// decodeDSData decodes DS record data from the given byte slice.
+func decodeDSData(b []byte) (string, error) {
+	if len(b) < 5 {
+		return "", fmt.Errorf("invalid DS data length: %d", len(b))
+	}
+	keyTag := binary.BigEndian.Uint16(b[:2])
+	return fmt.Sprintf("%d %d %d %X", keyTag, b[2], b[3], b[4:]), nil
+}
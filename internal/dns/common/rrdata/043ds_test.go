@@ -0,0 +1,46 @@
+package rrdata
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeDSData(t *testing.T) {
+	got, err := encodeDSData("20326 8 2 E06D44B8 0B8F1D39")
+	if err != nil {
+		t.Fatalf("encodeDSData unexpected error: %v", err)
+	}
+	want := []byte{0x4f, 0x66, 8, 2, 0xe0, 0x6d, 0x44, 0xb8, 0x0b, 0x8f, 0x1d, 0x39}
+	if !bytes.Equal(got, want) {
+		t.Errorf("encodeDSData = %v, want %v", got, want)
+	}
+}
+
+func TestEncodeDSData_Invalid(t *testing.T) {
+	invalidInputs := []string{
+		"",
+		"20326 8 2",
+		"70000 8 2 E06D",
+		"20326 256 2 E06D",
+		"20326 8 x E06D",
+		"20326 8 2 NOTHEX",
+	}
+	for _, input := range invalidInputs {
+		if _, err := encodeDSData(input); err == nil {
+			t.Errorf("encodeDSData(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestDecodeDSData(t *testing.T) {
+	got, err := decodeDSData([]byte{0x4f, 0x66, 8, 2, 0xe0, 0x6d})
+	if err != nil {
+		t.Fatalf("decodeDSData unexpected error: %v", err)
+	}
+	if got != "20326 8 2 E06D" {
+		t.Errorf("decodeDSData = %q, want %q", got, "20326 8 2 E06D")
+	}
+	if _, err := decodeDSData([]byte{0, 1, 8, 2}); err == nil {
+		t.Error("decodeDSData expected error for missing digest")
+	}
+}
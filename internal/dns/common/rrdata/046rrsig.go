@@ -0,0 +1,118 @@
+package rrdata
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// rrsigTimeLayout is the YYYYMMDDHHmmSS presentation format of RRSIG
+// signature expiration and inception times (RFC 4034 §3.2).
+const rrsigTimeLayout = "20060102150405"
+
+// encodeRRSIGData encodes an RRSIG record string into its binary representation (RFC 4034 §3).
+func encodeRRSIGData(data string) ([]byte, error) {
+	// data = "A 13 3 300 20250201000000 20250101000000 12345 example.com. <base64 signature>"
+	parts := strings.Fields(data)
+	if len(parts) < 9 {
+		return nil, fmt.Errorf("invalid RRSIG record format (expected 9 fields): %s", data)
+	}
+	covered, err := parseTypeMnemonic(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid RRSIG type covered: %v", err)
+	}
+	algorithm, err := strconv.ParseUint(parts[1], 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RRSIG algorithm: %s", parts[1])
+	}
+	labels, err := strconv.ParseUint(parts[2], 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RRSIG labels: %s", parts[2])
+	}
+	originalTTL, err := strconv.ParseUint(parts[3], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RRSIG original TTL: %s", parts[3])
+	}
+	expiration, err := parseRRSIGTime(parts[4])
+	if err != nil {
+		return nil, fmt.Errorf("invalid RRSIG expiration: %v", err)
+	}
+	inception, err := parseRRSIGTime(parts[5])
+	if err != nil {
+		return nil, fmt.Errorf("invalid RRSIG inception: %v", err)
+	}
+	keyTag, err := strconv.ParseUint(parts[6], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RRSIG key tag: %s", parts[6])
+	}
+	signer, err := encodeDomainName(parts[7])
+	if err != nil {
+		return nil, fmt.Errorf("invalid RRSIG signer name: %v", err)
+	}
+	// The signature may be split into several whitespace-separated chunks.
+	signature, err := base64.StdEncoding.DecodeString(strings.Join(parts[8:], ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid RRSIG signature: %v", err)
+	}
+
+	encoded := make([]byte, 18, 18+len(signer)+len(signature))
+	binary.BigEndian.PutUint16(encoded[0:], uint16(covered))
+	encoded[2] = byte(algorithm)
+	encoded[3] = byte(labels)
+	binary.BigEndian.PutUint32(encoded[4:], uint32(originalTTL))
+	binary.BigEndian.PutUint32(encoded[8:], expiration)
+	binary.BigEndian.PutUint32(encoded[12:], inception)
+	binary.BigEndian.PutUint16(encoded[16:], uint16(keyTag))
+	encoded = append(encoded, signer...)
+	return append(encoded, signature...), nil
+}
+
+// decodeRRSIGData decodes RRSIG record data from the given byte slice.
+func decodeRRSIGData(b []byte) (string, error) {
+	if len(b) < 19 {
+		return "", fmt.Errorf("invalid RRSIG data length: %d", len(b))
+	}
+	signer, signature, err := splitDomainName(b[18:])
+	if err != nil {
+		return "", fmt.Errorf("invalid RRSIG signer name: %v", err)
+	}
+	return fmt.Sprintf("%s %d %d %d %s %s %d %s %s",
+		typeMnemonic(domain.RRType(binary.BigEndian.Uint16(b[0:2]))),
+		b[2],
+		b[3],
+		binary.BigEndian.Uint32(b[4:8]),
+		formatRRSIGTime(binary.BigEndian.Uint32(b[8:12])),
+		formatRRSIGTime(binary.BigEndian.Uint32(b[12:16])),
+		binary.BigEndian.Uint16(b[16:18]),
+		signer,
+		base64.StdEncoding.EncodeToString(signature),
+	), nil
+}
+
+// parseRRSIGTime accepts either the YYYYMMDDHHmmSS form or a plain count of
+// seconds since the epoch, as allowed by RFC 4034 §3.2.
+func parseRRSIGTime(s string) (uint32, error) {
+	if len(s) == len(rrsigTimeLayout) {
+		t, err := time.Parse(rrsigTimeLayout, s)
+		if err != nil {
+			return 0, err
+		}
+		//gosec:disable G115 -- RRSIG times are serial numbers modulo 2^32 (RFC 4034 §3.1.5)
+		return uint32(t.Unix()), nil
+	}
+	v, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(v), nil
+}
+
+// formatRRSIGTime renders a signature time in the YYYYMMDDHHmmSS form.
+func formatRRSIGTime(v uint32) string {
+	return time.Unix(int64(v), 0).UTC().Format(rrsigTimeLayout)
+}
@@ -0,0 +1,78 @@
+package rrdata
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRRSIGData_RoundTrip(t *testing.T) {
+	text := "MX 13 2 3600 20250201000000 20250101000000 12345 example.com AAECAw=="
+	encoded, err := encodeRRSIGData(text)
+	if err != nil {
+		t.Fatalf("encodeRRSIGData unexpected error: %v", err)
+	}
+	want := []byte{
+		0, 15, // type covered MX
+		13,               // algorithm
+		2,                // labels
+		0, 0, 0x0e, 0x10, // original TTL 3600
+		0x67, 0x9d, 0x64, 0x00, // expiration 2025-02-01
+		0x67, 0x74, 0x85, 0x80, // inception 2025-01-01
+		0x30, 0x39, // key tag 12345
+		7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0,
+		0, 1, 2, 3,
+	}
+	if !bytes.Equal(encoded, want) {
+		t.Fatalf("encodeRRSIGData = %v, want %v", encoded, want)
+	}
+	decoded, err := decodeRRSIGData(encoded)
+	if err != nil {
+		t.Fatalf("decodeRRSIGData unexpected error: %v", err)
+	}
+	if decoded != text {
+		t.Errorf("decodeRRSIGData = %q, want %q", decoded, text)
+	}
+}
+
+func TestEncodeRRSIGData_Variants(t *testing.T) {
+	// Epoch-second times, a root signer and an unknown covered type.
+	encoded, err := encodeRRSIGData("TYPE999 8 0 60 1738368000 1735689600 1 . AAEC")
+	if err != nil {
+		t.Fatalf("encodeRRSIGData unexpected error: %v", err)
+	}
+	decoded, err := decodeRRSIGData(encoded)
+	if err != nil {
+		t.Fatalf("decodeRRSIGData unexpected error: %v", err)
+	}
+	want := "TYPE999 8 0 60 20250201000000 20250101000000 1 . AAEC"
+	if decoded != want {
+		t.Errorf("decodeRRSIGData = %q, want %q", decoded, want)
+	}
+}
+
+func TestEncodeRRSIGData_Invalid(t *testing.T) {
+	valid := []string{"A", "13", "2", "300", "20250201000000", "20250101000000", "12345", "example.com", "AAEC"}
+	for i, bad := range []string{"BOGUS", "x", "x", "x", "2025020100000x", "x", "x", string(make([]byte, 64)) + ".com", "!!!"} {
+		fields := append([]string(nil), valid...)
+		fields[i] = bad
+		input := ""
+		for _, f := range fields {
+			input += f + " "
+		}
+		if _, err := encodeRRSIGData(input); err == nil {
+			t.Errorf("encodeRRSIGData(%q) expected error, got nil", input)
+		}
+	}
+	if _, err := encodeRRSIGData("A 13 2 300"); err == nil {
+		t.Error("encodeRRSIGData expected error for missing fields")
+	}
+}
+
+func TestDecodeRRSIGData_Invalid(t *testing.T) {
+	if _, err := decodeRRSIGData(make([]byte, 18)); err == nil {
+		t.Error("decodeRRSIGData expected error for missing signer")
+	}
+	if _, err := decodeRRSIGData(append(make([]byte, 18), 5, 'a')); err == nil {
+		t.Error("decodeRRSIGData expected error for truncated signer")
+	}
+}
@@ -0,0 +1,93 @@
+package rrdata
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// encodeNSECData encodes an NSEC record string into its binary representation (RFC 4034 §4).
+func encodeNSECData(data string) ([]byte, error) {
+	// data = "host.example.com. A MX RRSIG NSEC"
+	parts := strings.Fields(data)
+	if len(parts) < 1 {
+		return nil, fmt.Errorf("invalid NSEC record format (expected: next types...): %s", data)
+	}
+	next, err := encodeDomainName(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid NSEC next domain: %v", err)
+	}
+	bitmap, err := encodeTypeBitmap(parts[1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid NSEC type bitmap: %v", err)
+	}
+	return append(next, bitmap...), nil
+}
+
+// decodeNSECData decodes NSEC record data from the given byte slice.
+func decodeNSECData(b []byte) (string, error) {
+	next, rest, err := splitDomainName(b)
+	if err != nil {
+		return "", fmt.Errorf("invalid NSEC next domain: %v", err)
+	}
+	types, err := decodeTypeBitmap(rest)
+	if err != nil {
+		return "", fmt.Errorf("invalid NSEC type bitmap: %v", err)
+	}
+	return strings.Join(append([]string{next}, types...), " "), nil
+}
+
+// encodeTypeBitmap encodes type mnemonics as the windowed bitmap shared by
+// NSEC and NSEC3 records (RFC 4034 §4.1.2).
+func encodeTypeBitmap(mnemonics []string) ([]byte, error) {
+	types := make([]domain.RRType, 0, len(mnemonics))
+	for _, m := range mnemonics {
+		t, err := parseTypeMnemonic(m)
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+	}
+	slices.Sort(types)
+	types = slices.Compact(types)
+
+	var encoded []byte
+	for i := 0; i < len(types); {
+		window := byte(types[i] >> 8)
+		var bits [32]byte
+		length := 0
+		for ; i < len(types) && byte(types[i]>>8) == window; i++ {
+			low := byte(types[i])
+			bits[low/8] |= 0x80 >> (low % 8)
+			length = int(low/8) + 1
+		}
+		encoded = append(encoded, window, byte(length))
+		encoded = append(encoded, bits[:length]...)
+	}
+	return encoded, nil
+}
+
+// decodeTypeBitmap decodes a windowed type bitmap into type mnemonics.
+func decodeTypeBitmap(b []byte) ([]string, error) {
+	var types []string
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return nil, fmt.Errorf("truncated window header")
+		}
+		window, length := int(b[0]), int(b[1])
+		if length == 0 || length > 32 || len(b) < 2+length {
+			return nil, fmt.Errorf("invalid window length: %d", length)
+		}
+		for i, octet := range b[2 : 2+length] {
+			for bit := 0; bit < 8; bit++ {
+				if octet&(0x80>>bit) != 0 {
+					types = append(types, typeMnemonic(domain.RRType(window<<8+i*8+bit)))
+				}
+			}
+		}
+		b = b[2+length:]
+	}
+	return types, nil
+}
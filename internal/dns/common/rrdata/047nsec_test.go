@@ -0,0 +1,62 @@
+package rrdata
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestNSECData_RoundTrip(t *testing.T) {
+	encoded, err := encodeNSECData("host.example.com MX A RRSIG NSEC TYPE1234")
+	if err != nil {
+		t.Fatalf("encodeNSECData unexpected error: %v", err)
+	}
+	want := []byte{
+		4, 'h', 'o', 's', 't', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0,
+		0, 6, 0x40, 0x01, 0x00, 0x00, 0x00, 0x03, // window 0: A MX RRSIG NSEC
+		4, 27, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x20, // window 4: TYPE1234
+	}
+	if !bytes.Equal(encoded, want) {
+		t.Fatalf("encodeNSECData = %v, want %v", encoded, want)
+	}
+	decoded, err := decodeNSECData(encoded)
+	if err != nil {
+		t.Fatalf("decodeNSECData unexpected error: %v", err)
+	}
+	if decoded != "host.example.com A MX RRSIG NSEC TYPE1234" {
+		t.Errorf("decodeNSECData = %q", decoded)
+	}
+}
+
+func TestEncodeNSECData_Invalid(t *testing.T) {
+	for _, input := range []string{"", "host.example.com BOGUS", string(make([]byte, 64)) + ".com A"} {
+		if _, err := encodeNSECData(input); err == nil {
+			t.Errorf("encodeNSECData(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestDecodeTypeBitmap(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []byte
+		want    []string
+		wantErr bool
+	}{
+		{name: "empty", input: nil, want: nil},
+		{name: "ns soa", input: []byte{0, 1, 0x22}, want: []string{"NS", "SOA"}},
+		{name: "truncated header", input: []byte{0}, wantErr: true},
+		{name: "zero length window", input: []byte{0, 0}, wantErr: true},
+		{name: "window past end", input: []byte{0, 2, 0x40}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := decodeTypeBitmap(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: decodeTypeBitmap error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: decodeTypeBitmap = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
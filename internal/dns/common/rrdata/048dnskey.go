@@ -0,0 +1,49 @@
+package rrdata
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// encodeDNSKEYData encodes a DNSKEY record string into its binary representation (RFC 4034 §2).
+func encodeDNSKEYData(data string) ([]byte, error) {
+	// data = "257 3 15 l02Woi0iS8Aa25FQkUd9RMzZHJpBoRQwAQEX1SxZJA4="
+	parts := strings.Fields(data)
+	if len(parts) < 4 {
+		return nil, fmt.Errorf("invalid DNSKEY record format (expected: flags protocol algorithm key): %s", data)
+	}
+	flags, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNSKEY flags: %s", parts[0])
+	}
+	protocol, err := strconv.ParseUint(parts[1], 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNSKEY protocol: %s", parts[1])
+	}
+	algorithm, err := strconv.ParseUint(parts[2], 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNSKEY algorithm: %s", parts[2])
+	}
+	// The key may be split into several whitespace-separated chunks.
+	key, err := base64.StdEncoding.DecodeString(strings.Join(parts[3:], ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNSKEY public key: %v", err)
+	}
+	encoded := make([]byte, 4, 4+len(key))
+	binary.BigEndian.PutUint16(encoded, uint16(flags))
+	encoded[2] = byte(protocol)
+	encoded[3] = byte(algorithm)
+	return append(encoded, key...), nil
+}
+
+// decodeDNSKEYData decodes DNSKEY record data from the given byte slice.
+func decodeDNSKEYData(b []byte) (string, error) {
+	if len(b) < 5 {
+		return "", fmt.Errorf("invalid DNSKEY data length: %d", len(b))
+	}
+	flags := binary.BigEndian.Uint16(b[:2])
+	return fmt.Sprintf("%d %d %d %s", flags, b[2], b[3], base64.StdEncoding.EncodeToString(b[4:])), nil
+}
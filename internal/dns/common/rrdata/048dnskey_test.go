@@ -0,0 +1,46 @@
+package rrdata
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeDNSKEYData(t *testing.T) {
+	got, err := encodeDNSKEYData("257 3 15 AAEC AwQ=")
+	if err != nil {
+		t.Fatalf("encodeDNSKEYData unexpected error: %v", err)
+	}
+	want := []byte{1, 1, 3, 15, 0, 1, 2, 3, 4}
+	if !bytes.Equal(got, want) {
+		t.Errorf("encodeDNSKEYData = %v, want %v", got, want)
+	}
+}
+
+func TestEncodeDNSKEYData_Invalid(t *testing.T) {
+	invalidInputs := []string{
+		"",
+		"257 3 15",
+		"70000 3 15 AAEC",
+		"257 300 15 AAEC",
+		"257 3 x AAEC",
+		"257 3 15 !!!",
+	}
+	for _, input := range invalidInputs {
+		if _, err := encodeDNSKEYData(input); err == nil {
+			t.Errorf("encodeDNSKEYData(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestDecodeDNSKEYData(t *testing.T) {
+	got, err := decodeDNSKEYData([]byte{1, 0, 3, 13, 0, 1, 2})
+	if err != nil {
+		t.Fatalf("decodeDNSKEYData unexpected error: %v", err)
+	}
+	if got != "256 3 13 AAEC" {
+		t.Errorf("decodeDNSKEYData = %q, want %q", got, "256 3 13 AAEC")
+	}
+	if _, err := decodeDNSKEYData([]byte{1, 0, 3, 13}); err == nil {
+		t.Error("decodeDNSKEYData expected error for missing key")
+	}
+}
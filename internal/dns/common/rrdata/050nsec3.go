@@ -0,0 +1,99 @@
+package rrdata
+
+import (
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// base32Hex is the unpadded "Base 32 Encoding with Extended Hex Alphabet"
+// used for NSEC3 hashed owner names (RFC 5155 §3.3).
+var base32Hex = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// encodeNSEC3Data encodes an NSEC3 record string into its binary representation (RFC 5155 §3).
+func encodeNSEC3Data(data string) ([]byte, error) {
+	// data = "1 0 0 - 2T7B4G4VSA5SMI47K61MV5BV1A22BOJR A RRSIG"
+	parts := strings.Fields(data)
+	if len(parts) < 5 {
+		return nil, fmt.Errorf("invalid NSEC3 record format (expected: algorithm flags iterations salt next types...): %s", data)
+	}
+	params, err := encodeNSEC3Params(parts[:4])
+	if err != nil {
+		return nil, err
+	}
+	next, err := base32Hex.DecodeString(strings.ToUpper(parts[4]))
+	if err != nil || len(next) == 0 || len(next) > 255 {
+		return nil, fmt.Errorf("invalid NSEC3 next hashed owner: %s", parts[4])
+	}
+	bitmap, err := encodeTypeBitmap(parts[5:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid NSEC3 type bitmap: %v", err)
+	}
+	encoded := append(params, byte(len(next)))
+	encoded = append(encoded, next...)
+	return append(encoded, bitmap...), nil
+}
+
+// decodeNSEC3Data decodes NSEC3 record data from the given byte slice.
+func decodeNSEC3Data(b []byte) (string, error) {
+	params, rest, err := decodeNSEC3Params(b)
+	if err != nil {
+		return "", err
+	}
+	if len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+		return "", fmt.Errorf("invalid NSEC3 next hashed owner length")
+	}
+	next := base32Hex.EncodeToString(rest[1 : 1+rest[0]])
+	types, err := decodeTypeBitmap(rest[1+rest[0]:])
+	if err != nil {
+		return "", fmt.Errorf("invalid NSEC3 type bitmap: %v", err)
+	}
+	return strings.Join(append([]string{params, next}, types...), " "), nil
+}
+
+// encodeNSEC3Params encodes the hash algorithm, flags, iterations and salt
+// fields that NSEC3 and NSEC3PARAM records share. A salt of "-" is empty.
+func encodeNSEC3Params(parts []string) ([]byte, error) {
+	algorithm, err := strconv.ParseUint(parts[0], 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NSEC3 hash algorithm: %s", parts[0])
+	}
+	flags, err := strconv.ParseUint(parts[1], 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NSEC3 flags: %s", parts[1])
+	}
+	iterations, err := strconv.ParseUint(parts[2], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NSEC3 iterations: %s", parts[2])
+	}
+	var salt []byte
+	if parts[3] != "-" {
+		salt, err = hex.DecodeString(parts[3])
+		if err != nil || len(salt) > 255 {
+			return nil, fmt.Errorf("invalid NSEC3 salt: %s", parts[3])
+		}
+	}
+	encoded := make([]byte, 5, 5+len(salt))
+	encoded[0] = byte(algorithm)
+	encoded[1] = byte(flags)
+	binary.BigEndian.PutUint16(encoded[2:], uint16(iterations))
+	encoded[4] = byte(len(salt))
+	return append(encoded, salt...), nil
+}
+
+// decodeNSEC3Params decodes the shared NSEC3 parameter fields and returns
+// their presentation form and the remaining bytes.
+func decodeNSEC3Params(b []byte) (string, []byte, error) {
+	if len(b) < 5 || len(b) < 5+int(b[4]) {
+		return "", nil, fmt.Errorf("invalid NSEC3 data length: %d", len(b))
+	}
+	salt := "-"
+	if b[4] > 0 {
+		salt = fmt.Sprintf("%X", b[5:5+b[4]])
+	}
+	params := fmt.Sprintf("%d %d %d %s", b[0], b[1], binary.BigEndian.Uint16(b[2:4]), salt)
+	return params, b[5+b[4]:], nil
+}
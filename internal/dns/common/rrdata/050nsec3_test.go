@@ -0,0 +1,60 @@
+package rrdata
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNSEC3Data_RoundTrip(t *testing.T) {
+	// RFC 5155 Appendix A example record for example.
+	text := "1 1 12 AABBCCDD 2T7B4G4VSA5SMI47K61MV5BV1A22BOJR NS SOA MX RRSIG DNSKEY NSEC3PARAM"
+	encoded, err := encodeNSEC3Data(text)
+	if err != nil {
+		t.Fatalf("encodeNSEC3Data unexpected error: %v", err)
+	}
+	if !bytes.Equal(encoded[:9], []byte{1, 1, 0, 12, 4, 0xaa, 0xbb, 0xcc, 0xdd}) {
+		t.Errorf("encodeNSEC3Data parameters = %v", encoded[:9])
+	}
+	if encoded[9] != 20 {
+		t.Errorf("encodeNSEC3Data hash length = %d, want 20", encoded[9])
+	}
+	decoded, err := decodeNSEC3Data(encoded)
+	if err != nil {
+		t.Fatalf("decodeNSEC3Data unexpected error: %v", err)
+	}
+	if decoded != text {
+		t.Errorf("decodeNSEC3Data = %q, want %q", decoded, text)
+	}
+}
+
+func TestEncodeNSEC3Data_Invalid(t *testing.T) {
+	invalidInputs := []string{
+		"1 0 0 -",
+		"x 0 0 - 2T7B4G4VSA5SMI47K61MV5BV1A22BOJR",
+		"1 x 0 - 2T7B4G4VSA5SMI47K61MV5BV1A22BOJR",
+		"1 0 70000 - 2T7B4G4VSA5SMI47K61MV5BV1A22BOJR",
+		"1 0 0 XYZ 2T7B4G4VSA5SMI47K61MV5BV1A22BOJR",
+		"1 0 0 - !!!",
+		"1 0 0 - 2T7B4G4VSA5SMI47K61MV5BV1A22BOJR BOGUS",
+	}
+	for _, input := range invalidInputs {
+		if _, err := encodeNSEC3Data(input); err == nil {
+			t.Errorf("encodeNSEC3Data(%q) expected error, got nil", input)
+		}
+	}
+}
+
+func TestDecodeNSEC3Data_Invalid(t *testing.T) {
+	invalidInputs := [][]byte{
+		{1, 0, 0, 0},             // short parameters
+		{1, 0, 0, 0, 2, 0xaa},    // salt past end
+		{1, 0, 0, 0, 0},          // missing hash length
+		{1, 0, 0, 0, 0, 2, 1},    // hash past end
+		{1, 0, 0, 0, 0, 1, 1, 0}, // bad bitmap
+	}
+	for _, input := range invalidInputs {
+		if _, err := decodeNSEC3Data(input); err == nil {
+			t.Errorf("decodeNSEC3Data(%v) expected error, got nil", input)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package rrdata
+
+import (
+	"fmt"
+	"strings"
+)
+
+// encodeNSEC3PARAMData encodes an NSEC3PARAM record string into its binary representation (RFC 5155 §4).
+func encodeNSEC3PARAMData(data string) ([]byte, error) {
+	// data = "1 0 0 -"
+	parts := strings.Fields(data)
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("invalid NSEC3PARAM record format (expected: algorithm flags iterations salt): %s", data)
+	}
+	return encodeNSEC3Params(parts)
+}
+
+// decodeNSEC3PARAMData decodes NSEC3PARAM record data from the given byte slice.
+func decodeNSEC3PARAMData(b []byte) (string, error) {
+	params, rest, err := decodeNSEC3Params(b)
+	if err != nil {
+		return "", err
+	}
+	if len(rest) != 0 {
+		return "", fmt.Errorf("invalid NSEC3PARAM data length: %d", len(b))
+	}
+	return params, nil
+}
@@ -0,0 +1,35 @@
+package rrdata
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNSEC3PARAMData_RoundTrip(t *testing.T) {
+	encoded, err := encodeNSEC3PARAMData("1 0 10 AABB")
+	if err != nil {
+		t.Fatalf("encodeNSEC3PARAMData unexpected error: %v", err)
+	}
+	if !bytes.Equal(encoded, []byte{1, 0, 0, 10, 2, 0xaa, 0xbb}) {
+		t.Errorf("encodeNSEC3PARAMData = %v", encoded)
+	}
+	decoded, err := decodeNSEC3PARAMData(encoded)
+	if err != nil {
+		t.Fatalf("decodeNSEC3PARAMData unexpected error: %v", err)
+	}
+	if decoded != "1 0 10 AABB" {
+		t.Errorf("decodeNSEC3PARAMData = %q", decoded)
+	}
+}
+
+func TestNSEC3PARAMData_Invalid(t *testing.T) {
+	if _, err := encodeNSEC3PARAMData("1 0 10"); err == nil {
+		t.Error("encodeNSEC3PARAMData expected error for missing salt")
+	}
+	if _, err := decodeNSEC3PARAMData([]byte{1, 0, 0, 10, 0, 0xff}); err == nil {
+		t.Error("decodeNSEC3PARAMData expected error for trailing data")
+	}
+	if _, err := decodeNSEC3PARAMData([]byte{1, 0}); err == nil {
+		t.Error("decodeNSEC3PARAMData expected error for short data")
+	}
+}
@@ -32,13 +32,17 @@ func Decode(rrType domain.RRType, data []byte) (string, error) {
 	case domain.RRTypeOPT: // 41
 		return decoderNotImplemented(domain.RRTypeOPT)
 	case domain.RRTypeDS: // 43
-		return decoderNotImplemented(domain.RRTypeDS)
+		return decodeDSData(data)
 	case domain.RRTypeRRSIG: // 46
-		return decoderNotImplemented(domain.RRTypeRRSIG)
+		return decodeRRSIGData(data)
 	case domain.RRTypeNSEC: // 47
-		return decoderNotImplemented(domain.RRTypeNSEC)
+		return decodeNSECData(data)
 	case domain.RRTypeDNSKEY: // 48
-		return decoderNotImplemented(domain.RRTypeDNSKEY)
+		return decodeDNSKEYData(data)
+	case domain.RRTypeNSEC3: // 50
+		return decodeNSEC3Data(data)
+	case domain.RRTypeNSEC3PARAM: // 51
+		return decodeNSEC3PARAMData(data)
 	case domain.RRTypeTLSA: // 52
 		return decoderNotImplemented(domain.RRTypeTLSA)
 	case domain.RRTypeSVCB: // 64
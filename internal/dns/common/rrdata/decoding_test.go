@@ -27,10 +27,18 @@ func TestDecode_SwitchCoverage(t *testing.T) {
 		{"SRV", domain.RRTypeSRV, append([]byte{0, 1, 0, 2, 0, 80}, []byte{6, 't', 'a', 'r', 'g', 'e', 't', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0}...), false, false},
 		{"NAPTR not implemented", domain.RRTypeNAPTR, []byte{}, true, false},
 		{"OPT not allowed", domain.RRTypeOPT, []byte{}, true, false},
-		{"DS not implemented", domain.RRTypeDS, []byte{}, true, false},
-		{"RRSIG not implemented", domain.RRTypeRRSIG, []byte{}, true, false},
-		{"NSEC not implemented", domain.RRTypeNSEC, []byte{}, true, false},
-		{"DNSKEY not implemented", domain.RRTypeDNSKEY, []byte{}, true, false},
+		{"DS", domain.RRTypeDS, []byte{0x4f, 0x66, 8, 2, 0xe0}, false, false},
+		{"DS too short", domain.RRTypeDS, []byte{}, true, false},
+		{"RRSIG", domain.RRTypeRRSIG, append(make([]byte, 18), 0, 1, 2), false, false},
+		{"RRSIG too short", domain.RRTypeRRSIG, []byte{}, true, false},
+		{"NSEC", domain.RRTypeNSEC, []byte{0, 0, 1, 0x40}, false, false},
+		{"NSEC truncated", domain.RRTypeNSEC, []byte{}, true, false},
+		{"DNSKEY", domain.RRTypeDNSKEY, []byte{1, 1, 3, 15, 0}, false, false},
+		{"DNSKEY too short", domain.RRTypeDNSKEY, []byte{}, true, false},
+		{"NSEC3", domain.RRTypeNSEC3, []byte{1, 0, 0, 0, 0, 1, 0xff}, false, false},
+		{"NSEC3 too short", domain.RRTypeNSEC3, []byte{}, true, false},
+		{"NSEC3PARAM", domain.RRTypeNSEC3PARAM, []byte{1, 0, 0, 10, 0}, false, false},
+		{"NSEC3PARAM too short", domain.RRTypeNSEC3PARAM, []byte{}, true, false},
 		{"TLSA not implemented", domain.RRTypeTLSA, []byte{}, true, false},
 		{"SVCB not implemented", domain.RRTypeSVCB, []byte{}, true, false},
 		{"HTTPS not implemented", domain.RRTypeHTTPS, []byte{}, true, false},
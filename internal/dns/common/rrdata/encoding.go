@@ -32,13 +32,17 @@ func Encode(rrType domain.RRType, data string) ([]byte, error) {
 	case domain.RRTypeOPT: // 41
 		return encoderNotImplemented(domain.RRTypeOPT)
 	case domain.RRTypeDS: // 43
-		return encoderNotImplemented(domain.RRTypeDS)
+		return encodeDSData(data)
 	case domain.RRTypeRRSIG: // 46
-		return encoderNotImplemented(domain.RRTypeRRSIG)
+		return encodeRRSIGData(data)
 	case domain.RRTypeNSEC: // 47
-		return encoderNotImplemented(domain.RRTypeNSEC)
+		return encodeNSECData(data)
 	case domain.RRTypeDNSKEY: // 48
-		return encoderNotImplemented(domain.RRTypeDNSKEY)
+		return encodeDNSKEYData(data)
+	case domain.RRTypeNSEC3: // 50
+		return encodeNSEC3Data(data)
+	case domain.RRTypeNSEC3PARAM: // 51
+		return encodeNSEC3PARAMData(data)
 	case domain.RRTypeTLSA: // 52
 		return encoderNotImplemented(domain.RRTypeTLSA)
 	case domain.RRTypeSVCB: // 64
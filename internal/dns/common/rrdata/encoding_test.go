@@ -53,10 +53,12 @@ func TestEncode_SwitchCoverage(t *testing.T) {
 		{"SRV", domain.RRTypeSRV, "1 2 80 target.example.com", false, false},
 		{"NAPTR not implemented", domain.RRTypeNAPTR, "ignored", true, false},
 		{"OPT not allowed", domain.RRTypeOPT, "ignored", true, false},
-		{"DS not implemented", domain.RRTypeDS, "ignored", true, false},
-		{"RRSIG not implemented", domain.RRTypeRRSIG, "ignored", true, false},
-		{"NSEC not implemented", domain.RRTypeNSEC, "ignored", true, false},
-		{"DNSKEY not implemented", domain.RRTypeDNSKEY, "ignored", true, false},
+		{"DS", domain.RRTypeDS, "20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D", false, false},
+		{"RRSIG", domain.RRTypeRRSIG, "A 13 2 300 20250201000000 20250101000000 12345 example.com AAEC", false, false},
+		{"NSEC", domain.RRTypeNSEC, "b.example.com A RRSIG NSEC", false, false},
+		{"DNSKEY", domain.RRTypeDNSKEY, "257 3 15 AAEC", false, false},
+		{"NSEC3", domain.RRTypeNSEC3, "1 0 0 - 2T7B4G4VSA5SMI47K61MV5BV1A22BOJR A", false, false},
+		{"NSEC3PARAM", domain.RRTypeNSEC3PARAM, "1 0 0 -", false, false},
 		{"TLSA not implemented", domain.RRTypeTLSA, "ignored", true, false},
 		{"SVCB not implemented", domain.RRTypeSVCB, "ignored", true, false},
 		{"HTTPS not implemented", domain.RRTypeHTTPS, "ignored", true, false},
@@ -5,6 +5,7 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/knadh/koanf/providers/env/v2"
@@ -16,10 +17,67 @@ import (
 type AppConfig struct {
 	CacheSize uint `koanf:"cache_size" validate:"required,gte=1"`
 
+	// CacheMaxBytes bounds the response cache by the approximate memory its entries use instead
+	// of by CacheSize, using a sharded cache that scales better with concurrent queries. 0 keeps
+	// the entry-count bound.
+	CacheMaxBytes int64 `koanf:"cache_max_bytes" validate:"gte=0"`
+
+	// CacheShards is the number of independently locked shards of the byte-bounded cache.
+	CacheShards int `koanf:"cache_shards" validate:"required,gte=1,lte=4096"`
+
 	// DisableCache disables DNS response caching when set to true.
 	// Useful for testing scenarios where cache behavior needs to be bypassed.
 	DisableCache bool `koanf:"disable_cache"`
 
+	// CacheStaleWindow keeps cached answers this long after they expire so they can be
+	// served when upstream resolution fails or is slow (RFC 8767). 0 disables serve-stale.
+	CacheStaleWindow time.Duration `koanf:"cache_stale_window" validate:"gte=0"`
+
+	// CacheSnapshotFile is where the cache is saved on shutdown and loaded from at startup,
+	// so a restart does not begin with a cold cache. Leave empty to disable snapshots.
+	CacheSnapshotFile string `koanf:"cache_snapshot_file"`
+
+	// CacheSnapshotInterval also saves the cache snapshot this often while running, limiting
+	// what a crash loses. 0 saves only on shutdown.
+	CacheSnapshotInterval time.Duration `koanf:"cache_snapshot_interval" validate:"gte=0"`
+
+	// StaleAnswerTimeout is how long a query with a stale answer waits for upstream before
+	// the stale answer is sent; the refresh continues in the background. 0 waits for upstream to fail.
+	StaleAnswerTimeout time.Duration `koanf:"stale_answer_timeout" validate:"gte=0"`
+
+	// StaleAnswerTTL is the TTL given to records in a stale answer, so clients come back
+	// soon for a fresh one (RFC 8767 §4 recommends 30 seconds).
+	StaleAnswerTTL time.Duration `koanf:"stale_answer_ttl" validate:"required,min=1s"`
+
+	// PrefetchMinHits refreshes a cached answer in the background once it has been served this
+	// many times and is in the last PrefetchPercent of its TTL, so popular names never go cold.
+	// 0 disables prefetch.
+	PrefetchMinHits int `koanf:"prefetch_min_hits" validate:"gte=0"`
+
+	// PrefetchPercent is the final share of a cached answer's TTL, in percent, in which it is prefetched.
+	PrefetchPercent int `koanf:"prefetch_percent" validate:"required,gte=1,lte=50"`
+
+	// CacheMinTTL raises the TTL of shorter-lived upstream answers, including TTL 0, when they are cached.
+	CacheMinTTL time.Duration `koanf:"cache_min_ttl" validate:"gte=0"`
+
+	// CacheMaxTTL caps the TTL of cached upstream answers. 0 leaves them uncapped.
+	CacheMaxTTL time.Duration `koanf:"cache_max_ttl" validate:"omitempty,gtefield=CacheMinTTL"`
+
+	// CacheNegativeMinTTL is the least time empty upstream answers (NXDOMAIN or NODATA) are cached.
+	// It raises the negative TTL taken from the SOA record; 0 leaves it as received.
+	CacheNegativeMinTTL time.Duration `koanf:"cache_negative_min_ttl" validate:"gte=0"`
+
+	// CacheNegativeMaxTTL caps how long empty upstream answers are cached, including TTL overrides.
+	// 0 leaves them uncapped.
+	CacheNegativeMaxTTL time.Duration `koanf:"cache_negative_max_ttl" validate:"omitempty,gtefield=CacheNegativeMinTTL"`
+
+	// CacheTTLOverrides caches answers for a domain suffix with a fixed TTL, ignoring the limits above.
+	// Each rule has the form "suffix=duration"; see ParseTTLOverride.
+	CacheTTLOverrides []string `koanf:"cache_ttl_overrides" validate:"omitempty,dive,ttl_override"`
+
+	// NeverCache lists domain suffixes whose upstream answers are never cached.
+	NeverCache []string `koanf:"never_cache" validate:"omitempty,dive,required"`
+
 	// Env is the runtime environment, either "dev" or "prod".
 	Env string `koanf:"env" validate:"required,oneof=dev prod"`
 
@@ -38,6 +96,140 @@ type AppConfig struct {
 	// MaxRecursion limits in-zone CNAME (or future alias) chase depth.
 	// Prevents infinite loops; 0 or negative will be rejected by validation (must be >=1).
 	MaxRecursion int `koanf:"max_recursion" validate:"required,gte=1"`
+
+	// UpstreamFailureThreshold is the number of consecutive failures after which
+	// an upstream server is sidelined by the circuit breaker.
+	UpstreamFailureThreshold int `koanf:"upstream_failure_threshold" validate:"required,gte=1"`
+
+	// UpstreamBackoff is how long a failing upstream server is sidelined before it is probed again.
+	// Repeated trips double the period up to a fixed cap.
+	UpstreamBackoff time.Duration `koanf:"upstream_backoff" validate:"required,gt=0"`
+
+	// UpstreamProbeInterval is how often sidelined upstream servers are checked in the background.
+	UpstreamProbeInterval time.Duration `koanf:"upstream_probe_interval" validate:"required,gt=0"`
+
+	// UpstreamStrategy selects how upstream servers are ordered for each query:
+	// "strict", "round_robin", "random", "weighted", or "fastest".
+	UpstreamStrategy string `koanf:"upstream_strategy" validate:"required,oneof=strict round_robin random weighted fastest"`
+
+	// UpstreamParallel races several upstream servers per query instead of trying them one at a time.
+	UpstreamParallel bool `koanf:"upstream_parallel"`
+
+	// UpstreamRaceCount limits parallel racing to the first N servers chosen by the strategy.
+	// 0 races every server.
+	UpstreamRaceCount int `koanf:"upstream_race_count" validate:"gte=0"`
+
+	// UpstreamWeights are the relative weights for the "weighted" strategy, in the same order as Servers.
+	// Leave empty to weigh every server equally.
+	UpstreamWeights []int `koanf:"upstream_weights" validate:"omitempty,dive,gte=1"`
+
+	// UpstreamCaseRandomization enables DNS 0x20: upstream query names are sent with random
+	// letter case that the response must echo exactly. Servers that fold case fall back automatically.
+	UpstreamCaseRandomization bool `koanf:"upstream_case_randomization"`
+
+	// Iterative resolves queries from the root name servers instead of forwarding them to Servers.
+	// Forward zones still use their own servers.
+	Iterative bool `koanf:"iterative"`
+
+	// RootHints overrides the root name server addresses (ip:port) used by the iterative resolver.
+	// Leave empty to use the built-in IANA root servers.
+	RootHints []string `koanf:"root_hints" validate:"omitempty,dive,ip_port"`
+
+	// QnameMinimisation makes the iterative resolver send each name server only the labels
+	// it needs to see (RFC 9156).
+	QnameMinimisation bool `koanf:"qname_minimisation"`
+
+	// DNSSEC validates answers from Servers against the chain of trust (RFC 4035): bogus answers
+	// become SERVFAIL and secure ones carry the AD bit. It cannot be combined with Iterative yet.
+	DNSSEC bool `koanf:"dnssec" validate:"excluded_with=Iterative"`
+
+	// DNSSECTrustAnchor is a file of DS or DNSKEY trust anchors in zone file format.
+	// Leave empty to use the built-in IANA root anchors.
+	DNSSECTrustAnchor string `koanf:"dnssec_trust_anchor"`
+
+	// DNSSECKeyDir is a directory of BIND-format key pairs (K<zone>+<alg>+<tag>.key and .private).
+	// Authoritative zones with keys there are signed online. Leave empty to serve zones unsigned.
+	DNSSECKeyDir string `koanf:"dnssec_key_dir"`
+
+	// DNSSECNSEC3 proves denial of existence in signed zones with NSEC3 (RFC 5155) instead of NSEC.
+	DNSSECNSEC3 bool `koanf:"dnssec_nsec3"`
+
+	// DNSSECSignatureValidity is how long zone signatures are valid; they are renewed half way through.
+	DNSSECSignatureValidity time.Duration `koanf:"dnssec_signature_validity" validate:"required,min=1h"`
+
+	// ForwardZones routes domain suffixes to their own upstream servers (conditional forwarding).
+	// Each rule has the form "suffix=server[+server...][;udp|tcp][;timeout]"; see ParseForwardZone.
+	ForwardZones []string `koanf:"forward_zones" validate:"omitempty,dive,forward_zone"`
+
+	// MetricsAddr is the host:port of an HTTP listener serving Prometheus metrics at /metrics,
+	// e.g. ":9153". Leave empty to disable it.
+	MetricsAddr string `koanf:"metrics_addr" validate:"omitempty,hostname_port"`
+
+	// TracingExporter sends trace spans of query handling to an OpenTelemetry collector ("otlp"),
+	// to stdout ("stdout") or to TracingFile ("file"), as OTLP/JSON. Leave empty to disable tracing.
+	TracingExporter string `koanf:"tracing_exporter" validate:"omitempty,oneof=otlp stdout file"`
+
+	// TracingEndpoint is the full URL of the collector's OTLP/HTTP traces receiver,
+	// e.g. "http://localhost:4318/v1/traces".
+	TracingEndpoint string `koanf:"tracing_endpoint" validate:"required_if=TracingExporter otlp,omitempty,http_url"`
+
+	// TracingFile is the file spans are appended to, one JSON request per line.
+	TracingFile string `koanf:"tracing_file" validate:"required_if=TracingExporter file"`
+
+	// TracingSampleRatio is the share of queries traced, from 0 to 1.
+	TracingSampleRatio float64 `koanf:"tracing_sample_ratio" validate:"gte=0,lte=1"`
+
+	// QueryLogFile is where every answered query is logged as a line of JSON. Leave empty to disable it.
+	QueryLogFile string `koanf:"query_log_file"`
+
+	// QueryLogMaxBytes rotates the query log before it grows past this size. 0 disables size-based rotation.
+	QueryLogMaxBytes int64 `koanf:"query_log_max_bytes" validate:"gte=0"`
+
+	// QueryLogRotateInterval rotates the query log once it has been written to for this long.
+	// 0 disables time-based rotation.
+	QueryLogRotateInterval time.Duration `koanf:"query_log_rotate_interval" validate:"gte=0"`
+
+	// QueryLogMaxBackups is the number of rotated query logs kept. 0 keeps them all.
+	QueryLogMaxBackups int `koanf:"query_log_max_backups" validate:"gte=0"`
+
+	// QueryLogMaxAge removes rotated query logs older than this. 0 keeps them regardless of age.
+	QueryLogMaxAge time.Duration `koanf:"query_log_max_age" validate:"gte=0"`
+
+	// QueryLogAnonymize hides client addresses in the query log: "truncate" keeps only the /24 (IPv4)
+	// or /48 (IPv6) network, "hash" logs a keyed hash. Leave empty to log addresses as they are.
+	QueryLogAnonymize string `koanf:"query_log_anonymize" validate:"omitempty,oneof=truncate hash"`
+
+	// QueryLogHashKey keys the "hash" anonymization, so hashes stay stable across restarts.
+	// Leave empty to use a random key per run.
+	QueryLogHashKey string `koanf:"query_log_hash_key"`
+
+	// QueryHistoryDir holds the searchable query history. Leave empty to disable it.
+	QueryHistoryDir string `koanf:"query_history_dir"`
+
+	// QueryHistoryRetention is how long queries are kept in the query history before they are pruned.
+	QueryHistoryRetention time.Duration `koanf:"query_history_retention" validate:"gt=0"`
+
+	// DnstapOutput sends dnstap messages to a collector on a unix socket ("unix") or a TCP address
+	// ("tcp"), or writes them to a file ("file"). Leave empty to disable dnstap.
+	DnstapOutput string `koanf:"dnstap_output" validate:"omitempty,oneof=unix tcp file"`
+
+	// DnstapAddress is the socket path, host:port or file path dnstap messages are sent to.
+	DnstapAddress string `koanf:"dnstap_address" validate:"required_with=DnstapOutput"`
+
+	// DnstapIdentity names this server in dnstap messages. Leave empty to use the hostname.
+	DnstapIdentity string `koanf:"dnstap_identity"`
+
+	// AdminAddr is the host:port of an HTTP listener serving the admin API, e.g. "127.0.0.1:8053".
+	// It requires AdminToken. Leave empty to disable it.
+	AdminAddr string `koanf:"admin_addr" validate:"omitempty,hostname_port"`
+
+	// AdminSocket is the path of a unix socket serving the admin API, reachable only by users
+	// with access to the file. It does not require AdminToken. Leave empty to disable it.
+	AdminSocket string `koanf:"admin_socket"`
+
+	// AdminToken is the bearer token admin API requests must present. It is required with
+	// AdminAddr and, when set, also applies to AdminSocket.
+	AdminToken string `koanf:"admin_token" validate:"required_with=AdminAddr"`
 }
 
 // DEFAULT_APP_CONFIG defines the default application configuration settings for the DNS service.
@@ -45,6 +237,7 @@ type AppConfig struct {
 // and upstream DNS servers.
 var DEFAULT_APP_CONFIG = AppConfig{
 	CacheSize:    1000,
+	CacheShards:  64,
 	DisableCache: false,
 	Env:          "prod",
 	LogLevel:     "info",
@@ -52,6 +245,31 @@ var DEFAULT_APP_CONFIG = AppConfig{
 	ZoneDir:      "/etc/rr-dns/zones/",
 	Servers:      []string{"1.1.1.1:53", "1.0.0.1:53"},
 	MaxRecursion: 8,
+
+	StaleAnswerTimeout: 1800 * time.Millisecond,
+	StaleAnswerTTL:     30 * time.Second,
+	PrefetchPercent:    10,
+
+	CacheMaxTTL:         24 * time.Hour,
+	CacheNegativeMaxTTL: 3 * time.Hour,
+
+	UpstreamFailureThreshold: 3,
+	UpstreamBackoff:          5 * time.Second,
+	UpstreamProbeInterval:    5 * time.Second,
+	UpstreamStrategy:         "strict",
+	UpstreamRaceCount:        2,
+
+	QnameMinimisation: true,
+
+	DNSSECSignatureValidity: 14 * 24 * time.Hour,
+
+	TracingSampleRatio: 1,
+
+	QueryLogMaxBytes:       100 << 20,
+	QueryLogRotateInterval: 24 * time.Hour,
+	QueryLogMaxBackups:     7,
+
+	QueryHistoryRetention: 7 * 24 * time.Hour,
 }
 
 // validIPPort validates whether the provided field value is a valid IP address and port combination.
@@ -59,7 +277,11 @@ var DEFAULT_APP_CONFIG = AppConfig{
 // is valid and both the IP and port are non-empty; otherwise, it returns false.
 func validIPPort(fl validator.FieldLevel) bool {
 	// stringify the field value to get the IP:Port format.
-	addr := fl.Field().String()
+	return isIPPort(fl.Field().String())
+}
+
+// isIPPort reports whether addr is a valid "IP:Port" combination.
+func isIPPort(addr string) bool {
 	// Split the address into IP and port.
 	ip, port, err := net.SplitHostPort(addr)
 	if err != nil || ip == "" || port == "" {
@@ -109,11 +331,17 @@ var defaultLoader = func(k *koanf.Koanf) error {
 	return k.Load(structs.Provider(DEFAULT_APP_CONFIG, "koanf"), nil)
 }
 
-// registerValidation registers a custom validation function "ip_port" with the provided validator.
-// It associates the "ip_port" tag with the validIPPort validation logic.
-// Returns an error if registration fails.
+// registerValidation registers the custom validation functions with the provided validator.
+// It associates the "ip_port" tag with validIPPort, the "forward_zone" tag with validForwardZone,
+// and the "ttl_override" tag with validTTLOverride. Returns an error if registration fails.
 var registerValidation = func(v *validator.Validate) error {
-	return v.RegisterValidation("ip_port", validIPPort)
+	if err := v.RegisterValidation("ip_port", validIPPort); err != nil {
+		return err
+	}
+	if err := v.RegisterValidation("forward_zone", validForwardZone); err != nil {
+		return err
+	}
+	return v.RegisterValidation("ttl_override", validTTLOverride)
 }
 
 // Load parses environment variables and returns an AppConfig instance.
@@ -5,6 +5,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/knadh/koanf/v2"
@@ -18,6 +19,27 @@ func TestLoad_Defaults(t *testing.T) {
 	_ = os.Unsetenv("DNS_ZONE_DIR")
 	_ = os.Unsetenv("DNS_SERVERS")
 	_ = os.Unsetenv("DNS_MAX_RECURSION")
+	_ = os.Unsetenv("DNS_UPSTREAM_FAILURE_THRESHOLD")
+	_ = os.Unsetenv("DNS_UPSTREAM_BACKOFF")
+	_ = os.Unsetenv("DNS_UPSTREAM_PROBE_INTERVAL")
+	_ = os.Unsetenv("DNS_UPSTREAM_STRATEGY")
+	_ = os.Unsetenv("DNS_UPSTREAM_PARALLEL")
+	_ = os.Unsetenv("DNS_UPSTREAM_RACE_COUNT")
+	_ = os.Unsetenv("DNS_UPSTREAM_WEIGHTS")
+	_ = os.Unsetenv("DNS_UPSTREAM_CASE_RANDOMIZATION")
+	_ = os.Unsetenv("DNS_ITERATIVE")
+	_ = os.Unsetenv("DNS_ROOT_HINTS")
+	_ = os.Unsetenv("DNS_QNAME_MINIMISATION")
+	_ = os.Unsetenv("DNS_DNSSEC")
+	_ = os.Unsetenv("DNS_DNSSEC_TRUST_ANCHOR")
+	_ = os.Unsetenv("DNS_DNSSEC_KEY_DIR")
+	_ = os.Unsetenv("DNS_DNSSEC_NSEC3")
+	_ = os.Unsetenv("DNS_DNSSEC_SIGNATURE_VALIDITY")
+	_ = os.Unsetenv("DNS_CACHE_STALE_WINDOW")
+	_ = os.Unsetenv("DNS_STALE_ANSWER_TIMEOUT")
+	_ = os.Unsetenv("DNS_STALE_ANSWER_TTL")
+	_ = os.Unsetenv("DNS_PREFETCH_MIN_HITS")
+	_ = os.Unsetenv("DNS_PREFETCH_PERCENT")
 
 	cfg, err := Load()
 	if err != nil {
@@ -48,6 +70,103 @@ func TestLoad_Defaults(t *testing.T) {
 	if cfg.MaxRecursion != 8 {
 		t.Errorf("expected MaxRecursion=8, got %d", cfg.MaxRecursion)
 	}
+	if cfg.UpstreamFailureThreshold != 3 {
+		t.Errorf("expected UpstreamFailureThreshold=3, got %d", cfg.UpstreamFailureThreshold)
+	}
+	if cfg.UpstreamBackoff != 5*time.Second {
+		t.Errorf("expected UpstreamBackoff=5s, got %v", cfg.UpstreamBackoff)
+	}
+	if cfg.UpstreamProbeInterval != 5*time.Second {
+		t.Errorf("expected UpstreamProbeInterval=5s, got %v", cfg.UpstreamProbeInterval)
+	}
+	if cfg.UpstreamStrategy != "strict" {
+		t.Errorf("expected UpstreamStrategy=strict, got %q", cfg.UpstreamStrategy)
+	}
+	if cfg.UpstreamParallel {
+		t.Error("expected UpstreamParallel=false")
+	}
+	if cfg.UpstreamCaseRandomization {
+		t.Error("expected UpstreamCaseRandomization=false")
+	}
+	if cfg.UpstreamRaceCount != 2 {
+		t.Errorf("expected UpstreamRaceCount=2, got %d", cfg.UpstreamRaceCount)
+	}
+	if len(cfg.UpstreamWeights) != 0 {
+		t.Errorf("expected no UpstreamWeights, got %v", cfg.UpstreamWeights)
+	}
+	if cfg.Iterative {
+		t.Error("expected Iterative=false")
+	}
+	if len(cfg.RootHints) != 0 {
+		t.Errorf("expected no RootHints, got %v", cfg.RootHints)
+	}
+	if cfg.DNSSEC {
+		t.Error("expected DNSSEC=false")
+	}
+	if cfg.DNSSECTrustAnchor != "" {
+		t.Errorf("expected no DNSSECTrustAnchor, got %q", cfg.DNSSECTrustAnchor)
+	}
+	if cfg.DNSSECKeyDir != "" {
+		t.Errorf("expected no DNSSECKeyDir, got %q", cfg.DNSSECKeyDir)
+	}
+	if cfg.DNSSECNSEC3 {
+		t.Error("expected DNSSECNSEC3=false")
+	}
+	if cfg.DNSSECSignatureValidity != 14*24*time.Hour {
+		t.Errorf("expected DNSSECSignatureValidity=336h, got %v", cfg.DNSSECSignatureValidity)
+	}
+	if !cfg.QnameMinimisation {
+		t.Error("expected QnameMinimisation=true")
+	}
+	if cfg.CacheStaleWindow != 0 {
+		t.Errorf("expected CacheStaleWindow=0, got %v", cfg.CacheStaleWindow)
+	}
+	if cfg.StaleAnswerTimeout != 1800*time.Millisecond {
+		t.Errorf("expected StaleAnswerTimeout=1.8s, got %v", cfg.StaleAnswerTimeout)
+	}
+	if cfg.StaleAnswerTTL != 30*time.Second {
+		t.Errorf("expected StaleAnswerTTL=30s, got %v", cfg.StaleAnswerTTL)
+	}
+	if cfg.PrefetchMinHits != 0 {
+		t.Errorf("expected PrefetchMinHits=0, got %d", cfg.PrefetchMinHits)
+	}
+	if cfg.PrefetchPercent != 10 {
+		t.Errorf("expected PrefetchPercent=10, got %d", cfg.PrefetchPercent)
+	}
+	if cfg.CacheMinTTL != 0 || cfg.CacheMaxTTL != 24*time.Hour {
+		t.Errorf("expected cache ttl limits 0..24h, got %v..%v", cfg.CacheMinTTL, cfg.CacheMaxTTL)
+	}
+	if cfg.CacheNegativeMinTTL != 0 || cfg.CacheNegativeMaxTTL != 3*time.Hour {
+		t.Errorf("expected negative ttl limits 0..3h, got %v..%v", cfg.CacheNegativeMinTTL, cfg.CacheNegativeMaxTTL)
+	}
+	if cfg.CacheMaxBytes != 0 || cfg.CacheShards != 64 {
+		t.Errorf("expected entry-bounded cache with 64 shards, got %d bytes and %d shards", cfg.CacheMaxBytes, cfg.CacheShards)
+	}
+	if cfg.CacheSnapshotFile != "" || cfg.CacheSnapshotInterval != 0 {
+		t.Errorf("expected cache snapshots disabled, got %q every %v", cfg.CacheSnapshotFile, cfg.CacheSnapshotInterval)
+	}
+	if len(cfg.CacheTTLOverrides) != 0 || len(cfg.NeverCache) != 0 {
+		t.Errorf("expected no ttl overrides or never-cache rules, got %v and %v", cfg.CacheTTLOverrides, cfg.NeverCache)
+	}
+	if cfg.MetricsAddr != "" {
+		t.Errorf("expected metrics disabled, got %q", cfg.MetricsAddr)
+	}
+	if cfg.TracingExporter != "" || cfg.TracingSampleRatio != 1 {
+		t.Errorf("expected tracing disabled with sample ratio 1, got %q at %v", cfg.TracingExporter, cfg.TracingSampleRatio)
+	}
+	if cfg.QueryLogFile != "" || cfg.QueryLogAnonymize != "" {
+		t.Errorf("expected query log disabled without anonymization, got %q with %q", cfg.QueryLogFile, cfg.QueryLogAnonymize)
+	}
+	if cfg.DnstapOutput != "" || cfg.DnstapAddress != "" || cfg.DnstapIdentity != "" {
+		t.Errorf("expected dnstap disabled, got %q to %q as %q", cfg.DnstapOutput, cfg.DnstapAddress, cfg.DnstapIdentity)
+	}
+	if cfg.QueryHistoryDir != "" || cfg.QueryHistoryRetention != 7*24*time.Hour {
+		t.Errorf("expected query history disabled with 168h retention, got %q with %v", cfg.QueryHistoryDir, cfg.QueryHistoryRetention)
+	}
+	if cfg.QueryLogMaxBytes != 100<<20 || cfg.QueryLogRotateInterval != 24*time.Hour || cfg.QueryLogMaxBackups != 7 || cfg.QueryLogMaxAge != 0 {
+		t.Errorf("expected query log rotation at 100 MiB or 24h keeping 7 files, got %d bytes, %v, %d files, max age %v",
+			cfg.QueryLogMaxBytes, cfg.QueryLogRotateInterval, cfg.QueryLogMaxBackups, cfg.QueryLogMaxAge)
+	}
 }
 
 func TestLoad_ValidOverrides(t *testing.T) {
@@ -58,6 +177,17 @@ func TestLoad_ValidOverrides(t *testing.T) {
 	t.Setenv("DNS_ZONE_DIR", "/tmp/zones/")
 	t.Setenv("DNS_SERVERS", "8.8.8.8:53,8.8.4.4:53")
 	t.Setenv("DNS_MAX_RECURSION", "12")
+	t.Setenv("DNS_UPSTREAM_FAILURE_THRESHOLD", "5")
+	t.Setenv("DNS_UPSTREAM_BACKOFF", "30s")
+	t.Setenv("DNS_UPSTREAM_PROBE_INTERVAL", "1m")
+	t.Setenv("DNS_UPSTREAM_STRATEGY", "weighted")
+	t.Setenv("DNS_UPSTREAM_PARALLEL", "true")
+	t.Setenv("DNS_UPSTREAM_RACE_COUNT", "1")
+	t.Setenv("DNS_UPSTREAM_WEIGHTS", "3,1")
+	t.Setenv("DNS_UPSTREAM_CASE_RANDOMIZATION", "true")
+	t.Setenv("DNS_ITERATIVE", "true")
+	t.Setenv("DNS_ROOT_HINTS", "198.41.0.4:53,199.9.14.201:53")
+	t.Setenv("DNS_QNAME_MINIMISATION", "false")
 
 	cfg, err := Load()
 	if err != nil {
@@ -88,6 +218,39 @@ func TestLoad_ValidOverrides(t *testing.T) {
 	if cfg.MaxRecursion != 12 {
 		t.Errorf("expected MaxRecursion=12, got %d", cfg.MaxRecursion)
 	}
+	if cfg.UpstreamFailureThreshold != 5 {
+		t.Errorf("expected UpstreamFailureThreshold=5, got %d", cfg.UpstreamFailureThreshold)
+	}
+	if cfg.UpstreamBackoff != 30*time.Second {
+		t.Errorf("expected UpstreamBackoff=30s, got %v", cfg.UpstreamBackoff)
+	}
+	if cfg.UpstreamProbeInterval != time.Minute {
+		t.Errorf("expected UpstreamProbeInterval=1m, got %v", cfg.UpstreamProbeInterval)
+	}
+	if cfg.UpstreamStrategy != "weighted" {
+		t.Errorf("expected UpstreamStrategy=weighted, got %q", cfg.UpstreamStrategy)
+	}
+	if !cfg.UpstreamParallel {
+		t.Error("expected UpstreamParallel=true")
+	}
+	if !cfg.UpstreamCaseRandomization {
+		t.Error("expected UpstreamCaseRandomization=true")
+	}
+	if cfg.UpstreamRaceCount != 1 {
+		t.Errorf("expected UpstreamRaceCount=1, got %d", cfg.UpstreamRaceCount)
+	}
+	if len(cfg.UpstreamWeights) != 2 || cfg.UpstreamWeights[0] != 3 || cfg.UpstreamWeights[1] != 1 {
+		t.Errorf("expected UpstreamWeights=[3 1], got %v", cfg.UpstreamWeights)
+	}
+	if !cfg.Iterative {
+		t.Error("expected Iterative=true")
+	}
+	if len(cfg.RootHints) != 2 || cfg.RootHints[0] != "198.41.0.4:53" || cfg.RootHints[1] != "199.9.14.201:53" {
+		t.Errorf("expected RootHints=[198.41.0.4:53 199.9.14.201:53], got %v", cfg.RootHints)
+	}
+	if cfg.QnameMinimisation {
+		t.Error("expected QnameMinimisation=false")
+	}
 }
 
 func TestLoad_WhenKoanfDefaultLoadFails(t *testing.T) {
@@ -227,6 +390,307 @@ func TestLoad_InvalidUpstream(t *testing.T) {
 	}
 }
 
+func TestLoad_InvalidRootHints(t *testing.T) {
+	t.Setenv("DNS_ROOT_HINTS", "a.root-servers.net:53") // must be ip:port
+
+	_, err := Load()
+	if err == nil {
+		t.Fatal("expected error for invalid RootHints, got nil")
+	}
+}
+
+func TestLoad_DNSSEC(t *testing.T) {
+	t.Setenv("DNS_DNSSEC", "true")
+	t.Setenv("DNS_DNSSEC_TRUST_ANCHOR", "/etc/rr-dns/anchors.conf")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if !cfg.DNSSEC {
+		t.Error("expected DNSSEC=true")
+	}
+	if cfg.DNSSECTrustAnchor != "/etc/rr-dns/anchors.conf" {
+		t.Errorf("expected DNSSECTrustAnchor=/etc/rr-dns/anchors.conf, got %q", cfg.DNSSECTrustAnchor)
+	}
+}
+
+func TestLoad_DNSSECWithIterative(t *testing.T) {
+	t.Setenv("DNS_DNSSEC", "true")
+	t.Setenv("DNS_ITERATIVE", "true")
+
+	_, err := Load()
+	if err == nil {
+		t.Fatal("expected error for DNSSEC with Iterative, got nil")
+	}
+}
+
+func TestLoad_DNSSECSigning(t *testing.T) {
+	t.Setenv("DNS_DNSSEC_KEY_DIR", "/etc/rr-dns/keys")
+	t.Setenv("DNS_DNSSEC_NSEC3", "true")
+	t.Setenv("DNS_DNSSEC_SIGNATURE_VALIDITY", "168h")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if cfg.DNSSECKeyDir != "/etc/rr-dns/keys" {
+		t.Errorf("expected DNSSECKeyDir=/etc/rr-dns/keys, got %q", cfg.DNSSECKeyDir)
+	}
+	if !cfg.DNSSECNSEC3 {
+		t.Error("expected DNSSECNSEC3=true")
+	}
+	if cfg.DNSSECSignatureValidity != 168*time.Hour {
+		t.Errorf("expected DNSSECSignatureValidity=168h, got %v", cfg.DNSSECSignatureValidity)
+	}
+}
+
+func TestLoad_DNSSECSignatureValidityTooShort(t *testing.T) {
+	t.Setenv("DNS_DNSSEC_SIGNATURE_VALIDITY", "30m")
+
+	_, err := Load()
+	if err == nil {
+		t.Fatal("expected error for DNSSECSignatureValidity below 1h, got nil")
+	}
+}
+
+func TestLoad_ServeStale(t *testing.T) {
+	t.Setenv("DNS_CACHE_STALE_WINDOW", "24h")
+	t.Setenv("DNS_STALE_ANSWER_TIMEOUT", "500ms")
+	t.Setenv("DNS_STALE_ANSWER_TTL", "1m")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if cfg.CacheStaleWindow != 24*time.Hour {
+		t.Errorf("expected CacheStaleWindow=24h, got %v", cfg.CacheStaleWindow)
+	}
+	if cfg.StaleAnswerTimeout != 500*time.Millisecond {
+		t.Errorf("expected StaleAnswerTimeout=500ms, got %v", cfg.StaleAnswerTimeout)
+	}
+	if cfg.StaleAnswerTTL != time.Minute {
+		t.Errorf("expected StaleAnswerTTL=1m, got %v", cfg.StaleAnswerTTL)
+	}
+}
+
+func TestLoad_InvalidServeStale(t *testing.T) {
+	tests := map[string]string{
+		"DNS_CACHE_STALE_WINDOW":   "-1h",
+		"DNS_STALE_ANSWER_TIMEOUT": "-1s",
+		"DNS_STALE_ANSWER_TTL":     "500ms",
+	}
+	for key, value := range tests {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if _, err := Load(); err == nil {
+				t.Fatalf("expected error for %s=%s, got nil", key, value)
+			}
+		})
+	}
+}
+
+func TestLoad_ShardedCache(t *testing.T) {
+	t.Setenv("DNS_CACHE_MAX_BYTES", "67108864")
+	t.Setenv("DNS_CACHE_SHARDS", "128")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if cfg.CacheMaxBytes != 64<<20 {
+		t.Errorf("expected CacheMaxBytes=67108864, got %d", cfg.CacheMaxBytes)
+	}
+	if cfg.CacheShards != 128 {
+		t.Errorf("expected CacheShards=128, got %d", cfg.CacheShards)
+	}
+
+	for key, value := range map[string]string{"DNS_CACHE_MAX_BYTES": "-1", "DNS_CACHE_SHARDS": "0"} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if _, err := Load(); err == nil {
+				t.Fatalf("expected error for %s=%s, got nil", key, value)
+			}
+		})
+	}
+}
+
+func TestLoad_CacheSnapshot(t *testing.T) {
+	t.Setenv("DNS_CACHE_SNAPSHOT_FILE", "/var/lib/rr-dns/cache.snapshot")
+	t.Setenv("DNS_CACHE_SNAPSHOT_INTERVAL", "5m")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if cfg.CacheSnapshotFile != "/var/lib/rr-dns/cache.snapshot" {
+		t.Errorf("expected CacheSnapshotFile=/var/lib/rr-dns/cache.snapshot, got %q", cfg.CacheSnapshotFile)
+	}
+	if cfg.CacheSnapshotInterval != 5*time.Minute {
+		t.Errorf("expected CacheSnapshotInterval=5m, got %v", cfg.CacheSnapshotInterval)
+	}
+
+	t.Setenv("DNS_CACHE_SNAPSHOT_INTERVAL", "-1m")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for negative snapshot interval, got nil")
+	}
+}
+
+func TestLoad_Metrics(t *testing.T) {
+	t.Setenv("DNS_METRICS_ADDR", ":9153")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if cfg.MetricsAddr != ":9153" {
+		t.Errorf("expected MetricsAddr=:9153, got %q", cfg.MetricsAddr)
+	}
+
+	t.Setenv("DNS_METRICS_ADDR", "9153")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for metrics address without a port, got nil")
+	}
+}
+
+func TestLoad_Tracing(t *testing.T) {
+	t.Setenv("DNS_TRACING_EXPORTER", "otlp")
+	t.Setenv("DNS_TRACING_ENDPOINT", "http://localhost:4318/v1/traces")
+	t.Setenv("DNS_TRACING_SAMPLE_RATIO", "0.25")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if cfg.TracingExporter != "otlp" || cfg.TracingEndpoint != "http://localhost:4318/v1/traces" {
+		t.Errorf("expected otlp exporter to localhost:4318, got %q to %q", cfg.TracingExporter, cfg.TracingEndpoint)
+	}
+	if cfg.TracingSampleRatio != 0.25 {
+		t.Errorf("expected TracingSampleRatio=0.25, got %v", cfg.TracingSampleRatio)
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{"unknown exporter", map[string]string{"DNS_TRACING_EXPORTER": "jaeger"}},
+		{"otlp without endpoint", map[string]string{"DNS_TRACING_ENDPOINT": ""}},
+		{"endpoint not a url", map[string]string{"DNS_TRACING_ENDPOINT": "localhost:4318"}},
+		{"file without path", map[string]string{"DNS_TRACING_EXPORTER": "file"}},
+		{"sample ratio above one", map[string]string{"DNS_TRACING_SAMPLE_RATIO": "1.5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			if _, err := Load(); err == nil {
+				t.Fatal("expected validation error, got nil")
+			}
+		})
+	}
+
+	t.Setenv("DNS_TRACING_EXPORTER", "file")
+	t.Setenv("DNS_TRACING_FILE", "/tmp/traces.jsonl")
+	if _, err := Load(); err != nil {
+		t.Fatalf("Load() returned error for file exporter: %v", err)
+	}
+}
+
+func TestLoad_QueryLog(t *testing.T) {
+	t.Setenv("DNS_QUERY_LOG_FILE", "/var/log/rr-dns/queries.log")
+	t.Setenv("DNS_QUERY_LOG_MAX_BYTES", "1048576")
+	t.Setenv("DNS_QUERY_LOG_ROTATE_INTERVAL", "1h")
+	t.Setenv("DNS_QUERY_LOG_MAX_BACKUPS", "0")
+	t.Setenv("DNS_QUERY_LOG_MAX_AGE", "720h")
+	t.Setenv("DNS_QUERY_LOG_ANONYMIZE", "hash")
+	t.Setenv("DNS_QUERY_LOG_HASH_KEY", "secret")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if cfg.QueryLogFile != "/var/log/rr-dns/queries.log" || cfg.QueryLogMaxBytes != 1<<20 || cfg.QueryLogRotateInterval != time.Hour {
+		t.Errorf("unexpected query log file or rotation: %q, %d bytes, %v", cfg.QueryLogFile, cfg.QueryLogMaxBytes, cfg.QueryLogRotateInterval)
+	}
+	if cfg.QueryLogMaxBackups != 0 || cfg.QueryLogMaxAge != 720*time.Hour {
+		t.Errorf("unexpected query log retention: %d files, %v", cfg.QueryLogMaxBackups, cfg.QueryLogMaxAge)
+	}
+	if cfg.QueryLogAnonymize != "hash" || cfg.QueryLogHashKey != "secret" {
+		t.Errorf("unexpected query log anonymization: %q keyed %q", cfg.QueryLogAnonymize, cfg.QueryLogHashKey)
+	}
+
+	tests := []struct {
+		key, value string
+	}{
+		{"DNS_QUERY_LOG_ANONYMIZE", "scramble"},
+		{"DNS_QUERY_LOG_MAX_BYTES", "-1"},
+		{"DNS_QUERY_LOG_ROTATE_INTERVAL", "-1h"},
+		{"DNS_QUERY_LOG_MAX_BACKUPS", "-1"},
+		{"DNS_QUERY_LOG_MAX_AGE", "-1h"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			t.Setenv(tt.key, tt.value)
+			if _, err := Load(); err == nil {
+				t.Fatalf("expected error for %s=%s, got nil", tt.key, tt.value)
+			}
+		})
+	}
+}
+
+func TestLoad_Prefetch(t *testing.T) {
+	t.Setenv("DNS_PREFETCH_MIN_HITS", "5")
+	t.Setenv("DNS_PREFETCH_PERCENT", "20")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if cfg.PrefetchMinHits != 5 {
+		t.Errorf("expected PrefetchMinHits=5, got %d", cfg.PrefetchMinHits)
+	}
+	if cfg.PrefetchPercent != 20 {
+		t.Errorf("expected PrefetchPercent=20, got %d", cfg.PrefetchPercent)
+	}
+}
+
+func TestLoad_InvalidPrefetch(t *testing.T) {
+	tests := map[string]string{
+		"DNS_PREFETCH_MIN_HITS": "-1",
+		"DNS_PREFETCH_PERCENT":  "75",
+	}
+	for key, value := range tests {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			if _, err := Load(); err == nil {
+				t.Fatalf("expected error for %s=%s, got nil", key, value)
+			}
+		})
+	}
+}
+
+func TestLoad_InvalidUpstreamOptions(t *testing.T) {
+	tests := map[string]string{
+		"DNS_UPSTREAM_FAILURE_THRESHOLD": "0",
+		"DNS_UPSTREAM_BACKOFF":           "-5s",
+		"DNS_UPSTREAM_PROBE_INTERVAL":    "soon",
+		"DNS_UPSTREAM_STRATEGY":          "lowest_latency",
+		"DNS_UPSTREAM_RACE_COUNT":        "-1",
+		"DNS_UPSTREAM_WEIGHTS":           "3,0",
+	}
+	for key, value := range tests {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+
+			_, err := Load()
+			if err == nil {
+				t.Fatalf("expected error for %s=%q, got nil", key, value)
+			}
+		})
+	}
+}
+
 func TestValidIPPort(t *testing.T) {
 	type testCase struct {
 		input    string
@@ -334,9 +798,100 @@ func TestDefaultLoader_ErrorPropagation(t *testing.T) {
 	}
 
 	validate := validator.New(validator.WithRequiredStructEnabled())
-	_ = validate.RegisterValidation("ip_port", validIPPort)
+	_ = registerValidation(validate)
 	err = validate.Struct(&cfg)
 	if err == nil {
 		t.Fatal("expected validation error for invalid default Servers, got nil")
 	}
 }
+
+func TestLoad_QueryHistory(t *testing.T) {
+	t.Setenv("DNS_QUERY_HISTORY_DIR", "/var/lib/rr-dns/history")
+	t.Setenv("DNS_QUERY_HISTORY_RETENTION", "72h")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if cfg.QueryHistoryDir != "/var/lib/rr-dns/history" || cfg.QueryHistoryRetention != 72*time.Hour {
+		t.Errorf("unexpected query history: %q kept for %v", cfg.QueryHistoryDir, cfg.QueryHistoryRetention)
+	}
+
+	for _, value := range []string{"0", "-1h"} {
+		t.Run(value, func(t *testing.T) {
+			t.Setenv("DNS_QUERY_HISTORY_RETENTION", value)
+			if _, err := Load(); err == nil {
+				t.Fatalf("expected error for DNS_QUERY_HISTORY_RETENTION=%s, got nil", value)
+			}
+		})
+	}
+}
+
+func TestLoad_Dnstap(t *testing.T) {
+	t.Setenv("DNS_DNSTAP_OUTPUT", "unix")
+	t.Setenv("DNS_DNSTAP_ADDRESS", "/run/dnstap.sock")
+	t.Setenv("DNS_DNSTAP_IDENTITY", "ns1")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if cfg.DnstapOutput != "unix" || cfg.DnstapAddress != "/run/dnstap.sock" || cfg.DnstapIdentity != "ns1" {
+		t.Errorf("unexpected dnstap: %q to %q as %q", cfg.DnstapOutput, cfg.DnstapAddress, cfg.DnstapIdentity)
+	}
+
+	tests := []struct {
+		name         string
+		output, addr string
+	}{
+		{"unknown output", "udp", "127.0.0.1:6000"},
+		{"missing address", "tcp", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DNS_DNSTAP_OUTPUT", tt.output)
+			t.Setenv("DNS_DNSTAP_ADDRESS", tt.addr)
+			if _, err := Load(); err == nil {
+				t.Fatalf("expected error for output %q at %q, got nil", tt.output, tt.addr)
+			}
+		})
+	}
+}
+
+func TestLoad_Admin(t *testing.T) {
+	t.Setenv("DNS_ADMIN_ADDR", "127.0.0.1:8053")
+	t.Setenv("DNS_ADMIN_SOCKET", "/run/rr-dns/admin.sock")
+	t.Setenv("DNS_ADMIN_TOKEN", "s3cret")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if cfg.AdminAddr != "127.0.0.1:8053" || cfg.AdminSocket != "/run/rr-dns/admin.sock" || cfg.AdminToken != "s3cret" {
+		t.Errorf("unexpected admin: %q, %q, %q", cfg.AdminAddr, cfg.AdminSocket, cfg.AdminToken)
+	}
+
+	// A unix socket alone needs no token
+	t.Setenv("DNS_ADMIN_ADDR", "")
+	t.Setenv("DNS_ADMIN_TOKEN", "")
+	if _, err := Load(); err != nil {
+		t.Fatalf("Load() with only an admin socket returned error: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		addr, token string
+	}{
+		{"listener without token", "127.0.0.1:8053", ""},
+		{"invalid address", "localhost", "s3cret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DNS_ADMIN_ADDR", tt.addr)
+			t.Setenv("DNS_ADMIN_TOKEN", tt.token)
+			if _, err := Load(); err == nil {
+				t.Fatalf("expected error for %q with token %q, got nil", tt.addr, tt.token)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// ForwardZone routes queries for a domain suffix to its own upstream servers.
+type ForwardZone struct {
+	// Suffix is the domain the rule covers, including all names below it.
+	Suffix string
+	// Servers are the upstream servers for the suffix in ip:port format.
+	Servers []string
+	// Network is "udp" (with TCP fallback on truncation) or "tcp".
+	Network string
+	// Timeout is the per-query timeout; zero means the default upstream timeout.
+	Timeout time.Duration
+}
+
+// ParseForwardZone parses a forward zone rule of the form
+//
+//	suffix=server[+server...][;udp|tcp][;timeout]
+//
+// for example "corp.example=10.8.0.1:53+10.8.0.2:53" or "consul=127.0.0.1:8600;tcp;2s".
+// Options after the server list may appear in any order.
+func ParseForwardZone(rule string) (ForwardZone, error) {
+	suffix, rest, ok := strings.Cut(rule, "=")
+	suffix = strings.TrimSpace(suffix)
+	if !ok || suffix == "" || rest == "" {
+		return ForwardZone{}, fmt.Errorf("forward zone %q: expected suffix=servers", rule)
+	}
+	parts := strings.Split(rest, ";")
+	zone := ForwardZone{Suffix: suffix, Network: "udp"}
+	for _, server := range strings.Split(parts[0], "+") {
+		if !isIPPort(server) {
+			return ForwardZone{}, fmt.Errorf("forward zone %q: invalid server %q", rule, server)
+		}
+		zone.Servers = append(zone.Servers, server)
+	}
+	for _, opt := range parts[1:] {
+		switch opt {
+		case "udp", "tcp":
+			zone.Network = opt
+		default:
+			timeout, err := time.ParseDuration(opt)
+			if err != nil || timeout <= 0 {
+				return ForwardZone{}, fmt.Errorf("forward zone %q: invalid option %q", rule, opt)
+			}
+			zone.Timeout = timeout
+		}
+	}
+	return zone, nil
+}
+
+// ParsedForwardZones returns the configured forward zone rules in parsed form.
+// Rules are validated by Load, so an error here indicates a config built by hand.
+func (c *AppConfig) ParsedForwardZones() ([]ForwardZone, error) {
+	zones := make([]ForwardZone, 0, len(c.ForwardZones))
+	for _, rule := range c.ForwardZones {
+		zone, err := ParseForwardZone(rule)
+		if err != nil {
+			return nil, err
+		}
+		zones = append(zones, zone)
+	}
+	return zones, nil
+}
+
+// validForwardZone validates a forward zone rule using ParseForwardZone.
+func validForwardZone(fl validator.FieldLevel) bool {
+	_, err := ParseForwardZone(fl.Field().String())
+	return err == nil
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseForwardZone(t *testing.T) {
+	tests := []struct {
+		rule    string
+		want    ForwardZone
+		wantErr bool
+	}{
+		{
+			rule: "corp.example=10.8.0.1:53",
+			want: ForwardZone{Suffix: "corp.example", Servers: []string{"10.8.0.1:53"}, Network: "udp"},
+		},
+		{
+			rule: "corp.example=10.8.0.1:53+10.8.0.2:53",
+			want: ForwardZone{Suffix: "corp.example", Servers: []string{"10.8.0.1:53", "10.8.0.2:53"}, Network: "udp"},
+		},
+		{
+			rule: "consul=127.0.0.1:8600;tcp;2s",
+			want: ForwardZone{Suffix: "consul", Servers: []string{"127.0.0.1:8600"}, Network: "tcp", Timeout: 2 * time.Second},
+		},
+		{
+			rule: "consul=127.0.0.1:8600;500ms;udp",
+			want: ForwardZone{Suffix: "consul", Servers: []string{"127.0.0.1:8600"}, Network: "udp", Timeout: 500 * time.Millisecond},
+		},
+		{rule: "corp.example", wantErr: true},
+		{rule: "=10.8.0.1:53", wantErr: true},
+		{rule: "corp.example=", wantErr: true},
+		{rule: "corp.example=vpn-dns:53", wantErr: true},
+		{rule: "corp.example=10.8.0.1:53+", wantErr: true},
+		{rule: "corp.example=10.8.0.1:53;quic", wantErr: true},
+		{rule: "corp.example=10.8.0.1:53;-1s", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			got, err := ParseForwardZone(tt.rule)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for %q, got %+v", tt.rule, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseForwardZone(%q) returned error: %v", tt.rule, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseForwardZone(%q) = %+v, want %+v", tt.rule, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad_ForwardZones(t *testing.T) {
+	t.Setenv("DNS_FORWARD_ZONES", "corp.example=10.8.0.1:53+10.8.0.2:53 consul=127.0.0.1:8600;tcp;2s")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	zones, err := cfg.ParsedForwardZones()
+	if err != nil {
+		t.Fatalf("ParsedForwardZones() returned error: %v", err)
+	}
+	want := []ForwardZone{
+		{Suffix: "corp.example", Servers: []string{"10.8.0.1:53", "10.8.0.2:53"}, Network: "udp"},
+		{Suffix: "consul", Servers: []string{"127.0.0.1:8600"}, Network: "tcp", Timeout: 2 * time.Second},
+	}
+	if !reflect.DeepEqual(zones, want) {
+		t.Errorf("expected forward zones %+v, got %+v", want, zones)
+	}
+
+	t.Setenv("DNS_FORWARD_ZONES", "corp.example=not_a_server")
+	if _, err := Load(); err == nil {
+		t.Fatal("expected error for invalid forward zone, got nil")
+	}
+}
+
+func TestAppConfig_ParsedForwardZones(t *testing.T) {
+	cfg := &AppConfig{}
+	zones, err := cfg.ParsedForwardZones()
+	if err != nil || len(zones) != 0 {
+		t.Fatalf("expected no forward zones, got %v (err %v)", zones, err)
+	}
+
+	cfg.ForwardZones = []string{"broken"}
+	if _, err := cfg.ParsedForwardZones(); err == nil {
+		t.Fatal("expected error for malformed rule, got nil")
+	}
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/knadh/koanf/providers/structs"
+)
+
+// redactedValue replaces the value of a secret setting in Redacted.
+const redactedValue = "[REDACTED]"
+
+// secretKeys are the settings Redacted hides, by koanf key.
+var secretKeys = []string{"query_log_hash_key", "admin_token"}
+
+// urlKeys are the URL settings Redacted strips credentials from, by koanf key.
+var urlKeys = []string{"tracing_endpoint"}
+
+// Redacted returns the configuration keyed like the environment variables
+// without their DNS_ prefix, for display. Secret settings that are set are
+// replaced with "[REDACTED]", URLs lose their userinfo, query and fragment,
+// which may carry credentials, and durations are rendered like "5s".
+func (c *AppConfig) Redacted() map[string]any {
+	// Reading a struct never fails
+	values, _ := structs.Provider(*c, "koanf").Read()
+	for key, value := range values {
+		if d, ok := value.(time.Duration); ok {
+			values[key] = d.String()
+		}
+	}
+	for _, key := range secretKeys {
+		if s, ok := values[key].(string); ok && s != "" {
+			values[key] = redactedValue
+		}
+	}
+	for _, key := range urlKeys {
+		if s, ok := values[key].(string); ok && s != "" {
+			values[key] = stripURL(s)
+		}
+	}
+	return values
+}
+
+// stripURL removes the userinfo, query and fragment of a URL. A value that
+// does not parse as a URL is redacted whole, since it cannot be inspected.
+func stripURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redactedValue
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.ForceQuery = false
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String()
+}
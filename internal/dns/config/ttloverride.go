@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// ParseTTLOverride parses a cache TTL override rule of the form
+//
+//	suffix=duration
+//
+// for example "corp.example=30s" or "static.example.com=12h". A duration of 0
+// caches answers for the suffix with TTL 0, which means they are not reused.
+func ParseTTLOverride(rule string) (string, time.Duration, error) {
+	suffix, value, ok := strings.Cut(rule, "=")
+	suffix = strings.TrimSpace(suffix)
+	if !ok || suffix == "" || value == "" {
+		return "", 0, fmt.Errorf("ttl override %q: expected suffix=duration", rule)
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < 0 {
+		return "", 0, fmt.Errorf("ttl override %q: invalid duration %q", rule, value)
+	}
+	return suffix, ttl, nil
+}
+
+// ParsedTTLOverrides returns the configured cache TTL overrides keyed by domain suffix.
+// Rules are validated by Load, so an error here indicates a config built by hand.
+// A later rule for the same suffix replaces an earlier one.
+func (c *AppConfig) ParsedTTLOverrides() (map[string]time.Duration, error) {
+	overrides := make(map[string]time.Duration, len(c.CacheTTLOverrides))
+	for _, rule := range c.CacheTTLOverrides {
+		suffix, ttl, err := ParseTTLOverride(rule)
+		if err != nil {
+			return nil, err
+		}
+		overrides[suffix] = ttl
+	}
+	return overrides, nil
+}
+
+// validTTLOverride validates a cache TTL override rule using ParseTTLOverride.
+func validTTLOverride(fl validator.FieldLevel) bool {
+	_, _, err := ParseTTLOverride(fl.Field().String())
+	return err == nil
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseTTLOverride(t *testing.T) {
+	tests := []struct {
+		rule       string
+		wantSuffix string
+		wantTTL    time.Duration
+		wantErr    bool
+	}{
+		{rule: "corp.example=30s", wantSuffix: "corp.example", wantTTL: 30 * time.Second},
+		{rule: "static.example.com=12h", wantSuffix: "static.example.com", wantTTL: 12 * time.Hour},
+		{rule: "dyn.example=0s", wantSuffix: "dyn.example", wantTTL: 0},
+		{rule: "corp.example", wantErr: true},
+		{rule: "=30s", wantErr: true},
+		{rule: "corp.example=", wantErr: true},
+		{rule: "corp.example=30", wantErr: true},
+		{rule: "corp.example=-1s", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rule, func(t *testing.T) {
+			suffix, ttl, err := ParseTTLOverride(tt.rule)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for %q, got %s=%v", tt.rule, suffix, ttl)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTTLOverride(%q) returned error: %v", tt.rule, err)
+			}
+			if suffix != tt.wantSuffix || ttl != tt.wantTTL {
+				t.Errorf("ParseTTLOverride(%q) = %s=%v, want %s=%v", tt.rule, suffix, ttl, tt.wantSuffix, tt.wantTTL)
+			}
+		})
+	}
+}
+
+func TestLoad_CachePolicy(t *testing.T) {
+	t.Setenv("DNS_CACHE_MIN_TTL", "30s")
+	t.Setenv("DNS_CACHE_MAX_TTL", "1h")
+	t.Setenv("DNS_CACHE_NEGATIVE_MIN_TTL", "1m")
+	t.Setenv("DNS_CACHE_NEGATIVE_MAX_TTL", "15m")
+	t.Setenv("DNS_CACHE_TTL_OVERRIDES", "corp.example=5s static.example.com=12h")
+	t.Setenv("DNS_NEVER_CACHE", "dyn.example,ddns.example.net")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if cfg.CacheMinTTL != 30*time.Second || cfg.CacheMaxTTL != time.Hour {
+		t.Errorf("expected cache ttl limits 30s..1h, got %v..%v", cfg.CacheMinTTL, cfg.CacheMaxTTL)
+	}
+	if cfg.CacheNegativeMinTTL != time.Minute || cfg.CacheNegativeMaxTTL != 15*time.Minute {
+		t.Errorf("expected negative ttl limits 1m..15m, got %v..%v", cfg.CacheNegativeMinTTL, cfg.CacheNegativeMaxTTL)
+	}
+	if !reflect.DeepEqual(cfg.NeverCache, []string{"dyn.example", "ddns.example.net"}) {
+		t.Errorf("unexpected NeverCache %v", cfg.NeverCache)
+	}
+	overrides, err := cfg.ParsedTTLOverrides()
+	if err != nil {
+		t.Fatalf("ParsedTTLOverrides() returned error: %v", err)
+	}
+	want := map[string]time.Duration{"corp.example": 5 * time.Second, "static.example.com": 12 * time.Hour}
+	if !reflect.DeepEqual(overrides, want) {
+		t.Errorf("expected ttl overrides %v, got %v", want, overrides)
+	}
+}
+
+func TestLoad_InvalidCachePolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{name: "negative min ttl", env: map[string]string{"DNS_CACHE_MIN_TTL": "-1s"}},
+		{name: "max below min", env: map[string]string{"DNS_CACHE_MIN_TTL": "1h", "DNS_CACHE_MAX_TTL": "1m"}},
+		{name: "negative max below min", env: map[string]string{"DNS_CACHE_NEGATIVE_MIN_TTL": "1h", "DNS_CACHE_NEGATIVE_MAX_TTL": "1m"}},
+		{name: "malformed override", env: map[string]string{"DNS_CACHE_TTL_OVERRIDES": "corp.example"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			if _, err := Load(); err == nil {
+				t.Fatal("expected validation error, got nil")
+			}
+		})
+	}
+}
+
+func TestAppConfig_ParsedTTLOverrides(t *testing.T) {
+	cfg := &AppConfig{}
+	overrides, err := cfg.ParsedTTLOverrides()
+	if err != nil || len(overrides) != 0 {
+		t.Fatalf("expected no ttl overrides, got %v (err %v)", overrides, err)
+	}
+
+	cfg.CacheTTLOverrides = []string{"broken"}
+	if _, err := cfg.ParsedTTLOverrides(); err == nil {
+		t.Fatal("expected error for malformed rule, got nil")
+	}
+}
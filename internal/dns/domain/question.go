@@ -8,6 +8,18 @@ type Question struct {
 	Name  string
 	Type  RRType
 	Class RRClass
+	// DNSSECOK reflects the DO bit of the query's EDNS(0) OPT record (RFC 3225):
+	// the client wants DNSSEC records with the answer. It is not part of the cache key.
+	DNSSECOK bool
+	// AuthenticData reflects the AD bit of the query header: the client
+	// understands the AD bit in responses even without DO (RFC 6840 §5.7).
+	// It is not part of the cache key.
+	AuthenticData bool
+	// UDPSize is the largest UDP response the client accepts, from the payload
+	// size of its EDNS(0) OPT record (RFC 6891 §6.2.3), or 0 when the query had
+	// no OPT record and responses are limited to 512 bytes. It is not part of
+	// the cache key.
+	UDPSize uint16
 }
 
 // NewQuestion constructs a Question and validates its fields.
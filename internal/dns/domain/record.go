@@ -2,6 +2,7 @@ package domain
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/haukened/rr-dns/internal/dns/common/utils"
@@ -17,12 +18,29 @@ type ResourceRecord struct {
 	expiresAt *time.Time // nil if record is authoritative
 	Data      []byte     // Wire-Encoded representation of the record
 	Text      string     // Human-readable representation of the record
+	// Authenticated marks a record whose RRset passed DNSSEC validation
+	// (RFC 4035 §4.3 "secure"). Responses made only of such records carry the AD bit.
+	Authenticated bool
+}
+
+// RootName is the owner name of records at the root zone, such as the root
+// DNSKEY RRset. Every other owner name is stored without a trailing dot.
+const RootName = "."
+
+// ownerName canonicalizes an owner name. The root keeps its "." spelling,
+// because an empty name is rejected as missing.
+func ownerName(name string) string {
+	canonical := utils.CanonicalDNSName(name)
+	if canonical == "" && strings.HasSuffix(strings.TrimSpace(name), ".") {
+		return RootName
+	}
+	return canonical
 }
 
 // NewAuthoritativeResourceRecord constructs an authoritative ResourceRecord (non-expiring).
 func NewAuthoritativeResourceRecord(name string, rrtype RRType, class RRClass, ttl uint32, data []byte, text string) (ResourceRecord, error) {
 	rr := ResourceRecord{
-		Name:      utils.CanonicalDNSName(name),
+		Name:      ownerName(name),
 		Type:      rrtype,
 		Class:     class,
 		ttl:       ttl,
@@ -41,7 +59,7 @@ func NewAuthoritativeResourceRecord(name string, rrtype RRType, class RRClass, t
 func NewCachedResourceRecord(name string, rrtype RRType, class RRClass, ttl uint32, data []byte, text string, now time.Time) (ResourceRecord, error) {
 	exp := now.Add(time.Duration(ttl) * time.Second)
 	rr := ResourceRecord{
-		Name:      utils.CanonicalDNSName(name),
+		Name:      ownerName(name),
 		Type:      rrtype,
 		Class:     class,
 		ttl:       ttl,
@@ -72,12 +90,12 @@ func (rr ResourceRecord) Validate() error {
 	return nil
 }
 
-// TTLRemaining returns the remaining TTL duration until the record expires.
-func (rr ResourceRecord) TTLRemaining() time.Duration {
+// TTLRemaining returns the remaining TTL duration at now until the record expires.
+func (rr ResourceRecord) TTLRemaining(now time.Time) time.Duration {
 	if rr.expiresAt == nil {
 		return time.Duration(rr.ttl) * time.Second
 	}
-	ttl := time.Until(*rr.expiresAt)
+	ttl := rr.expiresAt.Sub(now)
 	if ttl < 0 {
 		return 0
 	}
@@ -89,10 +107,10 @@ func (rr ResourceRecord) CacheKey() string {
 	return GenerateCacheKey(rr.Name, rr.Type, rr.Class)
 }
 
-// TTL returns the effective TTL value for wire encoding.
+// TTL returns the effective TTL value for wire encoding at now.
 // If the record is cached (expiresAt set), it computes the remaining TTL.
 // If it's authoritative (expiresAt is nil), it returns the original TTL.
-func (rr ResourceRecord) TTL() uint32 {
+func (rr ResourceRecord) TTL(now time.Time) uint32 {
 	// zone records are authoritative, so they do not have an expiration time
 	// so we can confidently return the original TTL
 	if rr.expiresAt == nil {
@@ -101,19 +119,46 @@ func (rr ResourceRecord) TTL() uint32 {
 	// cached resource records have an expiration time
 	// because for messages returned by an upstream DNS server
 	// TTL only has meaning in the context of the time of arrival
-	ttl := time.Until(*rr.expiresAt).Seconds()
+	ttl := rr.expiresAt.Sub(now).Seconds()
 	if ttl <= 0 {
 		return 0
 	}
 	return uint32(ttl)
 }
 
-// IsExpired returns true if the record has an expiration time that has passed.
-func (rr ResourceRecord) IsExpired() bool {
+// OriginalTTL returns the TTL the record was created with, before any time
+// passed in the cache.
+func (rr ResourceRecord) OriginalTTL() uint32 {
+	return rr.ttl
+}
+
+// IsExpired returns true if the record has an expiration time that has passed at now.
+func (rr ResourceRecord) IsExpired(now time.Time) bool {
 	if rr.expiresAt == nil {
 		return false
 	}
-	return time.Now().After(*rr.expiresAt)
+	return now.After(*rr.expiresAt)
+}
+
+// ExpiredFor returns how long before now a cached record expired, or 0 if it
+// has not expired yet or is authoritative.
+func (rr ResourceRecord) ExpiredFor(now time.Time) time.Duration {
+	if rr.expiresAt == nil {
+		return 0
+	}
+	since := now.Sub(*rr.expiresAt)
+	if since < 0 {
+		return 0
+	}
+	return since
+}
+
+// ExpiresAt returns when a cached record expires, or the zero time if it is authoritative.
+func (rr ResourceRecord) ExpiresAt() time.Time {
+	if rr.expiresAt == nil {
+		return time.Time{}
+	}
+	return *rr.expiresAt
 }
 
 // IsAuthoritative returns true if the record has no expiration time set.
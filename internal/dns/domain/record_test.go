@@ -192,6 +192,18 @@ func TestNewCachedResourceRecord(t *testing.T) {
 			now:         timeFixture,
 			expectError: true,
 		},
+		{
+			name:         "root owner keeps its dot",
+			recordName:   ".",
+			rrtype:       48, // DNSKEY
+			class:        1,  // IN
+			ttl:          172800,
+			data:         []byte{1, 1, 3, 8},
+			text:         "257 3 8 AQ==",
+			now:          timeFixture,
+			expectError:  false,
+			expectedName: ".",
+		},
 		{
 			name:         "zero TTL cached record",
 			recordName:   "example.com.",
@@ -284,7 +296,7 @@ func TestResourceRecord_TTL(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			actualTTL := tt.record.TTL()
+			actualTTL := tt.record.TTL(time.Now())
 
 			// For authoritative records, TTL should be the original value
 			if tt.record.expiresAt == nil && actualTTL != tt.expectedTTL {
@@ -312,7 +324,7 @@ func TestResourceRecord_TTL_CachedRecords(t *testing.T) {
 				expiresAt: func() *time.Time { exp := now.Add(100 * time.Second); return &exp }(),
 				Data:      []byte{192, 0, 2, 1},
 			},
-			expectedTTL: 100, // Approximately 100 seconds remaining
+			expectedTTL: 100,
 		},
 		{
 			name: "cached record with short remaining TTL",
@@ -324,7 +336,7 @@ func TestResourceRecord_TTL_CachedRecords(t *testing.T) {
 				expiresAt: func() *time.Time { exp := now.Add(5 * time.Second); return &exp }(),
 				Data:      []byte{192, 0, 2, 1},
 			},
-			expectedTTL: 5, // Approximately 5 seconds remaining
+			expectedTTL: 5,
 		},
 		{
 			name: "cached record exactly at expiration",
@@ -366,34 +378,18 @@ func TestResourceRecord_TTL_CachedRecords(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			actualTTL := tt.record.TTL()
-
-			// For cached records, we need to be more flexible with timing
-			if tt.record.expiresAt != nil {
-				// Allow for small timing differences (±2 seconds)
-				tolerance := uint32(2)
-				if actualTTL > tt.expectedTTL+tolerance {
-					t.Errorf("Expected TTL around %d, got %d (too high)", tt.expectedTTL, actualTTL)
-				}
-				// For expired records, TTL should be exactly 0
-				if tt.expectedTTL == 0 && actualTTL != 0 {
-					t.Errorf("Expected TTL 0 for expired record, got %d", actualTTL)
-				}
-				// For non-expired records, TTL should be close to expected
-				if tt.expectedTTL > 0 && actualTTL == 0 {
-					t.Errorf("Expected TTL around %d, got 0 (unexpectedly expired)", tt.expectedTTL)
-				}
-			} else {
-				// For authoritative records, TTL should be exact
-				if actualTTL != tt.expectedTTL {
-					t.Errorf("Expected TTL %d, got %d", tt.expectedTTL, actualTTL)
-				}
+			// The remaining TTL is computed against the given time, so it is exact
+			actualTTL := tt.record.TTL(now)
+			if actualTTL != tt.expectedTTL {
+				t.Errorf("Expected TTL %d, got %d", tt.expectedTTL, actualTTL)
 			}
 		})
 	}
 }
 
 func TestResourceRecord_TTLRemaining(t *testing.T) {
+	now := time.Now()
+
 	tests := []struct {
 		name             string
 		record           ResourceRecord
@@ -418,10 +414,10 @@ func TestResourceRecord_TTLRemaining(t *testing.T) {
 				Type:      1,
 				Class:     1,
 				ttl:       300,
-				expiresAt: &[]time.Time{time.Now().Add(200 * time.Second)}[0],
+				expiresAt: &[]time.Time{now.Add(200 * time.Second)}[0],
 				Data:      []byte{192, 0, 2, 1},
 			},
-			expectedDuration: 200 * time.Second, // Approximate
+			expectedDuration: 200 * time.Second,
 		},
 		{
 			name: "cached record expired",
@@ -430,7 +426,7 @@ func TestResourceRecord_TTLRemaining(t *testing.T) {
 				Type:      1,
 				Class:     1,
 				ttl:       300,
-				expiresAt: &[]time.Time{time.Now().Add(-100 * time.Second)}[0],
+				expiresAt: &[]time.Time{now.Add(-100 * time.Second)}[0],
 				Data:      []byte{192, 0, 2, 1},
 			},
 			expectedDuration: 0,
@@ -439,26 +435,9 @@ func TestResourceRecord_TTLRemaining(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			remaining := tt.record.TTLRemaining()
-
-			if tt.record.expiresAt == nil {
-				// Authoritative record should return original TTL
-				if remaining != tt.expectedDuration {
-					t.Errorf("Expected TTL remaining %v, got %v", tt.expectedDuration, remaining)
-				}
-			} else {
-				// Cached record - test within reasonable bounds due to time precision
-				if tt.expectedDuration == 0 {
-					if remaining != 0 {
-						t.Errorf("Expected TTL remaining %v, got %v", tt.expectedDuration, remaining)
-					}
-				} else {
-					// Allow some tolerance for time passage during test execution
-					tolerance := 2 * time.Second
-					if remaining < tt.expectedDuration-tolerance || remaining > tt.expectedDuration+tolerance {
-						t.Errorf("Expected TTL remaining ~%v, got %v", tt.expectedDuration, remaining)
-					}
-				}
+			remaining := tt.record.TTLRemaining(now)
+			if remaining != tt.expectedDuration {
+				t.Errorf("Expected TTL remaining %v, got %v", tt.expectedDuration, remaining)
 			}
 		})
 	}
@@ -494,8 +473,9 @@ func TestResourceRecord_IsAuthoritative(t *testing.T) {
 }
 
 func TestResourceRecord_IsExpired(t *testing.T) {
-	futureTime := time.Now().Add(300 * time.Second)
-	pastTime := time.Now().Add(-300 * time.Second)
+	now := time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC)
+	futureTime := now.Add(300 * time.Second)
+	pastTime := now.Add(-300 * time.Second)
 
 	tests := []struct {
 		name            string
@@ -542,13 +522,65 @@ func TestResourceRecord_IsExpired(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if tt.record.IsExpired() != tt.expectedExpired {
-				t.Errorf("Expected IsExpired() = %v, got %v", tt.expectedExpired, tt.record.IsExpired())
+			if tt.record.IsExpired(now) != tt.expectedExpired {
+				t.Errorf("Expected IsExpired() = %v, got %v", tt.expectedExpired, tt.record.IsExpired(now))
 			}
 		})
 	}
 }
 
+func TestResourceRecord_OriginalTTL(t *testing.T) {
+	now := time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC)
+	created := now.Add(-100 * time.Second)
+	rr, err := NewCachedResourceRecord("example.com.", 1, 1, 300, []byte{192, 0, 2, 1}, "192.0.2.1", created)
+	if err != nil {
+		t.Fatalf("NewCachedResourceRecord() returned error: %v", err)
+	}
+	if got := rr.OriginalTTL(); got != 300 {
+		t.Errorf("Expected OriginalTTL() = 300, got %d", got)
+	}
+	if got := rr.TTL(now); got != 200 {
+		t.Errorf("Expected TTL() = 200 after 100s in the cache, got %d", got)
+	}
+}
+
+func TestResourceRecord_ExpiredFor(t *testing.T) {
+	now := time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC)
+	futureTime := now.Add(300 * time.Second)
+	pastTime := now.Add(-300 * time.Second)
+
+	authoritative := ResourceRecord{Name: "example.com.", Type: 1, Class: 1, ttl: 300, Data: []byte{192, 0, 2, 1}}
+	if got := authoritative.ExpiredFor(now); got != 0 {
+		t.Errorf("Expected ExpiredFor() = 0 for authoritative record, got %v", got)
+	}
+
+	fresh := ResourceRecord{Name: "example.com.", Type: 1, Class: 1, ttl: 300, expiresAt: &futureTime, Data: []byte{192, 0, 2, 1}}
+	if got := fresh.ExpiredFor(now); got != 0 {
+		t.Errorf("Expected ExpiredFor() = 0 for unexpired record, got %v", got)
+	}
+
+	expired := ResourceRecord{Name: "example.com.", Type: 1, Class: 1, ttl: 300, expiresAt: &pastTime, Data: []byte{192, 0, 2, 1}}
+	if got := expired.ExpiredFor(now); got != 300*time.Second {
+		t.Errorf("Expected ExpiredFor() = 300s, got %v", got)
+	}
+}
+
+func TestResourceRecord_ExpiresAt(t *testing.T) {
+	authoritative := ResourceRecord{Name: "example.com.", Type: 1, Class: 1, ttl: 300, Data: []byte{192, 0, 2, 1}}
+	if got := authoritative.ExpiresAt(); !got.IsZero() {
+		t.Errorf("Expected zero ExpiresAt() for authoritative record, got %v", got)
+	}
+
+	now := time.Now()
+	cached, err := NewCachedResourceRecord("example.com.", 1, 1, 300, []byte{192, 0, 2, 1}, "192.0.2.1", now)
+	if err != nil {
+		t.Fatalf("NewCachedResourceRecord() returned error: %v", err)
+	}
+	if got, want := cached.ExpiresAt(), now.Add(300*time.Second); !got.Equal(want) {
+		t.Errorf("Expected ExpiresAt() = %v, got %v", want, got)
+	}
+}
+
 func TestResourceRecord_CacheKey(t *testing.T) {
 	rr1 := ResourceRecord{
 		Name:  "example.com.",
@@ -712,9 +744,10 @@ func BenchmarkResourceRecord_TTL(b *testing.B) {
 		Data:      []byte{192, 0, 2, 1},
 	}
 
+	now := time.Now()
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_ = rr.TTL()
+		_ = rr.TTL(now)
 	}
 }
 
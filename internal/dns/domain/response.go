@@ -12,6 +12,12 @@ type DNSResponse struct {
 	Answers    []ResourceRecord
 	Authority  []ResourceRecord
 	Additional []ResourceRecord
+	// Truncated reflects the TC header flag (RFC 1035 §4.1.1). When set, the
+	// message was cut short by the sender and should be retried over TCP.
+	Truncated bool
+	// AuthenticData reflects the AD header flag (RFC 4035 §3.2.3): every
+	// record in the answer and authority sections was validated by DNSSEC.
+	AuthenticData bool
 }
 
 // NewDNSResponse constructs a DNSResponse and validates its fields.
@@ -8,26 +8,28 @@ type RRType uint16
 
 // DNS Resource Record Type constants
 const (
-	RRTypeA      RRType = 1   // A - IPv4 address
-	RRTypeNS     RRType = 2   // NS - Name server
-	RRTypeCNAME  RRType = 5   // CNAME - Canonical name
-	RRTypeSOA    RRType = 6   // SOA - Start of authority
-	RRTypePTR    RRType = 12  // PTR - Pointer
-	RRTypeMX     RRType = 15  // MX - Mail exchange
-	RRTypeTXT    RRType = 16  // TXT - Text
-	RRTypeAAAA   RRType = 28  // AAAA - IPv6 address
-	RRTypeSRV    RRType = 33  // SRV - Service
-	RRTypeNAPTR  RRType = 35  // NAPTR - Naming authority pointer
-	RRTypeOPT    RRType = 41  // OPT - EDNS option
-	RRTypeDS     RRType = 43  // DS - Delegation signer
-	RRTypeRRSIG  RRType = 46  // RRSIG - Resource record signature
-	RRTypeNSEC   RRType = 47  // NSEC - Next secure
-	RRTypeDNSKEY RRType = 48  // DNSKEY - DNS key
-	RRTypeTLSA   RRType = 52  // TLSA - TLS association
-	RRTypeSVCB   RRType = 64  // SVCB - Service binding
-	RRTypeHTTPS  RRType = 65  // HTTPS - HTTPS binding
-	RRTypeANY    RRType = 255 // ANY - Any type (query only)
-	RRTypeCAA    RRType = 257 // CAA - Certificate authority authorization
+	RRTypeA          RRType = 1   // A - IPv4 address
+	RRTypeNS         RRType = 2   // NS - Name server
+	RRTypeCNAME      RRType = 5   // CNAME - Canonical name
+	RRTypeSOA        RRType = 6   // SOA - Start of authority
+	RRTypePTR        RRType = 12  // PTR - Pointer
+	RRTypeMX         RRType = 15  // MX - Mail exchange
+	RRTypeTXT        RRType = 16  // TXT - Text
+	RRTypeAAAA       RRType = 28  // AAAA - IPv6 address
+	RRTypeSRV        RRType = 33  // SRV - Service
+	RRTypeNAPTR      RRType = 35  // NAPTR - Naming authority pointer
+	RRTypeOPT        RRType = 41  // OPT - EDNS option
+	RRTypeDS         RRType = 43  // DS - Delegation signer
+	RRTypeRRSIG      RRType = 46  // RRSIG - Resource record signature
+	RRTypeNSEC       RRType = 47  // NSEC - Next secure
+	RRTypeDNSKEY     RRType = 48  // DNSKEY - DNS key
+	RRTypeNSEC3      RRType = 50  // NSEC3 - Hashed next secure
+	RRTypeNSEC3PARAM RRType = 51  // NSEC3PARAM - NSEC3 parameters
+	RRTypeTLSA       RRType = 52  // TLSA - TLS association
+	RRTypeSVCB       RRType = 64  // SVCB - Service binding
+	RRTypeHTTPS      RRType = 65  // HTTPS - HTTPS binding
+	RRTypeANY        RRType = 255 // ANY - Any type (query only)
+	RRTypeCAA        RRType = 257 // CAA - Certificate authority authorization
 )
 
 // IsValid returns true if the RRType is one of the supported types.
@@ -35,7 +37,7 @@ func (t RRType) IsValid() bool {
 	switch t {
 	case RRTypeA, RRTypeNS, RRTypeCNAME, RRTypeSOA, RRTypePTR, RRTypeMX, RRTypeTXT,
 		RRTypeAAAA, RRTypeSRV, RRTypeNAPTR, RRTypeOPT, RRTypeDS, RRTypeRRSIG,
-		RRTypeNSEC, RRTypeDNSKEY, RRTypeTLSA, RRTypeSVCB, RRTypeHTTPS, RRTypeANY, RRTypeCAA:
+		RRTypeNSEC, RRTypeDNSKEY, RRTypeNSEC3, RRTypeNSEC3PARAM, RRTypeTLSA, RRTypeSVCB, RRTypeHTTPS, RRTypeANY, RRTypeCAA:
 		return true
 	default:
 		return false
@@ -76,6 +78,10 @@ func (t RRType) String() string {
 		return "NSEC"
 	case RRTypeDNSKEY:
 		return "DNSKEY"
+	case RRTypeNSEC3:
+		return "NSEC3"
+	case RRTypeNSEC3PARAM:
+		return "NSEC3PARAM"
 	case RRTypeTLSA:
 		return "TLSA"
 	case RRTypeSVCB:
@@ -124,6 +130,10 @@ func RRTypeFromString(s string) RRType {
 		return RRTypeNSEC
 	case "DNSKEY":
 		return RRTypeDNSKEY
+	case "NSEC3":
+		return RRTypeNSEC3
+	case "NSEC3PARAM":
+		return RRTypeNSEC3PARAM
 	case "TLSA":
 		return RRTypeTLSA
 	case "SVCB":
@@ -1,6 +1,9 @@
 package domain
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/haukened/rr-dns/internal/dns/common/utils"
 )
 
@@ -16,3 +19,25 @@ func GenerateCacheKey(name string, t RRType, c RRClass) string {
 	// construct the cache key
 	return apexDomain + "|" + name + "|" + t.String() + "|" + c.String()
 }
+
+// ParseCacheKey splits a key made by GenerateCacheKey back into its canonical
+// name, type and class. ok is false when key is not in that format.
+func ParseCacheKey(key string) (name string, t RRType, c RRClass, ok bool) {
+	parts := strings.Split(key, "|")
+	if len(parts) != 4 {
+		return "", 0, 0, false
+	}
+	t = RRTypeFromString(parts[2])
+	if t == 0 {
+		var n uint16
+		if _, err := fmt.Sscanf(parts[2], "UNKNOWN(%d)", &n); err != nil {
+			return "", 0, 0, false
+		}
+		t = RRType(n)
+	}
+	c = ParseRRClass(parts[3])
+	if c == 0 {
+		return "", 0, 0, false
+	}
+	return parts[1], t, c, true
+}
@@ -137,3 +137,29 @@ func TestGenerateCacheKey_PipeSeparatorSafety(t *testing.T) {
 		})
 	}
 }
+
+func TestParseCacheKey(t *testing.T) {
+	cases := []struct {
+		name      string
+		key       string
+		wantName  string
+		wantType  RRType
+		wantClass RRClass
+		wantOK    bool
+	}{
+		{name: "round trip", key: GenerateCacheKey("WWW.Example.com.", RRTypeAAAA, RRClassIN), wantName: "www.example.com", wantType: RRTypeAAAA, wantClass: RRClassIN, wantOK: true},
+		{name: "unknown type", key: GenerateCacheKey("example.com", RRType(65280), RRClassIN), wantName: "example.com", wantType: RRType(65280), wantClass: RRClassIN, wantOK: true},
+		{name: "too few fields", key: "example.com|A|IN", wantOK: false},
+		{name: "bad type", key: "example.com|example.com|BOGUS|IN", wantOK: false},
+		{name: "bad class", key: "example.com|example.com|A|UNKNOWN", wantOK: false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			name, rrtype, class, ok := ParseCacheKey(tc.key)
+			if ok != tc.wantOK || name != tc.wantName || rrtype != tc.wantType || class != tc.wantClass {
+				t.Errorf("ParseCacheKey(%q) = %q, %v, %v, %v; want %q, %v, %v, %v",
+					tc.key, name, rrtype, class, ok, tc.wantName, tc.wantType, tc.wantClass, tc.wantOK)
+			}
+		})
+	}
+}
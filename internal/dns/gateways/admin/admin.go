@@ -0,0 +1,271 @@
+// Package admin serves the optional HTTP admin API: liveness and readiness
+// probes, build information, the effective configuration with secrets
+// redacted, the loaded zones and the health of upstream servers, the records
+// of editable zones, the upstream cache's entries and counters, and the
+// history of answered queries. It listens on a TCP address protected by a bearer
+// token, on a unix socket, or both.
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/common/log"
+	"github.com/haukened/rr-dns/internal/dns/gateways/upstream"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+const (
+	// readHeaderTimeout bounds how long a client may take to send request headers.
+	readHeaderTimeout = 5 * time.Second
+	// shutdownTimeout bounds how long Stop waits for in-flight requests.
+	shutdownTimeout = 5 * time.Second
+	// socketMode restricts the unix socket to the user running the server.
+	socketMode = 0o600
+)
+
+var (
+	errNoListener    = errors.New("admin API needs a listen address or a unix socket")
+	errTokenRequired = errors.New("admin API listen address requires a token")
+)
+
+// UpstreamHealth reports the health of upstream servers, as upstream.Resolver does.
+type UpstreamHealth interface {
+	Health() []upstream.ServerHealth
+}
+
+// BuildInfo describes the running binary.
+type BuildInfo struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	// Revision, Time and Modified describe the VCS commit the binary was built
+	// from, when the build recorded it.
+	Revision string `json:"revision,omitempty"`
+	Time     string `json:"time,omitempty"`
+	Modified bool   `json:"modified,omitempty"`
+}
+
+// Options configures a Server. At least one of Addr and Socket is required.
+type Options struct {
+	// Addr is the host:port of a TCP listener, e.g. "127.0.0.1:8053". It
+	// requires Token.
+	Addr string
+	// Socket is the path of a unix socket listener, created with mode 0600 so
+	// only the user running the server can connect. A stale socket left at the
+	// path is replaced.
+	Socket string
+	// Token is the bearer token every request must present, except liveness
+	// and readiness probes. Leave empty to serve the socket without one.
+	Token string
+	// Build is served by the version endpoint.
+	Build BuildInfo
+	// Config is the effective configuration, with secrets already redacted,
+	// served as JSON by the config endpoint.
+	Config any
+	// Zones reports the loaded authoritative zones; nil reports none.
+	Zones resolver.ZoneCache
+	// RequireZones makes readiness wait until Zones holds at least one zone.
+	// Set it when zone files are configured, so a server that has not loaded
+	// them is not sent traffic it would answer from upstream instead.
+	RequireZones bool
+	// Upstreams report the health of the default upstream servers. Readiness
+	// requires one healthy server among them, unless there are none.
+	Upstreams []UpstreamHealth
+	// ForwardZones report the health of each conditional forward zone's
+	// servers, by zone. They are listed and counted separately and do not
+	// affect readiness.
+	ForwardZones map[string]UpstreamHealth
+	// ZoneEditor serves the zone record endpoints; nil leaves them out.
+	ZoneEditor resolver.ZoneEditor
+	// Cache serves the upstream cache endpoints; nil leaves them out.
+	Cache resolver.CacheManager
+	// History serves the query history endpoint; nil leaves it out.
+	History resolver.QueryHistory
+	// Clock is the time source for the remaining TTLs of dumped cache
+	// entries (default: the system clock).
+	Clock  clock.Clock
+	Logger log.Logger
+}
+
+// Server is the optional admin API listener.
+type Server struct {
+	addr      string
+	socket    string
+	token     string
+	build     BuildInfo
+	config    any
+	zones     resolver.ZoneCache
+	needZones bool
+	upstreams []UpstreamHealth
+	forwards  map[string]UpstreamHealth
+	editor    resolver.ZoneEditor
+	cache     resolver.CacheManager
+	history   resolver.QueryHistory
+	clock     clock.Clock
+	logger    log.Logger
+	serving   atomic.Bool
+
+	mu        sync.Mutex
+	server    *http.Server
+	listeners []net.Listener
+}
+
+// New creates an admin API server. It does not listen until Start.
+func New(opts Options) (*Server, error) {
+	if opts.Addr == "" && opts.Socket == "" {
+		return nil, errNoListener
+	}
+	if opts.Addr != "" && opts.Token == "" {
+		return nil, errTokenRequired
+	}
+	if opts.Clock == nil {
+		opts.Clock = &clock.RealClock{}
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.NewNoopLogger()
+	}
+	return &Server{
+		addr:      opts.Addr,
+		socket:    opts.Socket,
+		token:     opts.Token,
+		build:     opts.Build,
+		config:    opts.Config,
+		zones:     opts.Zones,
+		needZones: opts.RequireZones,
+		upstreams: opts.Upstreams,
+		forwards:  opts.ForwardZones,
+		editor:    opts.ZoneEditor,
+		cache:     opts.Cache,
+		history:   opts.History,
+		clock:     opts.Clock,
+		logger:    opts.Logger,
+	}, nil
+}
+
+// SetServing records whether the DNS server is answering queries. Readiness
+// requires it, so it should be set once the zones are loaded and the transport
+// is listening, and cleared when shutdown begins.
+func (s *Server) SetServing(serving bool) {
+	s.serving.Store(serving)
+}
+
+// Start binds the listeners and serves requests in the background until Stop.
+func (s *Server) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.server != nil {
+		return fmt.Errorf("admin server already running")
+	}
+	var listeners []net.Listener
+	if s.addr != "" {
+		l, err := net.Listen("tcp", s.addr)
+		if err != nil {
+			return fmt.Errorf("failed to bind admin listener on %s: %w", s.addr, err)
+		}
+		listeners = append(listeners, l)
+	}
+	if s.socket != "" {
+		l, err := listenUnix(s.socket)
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return err
+		}
+		listeners = append(listeners, l)
+	}
+
+	s.server = &http.Server{Handler: s.Handler(), ReadHeaderTimeout: readHeaderTimeout}
+	s.listeners = listeners
+	for _, l := range listeners {
+		go func(server *http.Server, l net.Listener) {
+			if err := server.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				s.logger.Error(map[string]any{"error": err, "address": l.Addr().String()}, "Admin server failed")
+			}
+		}(s.server, l)
+	}
+
+	s.logger.Info(map[string]any{
+		"addresses": s.addresses(),
+		"token":     s.token != "",
+	}, "Admin server started")
+	return nil
+}
+
+// listenUnix listens on a unix socket at path that only its owner can use,
+// removing a socket left behind by an earlier run.
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&fs.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale admin socket %s: %w", path, err)
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind admin socket %s: %w", path, err)
+	}
+	if err := os.Chmod(path, socketMode); err != nil {
+		_ = l.Close()
+		return nil, fmt.Errorf("failed to restrict admin socket %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// Stop shuts the listeners down, waiting briefly for in-flight requests and
+// then closing the connections still open. The unix socket is removed.
+func (s *Server) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := s.server.Shutdown(ctx)
+	if err != nil {
+		// Cut off the requests still running after the timeout
+		err = errors.Join(err, s.server.Close())
+	}
+	s.server = nil
+	s.listeners = nil
+	return err
+}
+
+// Addresses returns the addresses the listeners are bound to, or the
+// configured ones when the server is not running.
+func (s *Server) Addresses() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addresses()
+}
+
+// addresses implements Addresses; the caller must hold mu.
+func (s *Server) addresses() []string {
+	if len(s.listeners) > 0 {
+		addrs := make([]string, 0, len(s.listeners))
+		for _, l := range s.listeners {
+			addrs = append(addrs, l.Addr().String())
+		}
+		return addrs
+	}
+	var addrs []string
+	if s.addr != "" {
+		addrs = append(addrs, s.addr)
+	}
+	if s.socket != "" {
+		addrs = append(addrs, s.socket)
+	}
+	return addrs
+}
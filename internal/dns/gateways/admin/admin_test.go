@@ -0,0 +1,132 @@
+package admin
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/common/log"
+)
+
+// socketPath returns a unix socket path short enough for the platform limit.
+func socketPath(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "admin")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return filepath.Join(dir, "admin.sock")
+}
+
+// unixClient returns an HTTP client that connects to the unix socket at path.
+func unixClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(Options{})
+	assert.ErrorIs(t, err, errNoListener)
+
+	_, err = New(Options{Addr: "127.0.0.1:0"})
+	assert.ErrorIs(t, err, errTokenRequired)
+
+	s, err := New(Options{Addr: "127.0.0.1:0", Socket: "/run/admin.sock", Token: "s3cret"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1:0", "/run/admin.sock"}, s.Addresses())
+}
+
+func TestServer_StartStop(t *testing.T) {
+	path := socketPath(t)
+	s, err := New(Options{Addr: "127.0.0.1:0", Socket: path, Token: "s3cret", Logger: log.NewNoopLogger()})
+	require.NoError(t, err)
+
+	require.NoError(t, s.Start())
+	assert.Error(t, s.Start(), "starting twice fails")
+	addrs := s.Addresses()
+	require.Len(t, addrs, 2)
+	assert.Equal(t, path, addrs[1])
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(socketMode), info.Mode().Perm())
+
+	// The token applies on both listeners
+	client := &http.Client{Transport: &http.Transport{}}
+	req, err := http.NewRequest(http.MethodGet, "http://"+addrs[0]+PathVersion, nil)
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	req.Header.Set("Authorization", "Bearer s3cret")
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	unix := unixClient(path)
+	resp, err = unix.Get("http://admin" + PathLive)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, resp.Body.Close())
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.JSONEq(t, `{"status":"ok"}`, string(body))
+
+	// Drop the clients' keep-alive connections so none race Stop
+	client.CloseIdleConnections()
+	unix.CloseIdleConnections()
+	require.NoError(t, s.Stop())
+	require.NoError(t, s.Stop(), "stopping twice is harmless")
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "the socket is removed")
+	_, err = http.Get("http://" + addrs[0] + PathLive)
+	assert.Error(t, err)
+}
+
+func TestServer_StaleSocket(t *testing.T) {
+	path := socketPath(t)
+	stale, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	// Leave the socket file behind, as a crashed process would
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+
+	s, err := New(Options{Socket: path})
+	require.NoError(t, err)
+	require.NoError(t, s.Start())
+	defer func() { assert.NoError(t, s.Stop()) }()
+
+	resp, err := unixClient(path).Get("http://admin" + PathVersion)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "the socket needs no token when none is set")
+}
+
+func TestServer_StartErrors(t *testing.T) {
+	// A regular file at the socket path is not replaced
+	file := filepath.Join(t.TempDir(), "admin.sock")
+	require.NoError(t, os.WriteFile(file, nil, 0o600))
+	s, err := New(Options{Addr: "127.0.0.1:0", Socket: file, Token: "s3cret"})
+	require.NoError(t, err)
+	assert.Error(t, s.Start())
+	assert.Empty(t, s.listeners, "the TCP listener is closed again")
+	assert.NoError(t, s.Stop())
+
+	s, err = New(Options{Addr: "256.0.0.1:0", Token: "s3cret"})
+	require.NoError(t, err)
+	assert.Error(t, s.Start())
+	assert.NoError(t, s.Stop())
+}
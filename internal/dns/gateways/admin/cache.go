@@ -0,0 +1,142 @@
+package admin
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// Upstream cache endpoints, served when Options.Cache is set.
+const (
+	// PathCache lists every cache entry (GET) and flushes entries (DELETE).
+	// A flush removes every entry, or with one of the name, domain or type
+	// query parameters only the entries for that exact name, for a domain and
+	// the names below it, or of that record type.
+	PathCache = "/api/v1/cache"
+	// PathCacheStats serves the cache's size and activity counters.
+	PathCacheStats = PathCache + "/stats"
+)
+
+// CacheEntry is one upstream cache entry, as listed by PathCache. TTL is the
+// number of seconds it has left; RCode is set for negative entries only.
+type CacheEntry struct {
+	Name     string        `json:"name"`
+	Type     string        `json:"type"`
+	Class    string        `json:"class"`
+	Negative bool          `json:"negative,omitempty"`
+	RCode    string        `json:"rcode,omitempty"`
+	TTL      int64         `json:"ttl"`
+	Records  []CacheRecord `json:"records,omitempty"`
+}
+
+// CacheRecord is one record of a cache entry. TTL is 0 for records kept only
+// to be served stale.
+type CacheRecord struct {
+	TTL   int64  `json:"ttl"`
+	Value string `json:"value"`
+}
+
+// CacheStats is the body of PathCacheStats.
+type CacheStats struct {
+	Entries       int    `json:"entries"`
+	Bytes         int64  `json:"bytes"`
+	Hits          uint64 `json:"hits"`
+	Misses        uint64 `json:"misses"`
+	ExpiredOnRead uint64 `json:"expired_on_read"`
+	Evictions     uint64 `json:"evictions"`
+	Inserts       uint64 `json:"inserts"`
+}
+
+// CacheFlush is the body of a DELETE of PathCache.
+type CacheFlush struct {
+	Flushed int `json:"flushed"`
+}
+
+// routeCache registers the cache endpoints on mux.
+func (s *Server) routeCache(mux *http.ServeMux) {
+	mux.Handle("GET "+PathCache, s.authorize(http.HandlerFunc(s.handleDumpCache)))
+	mux.Handle("DELETE "+PathCache, s.authorize(http.HandlerFunc(s.handleFlushCache)))
+	mux.Handle("GET "+PathCacheStats, s.authorize(http.HandlerFunc(s.handleCacheStats)))
+}
+
+func (s *Server) handleDumpCache(w http.ResponseWriter, _ *http.Request) {
+	now := s.clock.Now()
+	entries := []CacheEntry{}
+	for _, entry := range s.cache.Dump() {
+		entries = append(entries, toCacheEntry(entry, now))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"entries": entries})
+}
+
+func (s *Server) handleFlushCache(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	name, suffix, rrtype := query.Get("name"), query.Get("domain"), query.Get("type")
+	selectors := 0
+	for _, v := range []string{name, suffix, rrtype} {
+		if v != "" {
+			selectors++
+		}
+	}
+	if selectors > 1 {
+		writeError(w, http.StatusBadRequest, "flush by at most one of name, domain and type")
+		return
+	}
+
+	var flushed int
+	switch {
+	case name != "":
+		flushed = s.cache.FlushName(name)
+	case suffix != "":
+		flushed = s.cache.FlushDomain(suffix)
+	case rrtype != "":
+		t := domain.RRTypeFromString(strings.ToUpper(rrtype))
+		if t == 0 {
+			writeError(w, http.StatusBadRequest, "unknown record type "+rrtype)
+			return
+		}
+		flushed = s.cache.FlushType(t)
+	default:
+		flushed = s.cache.Flush()
+	}
+	s.logger.Info(map[string]any{
+		"name":    name,
+		"domain":  suffix,
+		"type":    rrtype,
+		"flushed": flushed,
+	}, "Cache flushed")
+	writeJSON(w, http.StatusOK, CacheFlush{Flushed: flushed})
+}
+
+func (s *Server) handleCacheStats(w http.ResponseWriter, _ *http.Request) {
+	stats := s.cache.Stats()
+	writeJSON(w, http.StatusOK, CacheStats{
+		Entries:       stats.Entries,
+		Bytes:         stats.Bytes,
+		Hits:          stats.Hits,
+		Misses:        stats.Misses,
+		ExpiredOnRead: stats.ExpiredOnRead,
+		Evictions:     stats.Evictions,
+		Inserts:       stats.Inserts,
+	})
+}
+
+// toCacheEntry converts a cache entry for a response.
+func toCacheEntry(entry resolver.CacheEntry, now time.Time) CacheEntry {
+	out := CacheEntry{
+		Name:     entry.Name,
+		Type:     entry.Type.String(),
+		Class:    entry.Class.String(),
+		Negative: entry.Negative,
+		TTL:      int64(entry.TTL / time.Second),
+	}
+	if entry.Negative {
+		out.RCode = entry.RCode.String()
+	}
+	for _, rr := range entry.Records {
+		out.Records = append(out.Records, CacheRecord{TTL: int64(rr.TTLRemaining(now) / time.Second), Value: rr.Text})
+	}
+	return out
+}
@@ -0,0 +1,125 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// fakeCache serves fixed entries and stats, recording the flushes it is asked for.
+type fakeCache struct {
+	entries []resolver.CacheEntry
+	stats   resolver.CacheStats
+
+	flushed string
+}
+
+var _ resolver.CacheManager = (*fakeCache)(nil)
+
+func (f *fakeCache) Flush() int                    { f.flushed = "all"; return 3 }
+func (f *fakeCache) FlushName(name string) int     { f.flushed = "name " + name; return 1 }
+func (f *fakeCache) FlushDomain(suffix string) int { f.flushed = "domain " + suffix; return 2 }
+func (f *fakeCache) FlushType(t domain.RRType) int { f.flushed = "type " + t.String(); return 4 }
+func (f *fakeCache) Dump() []resolver.CacheEntry   { return f.entries }
+func (f *fakeCache) Stats() resolver.CacheStats    { return f.stats }
+
+func TestHandler_Cache_NotServedWithoutCache(t *testing.T) {
+	s := newTestServer(t, Options{})
+	for _, path := range []string{PathCache, PathCacheStats} {
+		rec := get(t, s.Handler(), path, "", nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code, path)
+	}
+}
+
+func TestHandler_Cache_Authorization(t *testing.T) {
+	s := newTestServer(t, Options{Token: "s3cret", Cache: &fakeCache{}})
+	for _, path := range []string{PathCache, PathCacheStats} {
+		rec := get(t, s.Handler(), path, "", nil)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, path)
+		rec = get(t, s.Handler(), path, "s3cret", nil)
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+	}
+
+	cache := &fakeCache{}
+	s = newTestServer(t, Options{Token: "s3cret", Cache: cache})
+	rec := send(t, s.Handler(), http.MethodDelete, PathCache, "", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Empty(t, cache.flushed, "an unauthorized flush must not reach the cache")
+}
+
+func TestHandler_Cache_Dump(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	clk := &clock.MockClock{CurrentTime: now.Add(100 * time.Second)}
+	record, err := domain.NewCachedResourceRecord("example.com.", domain.RRTypeA, domain.RRClassIN, 300, []byte{192, 0, 2, 1}, "192.0.2.1", now)
+	require.NoError(t, err)
+	cache := &fakeCache{entries: []resolver.CacheEntry{
+		{Key: record.CacheKey(), Name: "example.com", Type: domain.RRTypeA, Class: domain.RRClassIN, TTL: 300 * time.Second, Records: []domain.ResourceRecord{record}},
+		{Key: "nope.example.com|AAAA|IN", Name: "nope.example.com", Type: domain.RRTypeAAAA, Class: domain.RRClassIN, Negative: true, RCode: domain.NXDOMAIN, TTL: 90 * time.Second},
+	}}
+	s := newTestServer(t, Options{Cache: cache, Clock: clk})
+
+	var got struct{ Entries []CacheEntry }
+	rec := get(t, s.Handler(), PathCache, "", &got)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.Len(t, got.Entries, 2)
+	assert.Equal(t, "example.com", got.Entries[0].Name)
+	assert.Equal(t, "A", got.Entries[0].Type)
+	assert.Equal(t, "IN", got.Entries[0].Class)
+	assert.Equal(t, int64(300), got.Entries[0].TTL)
+	require.Len(t, got.Entries[0].Records, 1)
+	assert.Equal(t, "192.0.2.1", got.Entries[0].Records[0].Value)
+	assert.Equal(t, int64(200), got.Entries[0].Records[0].TTL, "the TTL left at the server's clock")
+	assert.Equal(t, CacheEntry{Name: "nope.example.com", Type: "AAAA", Class: "IN", Negative: true, RCode: "NXDOMAIN", TTL: 90}, got.Entries[1])
+
+	// An empty cache lists no entries rather than null
+	s = newTestServer(t, Options{Cache: &fakeCache{}})
+	rec = get(t, s.Handler(), PathCache, "", nil)
+	assert.JSONEq(t, `{"entries":[]}`, rec.Body.String())
+}
+
+func TestHandler_Cache_Flush(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       string
+		wantStatus  int
+		wantFlushed string
+		wantCount   int
+	}{
+		{name: "everything", wantStatus: http.StatusOK, wantFlushed: "all", wantCount: 3},
+		{name: "by name", query: "?name=www.example.com", wantStatus: http.StatusOK, wantFlushed: "name www.example.com", wantCount: 1},
+		{name: "by domain", query: "?domain=example.com", wantStatus: http.StatusOK, wantFlushed: "domain example.com", wantCount: 2},
+		{name: "by type", query: "?type=aaaa", wantStatus: http.StatusOK, wantFlushed: "type AAAA", wantCount: 4},
+		{name: "unknown type", query: "?type=BOGUS", wantStatus: http.StatusBadRequest},
+		{name: "two selectors", query: "?name=www.example.com&type=A", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := &fakeCache{}
+			s := newTestServer(t, Options{Cache: cache})
+			rec := send(t, s.Handler(), http.MethodDelete, PathCache+tt.query, "", "")
+			assert.Equal(t, tt.wantStatus, rec.Code, rec.Body.String())
+			assert.Equal(t, tt.wantFlushed, cache.flushed)
+			if tt.wantStatus == http.StatusOK {
+				var got CacheFlush
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+				assert.Equal(t, tt.wantCount, got.Flushed)
+			}
+		})
+	}
+}
+
+func TestHandler_Cache_Stats(t *testing.T) {
+	stats := resolver.CacheStats{Entries: 2, Bytes: 512, Hits: 10, Misses: 4, ExpiredOnRead: 1, Evictions: 3, Inserts: 7}
+	s := newTestServer(t, Options{Cache: &fakeCache{stats: stats}})
+	rec := get(t, s.Handler(), PathCacheStats, "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"entries":2,"bytes":512,"hits":10,"misses":4,"expired_on_read":1,"evictions":3,"inserts":7}`, rec.Body.String())
+}
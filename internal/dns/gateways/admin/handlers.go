@@ -0,0 +1,196 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/haukened/rr-dns/internal/dns/gateways/upstream"
+)
+
+// Admin API endpoints.
+const (
+	// PathLive answers 200 while the process is running. It needs no token.
+	PathLive = "/healthz"
+	// PathReady answers 200 when the server is ready for queries and 503
+	// otherwise. It needs no token.
+	PathReady = "/readyz"
+	// PathVersion serves the build information.
+	PathVersion = "/api/v1/version"
+	// PathConfig serves the effective configuration with secrets redacted.
+	PathConfig = "/api/v1/config"
+	// PathZones lists the loaded zones with their record counts.
+	PathZones = "/api/v1/zones"
+	// PathUpstreams lists the health of every upstream server, the default
+	// ones apart from those of each forward zone.
+	PathUpstreams = "/api/v1/upstreams"
+)
+
+// contentType is the media type of every response.
+const contentType = "application/json"
+
+// ZoneStatus is one loaded zone, as listed by PathZones.
+type ZoneStatus struct {
+	Zone    string `json:"zone"`
+	Records int    `json:"records"`
+}
+
+// Readiness is the body of PathReady. Ready requires Serving, at least one
+// loaded zone when zone files are configured (Options.RequireZones), and a
+// healthy default upstream server when any are configured. Forward zones are
+// counted on their own and do not affect it, since they only serve their zone.
+type Readiness struct {
+	Ready            bool `json:"ready"`
+	Serving          bool `json:"serving"`
+	Zones            int  `json:"zones"`
+	Upstreams        int  `json:"upstreams"`
+	HealthyUpstreams int  `json:"healthy_upstreams"`
+	// ForwardZones counts the servers of each forward zone, by zone.
+	ForwardZones map[string]UpstreamCount `json:"forward_zones,omitempty"`
+}
+
+// UpstreamCount counts the servers of one group of upstream servers and how
+// many of them are healthy.
+type UpstreamCount struct {
+	Upstreams        int `json:"upstreams"`
+	HealthyUpstreams int `json:"healthy_upstreams"`
+}
+
+// count counts servers and the healthy ones among them.
+func count(servers []upstream.ServerHealth) UpstreamCount {
+	c := UpstreamCount{Upstreams: len(servers)}
+	for _, h := range servers {
+		if h.Healthy {
+			c.HealthyUpstreams++
+		}
+	}
+	return c
+}
+
+// errorBody is the body of every error response.
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+// Handler returns the admin API routes, requiring the bearer token where
+// one is configured.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+PathLive, s.handleLive)
+	mux.HandleFunc("GET "+PathReady, s.handleReady)
+	mux.Handle("GET "+PathVersion, s.authorize(http.HandlerFunc(s.handleVersion)))
+	mux.Handle("GET "+PathConfig, s.authorize(http.HandlerFunc(s.handleConfig)))
+	mux.Handle("GET "+PathZones, s.authorize(http.HandlerFunc(s.handleZones)))
+	mux.Handle("GET "+PathUpstreams, s.authorize(http.HandlerFunc(s.handleUpstreams)))
+	if s.editor != nil {
+		s.routeRecords(mux)
+	}
+	if s.cache != nil {
+		s.routeCache(mux)
+	}
+	if s.history != nil {
+		s.routeQueries(mux)
+	}
+	return mux
+}
+
+// authorize rejects requests without the bearer token, when one is configured.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	if s.token == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="rr-dns"`)
+			writeError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleLive(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) handleReady(w http.ResponseWriter, _ *http.Request) {
+	state := s.readiness()
+	status := http.StatusOK
+	if !state.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, state)
+}
+
+// readiness checks whether the server is serving, has loaded its zones and
+// can reach a default upstream server.
+func (s *Server) readiness() Readiness {
+	state := Readiness{Serving: s.serving.Load()}
+	if s.zones != nil {
+		state.Zones = len(s.zones.Zones())
+	}
+	defaults := count(health(s.upstreams))
+	state.Upstreams, state.HealthyUpstreams = defaults.Upstreams, defaults.HealthyUpstreams
+	for zone, u := range s.forwards {
+		if state.ForwardZones == nil {
+			state.ForwardZones = make(map[string]UpstreamCount, len(s.forwards))
+		}
+		state.ForwardZones[zone] = count(u.Health())
+	}
+	state.Ready = state.Serving &&
+		(!s.needZones || state.Zones > 0) &&
+		(state.Upstreams == 0 || state.HealthyUpstreams > 0)
+	return state
+}
+
+func (s *Server) handleVersion(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.build)
+}
+
+func (s *Server) handleConfig(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.config)
+}
+
+func (s *Server) handleZones(w http.ResponseWriter, _ *http.Request) {
+	zones := []ZoneStatus{}
+	if s.zones != nil {
+		for _, zone := range s.zones.Zones() {
+			zones = append(zones, ZoneStatus{Zone: zone, Records: s.zones.RecordCount(zone)})
+		}
+	}
+	slices.SortFunc(zones, func(a, b ZoneStatus) int { return strings.Compare(a.Zone, b.Zone) })
+	writeJSON(w, http.StatusOK, map[string]any{"zones": zones})
+}
+
+func (s *Server) handleUpstreams(w http.ResponseWriter, _ *http.Request) {
+	forwards := make(map[string][]upstream.ServerHealth, len(s.forwards))
+	for zone, u := range s.forwards {
+		forwards[zone] = health([]UpstreamHealth{u})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"upstreams": health(s.upstreams), "forward_zones": forwards})
+}
+
+// health returns the health of every server of the upstream clients, one
+// entry per server of each client.
+func health(clients []UpstreamHealth) []upstream.ServerHealth {
+	servers := []upstream.ServerHealth{}
+	for _, u := range clients {
+		servers = append(servers, u.Health()...)
+	}
+	return servers
+}
+
+// writeJSON writes v as the JSON body of a response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error response with the given status.
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorBody{Error: message})
+}
@@ -0,0 +1,253 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/gateways/upstream"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// fakeZones reports fixed zones and record counts.
+type fakeZones struct {
+	resolver.ZoneCache
+	counts map[string]int
+}
+
+func (f *fakeZones) Zones() []string {
+	zones := make([]string, 0, len(f.counts))
+	for zone := range f.counts {
+		zones = append(zones, zone)
+	}
+	return zones
+}
+
+func (f *fakeZones) RecordCount(zoneRoot string) int { return f.counts[zoneRoot] }
+
+// fakeUpstream reports fixed server health.
+type fakeUpstream []upstream.ServerHealth
+
+func (f fakeUpstream) Health() []upstream.ServerHealth { return f }
+
+func newTestServer(t *testing.T, opts Options) *Server {
+	t.Helper()
+	if opts.Addr == "" && opts.Socket == "" {
+		opts.Socket = "unused"
+	}
+	s, err := New(opts)
+	require.NoError(t, err)
+	return s
+}
+
+// get requests path from handler with token, decoding the JSON body into v.
+func get(t *testing.T, handler http.Handler, path, token string, v any) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if v != nil {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), v), rec.Body.String())
+	}
+	return rec
+}
+
+func TestHandler_Live(t *testing.T) {
+	s := newTestServer(t, Options{Token: "s3cret"})
+	var body map[string]string
+	rec := get(t, s.Handler(), PathLive, "", &body)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, contentType, rec.Header().Get("Content-Type"))
+	assert.Equal(t, "ok", body["status"])
+}
+
+func TestHandler_Ready(t *testing.T) {
+	healthy := fakeUpstream{{Server: "192.0.2.1:53", Healthy: true}, {Server: "192.0.2.2:53"}}
+	down := fakeUpstream{{Server: "192.0.2.3:53"}}
+	zones := &fakeZones{counts: map[string]int{"example.com": 3}}
+
+	tests := []struct {
+		name      string
+		serving   bool
+		zones     *fakeZones
+		required  bool
+		upstreams []UpstreamHealth
+		forwards  map[string]UpstreamHealth
+		want      Readiness
+	}{
+		{
+			name:      "serving with a healthy upstream",
+			serving:   true,
+			upstreams: []UpstreamHealth{healthy, down},
+			want:      Readiness{Ready: true, Serving: true, Zones: 1, Upstreams: 3, HealthyUpstreams: 1},
+		},
+		{
+			name:      "not serving yet",
+			upstreams: []UpstreamHealth{healthy},
+			want:      Readiness{Zones: 1, Upstreams: 2, HealthyUpstreams: 1},
+		},
+		{
+			name:      "every upstream down",
+			serving:   true,
+			upstreams: []UpstreamHealth{down},
+			want:      Readiness{Serving: true, Zones: 1, Upstreams: 1},
+		},
+		{
+			name:      "forward zones do not count towards readiness",
+			serving:   true,
+			upstreams: []UpstreamHealth{down},
+			forwards:  map[string]UpstreamHealth{"corp.example": healthy},
+			want: Readiness{Serving: true, Zones: 1, Upstreams: 1,
+				ForwardZones: map[string]UpstreamCount{"corp.example": {Upstreams: 2, HealthyUpstreams: 1}}},
+		},
+		{
+			name:      "a forward zone down does not block readiness",
+			serving:   true,
+			upstreams: []UpstreamHealth{healthy},
+			forwards:  map[string]UpstreamHealth{"corp.example": down},
+			want: Readiness{Ready: true, Serving: true, Zones: 1, Upstreams: 2, HealthyUpstreams: 1,
+				ForwardZones: map[string]UpstreamCount{"corp.example": {Upstreams: 1}}},
+		},
+		{
+			name:    "no upstreams configured",
+			serving: true,
+			want:    Readiness{Ready: true, Serving: true, Zones: 1},
+		},
+		{
+			name:      "zone files configured and loaded",
+			serving:   true,
+			required:  true,
+			upstreams: []UpstreamHealth{healthy},
+			want:      Readiness{Ready: true, Serving: true, Zones: 1, Upstreams: 2, HealthyUpstreams: 1},
+		},
+		{
+			name:      "zone files configured but no zone loaded",
+			serving:   true,
+			zones:     &fakeZones{},
+			required:  true,
+			upstreams: []UpstreamHealth{healthy},
+			want:      Readiness{Serving: true, Upstreams: 2, HealthyUpstreams: 1},
+		},
+		{
+			name:      "no zones needed without zone files",
+			serving:   true,
+			zones:     &fakeZones{},
+			upstreams: []UpstreamHealth{healthy},
+			want:      Readiness{Ready: true, Serving: true, Upstreams: 2, HealthyUpstreams: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{Token: "s3cret", Zones: zones, RequireZones: tt.required, Upstreams: tt.upstreams, ForwardZones: tt.forwards}
+			if tt.zones != nil {
+				opts.Zones = tt.zones
+			}
+			s := newTestServer(t, opts)
+			s.SetServing(tt.serving)
+			var got Readiness
+			rec := get(t, s.Handler(), PathReady, "", &got)
+			assert.Equal(t, tt.want, got)
+			if tt.want.Ready {
+				assert.Equal(t, http.StatusOK, rec.Code)
+			} else {
+				assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+			}
+		})
+	}
+}
+
+func TestHandler_Authorization(t *testing.T) {
+	s := newTestServer(t, Options{Token: "s3cret"})
+	for _, path := range []string{PathVersion, PathConfig, PathZones, PathUpstreams} {
+		t.Run(path, func(t *testing.T) {
+			var body errorBody
+			rec := get(t, s.Handler(), path, "", &body)
+			assert.Equal(t, http.StatusUnauthorized, rec.Code)
+			assert.Equal(t, `Bearer realm="rr-dns"`, rec.Header().Get("WWW-Authenticate"))
+			assert.NotEmpty(t, body.Error)
+
+			rec = get(t, s.Handler(), path, "wrong", nil)
+			assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+			rec = get(t, s.Handler(), path, "s3cret", nil)
+			assert.Equal(t, http.StatusOK, rec.Code)
+		})
+	}
+
+	// Without a token every endpoint is open
+	open := newTestServer(t, Options{Socket: "admin.sock"})
+	rec := get(t, open.Handler(), PathVersion, "", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Only GET is served
+	req := httptest.NewRequest(http.MethodPost, PathLive, nil)
+	rec = httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestHandler_Version(t *testing.T) {
+	build := BuildInfo{Name: "rr-dnsd", Version: "1.2.3", GoVersion: "go1.24.5", Revision: "abc123"}
+	s := newTestServer(t, Options{Build: build})
+	var got BuildInfo
+	rec := get(t, s.Handler(), PathVersion, "", &got)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, build, got)
+}
+
+func TestHandler_Config(t *testing.T) {
+	s := newTestServer(t, Options{Config: map[string]any{"port": 53, "admin_token": "[REDACTED]"}})
+	var got map[string]any
+	rec := get(t, s.Handler(), PathConfig, "", &got)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, map[string]any{"port": float64(53), "admin_token": "[REDACTED]"}, got)
+}
+
+func TestHandler_Zones(t *testing.T) {
+	s := newTestServer(t, Options{Zones: &fakeZones{counts: map[string]int{"example.org": 2, "example.com": 5}}})
+	var got struct{ Zones []ZoneStatus }
+	get(t, s.Handler(), PathZones, "", &got)
+	assert.Equal(t, []ZoneStatus{{Zone: "example.com", Records: 5}, {Zone: "example.org", Records: 2}}, got.Zones)
+
+	// Without a zone cache the list is empty rather than null
+	s = newTestServer(t, Options{})
+	rec := get(t, s.Handler(), PathZones, "", nil)
+	assert.JSONEq(t, `{"zones":[]}`, rec.Body.String())
+}
+
+func TestHandler_Upstreams(t *testing.T) {
+	until := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	s := newTestServer(t, Options{
+		Upstreams: []UpstreamHealth{
+			fakeUpstream{{Server: "192.0.2.1:53", Healthy: true, Queries: 10, RTT: 20 * time.Millisecond}},
+			fakeUpstream{{Server: "192.0.2.2:53", Failures: 3, LastError: "timeout", SidelinedUntil: until}},
+		},
+		ForwardZones: map[string]UpstreamHealth{"corp.example": fakeUpstream{{Server: "10.0.0.53:53", Healthy: true}}},
+	})
+	var got struct {
+		Upstreams    []upstream.ServerHealth
+		ForwardZones map[string][]upstream.ServerHealth `json:"forward_zones"`
+	}
+	rec := get(t, s.Handler(), PathUpstreams, "", &got)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.Len(t, got.Upstreams, 2)
+	assert.Equal(t, "192.0.2.1:53", got.Upstreams[0].Server)
+	assert.True(t, got.Upstreams[0].Healthy)
+	assert.Equal(t, 20*time.Millisecond, got.Upstreams[0].RTT)
+	assert.Equal(t, "timeout", got.Upstreams[1].LastError)
+	assert.True(t, until.Equal(got.Upstreams[1].SidelinedUntil))
+	require.Len(t, got.ForwardZones["corp.example"], 1)
+	assert.Equal(t, "10.0.0.53:53", got.ForwardZones["corp.example"][0].Server)
+
+	s = newTestServer(t, Options{})
+	rec = get(t, s.Handler(), PathUpstreams, "", nil)
+	assert.JSONEq(t, `{"upstreams":[],"forward_zones":{}}`, rec.Body.String())
+}
@@ -0,0 +1,117 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// PathQueries searches the query history, newest first, when Options.History
+// is set. The query parameters filter the results:
+//
+//   - since, until: RFC 3339 times bounding the query time; since is
+//     inclusive and until exclusive
+//   - client: the client IP address
+//   - name: names containing it, case-insensitively
+//   - rcode: a response code name such as NXDOMAIN
+//   - blocked: true or false
+//   - limit: the most records to return; the history caps it
+const PathQueries = "/api/v1/queries"
+
+// Query is one answered query, as listed by PathQueries. Duration is in
+// seconds.
+type Query struct {
+	Time     time.Time `json:"time"`
+	Client   string    `json:"client,omitempty"`
+	Name     string    `json:"name"`
+	Type     string    `json:"type"`
+	RCode    string    `json:"rcode"`
+	Answers  []string  `json:"answers,omitempty"`
+	Source   string    `json:"source"`
+	Upstream string    `json:"upstream,omitempty"`
+	Duration float64   `json:"duration"`
+}
+
+// routeQueries registers the query history endpoint on mux.
+func (s *Server) routeQueries(mux *http.ServeMux) {
+	mux.Handle("GET "+PathQueries, s.authorize(http.HandlerFunc(s.handleQueries)))
+}
+
+func (s *Server) handleQueries(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseQueryFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	queries := []Query{}
+	for _, rec := range s.history.Search(filter) {
+		queries = append(queries, toQuery(rec))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"queries": queries})
+}
+
+// parseQueryFilter reads a query history filter from the parameters of a
+// PathQueries request.
+func parseQueryFilter(params url.Values) (resolver.QueryFilter, error) {
+	filter := resolver.QueryFilter{
+		Client: params.Get("client"),
+		Domain: params.Get("name"),
+	}
+	for _, bound := range []struct {
+		param string
+		dst   *time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		v := params.Get(bound.param)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s %q: want an RFC 3339 time", bound.param, v)
+		}
+		*bound.dst = t
+	}
+	if v := params.Get("rcode"); v != "" {
+		rcode := domain.ParseRCode(strings.ToUpper(v))
+		if rcode.String() != strings.ToUpper(v) {
+			return filter, fmt.Errorf("invalid rcode %q: want a response code name such as NXDOMAIN", v)
+		}
+		filter.RCode = &rcode
+	}
+	if v := params.Get("blocked"); v != "" {
+		blocked, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, fmt.Errorf("invalid blocked %q: want true or false", v)
+		}
+		filter.Blocked = &blocked
+	}
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return filter, fmt.Errorf("invalid limit %q: want a positive number", v)
+		}
+		filter.Limit = limit
+	}
+	return filter, nil
+}
+
+// toQuery converts a query history record for a response.
+func toQuery(r resolver.QueryRecord) Query {
+	return Query{
+		Time:     r.Time,
+		Client:   r.Client,
+		Name:     r.Name,
+		Type:     r.Type.String(),
+		RCode:    r.RCode.String(),
+		Answers:  r.Answers,
+		Source:   string(r.Source),
+		Upstream: r.Upstream,
+		Duration: r.Duration.Seconds(),
+	}
+}
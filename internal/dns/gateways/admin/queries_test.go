@@ -0,0 +1,132 @@
+package admin
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/repos/queryhistory"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// historyStart is the time of the first query in newTestHistory.
+var historyStart = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestHistory returns a query history store holding four queries from two
+// clients, one of them blocked, ten minutes apart.
+func newTestHistory(t *testing.T) *queryhistory.Store {
+	t.Helper()
+	store, err := queryhistory.New(queryhistory.Options{
+		Dir:   t.TempDir(),
+		Clock: &clock.MockClock{CurrentTime: historyStart.Add(time.Hour)},
+	})
+	require.NoError(t, err)
+	entry := func(minutes int, client, name string, rcode domain.RCode, source resolver.AnswerSource) resolver.QueryLogEntry {
+		return resolver.QueryLogEntry{
+			Time:     historyStart.Add(time.Duration(minutes) * time.Minute),
+			Client:   &net.UDPAddr{IP: net.ParseIP(client), Port: 40000},
+			Question: domain.Question{Name: name, Type: domain.RRTypeA, Class: domain.RRClassIN},
+			RCode:    rcode,
+			Source:   source,
+			Upstream: "192.0.2.53:53",
+			Duration: 20 * time.Millisecond,
+		}
+	}
+	store.Record(entry(0, "192.0.2.1", "tv.example.com.", domain.NOERROR, resolver.SourceUpstream))
+	store.Record(entry(10, "192.0.2.2", "ads.tracker.net.", domain.NXDOMAIN, resolver.SourceBlocked))
+	store.Record(entry(20, "192.0.2.1", "nope.example.com.", domain.NXDOMAIN, resolver.SourceUpstream))
+	store.Record(entry(30, "192.0.2.2", "video.example.com.", domain.NOERROR, resolver.SourceCache))
+	// Close stores everything recorded so far; Search keeps working
+	require.NoError(t, store.Close())
+	return store
+}
+
+func TestHandler_Queries_NotServedWithoutHistory(t *testing.T) {
+	s := newTestServer(t, Options{})
+	rec := get(t, s.Handler(), PathQueries, "", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandler_Queries_Authorization(t *testing.T) {
+	s := newTestServer(t, Options{Token: "s3cret", History: newTestHistory(t)})
+	rec := get(t, s.Handler(), PathQueries, "", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = get(t, s.Handler(), PathQueries, "s3cret", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestHandler_Queries(t *testing.T) {
+	s := newTestServer(t, Options{History: newTestHistory(t)})
+	at := func(minutes int) string {
+		return historyStart.Add(time.Duration(minutes) * time.Minute).Format(time.RFC3339)
+	}
+
+	tests := []struct {
+		name   string
+		params url.Values
+		want   []string
+	}{
+		{name: "everything, newest first", want: []string{"video.example.com.", "nope.example.com.", "ads.tracker.net.", "tv.example.com."}},
+		{name: "time range", params: url.Values{"since": {at(10)}, "until": {at(30)}}, want: []string{"nope.example.com.", "ads.tracker.net."}},
+		{name: "client", params: url.Values{"client": {"192.0.2.1"}}, want: []string{"nope.example.com.", "tv.example.com."}},
+		{name: "name", params: url.Values{"name": {"EXAMPLE.com"}}, want: []string{"video.example.com.", "nope.example.com.", "tv.example.com."}},
+		{name: "rcode", params: url.Values{"rcode": {"nxdomain"}}, want: []string{"nope.example.com.", "ads.tracker.net."}},
+		{name: "blocked", params: url.Values{"blocked": {"true"}}, want: []string{"ads.tracker.net."}},
+		{name: "not blocked", params: url.Values{"blocked": {"false"}, "rcode": {"NXDOMAIN"}}, want: []string{"nope.example.com."}},
+		{name: "limit", params: url.Values{"limit": {"1"}}, want: []string{"video.example.com."}},
+		{name: "nothing matches", params: url.Values{"client": {"198.51.100.7"}}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got struct{ Queries []Query }
+			rec := get(t, s.Handler(), PathQueries+"?"+tt.params.Encode(), "", &got)
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+			names := []string{}
+			for _, q := range got.Queries {
+				names = append(names, q.Name)
+			}
+			assert.Equal(t, tt.want, names)
+		})
+	}
+
+	// Every field of a record is served
+	var got struct{ Queries []Query }
+	get(t, s.Handler(), PathQueries+"?blocked=true", "", &got)
+	require.Len(t, got.Queries, 1)
+	assert.Equal(t, Query{
+		Time:     historyStart.Add(10 * time.Minute),
+		Client:   "192.0.2.2",
+		Name:     "ads.tracker.net.",
+		Type:     "A",
+		RCode:    "NXDOMAIN",
+		Source:   "blocked",
+		Upstream: "192.0.2.53:53",
+		Duration: 0.02,
+	}, got.Queries[0])
+}
+
+func TestHandler_Queries_InvalidFilter(t *testing.T) {
+	s := newTestServer(t, Options{History: newTestHistory(t)})
+	for _, query := range []string{
+		"since=yesterday",
+		"until=2025-06-01",
+		"rcode=NOPE",
+		"blocked=maybe",
+		"limit=0",
+		"limit=ten",
+	} {
+		t.Run(query, func(t *testing.T) {
+			var body errorBody
+			rec := get(t, s.Handler(), PathQueries+"?"+query, "", &body)
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, body.Error, "invalid")
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// Zone record endpoints, served when Options.ZoneEditor is set. {zone} is a
+// zone root and {id} a record ID, as listed by PathZoneRecords.
+const (
+	// PathZoneRecords lists the records of a zone (GET) and adds one (POST).
+	PathZoneRecords = "/api/v1/zones/{zone}/records"
+	// PathZoneRecord replaces (PUT) or removes (DELETE) one record of a zone.
+	// Both require an If-Match header.
+	PathZoneRecord = PathZoneRecords + "/{id}"
+)
+
+// maxRecordBody bounds the size of a record in a request body.
+const maxRecordBody = 64 << 10
+
+// Record is one record of a zone as served and accepted by the record
+// endpoints. Requests leave ID empty; Name may be "@", relative to the zone
+// root, or absolute.
+type Record struct {
+	ID    string `json:"id,omitempty"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// ZoneRecords is the body of a GET of PathZoneRecords.
+type ZoneRecords struct {
+	Zone    string   `json:"zone"`
+	Version string   `json:"version"`
+	Records []Record `json:"records"`
+}
+
+// routeRecords registers the record endpoints on mux.
+func (s *Server) routeRecords(mux *http.ServeMux) {
+	mux.Handle("GET "+PathZoneRecords, s.authorize(http.HandlerFunc(s.handleListRecords)))
+	mux.Handle("POST "+PathZoneRecords, s.authorize(http.HandlerFunc(s.handleCreateRecord)))
+	mux.Handle("PUT "+PathZoneRecord, s.authorize(http.HandlerFunc(s.handleUpdateRecord)))
+	mux.Handle("DELETE "+PathZoneRecord, s.authorize(http.HandlerFunc(s.handleDeleteRecord)))
+}
+
+func (s *Server) handleListRecords(w http.ResponseWriter, r *http.Request) {
+	zone := r.PathValue("zone")
+	records, version, err := s.editor.Records(zone)
+	if err != nil {
+		s.writeEditError(w, err)
+		return
+	}
+	body := ZoneRecords{Zone: zone, Version: version, Records: []Record{}}
+	for _, rec := range records {
+		body.Records = append(body.Records, toRecord(rec))
+	}
+	setETag(w, version)
+	writeJSON(w, http.StatusOK, body)
+}
+
+func (s *Server) handleCreateRecord(w http.ResponseWriter, r *http.Request) {
+	record, ok := readRecord(w, r)
+	if !ok {
+		return
+	}
+	zone := r.PathValue("zone")
+	created, version, err := s.editor.CreateRecord(zone, ifMatch(r), record)
+	if err != nil {
+		s.writeEditError(w, err)
+		return
+	}
+	setETag(w, version)
+	w.Header().Set("Location", PathZones+"/"+url.PathEscape(zone)+"/records/"+created.ID)
+	writeJSON(w, http.StatusCreated, toRecord(created))
+}
+
+func (s *Server) handleUpdateRecord(w http.ResponseWriter, r *http.Request) {
+	base, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	record, ok := readRecord(w, r)
+	if !ok {
+		return
+	}
+	updated, version, err := s.editor.UpdateRecord(r.PathValue("zone"), base, r.PathValue("id"), record)
+	if err != nil {
+		s.writeEditError(w, err)
+		return
+	}
+	setETag(w, version)
+	writeJSON(w, http.StatusOK, toRecord(updated))
+}
+
+func (s *Server) handleDeleteRecord(w http.ResponseWriter, r *http.Request) {
+	base, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+	version, err := s.editor.DeleteRecord(r.PathValue("zone"), base, r.PathValue("id"))
+	if err != nil {
+		s.writeEditError(w, err)
+		return
+	}
+	setETag(w, version)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// toRecord converts a zone record for a response.
+func toRecord(r resolver.ZoneRecord) Record {
+	return Record{ID: r.ID, Name: r.Name, Type: r.Type.String(), Value: r.Value}
+}
+
+// readRecord decodes the record in a request body, answering 400 when it is
+// malformed.
+func readRecord(w http.ResponseWriter, r *http.Request) (resolver.ZoneRecord, bool) {
+	var body Record
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRecordBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid record: "+err.Error())
+		return resolver.ZoneRecord{}, false
+	}
+	return resolver.ZoneRecord{
+		Name:  body.Name,
+		Type:  domain.RRTypeFromString(strings.ToUpper(strings.TrimSpace(body.Type))),
+		Value: body.Value,
+	}, true
+}
+
+// ifMatch returns the zone version a request is based on, from its If-Match
+// header. A missing header or "*" skips the version check.
+func ifMatch(r *http.Request) string {
+	tag := strings.TrimSpace(r.Header.Get("If-Match"))
+	if tag == "*" {
+		return ""
+	}
+	return strings.Trim(strings.TrimPrefix(tag, "W/"), `"`)
+}
+
+// requireIfMatch returns the zone version a change to an existing record is
+// based on, answering 428 (RFC 6585) when the request has no If-Match header,
+// so a client cannot replace or remove a record without having seen the zone.
+// "*" still applies the change regardless of the version.
+func requireIfMatch(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if strings.TrimSpace(r.Header.Get("If-Match")) == "" {
+		writeError(w, http.StatusPreconditionRequired, `If-Match required: send the zone's ETag, or "*" to change the record regardless`)
+		return "", false
+	}
+	return ifMatch(r), true
+}
+
+// setETag sets a response's ETag to a zone version.
+func setETag(w http.ResponseWriter, version string) {
+	w.Header().Set("ETag", `"`+version+`"`)
+}
+
+// writeEditError answers a failed zone change with the status matching its
+// cause, logging unexpected failures.
+func (s *Server) writeEditError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, resolver.ErrZoneNotFound), errors.Is(err, resolver.ErrRecordNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, resolver.ErrZoneVersion):
+		writeError(w, http.StatusPreconditionFailed, err.Error())
+	case errors.Is(err, resolver.ErrRecordExists), errors.Is(err, resolver.ErrZoneNotEditable):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, resolver.ErrInvalidRecord):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		s.logger.Error(map[string]any{"error": err}, "Zone change failed")
+		writeError(w, http.StatusInternalServerError, "zone change failed")
+	}
+}
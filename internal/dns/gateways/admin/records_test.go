@@ -0,0 +1,213 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// fakeEditor serves one zone with a fixed version, recording the changes it is asked for.
+type fakeEditor struct {
+	records []resolver.ZoneRecord
+	version string
+	err     error
+
+	gotZone    string
+	gotVersion string
+	gotID      string
+	gotRecord  resolver.ZoneRecord
+}
+
+var _ resolver.ZoneEditor = (*fakeEditor)(nil)
+
+func (f *fakeEditor) Records(zone string) ([]resolver.ZoneRecord, string, error) {
+	f.gotZone = zone
+	return f.records, f.version, f.err
+}
+
+func (f *fakeEditor) CreateRecord(zone, version string, record resolver.ZoneRecord) (resolver.ZoneRecord, string, error) {
+	f.gotZone, f.gotVersion, f.gotRecord = zone, version, record
+	if f.err != nil {
+		return resolver.ZoneRecord{}, "", f.err
+	}
+	return resolver.NewZoneRecord(record.Name+"."+zone, record.Type, record.Value), "v2", nil
+}
+
+func (f *fakeEditor) UpdateRecord(zone, version, id string, record resolver.ZoneRecord) (resolver.ZoneRecord, string, error) {
+	f.gotZone, f.gotVersion, f.gotID, f.gotRecord = zone, version, id, record
+	if f.err != nil {
+		return resolver.ZoneRecord{}, "", f.err
+	}
+	return resolver.NewZoneRecord(record.Name+"."+zone, record.Type, record.Value), "v2", nil
+}
+
+func (f *fakeEditor) DeleteRecord(zone, version, id string) (string, error) {
+	f.gotZone, f.gotVersion, f.gotID = zone, version, id
+	return "v2", f.err
+}
+
+// send makes a request with a JSON body and the given If-Match header.
+func send(t *testing.T, handler http.Handler, method, path, ifMatch, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler_Records_NotServedWithoutEditor(t *testing.T) {
+	s := newTestServer(t, Options{})
+	rec := get(t, s.Handler(), "/api/v1/zones/example.com/records", "", nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestHandler_ListRecords(t *testing.T) {
+	www := resolver.NewZoneRecord("www.example.com", domain.RRTypeA, "192.0.2.1")
+	editor := &fakeEditor{records: []resolver.ZoneRecord{www}, version: "v1"}
+	s := newTestServer(t, Options{Token: "s3cret", ZoneEditor: editor})
+
+	rec := get(t, s.Handler(), "/api/v1/zones/example.com/records", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	var got ZoneRecords
+	rec = get(t, s.Handler(), "/api/v1/zones/example.com/records", "s3cret", &got)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"v1"`, rec.Header().Get("ETag"))
+	assert.Equal(t, "example.com", editor.gotZone)
+	assert.Equal(t, ZoneRecords{
+		Zone:    "example.com",
+		Version: "v1",
+		Records: []Record{{ID: www.ID, Name: "www.example.com", Type: "A", Value: "192.0.2.1"}},
+	}, got)
+
+	// An empty zone lists no records rather than null
+	editor.records = nil
+	rec = get(t, s.Handler(), "/api/v1/zones/example.com/records", "s3cret", nil)
+	assert.JSONEq(t, `{"zone":"example.com","version":"v1","records":[]}`, rec.Body.String())
+}
+
+func TestHandler_CreateRecord(t *testing.T) {
+	editor := &fakeEditor{}
+	s := newTestServer(t, Options{ZoneEditor: editor})
+
+	rec := send(t, s.Handler(), http.MethodPost, "/api/v1/zones/example.com/records", `"v1"`,
+		`{"name":"mail","type":"mx","value":"10 mail.example.com."}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	want := resolver.NewZoneRecord("mail.example.com", domain.RRTypeMX, "10 mail.example.com.")
+	assert.Equal(t, "v1", editor.gotVersion)
+	assert.Equal(t, resolver.ZoneRecord{Name: "mail", Type: domain.RRTypeMX, Value: "10 mail.example.com."}, editor.gotRecord)
+	assert.Equal(t, `"v2"`, rec.Header().Get("ETag"))
+	assert.Equal(t, "/api/v1/zones/example.com/records/"+want.ID, rec.Header().Get("Location"))
+
+	var got Record
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Equal(t, Record{ID: want.ID, Name: want.Name, Type: "MX", Value: want.Value}, got)
+}
+
+func TestHandler_CreateRecord_BadBody(t *testing.T) {
+	s := newTestServer(t, Options{ZoneEditor: &fakeEditor{}})
+	for name, body := range map[string]string{
+		"malformed":     `{"name":`,
+		"unknown field": `{"name":"www","type":"A","value":"192.0.2.1","ttl":60}`,
+		"too large":     `{"name":"` + strings.Repeat("a", maxRecordBody) + `"}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			rec := send(t, s.Handler(), http.MethodPost, "/api/v1/zones/example.com/records", "", body)
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), "invalid record")
+		})
+	}
+}
+
+func TestHandler_UpdateRecord(t *testing.T) {
+	editor := &fakeEditor{}
+	s := newTestServer(t, Options{ZoneEditor: editor})
+
+	rec := send(t, s.Handler(), http.MethodPut, "/api/v1/zones/example.com/records/abc123", `W/"v1"`,
+		`{"name":"www","type":"AAAA","value":"2001:db8::1"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, "abc123", editor.gotID)
+	assert.Equal(t, "v1", editor.gotVersion)
+	assert.Equal(t, domain.RRTypeAAAA, editor.gotRecord.Type)
+	assert.Equal(t, `"v2"`, rec.Header().Get("ETag"))
+
+	rec = send(t, s.Handler(), http.MethodPut, "/api/v1/zones/example.com/records/abc123", `"v2"`, `[]`)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestHandler_Records_IfMatchRequired(t *testing.T) {
+	body := `{"name":"www","type":"A","value":"192.0.2.1"}`
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		t.Run(method, func(t *testing.T) {
+			editor := &fakeEditor{}
+			s := newTestServer(t, Options{ZoneEditor: editor})
+			rec := send(t, s.Handler(), method, "/api/v1/zones/example.com/records/abc123", "", body)
+			assert.Equal(t, http.StatusPreconditionRequired, rec.Code)
+			assert.Contains(t, rec.Body.String(), "If-Match")
+			assert.Empty(t, editor.gotID, "the change must not reach the editor")
+		})
+	}
+}
+
+func TestHandler_DeleteRecord(t *testing.T) {
+	editor := &fakeEditor{}
+	s := newTestServer(t, Options{ZoneEditor: editor})
+
+	rec := send(t, s.Handler(), http.MethodDelete, "/api/v1/zones/example.com/records/abc123", "*", "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Empty(t, rec.Body.String())
+	assert.Equal(t, "abc123", editor.gotID)
+	assert.Equal(t, "", editor.gotVersion)
+	assert.Equal(t, `"v2"`, rec.Header().Get("ETag"))
+}
+
+func TestHandler_Records_Errors(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{fmt.Errorf("%w: example.net", resolver.ErrZoneNotFound), http.StatusNotFound},
+		{resolver.ErrRecordNotFound, http.StatusNotFound},
+		{resolver.ErrZoneVersion, http.StatusPreconditionFailed},
+		{resolver.ErrRecordExists, http.StatusConflict},
+		{resolver.ErrZoneNotEditable, http.StatusConflict},
+		{fmt.Errorf("%w: bad address", resolver.ErrInvalidRecord), http.StatusBadRequest},
+		{errors.New("disk full"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			s := newTestServer(t, Options{ZoneEditor: &fakeEditor{err: tt.err}})
+			body := `{"name":"www","type":"A","value":"192.0.2.1"}`
+			for _, rec := range []*httptest.ResponseRecorder{
+				send(t, s.Handler(), http.MethodGet, "/api/v1/zones/example.com/records", "", ""),
+				send(t, s.Handler(), http.MethodPost, "/api/v1/zones/example.com/records", "", body),
+				send(t, s.Handler(), http.MethodPut, "/api/v1/zones/example.com/records/abc", `"v1"`, body),
+				send(t, s.Handler(), http.MethodDelete, "/api/v1/zones/example.com/records/abc", `"v1"`, ""),
+			} {
+				assert.Equal(t, tt.status, rec.Code)
+				assert.Empty(t, rec.Header().Get("ETag"))
+				var got errorBody
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+				assert.NotEmpty(t, got.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package dnssec
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/haukened/rr-dns/internal/dns/common/rrdata"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// rootAnchors are the DS records of the IANA root zone key-signing keys,
+// KSK-2017 and KSK-2024, as published at https://data.iana.org/root-anchors/.
+var rootAnchors = []string{
+	". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	". IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+// RootAnchors returns the built-in trust anchors for the DNS root.
+func RootAnchors() []domain.ResourceRecord {
+	anchors, err := ParseTrustAnchors(strings.NewReader(strings.Join(rootAnchors, "\n")))
+	if err != nil {
+		panic(err) // the built-in anchors are constants
+	}
+	return anchors
+}
+
+// LoadTrustAnchors reads trust anchors from a file; see ParseTrustAnchors for the format.
+func LoadTrustAnchors(path string) ([]domain.ResourceRecord, error) {
+	//gosec:disable G304 -- the path comes from operator configuration
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf(errAnchorFile, err)
+	}
+	defer func() { _ = f.Close() }()
+	return ParseTrustAnchors(f)
+}
+
+// ParseTrustAnchors reads DS and DNSKEY records in zone file presentation
+// format, one per line, such as
+//
+//	example.test. 3600 IN DS 12345 13 2 0B8F...
+//	example.test. IN DNSKEY 257 3 15 l02Woi0iS8Aa25FQkUd9RMzZHJpBoRQwAQEX1SxZJA4=
+//
+// The TTL and class are optional. Blank lines and ';' comments are ignored.
+// Anchors need not be at the root: a locally signed zone can be anchored directly.
+func ParseTrustAnchors(r io.Reader) ([]domain.ResourceRecord, error) {
+	var anchors []domain.ResourceRecord
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line, _, _ := strings.Cut(scanner.Text(), ";")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		anchor, err := parseAnchor(fields)
+		if err != nil {
+			return nil, fmt.Errorf(errAnchorLine, lineNo, err)
+		}
+		anchors = append(anchors, anchor)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf(errAnchorFile, err)
+	}
+	return anchors, nil
+}
+
+// parseAnchor builds a DS or DNSKEY record from the fields of one line.
+func parseAnchor(fields []string) (domain.ResourceRecord, error) {
+	owner := fields[0]
+	var ttl uint32
+	i := 1
+	for ; i < len(fields); i++ {
+		if v, err := strconv.ParseUint(fields[i], 10, 32); err == nil {
+			ttl = uint32(v)
+			continue
+		}
+		if strings.EqualFold(fields[i], "IN") {
+			continue
+		}
+		break
+	}
+	if i+1 >= len(fields) {
+		return domain.ResourceRecord{}, fmt.Errorf("missing record type or data")
+	}
+	rrtype := domain.RRTypeFromString(strings.ToUpper(fields[i]))
+	if rrtype != domain.RRTypeDS && rrtype != domain.RRTypeDNSKEY {
+		return domain.ResourceRecord{}, fmt.Errorf("trust anchors must be DS or DNSKEY records, got %q", fields[i])
+	}
+	text := strings.Join(fields[i+1:], " ")
+	data, err := rrdata.Encode(rrtype, text)
+	if err != nil {
+		return domain.ResourceRecord{}, err
+	}
+	if rrtype == domain.RRTypeDS {
+		ds, _ := parseDS(data)
+		if !supportedAlgorithm(ds.algorithm) || !supportedDigest(ds.digestType) {
+			return domain.ResourceRecord{}, fmt.Errorf("unsupported DS algorithm %d or digest type %d", ds.algorithm, ds.digestType)
+		}
+	} else if key, _ := parseDNSKEY(data); !supportedAlgorithm(key.algorithm) {
+		return domain.ResourceRecord{}, fmt.Errorf("unsupported DNSKEY algorithm %d", key.algorithm)
+	}
+	return domain.NewAuthoritativeResourceRecord(owner, rrtype, domain.RRClassIN, ttl, data, text)
+}
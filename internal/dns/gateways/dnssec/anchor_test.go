@@ -0,0 +1,82 @@
+package dnssec
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+func TestRootAnchors(t *testing.T) {
+	anchors := RootAnchors()
+	require.Len(t, anchors, 2)
+	for _, rr := range anchors {
+		assert.Equal(t, domain.RootName, rr.Name)
+		assert.Equal(t, domain.RRTypeDS, rr.Type)
+		ds, err := parseDS(rr.Data)
+		require.NoError(t, err)
+		assert.Equal(t, uint8(algRSASHA256), ds.algorithm)
+	}
+}
+
+func TestParseTrustAnchors(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantTypes []domain.RRType
+		wantErr   string
+	}{
+		{
+			name: "ds and dnskey with comments",
+			input: `; local anchors
+example.test. 3600 IN DS 12345 13 2 0B8F7D5A9DB7E25A9C7F9A4A1D4C4B5E6F708192A3B4C5D6E7F8091A2B3C4D5E
+
+example.test. IN DNSKEY 257 3 15 l02Woi0iS8Aa25FQkUd9RMzZHJpBoRQwAQEX1SxZJA4= ; KSK
+`,
+			wantTypes: []domain.RRType{domain.RRTypeDS, domain.RRTypeDNSKEY},
+		},
+		{name: "ttl and class optional", input: "example.test. ds 12345 13 2 0B8F", wantTypes: []domain.RRType{domain.RRTypeDS}},
+		{name: "empty", input: "; nothing\n"},
+		{name: "wrong type", input: "example.test. IN A 192.0.2.1", wantErr: "line 1"},
+		{name: "missing data", input: "example.test. IN DS", wantErr: "missing record type or data"},
+		{name: "malformed data", input: "\nexample.test. IN DS 12345 13 2 not-hex", wantErr: "line 2"},
+		{name: "unsupported digest", input: "example.test. IN DS 12345 13 3 0B8F", wantErr: "unsupported DS"},
+		{name: "unsupported algorithm", input: "example.test. IN DNSKEY 257 3 16 AAAA", wantErr: "unsupported DNSKEY"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			anchors, err := ParseTrustAnchors(strings.NewReader(tt.input))
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			var types []domain.RRType
+			for _, rr := range anchors {
+				types = append(types, rr.Type)
+				assert.Equal(t, "example.test", rr.Name)
+			}
+			assert.Equal(t, tt.wantTypes, types)
+		})
+	}
+}
+
+func TestLoadTrustAnchors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "anchors.conf")
+	require.NoError(t, os.WriteFile(path, []byte("example.test. IN DS 12345 13 2 0B8F\n"), 0o600))
+
+	anchors, err := LoadTrustAnchors(path)
+	require.NoError(t, err)
+	require.Len(t, anchors, 1)
+	assert.Equal(t, uint32(0), anchors[0].OriginalTTL())
+
+	_, err = LoadTrustAnchors(filepath.Join(t.TempDir(), "missing.conf"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read trust anchors")
+}
@@ -0,0 +1,79 @@
+package dnssec
+
+import (
+	"sync"
+	"time"
+)
+
+// zoneState is what the chain of trust says about a name one label below a
+// known zone: whether it is a signed zone, an unsigned one, or no zone at all.
+type zoneState int
+
+const (
+	// zoneSecure is a zone whose DNSKEY RRset was validated from its parent's DS records.
+	zoneSecure zoneState = iota
+	// zoneInsecure is a zone the parent proves has no DS records, or any zone below it.
+	zoneInsecure
+	// zoneNoCut is a name the parent proves is not a delegation point.
+	zoneNoCut
+)
+
+// zoneEntry is the cached outcome of following the chain of trust to one name.
+type zoneEntry struct {
+	state   zoneState
+	keys    []dnskeyRecord // trusted zone keys when state is zoneSecure
+	expires time.Time
+}
+
+// zoneCache remembers validated keys and proven insecure delegations, so each
+// query does not have to walk the chain of trust from the anchor again. It is
+// bounded; expired entries are dropped first when room is needed.
+type zoneCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]zoneEntry
+}
+
+// newZoneCache creates a cache holding up to size names.
+func newZoneCache(size int) *zoneCache {
+	return &zoneCache{size: size, entries: make(map[string]zoneEntry)}
+}
+
+// put stores the entry for name for ttl, making room if the cache is full.
+func (c *zoneCache) put(name string, entry zoneEntry, ttl time.Duration, now time.Time) {
+	if ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[name]; !ok && len(c.entries) >= c.size {
+		for k, e := range c.entries {
+			if !now.Before(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		for k := range c.entries {
+			if len(c.entries) < c.size {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+	entry.expires = now.Add(ttl)
+	c.entries[name] = entry
+}
+
+// get returns the unexpired entry for name.
+func (c *zoneCache) get(name string, now time.Time) (zoneEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[name]
+	if !ok {
+		return zoneEntry{}, false
+	}
+	if !now.Before(e.expires) {
+		delete(c.entries, name)
+		return zoneEntry{}, false
+	}
+	return e, true
+}
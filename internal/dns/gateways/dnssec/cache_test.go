@@ -0,0 +1,42 @@
+package dnssec
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZoneCache(t *testing.T) {
+	now := time.Now()
+	c := newZoneCache(2)
+
+	c.put("a.test", zoneEntry{state: zoneSecure}, time.Minute, now)
+	c.put("b.test", zoneEntry{state: zoneInsecure}, time.Second, now)
+	c.put("ignored.test", zoneEntry{state: zoneNoCut}, 0, now)
+
+	e, ok := c.get("a.test", now)
+	assert.True(t, ok)
+	assert.Equal(t, zoneSecure, e.state)
+	_, ok = c.get("ignored.test", now)
+	assert.False(t, ok, "zero TTL is not cached")
+
+	_, ok = c.get("b.test", now.Add(2*time.Second))
+	assert.False(t, ok, "expired")
+	assert.Len(t, c.entries, 1, "expired entries are dropped on read")
+
+	// Filling the cache evicts expired entries before live ones.
+	c.put("b.test", zoneEntry{state: zoneInsecure}, time.Second, now)
+	c.put("c.test", zoneEntry{state: zoneNoCut}, time.Minute, now.Add(2*time.Second))
+	assert.Len(t, c.entries, 2)
+	_, ok = c.get("a.test", now.Add(2*time.Second))
+	assert.True(t, ok)
+	_, ok = c.get("c.test", now.Add(2*time.Second))
+	assert.True(t, ok)
+
+	// With no expired entries, some entry makes room and the size stays bounded.
+	c.put("d.test", zoneEntry{state: zoneSecure}, time.Minute, now.Add(2*time.Second))
+	assert.Len(t, c.entries, 2)
+	_, ok = c.get("d.test", now.Add(2*time.Second))
+	assert.True(t, ok)
+}
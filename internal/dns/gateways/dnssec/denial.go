@@ -0,0 +1,267 @@
+package dnssec
+
+import (
+	"bytes"
+	//gosec:disable G505 -- NSEC3 hash algorithm 1 is SHA-1 (RFC 5155 §11)
+	"crypto/sha1"
+	"encoding/base32"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// base32Hex is the unpadded "Base 32 Encoding with Extended Hex Alphabet"
+// used for NSEC3 hashed owner names (RFC 5155 §3.3).
+var base32Hex = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+const (
+	// nsec3HashSHA1 is the only NSEC3 hash algorithm defined (RFC 5155 §11).
+	nsec3HashSHA1 = 1
+	// maxNSEC3Iterations is the iteration count above which NSEC3 proofs are
+	// treated as insecure rather than computed (RFC 9276 §3.2).
+	maxNSEC3Iterations = 150
+)
+
+// proof is the outcome of checking a denial of existence.
+type proof int
+
+const (
+	// proofBogus means the records do not prove the denial.
+	proofBogus proof = iota
+	// proofSecure means the denial is proven.
+	proofSecure
+	// proofInsecure means the denial is consistent but cannot be proven, such as
+	// an opt-out span that may hide an unsigned delegation.
+	proofInsecure
+)
+
+// denial holds the validated NSEC and NSEC3 records of one response, from which
+// the non-existence of names and types is proven (RFC 4035 §5.4, RFC 5155 §8).
+type denial struct {
+	nsec  []nsecRecord
+	nsec3 []nsec3Record
+	zone  string // zone the NSEC3 owners belong to
+	// unusable is set when NSEC3 parameters are unsupported or too expensive;
+	// proofs from such a chain are insecure rather than bogus.
+	unusable bool
+	hashes   map[string][]byte
+}
+
+// nameExists reports the types at name when the records show that it exists:
+// an NSEC or NSEC3 owned by name, or an NSEC that proves it an empty non-terminal.
+func (d *denial) nameExists(name string) (typeSet, bool) {
+	for _, n := range d.nsec {
+		if !inZone(name, n.zone) {
+			continue
+		}
+		if n.owner == name {
+			return n.types, true
+		}
+		// An NSEC spanning name whose next name is below it marks an empty non-terminal.
+		if nsecCovers(n, name) && inZone(n.next, name) && n.next != name {
+			return typeSet{}, true
+		}
+	}
+	if n, ok := d.nsec3Match(name); ok && inZone(name, d.zone) {
+		return n.types, true
+	}
+	return nil, false
+}
+
+// nameError checks that name does not exist, returning its closest encloser:
+// the deepest existing ancestor, below which a wildcard could have matched.
+func (d *denial) nameError(name string) (string, proof) {
+	for _, n := range d.nsec {
+		if !inZone(name, n.zone) || !nsecCovers(n, name) || inZone(n.next, name) {
+			continue
+		}
+		// An NSEC at a zone cut only speaks for the parent side, not the names below it.
+		if n.types[domain.RRTypeNS] && !n.types[domain.RRTypeSOA] && inZone(name, n.owner) {
+			continue
+		}
+		encloser := commonAncestor(name, n.owner)
+		if other := commonAncestor(name, n.next); len(other) > len(encloser) {
+			encloser = other
+		}
+		return encloser, proofSecure
+	}
+	if len(d.nsec3) == 0 {
+		return "", proofBogus
+	}
+	if d.unusable {
+		return "", proofInsecure
+	}
+	return d.closestEncloser(name)
+}
+
+// closestEncloser runs the NSEC3 closest encloser proof for name (RFC 5155 §8.3):
+// an NSEC3 matches some ancestor, and another covers the next closer name.
+func (d *denial) closestEncloser(name string) (string, proof) {
+	if !inZone(name, d.zone) || name == d.zone {
+		return "", proofBogus
+	}
+	for encloser := parentName(name); inZone(encloser, d.zone); encloser = parentName(encloser) {
+		match, ok := d.nsec3Match(encloser)
+		if !ok {
+			if encloser == "" {
+				break
+			}
+			continue
+		}
+		// A delegation point or DNAME cannot be the closest encloser of a proof from this zone.
+		if match.types[domain.RRTypeNS] && !match.types[domain.RRTypeSOA] && encloser != d.zone {
+			return "", proofBogus
+		}
+		cover, ok := d.nsec3Cover(childOf(encloser, name))
+		if !ok {
+			return "", proofBogus
+		}
+		if cover.optOut {
+			return encloser, proofInsecure
+		}
+		return encloser, proofSecure
+	}
+	return "", proofBogus
+}
+
+// provesNXDomain checks the proof that name does not exist and that no
+// wildcard could have answered for it (RFC 4035 §5.4, RFC 5155 §8.4).
+func (d *denial) provesNXDomain(name string) proof {
+	encloser, result := d.nameError(name)
+	if result != proofSecure {
+		return result
+	}
+	if _, exists := d.nameExists(wildcardOf(encloser)); exists {
+		return proofBogus
+	}
+	if _, wildcard := d.nameError(wildcardOf(encloser)); wildcard == proofBogus {
+		return proofBogus
+	}
+	return result
+}
+
+// provesNoData checks the proof that name exists but has no records of
+// rrtype, either directly or through a wildcard (RFC 4035 §5.4, RFC 5155 §8.5-8.7).
+func (d *denial) provesNoData(name string, rrtype domain.RRType) proof {
+	if types, ok := d.nameExists(name); ok {
+		if types[rrtype] || types[domain.RRTypeCNAME] {
+			return proofBogus
+		}
+		// The parent side of a delegation can only deny the DS type.
+		if rrtype != domain.RRTypeDS && types[domain.RRTypeNS] && !types[domain.RRTypeSOA] {
+			return proofBogus
+		}
+		return proofSecure
+	}
+	if d.unusable {
+		return proofInsecure
+	}
+	encloser, result := d.nameError(name)
+	if result == proofBogus {
+		return proofBogus
+	}
+	// An opt-out span may hide an unsigned delegation for name (RFC 5155 §8.6).
+	if result == proofInsecure {
+		if rrtype == domain.RRTypeDS {
+			return proofInsecure
+		}
+		return proofBogus
+	}
+	types, ok := d.nameExists(wildcardOf(encloser))
+	if !ok || types[rrtype] || types[domain.RRTypeCNAME] {
+		return proofBogus
+	}
+	return proofSecure
+}
+
+// provesWildcard checks that name does not exist, so an answer synthesized
+// from the wildcard below encloser was legitimate (RFC 4035 §5.3.4, RFC 5155 §8.8).
+func (d *denial) provesWildcard(name, encloser string) proof {
+	if len(d.nsec3) > 0 && len(d.nsec) == 0 {
+		if d.unusable {
+			return proofInsecure
+		}
+		cover, ok := d.nsec3Cover(childOf(encloser, name))
+		switch {
+		case !ok:
+			return proofBogus
+		case cover.optOut:
+			return proofInsecure
+		}
+		return proofSecure
+	}
+	_, result := d.nameError(name)
+	return result
+}
+
+// nsecCovers reports whether name falls strictly between the owner and next
+// name of an NSEC record. The last NSEC of a zone wraps around to the apex.
+func nsecCovers(n nsecRecord, name string) bool {
+	if canonicalCompare(n.owner, name) >= 0 {
+		return false
+	}
+	if canonicalCompare(n.owner, n.next) >= 0 {
+		return true
+	}
+	return canonicalCompare(name, n.next) < 0
+}
+
+// nsec3Match returns the NSEC3 record whose hashed owner is the hash of name.
+func (d *denial) nsec3Match(name string) (nsec3Record, bool) {
+	for _, n := range d.nsec3 {
+		if bytes.Equal(n.owner, d.hash(n.params, name)) {
+			return n, true
+		}
+	}
+	return nsec3Record{}, false
+}
+
+// nsec3Cover returns the NSEC3 record whose span covers the hash of name.
+func (d *denial) nsec3Cover(name string) (nsec3Record, bool) {
+	for _, n := range d.nsec3 {
+		h := d.hash(n.params, name)
+		after := bytes.Compare(n.owner, h) < 0
+		before := bytes.Compare(h, n.next) < 0
+		// The last NSEC3 of the chain wraps around to the first.
+		if bytes.Compare(n.owner, n.next) >= 0 {
+			if after || before {
+				return n, true
+			}
+			continue
+		}
+		if after && before {
+			return n, true
+		}
+	}
+	return nsec3Record{}, false
+}
+
+// hash returns the NSEC3 hash of name under params, memoised per response.
+func (d *denial) hash(params nsec3Params, name string) []byte {
+	key := string([]byte{params.algorithm, byte(params.iterations >> 8), byte(params.iterations)}) + params.salt + "|" + name
+	if h, ok := d.hashes[key]; ok {
+		return h
+	}
+	if d.hashes == nil {
+		d.hashes = make(map[string][]byte)
+	}
+	h := nsec3Hash(params, name)
+	d.hashes[key] = h
+	return h
+}
+
+// nsec3Hash computes the iterated, salted SHA-1 hash of a canonical name (RFC 5155 §5).
+func nsec3Hash(params nsec3Params, name string) []byte {
+	salt := []byte(params.salt)
+	//gosec:disable G401 -- NSEC3 hash algorithm 1 is SHA-1
+	h := sha1.Sum(append(nameWire(name), salt...))
+	for range params.iterations {
+		//gosec:disable G401 -- NSEC3 hash algorithm 1 is SHA-1
+		h = sha1.Sum(append(h[:], salt...))
+	}
+	return h[:]
+}
+
+// usableNSEC3 reports whether an NSEC3 chain with params can be evaluated.
+func usableNSEC3(params nsec3Params) bool {
+	return params.algorithm == nsec3HashSHA1 && params.iterations <= maxNSEC3Iterations
+}
@@ -0,0 +1,160 @@
+package dnssec
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+func TestNSEC3Hash(t *testing.T) {
+	// Test vectors from RFC 5155 Appendix A.
+	params := nsec3Params{algorithm: nsec3HashSHA1, iterations: 12, salt: "\xaa\xbb\xcc\xdd"}
+	tests := map[string]string{
+		"example":   "0p9mhaveqvm6t7vbl5lop2u3t2rp3tom",
+		"a.example": "35mthgpgcu1qg68fab165klnsnk3dpvl",
+	}
+	for name, want := range tests {
+		assert.Equal(t, want, strings.ToLower(base32Hex.EncodeToString(nsec3Hash(params, name))), name)
+	}
+}
+
+func TestUsableNSEC3(t *testing.T) {
+	assert.True(t, usableNSEC3(nsec3Params{algorithm: nsec3HashSHA1, iterations: maxNSEC3Iterations}))
+	assert.False(t, usableNSEC3(nsec3Params{algorithm: nsec3HashSHA1, iterations: maxNSEC3Iterations + 1}))
+	assert.False(t, usableNSEC3(nsec3Params{algorithm: 2}))
+}
+
+func TestNSECCovers(t *testing.T) {
+	n := nsecRecord{zone: "test", owner: "b.test", next: "d.test"}
+	assert.True(t, nsecCovers(n, "c.test"))
+	assert.True(t, nsecCovers(n, "x.b.test"))
+	assert.False(t, nsecCovers(n, "b.test"))
+	assert.False(t, nsecCovers(n, "d.test"))
+	assert.False(t, nsecCovers(n, "a.test"))
+
+	last := nsecRecord{zone: "test", owner: "x.test", next: "test"}
+	assert.True(t, nsecCovers(last, "z.test"))
+	assert.False(t, nsecCovers(last, "a.test"))
+}
+
+func TestDenial_NSEC(t *testing.T) {
+	d := &denial{nsec: []nsecRecord{
+		{zone: "test", owner: "test", next: "a.b.test", types: typeSet{domain.RRTypeSOA: true, domain.RRTypeNS: true}},
+		{zone: "test", owner: "a.b.test", next: "sub.test", types: typeSet{domain.RRTypeA: true}},
+		{zone: "test", owner: "sub.test", next: "test", types: typeSet{domain.RRTypeNS: true}},
+	}}
+
+	types, ok := d.nameExists("a.b.test")
+	assert.True(t, ok)
+	assert.True(t, types[domain.RRTypeA])
+	_, ok = d.nameExists("b.test")
+	assert.True(t, ok, "empty non-terminal")
+	_, ok = d.nameExists("c.test")
+	assert.False(t, ok)
+
+	assert.Equal(t, proofSecure, d.provesNXDomain("c.test"))
+	assert.Equal(t, proofBogus, d.provesNXDomain("b.test"), "empty non-terminals exist")
+	assert.Equal(t, proofBogus, d.provesNXDomain("x.sub.test"), "names below a delegation are not proven by the parent")
+	assert.Equal(t, proofBogus, d.provesNXDomain("other.example"), "outside the zone")
+
+	assert.Equal(t, proofSecure, d.provesNoData("a.b.test", domain.RRTypeAAAA))
+	assert.Equal(t, proofBogus, d.provesNoData("a.b.test", domain.RRTypeA))
+	assert.Equal(t, proofSecure, d.provesNoData("sub.test", domain.RRTypeDS))
+	assert.Equal(t, proofBogus, d.provesNoData("sub.test", domain.RRTypeA), "parent side of a delegation")
+
+	encloser, result := d.nameError("x.c.test")
+	assert.Equal(t, proofSecure, result)
+	assert.Equal(t, "test", encloser)
+	assert.Equal(t, proofSecure, d.provesWildcard("c.test", "test"))
+	assert.Equal(t, proofBogus, d.provesWildcard("a.b.test", "b.test"))
+}
+
+func TestDenial_NSEC_Wildcard(t *testing.T) {
+	d := &denial{nsec: []nsecRecord{
+		{zone: "test", owner: "test", next: "*.test", types: typeSet{domain.RRTypeSOA: true}},
+		{zone: "test", owner: "*.test", next: "www.test", types: typeSet{domain.RRTypeA: true}},
+	}}
+	assert.Equal(t, proofBogus, d.provesNXDomain("foo.test"), "a wildcard could have answered")
+	assert.Equal(t, proofSecure, d.provesNoData("foo.test", domain.RRTypeMX), "wildcard NODATA")
+	assert.Equal(t, proofBogus, d.provesNoData("foo.test", domain.RRTypeA))
+}
+
+// nsec3Chain builds one NSEC3 record per name, linked in hash order into a
+// closed chain as a signed zone would hold them.
+func nsec3Chain(params nsec3Params, records map[string]typeSet, optOut bool) []nsec3Record {
+	var chain []nsec3Record
+	for name, types := range records {
+		chain = append(chain, nsec3Record{params: params, owner: nsec3Hash(params, name), types: types, optOut: optOut})
+	}
+	for i := range chain {
+		for j := i + 1; j < len(chain); j++ {
+			if bytes.Compare(chain[j].owner, chain[i].owner) < 0 {
+				chain[i], chain[j] = chain[j], chain[i]
+			}
+		}
+	}
+	for i := range chain {
+		chain[i].next = chain[(i+1)%len(chain)].owner
+	}
+	return chain
+}
+
+func TestDenial_NSEC3(t *testing.T) {
+	params := nsec3Params{algorithm: nsec3HashSHA1, iterations: 1, salt: "ab"}
+	zone := map[string]typeSet{
+		"test":     {domain.RRTypeSOA: true, domain.RRTypeNS: true},
+		"www.test": {domain.RRTypeA: true},
+		"sub.test": {domain.RRTypeNS: true},
+	}
+	d := &denial{zone: "test", nsec3: nsec3Chain(params, zone, false)}
+
+	assert.Equal(t, proofSecure, d.provesNXDomain("nope.test"))
+	assert.Equal(t, proofSecure, d.provesNXDomain("a.b.www.test"))
+	assert.Equal(t, proofBogus, d.provesNXDomain("www.test"))
+	assert.Equal(t, proofBogus, d.provesNXDomain("x.sub.test"), "closest encloser at a delegation")
+	assert.Equal(t, proofBogus, d.provesNXDomain("test"))
+	assert.Equal(t, proofSecure, d.provesNoData("www.test", domain.RRTypeAAAA))
+	assert.Equal(t, proofBogus, d.provesNoData("www.test", domain.RRTypeA))
+	assert.Equal(t, proofSecure, d.provesNoData("sub.test", domain.RRTypeDS))
+	assert.Equal(t, proofSecure, d.provesWildcard("foo.test", "test"))
+	assert.Equal(t, proofBogus, d.provesWildcard("www.test", "test"))
+
+	// The closest encloser alone, without a record covering the next closer name, proves nothing.
+	apex, _ := d.nsec3Match("test")
+	apex.next = append(append([]byte(nil), apex.owner[:19]...), apex.owner[19]+1)
+	alone := &denial{zone: "test", nsec3: []nsec3Record{apex}}
+	assert.Equal(t, proofBogus, alone.provesNXDomain("nope.test"))
+}
+
+func TestDenial_NSEC3_OptOutAndUnusable(t *testing.T) {
+	params := nsec3Params{algorithm: nsec3HashSHA1}
+	zone := map[string]typeSet{
+		"test":     {domain.RRTypeSOA: true, domain.RRTypeNS: true},
+		"www.test": {domain.RRTypeA: true},
+	}
+	optOut := &denial{zone: "test", nsec3: nsec3Chain(params, zone, true)}
+	assert.Equal(t, proofInsecure, optOut.provesNoData("unsigned.test", domain.RRTypeDS))
+	assert.Equal(t, proofBogus, optOut.provesNoData("unsigned.test", domain.RRTypeA))
+	assert.Equal(t, proofInsecure, optOut.provesNXDomain("unsigned.test"))
+
+	unusable := &denial{zone: "test", nsec3: nsec3Chain(params, zone, false), unusable: true}
+	assert.Equal(t, proofInsecure, unusable.provesNXDomain("nope.test"))
+	assert.Equal(t, proofInsecure, unusable.provesNoData("nope.test", domain.RRTypeA))
+	assert.Equal(t, proofInsecure, unusable.provesWildcard("nope.test", "test"))
+
+	assert.Equal(t, proofBogus, (&denial{}).provesNXDomain("nope.test"), "no records")
+}
+
+func TestDenial_HashMemoised(t *testing.T) {
+	d := &denial{}
+	params := nsec3Params{algorithm: nsec3HashSHA1, iterations: 3}
+	first := d.hash(params, "www.test")
+	assert.Equal(t, nsec3Hash(params, "www.test"), first)
+	assert.Len(t, d.hashes, 1)
+	d.hash(params, "www.test")
+	assert.Len(t, d.hashes, 1)
+}
@@ -0,0 +1,284 @@
+package dnssec
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// SigningKey is a private DNSSEC key of one zone, loaded from a key pair in
+// the format written by BIND's dnssec-keygen. Keys with the SEP flag (DNSKEY
+// flags 257) are key-signing keys (KSK) and sign the DNSKEY RRset; the other
+// keys of the zone (flags 256) are zone-signing keys (ZSK) and sign the rest.
+type SigningKey struct {
+	zone   string // canonical
+	dnskey domain.ResourceRecord
+	key    dnskeyRecord
+	sign   func(data []byte) ([]byte, error)
+}
+
+// Zone returns the canonical name of the zone the key signs.
+func (k SigningKey) Zone() string {
+	return k.zone
+}
+
+// KeyTag returns the key tag that identifies the key in RRSIG and DS records.
+func (k SigningKey) KeyTag() uint16 {
+	return keyTag(k.key.rdata)
+}
+
+// Algorithm returns the DNSSEC algorithm number of the key.
+func (k SigningKey) Algorithm() uint8 {
+	return k.key.algorithm
+}
+
+// IsKSK reports whether the key has the SEP flag and so signs the DNSKEY RRset.
+func (k SigningKey) IsKSK() bool {
+	return k.key.flags&flagSEP != 0
+}
+
+// DNSKEY returns the public key record served at the zone apex.
+func (k SigningKey) DNSKEY() domain.ResourceRecord {
+	return k.dnskey
+}
+
+// signingAlgorithm reports whether new signatures are made with alg. The
+// SHA-1 algorithms can still be validated but must not be used to sign (RFC 8624 §3.1).
+func signingAlgorithm(alg uint8) bool {
+	switch alg {
+	case algRSASHA256, algRSASHA512, algECDSAP256SHA256, algECDSAP384SHA384, algED25519:
+		return true
+	}
+	return false
+}
+
+// LoadSigningKeys loads every key pair in dir: each K<zone>+<alg>+<tag>.key
+// file with the DNSKEY record, and the .private file of the same name beside it.
+func LoadSigningKeys(dir string) ([]SigningKey, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "K*.key"))
+	if err != nil {
+		return nil, fmt.Errorf(errKeyDir, err)
+	}
+	sort.Strings(paths)
+	keys := make([]SigningKey, 0, len(paths))
+	for _, path := range paths {
+		key, err := LoadSigningKey(path)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// LoadSigningKey loads the key pair whose public half is in keyPath. The
+// private half is read from the file with the extension changed to .private.
+func LoadSigningKey(keyPath string) (SigningKey, error) {
+	privatePath := strings.TrimSuffix(keyPath, filepath.Ext(keyPath)) + ".private"
+	//gosec:disable G304 -- the path comes from operator configuration
+	public, err := os.Open(keyPath)
+	if err != nil {
+		return SigningKey{}, fmt.Errorf(errKeyFile, keyPath, err)
+	}
+	defer func() { _ = public.Close() }()
+	//gosec:disable G304 -- the path comes from operator configuration
+	private, err := os.Open(privatePath)
+	if err != nil {
+		return SigningKey{}, fmt.Errorf(errKeyFile, keyPath, err)
+	}
+	defer func() { _ = private.Close() }()
+
+	key, err := ParseSigningKey(public, private)
+	if err != nil {
+		return SigningKey{}, fmt.Errorf(errKeyFile, keyPath, err)
+	}
+	return key, nil
+}
+
+// ParseSigningKey builds a signing key from the DNSKEY record in public, in
+// zone file presentation format, and the BIND private key file in private:
+//
+//	Private-key-format: v1.3
+//	Algorithm: 13 (ECDSAP256SHA256)
+//	PrivateKey: GU6SnQ/Ou+xC5RumuIUIuJZteXT2z0O/ok1s38Et6mQ=
+//
+// ECDSA and Ed25519 keys need PrivateKey; RSA keys need Modulus,
+// PublicExponent, PrivateExponent, Prime1 and Prime2. The private key must
+// belong to the public key, which is checked by signing a probe.
+func ParseSigningKey(public, private io.Reader) (SigningKey, error) {
+	records, err := ParseTrustAnchors(public)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	if len(records) != 1 || records[0].Type != domain.RRTypeDNSKEY {
+		return SigningKey{}, errors.New("the public key file must hold exactly one DNSKEY record")
+	}
+	dnskey := records[0]
+	key, err := parseDNSKEY(dnskey.Data)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	if key.flags&flagZoneKey == 0 || key.flags&flagRevoke != 0 {
+		return SigningKey{}, fmt.Errorf("DNSKEY flags %d do not mark an active zone key", key.flags)
+	}
+	if !signingAlgorithm(key.algorithm) {
+		return SigningKey{}, fmt.Errorf("algorithm %d is not supported for signing", key.algorithm)
+	}
+
+	fields, err := parsePrivateKeyFile(private)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	if alg, _, _ := strings.Cut(fields["Algorithm"], " "); alg != strconv.Itoa(int(key.algorithm)) {
+		return SigningKey{}, fmt.Errorf("private key algorithm %q does not match DNSKEY algorithm %d", fields["Algorithm"], key.algorithm)
+	}
+	sign, err := privateKeySigner(key, fields)
+	if err != nil {
+		return SigningKey{}, err
+	}
+
+	probe := []byte("rr-dns signing key check")
+	signature, err := sign(probe)
+	if err != nil {
+		return SigningKey{}, err
+	}
+	if err := verifyData(key, probe, signature); err != nil {
+		return SigningKey{}, errors.New("private key does not match the DNSKEY record")
+	}
+	if dnskey.OriginalTTL() == 0 {
+		dnskey, err = domain.NewAuthoritativeResourceRecord(dnskey.Name, dnskey.Type, dnskey.Class, defaultDNSKEYTTL, dnskey.Data, dnskey.Text)
+		if err != nil {
+			return SigningKey{}, err
+		}
+	}
+	return SigningKey{zone: canonicalName(dnskey.Name), dnskey: dnskey, key: key, sign: sign}, nil
+}
+
+// parsePrivateKeyFile reads the "Field: value" lines of a BIND private key file.
+func parsePrivateKeyFile(r io.Reader) (map[string]string, error) {
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(fields["Private-key-format"], "v1.") {
+		return nil, fmt.Errorf("unsupported private key format %q", fields["Private-key-format"])
+	}
+	return fields, nil
+}
+
+// privateKeySigner returns a function that signs data with the private key in
+// fields, producing signatures in the DNSSEC format of the key's algorithm.
+func privateKeySigner(key dnskeyRecord, fields map[string]string) (func([]byte) ([]byte, error), error) {
+	decode := func(name string) ([]byte, error) {
+		value, ok := fields[name]
+		if !ok {
+			return nil, fmt.Errorf("private key field %s is missing", name)
+		}
+		b, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("private key field %s: %w", name, err)
+		}
+		return b, nil
+	}
+
+	switch key.algorithm {
+	case algED25519:
+		seed, err := decode("PrivateKey")
+		if err != nil {
+			return nil, err
+		}
+		if len(seed) != ed25519.SeedSize {
+			return nil, errors.New("invalid Ed25519 private key")
+		}
+		priv := ed25519.NewKeyFromSeed(seed)
+		return func(data []byte) ([]byte, error) { return ed25519.Sign(priv, data), nil }, nil
+
+	case algECDSAP256SHA256, algECDSAP384SHA384:
+		curve, hash := elliptic.P256(), crypto.SHA256
+		if key.algorithm == algECDSAP384SHA384 {
+			curve, hash = elliptic.P384(), crypto.SHA384
+		}
+		d, err := decode("PrivateKey")
+		if err != nil {
+			return nil, err
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(d) != size || len(key.publicKey) != 2*size {
+			return nil, errors.New("invalid ECDSA private key")
+		}
+		priv := &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{
+				Curve: curve,
+				X:     new(big.Int).SetBytes(key.publicKey[:size]),
+				Y:     new(big.Int).SetBytes(key.publicKey[size:]),
+			},
+			D: new(big.Int).SetBytes(d),
+		}
+		return func(data []byte) ([]byte, error) {
+			h := hash.New()
+			h.Write(data)
+			r, s, err := ecdsa.Sign(rand.Reader, priv, h.Sum(nil))
+			if err != nil {
+				return nil, err
+			}
+			// DNSSEC signatures are r and s as fixed-size integers (RFC 6605 §4).
+			return append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...), nil
+		}, nil
+
+	case algRSASHA256, algRSASHA512:
+		hash := crypto.SHA256
+		if key.algorithm == algRSASHA512 {
+			hash = crypto.SHA512
+		}
+		var parts [5]*big.Int
+		for i, name := range []string{"Modulus", "PublicExponent", "PrivateExponent", "Prime1", "Prime2"} {
+			b, err := decode(name)
+			if err != nil {
+				return nil, err
+			}
+			parts[i] = new(big.Int).SetBytes(b)
+		}
+		if !parts[1].IsInt64() || parts[1].Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA public exponent")
+		}
+		priv := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: parts[0], E: int(parts[1].Int64())},
+			D:         parts[2],
+			Primes:    []*big.Int{parts[3], parts[4]},
+		}
+		if err := priv.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid RSA private key: %w", err)
+		}
+		priv.Precompute()
+		return func(data []byte) ([]byte, error) {
+			h := hash.New()
+			h.Write(data)
+			return rsa.SignPKCS1v15(rand.Reader, priv, hash, h.Sum(nil))
+		}, nil
+	}
+	return nil, fmt.Errorf("algorithm %d is not supported for signing", key.algorithm)
+}
@@ -0,0 +1,161 @@
+package dnssec
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testKeyFiles generates a key and returns the contents of its .key and
+// .private files as BIND's dnssec-keygen writes them.
+func testKeyFiles(t *testing.T, zone string, alg uint8, flags uint16) (string, string) {
+	t.Helper()
+	var public []byte
+	private := []string{"Private-key-format: v1.3", fmt.Sprintf("Algorithm: %d (TEST)", alg)}
+	b64 := base64.StdEncoding.EncodeToString
+	switch alg {
+	case algED25519:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		public = pub
+		private = append(private, "PrivateKey: "+b64(priv.Seed()))
+	case algECDSAP256SHA256, algECDSAP384SHA384:
+		curve, size := elliptic.P256(), 32
+		if alg == algECDSAP384SHA384 {
+			curve, size = elliptic.P384(), 48
+		}
+		priv, err := ecdsa.GenerateKey(curve, rand.Reader)
+		require.NoError(t, err)
+		public = append(priv.X.FillBytes(make([]byte, size)), priv.Y.FillBytes(make([]byte, size))...)
+		private = append(private, "PrivateKey: "+b64(priv.D.FillBytes(make([]byte, size))))
+	case algRSASHA256, algRSASHA512:
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		public = append([]byte{3, 1, 0, 1}, priv.N.Bytes()...)
+		private = append(private,
+			"Modulus: "+b64(priv.N.Bytes()),
+			"PublicExponent: "+b64([]byte{1, 0, 1}),
+			"PrivateExponent: "+b64(priv.D.Bytes()),
+			"Prime1: "+b64(priv.Primes[0].Bytes()),
+			"Prime2: "+b64(priv.Primes[1].Bytes()),
+		)
+	default:
+		t.Fatalf("unsupported test algorithm %d", alg)
+	}
+	key := fmt.Sprintf("; test key for %s\n%s IN DNSKEY %d 3 %d %s\n", zone, zone, flags, alg, b64(public))
+	return key, strings.Join(private, "\n") + "\nCreated: 20250101000000\n"
+}
+
+// newTestSigningKey generates a signing key for zone.
+func newTestSigningKey(t *testing.T, zone string, alg uint8, flags uint16) SigningKey {
+	t.Helper()
+	public, private := testKeyFiles(t, zone, alg, flags)
+	key, err := ParseSigningKey(strings.NewReader(public), strings.NewReader(private))
+	require.NoError(t, err)
+	return key
+}
+
+func TestParseSigningKey(t *testing.T) {
+	for _, alg := range []uint8{algED25519, algECDSAP256SHA256, algECDSAP384SHA384, algRSASHA256, algRSASHA512} {
+		t.Run(fmt.Sprint(alg), func(t *testing.T) {
+			key := newTestSigningKey(t, "Example.Test.", alg, flagZoneKey|flagSEP)
+			assert.Equal(t, "example.test", key.Zone())
+			assert.Equal(t, alg, key.Algorithm())
+			assert.True(t, key.IsKSK())
+			assert.Equal(t, keyTag(key.DNSKEY().Data), key.KeyTag())
+			assert.Equal(t, uint32(defaultDNSKEYTTL), key.DNSKEY().OriginalTTL())
+
+			signature, err := key.sign([]byte("data"))
+			require.NoError(t, err)
+			assert.NoError(t, verifyData(key.key, []byte("data"), signature))
+		})
+	}
+
+	zsk := newTestSigningKey(t, "example.test.", algED25519, flagZoneKey)
+	assert.False(t, zsk.IsKSK())
+
+	public, private := testKeyFiles(t, "example.test.", algED25519, flagZoneKey)
+	withTTL := strings.Replace(public, " IN DNSKEY", " 600 IN DNSKEY", 1)
+	key, err := ParseSigningKey(strings.NewReader(withTTL), strings.NewReader(private))
+	require.NoError(t, err)
+	assert.Equal(t, uint32(600), key.DNSKEY().OriginalTTL())
+}
+
+func TestParseSigningKey_Errors(t *testing.T) {
+	public, private := testKeyFiles(t, "example.test.", algED25519, flagZoneKey)
+	otherPublic, _ := testKeyFiles(t, "example.test.", algED25519, flagZoneKey)
+	_, ecdsaPrivate := testKeyFiles(t, "example.test.", algECDSAP256SHA256, flagZoneKey)
+
+	tests := []struct {
+		name    string
+		public  string
+		private string
+		wantErr string
+	}{
+		{name: "key pair mismatch", public: otherPublic, private: private, wantErr: "does not match the DNSKEY"},
+		{name: "algorithm mismatch", public: public, private: ecdsaPrivate, wantErr: "does not match DNSKEY algorithm"},
+		{name: "not a zone key", public: strings.Replace(public, "DNSKEY 256", "DNSKEY 0", 1), private: private, wantErr: "active zone key"},
+		{name: "revoked", public: strings.Replace(public, "DNSKEY 256", "DNSKEY 384", 1), private: private, wantErr: "active zone key"},
+		{name: "SHA-1 algorithm", public: strings.Replace(public, " 3 15 ", " 3 5 ", 1), private: private, wantErr: "not supported for signing"},
+		{name: "no DNSKEY", public: "; empty\n", private: private, wantErr: "exactly one DNSKEY"},
+		{name: "two DNSKEYs", public: public + otherPublic, private: private, wantErr: "exactly one DNSKEY"},
+		{name: "unknown format", public: public, private: strings.Replace(private, "v1.3", "v2.0", 1), wantErr: "unsupported private key format"},
+		{name: "missing field", public: public, private: strings.Replace(private, "PrivateKey", "Other", 1), wantErr: "PrivateKey is missing"},
+		{name: "bad base64", public: public, private: strings.Replace(private, "PrivateKey: ", "PrivateKey: !", 1), wantErr: "PrivateKey"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSigningKey(strings.NewReader(tt.public), strings.NewReader(tt.private))
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestLoadSigningKeys(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+	ksk, kskPrivate := testKeyFiles(t, "example.test.", algECDSAP256SHA256, flagZoneKey|flagSEP)
+	zsk, zskPrivate := testKeyFiles(t, "example.test.", algECDSAP256SHA256, flagZoneKey)
+	write("Kexample.test.+013+00001.key", ksk)
+	write("Kexample.test.+013+00001.private", kskPrivate)
+	write("Kexample.test.+013+00002.key", zsk)
+	write("Kexample.test.+013+00002.private", zskPrivate)
+	write("README", "not a key")
+
+	keys, err := LoadSigningKeys(dir)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.True(t, keys[0].IsKSK())
+	assert.False(t, keys[1].IsKSK())
+
+	empty, err := LoadSigningKeys(t.TempDir())
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+
+	write("Kother.test.+013+00003.key", zsk)
+	_, err = LoadSigningKeys(dir)
+	assert.ErrorContains(t, err, "Kother.test.+013+00003.key")
+
+	_, err = LoadSigningKey(filepath.Join(dir, "Kmissing.key"))
+	assert.Error(t, err)
+}
+
+func TestSigningAlgorithm(t *testing.T) {
+	assert.True(t, signingAlgorithm(algED25519))
+	assert.True(t, signingAlgorithm(algRSASHA512))
+	assert.False(t, signingAlgorithm(algRSASHA1))
+	assert.False(t, signingAlgorithm(algRSASHA1NSEC3SHA1))
+}
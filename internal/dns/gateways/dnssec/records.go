@@ -0,0 +1,319 @@
+package dnssec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/haukened/rr-dns/internal/dns/common/utils"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// DNSKEY flag bits (RFC 4034 §2.1.1, RFC 5011 §7).
+const (
+	flagZoneKey uint16 = 0x0100
+	flagRevoke  uint16 = 0x0080
+	flagSEP     uint16 = 0x0001
+)
+
+// nsec3FlagOptOut marks an NSEC3 record whose span may cover unsigned delegations (RFC 5155 §3.1.2.1).
+const nsec3FlagOptOut = 0x01
+
+// rrsigRecord is the parsed RDATA of an RRSIG record (RFC 4034 §3.1).
+type rrsigRecord struct {
+	typeCovered domain.RRType
+	algorithm   uint8
+	labels      uint8
+	originalTTL uint32
+	expiration  uint32
+	inception   uint32
+	keyTag      uint16
+	signer      string // canonical, root is ""
+	signature   []byte
+	// signedFields is the RDATA up to the signature, with the signer name in
+	// canonical form; it opens the data a signature covers (RFC 4034 §3.1.8.1).
+	signedFields []byte
+}
+
+// dnskeyRecord is the parsed RDATA of a DNSKEY record (RFC 4034 §2.1).
+type dnskeyRecord struct {
+	flags     uint16
+	protocol  uint8
+	algorithm uint8
+	publicKey []byte
+	rdata     []byte
+}
+
+// dsRecord is the parsed RDATA of a DS record (RFC 4034 §5.1).
+type dsRecord struct {
+	keyTag     uint16
+	algorithm  uint8
+	digestType uint8
+	digest     []byte
+}
+
+// nsecRecord is an NSEC record reduced to what denial proofs need (RFC 4034 §4.1).
+type nsecRecord struct {
+	zone  string // signer of the record; it proves nothing outside this zone
+	owner string
+	next  string
+	types typeSet
+}
+
+// nsec3Params are the hashing parameters of an NSEC3 chain (RFC 5155 §3.1).
+type nsec3Params struct {
+	algorithm  uint8
+	iterations uint16
+	salt       string
+}
+
+// nsec3Record is an NSEC3 record reduced to what denial proofs need (RFC 5155 §3.1).
+type nsec3Record struct {
+	params nsec3Params
+	optOut bool
+	owner  []byte // hashed owner name, decoded from the first label
+	next   []byte // next hashed owner name
+	types  typeSet
+}
+
+// typeSet is the set of types listed in an NSEC or NSEC3 type bitmap.
+type typeSet map[domain.RRType]bool
+
+// parseRRSIG parses RRSIG RDATA.
+func parseRRSIG(data []byte) (rrsigRecord, error) {
+	if len(data) < 19 {
+		return rrsigRecord{}, errors.New("RRSIG too short")
+	}
+	signer, rest, err := readName(data[18:])
+	if err != nil {
+		return rrsigRecord{}, fmt.Errorf("RRSIG signer: %w", err)
+	}
+	if len(rest) == 0 {
+		return rrsigRecord{}, errors.New("RRSIG has no signature")
+	}
+	fields := append([]byte(nil), data[:18]...)
+	return rrsigRecord{
+		typeCovered:  domain.RRType(binary.BigEndian.Uint16(data[0:2])),
+		algorithm:    data[2],
+		labels:       data[3],
+		originalTTL:  binary.BigEndian.Uint32(data[4:8]),
+		expiration:   binary.BigEndian.Uint32(data[8:12]),
+		inception:    binary.BigEndian.Uint32(data[12:16]),
+		keyTag:       binary.BigEndian.Uint16(data[16:18]),
+		signer:       signer,
+		signature:    rest,
+		signedFields: append(fields, nameWire(signer)...),
+	}, nil
+}
+
+// parseDNSKEY parses DNSKEY RDATA.
+func parseDNSKEY(data []byte) (dnskeyRecord, error) {
+	if len(data) < 5 {
+		return dnskeyRecord{}, errors.New("DNSKEY too short")
+	}
+	return dnskeyRecord{
+		flags:     binary.BigEndian.Uint16(data[0:2]),
+		protocol:  data[2],
+		algorithm: data[3],
+		publicKey: data[4:],
+		rdata:     data,
+	}, nil
+}
+
+// parseDS parses DS RDATA.
+func parseDS(data []byte) (dsRecord, error) {
+	if len(data) < 5 {
+		return dsRecord{}, errors.New("DS too short")
+	}
+	return dsRecord{
+		keyTag:     binary.BigEndian.Uint16(data[0:2]),
+		algorithm:  data[2],
+		digestType: data[3],
+		digest:     data[4:],
+	}, nil
+}
+
+// parseNSEC parses the RDATA of an NSEC record owned by owner in zone.
+func parseNSEC(zone, owner string, data []byte) (nsecRecord, error) {
+	next, rest, err := readName(data)
+	if err != nil {
+		return nsecRecord{}, fmt.Errorf("NSEC next name: %w", err)
+	}
+	types, err := parseTypeBitmap(rest)
+	if err != nil {
+		return nsecRecord{}, fmt.Errorf("NSEC type bitmap: %w", err)
+	}
+	return nsecRecord{zone: zone, owner: owner, next: next, types: types}, nil
+}
+
+// parseNSEC3 parses the RDATA of an NSEC3 record owned by owner. The first
+// label of the owner is the base32hex-encoded hash of the name it stands for.
+func parseNSEC3(owner string, data []byte) (nsec3Record, error) {
+	if len(data) < 5 || len(data) < 5+int(data[4]) {
+		return nsec3Record{}, errors.New("NSEC3 too short")
+	}
+	params := nsec3Params{
+		algorithm:  data[0],
+		iterations: binary.BigEndian.Uint16(data[2:4]),
+		salt:       string(data[5 : 5+data[4]]),
+	}
+	rest := data[5+data[4]:]
+	if len(rest) < 1 || len(rest) < 1+int(rest[0]) || rest[0] == 0 {
+		return nsec3Record{}, errors.New("NSEC3 next hashed owner truncated")
+	}
+	next := rest[1 : 1+rest[0]]
+	types, err := parseTypeBitmap(rest[1+rest[0]:])
+	if err != nil {
+		return nsec3Record{}, fmt.Errorf("NSEC3 type bitmap: %w", err)
+	}
+	label, _, _ := strings.Cut(owner, ".")
+	hash, err := base32Hex.DecodeString(strings.ToUpper(label))
+	if err != nil {
+		return nsec3Record{}, fmt.Errorf("NSEC3 owner %q is not a hash", owner)
+	}
+	return nsec3Record{
+		params: params,
+		optOut: data[1]&nsec3FlagOptOut != 0,
+		owner:  hash,
+		next:   next,
+		types:  types,
+	}, nil
+}
+
+// parseTypeBitmap decodes a windowed NSEC/NSEC3 type bitmap (RFC 4034 §4.1.2).
+func parseTypeBitmap(b []byte) (typeSet, error) {
+	types := typeSet{}
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return nil, errors.New("truncated window header")
+		}
+		window, length := int(b[0]), int(b[1])
+		if length == 0 || length > 32 || len(b) < 2+length {
+			return nil, fmt.Errorf("invalid window length %d", length)
+		}
+		for i, octet := range b[2 : 2+length] {
+			for bit := range 8 {
+				if octet&(0x80>>bit) != 0 {
+					//gosec:disable G115 -- window < 256 and i < 32, so the type fits in 16 bits
+					types[domain.RRType(window<<8|i*8+bit)] = true
+				}
+			}
+		}
+		b = b[2+length:]
+	}
+	return types, nil
+}
+
+// readName decodes an uncompressed domain name at the start of b, returning it
+// in canonical form (lowercase, no trailing dot, root as "") with the bytes after it.
+func readName(b []byte) (string, []byte, error) {
+	var labels []string
+	for i := 0; ; {
+		if i >= len(b) {
+			return "", nil, errors.New("truncated name")
+		}
+		n := int(b[i])
+		if n == 0 {
+			return strings.ToLower(strings.Join(labels, ".")), b[i+1:], nil
+		}
+		if n > 63 || i+1+n > len(b) {
+			return "", nil, errors.New("invalid label")
+		}
+		labels = append(labels, string(b[i+1:i+1+n]))
+		i += 1 + n
+	}
+}
+
+// canonicalName converts a record owner name to the canonical form used in
+// this package: lowercase, no trailing dot, and "" for the root.
+func canonicalName(name string) string {
+	return utils.CanonicalDNSName(name)
+}
+
+// nameWire encodes a canonical name in uncompressed wire format.
+func nameWire(name string) []byte {
+	var out []byte
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			out = append(out, byte(len(label)))
+			out = append(out, label...)
+		}
+	}
+	return append(out, 0)
+}
+
+// labelCount returns the number of labels in a canonical name, not counting
+// the root or a leading wildcard (RFC 4034 §3.1.3).
+func labelCount(name string) int {
+	if name == "" {
+		return 0
+	}
+	n := strings.Count(name, ".") + 1
+	if name == "*" || strings.HasPrefix(name, "*.") {
+		n--
+	}
+	return n
+}
+
+// parentName strips the leftmost label of a canonical name; the parent of a
+// top-level domain is the root, written as "".
+func parentName(name string) string {
+	_, parent, _ := strings.Cut(name, ".")
+	return parent
+}
+
+// inZone reports whether a canonical name equals zone or sits below it on a
+// label boundary. Every name is inside the root zone "".
+func inZone(name, zone string) bool {
+	return zone == "" || name == zone || strings.HasSuffix(name, "."+zone)
+}
+
+// childOf returns the name one label below ancestor on the way to name.
+// name must be strictly below ancestor.
+func childOf(ancestor, name string) string {
+	rest := name
+	if ancestor != "" {
+		rest = strings.TrimSuffix(name, "."+ancestor)
+	}
+	return name[strings.LastIndex(rest, ".")+1:]
+}
+
+// wildcardOf returns the wildcard name directly below a closest encloser.
+func wildcardOf(encloser string) string {
+	if encloser == "" {
+		return "*"
+	}
+	return "*." + encloser
+}
+
+// canonicalCompare orders two canonical names as RFC 4034 §6.1 requires:
+// label by label from the root, each label compared as lowercase octets.
+func canonicalCompare(a, b string) int {
+	la, lb := splitLabels(a), splitLabels(b)
+	for i := 1; i <= len(la) && i <= len(lb); i++ {
+		if c := bytes.Compare([]byte(la[len(la)-i]), []byte(lb[len(lb)-i])); c != 0 {
+			return c
+		}
+	}
+	return len(la) - len(lb)
+}
+
+// splitLabels splits a canonical name into labels; the root has none.
+func splitLabels(name string) []string {
+	if name == "" {
+		return nil
+	}
+	return strings.Split(name, ".")
+}
+
+// commonAncestor returns the longest name that both canonical names are equal to or below.
+func commonAncestor(a, b string) string {
+	la, lb := splitLabels(a), splitLabels(b)
+	n := 0
+	for n < len(la) && n < len(lb) && la[len(la)-1-n] == lb[len(lb)-1-n] {
+		n++
+	}
+	return strings.Join(la[len(la)-n:], ".")
+}
@@ -0,0 +1,171 @@
+package dnssec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/common/rrdata"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+func TestParseRRSIG(t *testing.T) {
+	data, err := rrdata.Encode(domain.RRTypeRRSIG, "A 13 3 300 20250201000000 20250101000000 12345 Example.Test. AAECAw==")
+	require.NoError(t, err)
+
+	sig, err := parseRRSIG(data)
+	require.NoError(t, err)
+	assert.Equal(t, domain.RRTypeA, sig.typeCovered)
+	assert.Equal(t, uint8(13), sig.algorithm)
+	assert.Equal(t, uint8(3), sig.labels)
+	assert.Equal(t, uint32(300), sig.originalTTL)
+	assert.Equal(t, uint32(0x679D6400), sig.expiration)
+	assert.Equal(t, uint32(0x67748580), sig.inception)
+	assert.Equal(t, uint16(12345), sig.keyTag)
+	assert.Equal(t, "example.test", sig.signer)
+	assert.Equal(t, []byte{0, 1, 2, 3}, sig.signature)
+	assert.Equal(t, append(append([]byte(nil), data[:18]...), nameWire("example.test")...), sig.signedFields)
+
+	for _, bad := range [][]byte{data[:10], data[:len(data)-4], data[:20]} {
+		_, err := parseRRSIG(bad)
+		assert.Error(t, err)
+	}
+}
+
+func TestParseDNSKEYAndDS(t *testing.T) {
+	key, err := parseDNSKEY([]byte{1, 1, 3, 15, 0xAA, 0xBB})
+	require.NoError(t, err)
+	assert.Equal(t, flagZoneKey|flagSEP, key.flags)
+	assert.Equal(t, uint8(3), key.protocol)
+	assert.Equal(t, uint8(algED25519), key.algorithm)
+	assert.Equal(t, []byte{0xAA, 0xBB}, key.publicKey)
+
+	ds, err := parseDS([]byte{0x30, 0x39, 13, 2, 0xCC})
+	require.NoError(t, err)
+	assert.Equal(t, dsRecord{keyTag: 12345, algorithm: 13, digestType: 2, digest: []byte{0xCC}}, ds)
+
+	_, err = parseDNSKEY([]byte{1, 1, 3})
+	assert.Error(t, err)
+	_, err = parseDS([]byte{0x30, 0x39})
+	assert.Error(t, err)
+}
+
+func TestParseNSECAndNSEC3(t *testing.T) {
+	data, err := rrdata.Encode(domain.RRTypeNSEC, "Host.Example.Test. A MX RRSIG NSEC TYPE1234")
+	require.NoError(t, err)
+	n, err := parseNSEC("example.test", "a.example.test", data)
+	require.NoError(t, err)
+	assert.Equal(t, "host.example.test", n.next)
+	assert.Equal(t, typeSet{domain.RRTypeA: true, domain.RRTypeMX: true, domain.RRTypeRRSIG: true, domain.RRTypeNSEC: true, domain.RRType(1234): true}, n.types)
+
+	data, err = rrdata.Encode(domain.RRTypeNSEC3, "1 1 10 AABB 2T7B4G4VSA5SMI47K61MV5BV1A22BOJR A RRSIG")
+	require.NoError(t, err)
+	n3, err := parseNSEC3("0p9mhaveqvm6t7vbl5lop2u3t2rp3tom.example.test", data)
+	require.NoError(t, err)
+	assert.Equal(t, nsec3Params{algorithm: 1, iterations: 10, salt: "\xaa\xbb"}, n3.params)
+	assert.True(t, n3.optOut)
+	assert.Len(t, n3.owner, 20)
+	assert.Len(t, n3.next, 20)
+	assert.True(t, n3.types[domain.RRTypeA])
+
+	_, err = parseNSEC3("not-a-hash.example.test", data)
+	assert.Error(t, err)
+	_, err = parseNSEC3("0p9mhaveqvm6t7vbl5lop2u3t2rp3tom.example.test", data[:6])
+	assert.Error(t, err)
+	_, err = parseNSEC("example.test", "a.example.test", []byte{3, 'a'})
+	assert.Error(t, err)
+}
+
+func TestParseTypeBitmap(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      []byte
+		want    typeSet
+		wantErr bool
+	}{
+		{name: "empty", in: nil, want: typeSet{}},
+		{name: "a and mx", in: []byte{0, 2, 0x40, 0x01}, want: typeSet{domain.RRTypeA: true, domain.RRTypeMX: true}},
+		{name: "second window", in: []byte{1, 1, 0x40}, want: typeSet{domain.RRTypeCAA: true}},
+		{name: "truncated header", in: []byte{0}, wantErr: true},
+		{name: "zero length window", in: []byte{0, 0}, wantErr: true},
+		{name: "window too long", in: []byte{0, 33}, wantErr: true},
+		{name: "truncated window", in: []byte{0, 2, 0x40}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTypeBitmap(tt.in)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNameHelpers(t *testing.T) {
+	assert.Equal(t, []byte{3, 'w', 'w', 'w', 4, 't', 'e', 's', 't', 0}, nameWire("www.test"))
+	assert.Equal(t, []byte{0}, nameWire(""))
+
+	name, rest, err := readName([]byte{3, 'W', 'W', 'W', 0, 9})
+	require.NoError(t, err)
+	assert.Equal(t, "www", name)
+	assert.Equal(t, []byte{9}, rest)
+	_, _, err = readName([]byte{3, 'w'})
+	assert.Error(t, err)
+	_, _, err = readName([]byte{64})
+	assert.Error(t, err)
+
+	assert.Equal(t, 0, labelCount(""))
+	assert.Equal(t, 2, labelCount("www.test"))
+	assert.Equal(t, 1, labelCount("*.test"))
+	assert.Equal(t, 0, labelCount("*"))
+
+	assert.Equal(t, "test", parentName("www.test"))
+	assert.Equal(t, "", parentName("test"))
+	assert.True(t, inZone("www.test", ""))
+	assert.True(t, inZone("www.test", "test"))
+	assert.True(t, inZone("test", "test"))
+	assert.False(t, inZone("www.contest", "test"))
+
+	assert.Equal(t, "test", childOf("", "a.b.test"))
+	assert.Equal(t, "b.test", childOf("test", "a.b.test"))
+	assert.Equal(t, "a.b.test", childOf("b.test", "a.b.test"))
+
+	assert.Equal(t, "*", wildcardOf(""))
+	assert.Equal(t, "*.test", wildcardOf("test"))
+
+	assert.Equal(t, "test", commonAncestor("a.test", "b.test"))
+	assert.Equal(t, "", commonAncestor("a.test", "b.example"))
+	assert.Equal(t, "b.test", commonAncestor("a.b.test", "b.test"))
+}
+
+func TestCanonicalCompare(t *testing.T) {
+	// The example ordering of RFC 4034 §6.1.
+	ordered := []string{
+		"example",
+		"a.example",
+		"yljkjljk.a.example",
+		"z.a.example",
+		"zabc.a.example",
+		"z.example",
+		"\x01.z.example",
+		"*.z.example",
+		"\x80.z.example",
+	}
+	for i := range ordered {
+		for j := range ordered {
+			got := canonicalCompare(ordered[i], ordered[j])
+			switch {
+			case i < j:
+				assert.Negative(t, got, "%q < %q", ordered[i], ordered[j])
+			case i > j:
+				assert.Positive(t, got, "%q > %q", ordered[i], ordered[j])
+			default:
+				assert.Zero(t, got)
+			}
+		}
+	}
+}
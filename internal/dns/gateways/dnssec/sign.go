@@ -0,0 +1,375 @@
+package dnssec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/common/rrdata"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// signedZone is the signed form of one authoritative zone: its data, the
+// DNSKEY RRset at the apex, an NSEC or NSEC3 chain, and a signature over
+// every RRset, plus the indexes needed to answer for names it does not hold.
+type signedZone struct {
+	root    string                  // canonical zone apex
+	source  []domain.ResourceRecord // records as loaded, signed again on refresh
+	records []domain.ResourceRecord // everything served from the zone cache
+	// sigs maps the cache key of each RRset to the RRSIG records covering it.
+	sigs map[string][]domain.ResourceRecord
+	// names holds the types at every name of the zone, with empty
+	// non-terminals present under an empty set.
+	names   map[string]typeSet
+	soa     []domain.ResourceRecord
+	nsec    []domain.ResourceRecord // in canonical order of owner name
+	nsec3   []hashedRecord          // in hash order
+	params  nsec3Params
+	refresh time.Time // when the signatures are renewed
+}
+
+// hashedRecord is an NSEC3 record with the hash its owner name stands for.
+type hashedRecord struct {
+	hash []byte
+	rr   domain.ResourceRecord
+}
+
+// signZone signs the records of the zone at root with keys. Signatures are
+// valid from signatureInceptionSkew before now until validity after it, and
+// are due for renewal half way through. With useNSEC3, denial of existence
+// uses NSEC3 with the parameters RFC 9276 recommends (no salt, no extra
+// iterations); otherwise an NSEC chain.
+func signZone(root string, source []domain.ResourceRecord, keys []SigningKey, useNSEC3 bool, validity time.Duration, now time.Time) (*signedZone, error) {
+	z := &signedZone{
+		root:    canonicalName(root),
+		source:  source,
+		sigs:    make(map[string][]domain.ResourceRecord),
+		names:   make(map[string]typeSet),
+		refresh: now.Add(validity / 2),
+	}
+
+	// DNSSEC records in the source are replaced by the ones generated here.
+	data := make([]domain.ResourceRecord, 0, len(source)+len(keys)+1)
+	for _, rr := range source {
+		if !isDNSSECType(rr.Type) && rr.Type != domain.RRTypeDNSKEY && rr.Type != domain.RRTypeNSEC3PARAM {
+			data = append(data, rr)
+		}
+	}
+	for _, k := range keys {
+		data = append(data, k.dnskey)
+	}
+	if useNSEC3 {
+		z.params = nsec3Params{algorithm: nsec3HashSHA1}
+		param, err := newSignedRecord(z.root, domain.RRTypeNSEC3PARAM, 0, []byte{nsec3HashSHA1, 0, 0, 0, 0})
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, param)
+	}
+
+	var signable []domain.ResourceRecord
+	for _, rr := range data {
+		name := canonicalName(rr.Name)
+		if !inZone(name, z.root) {
+			continue // served as loaded, but not part of the signed zone
+		}
+		signable = append(signable, rr)
+		if z.names[name] == nil {
+			z.names[name] = typeSet{}
+		}
+		z.names[name][rr.Type] = true
+		if rr.Type == domain.RRTypeSOA && name == z.root {
+			z.soa = append(z.soa, rr)
+		}
+	}
+	for _, name := range slices.Collect(maps.Keys(z.names)) {
+		for parent := parentName(name); parent != z.root && inZone(parent, z.root); parent = parentName(parent) {
+			if _, ok := z.names[parent]; ok {
+				break
+			}
+			z.names[parent] = typeSet{} // empty non-terminal
+		}
+	}
+
+	ttl := negativeTTL(z.soa)
+	var denial []domain.ResourceRecord
+	var err error
+	if useNSEC3 {
+		denial, err = z.buildNSEC3(ttl)
+	} else {
+		denial, err = z.buildNSEC(ttl)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signable = append(signable, denial...)
+
+	var ksks, zsks []SigningKey
+	for _, k := range keys {
+		if k.IsKSK() {
+			ksks = append(ksks, k)
+		} else {
+			zsks = append(zsks, k)
+		}
+	}
+	// A zone with one kind of key only signs everything with it (a combined signing key).
+	if len(ksks) == 0 {
+		ksks = zsks
+	}
+	if len(zsks) == 0 {
+		zsks = ksks
+	}
+
+	inception, expiration := now.Add(-signatureInceptionSkew), now.Add(validity)
+	z.records = append(data, denial...)
+	for _, set := range groupRRsets(signable) {
+		signers := zsks
+		if set.rrtype == domain.RRTypeDNSKEY {
+			signers = ksks
+		}
+		key := domain.GenerateCacheKey(set.name, set.rrtype, domain.RRClassIN)
+		for _, k := range signers {
+			sig, err := k.rrsig(set.records, inception, expiration)
+			if err != nil {
+				return nil, err
+			}
+			z.sigs[key] = append(z.sigs[key], sig)
+			z.records = append(z.records, sig)
+		}
+	}
+	return z, nil
+}
+
+// buildNSEC links every name that owns records into a closed NSEC chain in
+// canonical order (RFC 4034 §4). Empty non-terminals get no NSEC record.
+func (z *signedZone) buildNSEC(ttl uint32) ([]domain.ResourceRecord, error) {
+	var owners []string
+	for name, types := range z.names {
+		if len(types) > 0 {
+			owners = append(owners, name)
+		}
+	}
+	sort.Slice(owners, func(i, j int) bool { return canonicalCompare(owners[i], owners[j]) < 0 })
+
+	z.nsec = make([]domain.ResourceRecord, 0, len(owners))
+	for i, owner := range owners {
+		types := withTypes(z.names[owner], domain.RRTypeRRSIG, domain.RRTypeNSEC)
+		rdata := append(nameWire(owners[(i+1)%len(owners)]), typeBitmap(types)...)
+		rr, err := newSignedRecord(owner, domain.RRTypeNSEC, ttl, rdata)
+		if err != nil {
+			return nil, err
+		}
+		z.nsec = append(z.nsec, rr)
+	}
+	return z.nsec, nil
+}
+
+// buildNSEC3 hashes every name of the zone, empty non-terminals included, and
+// links the hashes into a closed NSEC3 chain (RFC 5155 §7.1).
+func (z *signedZone) buildNSEC3(ttl uint32) ([]domain.ResourceRecord, error) {
+	type hashed struct {
+		hash  []byte
+		types typeSet
+	}
+	chain := make([]hashed, 0, len(z.names))
+	for name, types := range z.names {
+		if len(types) > 0 {
+			types = withTypes(types, domain.RRTypeRRSIG)
+		}
+		chain = append(chain, hashed{hash: nsec3Hash(z.params, name), types: types})
+	}
+	sort.Slice(chain, func(i, j int) bool { return bytes.Compare(chain[i].hash, chain[j].hash) < 0 })
+
+	z.nsec3 = make([]hashedRecord, 0, len(chain))
+	records := make([]domain.ResourceRecord, 0, len(chain))
+	for i, h := range chain {
+		next := chain[(i+1)%len(chain)].hash
+		rdata := []byte{z.params.algorithm, 0}
+		rdata = binary.BigEndian.AppendUint16(rdata, z.params.iterations)
+		rdata = append(rdata, byte(len(z.params.salt)))
+		rdata = append(rdata, z.params.salt...)
+		rdata = append(rdata, byte(len(next)))
+		rdata = append(rdata, next...)
+		rdata = append(rdata, typeBitmap(h.types)...)
+		owner := strings.ToLower(base32Hex.EncodeToString(h.hash)) + "." + z.root
+		rr, err := newSignedRecord(owner, domain.RRTypeNSEC3, ttl, rdata)
+		if err != nil {
+			return nil, err
+		}
+		z.nsec3 = append(z.nsec3, hashedRecord{hash: h.hash, rr: rr})
+		records = append(records, rr)
+	}
+	return records, nil
+}
+
+// deny builds the negative answer for a name of the zone that has no records
+// of type qtype: NXDOMAIN or NODATA with the SOA record, and when dnssecOK
+// the NSEC or NSEC3 records that prove it, all with their signatures. ok is
+// false when the zone could hold an answer after all: the name has the type
+// or a CNAME, the query is for ANY, or a wildcard exists where the name would
+// be synthesized from it.
+func (z *signedZone) deny(name string, qtype domain.RRType, dnssecOK bool) (domain.RCode, []domain.ResourceRecord, bool) {
+	if qtype == domain.RRTypeANY {
+		return 0, nil, false
+	}
+	rcode := domain.NOERROR
+	var proofs []domain.ResourceRecord
+	if types, exists := z.names[name]; exists {
+		if types[qtype] || types[domain.RRTypeCNAME] {
+			return 0, nil, false
+		}
+		proofs = append(proofs, z.denialRecord(name))
+	} else {
+		encloser := z.closestEncloser(name)
+		if _, ok := z.names[wildcardOf(encloser)]; ok {
+			return 0, nil, false
+		}
+		rcode = domain.NXDOMAIN
+		if z.nsec3 != nil {
+			// closest encloser, next closer name, and wildcard (RFC 5155 §7.2.2)
+			proofs = append(proofs, z.denialRecord(encloser), z.denialRecord(childOf(encloser, name)))
+		} else {
+			proofs = append(proofs, z.denialRecord(name))
+		}
+		proofs = append(proofs, z.denialRecord(wildcardOf(encloser)))
+	}
+
+	authority := slices.Clone(z.soa)
+	if !dnssecOK {
+		return rcode, authority, true
+	}
+	authority = append(authority, z.signatures(z.soa)...)
+	seen := make(map[string]bool)
+	for _, rr := range proofs {
+		if seen[rr.Name] {
+			continue
+		}
+		seen[rr.Name] = true
+		authority = append(authority, rr)
+		authority = append(authority, z.signatures([]domain.ResourceRecord{rr})...)
+	}
+	return rcode, authority, true
+}
+
+// closestEncloser returns the longest existing ancestor of a name that does not exist.
+func (z *signedZone) closestEncloser(name string) string {
+	for name != z.root {
+		name = parentName(name)
+		if _, ok := z.names[name]; ok {
+			return name
+		}
+	}
+	return z.root
+}
+
+// denialRecord returns the NSEC or NSEC3 record that matches name, or else
+// the one that covers it: the last record of the chain ordered before it,
+// wrapping around to the end of the chain.
+func (z *signedZone) denialRecord(name string) domain.ResourceRecord {
+	if z.nsec3 != nil {
+		h := nsec3Hash(z.params, name)
+		i := sort.Search(len(z.nsec3), func(i int) bool { return bytes.Compare(z.nsec3[i].hash, h) > 0 })
+		return z.nsec3[(i+len(z.nsec3)-1)%len(z.nsec3)].rr
+	}
+	i := sort.Search(len(z.nsec), func(i int) bool { return canonicalCompare(canonicalName(z.nsec[i].Name), name) > 0 })
+	return z.nsec[(i+len(z.nsec)-1)%len(z.nsec)]
+}
+
+// signatures returns the RRSIG records covering the RRsets of records.
+func (z *signedZone) signatures(records []domain.ResourceRecord) []domain.ResourceRecord {
+	var out []domain.ResourceRecord
+	seen := make(map[string]bool)
+	for _, rr := range records {
+		key := rr.CacheKey()
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, z.sigs[key]...)
+		}
+	}
+	return out
+}
+
+// rrsig signs one RRset with the key (RFC 4034 §3.1.8.1).
+func (k SigningKey) rrsig(rrset []domain.ResourceRecord, inception, expiration time.Time) (domain.ResourceRecord, error) {
+	owner := canonicalName(rrset[0].Name)
+	ttl := rrset[0].OriginalTTL()
+	fields := binary.BigEndian.AppendUint16(nil, uint16(rrset[0].Type))
+	fields = append(fields, k.key.algorithm, byte(labelCount(owner)))
+	fields = binary.BigEndian.AppendUint32(fields, ttl)
+	//gosec:disable G115 -- RRSIG times are 32-bit serial numbers (RFC 4034 §3.1.5)
+	fields = binary.BigEndian.AppendUint32(fields, uint32(expiration.Unix()))
+	//gosec:disable G115 -- RRSIG times are 32-bit serial numbers (RFC 4034 §3.1.5)
+	fields = binary.BigEndian.AppendUint32(fields, uint32(inception.Unix()))
+	fields = binary.BigEndian.AppendUint16(fields, k.KeyTag())
+	fields = append(fields, nameWire(k.zone)...)
+
+	sig := rrsigRecord{labels: uint8(labelCount(owner)), originalTTL: ttl, signedFields: fields}
+	data, err := signedData(sig, rrset)
+	if err != nil {
+		return domain.ResourceRecord{}, err
+	}
+	signature, err := k.sign(data)
+	if err != nil {
+		return domain.ResourceRecord{}, err
+	}
+	return newSignedRecord(rrset[0].Name, domain.RRTypeRRSIG, ttl, append(fields, signature...))
+}
+
+// newSignedRecord builds an authoritative record generated while signing,
+// with its presentation form filled in from the RDATA.
+func newSignedRecord(name string, rrtype domain.RRType, ttl uint32, data []byte) (domain.ResourceRecord, error) {
+	text, _ := rrdata.Decode(rrtype, data)
+	return domain.NewAuthoritativeResourceRecord(name, rrtype, domain.RRClassIN, ttl, data, text)
+}
+
+// negativeTTL is the TTL of NSEC and NSEC3 records: the lesser of the SOA TTL
+// and its MINIMUM field (RFC 9077), or defaultNegativeTTL without an SOA.
+func negativeTTL(soa []domain.ResourceRecord) uint32 {
+	if len(soa) == 0 || len(soa[0].Data) < 4 {
+		return defaultNegativeTTL
+	}
+	minimum := binary.BigEndian.Uint32(soa[0].Data[len(soa[0].Data)-4:])
+	return min(soa[0].OriginalTTL(), minimum)
+}
+
+// typeBitmap encodes types as the window blocks of an NSEC or NSEC3 type bit map (RFC 4034 §4.1.2).
+func typeBitmap(types typeSet) []byte {
+	sorted := make([]domain.RRType, 0, len(types))
+	for t, ok := range types {
+		if ok {
+			sorted = append(sorted, t)
+		}
+	}
+	slices.Sort(sorted)
+
+	var out []byte
+	for i := 0; i < len(sorted); {
+		window := byte(sorted[i] >> 8)
+		var bits [32]byte
+		length := 0
+		for ; i < len(sorted) && byte(sorted[i]>>8) == window; i++ {
+			low := byte(sorted[i])
+			bits[low/8] |= 0x80 >> (low % 8)
+			length = int(low/8) + 1
+		}
+		out = append(out, window, byte(length))
+		out = append(out, bits[:length]...)
+	}
+	return out
+}
+
+// withTypes returns a copy of types with extra added.
+func withTypes(types typeSet, extra ...domain.RRType) typeSet {
+	out := make(typeSet, len(types)+len(extra))
+	for t, ok := range types {
+		out[t] = ok
+	}
+	for _, t := range extra {
+		out[t] = true
+	}
+	return out
+}
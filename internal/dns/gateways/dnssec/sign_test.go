@@ -0,0 +1,172 @@
+package dnssec
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// testZone returns the records of a small zone at example.test. with an
+// empty non-terminal (b.example.test.) and an alias.
+func testZone(t *testing.T) []domain.ResourceRecord {
+	t.Helper()
+	return []domain.ResourceRecord{
+		testRR(t, "example.test.", domain.RRTypeSOA, "ns1.example.test. hostmaster.example.test. 1 7200 3600 1209600 60"),
+		testRR(t, "example.test.", domain.RRTypeNS, "ns1.example.test."),
+		testRR(t, "example.test.", domain.RRTypeMX, "10 mail.example.test."),
+		testRR(t, "ns1.example.test.", domain.RRTypeA, "192.0.2.53"),
+		testRR(t, "www.example.test.", domain.RRTypeA, "192.0.2.1"),
+		testRR(t, "www.example.test.", domain.RRTypeA, "192.0.2.2"),
+		testRR(t, "a.b.example.test.", domain.RRTypeTXT, "deep"),
+		testRR(t, "alias.example.test.", domain.RRTypeCNAME, "www.example.test."),
+		testRR(t, "other.invalid.", domain.RRTypeA, "192.0.2.99"),
+	}
+}
+
+func TestTypeBitmap(t *testing.T) {
+	types := typeSet{domain.RRTypeA: true, domain.RRTypeMX: true, domain.RRTypeRRSIG: true, domain.RRTypeCAA: true, domain.RRTypeAAAA: false}
+	encoded := typeBitmap(types)
+	decoded, err := parseTypeBitmap(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, typeSet{domain.RRTypeA: true, domain.RRTypeMX: true, domain.RRTypeRRSIG: true, domain.RRTypeCAA: true}, decoded)
+	assert.Equal(t, []byte{0, 2, 0x40, 0x01}, typeBitmap(typeSet{domain.RRTypeA: true, domain.RRTypeMX: true}))
+	assert.Empty(t, typeBitmap(typeSet{}))
+}
+
+func TestNegativeTTL(t *testing.T) {
+	soa := testRR(t, "example.test.", domain.RRTypeSOA, "ns1.example.test. hostmaster.example.test. 1 7200 3600 1209600 60")
+	assert.Equal(t, uint32(60), negativeTTL([]domain.ResourceRecord{soa}), "MINIMUM below the SOA TTL")
+	long := testRR(t, "example.test.", domain.RRTypeSOA, "ns1.example.test. hostmaster.example.test. 1 7200 3600 1209600 86400")
+	assert.Equal(t, uint32(300), negativeTTL([]domain.ResourceRecord{long}), "SOA TTL below MINIMUM")
+	assert.Equal(t, uint32(defaultNegativeTTL), negativeTTL(nil))
+}
+
+func TestSignZone(t *testing.T) {
+	now := time.Now()
+	ksk := newTestSigningKey(t, "example.test.", algECDSAP256SHA256, flagZoneKey|flagSEP)
+	zsk := newTestSigningKey(t, "example.test.", algED25519, flagZoneKey)
+	stale := testRR(t, "example.test.", domain.RRTypeRRSIG, "A 13 2 300 20250201000000 20250101000000 12345 example.test. AAECAw==")
+	source := append(testZone(t), stale)
+
+	for _, useNSEC3 := range []bool{false, true} {
+		z, err := signZone("Example.Test.", source, []SigningKey{ksk, zsk}, useNSEC3, 24*time.Hour, now)
+		require.NoError(t, err)
+		assert.Equal(t, "example.test", z.root)
+		assert.Equal(t, now.Add(12*time.Hour), z.refresh)
+		assert.Len(t, z.soa, 1)
+		assert.Equal(t, typeSet{}, z.names["b.example.test"], "empty non-terminal")
+		assert.NotContains(t, z.names, "other.invalid")
+
+		var dnskeys, denials int
+		for _, set := range groupRRsets(z.records) {
+			switch set.rrtype {
+			case domain.RRTypeDNSKEY:
+				dnskeys += len(set.records)
+			case domain.RRTypeNSEC, domain.RRTypeNSEC3:
+				denials += len(set.records)
+			}
+			if set.name == "other.invalid" {
+				assert.Empty(t, set.sigs, "records outside the zone are not signed")
+				continue
+			}
+			require.Len(t, set.sigs, 1, "%s %s", set.name, set.rrtype)
+			sig, err := parseRRSIG(set.sigs[0].Data)
+			require.NoError(t, err)
+			signer := zsk
+			if set.rrtype == domain.RRTypeDNSKEY {
+				signer = ksk
+			}
+			assert.NoError(t, verifySignature(signer.key, sig, set.records), "%s %s", set.name, set.rrtype)
+			assert.Equal(t, uint32(now.Add(-signatureInceptionSkew).Unix()), sig.inception)
+			assert.Equal(t, uint32(now.Add(24*time.Hour).Unix()), sig.expiration)
+			assert.Equal(t, set.sigs, z.sigs[domain.GenerateCacheKey(set.name, set.rrtype, domain.RRClassIN)])
+		}
+		assert.Equal(t, 2, dnskeys)
+		if useNSEC3 {
+			assert.Equal(t, 6, denials, "one NSEC3 per name, the empty non-terminal included")
+			assert.True(t, z.names["example.test"][domain.RRTypeNSEC3PARAM])
+		} else {
+			assert.Equal(t, 5, denials, "one NSEC per name holding records")
+		}
+	}
+}
+
+func TestSignZone_CombinedKey(t *testing.T) {
+	csk := newTestSigningKey(t, "example.test.", algED25519, flagZoneKey|flagSEP)
+	z, err := signZone("example.test", testZone(t), []SigningKey{csk}, false, time.Hour, time.Now())
+	require.NoError(t, err)
+	for _, set := range groupRRsets(z.records) {
+		if set.name != "other.invalid" {
+			assert.Len(t, set.sigs, 1, "%s %s", set.name, set.rrtype)
+		}
+	}
+}
+
+func TestSignedZone_Deny(t *testing.T) {
+	key := newTestSigningKey(t, "example.test.", algED25519, flagZoneKey|flagSEP)
+	wildcard := testRR(t, "*.wild.example.test.", domain.RRTypeA, "192.0.2.7")
+
+	for _, useNSEC3 := range []bool{false, true} {
+		z, err := signZone("example.test", append(testZone(t), wildcard), []SigningKey{key}, useNSEC3, time.Hour, time.Now())
+		require.NoError(t, err)
+
+		tests := []struct {
+			name      string
+			qname     string
+			qtype     domain.RRType
+			wantOK    bool
+			wantRCode domain.RCode
+		}{
+			{name: "nxdomain", qname: "nope.example.test", qtype: domain.RRTypeA, wantOK: true, wantRCode: domain.NXDOMAIN},
+			{name: "nxdomain below a name", qname: "x.y.www.example.test", qtype: domain.RRTypeA, wantOK: true, wantRCode: domain.NXDOMAIN},
+			{name: "nodata", qname: "www.example.test", qtype: domain.RRTypeAAAA, wantOK: true, wantRCode: domain.NOERROR},
+			{name: "nodata at the apex", qname: "example.test", qtype: domain.RRTypeTXT, wantOK: true, wantRCode: domain.NOERROR},
+			{name: "empty non-terminal", qname: "b.example.test", qtype: domain.RRTypeA, wantOK: true, wantRCode: domain.NOERROR},
+			{name: "type exists", qname: "www.example.test", qtype: domain.RRTypeA},
+			{name: "alias", qname: "alias.example.test", qtype: domain.RRTypeA},
+			{name: "any", qname: "nope.example.test", qtype: domain.RRTypeANY},
+			{name: "covered by a wildcard", qname: "x.wild.example.test", qtype: domain.RRTypeA},
+		}
+		for _, tt := range tests {
+			rcode, authority, ok := z.deny(tt.qname, tt.qtype, true)
+			require.Equal(t, tt.wantOK, ok, "%s (nsec3=%v)", tt.name, useNSEC3)
+			if !ok {
+				continue
+			}
+			assert.Equal(t, tt.wantRCode, rcode, tt.name)
+			require.NotEmpty(t, authority)
+			assert.Equal(t, z.soa[0], authority[0], "the SOA opens the authority section")
+
+			// the proof must satisfy the validator's own checks
+			d := &denial{zone: z.root}
+			for _, rr := range authority {
+				switch rr.Type {
+				case domain.RRTypeNSEC:
+					n, err := parseNSEC(z.root, canonicalName(rr.Name), rr.Data)
+					require.NoError(t, err)
+					d.nsec = append(d.nsec, n)
+				case domain.RRTypeNSEC3:
+					n, err := parseNSEC3(canonicalName(rr.Name), rr.Data)
+					require.NoError(t, err)
+					d.nsec3 = append(d.nsec3, n)
+				}
+			}
+			if rcode == domain.NXDOMAIN {
+				assert.Equal(t, proofSecure, d.provesNXDomain(tt.qname), "%s (nsec3=%v)", tt.name, useNSEC3)
+			} else {
+				assert.Equal(t, proofSecure, d.provesNoData(tt.qname, tt.qtype), "%s (nsec3=%v)", tt.name, useNSEC3)
+			}
+			for _, set := range groupRRsets(authority) {
+				assert.NotEmpty(t, set.sigs, "%s: %s %s is signed", tt.name, set.name, set.rrtype)
+			}
+
+			_, plain, ok := z.deny(tt.qname, tt.qtype, false)
+			assert.True(t, ok)
+			assert.Equal(t, z.soa, plain, "without DO only the SOA is returned")
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package dnssec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/common/log"
+	"github.com/haukened/rr-dns/internal/dns/common/utils"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// Error message constants for zone signing
+const (
+	errZonesRequired    = "zone cache is required"
+	errNoSigningKeys    = "no signing keys configured"
+	errValidityTooShort = "signature validity %s is shorter than the minimum of %s"
+	errKeyDir           = "failed to list signing keys: %w"
+	errKeyFile          = "signing key %s: %w"
+)
+
+const (
+	// defaultSignatureValidity is how long new signatures stay valid; they are renewed half way through.
+	defaultSignatureValidity = 14 * 24 * time.Hour
+	// minSignatureValidity keeps renewal from running constantly.
+	minSignatureValidity = time.Hour
+	// signatureInceptionSkew backdates signatures so validators with slow clocks accept them.
+	signatureInceptionSkew = time.Hour
+	// maxRefreshInterval caps how often the signer checks for signatures due for renewal.
+	maxRefreshInterval = time.Hour
+	// defaultDNSKEYTTL applies to DNSKEY records whose key file gives no TTL.
+	defaultDNSKEYTTL = 3600
+	// defaultNegativeTTL applies to NSEC and NSEC3 records of a zone without an SOA record.
+	defaultNegativeTTL = 300
+)
+
+// Signer serves authoritative zones signed online with DNSSEC. It wraps the
+// zone cache: zones loaded through PutZone that have signing keys are signed
+// before they are stored, and their signatures are renewed before they expire.
+// Zones without keys pass through unchanged.
+type Signer struct {
+	zones    resolver.ZoneCache
+	keys     map[string][]SigningKey // canonical zone -> keys
+	nsec3    bool
+	validity time.Duration
+	clock    clock.Clock
+	logger   log.Logger
+
+	mu     sync.RWMutex
+	signed map[string]*signedZone // canonical zone -> signed state
+}
+
+// SignerOptions defines configuration parameters for the zone signer.
+type SignerOptions struct {
+	// Zones stores the signed records (required).
+	Zones resolver.ZoneCache
+	// Keys are the signing keys; each signs the zone it belongs to (required).
+	Keys []SigningKey
+	// NSEC3 proves denial of existence with hashed NSEC3 records instead of NSEC,
+	// so the names of the zone cannot be listed by walking the chain.
+	NSEC3 bool
+	// Validity is how long new signatures are valid (default: 14 days, minimum: 1 hour).
+	Validity time.Duration
+	// options to inject for testing purposes
+	Clock  clock.Clock
+	Logger log.Logger
+}
+
+// NewSigner creates a zone signer with the specified options.
+// Returns an error if the zone cache or the keys are missing, or the validity is too short.
+func NewSigner(opts SignerOptions) (*Signer, error) {
+	if opts.Zones == nil {
+		return nil, errors.New(errZonesRequired)
+	}
+	if len(opts.Keys) == 0 {
+		return nil, errors.New(errNoSigningKeys)
+	}
+	if opts.Validity == 0 {
+		opts.Validity = defaultSignatureValidity
+	}
+	if opts.Validity < minSignatureValidity {
+		return nil, fmt.Errorf(errValidityTooShort, opts.Validity, minSignatureValidity)
+	}
+	if opts.Clock == nil {
+		opts.Clock = &clock.RealClock{}
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.NewNoopLogger()
+	}
+	keys := make(map[string][]SigningKey)
+	for _, k := range opts.Keys {
+		keys[k.zone] = append(keys[k.zone], k)
+	}
+	return &Signer{
+		zones:    opts.Zones,
+		keys:     keys,
+		nsec3:    opts.NSEC3,
+		validity: opts.Validity,
+		clock:    opts.Clock,
+		logger:   opts.Logger,
+		signed:   make(map[string]*signedZone),
+	}, nil
+}
+
+// FindRecords returns the records of the wrapped zone cache, signed records included.
+func (s *Signer) FindRecords(query domain.Question) ([]domain.ResourceRecord, bool) {
+	return s.zones.FindRecords(query)
+}
+
+// PutZone signs the zone if there are keys for it and stores it in the zone
+// cache. A zone that fails to sign is logged and stored unsigned, so a broken
+// key never takes the zone itself offline.
+func (s *Signer) PutZone(zoneRoot string, records []domain.ResourceRecord) {
+	root := canonicalName(zoneRoot)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := s.keys[root]
+	if len(keys) == 0 {
+		delete(s.signed, root)
+		s.zones.PutZone(zoneRoot, records)
+		return
+	}
+	z, err := signZone(root, records, keys, s.nsec3, s.validity, s.clock.Now())
+	if err != nil {
+		s.logger.Error(map[string]any{
+			"zone":  root,
+			"error": err,
+		}, "Failed to sign zone; serving it unsigned")
+		delete(s.signed, root)
+		s.zones.PutZone(zoneRoot, records)
+		return
+	}
+	s.signed[root] = z
+	s.zones.PutZone(zoneRoot, z.records)
+	s.logger.Info(map[string]any{
+		"zone":    root,
+		"keys":    len(keys),
+		"records": len(z.records),
+		"nsec3":   s.nsec3,
+		"refresh": z.refresh,
+	}, "Zone signed")
+}
+
+// RemoveZone removes a zone and its signatures.
+func (s *Signer) RemoveZone(zoneRoot string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.signed, canonicalName(zoneRoot))
+	s.zones.RemoveZone(zoneRoot)
+}
+
+// Zones returns the zone roots of the wrapped zone cache.
+func (s *Signer) Zones() []string {
+	return s.zones.Zones()
+}
+
+// Count returns the record count of the wrapped zone cache, signed records included.
+func (s *Signer) Count() int {
+	return s.zones.Count()
+}
+
+// RecordCount returns the number of records in one zone of the wrapped zone
+// cache, signed records included.
+func (s *Signer) RecordCount(zoneRoot string) int {
+	return s.zones.RecordCount(zoneRoot)
+}
+
+// Signatures returns the RRSIG records covering the RRsets of records.
+func (s *Signer) Signatures(records []domain.ResourceRecord) []domain.ResourceRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []domain.ResourceRecord
+	seen := make(map[string]bool)
+	for _, rr := range records {
+		key := rr.CacheKey()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if z, ok := s.signed[utils.GetApexDomain(canonicalName(rr.Name))]; ok {
+			out = append(out, z.sigs[key]...)
+		}
+	}
+	return out
+}
+
+// Deny answers a query for a name of a signed zone that holds no records of
+// the query type with an authenticated denial of existence.
+func (s *Signer) Deny(query domain.Question) (domain.RCode, []domain.ResourceRecord, bool) {
+	name := canonicalName(query.Name)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	z, ok := s.signed[utils.GetApexDomain(name)]
+	if !ok || !inZone(name, z.root) {
+		return 0, nil, false
+	}
+	return z.deny(name, query.Type, query.DNSSECOK)
+}
+
+// StartRefresh launches a background loop that signs zones again once their
+// signatures are half way to expiring. The loop exits when ctx is cancelled.
+func (s *Signer) StartRefresh(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(min(s.validity/8, maxRefreshInterval))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.refreshDue()
+			}
+		}
+	}()
+}
+
+// refreshDue signs again every zone whose signatures are due for renewal.
+func (s *Signer) refreshDue() {
+	now := s.clock.Now()
+	due := make(map[string][]domain.ResourceRecord)
+	s.mu.RLock()
+	for root, z := range s.signed {
+		if !now.Before(z.refresh) {
+			due[root] = z.source
+		}
+	}
+	s.mu.RUnlock()
+
+	for root, records := range due {
+		s.logger.Debug(map[string]any{"zone": root}, "Renewing zone signatures")
+		s.PutZone(root, records)
+	}
+}
+
+var (
+	_ resolver.ZoneCache  = (*Signer)(nil)
+	_ resolver.ZoneSigner = (*Signer)(nil)
+)
@@ -0,0 +1,179 @@
+package dnssec
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/repos/zonecache"
+)
+
+// signerExchanger answers queries from a Signer the way the service layer
+// does for a client that sets the DO bit.
+type signerExchanger struct {
+	s *Signer
+}
+
+func (e signerExchanger) Exchange(_ context.Context, query domain.Question, _ time.Time) (domain.DNSResponse, error) {
+	query.DNSSECOK = true
+	if records, ok := e.s.FindRecords(query); ok {
+		answers := slices.Clone(records)
+		return domain.DNSResponse{Question: query, Answers: append(answers, e.s.Signatures(records)...)}, nil
+	}
+	if rcode, authority, ok := e.s.Deny(query); ok {
+		return domain.DNSResponse{Question: query, RCode: rcode, Authority: authority}, nil
+	}
+	return domain.DNSResponse{}, errors.New("no answer")
+}
+
+func newTestZoneSigner(t *testing.T, nsec3 bool, keys ...SigningKey) (*Signer, *clock.MockClock) {
+	t.Helper()
+	clk := &clock.MockClock{CurrentTime: time.Now()}
+	s, err := NewSigner(SignerOptions{Zones: zonecache.New(), Keys: keys, NSEC3: nsec3, Validity: 24 * time.Hour, Clock: clk})
+	require.NoError(t, err)
+	return s, clk
+}
+
+func TestNewSigner(t *testing.T) {
+	key := newTestSigningKey(t, "example.test.", algED25519, flagZoneKey|flagSEP)
+	tests := []struct {
+		name    string
+		opts    SignerOptions
+		wantErr string
+	}{
+		{name: "missing zones", opts: SignerOptions{Keys: []SigningKey{key}}, wantErr: errZonesRequired},
+		{name: "missing keys", opts: SignerOptions{Zones: zonecache.New()}, wantErr: errNoSigningKeys},
+		{name: "validity too short", opts: SignerOptions{Zones: zonecache.New(), Keys: []SigningKey{key}, Validity: time.Minute}, wantErr: "shorter than the minimum"},
+		{name: "defaults", opts: SignerOptions{Zones: zonecache.New(), Keys: []SigningKey{key}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSigner(tt.opts)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, defaultSignatureValidity, s.validity)
+			assert.Len(t, s.keys["example.test"], 1)
+		})
+	}
+}
+
+func TestSigner_ValidatesEndToEnd(t *testing.T) {
+	ksk := newTestSigningKey(t, "example.test.", algECDSAP256SHA256, flagZoneKey|flagSEP)
+	zsk := newTestSigningKey(t, "example.test.", algED25519, flagZoneKey)
+
+	for _, nsec3 := range []bool{false, true} {
+		s, clk := newTestZoneSigner(t, nsec3, ksk, zsk)
+		s.PutZone("example.test.", testZone(t))
+		v, err := NewValidator(Options{Upstream: signerExchanger{s: s}, Anchors: []domain.ResourceRecord{ksk.DNSKEY()}})
+		require.NoError(t, err)
+
+		tests := []struct {
+			qname string
+			qtype domain.RRType
+			want  int
+		}{
+			{qname: "www.example.test", qtype: domain.RRTypeA, want: 2},
+			{qname: "example.test", qtype: domain.RRTypeMX, want: 1},
+			{qname: "example.test", qtype: domain.RRTypeDNSKEY, want: 2},
+			{qname: "nope.example.test", qtype: domain.RRTypeA},
+			{qname: "www.example.test", qtype: domain.RRTypeAAAA},
+			{qname: "b.example.test", qtype: domain.RRTypeTXT},
+		}
+		for _, tt := range tests {
+			q := domain.Question{Name: tt.qname, Type: tt.qtype, Class: domain.RRClassIN}
+			answer, err := v.Resolve(context.Background(), q, clk.Now())
+			records := answer.Answers
+			require.NoError(t, err, "%s %s (nsec3=%v)", tt.qname, tt.qtype, nsec3)
+			assert.Len(t, records, tt.want)
+			for _, rr := range records {
+				assert.True(t, rr.Authenticated, "%s %s", rr.Name, rr.Type)
+			}
+		}
+	}
+}
+
+func TestSigner_UnsignedZone(t *testing.T) {
+	key := newTestSigningKey(t, "example.test.", algED25519, flagZoneKey|flagSEP)
+	s, _ := newTestZoneSigner(t, false, key)
+	plain := []domain.ResourceRecord{testRR(t, "www.other.test.", domain.RRTypeA, "192.0.2.1")}
+	s.PutZone("other.test.", plain)
+
+	assert.ElementsMatch(t, []string{"other.test"}, s.Zones())
+	assert.Equal(t, 1, s.Count())
+	assert.Equal(t, 1, s.RecordCount("other.test."))
+	records, ok := s.FindRecords(domain.Question{Name: "www.other.test", Type: domain.RRTypeA, Class: domain.RRClassIN})
+	require.True(t, ok)
+	assert.Equal(t, plain, records)
+	assert.Empty(t, s.Signatures(records))
+	_, _, ok = s.Deny(domain.Question{Name: "nope.other.test", Type: domain.RRTypeA, Class: domain.RRClassIN, DNSSECOK: true})
+	assert.False(t, ok, "unsigned zones fall through to upstream")
+}
+
+func TestSigner_SigningFailure(t *testing.T) {
+	key := newTestSigningKey(t, "example.test.", algED25519, flagZoneKey|flagSEP)
+	key.sign = func([]byte) ([]byte, error) { return nil, errors.New("hsm offline") }
+	s, _ := newTestZoneSigner(t, false, key)
+	s.PutZone("example.test.", testZone(t))
+
+	records, ok := s.FindRecords(domain.Question{Name: "www.example.test", Type: domain.RRTypeA, Class: domain.RRClassIN})
+	require.True(t, ok, "the zone is still served")
+	assert.Empty(t, s.Signatures(records))
+	_, ok = s.FindRecords(domain.Question{Name: "example.test", Type: domain.RRTypeDNSKEY, Class: domain.RRClassIN})
+	assert.False(t, ok)
+}
+
+func TestSigner_RemoveZone(t *testing.T) {
+	key := newTestSigningKey(t, "example.test.", algED25519, flagZoneKey|flagSEP)
+	s, _ := newTestZoneSigner(t, false, key)
+	s.PutZone("example.test.", testZone(t))
+	q := domain.Question{Name: "nope.example.test", Type: domain.RRTypeA, Class: domain.RRClassIN}
+	_, _, ok := s.Deny(q)
+	require.True(t, ok)
+
+	s.RemoveZone("Example.Test.")
+	_, _, ok = s.Deny(q)
+	assert.False(t, ok)
+	assert.Empty(t, s.Zones())
+}
+
+func TestSigner_RefreshDue(t *testing.T) {
+	key := newTestSigningKey(t, "example.test.", algED25519, flagZoneKey|flagSEP)
+	s, clk := newTestZoneSigner(t, false, key)
+	s.PutZone("example.test.", testZone(t))
+	q := domain.Question{Name: "www.example.test", Type: domain.RRTypeA, Class: domain.RRClassIN}
+	records, _ := s.FindRecords(q)
+	first, err := parseRRSIG(s.Signatures(records)[0].Data)
+	require.NoError(t, err)
+
+	clk.Advance(6 * time.Hour)
+	s.refreshDue()
+	records, _ = s.FindRecords(q)
+	same, err := parseRRSIG(s.Signatures(records)[0].Data)
+	require.NoError(t, err)
+	assert.Equal(t, first.expiration, same.expiration, "signatures are not renewed early")
+
+	clk.Advance(6 * time.Hour)
+	s.refreshDue()
+	records, _ = s.FindRecords(q)
+	renewed, err := parseRRSIG(s.Signatures(records)[0].Data)
+	require.NoError(t, err)
+	assert.Equal(t, first.expiration+uint32((12*time.Hour).Seconds()), renewed.expiration)
+}
+
+func TestSigner_StartRefresh(t *testing.T) {
+	key := newTestSigningKey(t, "example.test.", algED25519, flagZoneKey|flagSEP)
+	s, _ := newTestZoneSigner(t, false, key)
+	ctx, cancel := context.WithCancel(context.Background())
+	s.StartRefresh(ctx)
+	cancel()
+}
@@ -0,0 +1,672 @@
+// Package dnssec validates upstream answers with DNSSEC (RFC 4033-4035, RFC 5155).
+// It wraps an upstream client that sets the DO bit, checks every RRset against
+// a chain of trust built down from configured trust anchors, and proves NSEC and
+// NSEC3 denials of existence.
+package dnssec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/common/log"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// Error message constants for consistent error handling
+const (
+	errUpstreamRequired = "upstream exchanger is required"
+	errNoTrustAnchors   = "no trust anchors configured"
+	errInvalidAnchor    = "invalid trust anchor for %q: %w"
+	errAnchorFile       = "failed to read trust anchors: %w"
+	errAnchorLine       = "trust anchor line %d: %w"
+	errBogus            = "DNSSEC validation failed for %q %s: %w"
+	errMissingSignature = "missing signature for %q %s"
+	errNoValidSignature = "no valid signature for %q %s: %w"
+	errSignerNotParent  = "signer %q is not a parent of %q"
+	errSignerOutside    = "signer %q is outside trust anchor %q"
+	errSignatureExpired = "signature by %q is not currently valid"
+	errNoMatchingKey    = "no trusted key %d of %q verifies the signature"
+	errNotAZone         = "signer %q is not a zone"
+	errNoKeyMatchesDS   = "no DNSKEY of %q matches its DS records"
+	errLookupFailed     = "%s lookup for %q failed: %w"
+	errLookupRCode      = "%s lookup for %q answered %s"
+	errMissingDenial    = "no NSEC or NSEC3 records prove the answer for %q"
+	errDenialBogus      = "NSEC or NSEC3 records do not prove the answer for %q %s"
+	errDSDenialBogus    = "NSEC or NSEC3 records do not prove the absence of DS for %q"
+	errWildcardBogus    = "wildcard answer for %q lacks a proof that the name does not exist"
+)
+
+const (
+	defaultKeyCacheSize = 1000
+	// maxZoneCacheTTL caps how long validated keys and insecure delegations are cached.
+	maxZoneCacheTTL = time.Hour
+)
+
+// Exchanger sends a query upstream and returns the whole response, including
+// the authority section and the RRSIG records that come with the DO bit.
+// *upstream.Resolver implements it when created with DNSSEC enabled.
+type Exchanger interface {
+	Exchange(ctx context.Context, query domain.Question, now time.Time) (domain.DNSResponse, error)
+}
+
+// Validator is a validating resolver: it forwards queries through an Exchanger
+// and only returns answers whose signatures chain up to a trust anchor, or that
+// lie in a zone the chain of trust proves unsigned. Answers that fail
+// validation ("bogus", RFC 4035 §4.3) become errors, which the service layer
+// turns into SERVFAIL. Records of secure answers are marked Authenticated.
+type Validator struct {
+	upstream Exchanger
+	anchors  map[string]trustAnchor // canonical zone -> anchor
+	zones    *zoneCache
+	logger   log.Logger
+}
+
+// Options defines configuration parameters for the validator.
+type Options struct {
+	// Upstream forwards queries with the DO bit set (required).
+	Upstream Exchanger
+	// Anchors are DS or DNSKEY records trusted without proof (default: RootAnchors()).
+	Anchors []domain.ResourceRecord
+	// KeyCacheSize bounds the number of zones whose keys or delegation status
+	// are cached (default: 1000).
+	KeyCacheSize int
+	// options to inject for testing purposes
+	Logger log.Logger
+}
+
+// trustAnchor holds the DS and DNSKEY records configured for one zone.
+type trustAnchor struct {
+	ds   []dsRecord
+	keys []dnskeyRecord
+}
+
+// rrset groups the records of one owner name and type with the signatures covering them.
+type rrset struct {
+	name    string
+	rrtype  domain.RRType
+	records []domain.ResourceRecord
+	sigs    []domain.ResourceRecord
+}
+
+// rrsetResult is the outcome of validating one RRset.
+type rrsetResult struct {
+	secure bool
+	signer string
+	// encloser is set when the RRset was synthesized from a wildcard: it is the
+	// name directly above the wildcard, whose non-existent children need proving.
+	encloser string
+	expanded bool
+}
+
+// NewValidator creates a validating resolver with the specified options.
+// Returns an error if the upstream is missing or a trust anchor is not a DS or DNSKEY record.
+func NewValidator(opts Options) (*Validator, error) {
+	if opts.Upstream == nil {
+		return nil, errors.New(errUpstreamRequired)
+	}
+	if len(opts.Anchors) == 0 {
+		opts.Anchors = RootAnchors()
+	}
+	if opts.KeyCacheSize <= 0 {
+		opts.KeyCacheSize = defaultKeyCacheSize
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.NewNoopLogger()
+	}
+	anchors := make(map[string]trustAnchor)
+	for _, rr := range opts.Anchors {
+		zone := canonicalName(rr.Name)
+		anchor := anchors[zone]
+		switch rr.Type {
+		case domain.RRTypeDS:
+			ds, err := parseDS(rr.Data)
+			if err != nil {
+				return nil, fmt.Errorf(errInvalidAnchor, rr.Name, err)
+			}
+			anchor.ds = append(anchor.ds, ds)
+		case domain.RRTypeDNSKEY:
+			key, err := parseDNSKEY(rr.Data)
+			if err != nil {
+				return nil, fmt.Errorf(errInvalidAnchor, rr.Name, err)
+			}
+			anchor.keys = append(anchor.keys, key)
+		default:
+			return nil, fmt.Errorf(errInvalidAnchor, rr.Name, fmt.Errorf("unsupported type %s", rr.Type))
+		}
+		anchors[zone] = anchor
+	}
+	if len(anchors) == 0 {
+		return nil, errors.New(errNoTrustAnchors)
+	}
+	return &Validator{
+		upstream: opts.Upstream,
+		anchors:  anchors,
+		zones:    newZoneCache(opts.KeyCacheSize),
+		logger:   opts.Logger,
+	}, nil
+}
+
+// Resolve forwards the query upstream and validates the response. Secure
+// answers come back with every record marked Authenticated; insecure answers
+// come back unmarked; bogus answers return an error. The RCODE is kept, and
+// of the authority section only the SOA record, for negative caching.
+func (v *Validator) Resolve(ctx context.Context, query domain.Question, now time.Time) (domain.DNSResponse, error) {
+	resp, err := v.upstream.Exchange(ctx, query, now)
+	if err != nil {
+		return domain.DNSResponse{}, err
+	}
+	secure, err := v.validate(ctx, query, resp, now)
+	if err != nil {
+		v.logger.Warn(map[string]any{
+			"query": query.Name,
+			"type":  query.Type.String(),
+			"error": err,
+		}, "DNSSEC validation failed")
+		return domain.DNSResponse{}, fmt.Errorf(errBogus, query.Name, query.Type, err)
+	}
+	answer := domain.DNSResponse{
+		ID:            resp.ID,
+		RCode:         resp.RCode,
+		Question:      resp.Question,
+		Answers:       make([]domain.ResourceRecord, 0, len(resp.Answers)),
+		AuthenticData: secure,
+	}
+	for _, rr := range resp.Answers {
+		// The client did not ask for DNSSEC records; they only served validation.
+		if isDNSSECType(rr.Type) && rr.Type != query.Type {
+			continue
+		}
+		rr.Authenticated = secure
+		answer.Answers = append(answer.Answers, rr)
+	}
+	for _, rr := range resp.Authority {
+		if rr.Type == domain.RRTypeSOA {
+			rr.Authenticated = secure
+			answer.Authority = append(answer.Authority, rr)
+		}
+	}
+	return answer, nil
+}
+
+// validate checks every answer RRset and, when the answer does not hold the
+// requested data, the denial of existence in the authority section. It
+// reports whether the whole response is secure.
+func (v *Validator) validate(ctx context.Context, query domain.Question, resp domain.DNSResponse, now time.Time) (bool, error) {
+	if resp.RCode != domain.NOERROR && resp.RCode != domain.NXDOMAIN {
+		// Nothing was answered, so there is nothing to validate.
+		return false, nil
+	}
+	name := canonicalName(query.Name)
+	secure := true
+	sets := groupRRsets(resp.Answers)
+	var wildcards []rrsetResult
+	var wildcardNames []string
+	for _, set := range sets {
+		res, err := v.verifyRRset(ctx, set, set.name, now)
+		if err != nil {
+			return false, err
+		}
+		secure = secure && res.secure
+		if res.expanded && res.secure {
+			wildcards = append(wildcards, res)
+			wildcardNames = append(wildcardNames, set.name)
+		}
+	}
+
+	final := followCNAMEs(name, query.Type, sets)
+	// RRSIG records are attached to the sets they cover, so an RRSIG query is
+	// answered by any signed set, just like an ANY query.
+	answered := (query.Type == domain.RRTypeANY || query.Type == domain.RRTypeRRSIG) && len(sets) > 0
+	for _, set := range sets {
+		if set.name == final && set.rrtype == query.Type {
+			answered = true
+		}
+	}
+	if answered && len(wildcards) == 0 {
+		return secure, nil
+	}
+
+	d, proven, err := v.verifyDenial(ctx, resp.Authority, final, now)
+	if err != nil {
+		return false, err
+	}
+	if !proven {
+		return false, nil
+	}
+	for i, w := range wildcards {
+		switch d.provesWildcard(wildcardNames[i], w.encloser) {
+		case proofBogus:
+			return false, fmt.Errorf(errWildcardBogus, wildcardNames[i])
+		case proofInsecure:
+			secure = false
+		}
+	}
+	if answered {
+		return secure, nil
+	}
+	result := d.provesNoData(final, query.Type)
+	if resp.RCode == domain.NXDOMAIN {
+		result = d.provesNXDomain(final)
+	}
+	switch result {
+	case proofBogus:
+		return false, fmt.Errorf(errDenialBogus, final, query.Type)
+	case proofInsecure:
+		secure = false
+	}
+	return secure, nil
+}
+
+// verifyRRset validates one RRset. A signature is accepted when its signer is
+// the owner or an ancestor inside the same trust anchor, it is currently
+// valid, and a trusted key of the signer verifies it. An unsigned RRset is
+// only accepted when the chain of trust proves statusName lies in an unsigned zone.
+func (v *Validator) verifyRRset(ctx context.Context, set *rrset, statusName string, now time.Time) (rrsetResult, error) {
+	if len(set.sigs) == 0 {
+		insecure, err := v.insecure(ctx, statusName, now)
+		if err != nil {
+			return rrsetResult{}, err
+		}
+		if !insecure {
+			return rrsetResult{}, fmt.Errorf(errMissingSignature, set.name, set.rrtype)
+		}
+		return rrsetResult{}, nil
+	}
+	anchor, anchored := v.closestAnchor(set.name)
+	lastErr := errors.New("no usable signature")
+	for _, sigRR := range set.sigs {
+		sig, err := parseRRSIG(sigRR.Data)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		switch {
+		case !inZone(set.name, sig.signer),
+			set.rrtype == domain.RRTypeDS && set.name == sig.signer:
+			// DS records live in the parent zone, so the child cannot sign them.
+			lastErr = fmt.Errorf(errSignerNotParent, sig.signer, set.name)
+			continue
+		case anchored && !inZone(sig.signer, anchor):
+			lastErr = fmt.Errorf(errSignerOutside, sig.signer, anchor)
+			continue
+		case !supportedAlgorithm(sig.algorithm):
+			lastErr = fmt.Errorf("unsupported algorithm %d", sig.algorithm)
+			continue
+		case !signatureCurrent(sig, now):
+			lastErr = fmt.Errorf(errSignatureExpired, sig.signer)
+			continue
+		}
+		entry, err := v.zone(ctx, sig.signer, now)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		switch entry.state {
+		case zoneInsecure:
+			return rrsetResult{signer: sig.signer}, nil
+		case zoneNoCut:
+			lastErr = fmt.Errorf(errNotAZone, sig.signer)
+			continue
+		}
+		if err := verifyWithKeys(entry.keys, sig, set.records); err != nil {
+			lastErr = err
+			continue
+		}
+		res := rrsetResult{secure: true, signer: sig.signer}
+		if labels := labelCount(set.name); int(sig.labels) < labels {
+			res.expanded = true
+			res.encloser = trimLabels(set.name, labels-int(sig.labels))
+		}
+		return res, nil
+	}
+	return rrsetResult{}, fmt.Errorf(errNoValidSignature, set.name, set.rrtype, lastErr)
+}
+
+// verifyWithKeys checks sig over records with each key whose tag and algorithm match.
+func verifyWithKeys(keys []dnskeyRecord, sig rrsigRecord, records []domain.ResourceRecord) error {
+	for _, key := range keys {
+		if key.algorithm != sig.algorithm || keyTag(key.rdata) != sig.keyTag {
+			continue
+		}
+		if verifySignature(key, sig, records) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf(errNoMatchingKey, sig.keyTag, sig.signer)
+}
+
+// verifyDenial validates the NSEC and NSEC3 RRsets of an authority section and
+// collects them for proofs. proven is false when the records lie in an unsigned
+// zone, in which case nothing can be proven and nothing needs to be.
+func (v *Validator) verifyDenial(ctx context.Context, authority []domain.ResourceRecord, statusName string, now time.Time) (*denial, bool, error) {
+	d := &denial{}
+	found := false
+	for _, set := range groupRRsets(authority) {
+		if set.rrtype != domain.RRTypeNSEC && set.rrtype != domain.RRTypeNSEC3 {
+			continue
+		}
+		found = true
+		res, err := v.verifyRRset(ctx, set, statusName, now)
+		if err != nil {
+			return nil, false, err
+		}
+		if !res.secure {
+			return nil, false, nil
+		}
+		for _, rr := range set.records {
+			if set.rrtype == domain.RRTypeNSEC {
+				n, err := parseNSEC(res.signer, set.name, rr.Data)
+				if err != nil {
+					return nil, false, err
+				}
+				d.nsec = append(d.nsec, n)
+				continue
+			}
+			n, err := parseNSEC3(set.name, rr.Data)
+			if err != nil {
+				return nil, false, err
+			}
+			d.zone = res.signer
+			d.unusable = d.unusable || !usableNSEC3(n.params)
+			d.nsec3 = append(d.nsec3, n)
+		}
+	}
+	if found {
+		return d, true, nil
+	}
+	insecure, err := v.insecure(ctx, statusName, now)
+	if err != nil {
+		return nil, false, err
+	}
+	if !insecure {
+		return nil, false, fmt.Errorf(errMissingDenial, statusName)
+	}
+	return nil, false, nil
+}
+
+// insecure reports whether name lies in an unsigned zone: outside every trust
+// anchor, or below a delegation the chain of trust proves has no DS records.
+func (v *Validator) insecure(ctx context.Context, name string, now time.Time) (bool, error) {
+	anchor, ok := v.closestAnchor(name)
+	if !ok {
+		return true, nil
+	}
+	for current := anchor; current != name; {
+		current = childOf(current, name)
+		entry, err := v.zone(ctx, current, now)
+		if err != nil {
+			return false, err
+		}
+		if entry.state == zoneInsecure {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// zone follows the chain of trust to name: for a trust anchor, its keys are
+// validated against the anchor; below one, the parent's DS RRset decides.
+func (v *Validator) zone(ctx context.Context, name string, now time.Time) (zoneEntry, error) {
+	if entry, ok := v.zones.get(name, now); ok {
+		return entry, nil
+	}
+	anchor, ok := v.closestAnchor(name)
+	if !ok {
+		return zoneEntry{state: zoneInsecure}, nil
+	}
+	var entry zoneEntry
+	var ttl time.Duration
+	var err error
+	if name == anchor {
+		a := v.anchors[anchor]
+		entry, ttl, err = v.fetchKeys(ctx, name, a.ds, a.keys, now)
+	} else {
+		entry, ttl, err = v.delegation(ctx, name, now)
+	}
+	if err != nil {
+		return zoneEntry{}, err
+	}
+	v.zones.put(name, entry, min(ttl, maxZoneCacheTTL), now)
+	return entry, nil
+}
+
+// delegation asks the parent side about name (RFC 4035 §5.2): a validated DS
+// RRset makes it a signed zone, while a proven absence of DS makes it either
+// an unsigned delegation or not a delegation at all.
+func (v *Validator) delegation(ctx context.Context, name string, now time.Time) (zoneEntry, time.Duration, error) {
+	resp, err := v.lookup(ctx, name, domain.RRTypeDS, now)
+	if err != nil {
+		return zoneEntry{}, 0, err
+	}
+	parent := parentName(name)
+	for _, set := range groupRRsets(resp.Answers) {
+		if set.name != name || set.rrtype != domain.RRTypeDS {
+			continue
+		}
+		res, err := v.verifyRRset(ctx, set, parent, now)
+		if err != nil {
+			return zoneEntry{}, 0, err
+		}
+		if !res.secure {
+			return zoneEntry{state: zoneInsecure}, minTTL(set.records, now), nil
+		}
+		var ds []dsRecord
+		for _, rr := range set.records {
+			d, err := parseDS(rr.Data)
+			if err == nil && supportedAlgorithm(d.algorithm) && supportedDigest(d.digestType) {
+				ds = append(ds, d)
+			}
+		}
+		// A zone signed only with algorithms we cannot check is treated as unsigned (RFC 4035 §5.2).
+		if len(ds) == 0 {
+			return zoneEntry{state: zoneInsecure}, minTTL(set.records, now), nil
+		}
+		entry, ttl, err := v.fetchKeys(ctx, name, ds, nil, now)
+		return entry, min(ttl, minTTL(set.records, now)), err
+	}
+
+	d, proven, err := v.verifyDenial(ctx, resp.Authority, parent, now)
+	if err != nil {
+		return zoneEntry{}, 0, err
+	}
+	ttl := minTTL(resp.Authority, now)
+	if !proven {
+		return zoneEntry{state: zoneInsecure}, ttl, nil
+	}
+	if types, ok := d.nameExists(name); ok {
+		switch {
+		case types[domain.RRTypeDS]:
+			return zoneEntry{}, 0, fmt.Errorf(errDSDenialBogus, name)
+		case types[domain.RRTypeNS] && !types[domain.RRTypeSOA]:
+			return zoneEntry{state: zoneInsecure}, ttl, nil
+		}
+		return zoneEntry{state: zoneNoCut}, ttl, nil
+	}
+	switch _, result := d.nameError(name); result {
+	case proofSecure:
+		return zoneEntry{state: zoneNoCut}, ttl, nil
+	case proofInsecure:
+		// An opt-out span may hide an unsigned delegation (RFC 5155 §6).
+		return zoneEntry{state: zoneInsecure}, ttl, nil
+	}
+	return zoneEntry{}, 0, fmt.Errorf(errDSDenialBogus, name)
+}
+
+// fetchKeys looks up the DNSKEY RRset of zone and validates it: some key must
+// match one of the DS records or trusted keys and sign the whole RRset. All
+// zone keys in a validated RRset are then trusted (RFC 4035 §5.2).
+func (v *Validator) fetchKeys(ctx context.Context, zone string, ds []dsRecord, trusted []dnskeyRecord, now time.Time) (zoneEntry, time.Duration, error) {
+	resp, err := v.lookup(ctx, zone, domain.RRTypeDNSKEY, now)
+	if err != nil {
+		return zoneEntry{}, 0, err
+	}
+	var set *rrset
+	for _, s := range groupRRsets(resp.Answers) {
+		if s.name == zone && s.rrtype == domain.RRTypeDNSKEY {
+			set = s
+		}
+	}
+	if set == nil {
+		return zoneEntry{}, 0, fmt.Errorf(errNoKeyMatchesDS, zone)
+	}
+
+	var keys, entryPoints []dnskeyRecord
+	for _, rr := range set.records {
+		key, err := parseDNSKEY(rr.Data)
+		if err != nil || key.protocol != 3 || key.flags&flagZoneKey == 0 {
+			continue
+		}
+		keys = append(keys, key)
+		if key.flags&flagRevoke == 0 && (matchesAnyDS(ds, zone, key) || matchesAnyKey(trusted, key)) {
+			entryPoints = append(entryPoints, key)
+		}
+	}
+	if len(entryPoints) == 0 {
+		return zoneEntry{}, 0, fmt.Errorf(errNoKeyMatchesDS, zone)
+	}
+
+	lastErr := fmt.Errorf(errMissingSignature, zone, domain.RRTypeDNSKEY)
+	for _, sigRR := range set.sigs {
+		sig, err := parseRRSIG(sigRR.Data)
+		if err != nil || sig.signer != zone {
+			continue
+		}
+		if !signatureCurrent(sig, now) {
+			lastErr = fmt.Errorf(errSignatureExpired, sig.signer)
+			continue
+		}
+		if err := verifyWithKeys(entryPoints, sig, set.records); err != nil {
+			lastErr = err
+			continue
+		}
+		return zoneEntry{state: zoneSecure, keys: keys}, minTTL(set.records, now), nil
+	}
+	return zoneEntry{}, 0, fmt.Errorf(errNoValidSignature, zone, domain.RRTypeDNSKEY, lastErr)
+}
+
+// lookup sends a DS or DNSKEY query needed to build the chain of trust.
+func (v *Validator) lookup(ctx context.Context, name string, rrtype domain.RRType, now time.Time) (domain.DNSResponse, error) {
+	qname := name
+	if qname == "" {
+		qname = domain.RootName
+	}
+	query := domain.Question{Name: qname, Type: rrtype, Class: domain.RRClassIN}
+	resp, err := v.upstream.Exchange(ctx, query, now)
+	if err != nil {
+		return domain.DNSResponse{}, fmt.Errorf(errLookupFailed, rrtype, qname, err)
+	}
+	if resp.RCode != domain.NOERROR && resp.RCode != domain.NXDOMAIN {
+		return domain.DNSResponse{}, fmt.Errorf(errLookupRCode, rrtype, qname, resp.RCode)
+	}
+	v.logger.Debug(map[string]any{
+		"name": qname,
+		"type": rrtype.String(),
+	}, "Fetched DNSSEC chain of trust records")
+	return resp, nil
+}
+
+// closestAnchor returns the deepest trust anchor zone enclosing name.
+func (v *Validator) closestAnchor(name string) (string, bool) {
+	for zone := name; ; zone = parentName(zone) {
+		if _, ok := v.anchors[zone]; ok {
+			return zone, true
+		}
+		if zone == "" {
+			return "", false
+		}
+	}
+}
+
+// matchesAnyDS reports whether any DS record commits to key.
+func matchesAnyDS(ds []dsRecord, zone string, key dnskeyRecord) bool {
+	for _, d := range ds {
+		if dsMatches(d, zone, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAnyKey reports whether key is one of the trusted keys.
+func matchesAnyKey(trusted []dnskeyRecord, key dnskeyRecord) bool {
+	for _, t := range trusted {
+		if t.algorithm == key.algorithm && string(t.publicKey) == string(key.publicKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// groupRRsets splits records into RRsets in order of first appearance and
+// attaches each RRSIG to the RRset of the type it covers.
+func groupRRsets(records []domain.ResourceRecord) []*rrset {
+	var sets []*rrset
+	index := make(map[string]*rrset)
+	get := func(name string, rrtype domain.RRType) *rrset {
+		key := domain.GenerateCacheKey(name, rrtype, domain.RRClassIN)
+		set, ok := index[key]
+		if !ok {
+			set = &rrset{name: name, rrtype: rrtype}
+			index[key] = set
+			sets = append(sets, set)
+		}
+		return set
+	}
+	for _, rr := range records {
+		name := canonicalName(rr.Name)
+		if rr.Type != domain.RRTypeRRSIG {
+			set := get(name, rr.Type)
+			set.records = append(set.records, rr)
+		}
+	}
+	for _, rr := range records {
+		if rr.Type != domain.RRTypeRRSIG || len(rr.Data) < 2 {
+			continue
+		}
+		covered := domain.RRType(uint16(rr.Data[0])<<8 | uint16(rr.Data[1]))
+		if set, ok := index[domain.GenerateCacheKey(canonicalName(rr.Name), covered, domain.RRClassIN)]; ok {
+			set.sigs = append(set.sigs, rr)
+		}
+	}
+	return sets
+}
+
+// followCNAMEs follows the CNAME chain in sets from name and returns the name
+// the answer ends at. A CNAME query stops at the first name.
+func followCNAMEs(name string, qtype domain.RRType, sets []*rrset) string {
+	if qtype == domain.RRTypeCNAME {
+		return name
+	}
+	for range len(sets) {
+		next := ""
+		for _, set := range sets {
+			if set.name == name && set.rrtype == domain.RRTypeCNAME && len(set.records) > 0 {
+				next = canonicalName(set.records[0].Text)
+			}
+		}
+		if next == "" {
+			break
+		}
+		name = next
+	}
+	return name
+}
+
+// minTTL returns the smallest TTL remaining at now among records.
+func minTTL(records []domain.ResourceRecord, now time.Time) time.Duration {
+	ttl := maxZoneCacheTTL
+	for _, rr := range records {
+		ttl = min(ttl, rr.TTLRemaining(now))
+	}
+	return ttl
+}
+
+// isDNSSECType reports whether rrtype only exists to support validation.
+func isDNSSECType(rrtype domain.RRType) bool {
+	return rrtype == domain.RRTypeRRSIG || rrtype == domain.RRTypeNSEC || rrtype == domain.RRTypeNSEC3
+}
+
+var _ resolver.UpstreamClient = (*Validator)(nil)
@@ -0,0 +1,604 @@
+package dnssec
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/common/log"
+	"github.com/haukened/rr-dns/internal/dns/common/rrdata"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// testRR builds a resource record from its presentation form.
+func testRR(t *testing.T, name string, rrtype domain.RRType, text string) domain.ResourceRecord {
+	t.Helper()
+	data, err := rrdata.Encode(rrtype, text)
+	require.NoError(t, err)
+	rr, err := domain.NewAuthoritativeResourceRecord(name, rrtype, domain.RRClassIN, 300, data, text)
+	require.NoError(t, err)
+	return rr
+}
+
+// testSigner holds the single combined signing key of a locally signed test zone.
+type testSigner struct {
+	zone   string
+	alg    uint8
+	dnskey domain.ResourceRecord
+	key    dnskeyRecord
+	sign   func(t *testing.T, data []byte) []byte
+}
+
+// newTestSigner generates a key for zone with the given algorithm.
+func newTestSigner(t *testing.T, zone string, alg uint8) *testSigner {
+	t.Helper()
+	var public []byte
+	var sign func(t *testing.T, data []byte) []byte
+	switch alg {
+	case algED25519:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		public = pub
+		sign = func(_ *testing.T, data []byte) []byte { return ed25519.Sign(priv, data) }
+	case algECDSAP256SHA256:
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		public = append(priv.X.FillBytes(make([]byte, 32)), priv.Y.FillBytes(make([]byte, 32))...)
+		sign = func(t *testing.T, data []byte) []byte {
+			digest := sha256.Sum256(data)
+			r, s, err := ecdsa.Sign(rand.Reader, priv, digest[:])
+			require.NoError(t, err)
+			return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+		}
+	case algRSASHA256:
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		public = []byte{3, 1, 0, 1} // exponent 65537
+		public = append(public, priv.N.Bytes()...)
+		sign = func(t *testing.T, data []byte) []byte {
+			digest := sha256.Sum256(data)
+			sig, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, digest[:])
+			require.NoError(t, err)
+			return sig
+		}
+	default:
+		t.Fatalf("unsupported test algorithm %d", alg)
+	}
+	rdata := binary.BigEndian.AppendUint16(nil, flagZoneKey|flagSEP)
+	rdata = append(rdata, 3, alg)
+	rdata = append(rdata, public...)
+	dnskey, err := domain.NewAuthoritativeResourceRecord(zone, domain.RRTypeDNSKEY, domain.RRClassIN, 3600, rdata, "")
+	require.NoError(t, err)
+	key, err := parseDNSKEY(rdata)
+	require.NoError(t, err)
+	return &testSigner{zone: canonicalName(zone), alg: alg, dnskey: dnskey, key: key, sign: sign}
+}
+
+// ds returns the SHA-256 DS record of the signer's key.
+func (s *testSigner) ds(t *testing.T) domain.ResourceRecord {
+	t.Helper()
+	digest, ok := dsDigest(digestSHA256, s.zone, s.key.rdata)
+	require.True(t, ok)
+	data := binary.BigEndian.AppendUint16(nil, keyTag(s.key.rdata))
+	data = append(data, s.alg, digestSHA256)
+	data = append(data, digest...)
+	rr, err := domain.NewAuthoritativeResourceRecord(s.dnskey.Name, domain.RRTypeDS, domain.RRClassIN, 3600, data, "")
+	require.NoError(t, err)
+	return rr
+}
+
+// rrsig signs records, valid from an hour before now until an hour after.
+func (s *testSigner) rrsig(t *testing.T, records []domain.ResourceRecord, now time.Time) domain.ResourceRecord {
+	t.Helper()
+	return s.rrsigValid(t, records, now.Add(-time.Hour), now.Add(time.Hour))
+}
+
+// rrsigValid signs records with the given validity period. A record set owned
+// by a wildcard is signed with the label count of the wildcard.
+func (s *testSigner) rrsigValid(t *testing.T, records []domain.ResourceRecord, inception, expiration time.Time) domain.ResourceRecord {
+	t.Helper()
+	owner := canonicalName(records[0].Name)
+	rdata := binary.BigEndian.AppendUint16(nil, uint16(records[0].Type))
+	rdata = append(rdata, s.alg, byte(labelCount(owner)))
+	rdata = binary.BigEndian.AppendUint32(rdata, 300)
+	rdata = binary.BigEndian.AppendUint32(rdata, uint32(expiration.Unix()))
+	rdata = binary.BigEndian.AppendUint32(rdata, uint32(inception.Unix()))
+	rdata = binary.BigEndian.AppendUint16(rdata, keyTag(s.key.rdata))
+	rdata = append(rdata, nameWire(s.zone)...)
+	sig, err := parseRRSIG(append(rdata, 0))
+	require.NoError(t, err)
+	data, err := signedData(sig, records)
+	require.NoError(t, err)
+	rdata = append(rdata, s.sign(t, data)...)
+	rr, err := domain.NewAuthoritativeResourceRecord(records[0].Name, domain.RRTypeRRSIG, domain.RRClassIN, 300, rdata, "")
+	require.NoError(t, err)
+	return rr
+}
+
+// signed returns records followed by their signature.
+func (s *testSigner) signed(t *testing.T, now time.Time, records ...domain.ResourceRecord) []domain.ResourceRecord {
+	t.Helper()
+	return append(records, s.rrsig(t, records, now))
+}
+
+// expand renames wildcard records to name, as a server answering from a wildcard does.
+func expand(records []domain.ResourceRecord, name string) []domain.ResourceRecord {
+	out := make([]domain.ResourceRecord, len(records))
+	for i, rr := range records {
+		rr.Name = name
+		out[i] = rr
+	}
+	return out
+}
+
+// nsec3Owner returns the NSEC3 owner name standing for name in zone, with
+// the default test parameters (SHA-1, no extra iterations, no salt).
+func nsec3Owner(name, zone string) string {
+	return strings.ToLower(base32Hex.EncodeToString(nsec3Hash(nsec3Params{algorithm: nsec3HashSHA1}, name))) + "." + zone
+}
+
+// testUpstream is an in-memory Exchanger serving fixed responses.
+type testUpstream struct {
+	mu        sync.Mutex
+	responses map[string]domain.DNSResponse
+	queries   []string
+}
+
+func newTestUpstream() *testUpstream {
+	return &testUpstream{responses: make(map[string]domain.DNSResponse)}
+}
+
+func (u *testUpstream) set(name string, rrtype domain.RRType, rcode domain.RCode, answers, authority []domain.ResourceRecord) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.responses[canonicalName(name)+" "+rrtype.String()] = domain.DNSResponse{RCode: rcode, Answers: answers, Authority: authority}
+}
+
+func (u *testUpstream) Exchange(_ context.Context, query domain.Question, _ time.Time) (domain.DNSResponse, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	key := canonicalName(query.Name) + " " + query.Type.String()
+	u.queries = append(u.queries, key)
+	resp, ok := u.responses[key]
+	if !ok {
+		return domain.DNSResponse{}, fmt.Errorf("no response for %s", key)
+	}
+	return resp, nil
+}
+
+func (u *testUpstream) count(key string) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	n := 0
+	for _, q := range u.queries {
+		if q == key {
+			n++
+		}
+	}
+	return n
+}
+
+// testTree is a locally signed hierarchy below the trust anchor "test.":
+// example.test. is a signed delegation and insecure.test. an unsigned one.
+type testTree struct {
+	upstream *testUpstream
+	root     *testSigner
+	example  *testSigner
+	anchors  []domain.ResourceRecord
+}
+
+func newTestTree(t *testing.T, alg uint8, now time.Time) *testTree {
+	t.Helper()
+	root := newTestSigner(t, "test.", alg)
+	example := newTestSigner(t, "example.test.", alg)
+	u := newTestUpstream()
+	u.set("test.", domain.RRTypeDNSKEY, domain.NOERROR, root.signed(t, now, root.dnskey), nil)
+	u.set("example.test.", domain.RRTypeDS, domain.NOERROR, root.signed(t, now, example.ds(t)), nil)
+	u.set("example.test.", domain.RRTypeDNSKEY, domain.NOERROR, example.signed(t, now, example.dnskey), nil)
+	u.set("insecure.test.", domain.RRTypeDS, domain.NOERROR, nil,
+		root.signed(t, now, testRR(t, "insecure.test.", domain.RRTypeNSEC, "zzz.test. NS RRSIG NSEC")))
+	return &testTree{upstream: u, root: root, example: example, anchors: []domain.ResourceRecord{root.ds(t)}}
+}
+
+func (tt *testTree) validator(t *testing.T) *Validator {
+	t.Helper()
+	v, err := NewValidator(Options{Upstream: tt.upstream, Anchors: tt.anchors, Logger: log.NewNoopLogger()})
+	require.NoError(t, err)
+	return v
+}
+
+func TestNewValidator(t *testing.T) {
+	ds := testRR(t, "test.", domain.RRTypeDS, "12345 13 2 0B8F7D5A9DB7E25A9C7F9A4A1D4C4B5E6F708192A3B4C5D6E7F8091A2B3C4D5E")
+	key := testRR(t, "test.", domain.RRTypeDNSKEY, "257 3 15 l02Woi0iS8Aa25FQkUd9RMzZHJpBoRQwAQEX1SxZJA4=")
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr string
+	}{
+		{name: "missing upstream", opts: Options{}, wantErr: errUpstreamRequired},
+		{name: "default root anchors", opts: Options{Upstream: newTestUpstream()}},
+		{name: "ds and dnskey anchors", opts: Options{Upstream: newTestUpstream(), Anchors: []domain.ResourceRecord{ds, key}}},
+		{
+			name:    "anchor of wrong type",
+			opts:    Options{Upstream: newTestUpstream(), Anchors: []domain.ResourceRecord{testRR(t, "test.", domain.RRTypeA, "192.0.2.1")}},
+			wantErr: "invalid trust anchor",
+		},
+		{
+			name: "truncated ds anchor",
+			opts: Options{Upstream: newTestUpstream(), Anchors: []domain.ResourceRecord{{
+				Name: "test", Type: domain.RRTypeDS, Class: domain.RRClassIN, Data: []byte{1, 2},
+			}}},
+			wantErr: "invalid trust anchor",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewValidator(tt.opts)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotEmpty(t, v.anchors)
+		})
+	}
+}
+
+func TestValidator_Resolve_Algorithms(t *testing.T) {
+	for _, alg := range []uint8{algED25519, algECDSAP256SHA256, algRSASHA256} {
+		t.Run(fmt.Sprintf("algorithm %d", alg), func(t *testing.T) {
+			now := time.Now()
+			tree := newTestTree(t, alg, now)
+			a := testRR(t, "www.example.test.", domain.RRTypeA, "192.0.2.1")
+			tree.upstream.set("www.example.test.", domain.RRTypeA, domain.NOERROR, tree.example.signed(t, now, a), nil)
+
+			answer, err := tree.validator(t).Resolve(context.Background(), domain.Question{Name: "www.example.test.", Type: domain.RRTypeA, Class: domain.RRClassIN}, now)
+			records := answer.Answers
+			require.NoError(t, err)
+			require.Len(t, records, 1, "RRSIG records are stripped")
+			assert.Equal(t, domain.RRTypeA, records[0].Type)
+			assert.True(t, records[0].Authenticated)
+		})
+	}
+}
+
+func TestValidator_Resolve(t *testing.T) {
+	now := time.Now()
+	tree := newTestTree(t, algED25519, now)
+	ex := tree.example
+
+	www := testRR(t, "www.example.test.", domain.RRTypeA, "192.0.2.1")
+	tampered := www
+	tampered.Data = []byte{192, 0, 2, 66}
+	wildcard := testRR(t, "*.example.test.", domain.RRTypeA, "192.0.2.7")
+	wildcardSig := ex.rrsig(t, []domain.ResourceRecord{wildcard}, now)
+	cname := testRR(t, "alias.example.test.", domain.RRTypeCNAME, "www.example.test.")
+	apexNSEC := testRR(t, "example.test.", domain.RRTypeNSEC, "www.example.test. NS SOA RRSIG NSEC DNSKEY")
+	wwwNSEC := testRR(t, "www.example.test.", domain.RRTypeNSEC, "example.test. A RRSIG NSEC")
+	starNSEC := testRR(t, "*.example.test.", domain.RRTypeNSEC, "www.example.test. A RRSIG NSEC")
+	apexNSEC3 := testRR(t, nsec3Owner("example.test", "example.test."), domain.RRTypeNSEC3,
+		"1 0 0 - "+nsec3Owner("example.test", "example.test.")[:32]+" NS SOA RRSIG DNSKEY NSEC3PARAM")
+	wwwNSEC3 := testRR(t, nsec3Owner("www.example.test", "example.test."), domain.RRTypeNSEC3,
+		"1 0 0 - "+nsec3Owner("www.example.test", "example.test.")[:32]+" A RRSIG")
+
+	tests := []struct {
+		name          string
+		query         domain.Question
+		rcode         domain.RCode
+		answers       []domain.ResourceRecord
+		authority     []domain.ResourceRecord
+		wantErr       bool
+		wantTypes     []domain.RRType
+		authenticated bool
+	}{
+		{
+			name:          "secure answer",
+			query:         domain.Question{Name: "www.example.test.", Type: domain.RRTypeA},
+			answers:       ex.signed(t, now, www),
+			wantTypes:     []domain.RRType{domain.RRTypeA},
+			authenticated: true,
+		},
+		{
+			name:    "tampered answer is bogus",
+			query:   domain.Question{Name: "www.example.test.", Type: domain.RRTypeA},
+			answers: []domain.ResourceRecord{tampered, ex.rrsig(t, []domain.ResourceRecord{www}, now)},
+			wantErr: true,
+		},
+		{
+			name:    "expired signature is bogus",
+			query:   domain.Question{Name: "www.example.test.", Type: domain.RRTypeA},
+			answers: []domain.ResourceRecord{www, ex.rrsigValid(t, []domain.ResourceRecord{www}, now.Add(-2*time.Hour), now.Add(-time.Hour))},
+			wantErr: true,
+		},
+		{
+			name:    "missing signature in a signed zone is bogus",
+			query:   domain.Question{Name: "www.example.test.", Type: domain.RRTypeA},
+			answers: []domain.ResourceRecord{www},
+			wantErr: true,
+		},
+		{
+			name:    "signature by a sibling zone is bogus",
+			query:   domain.Question{Name: "www.example.test.", Type: domain.RRTypeA},
+			answers: []domain.ResourceRecord{www, newTestSigner(t, "other.test.", algED25519).rrsig(t, []domain.ResourceRecord{www}, now)},
+			wantErr: true,
+		},
+		{
+			name:      "unsigned answer below an insecure delegation",
+			query:     domain.Question{Name: "www.insecure.test.", Type: domain.RRTypeA},
+			answers:   []domain.ResourceRecord{testRR(t, "www.insecure.test.", domain.RRTypeA, "192.0.2.2")},
+			wantTypes: []domain.RRType{domain.RRTypeA},
+		},
+		{
+			name:      "unsigned answer outside the trust anchor",
+			query:     domain.Question{Name: "www.elsewhere.", Type: domain.RRTypeA},
+			answers:   []domain.ResourceRecord{testRR(t, "www.elsewhere.", domain.RRTypeA, "192.0.2.3")},
+			wantTypes: []domain.RRType{domain.RRTypeA},
+		},
+		{
+			name:          "secure cname chain",
+			query:         domain.Question{Name: "alias.example.test.", Type: domain.RRTypeA},
+			answers:       append(ex.signed(t, now, cname), ex.signed(t, now, www)...),
+			wantTypes:     []domain.RRType{domain.RRTypeCNAME, domain.RRTypeA},
+			authenticated: true,
+		},
+		{
+			name:          "rrsig kept when asked for",
+			query:         domain.Question{Name: "www.example.test.", Type: domain.RRTypeRRSIG},
+			answers:       ex.signed(t, now, www),
+			wantTypes:     []domain.RRType{domain.RRTypeA, domain.RRTypeRRSIG},
+			authenticated: true,
+		},
+		{
+			name:      "nsec nxdomain",
+			query:     domain.Question{Name: "nope.example.test.", Type: domain.RRTypeA},
+			rcode:     domain.NXDOMAIN,
+			authority: ex.signed(t, now, apexNSEC),
+		},
+		{
+			name:      "nxdomain without proof is bogus",
+			query:     domain.Question{Name: "nope.example.test.", Type: domain.RRTypeA},
+			rcode:     domain.NXDOMAIN,
+			authority: nil,
+			wantErr:   true,
+		},
+		{
+			name:      "nxdomain with a proof for another name is bogus",
+			query:     domain.Question{Name: "zzz.example.test.", Type: domain.RRTypeA},
+			rcode:     domain.NXDOMAIN,
+			authority: ex.signed(t, now, apexNSEC),
+			wantErr:   true,
+		},
+		{
+			name:      "nsec nodata",
+			query:     domain.Question{Name: "www.example.test.", Type: domain.RRTypeAAAA},
+			authority: ex.signed(t, now, wwwNSEC),
+		},
+		{
+			name:      "nodata denying an existing type is bogus",
+			query:     domain.Question{Name: "www.example.test.", Type: domain.RRTypeA},
+			authority: ex.signed(t, now, wwwNSEC),
+			wantErr:   true,
+		},
+		{
+			name:      "nsec3 nxdomain",
+			query:     domain.Question{Name: "nope.example.test.", Type: domain.RRTypeA},
+			rcode:     domain.NXDOMAIN,
+			authority: ex.signed(t, now, apexNSEC3),
+		},
+		{
+			name:      "nsec3 nodata",
+			query:     domain.Question{Name: "www.example.test.", Type: domain.RRTypeAAAA},
+			authority: ex.signed(t, now, wwwNSEC3),
+		},
+		{
+			name:      "nsec3 nodata denying an existing type is bogus",
+			query:     domain.Question{Name: "www.example.test.", Type: domain.RRTypeA},
+			authority: ex.signed(t, now, wwwNSEC3),
+			wantErr:   true,
+		},
+		{
+			name:          "wildcard answer with proof",
+			query:         domain.Question{Name: "foo.example.test.", Type: domain.RRTypeA},
+			answers:       expand([]domain.ResourceRecord{wildcard, wildcardSig}, "foo.example.test."),
+			authority:     ex.signed(t, now, starNSEC),
+			wantTypes:     []domain.RRType{domain.RRTypeA},
+			authenticated: true,
+		},
+		{
+			name:    "wildcard answer without proof is bogus",
+			query:   domain.Question{Name: "foo.example.test.", Type: domain.RRTypeA},
+			answers: expand([]domain.ResourceRecord{wildcard, wildcardSig}, "foo.example.test."),
+			wantErr: true,
+		},
+		{
+			name:  "servfail passes through",
+			query: domain.Question{Name: "www.example.test.", Type: domain.RRTypeA},
+			rcode: domain.SERVFAIL,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.query.Class = domain.RRClassIN
+			tree.upstream.set(tc.query.Name, tc.query.Type, tc.rcode, tc.answers, tc.authority)
+			answer, err := tree.validator(t).Resolve(context.Background(), tc.query, now)
+			records := answer.Answers
+			if tc.wantErr {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), "DNSSEC validation failed")
+				return
+			}
+			require.NoError(t, err)
+			var types []domain.RRType
+			for _, rr := range records {
+				types = append(types, rr.Type)
+				assert.Equal(t, tc.authenticated, rr.Authenticated)
+			}
+			assert.Equal(t, tc.wantTypes, types)
+		})
+	}
+}
+
+func TestValidator_Resolve_ChainOfTrust(t *testing.T) {
+	now := time.Now()
+	query := domain.Question{Name: "www.example.test.", Type: domain.RRTypeA, Class: domain.RRClassIN}
+
+	tests := []struct {
+		name    string
+		mutate  func(t *testing.T, tree *testTree)
+		wantErr bool
+	}{
+		{name: "valid chain", mutate: func(*testing.T, *testTree) {}},
+		{
+			name: "anchor does not match the zone key",
+			mutate: func(t *testing.T, tree *testTree) {
+				tree.anchors = []domain.ResourceRecord{newTestSigner(t, "test.", algED25519).ds(t)}
+			},
+			wantErr: true,
+		},
+		{
+			name: "dnskey anchor",
+			mutate: func(t *testing.T, tree *testTree) {
+				tree.anchors = []domain.ResourceRecord{tree.root.dnskey}
+			},
+		},
+		{
+			name: "anchor at the signed zone itself",
+			mutate: func(t *testing.T, tree *testTree) {
+				tree.anchors = []domain.ResourceRecord{tree.example.ds(t)}
+			},
+		},
+		{
+			name: "ds does not match the child key",
+			mutate: func(t *testing.T, tree *testTree) {
+				other := newTestSigner(t, "example.test.", algED25519)
+				tree.upstream.set("example.test.", domain.RRTypeDS, domain.NOERROR, tree.root.signed(t, now, other.ds(t)), nil)
+			},
+			wantErr: true,
+		},
+		{
+			name: "ds signed by the child is bogus",
+			mutate: func(t *testing.T, tree *testTree) {
+				tree.upstream.set("example.test.", domain.RRTypeDS, domain.NOERROR, tree.example.signed(t, now, tree.example.ds(t)), nil)
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsigned ds is bogus",
+			mutate: func(t *testing.T, tree *testTree) {
+				tree.upstream.set("example.test.", domain.RRTypeDS, domain.NOERROR, []domain.ResourceRecord{tree.example.ds(t)}, nil)
+			},
+			wantErr: true,
+		},
+		{
+			name: "ds lookup failure",
+			mutate: func(t *testing.T, tree *testTree) {
+				tree.upstream.set("example.test.", domain.RRTypeDS, domain.SERVFAIL, nil, nil)
+			},
+			wantErr: true,
+		},
+		{
+			name: "proven insecure delegation downgrades the answer",
+			mutate: func(t *testing.T, tree *testTree) {
+				nsec := testRR(t, "example.test.", domain.RRTypeNSEC, "zzz.test. NS RRSIG NSEC")
+				tree.upstream.set("example.test.", domain.RRTypeDS, domain.NOERROR, nil, tree.root.signed(t, now, nsec))
+			},
+		},
+		{
+			name: "denial of ds listing ds is bogus",
+			mutate: func(t *testing.T, tree *testTree) {
+				nsec := testRR(t, "example.test.", domain.RRTypeNSEC, "zzz.test. NS DS RRSIG NSEC")
+				tree.upstream.set("example.test.", domain.RRTypeDS, domain.NOERROR, nil, tree.root.signed(t, now, nsec))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tree := newTestTree(t, algED25519, now)
+			tree.upstream.set(query.Name, query.Type, domain.NOERROR, tree.example.signed(t, now, testRR(t, query.Name, query.Type, "192.0.2.1")), nil)
+			tc.mutate(t, tree)
+			answer, err := tree.validator(t).Resolve(context.Background(), query, now)
+			records := answer.Answers
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, records, 1)
+		})
+	}
+}
+
+func TestValidator_Resolve_CachesKeys(t *testing.T) {
+	now := time.Now()
+	tree := newTestTree(t, algECDSAP256SHA256, now)
+	query := domain.Question{Name: "www.example.test.", Type: domain.RRTypeA, Class: domain.RRClassIN}
+	tree.upstream.set(query.Name, query.Type, domain.NOERROR, tree.example.signed(t, now, testRR(t, query.Name, query.Type, "192.0.2.1")), nil)
+	v := tree.validator(t)
+
+	for range 3 {
+		answer, err := v.Resolve(context.Background(), query, now)
+		records := answer.Answers
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		assert.True(t, records[0].Authenticated)
+	}
+	assert.Equal(t, 3, tree.upstream.count("www.example.test A"))
+	assert.Equal(t, 1, tree.upstream.count("test DNSKEY"))
+	assert.Equal(t, 1, tree.upstream.count("example.test DS"))
+	assert.Equal(t, 1, tree.upstream.count("example.test DNSKEY"))
+}
+
+func TestValidator_Resolve_UpstreamError(t *testing.T) {
+	v, err := NewValidator(Options{Upstream: newTestUpstream()})
+	require.NoError(t, err)
+	_, err = v.Resolve(context.Background(), domain.Question{Name: "example.com.", Type: domain.RRTypeA, Class: domain.RRClassIN}, time.Now())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no response")
+}
+
+func TestGroupRRsets(t *testing.T) {
+	now := time.Now()
+	s := newTestSigner(t, "example.test.", algED25519)
+	a1 := testRR(t, "www.example.test.", domain.RRTypeA, "192.0.2.1")
+	a2 := testRR(t, "WWW.example.test.", domain.RRTypeA, "192.0.2.2")
+	aaaa := testRR(t, "www.example.test.", domain.RRTypeAAAA, "2001:db8::1")
+	sig := s.rrsig(t, []domain.ResourceRecord{a1, a2}, now)
+	orphan := s.rrsig(t, []domain.ResourceRecord{testRR(t, "x.example.test.", domain.RRTypeTXT, "orphan")}, now)
+
+	sets := groupRRsets([]domain.ResourceRecord{sig, a1, aaaa, a2, orphan})
+	require.Len(t, sets, 2)
+	assert.Equal(t, "www.example.test", sets[0].name)
+	assert.Equal(t, domain.RRTypeA, sets[0].rrtype)
+	assert.Len(t, sets[0].records, 2)
+	assert.Len(t, sets[0].sigs, 1)
+	assert.Equal(t, domain.RRTypeAAAA, sets[1].rrtype)
+	assert.Empty(t, sets[1].sigs)
+}
+
+func TestFollowCNAMEs(t *testing.T) {
+	sets := groupRRsets([]domain.ResourceRecord{
+		testRR(t, "a.test.", domain.RRTypeCNAME, "b.test."),
+		testRR(t, "b.test.", domain.RRTypeCNAME, "c.test."),
+		testRR(t, "loop.test.", domain.RRTypeCNAME, "loop.test."),
+	})
+	assert.Equal(t, "c.test", followCNAMEs("a.test", domain.RRTypeA, sets))
+	assert.Equal(t, "a.test", followCNAMEs("a.test", domain.RRTypeCNAME, sets))
+	assert.Equal(t, "other.test", followCNAMEs("other.test", domain.RRTypeA, sets))
+	assert.Equal(t, "loop.test", followCNAMEs("loop.test", domain.RRTypeA, sets))
+}
@@ -0,0 +1,271 @@
+package dnssec
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	//gosec:disable G505 -- SHA-1 is still required for DS digest type 1 and RSASHA1 (RFC 8624)
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// DNSSEC algorithm numbers this package can verify (RFC 8624 §3.1).
+const (
+	algRSASHA1          = 5
+	algRSASHA1NSEC3SHA1 = 7
+	algRSASHA256        = 8
+	algRSASHA512        = 10
+	algECDSAP256SHA256  = 13
+	algECDSAP384SHA384  = 14
+	algED25519          = 15
+)
+
+// DS digest types this package can check (RFC 8624 §3.3).
+const (
+	digestSHA1   = 1
+	digestSHA256 = 2
+	digestSHA384 = 4
+)
+
+// minRSAModulusBits rejects RSA keys too short to be trusted (RFC 8624 §3.1 notes).
+const minRSAModulusBits = 1024
+
+// supportedAlgorithm reports whether signatures made with alg can be verified.
+func supportedAlgorithm(alg uint8) bool {
+	switch alg {
+	case algRSASHA1, algRSASHA1NSEC3SHA1, algRSASHA256, algRSASHA512,
+		algECDSAP256SHA256, algECDSAP384SHA384, algED25519:
+		return true
+	}
+	return false
+}
+
+// supportedDigest reports whether DS records with digest type t can be checked.
+func supportedDigest(t uint8) bool {
+	return t == digestSHA1 || t == digestSHA256 || t == digestSHA384
+}
+
+// keyTag computes the key tag of a DNSKEY RDATA (RFC 4034 Appendix B).
+func keyTag(rdata []byte) uint16 {
+	var acc uint32
+	for i, b := range rdata {
+		if i&1 == 0 {
+			acc += uint32(b) << 8
+		} else {
+			acc += uint32(b)
+		}
+	}
+	acc += acc >> 16 & 0xFFFF
+	//gosec:disable G115 -- the key tag is defined as the low 16 bits
+	return uint16(acc & 0xFFFF)
+}
+
+// dsDigest computes the digest a DS record of the given type holds for the
+// DNSKEY RDATA of owner (RFC 4034 §5.1.4).
+func dsDigest(digestType uint8, owner string, rdata []byte) ([]byte, bool) {
+	input := append(nameWire(owner), rdata...)
+	switch digestType {
+	case digestSHA1:
+		//gosec:disable G401 -- required by DS digest type 1
+		sum := sha1.Sum(input)
+		return sum[:], true
+	case digestSHA256:
+		sum := sha256.Sum256(input)
+		return sum[:], true
+	case digestSHA384:
+		sum := sha512.Sum384(input)
+		return sum[:], true
+	}
+	return nil, false
+}
+
+// dsMatches reports whether ds commits to key, the DNSKEY of owner.
+func dsMatches(ds dsRecord, owner string, key dnskeyRecord) bool {
+	if ds.algorithm != key.algorithm || ds.keyTag != keyTag(key.rdata) {
+		return false
+	}
+	digest, ok := dsDigest(ds.digestType, owner, key.rdata)
+	return ok && bytes.Equal(digest, ds.digest)
+}
+
+// signedData builds the data an RRSIG signs over rrset (RFC 4034 §3.1.8.1):
+// the RRSIG fields followed by each record in canonical form and order. For
+// signatures made by a wildcard, the owner is rebuilt from the label count.
+func signedData(sig rrsigRecord, rrset []domain.ResourceRecord) ([]byte, error) {
+	owner := canonicalName(rrset[0].Name)
+	labels := labelCount(owner)
+	if int(sig.labels) > labels {
+		return nil, fmt.Errorf("RRSIG label count %d exceeds owner %q", sig.labels, owner)
+	}
+	if int(sig.labels) < labels {
+		owner = wildcardOf(trimLabels(owner, labels-int(sig.labels)))
+	}
+	var header []byte
+	header = append(header, nameWire(owner)...)
+	header = binary.BigEndian.AppendUint16(header, uint16(rrset[0].Type))
+	header = binary.BigEndian.AppendUint16(header, uint16(rrset[0].Class))
+	header = binary.BigEndian.AppendUint32(header, sig.originalTTL)
+
+	rdatas := make([][]byte, 0, len(rrset))
+	for _, rr := range rrset {
+		rdatas = append(rdatas, canonicalRData(rr.Type, rr.Data))
+	}
+	slices.SortFunc(rdatas, bytes.Compare)
+	rdatas = slices.CompactFunc(rdatas, bytes.Equal)
+
+	data := append([]byte(nil), sig.signedFields...)
+	for _, rdata := range rdatas {
+		if len(rdata) > 0xFFFF {
+			return nil, errors.New("RDATA too long")
+		}
+		data = append(data, header...)
+		//gosec:disable G115 -- length checked above
+		data = binary.BigEndian.AppendUint16(data, uint16(len(rdata)))
+		data = append(data, rdata...)
+	}
+	return data, nil
+}
+
+// trimLabels removes the n leftmost labels of a canonical name.
+func trimLabels(name string, n int) string {
+	for range n {
+		name = parentName(name)
+	}
+	return name
+}
+
+// canonicalRData lowercases the domain names embedded in RDATA of the types
+// listed in RFC 4034 §6.2 that this resolver decodes. The wire codec has
+// already expanded compression, so names can be lowered in place: label
+// lengths never fall in the ASCII uppercase range.
+func canonicalRData(rrtype domain.RRType, data []byte) []byte {
+	var start, end int
+	switch rrtype {
+	case domain.RRTypeNS, domain.RRTypeCNAME, domain.RRTypePTR:
+		start, end = 0, len(data)
+	case domain.RRTypeMX:
+		start, end = 2, len(data)
+	case domain.RRTypeSRV:
+		start, end = 6, len(data)
+	case domain.RRTypeSOA:
+		start, end = 0, len(data)-20
+	default:
+		return data
+	}
+	if start > end || end < 0 {
+		return data
+	}
+	out := append([]byte(nil), data...)
+	copy(out[start:end], bytes.ToLower(out[start:end]))
+	return out
+}
+
+// signatureCurrent reports whether now falls inside the validity period of sig.
+// RRSIG times are 32-bit serial numbers (RFC 4034 §3.1.5); they are compared
+// in serial arithmetic around now so the check keeps working after 2106.
+func signatureCurrent(sig rrsigRecord, now time.Time) bool {
+	//gosec:disable G115 -- serial number arithmetic wraps intentionally
+	t := uint32(now.Unix())
+	return int32(t-sig.inception) >= 0 && int32(sig.expiration-t) >= 0
+}
+
+// verifySignature checks sig over rrset with key. The caller is responsible
+// for deciding whether key is trusted.
+func verifySignature(key dnskeyRecord, sig rrsigRecord, rrset []domain.ResourceRecord) error {
+	if key.algorithm != sig.algorithm || keyTag(key.rdata) != sig.keyTag {
+		return errors.New("key does not match signature")
+	}
+	data, err := signedData(sig, rrset)
+	if err != nil {
+		return err
+	}
+	return verifyData(key, data, sig.signature)
+}
+
+// verifyData checks signature over data with key, using the key's algorithm.
+func verifyData(key dnskeyRecord, data, signature []byte) error {
+	switch key.algorithm {
+	case algRSASHA1, algRSASHA1NSEC3SHA1:
+		return verifyRSA(key.publicKey, crypto.SHA1, data, signature)
+	case algRSASHA256:
+		return verifyRSA(key.publicKey, crypto.SHA256, data, signature)
+	case algRSASHA512:
+		return verifyRSA(key.publicKey, crypto.SHA512, data, signature)
+	case algECDSAP256SHA256:
+		return verifyECDSA(key.publicKey, elliptic.P256(), crypto.SHA256, data, signature)
+	case algECDSAP384SHA384:
+		return verifyECDSA(key.publicKey, elliptic.P384(), crypto.SHA384, data, signature)
+	case algED25519:
+		if len(key.publicKey) != ed25519.PublicKeySize {
+			return errors.New("invalid Ed25519 key")
+		}
+		if !ed25519.Verify(ed25519.PublicKey(key.publicKey), data, signature) {
+			return errors.New("Ed25519 signature mismatch")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported algorithm %d", key.algorithm)
+}
+
+// verifyRSA checks a PKCS #1 v1.5 signature with a key in RFC 3110 §2 format:
+// exponent length, exponent, then modulus.
+func verifyRSA(keyData []byte, hash crypto.Hash, data, signature []byte) error {
+	if len(keyData) < 1 {
+		return errors.New("invalid RSA key")
+	}
+	expLen, rest := int(keyData[0]), keyData[1:]
+	if expLen == 0 {
+		if len(rest) < 2 {
+			return errors.New("invalid RSA key")
+		}
+		expLen, rest = int(binary.BigEndian.Uint16(rest)), rest[2:]
+	}
+	if expLen == 0 || expLen > 4 || len(rest) <= expLen {
+		return errors.New("invalid RSA key")
+	}
+	exponent := new(big.Int).SetBytes(rest[:expLen])
+	pub := &rsa.PublicKey{N: new(big.Int).SetBytes(rest[expLen:]), E: int(exponent.Int64())}
+	if pub.N.BitLen() < minRSAModulusBits {
+		return fmt.Errorf("RSA key of %d bits is too short", pub.N.BitLen())
+	}
+	h := hash.New()
+	h.Write(data)
+	if err := rsa.VerifyPKCS1v15(pub, hash, h.Sum(nil), signature); err != nil {
+		return fmt.Errorf("RSA signature mismatch: %w", err)
+	}
+	return nil
+}
+
+// verifyECDSA checks an ECDSA signature in RFC 6605 §4 format: the key is the
+// point X | Y and the signature r | s, each half as long as the curve order.
+func verifyECDSA(keyData []byte, curve elliptic.Curve, hash crypto.Hash, data, signature []byte) error {
+	size := (curve.Params().BitSize + 7) / 8
+	if len(keyData) != 2*size || len(signature) != 2*size {
+		return errors.New("invalid ECDSA key or signature length")
+	}
+	pub := &ecdsa.PublicKey{
+		Curve: curve,
+		X:     new(big.Int).SetBytes(keyData[:size]),
+		Y:     new(big.Int).SetBytes(keyData[size:]),
+	}
+	h := hash.New()
+	h.Write(data)
+	r := new(big.Int).SetBytes(signature[:size])
+	s := new(big.Int).SetBytes(signature[size:])
+	if !ecdsa.Verify(pub, h.Sum(nil), r, s) {
+		return errors.New("ECDSA signature mismatch")
+	}
+	return nil
+}
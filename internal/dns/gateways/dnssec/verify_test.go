@@ -0,0 +1,146 @@
+package dnssec
+
+import (
+	"crypto"
+	"crypto/elliptic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+func TestKeyTag(t *testing.T) {
+	assert.Equal(t, uint16(0x0409), keyTag([]byte{0x01, 0x01, 0x03, 0x08}))
+	// odd length, with a carry out of the low 16 bits folded back in
+	assert.Equal(t, uint16(0x0002), keyTag([]byte{0xFF, 0xFF, 0x00, 0x02, 0x00}))
+}
+
+func TestDSMatches(t *testing.T) {
+	s := newTestSigner(t, "example.test.", algED25519)
+	ds, err := parseDS(s.ds(t).Data)
+	require.NoError(t, err)
+	assert.True(t, dsMatches(ds, "example.test", s.key))
+	assert.False(t, dsMatches(ds, "other.test", s.key))
+
+	other := newTestSigner(t, "example.test.", algED25519)
+	assert.False(t, dsMatches(ds, "example.test", other.key))
+
+	for _, digestType := range []uint8{digestSHA1, digestSHA256, digestSHA384} {
+		digest, ok := dsDigest(digestType, "example.test", s.key.rdata)
+		require.True(t, ok)
+		d := dsRecord{keyTag: keyTag(s.key.rdata), algorithm: algED25519, digestType: digestType, digest: digest}
+		assert.True(t, dsMatches(d, "example.test", s.key), "digest type %d", digestType)
+	}
+	_, ok := dsDigest(3, "example.test", s.key.rdata)
+	assert.False(t, ok)
+}
+
+func TestVerifySignature(t *testing.T) {
+	now := time.Now()
+	a := testRR(t, "www.example.test.", domain.RRTypeA, "192.0.2.1")
+	b := testRR(t, "www.example.test.", domain.RRTypeA, "192.0.2.2")
+
+	for _, alg := range []uint8{algED25519, algECDSAP256SHA256, algRSASHA256} {
+		s := newTestSigner(t, "example.test.", alg)
+		sig, err := parseRRSIG(s.rrsig(t, []domain.ResourceRecord{a, b}, now).Data)
+		require.NoError(t, err)
+
+		// record order and duplicates do not change the signed data
+		assert.NoError(t, verifySignature(s.key, sig, []domain.ResourceRecord{b, a, b}), "algorithm %d", alg)
+		assert.Error(t, verifySignature(s.key, sig, []domain.ResourceRecord{a}), "algorithm %d", alg)
+
+		tampered := sig
+		tampered.signature = append([]byte(nil), sig.signature...)
+		tampered.signature[0] ^= 0xFF
+		assert.Error(t, verifySignature(s.key, tampered, []domain.ResourceRecord{a, b}), "algorithm %d", alg)
+	}
+
+	s := newTestSigner(t, "example.test.", algED25519)
+	sig, err := parseRRSIG(s.rrsig(t, []domain.ResourceRecord{a}, now).Data)
+	require.NoError(t, err)
+	other := newTestSigner(t, "example.test.", algECDSAP256SHA256)
+	assert.Error(t, verifySignature(other.key, sig, []domain.ResourceRecord{a}), "key of another algorithm")
+
+	tooManyLabels := sig
+	tooManyLabels.labels = 5
+	assert.Error(t, verifySignature(s.key, tooManyLabels, []domain.ResourceRecord{a}))
+}
+
+func TestVerifySignature_Wildcard(t *testing.T) {
+	now := time.Now()
+	s := newTestSigner(t, "example.test.", algECDSAP256SHA256)
+	wildcard := testRR(t, "*.example.test.", domain.RRTypeTXT, "hello")
+	sig, err := parseRRSIG(s.rrsig(t, []domain.ResourceRecord{wildcard}, now).Data)
+	require.NoError(t, err)
+	assert.Equal(t, uint8(2), sig.labels)
+
+	assert.NoError(t, verifySignature(s.key, sig, expand([]domain.ResourceRecord{wildcard}, "a.b.example.test.")))
+}
+
+func TestVerifyKeyFormats(t *testing.T) {
+	assert.Error(t, verifyRSA(nil, 0, nil, nil))
+	assert.Error(t, verifyRSA([]byte{0, 0}, 0, nil, nil))
+	assert.Error(t, verifyRSA([]byte{3, 1, 0, 1}, 0, nil, nil), "no modulus")
+	assert.ErrorContains(t, verifyRSA([]byte{3, 1, 0, 1, 0xFF, 0xFF}, 0, nil, nil), "too short")
+
+	s := newTestSigner(t, "example.test.", algECDSAP256SHA256)
+	assert.Error(t, verifyECDSA(s.key.publicKey[:10], elliptic.P256(), crypto.SHA256, nil, nil))
+
+	key := dnskeyRecord{algorithm: algED25519, publicKey: []byte{1, 2, 3}, rdata: []byte{1, 1, 3, algED25519, 1, 2, 3}}
+	sig := rrsigRecord{algorithm: algED25519, keyTag: keyTag(key.rdata), signedFields: []byte{}}
+	assert.Error(t, verifySignature(key, sig, []domain.ResourceRecord{testRR(t, "a.test.", domain.RRTypeA, "192.0.2.1")}))
+}
+
+func TestSignatureCurrent(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	tests := []struct {
+		name       string
+		inception  time.Time
+		expiration time.Time
+		want       bool
+	}{
+		{name: "current", inception: now.Add(-time.Hour), expiration: now.Add(time.Hour), want: true},
+		{name: "expired", inception: now.Add(-2 * time.Hour), expiration: now.Add(-time.Hour), want: false},
+		{name: "not yet valid", inception: now.Add(time.Hour), expiration: now.Add(2 * time.Hour), want: false},
+		{name: "boundaries inclusive", inception: now, expiration: now, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sig := rrsigRecord{inception: uint32(tt.inception.Unix()), expiration: uint32(tt.expiration.Unix())}
+			assert.Equal(t, tt.want, signatureCurrent(sig, now))
+		})
+	}
+}
+
+func TestCanonicalRData(t *testing.T) {
+	tests := []struct {
+		name   string
+		rrtype domain.RRType
+		in     []byte
+		want   []byte
+	}{
+		{name: "cname", rrtype: domain.RRTypeCNAME, in: []byte{3, 'W', 'w', 'W', 0}, want: []byte{3, 'w', 'w', 'w', 0}},
+		{name: "mx keeps preference", rrtype: domain.RRTypeMX, in: []byte{0, 'A', 1, 'M', 0}, want: []byte{0, 'A', 1, 'm', 0}},
+		{name: "txt untouched", rrtype: domain.RRTypeTXT, in: []byte{2, 'H', 'i'}, want: []byte{2, 'H', 'i'}},
+		{name: "short soa untouched", rrtype: domain.RRTypeSOA, in: []byte{1, 'A'}, want: []byte{1, 'A'}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := append([]byte(nil), tt.in...)
+			assert.Equal(t, tt.want, canonicalRData(tt.rrtype, in))
+			assert.Equal(t, tt.in, in, "input is not modified")
+		})
+	}
+}
+
+func TestSupported(t *testing.T) {
+	assert.True(t, supportedAlgorithm(algRSASHA256))
+	assert.True(t, supportedAlgorithm(algED25519))
+	assert.False(t, supportedAlgorithm(3))  // DSA
+	assert.False(t, supportedAlgorithm(16)) // Ed448
+	assert.True(t, supportedDigest(digestSHA384))
+	assert.False(t, supportedDigest(3)) // GOST
+}
@@ -0,0 +1,236 @@
+// Package dnstap exports copies of the DNS messages exchanged with clients and
+// upstream servers as dnstap (https://dnstap.info): protobuf messages in Frame
+// Streams, written to a unix socket, a TCP socket or a file.
+package dnstap
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/common/log"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// Networks a Logger can write to.
+const (
+	// NetworkUnix connects to a collector listening on a unix socket.
+	NetworkUnix = "unix"
+	// NetworkTCP connects to a collector listening on a TCP address.
+	NetworkTCP = "tcp"
+	// NetworkFile writes to a file, replacing its contents.
+	NetworkFile = "file"
+)
+
+const (
+	// DefaultQueueSize is the number of messages buffered for writing.
+	DefaultQueueSize = 8192
+	// DefaultReconnectInterval is the time between attempts to reconnect to a collector.
+	DefaultReconnectInterval = 5 * time.Second
+)
+
+var (
+	errAddressRequired = errors.New("dnstap address is required")
+	errUnknownNetwork  = errors.New("unsupported dnstap network")
+)
+
+// Options configures a Logger.
+type Options struct {
+	// Network is NetworkUnix, NetworkTCP or NetworkFile. Required.
+	Network string
+	// Address is the socket path, host:port or file path. Required.
+	Address string
+	// Identity names this server in every message, and Version the software.
+	// Either may be empty.
+	Identity string
+	Version  string
+	// QueueSize is the number of messages buffered for writing; zero uses
+	// DefaultQueueSize. Messages tapped while the queue is full are dropped.
+	QueueSize int
+	// ReconnectInterval is the time between attempts to reach a collector that
+	// is down; zero uses DefaultReconnectInterval.
+	ReconnectInterval time.Duration
+	// options to inject for testing purposes
+	Clock  clock.Clock
+	Logger log.Logger
+}
+
+// Logger implements resolver.MessageTap. Messages are queued and written by a
+// background goroutine, so neither a slow collector nor a slow disk delays a
+// query. While a collector is unreachable, messages are discarded and the
+// connection is retried every ReconnectInterval.
+type Logger struct {
+	network   string
+	address   string
+	identity  []byte
+	version   []byte
+	reconnect time.Duration
+	clock     clock.Clock
+	logger    log.Logger
+
+	// out and lastAttempt are used only by the background goroutine until it has stopped.
+	out         *output
+	lastAttempt time.Time
+
+	mu      sync.RWMutex // guards closed against concurrent sends on queue
+	closed  bool
+	queue   chan resolver.TapMessage
+	dropped atomic.Uint64
+	lost    atomic.Uint64
+	done    chan struct{}
+}
+
+// New creates a Logger writing to opts.Address. A file is opened at once and
+// failing to open it is an error; a collector that cannot be reached yet is
+// retried in the background.
+func New(opts Options) (*Logger, error) {
+	switch opts.Network {
+	case NetworkUnix, NetworkTCP, NetworkFile:
+	default:
+		return nil, fmt.Errorf("%w: %q", errUnknownNetwork, opts.Network)
+	}
+	if opts.Address == "" {
+		return nil, errAddressRequired
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	if opts.ReconnectInterval <= 0 {
+		opts.ReconnectInterval = DefaultReconnectInterval
+	}
+	if opts.Clock == nil {
+		opts.Clock = &clock.RealClock{}
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.NewNoopLogger()
+	}
+	l := &Logger{
+		network:   opts.Network,
+		address:   opts.Address,
+		identity:  []byte(opts.Identity),
+		version:   []byte(opts.Version),
+		reconnect: opts.ReconnectInterval,
+		clock:     opts.Clock,
+		logger:    opts.Logger,
+		queue:     make(chan resolver.TapMessage, opts.QueueSize),
+		done:      make(chan struct{}),
+	}
+	if opts.Network == NetworkFile {
+		out, err := openOutput(opts.Network, opts.Address)
+		if err != nil {
+			return nil, err
+		}
+		l.out = out
+	} else {
+		l.connect()
+	}
+	go l.run()
+	return l, nil
+}
+
+// Tap queues msg for writing, dropping it if the queue is full or the Logger
+// is closed.
+func (l *Logger) Tap(msg resolver.TapMessage) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		return
+	}
+	select {
+	case l.queue <- msg:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+// run writes queued messages until the queue is closed, flushing whenever the
+// queue runs empty.
+func (l *Logger) run() {
+	defer close(l.done)
+	pending := 0
+	for msg := range l.queue {
+		if l.out == nil && !l.connect() {
+			l.lost.Add(1)
+			continue
+		}
+		if err := l.out.write(encodeFrame(l.identity, l.version, msg)); err != nil {
+			l.fail(err, pending+1)
+			pending = 0
+			continue
+		}
+		pending++
+		if len(l.queue) > 0 {
+			continue
+		}
+		if err := l.out.flush(); err != nil {
+			l.fail(err, pending)
+		}
+		pending = 0
+	}
+}
+
+// connect opens the output unless the last attempt was less than a reconnect
+// interval ago, and reports whether it is open.
+func (l *Logger) connect() bool {
+	now := l.clock.Now()
+	if !l.lastAttempt.IsZero() && now.Sub(l.lastAttempt) < l.reconnect {
+		return false
+	}
+	l.lastAttempt = now
+	out, err := openOutput(l.network, l.address)
+	if err != nil {
+		l.logger.Warn(map[string]any{"address": l.address, "error": err}, "dnstap output unavailable")
+		return false
+	}
+	l.out = out
+	l.logger.Info(map[string]any{"network": l.network, "address": l.address}, "dnstap output connected")
+	return true
+}
+
+// fail drops the output after a write error, counting the unwritten messages
+// as lost. The next message reconnects after the reconnect interval.
+func (l *Logger) fail(err error, unwritten int) {
+	l.logger.Error(map[string]any{"address": l.address, "error": err}, "Failed to write dnstap messages")
+	l.out.abort()
+	l.out = nil
+	l.lastAttempt = l.clock.Now()
+	//gosec:disable G115 -- unwritten counts messages and is never negative
+	l.lost.Add(uint64(unwritten))
+}
+
+// Dropped returns the number of messages discarded because the queue was full.
+func (l *Logger) Dropped() uint64 {
+	return l.dropped.Load()
+}
+
+// Lost returns the number of messages discarded because the output was
+// unavailable or failed.
+func (l *Logger) Lost() uint64 {
+	return l.lost.Load()
+}
+
+// Close stops accepting messages, writes those still queued and ends the
+// Frame Streams session.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.queue)
+	l.mu.Unlock()
+
+	<-l.done
+	if l.out == nil {
+		return nil
+	}
+	err := l.out.close()
+	l.out = nil
+	return err
+}
+
+var _ resolver.MessageTap = (*Logger)(nil)
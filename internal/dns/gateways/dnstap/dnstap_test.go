@@ -0,0 +1,139 @@
+package dnstap
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// testMessage returns a client query carrying payload.
+func testMessage(payload byte) resolver.TapMessage {
+	return resolver.TapMessage{
+		Type:      resolver.TapClientQuery,
+		Protocol:  "udp",
+		QueryAddr: &net.UDPAddr{IP: net.ParseIP("192.0.2.10"), Port: 40000},
+		QueryTime: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC),
+		Message:   []byte{payload},
+	}
+}
+
+// queryMessage returns the DNS message carried by a dnstap frame.
+func queryMessage(t *testing.T, frame []byte) []byte {
+	t.Helper()
+	return decodeProto(t, decodeProto(t, frame)[dnstapMessage].bytes)[messageQueryMessage].bytes
+}
+
+// receive waits for the next frame from a collector.
+func receive(t *testing.T, frames <-chan []byte) []byte {
+	t.Helper()
+	select {
+	case frame := <-frames:
+		return frame
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a dnstap frame")
+		return nil
+	}
+}
+
+func TestLogger_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dnstap.fstrm")
+	l, err := New(Options{Network: NetworkFile, Address: path, Identity: "ns1", Version: "rr-dnsd 1.0"})
+	require.NoError(t, err)
+	for i := range 3 {
+		l.Tap(testMessage(byte(i)))
+	}
+	require.NoError(t, l.Close())
+	require.NoError(t, l.Close(), "closing twice is harmless")
+	l.Tap(testMessage(9))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	r := bytes.NewReader(data)
+	_, controlType, err := readFrame(r)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(controlStart), controlType)
+	for i := range 3 {
+		frame, _, err := readFrame(r)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("ns1"), decodeProto(t, frame)[dnstapIdentity].bytes)
+		assert.Equal(t, []byte{byte(i)}, queryMessage(t, frame))
+	}
+	_, controlType, err = readFrame(r)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(controlStop), controlType)
+	assert.Zero(t, l.Dropped()+l.Lost())
+}
+
+func TestLogger_Socket(t *testing.T) {
+	ln, frames := listenCollector(t, NetworkTCP, "127.0.0.1:0")
+
+	l, err := New(Options{Network: NetworkTCP, Address: ln.Addr().String()})
+	require.NoError(t, err)
+	l.Tap(testMessage(7))
+	assert.Equal(t, []byte{7}, queryMessage(t, receive(t, frames)))
+	require.NoError(t, l.Close())
+}
+
+func TestLogger_Reconnect(t *testing.T) {
+	path := socketPath(t)
+	clk := &clock.MockClock{CurrentTime: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)}
+
+	// No collector yet: messages are lost, not queued up
+	l, err := New(Options{Network: NetworkUnix, Address: path, ReconnectInterval: time.Minute, Clock: clk})
+	require.NoError(t, err)
+	l.Tap(testMessage(1))
+	require.Eventually(t, func() bool { return l.Lost() == 1 }, 2*time.Second, time.Millisecond)
+
+	// Within the reconnect interval the collector is not retried
+	_, frames := listenCollector(t, NetworkUnix, path)
+	l.Tap(testMessage(2))
+	require.Eventually(t, func() bool { return l.Lost() == 2 }, 2*time.Second, time.Millisecond)
+
+	clk.Advance(time.Minute)
+	l.Tap(testMessage(3))
+	assert.Equal(t, []byte{3}, queryMessage(t, receive(t, frames)))
+	require.NoError(t, l.Close())
+	assert.Equal(t, uint64(2), l.Lost())
+}
+
+func TestLogger_CountsDroppedMessages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dnstap.fstrm")
+	l, err := New(Options{Network: NetworkFile, Address: path, QueueSize: 1})
+	require.NoError(t, err)
+	for i := range 100 {
+		l.Tap(testMessage(byte(i)))
+	}
+	require.NoError(t, l.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	written := 0
+	for r := bytes.NewReader(data); r.Len() > 0; {
+		payload, _, err := readFrame(r)
+		require.NoError(t, err)
+		if payload != nil {
+			written++
+		}
+	}
+	assert.Equal(t, uint64(100), l.Dropped()+uint64(written))
+}
+
+func TestNew_Errors(t *testing.T) {
+	_, err := New(Options{Network: "udp", Address: "127.0.0.1:6000"})
+	assert.ErrorIs(t, err, errUnknownNetwork)
+
+	_, err = New(Options{Network: NetworkUnix})
+	assert.ErrorIs(t, err, errAddressRequired)
+
+	_, err = New(Options{Network: NetworkFile, Address: filepath.Join(t.TempDir(), "missing", "dnstap.fstrm")})
+	assert.ErrorContains(t, err, "failed to open dnstap file")
+}
@@ -0,0 +1,103 @@
+package dnstap
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// contentType identifies dnstap data frames in the Frame Streams handshake.
+const contentType = "protobuf:dnstap.Dnstap"
+
+// Frame Streams control frame types.
+const (
+	controlAccept = 0x01
+	controlStart  = 0x02
+	controlStop   = 0x03
+	controlReady  = 0x04
+	controlFinish = 0x05
+
+	// controlFieldContentType is the only control frame field type.
+	controlFieldContentType = 0x01
+
+	// maxControlFrameSize bounds the control frames read from a collector.
+	maxControlFrameSize = 512
+)
+
+var (
+	errUnexpectedControl = errors.New("unexpected frame streams control frame")
+	errContentType       = errors.New("collector does not accept " + contentType)
+)
+
+// appendControlFrame appends a control frame of the given type: an escape
+// (a zero length), the frame length, the type and the content type fields.
+func appendControlFrame(b []byte, controlType uint32, contentTypes ...string) []byte {
+	length := 4
+	for _, ct := range contentTypes {
+		length += 8 + len(ct)
+	}
+	b = binary.BigEndian.AppendUint32(b, 0)
+	//gosec:disable G115 -- control frames hold a few short content types
+	b = binary.BigEndian.AppendUint32(b, uint32(length))
+	b = binary.BigEndian.AppendUint32(b, controlType)
+	for _, ct := range contentTypes {
+		b = binary.BigEndian.AppendUint32(b, controlFieldContentType)
+		//gosec:disable G115 -- content types are short strings
+		b = binary.BigEndian.AppendUint32(b, uint32(len(ct)))
+		b = append(b, ct...)
+	}
+	return b
+}
+
+// readControlFrame reads a control frame, returning its type and content types.
+func readControlFrame(r io.Reader) (controlType uint32, contentTypes []string, err error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[4:])
+	if binary.BigEndian.Uint32(header[:4]) != 0 || length < 4 || length > maxControlFrameSize {
+		return 0, nil, errUnexpectedControl
+	}
+	frame := make([]byte, length)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return 0, nil, err
+	}
+	controlType = binary.BigEndian.Uint32(frame)
+	for fields := frame[4:]; len(fields) > 0; {
+		if len(fields) < 8 {
+			return 0, nil, errUnexpectedControl
+		}
+		fieldType, fieldLen := binary.BigEndian.Uint32(fields), binary.BigEndian.Uint32(fields[4:])
+		if uint64(fieldLen) > uint64(len(fields)-8) {
+			return 0, nil, errUnexpectedControl
+		}
+		if fieldType == controlFieldContentType {
+			contentTypes = append(contentTypes, string(fields[8:8+fieldLen]))
+		}
+		fields = fields[8+fieldLen:]
+	}
+	return controlType, contentTypes, nil
+}
+
+// handshake opens a bidirectional Frame Streams session with a collector:
+// READY offering dnstap, the collector's ACCEPT, then START.
+func handshake(rw io.ReadWriter) error {
+	if _, err := rw.Write(appendControlFrame(nil, controlReady, contentType)); err != nil {
+		return err
+	}
+	controlType, contentTypes, err := readControlFrame(rw)
+	if err != nil {
+		return fmt.Errorf("failed to read ACCEPT: %w", err)
+	}
+	if controlType != controlAccept {
+		return errUnexpectedControl
+	}
+	if !slices.Contains(contentTypes, contentType) {
+		return errContentType
+	}
+	_, err = rw.Write(appendControlFrame(nil, controlStart, contentType))
+	return err
+}
@@ -0,0 +1,135 @@
+package dnstap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readFrame reads one Frame Streams frame: a data frame's payload, or the
+// type of a control frame.
+func readFrame(r io.Reader) (payload []byte, controlType uint32, err error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, 0, err
+	}
+	if n := binary.BigEndian.Uint32(length[:]); n > 0 {
+		payload = make([]byte, n)
+		_, err := io.ReadFull(r, payload)
+		return payload, 0, err
+	}
+	controlType, _, err = readControlFrame(io.MultiReader(bytes.NewReader(length[:]), r))
+	return nil, controlType, err
+}
+
+// collect acts as a dnstap collector on conn: it accepts the session, sends
+// every data frame to frames and answers STOP with FINISH.
+func collect(conn net.Conn, frames chan<- []byte) {
+	defer func() { _ = conn.Close() }()
+	if controlType, _, err := readControlFrame(conn); err != nil || controlType != controlReady {
+		return
+	}
+	if _, err := conn.Write(appendControlFrame(nil, controlAccept, contentType)); err != nil {
+		return
+	}
+	if controlType, _, err := readControlFrame(conn); err != nil || controlType != controlStart {
+		return
+	}
+	for {
+		payload, controlType, err := readFrame(conn)
+		if err != nil {
+			return
+		}
+		if controlType == controlStop {
+			_, _ = conn.Write(appendControlFrame(nil, controlFinish))
+			return
+		}
+		frames <- payload
+	}
+}
+
+func TestControlFrame_RoundTrip(t *testing.T) {
+	frame := appendControlFrame(nil, controlReady, contentType, "other")
+	assert.Equal(t, []byte{0, 0, 0, 0}, frame[:4])
+
+	controlType, contentTypes, err := readControlFrame(bytes.NewReader(frame))
+	require.NoError(t, err)
+	assert.Equal(t, uint32(controlReady), controlType)
+	assert.Equal(t, []string{contentType, "other"}, contentTypes)
+
+	controlType, contentTypes, err = readControlFrame(bytes.NewReader(appendControlFrame(nil, controlStop)))
+	require.NoError(t, err)
+	assert.Equal(t, uint32(controlStop), controlType)
+	assert.Empty(t, contentTypes)
+}
+
+func TestReadControlFrame_Errors(t *testing.T) {
+	valid := appendControlFrame(nil, controlAccept, contentType)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"data frame", []byte{0, 0, 0, 3, 1, 2, 3, 4}},
+		{"too short", []byte{0, 0, 0, 0, 0, 0, 0, 2}},
+		{"too long", []byte{0, 0, 0, 0, 0, 0, 0x10, 0}},
+		{"truncated", valid[:len(valid)-1]},
+		{"field overrun", append(binary.BigEndian.AppendUint32([]byte{0, 0, 0, 0}, 12), 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 9)},
+		{"partial field header", append(binary.BigEndian.AppendUint32([]byte{0, 0, 0, 0}, 6), 0, 0, 0, 1, 0, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := readControlFrame(bytes.NewReader(tt.data))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	client, server := net.Pipe()
+	defer func() { _ = client.Close() }()
+	frames := make(chan []byte, 1)
+	go collect(server, frames)
+	require.NoError(t, handshake(client))
+
+	// The collector now takes data frames
+	_, err := client.Write([]byte{0, 0, 0, 1, 0x42})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x42}, <-frames)
+}
+
+func TestHandshake_Rejected(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply []byte
+		want  error
+	}{
+		{"other content type", appendControlFrame(nil, controlAccept, "protobuf:other"), errContentType},
+		{"not accept", appendControlFrame(nil, controlFinish), errUnexpectedControl},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer func() { _ = client.Close() }()
+			go func() {
+				defer func() { _ = server.Close() }()
+				if _, _, err := readControlFrame(server); err == nil {
+					_, _ = server.Write(tt.reply)
+				}
+			}()
+			assert.ErrorIs(t, handshake(client), tt.want)
+		})
+	}
+
+	client, server := net.Pipe()
+	go func() {
+		_, _, _ = readControlFrame(server)
+		_ = server.Close()
+	}()
+	assert.Error(t, handshake(client), "the collector hung up")
+}
@@ -0,0 +1,164 @@
+package dnstap
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// Field numbers of the dnstap.Dnstap message.
+const (
+	dnstapIdentity = 1
+	dnstapVersion  = 2
+	dnstapMessage  = 14
+	dnstapType     = 15
+
+	// dnstapTypeMessage is the Dnstap.Type of a frame carrying a Message.
+	dnstapTypeMessage = 1
+)
+
+// Field numbers of the dnstap.Message message.
+const (
+	messageType             = 1
+	messageSocketFamily     = 2
+	messageSocketProtocol   = 3
+	messageQueryAddress     = 4
+	messageResponseAddress  = 5
+	messageQueryPort        = 6
+	messageResponsePort     = 7
+	messageQueryTimeSec     = 8
+	messageQueryTimeNsec    = 9
+	messageQueryMessage     = 10
+	messageResponseTimeSec  = 12
+	messageResponseTimeNsec = 13
+	messageResponseMessage  = 14
+)
+
+// messageTypes maps tapped message types to dnstap Message.Type values.
+var messageTypes = map[resolver.TapMessageType]uint64{
+	resolver.TapResolverQuery:     3,
+	resolver.TapResolverResponse:  4,
+	resolver.TapClientQuery:       5,
+	resolver.TapClientResponse:    6,
+	resolver.TapForwarderQuery:    7,
+	resolver.TapForwarderResponse: 8,
+}
+
+// socketProtocols maps transport names to dnstap SocketProtocol values.
+var socketProtocols = map[string]uint64{
+	"udp": 1,
+	"tcp": 2,
+}
+
+// dnstap SocketFamily values.
+const (
+	socketFamilyINET  = 1
+	socketFamilyINET6 = 2
+)
+
+// encodeFrame returns the dnstap.Dnstap protobuf message carrying msg.
+func encodeFrame(identity, version []byte, msg resolver.TapMessage) []byte {
+	inner := encodeMessage(msg)
+	b := make([]byte, 0, len(inner)+len(identity)+len(version)+16)
+	if len(identity) > 0 {
+		b = appendBytesField(b, dnstapIdentity, identity)
+	}
+	if len(version) > 0 {
+		b = appendBytesField(b, dnstapVersion, version)
+	}
+	b = appendBytesField(b, dnstapMessage, inner)
+	return appendVarintField(b, dnstapType, dnstapTypeMessage)
+}
+
+// encodeMessage returns the dnstap.Message protobuf message for msg. The query
+// types carry the query and its time; the response types carry the response
+// and both times.
+func encodeMessage(msg resolver.TapMessage) []byte {
+	b := make([]byte, 0, len(msg.Message)+64)
+	b = appendVarintField(b, messageType, messageTypes[msg.Type])
+
+	queryIP, queryPort := splitAddr(msg.QueryAddr)
+	responseIP, responsePort := splitAddr(msg.ResponseAddr)
+	family := queryIP
+	if family == nil {
+		family = responseIP
+	}
+	switch {
+	case family == nil:
+	case family.To4() != nil:
+		b = appendVarintField(b, messageSocketFamily, socketFamilyINET)
+	default:
+		b = appendVarintField(b, messageSocketFamily, socketFamilyINET6)
+	}
+	if protocol, ok := socketProtocols[msg.Protocol]; ok {
+		b = appendVarintField(b, messageSocketProtocol, protocol)
+	}
+	if queryIP != nil {
+		b = appendBytesField(b, messageQueryAddress, ipBytes(queryIP))
+		b = appendVarintField(b, messageQueryPort, uint64(queryPort))
+	}
+	if responseIP != nil {
+		b = appendBytesField(b, messageResponseAddress, ipBytes(responseIP))
+		b = appendVarintField(b, messageResponsePort, uint64(responsePort))
+	}
+	if !msg.QueryTime.IsZero() {
+		b = appendTime(b, messageQueryTimeSec, messageQueryTimeNsec, msg.QueryTime)
+	}
+
+	switch msg.Type {
+	case resolver.TapClientResponse, resolver.TapForwarderResponse, resolver.TapResolverResponse:
+		if !msg.ResponseTime.IsZero() {
+			b = appendTime(b, messageResponseTimeSec, messageResponseTimeNsec, msg.ResponseTime)
+		}
+		b = appendBytesField(b, messageResponseMessage, msg.Message)
+	default:
+		b = appendBytesField(b, messageQueryMessage, msg.Message)
+	}
+	return b
+}
+
+// appendTime appends t as the seconds and nanoseconds fields of a timestamp.
+func appendTime(b []byte, secField, nsecField int, t time.Time) []byte {
+	//gosec:disable G115 -- message times are after the Unix epoch
+	b = appendVarintField(b, secField, uint64(t.Unix()))
+	//gosec:disable G115 -- nanoseconds within a second fit in 32 bits
+	return appendFixed32Field(b, nsecField, uint32(t.Nanosecond()))
+}
+
+// splitAddr returns the IP address and port of addr, or a nil IP when addr
+// does not carry one.
+func splitAddr(addr net.Addr) (net.IP, uint16) {
+	switch a := addr.(type) {
+	case nil:
+		return nil, 0
+	case *net.UDPAddr:
+		//gosec:disable G115 -- ports fit in 16 bits
+		return a.IP, uint16(a.Port)
+	case *net.TCPAddr:
+		//gosec:disable G115 -- ports fit in 16 bits
+		return a.IP, uint16(a.Port)
+	}
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil, 0
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, 0
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return ip, 0
+	}
+	return ip, uint16(p)
+}
+
+// ipBytes returns ip as 4 bytes for IPv4 and 16 bytes for IPv6, as dnstap expects.
+func ipBytes(ip net.IP) []byte {
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip.To16()
+}
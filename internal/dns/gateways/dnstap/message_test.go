@@ -0,0 +1,138 @@
+package dnstap
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+func TestEncodeFrame_ClientQuery(t *testing.T) {
+	queryTime := time.Date(2025, 6, 1, 12, 0, 0, 123456789, time.UTC)
+	msg := resolver.TapMessage{
+		Type:         resolver.TapClientQuery,
+		Protocol:     "udp",
+		QueryAddr:    &net.UDPAddr{IP: net.ParseIP("192.0.2.10"), Port: 40000},
+		ResponseAddr: &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 53},
+		QueryTime:    queryTime,
+		Message:      []byte{0xab, 0xcd},
+	}
+
+	frame := decodeProto(t, encodeFrame([]byte("ns1"), []byte("rr-dnsd 1.0"), msg))
+	assert.Equal(t, []byte("ns1"), frame[dnstapIdentity].bytes)
+	assert.Equal(t, []byte("rr-dnsd 1.0"), frame[dnstapVersion].bytes)
+	assert.Equal(t, uint64(dnstapTypeMessage), frame[dnstapType].varint)
+
+	m := decodeProto(t, frame[dnstapMessage].bytes)
+	assert.Equal(t, uint64(5), m[messageType].varint)
+	assert.Equal(t, uint64(socketFamilyINET), m[messageSocketFamily].varint)
+	assert.Equal(t, uint64(1), m[messageSocketProtocol].varint)
+	assert.Equal(t, []byte{192, 0, 2, 10}, m[messageQueryAddress].bytes)
+	assert.Equal(t, uint64(40000), m[messageQueryPort].varint)
+	assert.Equal(t, []byte{192, 0, 2, 1}, m[messageResponseAddress].bytes)
+	assert.Equal(t, uint64(53), m[messageResponsePort].varint)
+	assert.Equal(t, uint64(queryTime.Unix()), m[messageQueryTimeSec].varint)
+	assert.Equal(t, uint32(123456789), m[messageQueryTimeNsec].fixed)
+	assert.Equal(t, []byte{0xab, 0xcd}, m[messageQueryMessage].bytes)
+	assert.NotContains(t, m, messageResponseMessage)
+	assert.NotContains(t, m, messageResponseTimeSec)
+}
+
+func TestEncodeFrame_ForwarderResponse(t *testing.T) {
+	queryTime := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	responseTime := queryTime.Add(15 * time.Millisecond)
+	msg := resolver.TapMessage{
+		Type:         resolver.TapForwarderResponse,
+		Protocol:     "tcp",
+		QueryAddr:    &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 50000},
+		ResponseAddr: &net.TCPAddr{IP: net.ParseIP("2001:db8::53"), Port: 53},
+		QueryTime:    queryTime,
+		ResponseTime: responseTime,
+		Message:      []byte{0x01},
+	}
+
+	frame := decodeProto(t, encodeFrame(nil, nil, msg))
+	assert.NotContains(t, frame, dnstapIdentity)
+	assert.NotContains(t, frame, dnstapVersion)
+
+	m := decodeProto(t, frame[dnstapMessage].bytes)
+	assert.Equal(t, uint64(8), m[messageType].varint)
+	assert.Equal(t, uint64(socketFamilyINET6), m[messageSocketFamily].varint)
+	assert.Equal(t, uint64(2), m[messageSocketProtocol].varint)
+	assert.Equal(t, []byte(net.ParseIP("2001:db8::1")), m[messageQueryAddress].bytes)
+	assert.Equal(t, []byte(net.ParseIP("2001:db8::53")), m[messageResponseAddress].bytes)
+	assert.Equal(t, uint64(queryTime.Unix()), m[messageQueryTimeSec].varint)
+	assert.Equal(t, uint64(responseTime.Unix()), m[messageResponseTimeSec].varint)
+	assert.Equal(t, uint32(15_000_000), m[messageResponseTimeNsec].fixed)
+	assert.Equal(t, []byte{0x01}, m[messageResponseMessage].bytes)
+	assert.NotContains(t, m, messageQueryMessage)
+}
+
+func TestEncodeMessage_ResolverMessages(t *testing.T) {
+	queryTime := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	query := decodeProto(t, encodeMessage(resolver.TapMessage{
+		Type:      resolver.TapResolverQuery,
+		QueryTime: queryTime,
+		Message:   []byte{0x03},
+	}))
+	assert.Equal(t, uint64(3), query[messageType].varint)
+	assert.Equal(t, []byte{0x03}, query[messageQueryMessage].bytes)
+
+	response := decodeProto(t, encodeMessage(resolver.TapMessage{
+		Type:         resolver.TapResolverResponse,
+		QueryTime:    queryTime,
+		ResponseTime: queryTime.Add(time.Second),
+		Message:      []byte{0x04},
+	}))
+	assert.Equal(t, uint64(4), response[messageType].varint)
+	assert.Equal(t, uint64(queryTime.Unix()+1), response[messageResponseTimeSec].varint)
+	assert.Equal(t, []byte{0x04}, response[messageResponseMessage].bytes)
+	assert.NotContains(t, response, messageQueryMessage)
+}
+
+func TestEncodeMessage_UnknownAddresses(t *testing.T) {
+	m := decodeProto(t, encodeMessage(resolver.TapMessage{
+		Type:         resolver.TapForwarderQuery,
+		ResponseAddr: &net.UnixAddr{Name: "/run/dns.sock", Net: "unix"},
+		Message:      []byte{0x02},
+	}))
+	assert.Equal(t, uint64(7), m[messageType].varint)
+	for _, field := range []int{messageSocketFamily, messageSocketProtocol, messageQueryAddress, messageResponseAddress, messageQueryTimeSec} {
+		assert.NotContains(t, m, field)
+	}
+	assert.Equal(t, []byte{0x02}, m[messageQueryMessage].bytes)
+}
+
+func TestSplitAddr(t *testing.T) {
+	tests := []struct {
+		name     string
+		addr     net.Addr
+		wantIP   string
+		wantPort uint16
+	}{
+		{"nil", nil, "<nil>", 0},
+		{"udp", &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 53}, "192.0.2.1", 53},
+		{"tcp", &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 853}, "2001:db8::1", 853},
+		{"ip only", &net.IPAddr{IP: net.ParseIP("192.0.2.2")}, "<nil>", 0},
+		{"other with port", testAddr("198.51.100.7:5353"), "198.51.100.7", 5353},
+		{"other with named port", testAddr("198.51.100.7:domain"), "198.51.100.7", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, port := splitAddr(tt.addr)
+			assert.Equal(t, tt.wantIP, ip.String())
+			assert.Equal(t, tt.wantPort, port)
+		})
+	}
+	require.Len(t, ipBytes(net.ParseIP("192.0.2.1")), 4)
+}
+
+// testAddr is a net.Addr of some other network, such as a pipe.
+type testAddr string
+
+func (a testAddr) Network() string { return "test" }
+func (a testAddr) String() string  { return string(a) }
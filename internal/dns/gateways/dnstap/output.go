@@ -0,0 +1,116 @@
+package dnstap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+const (
+	// outputBufferSize is the write buffer of an output; frames are flushed
+	// when it fills up or the queue runs empty.
+	outputBufferSize = 64 << 10
+	// dialTimeout bounds connecting to a collector.
+	dialTimeout = 5 * time.Second
+	// ioTimeout bounds the handshake, each flush and the closing STOP/FINISH
+	// exchange with a collector, so a stalled collector cannot hang the writer.
+	ioTimeout = 5 * time.Second
+)
+
+// output is an open Frame Streams session: unidirectional to a file, or
+// bidirectional to a collector on a socket.
+type output struct {
+	w      *bufio.Writer
+	closer io.Closer
+	conn   net.Conn // nil for files
+}
+
+// openOutput opens a session of the given network to address. Files are
+// truncated and start with a START frame; sockets complete the handshake.
+func openOutput(network, address string) (*output, error) {
+	if network == NetworkFile {
+		//gosec:disable G304 -- the dnstap file is set by the operator
+		f, err := os.OpenFile(address, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open dnstap file: %w", err)
+		}
+		out := &output{w: bufio.NewWriterSize(f, outputBufferSize), closer: f}
+		if _, err := out.w.Write(appendControlFrame(nil, controlStart, contentType)); err != nil {
+			out.abort()
+			return nil, err
+		}
+		return out, nil
+	}
+
+	conn, err := net.DialTimeout(network, address, dialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to dnstap collector: %w", err)
+	}
+	if err := conn.SetDeadline(time.Now().Add(ioTimeout)); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if err := handshake(conn); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("dnstap handshake failed: %w", err)
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return &output{w: bufio.NewWriterSize(conn, outputBufferSize), closer: conn, conn: conn}, nil
+}
+
+// write buffers payload as a data frame.
+func (o *output) write(payload []byte) error {
+	var length [4]byte
+	//gosec:disable G115 -- dnstap frames hold one DNS message and stay far below 4 GiB
+	binary.BigEndian.PutUint32(length[:], uint32(len(payload)))
+	if _, err := o.w.Write(length[:]); err != nil {
+		return err
+	}
+	_, err := o.w.Write(payload)
+	return err
+}
+
+// flush writes the buffered frames.
+func (o *output) flush() error {
+	if o.conn != nil {
+		if err := o.conn.SetWriteDeadline(time.Now().Add(ioTimeout)); err != nil {
+			return err
+		}
+	}
+	return o.w.Flush()
+}
+
+// close ends the session with STOP, waiting for the collector's FINISH on
+// sockets, and closes the file or connection.
+func (o *output) close() error {
+	_, err := o.w.Write(appendControlFrame(nil, controlStop))
+	if err == nil {
+		err = o.flush()
+	}
+	if err == nil && o.conn != nil {
+		if err = o.conn.SetReadDeadline(time.Now().Add(ioTimeout)); err == nil {
+			var controlType uint32
+			controlType, _, err = readControlFrame(o.conn)
+			if err == nil && controlType != controlFinish {
+				err = errUnexpectedControl
+			}
+		}
+	}
+	if closeErr := o.closer.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// abort closes the file or connection without ending the session, after a
+// write failed.
+func (o *output) abort() {
+	_ = o.closer.Close()
+}
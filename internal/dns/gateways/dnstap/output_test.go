@@ -0,0 +1,98 @@
+package dnstap
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// socketPath returns a unix socket path short enough for every platform.
+func socketPath(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "dnstap")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return filepath.Join(dir, "tap.sock")
+}
+
+// listenCollector runs a collector on a listener of network, sending every
+// data frame it receives to the returned channel.
+func listenCollector(t *testing.T, network, address string) (net.Listener, chan []byte) {
+	t.Helper()
+	ln, err := net.Listen(network, address)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+	frames := make(chan []byte, 16)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go collect(conn, frames)
+		}
+	}()
+	return ln, frames
+}
+
+func TestOutput_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dnstap.fstrm")
+	require.NoError(t, os.WriteFile(path, []byte("old contents"), 0o600))
+
+	out, err := openOutput(NetworkFile, path)
+	require.NoError(t, err)
+	require.NoError(t, out.write([]byte{0x01, 0x02}))
+	require.NoError(t, out.close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	r := bytes.NewReader(data)
+	_, controlType, err := readFrame(r)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(controlStart), controlType)
+	payload, _, err := readFrame(r)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x01, 0x02}, payload)
+	_, controlType, err = readFrame(r)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(controlStop), controlType)
+	assert.Zero(t, r.Len(), "old contents are replaced")
+
+	_, err = openOutput(NetworkFile, filepath.Join(t.TempDir(), "missing", "dnstap.fstrm"))
+	assert.ErrorContains(t, err, "failed to open dnstap file")
+}
+
+func TestOutput_Socket(t *testing.T) {
+	path := socketPath(t)
+	_, frames := listenCollector(t, NetworkUnix, path)
+
+	out, err := openOutput(NetworkUnix, path)
+	require.NoError(t, err)
+	require.NoError(t, out.write([]byte{0x03}))
+	require.NoError(t, out.flush())
+	assert.Equal(t, []byte{0x03}, <-frames)
+	assert.NoError(t, out.close(), "the collector answers STOP with FINISH")
+
+	_, err = openOutput(NetworkUnix, filepath.Join(filepath.Dir(path), "absent.sock"))
+	assert.ErrorContains(t, err, "failed to connect to dnstap collector")
+}
+
+func TestOutput_HandshakeFailure(t *testing.T) {
+	ln, err := net.Listen(NetworkTCP, "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = ln.Close() }()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			_ = conn.Close()
+		}
+	}()
+
+	_, err = openOutput(NetworkTCP, ln.Addr().String())
+	assert.ErrorContains(t, err, "dnstap handshake failed")
+}
@@ -0,0 +1,37 @@
+package dnstap
+
+import (
+	"encoding/binary"
+)
+
+// Protocol Buffers wire types used by the dnstap schema.
+const (
+	wireVarint  = 0
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// appendKey appends the key of field with the given wire type.
+func appendKey(b []byte, field int, wireType int) []byte {
+	//gosec:disable G115 -- field numbers and wire types are small non-negative constants
+	return binary.AppendUvarint(b, uint64(field)<<3|uint64(wireType))
+}
+
+// appendVarintField appends field as a varint.
+func appendVarintField(b []byte, field int, v uint64) []byte {
+	b = appendKey(b, field, wireVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+// appendBytesField appends field as length-delimited bytes.
+func appendBytesField(b []byte, field int, v []byte) []byte {
+	b = appendKey(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// appendFixed32Field appends field as a little-endian fixed32.
+func appendFixed32Field(b []byte, field int, v uint32) []byte {
+	b = appendKey(b, field, wireFixed32)
+	return binary.LittleEndian.AppendUint32(b, v)
+}
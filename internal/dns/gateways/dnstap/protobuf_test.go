@@ -0,0 +1,57 @@
+package dnstap
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pbField is one decoded protobuf field.
+type pbField struct {
+	varint uint64
+	bytes  []byte
+	fixed  uint32
+}
+
+// decodeProto decodes a flat protobuf message into its fields by number.
+func decodeProto(t *testing.T, b []byte) map[int]pbField {
+	t.Helper()
+	fields := make(map[int]pbField)
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		require.Positive(t, n, "bad field key")
+		b = b[n:]
+		num := int(key >> 3)
+		switch key & 7 {
+		case wireVarint:
+			v, n := binary.Uvarint(b)
+			require.Positive(t, n, "bad varint")
+			fields[num] = pbField{varint: v}
+			b = b[n:]
+		case wireBytes:
+			length, n := binary.Uvarint(b)
+			require.Positive(t, n, "bad length")
+			b = b[n:]
+			require.LessOrEqual(t, length, uint64(len(b)))
+			fields[num] = pbField{bytes: b[:length]}
+			b = b[length:]
+		case wireFixed32:
+			require.GreaterOrEqual(t, len(b), 4)
+			fields[num] = pbField{fixed: binary.LittleEndian.Uint32(b)}
+			b = b[4:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return fields
+}
+
+func TestProtobufFields(t *testing.T) {
+	// Examples from the Protocol Buffers encoding guide
+	assert.Equal(t, []byte{0x08, 0x96, 0x01}, appendVarintField(nil, 1, 150))
+	assert.Equal(t, []byte{0x12, 0x07, 't', 'e', 's', 't', 'i', 'n', 'g'}, appendBytesField(nil, 2, []byte("testing")))
+	assert.Equal(t, []byte{0x4d, 0x01, 0x00, 0x00, 0x00}, appendFixed32Field(nil, 9, 1))
+	assert.Equal(t, []byte{0x78}, appendKey(nil, 15, wireVarint))
+}
@@ -0,0 +1,136 @@
+package iterative
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// cacheEntry holds a set of names or addresses together with their expiry.
+type cacheEntry struct {
+	values  []string
+	expires time.Time
+}
+
+// delegationCache remembers what referrals taught us: which name servers
+// serve a zone, and which addresses those name servers have. Both maps are
+// bounded; expired entries are dropped first when room is needed.
+type delegationCache struct {
+	mu    sync.Mutex
+	size  int
+	zones map[string]cacheEntry // zone -> name server names
+	addrs map[string]cacheEntry // name server name -> ip:port addresses
+}
+
+// newDelegationCache creates a cache holding up to size zones and size name server addresses.
+func newDelegationCache(size int) *delegationCache {
+	return &delegationCache{
+		size:  size,
+		zones: make(map[string]cacheEntry),
+		addrs: make(map[string]cacheEntry),
+	}
+}
+
+// putZone records the name servers of zone for ttl.
+func (c *delegationCache) putZone(zone string, nameservers []string, ttl time.Duration, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.put(c.zones, zone, nameservers, ttl, now)
+}
+
+// putAddrs records the addresses of a name server for ttl.
+func (c *delegationCache) putAddrs(nameserver string, addrs []string, ttl time.Duration, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.put(c.addrs, nameserver, addrs, ttl, now)
+}
+
+// put stores an entry, making room if the map is full. Callers hold c.mu.
+func (c *delegationCache) put(m map[string]cacheEntry, key string, values []string, ttl time.Duration, now time.Time) {
+	if ttl <= 0 || len(values) == 0 {
+		return
+	}
+	if _, ok := m[key]; !ok && len(m) >= c.size {
+		for k, e := range m {
+			if !now.Before(e.expires) {
+				delete(m, k)
+			}
+		}
+		for k := range m {
+			if len(m) < c.size {
+				break
+			}
+			delete(m, k)
+		}
+	}
+	m[key] = cacheEntry{values: values, expires: now.Add(ttl)}
+}
+
+// nameservers returns the unexpired name server names of zone.
+func (c *delegationCache) nameservers(zone string, now time.Time) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.get(c.zones, zone, now)
+}
+
+// addresses returns the unexpired addresses of a name server.
+func (c *delegationCache) addresses(nameserver string, now time.Time) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.get(c.addrs, nameserver, now)
+}
+
+// get returns the values stored under key unless they have expired. Callers hold c.mu.
+func (c *delegationCache) get(m map[string]cacheEntry, key string, now time.Time) []string {
+	e, ok := m[key]
+	if !ok {
+		return nil
+	}
+	if !now.Before(e.expires) {
+		delete(m, key)
+		return nil
+	}
+	return e.values
+}
+
+// closest returns the deepest cached zone enclosing name whose name servers
+// have known addresses, along with those addresses. ok is false when nothing
+// below the root is cached.
+func (c *delegationCache) closest(name string, now time.Time) (zone string, addrs []string, ok bool) {
+	for z := name; z != ""; z = parentZone(z) {
+		for _, ns := range c.nameservers(z, now) {
+			addrs = append(addrs, c.addresses(ns, now)...)
+		}
+		if len(addrs) > 0 {
+			return z, addrs, true
+		}
+	}
+	return "", nil, false
+}
+
+// parentZone strips the leftmost label of a canonical name; the parent of a
+// top-level domain is the root, written as "".
+func parentZone(name string) string {
+	_, parent, _ := strings.Cut(name, ".")
+	return parent
+}
+
+// inZone reports whether a canonical name equals zone or sits below it on a
+// label boundary. Every name is inside the root zone "".
+func inZone(name, zone string) bool {
+	return zone == "" || name == zone || strings.HasSuffix(name, "."+zone)
+}
+
+// childZone returns the name one label below zone on the way to name, which is
+// the next name to ask about under QNAME minimisation (RFC 9156 §3). name must
+// be inside zone; if it equals zone, it is returned unchanged.
+func childZone(zone, name string) string {
+	if name == zone {
+		return name
+	}
+	rest := name
+	if zone != "" {
+		rest = strings.TrimSuffix(name, "."+zone)
+	}
+	return name[strings.LastIndex(rest, ".")+1:]
+}
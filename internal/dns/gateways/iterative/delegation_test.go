@@ -0,0 +1,88 @@
+package iterative
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDelegationCache_PutGet(t *testing.T) {
+	now := time.Now()
+	c := newDelegationCache(10)
+
+	c.putZone("example.com", []string{"ns1.example.com"}, time.Minute, now)
+	c.putAddrs("ns1.example.com", []string{"192.0.2.53:53"}, time.Minute, now)
+	c.putZone("empty.com", nil, time.Minute, now)
+	c.putZone("expired.com", []string{"ns.expired.com"}, 0, now)
+
+	assert.Equal(t, []string{"ns1.example.com"}, c.nameservers("example.com", now))
+	assert.Equal(t, []string{"192.0.2.53:53"}, c.addresses("ns1.example.com", now.Add(59*time.Second)))
+	assert.Nil(t, c.addresses("ns1.example.com", now.Add(time.Minute)), "entry expires at its TTL")
+	assert.Nil(t, c.nameservers("empty.com", now), "empty sets are not cached")
+	assert.Nil(t, c.nameservers("expired.com", now), "zero TTL is not cached")
+	assert.Nil(t, c.nameservers("missing.com", now))
+}
+
+func TestDelegationCache_Eviction(t *testing.T) {
+	now := time.Now()
+	c := newDelegationCache(2)
+
+	c.putZone("old.com", []string{"ns.old.com"}, time.Second, now)
+	c.putZone("keep.com", []string{"ns.keep.com"}, time.Hour, now)
+	c.putZone("new.com", []string{"ns.new.com"}, time.Hour, now.Add(time.Minute))
+
+	later := now.Add(time.Minute)
+	assert.Len(t, c.zones, 2)
+	assert.Nil(t, c.nameservers("old.com", later), "expired entries are evicted first")
+	assert.NotNil(t, c.nameservers("keep.com", later))
+	assert.NotNil(t, c.nameservers("new.com", later))
+
+	// with nothing expired, some entry still makes room
+	c.putZone("third.com", []string{"ns.third.com"}, time.Hour, later)
+	assert.Len(t, c.zones, 2)
+	assert.NotNil(t, c.nameservers("third.com", later))
+
+	// updating an existing key never evicts
+	c.putZone("third.com", []string{"ns2.third.com"}, time.Hour, later)
+	assert.Len(t, c.zones, 2)
+}
+
+func TestDelegationCache_Closest(t *testing.T) {
+	now := time.Now()
+	c := newDelegationCache(10)
+	c.putZone("com", []string{"a.gtld.com"}, time.Hour, now)
+	c.putAddrs("a.gtld.com", []string{"192.0.2.1:53"}, time.Hour, now)
+	c.putZone("example.com", []string{"ns.hosting.net"}, time.Hour, now) // no known address
+
+	zone, addrs, ok := c.closest("www.example.com", now)
+	assert.True(t, ok)
+	assert.Equal(t, "com", zone, "zones without addresses are skipped")
+	assert.Equal(t, []string{"192.0.2.1:53"}, addrs)
+
+	_, _, ok = c.closest("www.example.org", now)
+	assert.False(t, ok)
+}
+
+func TestZoneHelpers(t *testing.T) {
+	assert.Equal(t, "example.com", parentZone("www.example.com"))
+	assert.Equal(t, "", parentZone("com"))
+
+	assert.True(t, inZone("www.example.com", "example.com"))
+	assert.True(t, inZone("example.com", "example.com"))
+	assert.True(t, inZone("example.com", ""))
+	assert.False(t, inZone("badexample.com", "example.com"))
+
+	tests := []struct {
+		zone, name, want string
+	}{
+		{zone: "", name: "a.b.example.com", want: "com"},
+		{zone: "com", name: "a.b.example.com", want: "example.com"},
+		{zone: "example.com", name: "a.b.example.com", want: "b.example.com"},
+		{zone: "b.example.com", name: "a.b.example.com", want: "a.b.example.com"},
+		{zone: "a.b.example.com", name: "a.b.example.com", want: "a.b.example.com"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, childZone(tt.zone, tt.name), "childZone(%q, %q)", tt.zone, tt.name)
+	}
+}
@@ -0,0 +1,112 @@
+package iterative
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/common/utils"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/gateways/upstream"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// flagRD is the recursion desired bit in the third header byte.
+const flagRD = 0x01
+
+// exchange sends a single non-recursive query to server within a trace span
+// and returns the decoded response. Truncated UDP answers are retried over
+// TCP, and the response must echo the question that was asked.
+func (r *Resolver) exchange(ctx context.Context, server string, q domain.Question, now time.Time) (domain.DNSResponse, error) {
+	ctx, span := r.tracer.Start(ctx, resolver.SpanUpstreamAttempt, resolver.SpanKindClient)
+	defer span.End()
+	span.SetAttribute(resolver.AttrServer, server)
+	span.SetAttribute(resolver.AttrQuestionName, q.Name)
+	span.SetAttribute(resolver.AttrQuestionType, q.Type.String())
+
+	resp, err := r.query(ctx, server, q, now)
+	if err != nil {
+		span.RecordError(err)
+		return domain.DNSResponse{}, err
+	}
+	span.SetAttribute(resolver.AttrResponseCode, resp.RCode.String())
+	span.SetAttribute(resolver.AttrAnswerCount, len(resp.Answers))
+	return resp, nil
+}
+
+// query sends q to server with a fresh message ID and the RD bit cleared,
+// falling back to TCP when the UDP answer is truncated.
+func (r *Resolver) query(ctx context.Context, server string, q domain.Question, now time.Time) (domain.DNSResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	q.ID = r.queryID()
+	msg, err := r.codec.EncodeQuery(q)
+	if err != nil {
+		return domain.DNSResponse{}, fmt.Errorf(errEncodeFailed, err)
+	}
+	// Authoritative servers are asked exactly what they know, never to recurse.
+	msg[2] &^= flagRD
+
+	resp, err := r.roundTrip(ctx, upstream.NetworkUDP, server, msg, q.ID, now)
+	if err == nil && resp.Truncated {
+		resp, err = r.roundTrip(ctx, upstream.NetworkTCP, server, msg, q.ID, now)
+		if err != nil {
+			return domain.DNSResponse{}, fmt.Errorf(errTCPFallback, err)
+		}
+	}
+	if err != nil {
+		return domain.DNSResponse{}, err
+	}
+
+	echoed := resp.Question
+	if utils.CanonicalDNSName(echoed.Name) != utils.CanonicalDNSName(q.Name) || echoed.Type != q.Type || echoed.Class != q.Class {
+		return domain.DNSResponse{}, fmt.Errorf(errQuestionMismatch, echoed.Name, echoed.Type, echoed.Class)
+	}
+	return resp, nil
+}
+
+// roundTrip writes msg to server over network and decodes the reply, using the
+// upstream package's datagram and length-framed stream exchanges. The query
+// and the raw reply are passed to the tap as resolver messages.
+func (r *Resolver) roundTrip(ctx context.Context, network, server string, msg []byte, id uint16, now time.Time) (domain.DNSResponse, error) {
+	conn, err := upstream.Connect(ctx, r.dial, network, server)
+	if err != nil {
+		return domain.DNSResponse{}, err
+	}
+	defer func() {
+		// ignore close error but satisfy linters
+		_ = conn.Close()
+	}()
+	// Closing the connection unblocks the read when the caller gives up early.
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	tapped := resolver.TapMessage{
+		Type:         resolver.TapResolverQuery,
+		Protocol:     network,
+		QueryAddr:    conn.LocalAddr(),
+		ResponseAddr: conn.RemoteAddr(),
+		QueryTime:    r.clock.Now(),
+		Message:      msg,
+	}
+	r.tap.Tap(tapped)
+
+	var data []byte
+	if network == upstream.NetworkTCP {
+		data, err = upstream.ExchangeStream(conn, msg)
+	} else {
+		data, err = upstream.ExchangeDatagram(conn, msg)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return domain.DNSResponse{}, ctx.Err()
+		}
+		return domain.DNSResponse{}, err
+	}
+	tapped.Type = resolver.TapResolverResponse
+	tapped.ResponseTime = r.clock.Now()
+	tapped.Message = data
+	r.tap.Tap(tapped)
+	return r.codec.DecodeResponse(data, id, now)
+}
@@ -0,0 +1,137 @@
+package iterative
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// testSpan records what is set on it.
+type testSpan struct {
+	attrs map[string]any
+	err   error
+	ended bool
+}
+
+func (s *testSpan) SetAttribute(key string, value any) { s.attrs[key] = value }
+func (s *testSpan) RecordError(err error)              { s.err = err }
+func (s *testSpan) End()                               { s.ended = true }
+
+// testTracer records every span it starts.
+type testTracer struct {
+	mu    sync.Mutex
+	names []string
+	kinds []resolver.SpanKind
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string, kind resolver.SpanKind) (context.Context, resolver.Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span := &testSpan{attrs: make(map[string]any)}
+	t.names = append(t.names, name)
+	t.kinds = append(t.kinds, kind)
+	t.spans = append(t.spans, span)
+	return ctx, span
+}
+
+// tapRecorder keeps every tapped message.
+type tapRecorder struct {
+	mu       sync.Mutex
+	messages []resolver.TapMessage
+}
+
+func (r *tapRecorder) Tap(msg resolver.TapMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, msg)
+}
+
+func (r *tapRecorder) tapped() []resolver.TapMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]resolver.TapMessage(nil), r.messages...)
+}
+
+func TestResolver_exchange_Tracing(t *testing.T) {
+	n := newTestNet(t)
+	tracer := &testTracer{}
+	r := newTestResolver(t, n, Options{Tracer: tracer})
+	q := domain.Question{Name: "www.example.com.", Type: domain.RRTypeA, Class: domain.RRClassIN}
+
+	_, err := r.exchange(context.Background(), "10.0.0.3:53", q, time.Now())
+	require.NoError(t, err)
+	_, err = r.exchange(context.Background(), "10.0.0.9:53", q, time.Now())
+	require.ErrorContains(t, err, "no route to")
+
+	require.Len(t, tracer.spans, 2)
+	assert.Equal(t, []string{resolver.SpanUpstreamAttempt, resolver.SpanUpstreamAttempt}, tracer.names)
+	assert.Equal(t, []resolver.SpanKind{resolver.SpanKindClient, resolver.SpanKindClient}, tracer.kinds)
+
+	succeeded, failed := tracer.spans[0], tracer.spans[1]
+	assert.Equal(t, map[string]any{
+		resolver.AttrServer:       "10.0.0.3:53",
+		resolver.AttrQuestionName: "www.example.com.",
+		resolver.AttrQuestionType: "A",
+		resolver.AttrResponseCode: "NOERROR",
+		resolver.AttrAnswerCount:  1,
+	}, succeeded.attrs)
+	assert.NoError(t, succeeded.err)
+	assert.Equal(t, "10.0.0.9:53", failed.attrs[resolver.AttrServer])
+	assert.ErrorContains(t, failed.err, "no route to")
+	assert.NotContains(t, failed.attrs, resolver.AttrResponseCode)
+	assert.True(t, succeeded.ended)
+	assert.True(t, failed.ended)
+}
+
+func TestResolver_exchange_Tap(t *testing.T) {
+	n := newTestNet(t)
+	clk := &clock.MockClock{CurrentTime: time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)}
+	tap := &tapRecorder{}
+	r := newTestResolver(t, n, Options{Clock: clk, Tap: tap})
+	q := domain.Question{Name: "www.example.com.", Type: domain.RRTypeA, Class: domain.RRClassIN}
+
+	_, err := r.exchange(context.Background(), "10.0.0.3:53", q, time.Now())
+	require.NoError(t, err)
+	messages := tap.tapped()
+	require.Len(t, messages, 2)
+	assert.Equal(t, resolver.TapResolverQuery, messages[0].Type)
+	assert.Equal(t, resolver.TapResolverResponse, messages[1].Type)
+	for _, msg := range messages {
+		assert.Equal(t, "udp", msg.Protocol)
+		assert.Equal(t, clk.CurrentTime, msg.QueryTime)
+		assert.NotNil(t, msg.QueryAddr)
+		assert.Equal(t, n["10.0.0.3"].udp.LocalAddr().String(), msg.ResponseAddr.String())
+		assert.NotEmpty(t, msg.Message)
+	}
+	assert.True(t, messages[0].ResponseTime.IsZero())
+	assert.Equal(t, clk.CurrentTime, messages[1].ResponseTime)
+	assert.Zero(t, messages[0].Message[2]&flagRD, "the tapped query is the one sent, without RD")
+
+	// A truncated answer is tapped before the TCP retry and its exchange
+	n["10.0.0.3"].mu.Lock()
+	n["10.0.0.3"].truncateUDP = true
+	n["10.0.0.3"].mu.Unlock()
+	tap.messages = nil
+	_, err = r.exchange(context.Background(), "10.0.0.3:53", q, time.Now())
+	require.NoError(t, err)
+	var protocols []string
+	for _, msg := range tap.tapped() {
+		protocols = append(protocols, string(msg.Type)+" "+msg.Protocol)
+	}
+	assert.Equal(t, []string{"RESOLVER_QUERY udp", "RESOLVER_RESPONSE udp", "RESOLVER_QUERY tcp", "RESOLVER_RESPONSE tcp"}, protocols)
+
+	// Nothing is tapped when the server cannot be reached
+	tap.messages = nil
+	_, err = r.exchange(context.Background(), "10.0.0.9:53", q, time.Now())
+	require.Error(t, err)
+	assert.Empty(t, tap.tapped())
+}
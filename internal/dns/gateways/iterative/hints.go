@@ -0,0 +1,20 @@
+package iterative
+
+// DefaultRootHints are the IPv4 addresses of the thirteen root name servers
+// (https://www.internic.net/domain/named.root). They only bootstrap the first
+// query; everything below the root is learned from referrals.
+var DefaultRootHints = []string{
+	"198.41.0.4:53",     // a.root-servers.net
+	"170.247.170.2:53",  // b.root-servers.net
+	"192.33.4.12:53",    // c.root-servers.net
+	"199.7.91.13:53",    // d.root-servers.net
+	"192.203.230.10:53", // e.root-servers.net
+	"192.5.5.241:53",    // f.root-servers.net
+	"192.112.36.4:53",   // g.root-servers.net
+	"198.97.190.53:53",  // h.root-servers.net
+	"192.36.148.17:53",  // i.root-servers.net
+	"192.58.128.30:53",  // j.root-servers.net
+	"193.0.14.129:53",   // k.root-servers.net
+	"199.7.83.42:53",    // l.root-servers.net
+	"202.12.27.33:53",   // m.root-servers.net
+}
@@ -0,0 +1,565 @@
+// Package iterative resolves queries itself, starting at the root name servers
+// and following referrals down to the authoritative servers for each name,
+// instead of forwarding them to a recursive upstream.
+package iterative
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/common/log"
+	"github.com/haukened/rr-dns/internal/dns/common/utils"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/gateways/upstream"
+	"github.com/haukened/rr-dns/internal/dns/gateways/wire"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// Error message constants for consistent error handling
+const (
+	errCodecRequired    = "DNS codec is required"
+	errInvalidRootHint  = "invalid root hint %q"
+	errEncodeFailed     = "encode failed: %w"
+	errTCPFallback      = "tcp fallback failed: %w"
+	errQuestionMismatch = "response question %q type %d class %d does not match query"
+	errServerRCode      = "server answered %s"
+	errLameDelegation   = "lame delegation for %q"
+	errAllServersFailed = "all %d name servers for %q failed: %w"
+	errNoNameservers    = "no usable name server addresses for %q"
+	errQueryLimit       = "exceeded %d queries resolving %q"
+	errReferralLimit    = "exceeded %d referrals resolving %q"
+	errCNAMELimit       = "exceeded %d CNAMEs resolving %q"
+	errDepthLimit       = "exceeded lookup depth %d resolving name servers for %q"
+	errQueryTimeout     = "query timeout after %v"
+)
+
+const (
+	defaultTimeout      = 2 * time.Second
+	defaultQueryTimeout = 10 * time.Second
+	defaultCacheSize    = 10000
+	defaultMaxQueries   = 64
+	defaultMaxReferrals = 16
+	defaultMaxCNAMEs    = 8
+	defaultMaxDepth     = 3
+
+	// nameserverPort is the port used for addresses learned from glue and lookups.
+	nameserverPort = "53"
+	// maxDelegationTTL caps how long a delegation or address is cached.
+	maxDelegationTTL = 24 * time.Hour
+	// minimisedQueryType is the type asked for while a name is still minimised (RFC 9156 §2.3).
+	minimisedQueryType = domain.RRTypeA
+	// nameserverAddrType is the address type used to reach name servers (IPv4 only).
+	nameserverAddrType = domain.RRTypeA
+)
+
+// Limits bounds the work a single Resolve call may do, so a hostile or broken
+// delegation chain cannot turn one client query into unbounded traffic.
+type Limits struct {
+	// MaxQueries caps the queries sent to authoritative servers per Resolve,
+	// including those needed to find glueless name servers (default 64).
+	MaxQueries int
+	// MaxReferrals caps the referrals followed for a single name (default 16).
+	MaxReferrals int
+	// MaxCNAMEs caps the CNAME targets chased into other zones (default 8).
+	MaxCNAMEs int
+	// MaxDepth caps nested lookups of glueless name server addresses (default 3).
+	MaxDepth int
+}
+
+// withDefaults replaces non-positive limits with their defaults.
+func (l Limits) withDefaults() Limits {
+	if l.MaxQueries <= 0 {
+		l.MaxQueries = defaultMaxQueries
+	}
+	if l.MaxReferrals <= 0 {
+		l.MaxReferrals = defaultMaxReferrals
+	}
+	if l.MaxCNAMEs <= 0 {
+		l.MaxCNAMEs = defaultMaxCNAMEs
+	}
+	if l.MaxDepth <= 0 {
+		l.MaxDepth = defaultMaxDepth
+	}
+	return l
+}
+
+// Resolver performs iterative resolution from the root hints. It implements
+// resolver.UpstreamClient, so it can stand in for the forwarding upstream
+// client without the service layer noticing.
+type Resolver struct {
+	hints        []string            // Root server addresses (ip:port)
+	codec        wire.DNSCodec       // Codec for encoding/decoding DNS messages
+	dial         upstream.DialFunc   // Dial function to create network connections
+	timeout      time.Duration       // Timeout for a single exchange with one server
+	queryTimeout time.Duration       // Default deadline for a whole Resolve call
+	minimise     bool                // Whether QNAME minimisation is enabled
+	limits       Limits              // Work limits per Resolve call
+	cache        *delegationCache    // Learned delegations and name server addresses
+	queryID      func() uint16       // Generates the message ID of each query
+	clock        clock.Clock         // Time source for the query deadline and tapped message times
+	tracer       resolver.Tracer     // Records a span around each query sent to a server
+	tap          resolver.MessageTap // Receives copies of the queries sent and responses received
+	logger       log.Logger
+}
+
+// Options defines configuration parameters for the iterative resolver.
+type Options struct {
+	// RootHints are the root server addresses in ip:port format (default: DefaultRootHints).
+	RootHints []string
+	// Timeout bounds a single exchange with one server (default: 2s).
+	Timeout time.Duration
+	// QueryTimeout bounds a whole Resolve call when the context has no deadline (default: 10s).
+	QueryTimeout time.Duration
+	// QNAMEMinimisation sends each server only the labels it needs to see (RFC 9156).
+	QNAMEMinimisation bool
+	// Limits bounds the work done per query; zero values use the defaults.
+	Limits Limits
+	// CacheSize bounds the number of cached delegations and name server addresses (default: 10000).
+	CacheSize int
+	// Tracer records a client span around each query sent to a name server.
+	// Defaults to resolver.NopTracer.
+	Tracer resolver.Tracer
+	// Tap receives a copy of every query sent to a name server and every
+	// response received, as resolver messages. Defaults to resolver.NopTap.
+	Tap resolver.MessageTap
+	// options to inject for testing purposes
+	Codec   wire.DNSCodec
+	Dial    upstream.DialFunc
+	Clock   clock.Clock
+	Logger  log.Logger
+	QueryID func() uint16
+}
+
+// NewResolver creates an iterative resolver with the specified options.
+// Returns an error if the codec is missing or a root hint is not an ip:port address.
+func NewResolver(opts Options) (*Resolver, error) {
+	if opts.Codec == nil {
+		return nil, errors.New(errCodecRequired)
+	}
+	if len(opts.RootHints) == 0 {
+		opts.RootHints = DefaultRootHints
+	}
+	for _, hint := range opts.RootHints {
+		if _, err := netip.ParseAddrPort(hint); err != nil {
+			return nil, fmt.Errorf(errInvalidRootHint, hint)
+		}
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.QueryTimeout <= 0 {
+		opts.QueryTimeout = defaultQueryTimeout
+	}
+	if opts.CacheSize <= 0 {
+		opts.CacheSize = defaultCacheSize
+	}
+	if opts.Dial == nil {
+		opts.Dial = upstream.DialRandomPort
+	}
+	if opts.Clock == nil {
+		opts.Clock = &clock.RealClock{}
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.NewNoopLogger()
+	}
+	if opts.QueryID == nil {
+		opts.QueryID = upstream.RandomQueryID
+	}
+	if opts.Tracer == nil {
+		opts.Tracer = resolver.NopTracer{}
+	}
+	if opts.Tap == nil {
+		opts.Tap = resolver.NopTap{}
+	}
+	return &Resolver{
+		hints:        slices.Clone(opts.RootHints),
+		codec:        opts.Codec,
+		dial:         opts.Dial,
+		timeout:      opts.Timeout,
+		queryTimeout: opts.QueryTimeout,
+		minimise:     opts.QNAMEMinimisation,
+		limits:       opts.Limits.withDefaults(),
+		cache:        newDelegationCache(opts.CacheSize),
+		queryID:      opts.QueryID,
+		clock:        opts.Clock,
+		tracer:       opts.Tracer,
+		tap:          opts.Tap,
+		logger:       opts.Logger,
+	}, nil
+}
+
+// RootHints returns the root server addresses the resolver starts from.
+func (r *Resolver) RootHints() []string {
+	return slices.Clone(r.hints)
+}
+
+// Resolve walks the delegation chain for query and returns the answer,
+// following CNAMEs into other zones. The response carries the RCODE of the
+// last authoritative answer, so NXDOMAIN and NODATA come back without error,
+// and that zone's SOA record in its authority section.
+func (r *Resolver) Resolve(ctx context.Context, query domain.Question, now time.Time) (domain.DNSResponse, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.queryTimeout)
+		defer cancel()
+	}
+	l := &lookup{r: r, now: now}
+	resp, err := l.resolve(ctx, query, 0)
+	if err != nil {
+		// A socket deadline can fire a moment before the context notices, so
+		// compare against the deadline itself rather than only ctx.Err().
+		if deadline, _ := ctx.Deadline(); !r.clock.Now().Before(deadline) {
+			return domain.DNSResponse{}, fmt.Errorf(errQueryTimeout+": %w", r.queryTimeout, err)
+		}
+		return domain.DNSResponse{}, err
+	}
+	resp.ID, resp.Question = query.ID, query
+	return resp, nil
+}
+
+// lookup carries the state of one Resolve call, shared by the nested lookups
+// of glueless name server addresses so they draw on the same query budget.
+type lookup struct {
+	r       *Resolver
+	now     time.Time
+	queries int
+}
+
+// resolve answers q, chasing CNAME targets that lie outside the zone that answered.
+// The answer holds the records of the whole chain and the RCODE and authority
+// section of its last link. depth counts how deeply this lookup is nested
+// inside name server address lookups.
+func (l *lookup) resolve(ctx context.Context, q domain.Question, depth int) (domain.DNSResponse, error) {
+	name := utils.CanonicalDNSName(q.Name)
+	var records []domain.ResourceRecord
+	for cnames := 0; ; cnames++ {
+		answer, err := l.iterate(ctx, name, q.Type, q.Class, depth)
+		if err != nil {
+			return domain.DNSResponse{}, err
+		}
+		records = append(records, answer.Answers...)
+		target, ok := danglingCNAME(name, q.Type, answer.Answers)
+		if !ok {
+			answer.Answers = records
+			return answer, nil
+		}
+		if cnames == l.r.limits.MaxCNAMEs {
+			return domain.DNSResponse{}, fmt.Errorf(errCNAMELimit, l.r.limits.MaxCNAMEs, q.Name)
+		}
+		name = target
+	}
+}
+
+// iterate follows referrals from the closest known delegation of name down to
+// the servers authoritative for it and returns their answer, as finalAnswer keeps it.
+func (l *lookup) iterate(ctx context.Context, name string, qtype domain.RRType, qclass domain.RRClass, depth int) (domain.DNSResponse, error) {
+	zone, servers, ok := l.r.cache.closest(name, l.now)
+	if !ok {
+		zone, servers = "", l.r.hints
+	}
+	qname := l.nextName(zone, name)
+	for referrals := 0; ; {
+		asked := qtype
+		if qname != name {
+			// RFC 9156 §2.3: ask for A records while hiding the rest of the name.
+			asked = minimisedQueryType
+		}
+		resp, err := l.ask(ctx, zone, servers, domain.Question{Name: qname, Type: asked, Class: qclass})
+		if err != nil {
+			if qname != name && ctx.Err() == nil {
+				// Some servers mishandle minimised queries; fall back to the full name.
+				qname = name
+				continue
+			}
+			return domain.DNSResponse{}, err
+		}
+
+		if child, nameservers, ttl, ok := referral(resp, zone, qname, l.now); ok {
+			referrals++
+			if referrals > l.r.limits.MaxReferrals {
+				return domain.DNSResponse{}, fmt.Errorf(errReferralLimit, l.r.limits.MaxReferrals, name)
+			}
+			l.r.cache.putZone(child, nameservers, ttl, l.now)
+			l.cacheGlue(resp, zone, nameservers)
+			servers, err = l.addresses(ctx, child, nameservers, depth)
+			if err != nil {
+				return domain.DNSResponse{}, err
+			}
+			l.r.logger.Debug(map[string]any{
+				"zone":        child,
+				"nameservers": nameservers,
+				"query":       name,
+			}, "Following referral")
+			zone = child
+			qname = l.nextName(zone, name)
+			continue
+		}
+
+		if qname != name {
+			if resp.RCode == domain.NXDOMAIN {
+				// Nothing exists below a name that does not exist (RFC 8020).
+				return finalAnswer(resp, name, zone), nil
+			}
+			// No zone cut here; reveal one more label to the same servers.
+			qname = childZone(qname, name)
+			continue
+		}
+		return finalAnswer(resp, name, zone), nil
+	}
+}
+
+// finalAnswer keeps what a client needs from resp, the authoritative answer
+// for name from the servers of zone: its RCODE, the answer records kept by
+// answerRecords, and the SOA record of the zone holding name, which sets how
+// long an empty answer may be cached.
+func finalAnswer(resp domain.DNSResponse, name, zone string) domain.DNSResponse {
+	answer := domain.DNSResponse{RCode: resp.RCode}
+	if resp.RCode == domain.NOERROR {
+		answer.Answers = answerRecords(resp.Answers, name, zone)
+	}
+	for _, rr := range resp.Authority {
+		owner := utils.CanonicalDNSName(rr.Name)
+		if rr.Type == domain.RRTypeSOA && inZone(owner, zone) && inZone(name, owner) {
+			answer.Authority = append(answer.Authority, rr)
+		}
+	}
+	return answer
+}
+
+// nextName returns the name to send to the servers of zone: the full name, or
+// with QNAME minimisation only one label more than zone.
+func (l *lookup) nextName(zone, name string) string {
+	if !l.r.minimise {
+		return name
+	}
+	return childZone(zone, name)
+}
+
+// ask sends q to the servers of zone in random order until one gives a usable
+// answer. Servers that fail, refuse, or point back up the tree are skipped.
+func (l *lookup) ask(ctx context.Context, zone string, servers []string, q domain.Question) (domain.DNSResponse, error) {
+	servers = slices.Clone(servers)
+	//gosec:disable G404 -- server order only spreads load, it is not a security boundary
+	rand.Shuffle(len(servers), func(i, j int) { servers[i], servers[j] = servers[j], servers[i] })
+
+	var lastErr error
+	for _, server := range servers {
+		if l.queries == l.r.limits.MaxQueries {
+			return domain.DNSResponse{}, fmt.Errorf(errQueryLimit, l.r.limits.MaxQueries, q.Name)
+		}
+		l.queries++
+		resp, err := l.r.exchange(ctx, server, q, l.now)
+		if err == nil {
+			err = checkResponse(resp, zone)
+		}
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return domain.DNSResponse{}, ctx.Err()
+		}
+		l.r.logger.Debug(map[string]any{
+			"server": server,
+			"zone":   zone,
+			"query":  q.Name,
+			"error":  err,
+		}, "Name server failed")
+		lastErr = err
+	}
+	if lastErr == nil {
+		return domain.DNSResponse{}, fmt.Errorf(errNoNameservers, zone)
+	}
+	return domain.DNSResponse{}, fmt.Errorf(errAllServersFailed, len(servers), zone, lastErr)
+}
+
+// checkResponse rejects answers that cannot be used: server errors, and
+// referrals that do not lead further down from zone (lame delegations).
+func checkResponse(resp domain.DNSResponse, zone string) error {
+	if resp.RCode != domain.NOERROR && resp.RCode != domain.NXDOMAIN {
+		return fmt.Errorf(errServerRCode, resp.RCode)
+	}
+	if resp.RCode != domain.NOERROR || len(resp.Answers) > 0 {
+		return nil
+	}
+	hasNS := false
+	for _, rr := range resp.Authority {
+		switch rr.Type {
+		case domain.RRTypeSOA:
+			return nil // negative answer
+		case domain.RRTypeNS:
+			owner := utils.CanonicalDNSName(rr.Name)
+			if owner != zone && inZone(owner, zone) {
+				return nil // downward referral
+			}
+			hasNS = true
+		}
+	}
+	if hasNS {
+		return fmt.Errorf(errLameDelegation, zone)
+	}
+	return nil
+}
+
+// referral extracts a delegation from resp: the deepest NS RRset in the
+// authority section that lies below zone and encloses qname, with the TTL it
+// has left at now. Anything else in the authority section is ignored, so a
+// server cannot redirect queries for names outside its own zone.
+func referral(resp domain.DNSResponse, zone, qname string, now time.Time) (child string, nameservers []string, ttl time.Duration, ok bool) {
+	if resp.RCode != domain.NOERROR || len(resp.Answers) > 0 {
+		return "", nil, 0, false
+	}
+	for _, rr := range resp.Authority {
+		owner := utils.CanonicalDNSName(rr.Name)
+		if rr.Type != domain.RRTypeNS || owner == zone || !inZone(owner, zone) || !inZone(qname, owner) {
+			continue
+		}
+		if !ok || len(owner) > len(child) {
+			child, nameservers, ttl, ok = owner, nil, maxDelegationTTL, true
+		}
+		if owner != child {
+			continue
+		}
+		if ns := utils.CanonicalDNSName(rr.Text); !slices.Contains(nameservers, ns) {
+			nameservers = append(nameservers, ns)
+		}
+		ttl = min(ttl, rr.TTLRemaining(now))
+	}
+	return child, nameservers, ttl, ok && len(nameservers) > 0
+}
+
+// cacheGlue stores the A records in resp's additional section that belong to
+// nameservers. Glue is only trusted inside zone, the zone of the server that
+// sent it; anything else would let one zone's servers hijack another's.
+func (l *lookup) cacheGlue(resp domain.DNSResponse, zone string, nameservers []string) {
+	glue := make(map[string][]string)
+	ttls := make(map[string]time.Duration)
+	for _, rr := range resp.Additional {
+		owner := utils.CanonicalDNSName(rr.Name)
+		if rr.Type != nameserverAddrType || !inZone(owner, zone) || !slices.Contains(nameservers, owner) {
+			continue
+		}
+		glue[owner] = append(glue[owner], net.JoinHostPort(rr.Text, nameserverPort))
+		if ttl, seen := ttls[owner]; !seen || rr.TTLRemaining(l.now) < ttl {
+			ttls[owner] = rr.TTLRemaining(l.now)
+		}
+	}
+	for ns, addrs := range glue {
+		l.r.cache.putAddrs(ns, addrs, min(ttls[ns], maxDelegationTTL), l.now)
+	}
+}
+
+// addresses returns the addresses of the name servers of zone. Cached and
+// glue addresses are used when present; otherwise the name servers' own
+// names are resolved (glueless delegation), skipping names inside zone itself,
+// which could only be found by asking the servers being looked for.
+func (l *lookup) addresses(ctx context.Context, zone string, nameservers []string, depth int) ([]string, error) {
+	var addrs []string
+	for _, ns := range nameservers {
+		addrs = append(addrs, l.r.cache.addresses(ns, l.now)...)
+	}
+	if len(addrs) > 0 {
+		return addrs, nil
+	}
+	if depth >= l.r.limits.MaxDepth {
+		return nil, fmt.Errorf(errDepthLimit, l.r.limits.MaxDepth, zone)
+	}
+	var lastErr error
+	for _, ns := range nameservers {
+		if inZone(ns, zone) {
+			continue
+		}
+		answer, err := l.resolve(ctx, domain.Question{Name: ns, Type: nameserverAddrType, Class: domain.RRClassIN}, depth+1)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			lastErr = err
+			continue
+		}
+		ttl := maxDelegationTTL
+		for _, rr := range answer.Answers {
+			if rr.Type == nameserverAddrType {
+				addrs = append(addrs, net.JoinHostPort(rr.Text, nameserverPort))
+				ttl = min(ttl, rr.TTLRemaining(l.now))
+			}
+		}
+		if len(addrs) > 0 {
+			l.r.cache.putAddrs(ns, addrs, ttl, l.now)
+			return addrs, nil
+		}
+	}
+	if lastErr != nil {
+		return nil, fmt.Errorf(errNoNameservers+": %w", zone, lastErr)
+	}
+	return nil, fmt.Errorf(errNoNameservers, zone)
+}
+
+// answerRecords keeps the answers that belong to name's CNAME chain and lie
+// inside zone, the zone the answering server is authoritative for. Records
+// for names in other zones are dropped and, if needed, resolved separately.
+func answerRecords(answers []domain.ResourceRecord, name, zone string) []domain.ResourceRecord {
+	chain := map[string]bool{name: true}
+	for grew := true; grew; {
+		grew = false
+		for _, rr := range answers {
+			owner := utils.CanonicalDNSName(rr.Name)
+			if rr.Type != domain.RRTypeCNAME || !chain[owner] || !inZone(owner, zone) {
+				continue
+			}
+			if target := utils.CanonicalDNSName(rr.Text); !chain[target] {
+				chain[target] = true
+				grew = true
+			}
+		}
+	}
+	var kept []domain.ResourceRecord
+	for _, rr := range answers {
+		owner := utils.CanonicalDNSName(rr.Name)
+		if chain[owner] && inZone(owner, zone) {
+			kept = append(kept, rr)
+		}
+	}
+	return kept
+}
+
+// danglingCNAME follows the CNAME chain from name through answers and reports
+// the last target when it still has to be resolved: the chain ends on a name
+// that has neither records of qtype nor a further CNAME in answers.
+func danglingCNAME(name string, qtype domain.RRType, answers []domain.ResourceRecord) (string, bool) {
+	if qtype == domain.RRTypeCNAME || qtype == domain.RRTypeANY {
+		return "", false
+	}
+	seen := make(map[string]bool)
+	for current := name; !seen[current]; {
+		seen[current] = true
+		next := ""
+		for _, rr := range answers {
+			if utils.CanonicalDNSName(rr.Name) != current {
+				continue
+			}
+			if rr.Type == qtype {
+				return "", false
+			}
+			if rr.Type == domain.RRTypeCNAME {
+				next = utils.CanonicalDNSName(rr.Text)
+			}
+		}
+		if next == "" {
+			if current == name {
+				return "", false
+			}
+			return current, true
+		}
+		current = next
+	}
+	return "", false // the chain loops back on itself
+}
+
+var _ resolver.UpstreamClient = (*Resolver)(nil)
@@ -0,0 +1,641 @@
+package iterative
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/common/log"
+	"github.com/haukened/rr-dns/internal/dns/common/rrdata"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/gateways/upstream"
+	"github.com/haukened/rr-dns/internal/dns/gateways/wire"
+)
+
+// testRR builds a resource record from its presentation form.
+func testRR(t *testing.T, name string, rrtype domain.RRType, text string) domain.ResourceRecord {
+	t.Helper()
+	data, err := rrdata.Encode(rrtype, text)
+	require.NoError(t, err)
+	rr, err := domain.NewAuthoritativeResourceRecord(name, rrtype, domain.RRClassIN, 300, data, text)
+	require.NoError(t, err)
+	return rr
+}
+
+// authServer is an in-process authoritative name server listening on
+// loopback. It answers from a fixed record set for the zones it serves,
+// giving referrals for any delegation (non-apex NS RRset) on the way to the
+// query name, the way a real authoritative server does.
+type authServer struct {
+	t       *testing.T
+	codec   wire.DNSCodec
+	zones   []string
+	records []domain.ResourceRecord
+	udp     net.PacketConn
+	tcp     net.Listener
+
+	mu sync.Mutex // guards the switches and the query log below
+
+	// behaviour switches for failure scenarios
+	truncateUDP bool         // answer UDP with TC set so the client must retry over TCP
+	rcode       domain.RCode // answer every query with this RCODE when non-zero
+	lame        bool         // answer with an upward referral to com
+	echoName    string       // echo this name in the question section instead of the real one
+
+	queries []string // "name type" of every query received
+	rd      []bool   // RD bit of every query received
+}
+
+// startAuthServer starts a server for zones with the given records on 127.0.0.1.
+func startAuthServer(t *testing.T, zones []string, records []domain.ResourceRecord) *authServer {
+	t.Helper()
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &authServer{t: t, codec: wire.NewUDPCodec(log.NewNoopLogger()), zones: zones, records: records, udp: udp, tcp: tcp}
+	t.Cleanup(func() {
+		_ = udp.Close()
+		_ = tcp.Close()
+	})
+	go s.serveUDP()
+	go s.serveTCP()
+	return s
+}
+
+func (s *authServer) serveUDP() {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		reply := s.handle(buf[:n], true)
+		if reply != nil {
+			_, _ = s.udp.WriteTo(reply, addr)
+		}
+	}
+}
+
+func (s *authServer) serveTCP() {
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer func() { _ = conn.Close() }()
+			var prefix [2]byte
+			if _, err := io.ReadFull(conn, prefix[:]); err != nil {
+				return
+			}
+			msg := make([]byte, int(prefix[0])<<8|int(prefix[1]))
+			if _, err := io.ReadFull(conn, msg); err != nil {
+				return
+			}
+			reply := s.handle(msg, false)
+			_, _ = conn.Write(append([]byte{byte(len(reply) >> 8), byte(len(reply))}, reply...))
+		}()
+	}
+}
+
+// handle builds the reply to a raw query message received over UDP or TCP.
+func (s *authServer) handle(msg []byte, udp bool) []byte {
+	q, err := s.codec.DecodeQuery(msg)
+	if err != nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries = append(s.queries, q.Name+" "+q.Type.String())
+	s.rd = append(s.rd, msg[2]&0x01 != 0)
+	truncate := udp && s.truncateUDP
+
+	resp := s.answer(q)
+	resp.ID = q.ID
+	resp.Question = q
+	if s.echoName != "" {
+		resp.Question.Name = s.echoName
+	}
+	if truncate {
+		resp.Answers, resp.Authority, resp.Additional = nil, nil, nil
+	}
+	data, err := s.codec.EncodeResponse(resp)
+	require.NoError(s.t, err)
+	if truncate {
+		data[2] |= 0x02
+	}
+	return data
+}
+
+// answer looks q up in the server's records.
+func (s *authServer) answer(q domain.Question) domain.DNSResponse {
+	if s.rcode != domain.NOERROR {
+		return domain.DNSResponse{RCode: s.rcode}
+	}
+	name := strings.ToLower(q.Name)
+	zone, ok := "", false
+	for _, z := range s.zones {
+		if inZone(name, z) && (!ok || len(z) > len(zone)) {
+			zone, ok = z, true
+		}
+	}
+	if !ok {
+		return domain.DNSResponse{RCode: domain.REFUSED}
+	}
+	if s.lame {
+		return domain.DNSResponse{Authority: []domain.ResourceRecord{testRR(s.t, "com", domain.RRTypeNS, "a.gtld.com")}}
+	}
+
+	// Referral: the deepest delegation between the zone apex and the query name.
+	cut := ""
+	for _, rr := range s.records {
+		if rr.Type == domain.RRTypeNS && rr.Name != zone && inZone(name, rr.Name) && len(rr.Name) > len(cut) {
+			cut = rr.Name
+		}
+	}
+	if cut != "" {
+		var resp domain.DNSResponse
+		for _, rr := range s.records {
+			if rr.Type == domain.RRTypeNS && rr.Name == cut {
+				resp.Authority = append(resp.Authority, rr)
+				for _, glue := range s.records {
+					if glue.Type == domain.RRTypeA && glue.Name == rr.Text {
+						resp.Additional = append(resp.Additional, glue)
+					}
+				}
+			}
+		}
+		return resp
+	}
+
+	var resp domain.DNSResponse
+	exists := false
+	for _, rr := range s.records {
+		if inZone(rr.Name, name) {
+			exists = true // the name itself or an empty non-terminal above existing names
+		}
+		if rr.Name == name && (rr.Type == q.Type || rr.Type == domain.RRTypeCNAME) {
+			resp.Answers = append(resp.Answers, rr)
+		}
+	}
+	if len(resp.Answers) > 0 {
+		return resp
+	}
+	resp.Authority = []domain.ResourceRecord{testRR(s.t, zone, domain.RRTypeSOA, "ns."+zone+" hostmaster."+zone+" 1 3600 600 86400 300")}
+	if !exists {
+		resp.RCode = domain.NXDOMAIN
+	}
+	return resp
+}
+
+// seen returns the queries the server has received so far.
+func (s *authServer) seen() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.queries...)
+}
+
+// testNet maps the made-up addresses used in glue and root hints onto the
+// loopback servers, so delegations can use realistic port-53 addresses.
+type testNet map[string]*authServer
+
+func (n testNet) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := n[host]
+	if !ok {
+		return nil, errors.New("no route to " + address)
+	}
+	target := s.udp.LocalAddr().String()
+	if network == upstream.NetworkTCP {
+		target = s.tcp.Addr().String()
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, network, target)
+}
+
+// newTestNet builds a small DNS tree:
+//
+//	.            root         10.0.0.1
+//	com.         gtld         10.0.0.2
+//	example.com. example      10.0.0.3  (glue from com)
+//	net.         nic          10.0.0.5
+//	hosting.net. hosting      10.0.0.4  (glue from net; also serves glueless.com)
+//	glueless.com              delegated to ns.hosting.net without glue
+func newTestNet(t *testing.T) testNet {
+	root := startAuthServer(t, []string{""}, []domain.ResourceRecord{
+		testRR(t, "com", domain.RRTypeNS, "a.gtld.com"),
+		testRR(t, "a.gtld.com", domain.RRTypeA, "10.0.0.2"),
+		testRR(t, "net", domain.RRTypeNS, "a.nic.net"),
+		testRR(t, "a.nic.net", domain.RRTypeA, "10.0.0.5"),
+	})
+	gtld := startAuthServer(t, []string{"com"}, []domain.ResourceRecord{
+		testRR(t, "example.com", domain.RRTypeNS, "ns1.example.com"),
+		testRR(t, "ns1.example.com", domain.RRTypeA, "10.0.0.3"),
+		testRR(t, "glueless.com", domain.RRTypeNS, "ns.hosting.net"),
+	})
+	example := startAuthServer(t, []string{"example.com"}, []domain.ResourceRecord{
+		testRR(t, "example.com", domain.RRTypeNS, "ns1.example.com"),
+		testRR(t, "ns1.example.com", domain.RRTypeA, "10.0.0.3"),
+		testRR(t, "www.example.com", domain.RRTypeA, "192.0.2.1"),
+		testRR(t, "mail.example.com", domain.RRTypeA, "192.0.2.25"),
+		testRR(t, "a.b.c.example.com", domain.RRTypeA, "192.0.2.9"),
+		testRR(t, "alias.example.com", domain.RRTypeCNAME, "www.hosting.net"),
+		testRR(t, "loop.example.com", domain.RRTypeCNAME, "loop.hosting.net"),
+	})
+	nic := startAuthServer(t, []string{"net"}, []domain.ResourceRecord{
+		testRR(t, "hosting.net", domain.RRTypeNS, "ns.hosting.net"),
+		testRR(t, "ns.hosting.net", domain.RRTypeA, "10.0.0.4"),
+	})
+	hosting := startAuthServer(t, []string{"hosting.net", "glueless.com"}, []domain.ResourceRecord{
+		testRR(t, "hosting.net", domain.RRTypeNS, "ns.hosting.net"),
+		testRR(t, "ns.hosting.net", domain.RRTypeA, "10.0.0.4"),
+		testRR(t, "www.hosting.net", domain.RRTypeA, "192.0.2.2"),
+		testRR(t, "loop.hosting.net", domain.RRTypeCNAME, "loop.example.com"),
+		testRR(t, "glueless.com", domain.RRTypeNS, "ns.hosting.net"),
+		testRR(t, "www.glueless.com", domain.RRTypeA, "192.0.2.3"),
+	})
+	return testNet{"10.0.0.1": root, "10.0.0.2": gtld, "10.0.0.3": example, "10.0.0.4": hosting, "10.0.0.5": nic}
+}
+
+func newTestResolver(t *testing.T, n testNet, opts Options) *Resolver {
+	t.Helper()
+	opts.RootHints = []string{"10.0.0.1:53"}
+	opts.Codec = wire.NewUDPCodec(log.NewNoopLogger())
+	opts.Dial = n.dial
+	if opts.Timeout == 0 {
+		opts.Timeout = time.Second
+	}
+	r, err := NewResolver(opts)
+	require.NoError(t, err)
+	return r
+}
+
+func answerTexts(records []domain.ResourceRecord) []string {
+	texts := []string{}
+	for _, rr := range records {
+		texts = append(texts, rr.Name+" "+rr.Type.String()+" "+rr.Text)
+	}
+	return texts
+}
+
+func TestNewResolver(t *testing.T) {
+	codec := wire.NewUDPCodec(log.NewNoopLogger())
+
+	_, err := NewResolver(Options{})
+	assert.EqualError(t, err, errCodecRequired)
+
+	_, err = NewResolver(Options{Codec: codec, RootHints: []string{"a.root-servers.net:53"}})
+	assert.ErrorContains(t, err, "invalid root hint")
+
+	r, err := NewResolver(Options{Codec: codec})
+	require.NoError(t, err)
+	assert.Equal(t, DefaultRootHints, r.hints)
+	assert.Equal(t, defaultTimeout, r.timeout)
+	assert.Equal(t, defaultQueryTimeout, r.queryTimeout)
+	assert.Equal(t, Limits{MaxQueries: 64, MaxReferrals: 16, MaxCNAMEs: 8, MaxDepth: 3}, r.limits)
+	assert.NotNil(t, r.dial)
+	assert.NotNil(t, r.queryID)
+}
+
+func TestResolver_Resolve(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		query string
+		qtype domain.RRType
+		want  []string
+	}{
+		{
+			name:  "referrals with glue",
+			query: "www.example.com.",
+			qtype: domain.RRTypeA,
+			want:  []string{"www.example.com A 192.0.2.1"},
+		},
+		{
+			name:  "glueless delegation",
+			query: "www.glueless.com.",
+			qtype: domain.RRTypeA,
+			want:  []string{"www.glueless.com A 192.0.2.3"},
+		},
+		{
+			name:  "cname into another zone",
+			query: "alias.example.com.",
+			qtype: domain.RRTypeA,
+			want:  []string{"alias.example.com CNAME www.hosting.net", "www.hosting.net A 192.0.2.2"},
+		},
+		{
+			name:  "deep name below empty non-terminals",
+			query: "a.b.c.example.com.",
+			qtype: domain.RRTypeA,
+			want:  []string{"a.b.c.example.com A 192.0.2.9"},
+		},
+		{
+			name:  "nxdomain",
+			query: "missing.example.com.",
+			qtype: domain.RRTypeA,
+			want:  []string{},
+		},
+		{
+			name:  "nodata",
+			query: "www.example.com.",
+			qtype: domain.RRTypeAAAA,
+			want:  []string{},
+		},
+	}
+	for _, minimise := range []bool{true, false} {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				r := newTestResolver(t, newTestNet(t), Options{QNAMEMinimisation: minimise})
+				answer, err := r.Resolve(context.Background(), domain.Question{ID: 7, Name: tt.query, Type: tt.qtype, Class: domain.RRClassIN}, now)
+				records := answer.Answers
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, answerTexts(records))
+			})
+		}
+	}
+}
+
+func TestResolver_Resolve_QNAMEMinimisation(t *testing.T) {
+	now := time.Now()
+	query := domain.Question{Name: "a.b.c.example.com.", Type: domain.RRTypeAAAA, Class: domain.RRClassIN}
+
+	n := newTestNet(t)
+	r := newTestResolver(t, n, Options{QNAMEMinimisation: true})
+	_, err := r.Resolve(context.Background(), query, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"com A"}, n["10.0.0.1"].seen(), "root only learns the TLD")
+	assert.Equal(t, []string{"example.com A"}, n["10.0.0.2"].seen(), "TLD only learns the registered name")
+	assert.Equal(t, []string{"c.example.com A", "b.c.example.com A", "a.b.c.example.com AAAA"}, n["10.0.0.3"].seen())
+
+	n = newTestNet(t)
+	r = newTestResolver(t, n, Options{QNAMEMinimisation: false})
+	_, err = r.Resolve(context.Background(), query, now)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.b.c.example.com AAAA"}, n["10.0.0.1"].seen())
+}
+
+func TestResolver_Resolve_DelegationCache(t *testing.T) {
+	now := time.Now()
+	n := newTestNet(t)
+	r := newTestResolver(t, n, Options{})
+
+	_, err := r.Resolve(context.Background(), domain.Question{Name: "www.example.com.", Type: domain.RRTypeA, Class: domain.RRClassIN}, now)
+	require.NoError(t, err)
+	answer, err := r.Resolve(context.Background(), domain.Question{Name: "mail.example.com.", Type: domain.RRTypeA, Class: domain.RRClassIN}, now.Add(time.Minute))
+	records := answer.Answers
+	require.NoError(t, err)
+	assert.Equal(t, []string{"mail.example.com A 192.0.2.25"}, answerTexts(records))
+	assert.Len(t, n["10.0.0.1"].seen(), 1, "cached delegation skips the root")
+	assert.Len(t, n["10.0.0.2"].seen(), 1, "cached delegation skips the TLD")
+
+	// once the delegation expires the walk starts from the root again
+	_, err = r.Resolve(context.Background(), domain.Question{Name: "www.example.com.", Type: domain.RRTypeA, Class: domain.RRClassIN}, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Len(t, n["10.0.0.1"].seen(), 2)
+}
+
+func TestResolver_Resolve_Limits(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		limits  Limits
+		query   string
+		wantErr string
+	}{
+		{name: "query budget", limits: Limits{MaxQueries: 2}, query: "www.example.com.", wantErr: "exceeded 2 queries"},
+		{name: "referral depth", limits: Limits{MaxReferrals: 1}, query: "www.example.com.", wantErr: "exceeded 1 referrals"},
+		{name: "cname loop across zones", limits: Limits{MaxCNAMEs: 3}, query: "loop.example.com.", wantErr: "exceeded 3 CNAMEs"},
+		{name: "glueless nesting", limits: Limits{MaxDepth: 1}, query: "www.glueless.com.", wantErr: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestResolver(t, newTestNet(t), Options{Limits: tt.limits})
+			_, err := r.Resolve(context.Background(), domain.Question{Name: tt.query, Type: domain.RRTypeA, Class: domain.RRClassIN}, now)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestResolver_Resolve_ServerFailures(t *testing.T) {
+	now := time.Now()
+	query := domain.Question{Name: "www.example.com.", Type: domain.RRTypeA, Class: domain.RRClassIN}
+
+	tests := []struct {
+		name    string
+		breakIt func(*authServer)
+		wantErr string
+	}{
+		{name: "tcp fallback on truncation", breakIt: func(s *authServer) { s.truncateUDP = true }},
+		{name: "servfail", breakIt: func(s *authServer) { s.rcode = domain.SERVFAIL }, wantErr: "server answered SERVFAIL"},
+		{name: "lame delegation", breakIt: func(s *authServer) { s.lame = true }, wantErr: "lame delegation"},
+		{name: "question mismatch", breakIt: func(s *authServer) { s.echoName = "bank.example" }, wantErr: "does not match query"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newTestNet(t)
+			s := n["10.0.0.3"]
+			s.mu.Lock()
+			tt.breakIt(s)
+			s.mu.Unlock()
+			r := newTestResolver(t, n, Options{})
+			answer, err := r.Resolve(context.Background(), query, now)
+			records := answer.Answers
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, []string{"www.example.com A 192.0.2.1"}, answerTexts(records))
+		})
+	}
+}
+
+func TestResolver_Resolve_NonRecursiveQueries(t *testing.T) {
+	n := newTestNet(t)
+	r := newTestResolver(t, n, Options{})
+	_, err := r.Resolve(context.Background(), domain.Question{Name: "www.example.com.", Type: domain.RRTypeA, Class: domain.RRClassIN}, time.Now())
+	require.NoError(t, err)
+	for ip, s := range n {
+		s.mu.Lock()
+		for _, rd := range s.rd {
+			assert.False(t, rd, "query to %s had RD set", ip)
+		}
+		s.mu.Unlock()
+	}
+}
+
+func TestResolver_Resolve_Timeout(t *testing.T) {
+	// a server that never answers
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = silent.Close() }()
+
+	r, err := NewResolver(Options{
+		RootHints:    []string{silent.LocalAddr().String()},
+		Codec:        wire.NewUDPCodec(log.NewNoopLogger()),
+		Timeout:      time.Second,
+		QueryTimeout: 50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	_, err = r.Resolve(context.Background(), domain.Question{Name: "www.example.com.", Type: domain.RRTypeA, Class: domain.RRClassIN}, time.Now())
+	assert.ErrorContains(t, err, "query timeout")
+}
+
+func TestResolver_Resolve_DeadlineClock(t *testing.T) {
+	q := domain.Question{Name: "www.example.com.", Type: domain.RRTypeA, Class: domain.RRClassIN}
+	deadline := time.Now().Add(time.Hour)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	// A failure is reported as a timeout only once the clock reaches the deadline
+	clk := &clock.MockClock{CurrentTime: deadline.Add(-time.Second)}
+	r := newTestResolver(t, testNet{}, Options{Clock: clk})
+	_, err := r.Resolve(ctx, q, time.Now())
+	require.ErrorContains(t, err, "no route to")
+	assert.NotContains(t, err.Error(), "query timeout")
+
+	clk.Advance(time.Second)
+	_, err = r.Resolve(ctx, q, time.Now())
+	assert.ErrorContains(t, err, "query timeout")
+}
+
+func TestReferral(t *testing.T) {
+	ns := func(owner, target string) domain.ResourceRecord {
+		return testRR(t, owner, domain.RRTypeNS, target)
+	}
+	tests := []struct {
+		name      string
+		resp      domain.DNSResponse
+		zone      string
+		qname     string
+		wantChild string
+		wantNS    []string
+		wantOK    bool
+	}{
+		{
+			name:      "downward referral",
+			resp:      domain.DNSResponse{Authority: []domain.ResourceRecord{ns("example.com", "ns1.example.com"), ns("example.com", "ns2.example.net")}},
+			zone:      "com",
+			qname:     "www.example.com",
+			wantChild: "example.com",
+			wantNS:    []string{"ns1.example.com", "ns2.example.net"},
+			wantOK:    true,
+		},
+		{
+			name:      "unrelated delegation ignored",
+			resp:      domain.DNSResponse{Authority: []domain.ResourceRecord{ns("bank.com", "ns.attacker.example"), ns("example.com", "ns1.example.com")}},
+			zone:      "com",
+			qname:     "www.example.com",
+			wantChild: "example.com",
+			wantNS:    []string{"ns1.example.com"},
+			wantOK:    true,
+		},
+		{
+			name:  "delegation outside the server's zone ignored",
+			resp:  domain.DNSResponse{Authority: []domain.ResourceRecord{ns("example.org", "ns.attacker.example")}},
+			zone:  "com",
+			qname: "www.example.org",
+		},
+		{
+			name:  "upward referral is not a referral",
+			resp:  domain.DNSResponse{Authority: []domain.ResourceRecord{ns("com", "a.gtld.com")}},
+			zone:  "com",
+			qname: "www.example.com",
+		},
+		{
+			name:  "answers present",
+			resp:  domain.DNSResponse{Answers: []domain.ResourceRecord{testRR(t, "www.example.com", domain.RRTypeA, "192.0.2.1")}, Authority: []domain.ResourceRecord{ns("example.com", "ns1.example.com")}},
+			zone:  "com",
+			qname: "www.example.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			child, nameservers, ttl, ok := referral(tt.resp, tt.zone, tt.qname, time.Now())
+			assert.Equal(t, tt.wantOK, ok)
+			if !tt.wantOK {
+				return
+			}
+			assert.Equal(t, tt.wantChild, child)
+			assert.Equal(t, tt.wantNS, nameservers)
+			assert.Equal(t, 300*time.Second, ttl)
+		})
+	}
+}
+
+func TestLookup_cacheGlue(t *testing.T) {
+	now := time.Now()
+	r := newTestResolver(t, testNet{}, Options{})
+	l := &lookup{r: r, now: now}
+	resp := domain.DNSResponse{Additional: []domain.ResourceRecord{
+		testRR(t, "ns1.example.com", domain.RRTypeA, "192.0.2.53"),
+		testRR(t, "ns2.example.net", domain.RRTypeA, "203.0.113.66"), // out of bailiwick for com
+		testRR(t, "unrelated.com", domain.RRTypeA, "203.0.113.67"),   // not a name server
+	}}
+	l.cacheGlue(resp, "com", []string{"ns1.example.com", "ns2.example.net"})
+
+	assert.Equal(t, []string{"192.0.2.53:53"}, r.cache.addresses("ns1.example.com", now))
+	assert.Nil(t, r.cache.addresses("ns2.example.net", now))
+	assert.Nil(t, r.cache.addresses("unrelated.com", now))
+}
+
+func TestAnswerRecords(t *testing.T) {
+	answers := []domain.ResourceRecord{
+		testRR(t, "www.example.com", domain.RRTypeCNAME, "cdn.example.com"),
+		testRR(t, "cdn.example.com", domain.RRTypeCNAME, "edge.cdn.net"),
+		testRR(t, "edge.cdn.net", domain.RRTypeA, "203.0.113.66"), // other zone: must be re-resolved
+		testRR(t, "bank.example.com", domain.RRTypeA, "203.0.113.67"),
+	}
+	got := answerRecords(answers, "www.example.com", "example.com")
+	assert.Equal(t, []string{
+		"www.example.com CNAME cdn.example.com",
+		"cdn.example.com CNAME edge.cdn.net",
+	}, answerTexts(got))
+}
+
+func TestDanglingCNAME(t *testing.T) {
+	cname := func(owner, target string) domain.ResourceRecord {
+		return testRR(t, owner, domain.RRTypeCNAME, target)
+	}
+	a := testRR(t, "edge.cdn.net", domain.RRTypeA, "192.0.2.1")
+
+	tests := []struct {
+		name       string
+		qtype      domain.RRType
+		answers    []domain.ResourceRecord
+		wantTarget string
+		wantOK     bool
+	}{
+		{name: "no answers", qtype: domain.RRTypeA},
+		{name: "chain resolved", qtype: domain.RRTypeA, answers: []domain.ResourceRecord{cname("www.example.com", "edge.cdn.net"), a}},
+		{name: "chain dangling", qtype: domain.RRTypeA, answers: []domain.ResourceRecord{cname("www.example.com", "edge.cdn.net")}, wantTarget: "edge.cdn.net", wantOK: true},
+		{name: "cname query not chased", qtype: domain.RRTypeCNAME, answers: []domain.ResourceRecord{cname("www.example.com", "edge.cdn.net")}},
+		{name: "loop in answer", qtype: domain.RRTypeA, answers: []domain.ResourceRecord{cname("www.example.com", "x.example.com"), cname("x.example.com", "www.example.com")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, ok := danglingCNAME("www.example.com", tt.qtype, tt.answers)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantTarget, target)
+		})
+	}
+}
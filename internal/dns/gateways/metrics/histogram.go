@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"slices"
+	"sort"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the latency histograms.
+// They span cache hits well under a millisecond to upstream timeouts.
+var DefaultBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// histogram counts observations into buckets with fixed upper bounds, like a
+// Prometheus histogram. It is not safe for concurrent use; the Registry lock
+// guards it.
+type histogram struct {
+	bounds []float64
+	// counts holds the observations per bucket, not cumulative. The last
+	// bucket counts observations above every bound (+Inf).
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// newHistogram creates an empty histogram with the given sorted bounds.
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+// observe adds one observation of v.
+func (h *histogram) observe(v float64) {
+	h.counts[sort.SearchFloat64s(h.bounds, v)]++
+	h.sum += v
+	h.count++
+}
+
+// cumulative returns the number of observations at or below each bound,
+// followed by the total count for the +Inf bucket.
+func (h *histogram) cumulative() []uint64 {
+	out := slices.Clone(h.counts)
+	for i := 1; i < len(out); i++ {
+		out[i] += out[i-1]
+	}
+	return out
+}
@@ -0,0 +1,25 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogram_Observe(t *testing.T) {
+	h := newHistogram([]float64{0.1, 1})
+	for _, v := range []float64{0.05, 0.1, 0.5, 2, 3} {
+		h.observe(v)
+	}
+
+	assert.Equal(t, []uint64{2, 1, 2}, h.counts, "observations on a bound belong to its bucket")
+	assert.Equal(t, []uint64{2, 3, 5}, h.cumulative())
+	assert.Equal(t, uint64(5), h.count)
+	assert.InDelta(t, 5.65, h.sum, 1e-9)
+}
+
+func TestHistogram_Empty(t *testing.T) {
+	h := newHistogram(DefaultBuckets)
+	assert.Len(t, h.cumulative(), len(DefaultBuckets)+1)
+	assert.Zero(t, h.count)
+}
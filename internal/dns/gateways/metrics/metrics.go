@@ -0,0 +1,315 @@
+// Package metrics collects instrumentation from the resolver and transports
+// and exposes it, together with cache, zone and upstream state, in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"cmp"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/gateways/upstream"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// contentType is the media type of the Prometheus text exposition format.
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// UpstreamHealth reports the health of upstream servers, as upstream.Resolver does.
+type UpstreamHealth interface {
+	Health() []upstream.ServerHealth
+}
+
+// Options configures a Registry. The state sources are read on every scrape;
+// leave one nil to omit its metrics.
+type Options struct {
+	// Cache reports the size and hit ratio of the upstream response cache.
+	Cache resolver.CacheManager
+	// Zones reports the number of authoritative zones and records.
+	Zones resolver.ZoneCache
+	// Upstreams report per-server round-trip times and errors. A server used
+	// by several clients is reported once, with their counters summed and
+	// their round-trip times averaged, weighted by query count.
+	Upstreams []UpstreamHealth
+	// Buckets are the upper bounds, in seconds, of the latency histograms.
+	// Defaults to DefaultBuckets.
+	Buckets []float64
+}
+
+// servedKey identifies a series of queries served over a transport.
+type servedKey struct {
+	transport string
+	qtype     domain.RRType
+	rcode     domain.RCode
+}
+
+// answeredKey identifies a series of queries answered by the resolver.
+type answeredKey struct {
+	source resolver.AnswerSource
+	qtype  domain.RRType
+	rcode  domain.RCode
+}
+
+// failedKey identifies a series of queries a transport dropped.
+type failedKey struct {
+	transport string
+	stage     string
+}
+
+// Registry implements resolver.Metrics, counting queries as they are served,
+// and serves the counts over HTTP in the Prometheus text format.
+type Registry struct {
+	mu          sync.Mutex
+	served      map[servedKey]uint64
+	answered    map[answeredKey]uint64
+	failed      map[failedKey]uint64
+	serveTimes  map[string]*histogram
+	answerTimes map[resolver.AnswerSource]*histogram
+	blocked     uint64
+
+	buckets   []float64
+	cache     resolver.CacheManager
+	zones     resolver.ZoneCache
+	upstreams []UpstreamHealth
+}
+
+// NewRegistry creates an empty Registry reading state from the given sources.
+func NewRegistry(opts Options) *Registry {
+	buckets := slices.Clone(opts.Buckets)
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	slices.Sort(buckets)
+	return &Registry{
+		served:      make(map[servedKey]uint64),
+		answered:    make(map[answeredKey]uint64),
+		failed:      make(map[failedKey]uint64),
+		serveTimes:  make(map[string]*histogram),
+		answerTimes: make(map[resolver.AnswerSource]*histogram),
+		buckets:     buckets,
+		cache:       opts.Cache,
+		zones:       opts.Zones,
+		upstreams:   opts.Upstreams,
+	}
+}
+
+// QueryAnswered counts a query answered by the resolver and its resolution time.
+func (r *Registry) QueryAnswered(query domain.Question, rcode domain.RCode, source resolver.AnswerSource, duration time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.answered[answeredKey{source: source, qtype: query.Type, rcode: rcode}]++
+	if source == resolver.SourceBlocked {
+		r.blocked++
+	}
+	h, ok := r.answerTimes[source]
+	if !ok {
+		h = newHistogram(r.buckets)
+		r.answerTimes[source] = h
+	}
+	h.observe(duration.Seconds())
+}
+
+// QueryServed counts a query answered over a transport and its end-to-end latency.
+func (r *Registry) QueryServed(transport string, query domain.Question, rcode domain.RCode, duration time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.served[servedKey{transport: transport, qtype: query.Type, rcode: rcode}]++
+	h, ok := r.serveTimes[transport]
+	if !ok {
+		h = newHistogram(r.buckets)
+		r.serveTimes[transport] = h
+	}
+	h.observe(duration.Seconds())
+}
+
+// QueryFailed counts a query a transport dropped at the given stage.
+func (r *Registry) QueryFailed(transport string, stage string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failed[failedKey{transport: transport, stage: stage}]++
+}
+
+// ServeHTTP writes every metric in the Prometheus text exposition format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	_, _ = w.Write(r.Expose())
+}
+
+// Expose renders every metric in the Prometheus text exposition format.
+func (r *Registry) Expose() []byte {
+	var t textWriter
+	r.writeQueries(&t)
+	r.writeCache(&t)
+	r.writeZones(&t)
+	r.writeUpstreams(&t)
+	return t.Bytes()
+}
+
+// writeQueries writes the query counters and latency histograms.
+func (r *Registry) writeQueries(t *textWriter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t.family("rrdns_queries_total", "DNS queries answered over each transport, by query type and response code.", "counter")
+	for _, k := range sortedKeys(r.served, func(a, b servedKey) int {
+		return cmp.Or(cmp.Compare(a.transport, b.transport), cmp.Compare(a.qtype, b.qtype), cmp.Compare(a.rcode, b.rcode))
+	}) {
+		t.sample("rrdns_queries_total", []label{{"transport", k.transport}, {"type", k.qtype.String()}, {"rcode", k.rcode.String()}}, float64(r.served[k]))
+	}
+
+	t.family("rrdns_query_duration_seconds", "Time from receiving a query to sending its response.", "histogram")
+	for _, transport := range sortedKeys(r.serveTimes, cmp.Compare[string]) {
+		t.histogram("rrdns_query_duration_seconds", []label{{"transport", transport}}, r.serveTimes[transport])
+	}
+
+	t.family("rrdns_query_failures_total", "Queries dropped because decoding, handling, encoding or sending failed.", "counter")
+	for _, k := range sortedKeys(r.failed, func(a, b failedKey) int {
+		return cmp.Or(cmp.Compare(a.transport, b.transport), cmp.Compare(a.stage, b.stage))
+	}) {
+		t.sample("rrdns_query_failures_total", []label{{"transport", k.transport}, {"stage", k.stage}}, float64(r.failed[k]))
+	}
+
+	t.family("rrdns_answers_total", "Queries answered by the resolver, by answer source, query type and response code.", "counter")
+	for _, k := range sortedKeys(r.answered, func(a, b answeredKey) int {
+		return cmp.Or(cmp.Compare(a.source, b.source), cmp.Compare(a.qtype, b.qtype), cmp.Compare(a.rcode, b.rcode))
+	}) {
+		t.sample("rrdns_answers_total", []label{{"source", string(k.source)}, {"type", k.qtype.String()}, {"rcode", k.rcode.String()}}, float64(r.answered[k]))
+	}
+
+	t.family("rrdns_answer_duration_seconds", "Time the resolver took to answer a query, by answer source.", "histogram")
+	for _, source := range sortedKeys(r.answerTimes, cmp.Compare[resolver.AnswerSource]) {
+		t.histogram("rrdns_answer_duration_seconds", []label{{"source", string(source)}}, r.answerTimes[source])
+	}
+
+	t.family("rrdns_blocklist_hits_total", "Queries blocked by the blocklist.", "counter")
+	t.sample("rrdns_blocklist_hits_total", nil, float64(r.blocked))
+}
+
+// writeCache writes the size and counters of the upstream cache.
+func (r *Registry) writeCache(t *textWriter) {
+	if r.cache == nil {
+		return
+	}
+	stats := r.cache.Stats()
+	ratio := 0.0
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		ratio = float64(stats.Hits) / float64(lookups)
+	}
+	gauges := []struct {
+		name, help, kind string
+		value            float64
+	}{
+		{"rrdns_cache_entries", "Entries in the upstream response cache.", "gauge", float64(stats.Entries)},
+		{"rrdns_cache_bytes", "Approximate memory held by the upstream response cache.", "gauge", float64(stats.Bytes)},
+		{"rrdns_cache_hits_total", "Cache lookups that found a live answer.", "counter", float64(stats.Hits)},
+		{"rrdns_cache_misses_total", "Cache lookups that found no live answer.", "counter", float64(stats.Misses)},
+		{"rrdns_cache_evictions_total", "Cache entries evicted to make room for new ones.", "counter", float64(stats.Evictions)},
+		{"rrdns_cache_hit_ratio", "Share of cache lookups that found a live answer since startup.", "gauge", ratio},
+	}
+	for _, g := range gauges {
+		t.family(g.name, g.help, g.kind)
+		t.sample(g.name, nil, g.value)
+	}
+}
+
+// writeZones writes the number of authoritative zones and records.
+func (r *Registry) writeZones(t *textWriter) {
+	if r.zones == nil {
+		return
+	}
+	t.family("rrdns_zones", "Authoritative zones loaded.", "gauge")
+	t.sample("rrdns_zones", nil, float64(len(r.zones.Zones())))
+	t.family("rrdns_zone_records", "Authoritative records across all zones.", "gauge")
+	t.sample("rrdns_zone_records", nil, float64(r.zones.Count()))
+}
+
+// writeUpstreams writes per-server query, error, round-trip time and health metrics.
+func (r *Registry) writeUpstreams(t *textWriter) {
+	if len(r.upstreams) == 0 {
+		return
+	}
+	var servers []upstream.ServerHealth
+	var rtts []rttMean
+	index := make(map[string]int)
+	for _, u := range r.upstreams {
+		for _, h := range u.Health() {
+			i, seen := index[h.Server]
+			if !seen {
+				index[h.Server] = len(servers)
+				servers = append(servers, h)
+				rtts = append(rtts, rttMean{})
+				rtts[len(rtts)-1].add(h)
+				continue
+			}
+			merged := &servers[i]
+			merged.Queries += h.Queries
+			merged.Failures += h.Failures
+			merged.Healthy = merged.Healthy && h.Healthy
+			rtts[i].add(h)
+			merged.RTT = rtts[i].mean()
+		}
+	}
+	slices.SortFunc(servers, func(a, b upstream.ServerHealth) int { return cmp.Compare(a.Server, b.Server) })
+
+	families := []struct {
+		name, help, kind string
+		value            func(upstream.ServerHealth) float64
+	}{
+		{"rrdns_upstream_queries_total", "Queries sent to each upstream server.", "counter", func(h upstream.ServerHealth) float64 { return float64(h.Queries) }},
+		{"rrdns_upstream_errors_total", "Queries to each upstream server that failed.", "counter", func(h upstream.ServerHealth) float64 { return float64(h.Failures) }},
+		{"rrdns_upstream_rtt_seconds", "Smoothed round-trip time of each upstream server, averaged over its clients by query count.", "gauge", func(h upstream.ServerHealth) float64 { return h.RTT.Seconds() }},
+		{"rrdns_upstream_healthy", "Whether each upstream server is in rotation (1) or sidelined by the circuit breaker (0).", "gauge", func(h upstream.ServerHealth) float64 {
+			if h.Healthy {
+				return 1
+			}
+			return 0
+		}},
+	}
+	for _, f := range families {
+		t.family(f.name, f.help, f.kind)
+		for _, h := range servers {
+			t.sample(f.name, []label{{"server", h.Server}}, f.value(h))
+		}
+	}
+}
+
+// rttMean averages the round-trip times one server has in several upstream
+// clients, weighted by the queries each client sent it. Clients that sent no
+// queries count equally while none has.
+type rttMean struct {
+	weighted time.Duration
+	queries  uint64
+	sum      time.Duration
+	clients  int
+}
+
+// add includes one client's view of the server.
+func (m *rttMean) add(h upstream.ServerHealth) {
+	m.weighted += h.RTT * time.Duration(h.Queries)
+	m.queries += h.Queries
+	m.sum += h.RTT
+	m.clients++
+}
+
+// mean returns the weighted average round-trip time.
+func (m *rttMean) mean() time.Duration {
+	if m.queries > 0 {
+		return m.weighted / time.Duration(m.queries)
+	}
+	return m.sum / time.Duration(m.clients)
+}
+
+// sortedKeys returns the keys of m ordered by compare, so scrapes list series
+// in a stable order.
+func sortedKeys[K comparable, V any](m map[K]V, compare func(a, b K) int) []K {
+	return slices.SortedFunc(maps.Keys(m), compare)
+}
+
+var (
+	_ resolver.Metrics = (*Registry)(nil)
+	_ http.Handler     = (*Registry)(nil)
+)
@@ -0,0 +1,156 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/gateways/upstream"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// fakeCache reports fixed cache statistics.
+type fakeCache struct {
+	stats resolver.CacheStats
+}
+
+func (f *fakeCache) Flush() int                  { return 0 }
+func (f *fakeCache) FlushName(string) int        { return 0 }
+func (f *fakeCache) FlushDomain(string) int      { return 0 }
+func (f *fakeCache) FlushType(domain.RRType) int { return 0 }
+func (f *fakeCache) Dump() []resolver.CacheEntry { return nil }
+func (f *fakeCache) Stats() resolver.CacheStats  { return f.stats }
+
+// fakeZones reports fixed zone and record counts.
+type fakeZones struct {
+	zones   []string
+	records int
+}
+
+func (f *fakeZones) FindRecords(domain.Question) ([]domain.ResourceRecord, bool) { return nil, false }
+func (f *fakeZones) PutZone(string, []domain.ResourceRecord)                     {}
+func (f *fakeZones) RemoveZone(string)                                           {}
+func (f *fakeZones) Zones() []string                                             { return f.zones }
+func (f *fakeZones) Count() int                                                  { return f.records }
+func (f *fakeZones) RecordCount(string) int                                      { return 0 }
+
+// fakeUpstream reports fixed server health.
+type fakeUpstream []upstream.ServerHealth
+
+func (f fakeUpstream) Health() []upstream.ServerHealth { return f }
+
+// exposedLines returns the non-comment lines of the registry's exposition.
+func exposedLines(r *Registry) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(string(r.Expose())), "\n") {
+		if !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func TestRegistry_Queries(t *testing.T) {
+	r := NewRegistry(Options{Buckets: []float64{0.01, 0.1}})
+	a := domain.Question{Name: "example.com.", Type: domain.RRTypeA, Class: domain.RRClassIN}
+	aaaa := domain.Question{Name: "example.com.", Type: domain.RRTypeAAAA, Class: domain.RRClassIN}
+
+	r.QueryServed("udp", a, domain.NOERROR, 5*time.Millisecond)
+	r.QueryServed("udp", a, domain.NOERROR, 50*time.Millisecond)
+	r.QueryServed("udp", aaaa, domain.NXDOMAIN, time.Second)
+	r.QueryFailed("udp", "decode")
+	r.QueryAnswered(a, domain.NOERROR, resolver.SourceCache, time.Millisecond)
+	r.QueryAnswered(aaaa, domain.NXDOMAIN, resolver.SourceBlocked, 0)
+	r.QueryAnswered(a, domain.SERVFAIL, resolver.SourceUpstream, 2*time.Second)
+
+	lines := exposedLines(r)
+	for _, want := range []string{
+		`rrdns_queries_total{transport="udp",type="A",rcode="NOERROR"} 2`,
+		`rrdns_queries_total{transport="udp",type="AAAA",rcode="NXDOMAIN"} 1`,
+		`rrdns_query_duration_seconds_bucket{transport="udp",le="0.01"} 1`,
+		`rrdns_query_duration_seconds_bucket{transport="udp",le="0.1"} 2`,
+		`rrdns_query_duration_seconds_bucket{transport="udp",le="+Inf"} 3`,
+		`rrdns_query_duration_seconds_count{transport="udp"} 3`,
+		`rrdns_query_failures_total{transport="udp",stage="decode"} 1`,
+		`rrdns_answers_total{source="blocked",type="AAAA",rcode="NXDOMAIN"} 1`,
+		`rrdns_answers_total{source="cache",type="A",rcode="NOERROR"} 1`,
+		`rrdns_answers_total{source="upstream",type="A",rcode="SERVFAIL"} 1`,
+		`rrdns_answer_duration_seconds_bucket{source="cache",le="0.01"} 1`,
+		`rrdns_answer_duration_seconds_sum{source="upstream"} 2`,
+		`rrdns_blocklist_hits_total 1`,
+	} {
+		assert.Contains(t, lines, want)
+	}
+	for _, line := range lines {
+		assert.False(t, strings.HasPrefix(line, "rrdns_cache_") || strings.HasPrefix(line, "rrdns_zone") || strings.HasPrefix(line, "rrdns_upstream_"),
+			"state metrics without a source should be omitted: %s", line)
+	}
+}
+
+func TestRegistry_State(t *testing.T) {
+	r := NewRegistry(Options{
+		Cache: &fakeCache{stats: resolver.CacheStats{Entries: 10, Bytes: 2048, Hits: 3, Misses: 1, Evictions: 2}},
+		Zones: &fakeZones{zones: []string{"example.com.", "example.org."}, records: 12},
+		Upstreams: []UpstreamHealth{
+			fakeUpstream{
+				{Server: "9.9.9.9:53", Healthy: true, RTT: 20 * time.Millisecond, Queries: 10, Failures: 1},
+				{Server: "1.1.1.1:53", Healthy: false, RTT: 5 * time.Millisecond, Queries: 4, Failures: 4},
+				{Server: "8.8.8.8:53", Healthy: true, RTT: 10 * time.Millisecond},
+			},
+			fakeUpstream{
+				{Server: "9.9.9.9:53", Healthy: true, RTT: 30 * time.Millisecond, Queries: 30, Failures: 0},
+				{Server: "8.8.8.8:53", Healthy: true, RTT: 20 * time.Millisecond},
+			},
+		},
+	})
+
+	lines := exposedLines(r)
+	for _, want := range []string{
+		`rrdns_cache_entries 10`,
+		`rrdns_cache_bytes 2048`,
+		`rrdns_cache_hits_total 3`,
+		`rrdns_cache_misses_total 1`,
+		`rrdns_cache_evictions_total 2`,
+		`rrdns_cache_hit_ratio 0.75`,
+		`rrdns_zones 2`,
+		`rrdns_zone_records 12`,
+		`rrdns_upstream_queries_total{server="1.1.1.1:53"} 4`,
+		`rrdns_upstream_queries_total{server="9.9.9.9:53"} 40`,
+		`rrdns_upstream_errors_total{server="9.9.9.9:53"} 1`,
+		`rrdns_upstream_rtt_seconds{server="9.9.9.9:53"} 0.0275`, // (10×20ms + 30×30ms) / 40
+		`rrdns_upstream_rtt_seconds{server="8.8.8.8:53"} 0.015`,  // no queries yet: plain mean
+		`rrdns_upstream_rtt_seconds{server="1.1.1.1:53"} 0.005`,
+		`rrdns_upstream_healthy{server="1.1.1.1:53"} 0`,
+		`rrdns_upstream_healthy{server="9.9.9.9:53"} 1`,
+	} {
+		assert.Contains(t, lines, want)
+	}
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	r := NewRegistry(Options{})
+	r.QueryFailed("udp", "send")
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", Path, nil))
+
+	require.Equal(t, 200, rec.Code)
+	assert.Equal(t, contentType, rec.Header().Get("Content-Type"))
+	body := rec.Body.String()
+	assert.Contains(t, body, "# TYPE rrdns_query_failures_total counter\n")
+	assert.Contains(t, body, `rrdns_query_failures_total{transport="udp",stage="send"} 1`)
+}
+
+func TestNewRegistry_Buckets(t *testing.T) {
+	assert.Equal(t, DefaultBuckets, NewRegistry(Options{}).buckets)
+
+	custom := []float64{1, 0.1}
+	r := NewRegistry(Options{Buckets: custom})
+	assert.Equal(t, []float64{0.1, 1}, r.buckets)
+	assert.Equal(t, []float64{1, 0.1}, custom, "the caller's buckets are not reordered")
+}
@@ -0,0 +1,97 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/common/log"
+)
+
+const (
+	// Path is where the metrics are served.
+	Path = "/metrics"
+
+	// readHeaderTimeout bounds how long a client may take to send request headers.
+	readHeaderTimeout = 5 * time.Second
+	// shutdownTimeout bounds how long Stop waits for in-flight scrapes.
+	shutdownTimeout = 5 * time.Second
+)
+
+// Server is the optional HTTP listener that exposes a Registry to Prometheus.
+type Server struct {
+	addr    string
+	handler http.Handler
+	logger  log.Logger
+
+	mu       sync.Mutex
+	server   *http.Server
+	listener net.Listener
+}
+
+// NewServer creates a metrics listener on addr (host:port) serving handler at Path.
+func NewServer(addr string, handler http.Handler, logger log.Logger) *Server {
+	return &Server{addr: addr, handler: handler, logger: logger}
+}
+
+// Start binds the listener and serves scrapes in the background until Stop.
+func (s *Server) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.server != nil {
+		return fmt.Errorf("metrics server already running")
+	}
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to bind metrics listener on %s: %w", s.addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET "+Path, s.handler)
+	s.server = &http.Server{Handler: mux, ReadHeaderTimeout: readHeaderTimeout}
+	s.listener = listener
+
+	go func(server *http.Server) {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error(map[string]any{"error": err}, "Metrics server failed")
+		}
+	}(s.server)
+
+	s.logger.Info(map[string]any{
+		"address": listener.Addr().String(),
+		"path":    Path,
+	}, "Metrics server started")
+	return nil
+}
+
+// Stop shuts the listener down, waiting briefly for in-flight scrapes.
+func (s *Server) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.server == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := s.server.Shutdown(ctx)
+	s.server = nil
+	s.listener = nil
+	return err
+}
+
+// Address returns the address the listener is bound to, or the configured
+// address when it is not running.
+func (s *Server) Address() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener != nil {
+		return s.listener.Addr().String()
+	}
+	return s.addr
+}
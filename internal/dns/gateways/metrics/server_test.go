@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/common/log"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+func TestServer_StartStop(t *testing.T) {
+	r := NewRegistry(Options{})
+	r.QueryServed("udp", domain.Question{Type: domain.RRTypeA}, domain.NOERROR, 0)
+	s := NewServer("127.0.0.1:0", r, log.NewNoopLogger())
+
+	require.NoError(t, s.Start())
+	assert.Error(t, s.Start(), "starting twice fails")
+
+	resp, err := http.Get("http://" + s.Address() + Path)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, resp.Body.Close())
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, contentType, resp.Header.Get("Content-Type"))
+	assert.Contains(t, string(body), `rrdns_queries_total{transport="udp",type="A",rcode="NOERROR"} 1`)
+
+	resp, err = http.Get("http://" + s.Address() + "/other")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	addr := s.Address()
+	require.NoError(t, s.Stop())
+	require.NoError(t, s.Stop(), "stopping twice is harmless")
+	assert.Equal(t, "127.0.0.1:0", s.Address())
+	_, err = http.Get("http://" + addr + Path)
+	assert.Error(t, err)
+}
+
+func TestServer_StartBindError(t *testing.T) {
+	s := NewServer("256.0.0.1:0", NewRegistry(Options{}), log.NewNoopLogger())
+	assert.Error(t, s.Start())
+	assert.NoError(t, s.Stop())
+}
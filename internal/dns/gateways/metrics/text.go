@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// label is one name="value" pair of a sample.
+type label struct {
+	name  string
+	value string
+}
+
+// textWriter renders metric families in the Prometheus text exposition
+// format (version 0.0.4).
+type textWriter struct {
+	buf bytes.Buffer
+}
+
+// family starts a metric family with its HELP and TYPE lines.
+func (t *textWriter) family(name, help, kind string) {
+	t.buf.WriteString("# HELP " + name + " " + helpEscaper.Replace(help) + "\n")
+	t.buf.WriteString("# TYPE " + name + " " + kind + "\n")
+}
+
+// sample writes one sample line.
+func (t *textWriter) sample(name string, labels []label, value float64) {
+	t.buf.WriteString(name)
+	if len(labels) > 0 {
+		t.buf.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				t.buf.WriteByte(',')
+			}
+			t.buf.WriteString(l.name + `="` + labelEscaper.Replace(l.value) + `"`)
+		}
+		t.buf.WriteByte('}')
+	}
+	t.buf.WriteString(" " + formatValue(value) + "\n")
+}
+
+// histogram writes the bucket, sum and count samples of h.
+func (t *textWriter) histogram(name string, labels []label, h *histogram) {
+	cumulative := h.cumulative()
+	for i, n := range cumulative {
+		bound := math.Inf(1)
+		if i < len(h.bounds) {
+			bound = h.bounds[i]
+		}
+		t.sample(name+"_bucket", append(labels[:len(labels):len(labels)], label{"le", formatValue(bound)}), float64(n))
+	}
+	t.sample(name+"_sum", labels, h.sum)
+	t.sample(name+"_count", labels, float64(h.count))
+}
+
+// Bytes returns everything written so far.
+func (t *textWriter) Bytes() []byte {
+	return t.buf.Bytes()
+}
+
+var (
+	// helpEscaper escapes HELP text as the exposition format requires.
+	helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	// labelEscaper escapes label values as the exposition format requires.
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// formatValue formats a sample value, spelling infinities and NaN the way
+// Prometheus expects.
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
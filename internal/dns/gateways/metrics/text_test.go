@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTextWriter(t *testing.T) {
+	var w textWriter
+	w.family("test_total", "A help line\nwith a \\ backslash.", "counter")
+	w.sample("test_total", nil, 3)
+	w.sample("test_total", []label{{"a", `quote " and \ slash`}, {"b", "line\nbreak"}}, 1.5)
+
+	want := "# HELP test_total A help line\\nwith a \\\\ backslash.\n" +
+		"# TYPE test_total counter\n" +
+		"test_total 3\n" +
+		`test_total{a="quote \" and \\ slash",b="line\nbreak"} 1.5` + "\n"
+	assert.Equal(t, want, string(w.Bytes()))
+}
+
+func TestTextWriter_Histogram(t *testing.T) {
+	h := newHistogram([]float64{0.5, 1})
+	h.observe(0.25)
+	h.observe(2)
+
+	var w textWriter
+	labels := []label{{"transport", "udp"}}
+	w.histogram("latency_seconds", labels, h)
+
+	want := `latency_seconds_bucket{transport="udp",le="0.5"} 1` + "\n" +
+		`latency_seconds_bucket{transport="udp",le="1"} 1` + "\n" +
+		`latency_seconds_bucket{transport="udp",le="+Inf"} 2` + "\n" +
+		`latency_seconds_sum{transport="udp"} 2.25` + "\n" +
+		`latency_seconds_count{transport="udp"} 2` + "\n"
+	assert.Equal(t, want, string(w.Bytes()))
+	assert.Len(t, labels, 1, "the caller's labels are not modified")
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := map[string]float64{
+		"0":      0,
+		"42":     42,
+		"0.0005": 0.0005,
+		"1e+21":  1e21,
+		"+Inf":   math.Inf(1),
+		"-Inf":   math.Inf(-1),
+		"NaN":    math.NaN(),
+	}
+	for want, v := range tests {
+		assert.Equal(t, want, formatValue(v))
+	}
+}
@@ -0,0 +1,84 @@
+package querylog
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+)
+
+// Anonymization selects how client addresses are written to the query log.
+type Anonymization string
+
+const (
+	// AnonymizeNone logs client addresses as they are.
+	AnonymizeNone Anonymization = ""
+	// AnonymizeTruncate zeroes the host part: IPv4 addresses keep their /24
+	// network and IPv6 addresses their /48.
+	AnonymizeTruncate Anonymization = "truncate"
+	// AnonymizeHash replaces addresses with a keyed hash, so queries from the
+	// same client can still be correlated without revealing the address.
+	AnonymizeHash Anonymization = "hash"
+)
+
+const (
+	// truncateBitsV4 and truncateBitsV6 are the prefix lengths kept by AnonymizeTruncate.
+	truncateBitsV4 = 24
+	truncateBitsV6 = 48
+	// hashBytes is the length of the hash logged by AnonymizeHash.
+	hashBytes = 8
+)
+
+// Anonymizer rewrites client addresses according to an Anonymization mode.
+// A nil Anonymizer logs addresses as they are.
+type Anonymizer struct {
+	mode Anonymization
+	key  []byte
+}
+
+// NewAnonymizer creates an Anonymizer for mode. AnonymizeHash uses key for the
+// HMAC; with an empty key a random one is generated, so hashes only correlate
+// clients until the process restarts.
+func NewAnonymizer(mode Anonymization, key string) (*Anonymizer, error) {
+	switch mode {
+	case AnonymizeNone, AnonymizeTruncate:
+		return &Anonymizer{mode: mode}, nil
+	case AnonymizeHash:
+		k := []byte(key)
+		if len(k) == 0 {
+			k = make([]byte, sha256.Size)
+			if _, err := rand.Read(k); err != nil {
+				return nil, fmt.Errorf("failed to generate client hash key: %w", err)
+			}
+		}
+		return &Anonymizer{mode: mode, key: k}, nil
+	}
+	return nil, fmt.Errorf("unknown client anonymization %q", mode)
+}
+
+// Client returns the logged form of ip, or "" when ip is nil.
+func (a *Anonymizer) Client(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	if a == nil {
+		return ip.String()
+	}
+	switch a.mode {
+	case AnonymizeTruncate:
+		if v4 := ip.To4(); v4 != nil {
+			return v4.Mask(net.CIDRMask(truncateBitsV4, 32)).String()
+		}
+		return ip.Mask(net.CIDRMask(truncateBitsV6, 128)).String()
+	case AnonymizeHash:
+		if v4 := ip.To4(); v4 != nil {
+			ip = v4
+		}
+		mac := hmac.New(sha256.New, a.key)
+		mac.Write(ip)
+		return hex.EncodeToString(mac.Sum(nil)[:hashBytes])
+	}
+	return ip.String()
+}
@@ -0,0 +1,48 @@
+package querylog
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnonymizer_Client(t *testing.T) {
+	v4 := net.ParseIP("192.0.2.123")
+	v6 := net.ParseIP("2001:db8:1234:5678::1")
+
+	none, err := NewAnonymizer(AnonymizeNone, "")
+	require.NoError(t, err)
+	assert.Equal(t, "192.0.2.123", none.Client(v4))
+	assert.Equal(t, "", none.Client(nil))
+
+	var nilAnon *Anonymizer
+	assert.Equal(t, "2001:db8:1234:5678::1", nilAnon.Client(v6))
+
+	truncate, err := NewAnonymizer(AnonymizeTruncate, "")
+	require.NoError(t, err)
+	assert.Equal(t, "192.0.2.0", truncate.Client(v4))
+	assert.Equal(t, "2001:db8:1234::", truncate.Client(v6))
+
+	hash, err := NewAnonymizer(AnonymizeHash, "secret")
+	require.NoError(t, err)
+	h := hash.Client(v4)
+	assert.Len(t, h, 2*hashBytes)
+	assert.NotContains(t, h, "192")
+	assert.Equal(t, h, hash.Client(net.ParseIP("::ffff:192.0.2.123")), "IPv4-mapped addresses hash alike")
+	assert.NotEqual(t, h, hash.Client(net.ParseIP("192.0.2.124")))
+
+	sameKey, err := NewAnonymizer(AnonymizeHash, "secret")
+	require.NoError(t, err)
+	assert.Equal(t, h, sameKey.Client(v4), "the same key gives the same hash")
+
+	randomKey, err := NewAnonymizer(AnonymizeHash, "")
+	require.NoError(t, err)
+	assert.NotEqual(t, h, randomKey.Client(v4))
+}
+
+func TestNewAnonymizer_UnknownMode(t *testing.T) {
+	_, err := NewAnonymizer("scramble", "")
+	assert.ErrorContains(t, err, `unknown client anonymization "scramble"`)
+}
@@ -0,0 +1,39 @@
+package querylog
+
+import (
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// Entry is one line of the query log.
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Client string    `json:"client,omitempty"`
+	Name   string    `json:"name"`
+	Type   string    `json:"type"`
+	RCode  string    `json:"rcode"`
+	// Answers summarizes the answer records as "name TYPE data".
+	Answers  []string `json:"answers"`
+	Source   string   `json:"source"`
+	Upstream string   `json:"upstream,omitempty"`
+	// DurationMS is the time the resolver took to answer, in milliseconds.
+	DurationMS float64 `json:"duration_ms"`
+}
+
+// NewEntry converts a resolver query log entry to its logged form, passing the
+// client address through anon.
+func NewEntry(e resolver.QueryLogEntry, anon *Anonymizer) Entry {
+	r := resolver.NewQueryRecord(e)
+	return Entry{
+		Time:       r.Time.UTC(),
+		Client:     anon.Client(e.ClientIP()),
+		Name:       r.Name,
+		Type:       r.Type.String(),
+		RCode:      r.RCode.String(),
+		Answers:    r.Answers,
+		Source:     string(r.Source),
+		Upstream:   r.Upstream,
+		DurationMS: float64(r.Duration.Microseconds()) / 1000,
+	}
+}
@@ -0,0 +1,66 @@
+package querylog
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// testEntry returns a resolver entry for an upstream answer with a CNAME chain.
+func testEntry(t *testing.T) resolver.QueryLogEntry {
+	t.Helper()
+	cname, err := domain.NewAuthoritativeResourceRecord("www.example.com.", domain.RRTypeCNAME, domain.RRClassIN, 300, []byte{0}, "example.com.")
+	require.NoError(t, err)
+	a, err := domain.NewAuthoritativeResourceRecord("example.com.", domain.RRTypeA, domain.RRClassIN, 300, []byte{192, 0, 2, 1}, "192.0.2.1")
+	require.NoError(t, err)
+	return resolver.QueryLogEntry{
+		Time:     time.Date(2025, 6, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60)),
+		Client:   &net.UDPAddr{IP: net.ParseIP("192.0.2.10"), Port: 40000},
+		Question: domain.Question{Name: "www.example.com.", Type: domain.RRTypeA, Class: domain.RRClassIN},
+		RCode:    domain.NOERROR,
+		Answers:  []domain.ResourceRecord{cname, a},
+		Source:   resolver.SourceUpstream,
+		Upstream: "1.1.1.1:53",
+		Duration: 12345 * time.Microsecond,
+	}
+}
+
+func TestNewEntry(t *testing.T) {
+	entry := NewEntry(testEntry(t), nil)
+	data, err := json.Marshal(entry)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"time": "2025-06-01T10:00:00Z",
+		"client": "192.0.2.10",
+		"name": "www.example.com.",
+		"type": "A",
+		"rcode": "NOERROR",
+		"answers": ["www.example.com CNAME example.com.", "example.com A 192.0.2.1"],
+		"source": "upstream",
+		"upstream": "1.1.1.1:53",
+		"duration_ms": 12.345
+	}`, string(data))
+}
+
+func TestNewEntry_NoAnswersOrClient(t *testing.T) {
+	e := testEntry(t)
+	e.Client = nil
+	e.Answers = nil
+	e.Upstream = ""
+	e.RCode = domain.NXDOMAIN
+	e.Source = resolver.SourceBlocked
+
+	data, err := json.Marshal(NewEntry(e, nil))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"answers":[]`)
+	assert.NotContains(t, string(data), `"client"`)
+	assert.NotContains(t, string(data), `"upstream"`)
+	assert.Contains(t, string(data), `"source":"blocked"`)
+}
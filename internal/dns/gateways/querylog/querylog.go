@@ -0,0 +1,177 @@
+// Package querylog writes every query the resolver answers to a JSON-lines
+// file, with size- and time-based rotation, retention of rotated files and
+// optional anonymization of client addresses.
+package querylog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/common/log"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+const (
+	// DefaultQueueSize is the number of entries buffered for writing.
+	DefaultQueueSize = 4096
+	// maxWriteBytes bounds how many queued entries are written together.
+	maxWriteBytes = 64 << 10
+)
+
+// errPathRequired is returned by New without a Path.
+var errPathRequired = errors.New("query log path is required")
+
+// Options configures a Logger.
+type Options struct {
+	// Path is the file entries are appended to. Required.
+	Path string
+	// MaxBytes rotates the file before it grows past this size; 0 disables size-based rotation.
+	MaxBytes int64
+	// RotateInterval rotates the file once it has been written to for this long;
+	// 0 disables time-based rotation.
+	RotateInterval time.Duration
+	// MaxBackups is the number of rotated files kept; 0 keeps them all.
+	MaxBackups int
+	// MaxAge removes rotated files older than this; 0 keeps them regardless of age.
+	MaxAge time.Duration
+	// Anonymize rewrites client addresses; see Anonymization. HashKey keys
+	// AnonymizeHash and is random per process when empty.
+	Anonymize Anonymization
+	HashKey   string
+	// QueueSize is the number of entries buffered for writing; zero uses
+	// DefaultQueueSize. Entries recorded while the queue is full are dropped.
+	QueueSize int
+	// options to inject for testing purposes
+	Clock  clock.Clock
+	Logger log.Logger
+}
+
+// Logger implements resolver.QueryLog. Entries are queued and written by a
+// background goroutine, so a slow disk never delays a query.
+type Logger struct {
+	file   *rotatingFile
+	anon   *Anonymizer
+	logger log.Logger
+
+	mu      sync.RWMutex // guards closed against concurrent sends on queue
+	closed  bool
+	queue   chan resolver.QueryLogEntry
+	dropped atomic.Uint64
+	done    chan struct{}
+}
+
+// New opens the query log at opts.Path and starts writing entries to it.
+func New(opts Options) (*Logger, error) {
+	if opts.Path == "" {
+		return nil, errPathRequired
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	if opts.Clock == nil {
+		opts.Clock = &clock.RealClock{}
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.NewNoopLogger()
+	}
+	anon, err := NewAnonymizer(opts.Anonymize, opts.HashKey)
+	if err != nil {
+		return nil, err
+	}
+	file := &rotatingFile{
+		path:       opts.Path,
+		maxBytes:   opts.MaxBytes,
+		interval:   opts.RotateInterval,
+		maxBackups: opts.MaxBackups,
+		maxAge:     opts.MaxAge,
+		clock:      opts.Clock,
+	}
+	if err := file.open(); err != nil {
+		return nil, err
+	}
+	l := &Logger{
+		file:   file,
+		anon:   anon,
+		logger: opts.Logger,
+		queue:  make(chan resolver.QueryLogEntry, opts.QueueSize),
+		done:   make(chan struct{}),
+	}
+	go l.run()
+	return l, nil
+}
+
+// Record queues entry for writing, dropping it if the queue is full or the
+// Logger is closed.
+func (l *Logger) Record(entry resolver.QueryLogEntry) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		return
+	}
+	select {
+	case l.queue <- entry:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+// run writes queued entries until the queue is closed, gathering whatever is
+// already waiting into a single write.
+func (l *Logger) run() {
+	defer close(l.done)
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for entry := range l.queue {
+		l.encode(enc, entry)
+	gather:
+		for buf.Len() < maxWriteBytes {
+			select {
+			case next, ok := <-l.queue:
+				if !ok {
+					break gather
+				}
+				l.encode(enc, next)
+			default:
+				break gather
+			}
+		}
+		if _, err := l.file.Write(buf.Bytes()); err != nil {
+			l.logger.Error(map[string]any{"error": err}, "Failed to write query log")
+		}
+		buf.Reset()
+	}
+}
+
+// encode appends one JSON line for entry to enc's buffer.
+func (l *Logger) encode(enc *json.Encoder, entry resolver.QueryLogEntry) {
+	if err := enc.Encode(NewEntry(entry, l.anon)); err != nil {
+		l.logger.Error(map[string]any{"error": err}, "Failed to encode query log entry")
+	}
+}
+
+// Dropped returns the number of entries discarded because the queue was full.
+func (l *Logger) Dropped() uint64 {
+	return l.dropped.Load()
+}
+
+// Close stops accepting entries, writes those still queued and closes the file.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.queue)
+	l.mu.Unlock()
+
+	<-l.done
+	return l.file.Close()
+}
+
+var _ resolver.QueryLog = (*Logger)(nil)
@@ -0,0 +1,95 @@
+package querylog
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+)
+
+// readEntries decodes every line of the query log at path.
+func readEntries(t *testing.T, path string) []Entry {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Entry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+		entries = append(entries, e)
+	}
+	require.NoError(t, scanner.Err())
+	return entries
+}
+
+func TestLogger_Record(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.log")
+	l, err := New(Options{Path: path, Anonymize: AnonymizeTruncate})
+	require.NoError(t, err)
+
+	for range 3 {
+		l.Record(testEntry(t))
+	}
+	require.NoError(t, l.Close())
+	require.NoError(t, l.Close())
+	l.Record(testEntry(t)) // ignored once closed
+
+	entries := readEntries(t, path)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "192.0.2.0", entries[0].Client)
+	assert.Equal(t, "www.example.com.", entries[0].Name)
+	assert.Equal(t, "1.1.1.1:53", entries[0].Upstream)
+	assert.Zero(t, l.Dropped())
+}
+
+func TestLogger_Rotation(t *testing.T) {
+	dir := t.TempDir()
+	clk := &clock.MockClock{CurrentTime: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l, err := New(Options{Path: filepath.Join(dir, "queries.log"), RotateInterval: time.Hour, Clock: clk})
+	require.NoError(t, err)
+
+	l.Record(testEntry(t))
+	require.Eventually(t, func() bool {
+		info, err := os.Stat(filepath.Join(dir, "queries.log"))
+		return err == nil && info.Size() > 0
+	}, time.Second, time.Millisecond)
+	clk.Advance(time.Hour)
+	l.Record(testEntry(t))
+	require.NoError(t, l.Close())
+
+	assert.Len(t, readEntries(t, filepath.Join(dir, "queries-20250101T010000.000.log")), 1)
+	assert.Len(t, readEntries(t, filepath.Join(dir, "queries.log")), 1)
+}
+
+func TestNew_Errors(t *testing.T) {
+	_, err := New(Options{})
+	assert.ErrorIs(t, err, errPathRequired)
+
+	_, err = New(Options{Path: filepath.Join(t.TempDir(), "queries.log"), Anonymize: "scramble"})
+	assert.ErrorContains(t, err, "unknown client anonymization")
+
+	_, err = New(Options{Path: filepath.Join(t.TempDir(), "missing", "queries.log")})
+	assert.ErrorContains(t, err, "failed to open query log")
+}
+
+func TestLogger_CountsDroppedEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.log")
+	l, err := New(Options{Path: path, QueueSize: 1})
+	require.NoError(t, err)
+
+	// Recording faster than the writer drains a one-entry queue drops some entries
+	for range 100 {
+		l.Record(testEntry(t))
+	}
+	require.NoError(t, l.Close())
+	assert.Equal(t, uint64(100), l.Dropped()+uint64(len(readEntries(t, path))))
+}
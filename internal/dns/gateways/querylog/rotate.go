@@ -0,0 +1,186 @@
+package querylog
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+)
+
+// backupTimeFormat stamps rotated files with the time they were rotated. It
+// sorts lexically in time order.
+const backupTimeFormat = "20060102T150405.000"
+
+// rotatingFile appends to a file, moving it aside when it grows past maxBytes
+// or gets older than interval, and removes old rotated files beyond
+// maxBackups or maxAge. It is not safe for concurrent use.
+type rotatingFile struct {
+	path       string
+	maxBytes   int64
+	interval   time.Duration
+	maxBackups int
+	maxAge     time.Duration
+	clock      clock.Clock
+
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+// open opens (or creates) the log file for appending.
+func (f *rotatingFile) open() error {
+	//gosec:disable G304 -- the path comes from operator configuration
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open query log %s: %w", f.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.opened = f.clock.Now()
+	return nil
+}
+
+// Write appends p, rotating first if p would take the file past maxBytes or
+// the file has been open longer than interval. p is never split across files.
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.due(len(p)) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// due reports whether the file should be rotated before writing n more bytes.
+// An empty file is never rotated for size, so an oversized write still lands.
+func (f *rotatingFile) due(n int) bool {
+	if f.maxBytes > 0 && f.size > 0 && f.size+int64(n) > f.maxBytes {
+		return true
+	}
+	return f.interval > 0 && f.clock.Now().Sub(f.opened) >= f.interval
+}
+
+// rotate moves the current file aside, opens a new one and prunes old backups.
+func (f *rotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file = nil
+	if err := os.Rename(f.path, f.backupPath(f.clock.Now())); err != nil {
+		return fmt.Errorf("failed to rotate query log: %w", err)
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	return f.prune()
+}
+
+// backupPath names a rotated file after the log file and t, adding a counter
+// when a file rotated within the same millisecond already exists.
+func (f *rotatingFile) backupPath(t time.Time) string {
+	prefix, ext := f.backupAffixes()
+	name := prefix + t.UTC().Format(backupTimeFormat)
+	path := name + ext
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return path
+		}
+		path = name + "-" + strconv.Itoa(i) + ext
+	}
+}
+
+// backupAffixes returns the prefix and extension of rotated files: for
+// "/var/log/queries.log" they are named "/var/log/queries-<time>.log".
+func (f *rotatingFile) backupAffixes() (prefix, ext string) {
+	ext = filepath.Ext(f.path)
+	return strings.TrimSuffix(f.path, ext) + "-", ext
+}
+
+// backups lists rotated files with the time they were rotated, oldest first.
+func (f *rotatingFile) backups() ([]backup, error) {
+	prefix, ext := f.backupAffixes()
+	entries, err := os.ReadDir(filepath.Dir(f.path))
+	if err != nil {
+		return nil, err
+	}
+	base := filepath.Base(prefix)
+	var out []backup
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, base) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, base), ext)
+		if len(stamp) < len(backupTimeFormat) {
+			continue
+		}
+		t, err := time.Parse(backupTimeFormat, stamp[:len(backupTimeFormat)])
+		if err != nil {
+			continue
+		}
+		out = append(out, backup{path: filepath.Join(filepath.Dir(f.path), name), rotated: t})
+	}
+	slices.SortFunc(out, func(a, b backup) int {
+		return cmp.Or(a.rotated.Compare(b.rotated), cmp.Compare(len(a.path), len(b.path)), strings.Compare(a.path, b.path))
+	})
+	return out, nil
+}
+
+// backup is a rotated log file.
+type backup struct {
+	path    string
+	rotated time.Time
+}
+
+// prune removes rotated files beyond maxBackups, oldest first, and those
+// rotated longer than maxAge ago.
+func (f *rotatingFile) prune() error {
+	if f.maxBackups <= 0 && f.maxAge <= 0 {
+		return nil
+	}
+	backups, err := f.backups()
+	if err != nil {
+		return err
+	}
+	now := f.clock.Now()
+	var errs []error
+	for i, b := range backups {
+		expired := f.maxAge > 0 && now.Sub(b.rotated) > f.maxAge
+		excess := f.maxBackups > 0 && len(backups)-i > f.maxBackups
+		if expired || excess {
+			if err := os.Remove(b.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes the current file.
+func (f *rotatingFile) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,150 @@
+package querylog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+)
+
+// listDir returns the names of the files in dir.
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func newTestFile(t *testing.T, f rotatingFile) (*rotatingFile, *clock.MockClock) {
+	t.Helper()
+	clk := &clock.MockClock{CurrentTime: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	f.path = filepath.Join(t.TempDir(), "queries.log")
+	f.clock = clk
+	require.NoError(t, f.open())
+	t.Cleanup(func() { _ = f.Close() })
+	return &f, clk
+}
+
+func TestRotatingFile_SizeRotation(t *testing.T) {
+	f, clk := newTestFile(t, rotatingFile{maxBytes: 10})
+
+	_, err := f.Write([]byte("12345\n"))
+	require.NoError(t, err)
+	_, err = f.Write([]byte("123\n"))
+	require.NoError(t, err)
+	clk.Advance(time.Second)
+	_, err = f.Write([]byte("abc\n")) // 14 bytes would exceed 10
+	require.NoError(t, err)
+
+	dir := filepath.Dir(f.path)
+	assert.Equal(t, []string{"queries-20250101T000001.000.log", "queries.log"}, listDir(t, dir))
+	data, err := os.ReadFile(filepath.Join(dir, "queries-20250101T000001.000.log"))
+	require.NoError(t, err)
+	assert.Equal(t, "12345\n123\n", string(data))
+	data, err = os.ReadFile(f.path)
+	require.NoError(t, err)
+	assert.Equal(t, "abc\n", string(data))
+}
+
+func TestRotatingFile_OversizedWriteLandsWhole(t *testing.T) {
+	f, _ := newTestFile(t, rotatingFile{maxBytes: 4})
+	_, err := f.Write([]byte("0123456789\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"queries.log"}, listDir(t, filepath.Dir(f.path)))
+}
+
+func TestRotatingFile_TimeRotation(t *testing.T) {
+	f, clk := newTestFile(t, rotatingFile{interval: time.Hour})
+
+	_, err := f.Write([]byte("first\n"))
+	require.NoError(t, err)
+	clk.Advance(59 * time.Minute)
+	_, err = f.Write([]byte("second\n"))
+	require.NoError(t, err)
+	assert.Len(t, listDir(t, filepath.Dir(f.path)), 1)
+
+	clk.Advance(time.Minute)
+	_, err = f.Write([]byte("third\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"queries-20250101T010000.000.log", "queries.log"}, listDir(t, filepath.Dir(f.path)))
+}
+
+func TestRotatingFile_SameMillisecond(t *testing.T) {
+	f, _ := newTestFile(t, rotatingFile{maxBytes: 1})
+	for range 3 {
+		_, err := f.Write([]byte("x\n"))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{
+		"queries-20250101T000000.000-1.log",
+		"queries-20250101T000000.000.log",
+		"queries.log",
+	}, listDir(t, filepath.Dir(f.path)))
+
+	backups, err := f.backups()
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	assert.Equal(t, "queries-20250101T000000.000.log", filepath.Base(backups[0].path), "the first rotation sorts first")
+}
+
+func TestRotatingFile_Retention(t *testing.T) {
+	t.Run("max backups", func(t *testing.T) {
+		f, clk := newTestFile(t, rotatingFile{maxBytes: 1, maxBackups: 2})
+		for range 5 {
+			clk.Advance(time.Second)
+			_, err := f.Write([]byte("x\n"))
+			require.NoError(t, err)
+		}
+		assert.Equal(t, []string{
+			"queries-20250101T000004.000.log",
+			"queries-20250101T000005.000.log",
+			"queries.log",
+		}, listDir(t, filepath.Dir(f.path)))
+	})
+
+	t.Run("max age", func(t *testing.T) {
+		f, clk := newTestFile(t, rotatingFile{interval: time.Hour, maxAge: 90 * time.Minute})
+		dir := filepath.Dir(f.path)
+		unrelated := filepath.Join(dir, "queries-notes.log")
+		require.NoError(t, os.WriteFile(unrelated, nil, 0o600))
+		for range 4 {
+			_, err := f.Write([]byte("x\n"))
+			require.NoError(t, err)
+			clk.Advance(time.Hour)
+		}
+		assert.Equal(t, []string{
+			"queries-20250101T020000.000.log",
+			"queries-20250101T030000.000.log",
+			"queries-notes.log",
+			"queries.log",
+		}, listDir(t, dir))
+	})
+}
+
+func TestRotatingFile_ReopensAfterClose(t *testing.T) {
+	f, _ := newTestFile(t, rotatingFile{})
+	_, err := f.Write([]byte("a\n"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.NoError(t, f.Close())
+
+	_, err = f.Write([]byte("b\n"))
+	require.NoError(t, err)
+	data, err := os.ReadFile(f.path)
+	require.NoError(t, err)
+	assert.Equal(t, "a\nb\n", string(data))
+}
+
+func TestRotatingFile_OpenError(t *testing.T) {
+	f := &rotatingFile{path: filepath.Join(t.TempDir(), "missing", "queries.log"), clock: &clock.RealClock{}}
+	assert.ErrorContains(t, f.open(), "failed to open query log")
+}
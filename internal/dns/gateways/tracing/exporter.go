@@ -0,0 +1,108 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// exportTimeout bounds a single export.
+const exportTimeout = 10 * time.Second
+
+// Exporter sends encoded batches of spans to their destination. Each payload
+// is one OTLP/JSON ExportTraceServiceRequest.
+type Exporter interface {
+	Export(ctx context.Context, payload []byte) error
+	// Close releases the destination once the last batch is exported.
+	Close() error
+}
+
+// WriterExporter writes each batch as one line of JSON, the format of the
+// OpenTelemetry Collector's file exporter and receiver.
+type WriterExporter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer // nil when the writer is not owned, e.g. stdout
+}
+
+// NewWriterExporter creates an exporter writing to w, which it does not close.
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// NewFileExporter creates an exporter appending to the file at path,
+// creating it if needed.
+func NewFileExporter(path string) (*WriterExporter, error) {
+	//gosec:disable G304 -- the path comes from operator configuration
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace file %s: %w", path, err)
+	}
+	return &WriterExporter{w: f, closer: f}, nil
+}
+
+// Export writes payload followed by a newline.
+func (e *WriterExporter) Export(_ context.Context, payload []byte) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err := e.w.Write(append(payload, '\n'))
+	return err
+}
+
+// Close closes the file opened by NewFileExporter.
+func (e *WriterExporter) Close() error {
+	if e.closer == nil {
+		return nil
+	}
+	return e.closer.Close()
+}
+
+// HTTPExporter posts each batch to an OTLP/HTTP endpoint using JSON encoding.
+type HTTPExporter struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewHTTPExporter creates an exporter posting to endpoint, the full URL of a
+// collector's traces receiver, e.g. "http://localhost:4318/v1/traces".
+// A nil client uses one with a timeout of its own.
+func NewHTTPExporter(endpoint string, client *http.Client) *HTTPExporter {
+	if client == nil {
+		client = &http.Client{Timeout: exportTimeout}
+	}
+	return &HTTPExporter{endpoint: endpoint, client: client}
+}
+
+// Export posts payload and fails unless the collector accepts it.
+func (e *HTTPExporter) Export(ctx context.Context, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("trace collector %s returned %s", e.endpoint, resp.Status)
+	}
+	return nil
+}
+
+// Close does nothing; the HTTP client holds no resources that need releasing.
+func (e *HTTPExporter) Close() error {
+	return nil
+}
+
+var (
+	_ Exporter = (*WriterExporter)(nil)
+	_ Exporter = (*HTTPExporter)(nil)
+)
@@ -0,0 +1,68 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterExporter(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewWriterExporter(&buf)
+	require.NoError(t, e.Export(context.Background(), []byte(`{"a":1}`)))
+	require.NoError(t, e.Export(context.Background(), []byte(`{"b":2}`)))
+	require.NoError(t, e.Close())
+	assert.Equal(t, "{\"a\":1}\n{\"b\":2}\n", buf.String())
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("{}\n"), 0o600))
+
+	e, err := NewFileExporter(path)
+	require.NoError(t, err)
+	require.NoError(t, e.Export(context.Background(), []byte(`{"a":1}`)))
+	require.NoError(t, e.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "{}\n{\"a\":1}\n", string(data), "file is appended to")
+
+	_, err = NewFileExporter(filepath.Join(t.TempDir(), "missing", "traces.jsonl"))
+	assert.ErrorContains(t, err, "failed to open trace file")
+}
+
+func TestHTTPExporter(t *testing.T) {
+	var gotBody []byte
+	var gotType string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		gotType = r.Header.Get("Content-Type")
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	e := NewHTTPExporter(srv.URL+"/v1/traces", nil)
+	require.NoError(t, e.Export(context.Background(), []byte(`{"resourceSpans":[]}`)))
+	assert.Equal(t, "application/json", gotType)
+	assert.Equal(t, `{"resourceSpans":[]}`, string(gotBody))
+
+	status = http.StatusBadRequest
+	assert.ErrorContains(t, e.Export(context.Background(), []byte(`{}`)), "400 Bad Request")
+	assert.NoError(t, e.Close())
+
+	srv.Close()
+	assert.Error(t, e.Export(context.Background(), []byte(`{}`)))
+	assert.Error(t, NewHTTPExporter("://bad", nil).Export(context.Background(), nil))
+}
@@ -0,0 +1,141 @@
+package tracing
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// scopeName is the instrumentation scope of every exported span.
+const scopeName = "github.com/haukened/rr-dns"
+
+// statusCodeError is the OTLP status code of a failed span.
+const statusCodeError = 2
+
+// resource describes the process that produced the spans.
+type resource struct {
+	serviceName    string
+	serviceVersion string
+}
+
+// The types below mirror the OTLP/JSON encoding of an ExportTraceServiceRequest
+// (opentelemetry-proto trace/v1): IDs are hex strings and 64-bit integers are
+// decimal strings.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              int            `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            *otlpStatus    `json:"status,omitempty"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpKeyValue struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+)
+
+// encodeOTLP encodes a batch of spans as an OTLP/JSON ExportTraceServiceRequest.
+func encodeOTLP(res resource, spans []SpanData) ([]byte, error) {
+	attrs := []otlpKeyValue{keyValue("service.name", res.serviceName)}
+	if res.serviceVersion != "" {
+		attrs = append(attrs, keyValue("service.version", res.serviceVersion))
+	}
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		out = append(out, encodeSpan(s))
+	}
+	return json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: attrs},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: scopeName}, Spans: out}},
+	}}})
+}
+
+// encodeSpan converts one span to its OTLP form.
+func encodeSpan(s SpanData) otlpSpan {
+	out := otlpSpan{
+		TraceID:           hex.EncodeToString(s.TraceID[:]),
+		SpanID:            hex.EncodeToString(s.SpanID[:]),
+		Name:              s.Name,
+		Kind:              int(s.Kind),
+		StartTimeUnixNano: unixNano(s.Start),
+		EndTimeUnixNano:   unixNano(s.End),
+	}
+	if s.ParentSpanID != (SpanID{}) {
+		out.ParentSpanID = hex.EncodeToString(s.ParentSpanID[:])
+	}
+	for _, a := range s.Attributes {
+		out.Attributes = append(out.Attributes, keyValue(a.Key, a.Value))
+	}
+	if s.Err != nil {
+		out.Status = &otlpStatus{Code: statusCodeError, Message: s.Err.Error()}
+	}
+	return out
+}
+
+// keyValue converts an attribute value to the matching OTLP value type.
+// Values of other types are recorded as their string form.
+func keyValue(key string, value any) otlpKeyValue {
+	var v otlpValue
+	switch x := value.(type) {
+	case string:
+		v.StringValue = &x
+	case bool:
+		v.BoolValue = &x
+	case int:
+		v.IntValue = ptr(strconv.FormatInt(int64(x), 10))
+	case int64:
+		v.IntValue = ptr(strconv.FormatInt(x, 10))
+	case uint16:
+		v.IntValue = ptr(strconv.FormatUint(uint64(x), 10))
+	case uint32:
+		v.IntValue = ptr(strconv.FormatUint(uint64(x), 10))
+	case float64:
+		v.DoubleValue = &x
+	default:
+		v.StringValue = ptr(fmt.Sprint(value))
+	}
+	return otlpKeyValue{Key: key, Value: v}
+}
+
+// unixNano formats t as nanoseconds since the Unix epoch.
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
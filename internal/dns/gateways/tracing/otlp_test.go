@@ -0,0 +1,91 @@
+package tracing
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+func TestEncodeOTLP(t *testing.T) {
+	start := time.Unix(1700000000, 5)
+	spans := []SpanData{{
+		TraceID:      TraceID{0: 0x01, 15: 0xff},
+		SpanID:       SpanID{0: 0x02},
+		ParentSpanID: SpanID{7: 0x03},
+		Name:         resolver.SpanUpstreamAttempt,
+		Kind:         resolver.SpanKindClient,
+		Start:        start,
+		End:          start.Add(time.Millisecond),
+		Attributes: []Attribute{
+			{resolver.AttrServer, "1.1.1.1:53"},
+			{resolver.AttrAnswerCount, 2},
+		},
+		Err: errors.New("timeout"),
+	}}
+
+	payload, err := encodeOTLP(resource{serviceName: "rr-dnsd", serviceVersion: "1.0.0"}, spans)
+	require.NoError(t, err)
+
+	want := `{"resourceSpans":[{
+		"resource":{"attributes":[
+			{"key":"service.name","value":{"stringValue":"rr-dnsd"}},
+			{"key":"service.version","value":{"stringValue":"1.0.0"}}]},
+		"scopeSpans":[{"scope":{"name":"github.com/haukened/rr-dns"},"spans":[{
+			"traceId":"010000000000000000000000000000ff",
+			"spanId":"0200000000000000",
+			"parentSpanId":"0000000000000003",
+			"name":"dns.upstream.attempt",
+			"kind":3,
+			"startTimeUnixNano":"1700000000000000005",
+			"endTimeUnixNano":"1700000000001000005",
+			"attributes":[
+				{"key":"server.address","value":{"stringValue":"1.1.1.1:53"}},
+				{"key":"dns.answer.count","value":{"intValue":"2"}}],
+			"status":{"code":2,"message":"timeout"}}]}]}]}`
+	assert.JSONEq(t, want, string(payload))
+}
+
+func TestEncodeOTLP_RootWithoutStatus(t *testing.T) {
+	payload, err := encodeOTLP(resource{serviceName: "rr-dnsd"}, []SpanData{{Name: resolver.SpanQuery}})
+	require.NoError(t, err)
+
+	var req otlpRequest
+	require.NoError(t, json.Unmarshal(payload, &req))
+	rs := req.ResourceSpans[0]
+	assert.Len(t, rs.Resource.Attributes, 1)
+	s := rs.ScopeSpans[0].Spans[0]
+	assert.Empty(t, s.ParentSpanID)
+	assert.Nil(t, s.Status)
+	assert.Empty(t, s.Attributes)
+}
+
+func TestKeyValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{"string", "a", `{"stringValue":"a"}`},
+		{"bool", true, `{"boolValue":true}`},
+		{"int", -3, `{"intValue":"-3"}`},
+		{"int64", int64(1) << 40, `{"intValue":"1099511627776"}`},
+		{"uint16", uint16(53), `{"intValue":"53"}`},
+		{"uint32", uint32(300), `{"intValue":"300"}`},
+		{"float64", 0.5, `{"doubleValue":0.5}`},
+		{"other", time.Second, `{"stringValue":"1s"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kv := keyValue("k", tt.value)
+			got, err := json.Marshal(kv.Value)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package tracing
+
+import (
+	"sync"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// TraceID identifies a trace, as in W3C Trace Context.
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+// Attribute is one key/value pair recorded on a span.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// SpanData is a finished span as handed to the exporter.
+type SpanData struct {
+	TraceID      TraceID
+	SpanID       SpanID
+	ParentSpanID SpanID // zero for the root span of a trace
+	Name         string
+	Kind         resolver.SpanKind
+	Start        time.Time
+	End          time.Time
+	Attributes   []Attribute // in the order first set
+	Err          error       // the last error recorded, if any
+}
+
+// span implements resolver.Span. Unsampled spans still carry IDs, so their
+// children join the same trace and inherit the decision, but record nothing.
+type span struct {
+	tracer  *Tracer
+	sampled bool
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// SetAttribute records value under key, replacing an earlier value.
+func (s *span) SetAttribute(key string, value any) {
+	if !s.sampled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.data.Attributes {
+		if s.data.Attributes[i].Key == key {
+			s.data.Attributes[i].Value = value
+			return
+		}
+	}
+	s.data.Attributes = append(s.data.Attributes, Attribute{Key: key, Value: value})
+}
+
+// RecordError marks the span as failed with err.
+func (s *span) RecordError(err error) {
+	if !s.sampled || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Err = err
+}
+
+// End finishes the span and queues it for export. Later calls do nothing.
+func (s *span) End() {
+	if !s.sampled {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = s.tracer.clock.Now()
+	data := s.data
+	s.mu.Unlock()
+	s.tracer.enqueue(data)
+}
+
+var _ resolver.Span = (*span)(nil)
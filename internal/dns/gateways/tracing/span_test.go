@@ -0,0 +1,56 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+func TestSpan_SetAttribute(t *testing.T) {
+	tr, _ := newTestTracer(t, Options{SampleRatio: 1})
+	defer func() { _ = tr.Shutdown(context.Background()) }()
+
+	_, s := tr.Start(context.Background(), resolver.SpanQuery, resolver.SpanKindServer)
+	s.SetAttribute("a", 1)
+	s.SetAttribute("b", "x")
+	s.SetAttribute("a", 2)
+	assert.Equal(t, []Attribute{{"a", 2}, {"b", "x"}}, s.(*span).data.Attributes)
+}
+
+func TestSpan_RecordError(t *testing.T) {
+	tr, _ := newTestTracer(t, Options{SampleRatio: 1})
+	defer func() { _ = tr.Shutdown(context.Background()) }()
+
+	_, s := tr.Start(context.Background(), resolver.SpanQuery, resolver.SpanKindServer)
+	err := errors.New("boom")
+	s.RecordError(err)
+	s.RecordError(nil)
+	assert.Equal(t, err, s.(*span).data.Err)
+}
+
+func TestSpan_Unsampled(t *testing.T) {
+	tr, _ := newTestTracer(t, Options{SampleRatio: 0})
+	defer func() { _ = tr.Shutdown(context.Background()) }()
+
+	ctx, s := tr.Start(context.Background(), resolver.SpanQuery, resolver.SpanKindServer)
+	s.SetAttribute("a", 1)
+	s.RecordError(errors.New("boom"))
+	s.End()
+
+	root := s.(*span)
+	assert.False(t, root.sampled)
+	assert.Empty(t, root.data.Attributes)
+	assert.NoError(t, root.data.Err)
+	assert.False(t, root.ended)
+
+	_, c := tr.Start(ctx, resolver.SpanZoneLookup, resolver.SpanKindInternal)
+	child := c.(*span)
+	require.False(t, child.sampled)
+	assert.Equal(t, root.data.TraceID, child.data.TraceID)
+	assert.Equal(t, root.data.SpanID, child.data.ParentSpanID)
+}
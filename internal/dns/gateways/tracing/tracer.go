@@ -0,0 +1,252 @@
+// Package tracing records the trace spans started by the resolver and upstream
+// clients and exports them in batches as OTLP/JSON, either to an OpenTelemetry
+// collector over HTTP or to a file or stdout for offline use.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/common/log"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+const (
+	// DefaultServiceName is the service.name resource attribute of exported spans.
+	DefaultServiceName = "rr-dnsd"
+	// DefaultBatchSize is the number of spans exported together.
+	DefaultBatchSize = 512
+	// DefaultQueueSize is the number of finished spans buffered for export.
+	DefaultQueueSize = 2048
+	// DefaultFlushInterval is how often a partial batch is exported.
+	DefaultFlushInterval = 5 * time.Second
+)
+
+// errExporterRequired is returned by NewTracer without an Exporter.
+var errExporterRequired = errors.New("trace exporter is required")
+
+// Options configures a Tracer.
+type Options struct {
+	// Exporter receives each batch of finished spans. Required.
+	Exporter Exporter
+	// ServiceName and ServiceVersion identify rr-dnsd in exported spans.
+	// ServiceName defaults to DefaultServiceName.
+	ServiceName    string
+	ServiceVersion string
+	// SampleRatio is the share of traces recorded, from 0 (none) to 1 (all).
+	// Spans follow the decision made for the root of their trace.
+	SampleRatio float64
+	// BatchSize, QueueSize and FlushInterval tune batching; zero uses the
+	// defaults. Spans finished while the queue is full are dropped.
+	BatchSize     int
+	QueueSize     int
+	FlushInterval time.Duration
+	// options to inject for testing purposes
+	Clock  clock.Clock
+	Logger log.Logger
+}
+
+// Tracer implements resolver.Tracer. Finished spans are queued and exported
+// in batches by a background goroutine until Shutdown.
+type Tracer struct {
+	exporter  Exporter
+	resource  resource
+	threshold uint64 // traces whose ID sorts below this are sampled
+	sampleAll bool
+	batchSize int
+	interval  time.Duration
+	clock     clock.Clock
+	logger    log.Logger
+
+	mu      sync.RWMutex // guards closed against concurrent sends on queue
+	closed  bool
+	queue   chan SpanData
+	dropped atomic.Uint64
+	done    chan struct{}
+}
+
+// NewTracer creates a Tracer and starts exporting the spans it records.
+func NewTracer(opts Options) (*Tracer, error) {
+	if opts.Exporter == nil {
+		return nil, errExporterRequired
+	}
+	if opts.ServiceName == "" {
+		opts.ServiceName = DefaultServiceName
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = DefaultFlushInterval
+	}
+	if opts.Clock == nil {
+		opts.Clock = &clock.RealClock{}
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.NewNoopLogger()
+	}
+	ratio := min(max(opts.SampleRatio, 0), 1)
+	var threshold uint64
+	if ratio < 1 {
+		threshold = uint64(math.Ldexp(ratio, 64))
+	}
+	t := &Tracer{
+		exporter:  opts.Exporter,
+		resource:  resource{serviceName: opts.ServiceName, serviceVersion: opts.ServiceVersion},
+		threshold: threshold,
+		sampleAll: ratio == 1,
+		batchSize: opts.BatchSize,
+		interval:  opts.FlushInterval,
+		clock:     opts.Clock,
+		logger:    opts.Logger,
+		queue:     make(chan SpanData, opts.QueueSize),
+		done:      make(chan struct{}),
+	}
+	go t.run()
+	return t, nil
+}
+
+// spanContextKey is the context key under which the current span is stored.
+type spanContextKey struct{}
+
+// Start begins a span. When ctx carries a span the new one joins its trace as
+// a child and shares its sampling decision; otherwise a new trace begins.
+func (t *Tracer) Start(ctx context.Context, name string, kind resolver.SpanKind) (context.Context, resolver.Span) {
+	s := &span{tracer: t}
+	if parent, ok := ctx.Value(spanContextKey{}).(*span); ok {
+		s.data.TraceID = parent.data.TraceID
+		s.data.ParentSpanID = parent.data.SpanID
+		s.sampled = parent.sampled
+	} else {
+		s.data.TraceID = newTraceID()
+		s.sampled = t.sample(s.data.TraceID)
+	}
+	s.data.SpanID = newSpanID()
+	s.data.Name = name
+	s.data.Kind = kind
+	if s.sampled {
+		s.data.Start = t.clock.Now()
+	}
+	return context.WithValue(ctx, spanContextKey{}, s), s
+}
+
+// sample decides whether the trace with the given ID is recorded, from the
+// random bits of the ID, as OpenTelemetry's TraceIdRatioBased sampler does.
+func (t *Tracer) sample(id TraceID) bool {
+	if t.sampleAll {
+		return true
+	}
+	return binary.BigEndian.Uint64(id[8:]) < t.threshold
+}
+
+// enqueue hands a finished span to the export goroutine, dropping it when the
+// queue is full or the tracer has shut down.
+func (t *Tracer) enqueue(data SpanData) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return
+	}
+	select {
+	case t.queue <- data:
+	default:
+		t.dropped.Add(1)
+	}
+}
+
+// run batches queued spans and exports them when a batch fills up, when the
+// flush interval passes, and when the queue is closed by Shutdown.
+func (t *Tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, t.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		t.export(batch)
+		batch = make([]SpanData, 0, t.batchSize)
+	}
+	for {
+		select {
+		case data, ok := <-t.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, data)
+			if len(batch) >= t.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// export encodes a batch and sends it to the exporter, logging failures:
+// losing spans must never affect query handling.
+func (t *Tracer) export(batch []SpanData) {
+	payload, err := encodeOTLP(t.resource, batch)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		err = t.exporter.Export(ctx, payload)
+		cancel()
+	}
+	if err != nil {
+		t.logger.Warn(map[string]any{"error": err, "spans": len(batch)}, "Failed to export trace spans")
+	}
+}
+
+// Dropped returns the number of spans discarded because the export queue was full.
+func (t *Tracer) Dropped() uint64 {
+	return t.dropped.Load()
+}
+
+// Shutdown stops accepting spans, exports those still queued and closes the
+// exporter. It returns early with ctx's error if ctx is done first.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	close(t.queue)
+	t.mu.Unlock()
+
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return t.exporter.Close()
+}
+
+// newTraceID returns a random trace ID.
+func newTraceID() TraceID {
+	var id TraceID
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+// newSpanID returns a random span ID.
+func newSpanID() SpanID {
+	var id SpanID
+	_, _ = rand.Read(id[:])
+	return id
+}
+
+var _ resolver.Tracer = (*Tracer)(nil)
@@ -0,0 +1,219 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// memoryExporter keeps every payload it is given.
+type memoryExporter struct {
+	mu       sync.Mutex
+	payloads [][]byte
+	err      error
+	closed   bool
+}
+
+func (e *memoryExporter) Export(_ context.Context, payload []byte) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.payloads = append(e.payloads, payload)
+	return e.err
+}
+
+func (e *memoryExporter) Close() error {
+	e.closed = true
+	return nil
+}
+
+// spans decodes every exported span, in export order.
+func (e *memoryExporter) spans(t *testing.T) []otlpSpan {
+	t.Helper()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var out []otlpSpan
+	for _, p := range e.payloads {
+		var req otlpRequest
+		require.NoError(t, json.Unmarshal(p, &req))
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				out = append(out, ss.Spans...)
+			}
+		}
+	}
+	return out
+}
+
+func newTestTracer(t *testing.T, opts Options) (*Tracer, *memoryExporter) {
+	t.Helper()
+	exp := &memoryExporter{}
+	opts.Exporter = exp
+	if opts.Clock == nil {
+		opts.Clock = &clock.MockClock{CurrentTime: time.Unix(1700000000, 0)}
+	}
+	tr, err := NewTracer(opts)
+	require.NoError(t, err)
+	return tr, exp
+}
+
+func TestNewTracer_RequiresExporter(t *testing.T) {
+	_, err := NewTracer(Options{SampleRatio: 1})
+	assert.ErrorIs(t, err, errExporterRequired)
+}
+
+func TestTracer_ParentAndChild(t *testing.T) {
+	clk := &clock.MockClock{CurrentTime: time.Unix(1700000000, 0)}
+	tr, exp := newTestTracer(t, Options{SampleRatio: 1, Clock: clk})
+
+	ctx, root := tr.Start(context.Background(), resolver.SpanQuery, resolver.SpanKindServer)
+	root.SetAttribute(resolver.AttrQuestionName, "example.com.")
+	_, child := tr.Start(ctx, resolver.SpanCacheLookup, resolver.SpanKindInternal)
+	clk.Advance(time.Millisecond)
+	child.SetAttribute(resolver.AttrCacheHit, false)
+	child.RecordError(errors.New("boom"))
+	child.End()
+	root.End()
+	root.End() // a second End is ignored
+
+	require.NoError(t, tr.Shutdown(context.Background()))
+	assert.True(t, exp.closed)
+
+	spans := exp.spans(t)
+	require.Len(t, spans, 2)
+	c, r := spans[0], spans[1]
+	assert.Equal(t, resolver.SpanCacheLookup, c.Name)
+	assert.Equal(t, r.TraceID, c.TraceID)
+	assert.Equal(t, r.SpanID, c.ParentSpanID)
+	assert.Empty(t, r.ParentSpanID)
+	assert.NotEqual(t, r.SpanID, c.SpanID)
+	assert.Equal(t, int(resolver.SpanKindServer), r.Kind)
+	assert.Equal(t, "1700000000000000000", r.StartTimeUnixNano)
+	assert.Equal(t, "1700000000001000000", c.EndTimeUnixNano)
+	assert.Equal(t, &otlpStatus{Code: statusCodeError, Message: "boom"}, c.Status)
+	assert.Nil(t, r.Status)
+}
+
+func TestTracer_Sampling(t *testing.T) {
+	t.Run("ratio zero records nothing", func(t *testing.T) {
+		tr, exp := newTestTracer(t, Options{SampleRatio: 0})
+		ctx, root := tr.Start(context.Background(), resolver.SpanQuery, resolver.SpanKindServer)
+		_, child := tr.Start(ctx, resolver.SpanZoneLookup, resolver.SpanKindInternal)
+		child.End()
+		root.End()
+		require.NoError(t, tr.Shutdown(context.Background()))
+		assert.Empty(t, exp.spans(t))
+	})
+
+	t.Run("children follow the root decision", func(t *testing.T) {
+		tr, exp := newTestTracer(t, Options{SampleRatio: 0.5})
+		for range 200 {
+			ctx, root := tr.Start(context.Background(), resolver.SpanQuery, resolver.SpanKindServer)
+			_, child := tr.Start(ctx, resolver.SpanZoneLookup, resolver.SpanKindInternal)
+			child.End()
+			root.End()
+		}
+		require.NoError(t, tr.Shutdown(context.Background()))
+
+		traces := make(map[string]int)
+		for _, s := range exp.spans(t) {
+			traces[s.TraceID]++
+		}
+		assert.Greater(t, len(traces), 0)
+		assert.Less(t, len(traces), 200)
+		for id, n := range traces {
+			assert.Equal(t, 2, n, "trace %s is incomplete", id)
+		}
+	})
+}
+
+func TestTracer_Batching(t *testing.T) {
+	tr, exp := newTestTracer(t, Options{SampleRatio: 1, BatchSize: 2})
+	for range 5 {
+		_, s := tr.Start(context.Background(), resolver.SpanQuery, resolver.SpanKindServer)
+		s.End()
+	}
+	require.NoError(t, tr.Shutdown(context.Background()))
+	assert.Len(t, exp.payloads, 3)
+	assert.Len(t, exp.spans(t), 5)
+}
+
+func TestTracer_FlushInterval(t *testing.T) {
+	tr, exp := newTestTracer(t, Options{SampleRatio: 1, FlushInterval: 10 * time.Millisecond})
+	defer func() { _ = tr.Shutdown(context.Background()) }()
+
+	_, s := tr.Start(context.Background(), resolver.SpanQuery, resolver.SpanKindServer)
+	s.End()
+	assert.Eventually(t, func() bool {
+		exp.mu.Lock()
+		defer exp.mu.Unlock()
+		return len(exp.payloads) == 1
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestTracer_QueueFullDropsSpans(t *testing.T) {
+	exp := &blockingExporter{release: make(chan struct{})}
+	tr, err := NewTracer(Options{Exporter: exp, SampleRatio: 1, BatchSize: 1, QueueSize: 1})
+	require.NoError(t, err)
+
+	for range 10 {
+		_, s := tr.Start(context.Background(), resolver.SpanQuery, resolver.SpanKindServer)
+		s.End()
+	}
+	assert.Positive(t, tr.Dropped())
+	close(exp.release)
+	require.NoError(t, tr.Shutdown(context.Background()))
+}
+
+func TestTracer_Shutdown(t *testing.T) {
+	t.Run("spans after shutdown are ignored", func(t *testing.T) {
+		tr, exp := newTestTracer(t, Options{SampleRatio: 1})
+		require.NoError(t, tr.Shutdown(context.Background()))
+		require.NoError(t, tr.Shutdown(context.Background()))
+		_, s := tr.Start(context.Background(), resolver.SpanQuery, resolver.SpanKindServer)
+		s.End()
+		assert.Empty(t, exp.payloads)
+	})
+
+	t.Run("gives up when the context ends", func(t *testing.T) {
+		exp := &blockingExporter{release: make(chan struct{})}
+		defer close(exp.release)
+		tr, err := NewTracer(Options{Exporter: exp, SampleRatio: 1})
+		require.NoError(t, err)
+		_, s := tr.Start(context.Background(), resolver.SpanQuery, resolver.SpanKindServer)
+		s.End()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, tr.Shutdown(ctx), context.DeadlineExceeded)
+	})
+}
+
+func TestTracer_ExportErrorIsLogged(t *testing.T) {
+	tr, exp := newTestTracer(t, Options{SampleRatio: 1})
+	exp.err = errors.New("collector down")
+	_, s := tr.Start(context.Background(), resolver.SpanQuery, resolver.SpanKindServer)
+	s.End()
+	assert.NoError(t, tr.Shutdown(context.Background()))
+	assert.Len(t, exp.payloads, 1)
+}
+
+// blockingExporter blocks every export until release is closed.
+type blockingExporter struct {
+	release chan struct{}
+}
+
+func (e *blockingExporter) Export(ctx context.Context, _ []byte) error {
+	<-e.release
+	return nil
+}
+
+func (e *blockingExporter) Close() error { return nil }
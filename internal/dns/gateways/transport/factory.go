@@ -26,6 +26,9 @@ func NewTransport(transportType TransportType, addr string, codec wire.DNSCodec,
 	case TransportUDP:
 		return NewUDPTransport(addr, codec, logger), nil
 
+	case TransportTCP:
+		return NewTCPTransport(addr, codec, logger), nil
+
 	case TransportDoH:
 		return nil, fmt.Errorf("DNS over HTTPS transport not yet implemented")
 
@@ -44,6 +47,7 @@ func NewTransport(transportType TransportType, addr string, codec wire.DNSCodec,
 func GetSupportedTransports() []TransportType {
 	return []TransportType{
 		TransportUDP,
+		TransportTCP,
 		// Future implementations will be added here:
 		// TransportDoH,
 		// TransportDoT,
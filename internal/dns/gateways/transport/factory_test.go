@@ -26,6 +26,12 @@ func TestNewTransport(t *testing.T) {
 			addr:          "127.0.0.1:0",
 			wantErr:       false,
 		},
+		{
+			name:          "TCP transport success",
+			transportType: TransportTCP,
+			addr:          "127.0.0.1:0",
+			wantErr:       false,
+		},
 		{
 			name:          "DoH transport not implemented",
 			transportType: TransportDoH,
@@ -78,6 +84,7 @@ func TestGetSupportedTransports(t *testing.T) {
 
 	assert.NotEmpty(t, supported)
 	assert.Contains(t, supported, TransportUDP)
+	assert.Contains(t, supported, TransportTCP)
 
 	// Verify it returns a new slice each time (not a shared reference)
 	supported1 := GetSupportedTransports()
@@ -103,6 +110,11 @@ func TestIsTransportSupported(t *testing.T) {
 			transportType: TransportUDP,
 			expected:      true,
 		},
+		{
+			name:          "TCP is supported",
+			transportType: TransportTCP,
+			expected:      true,
+		},
 		{
 			name:          "DoH is not supported yet",
 			transportType: TransportDoH,
@@ -141,6 +153,7 @@ func TestIsTransportSupported(t *testing.T) {
 func TestTransportConstants(t *testing.T) {
 	// Verify transport type constants are defined correctly
 	assert.Equal(t, TransportType("udp"), TransportUDP)
+	assert.Equal(t, TransportType("tcp"), TransportTCP)
 	assert.Equal(t, TransportType("doh"), TransportDoH)
 	assert.Equal(t, TransportType("dot"), TransportDoT)
 	assert.Equal(t, TransportType("doq"), TransportDoQ)
@@ -0,0 +1,313 @@
+package transport
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/common/log"
+	"github.com/haukened/rr-dns/internal/dns/gateways/wire"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+const (
+	// tcpIdleTimeout is how long a client connection may wait between queries,
+	// or take to accept a response, before it is closed (RFC 7766 §6.2.3).
+	tcpIdleTimeout = 10 * time.Second
+
+	// maxTCPConnections bounds the client connections served at once; further
+	// connections are closed as soon as they are accepted.
+	maxTCPConnections = 256
+)
+
+// TCPTransport implements ServerTransport for DNS over TCP (RFC 1035 §4.2.2,
+// RFC 7766). It answers the clients a truncated UDP response sends back over
+// TCP, reading length-prefixed queries from each connection until the client
+// closes it or stays idle, and answering them concurrently.
+type TCPTransport struct {
+	addr     string
+	listener net.Listener
+	codec    wire.DNSCodec
+	logger   log.Logger
+	metrics  resolver.Metrics
+	tap      resolver.MessageTap
+
+	// idleTimeout closes connections that stop sending queries
+	idleTimeout time.Duration
+
+	// Synchronization for graceful shutdown
+	mu      sync.Mutex
+	running bool
+	conns   map[net.Conn]struct{}
+}
+
+// NewTCPTransport creates a new TCP transport instance.
+func NewTCPTransport(addr string, codec wire.DNSCodec, logger log.Logger) *TCPTransport {
+	return NewTCPTransportWithMetrics(addr, codec, logger, resolver.NopMetrics{})
+}
+
+// NewTCPTransportWithMetrics creates a TCP transport that reports every query
+// it serves or drops to metrics.
+func NewTCPTransportWithMetrics(addr string, codec wire.DNSCodec, logger log.Logger, metrics resolver.Metrics) *TCPTransport {
+	return &TCPTransport{
+		addr:        addr,
+		codec:       codec,
+		logger:      logger,
+		metrics:     metrics,
+		tap:         resolver.NopTap{},
+		idleTimeout: tcpIdleTimeout,
+		conns:       make(map[net.Conn]struct{}),
+	}
+}
+
+// SetTap sends a copy of every query received and every response sent to tap.
+// It must be called before Start.
+func (t *TCPTransport) SetTap(tap resolver.MessageTap) {
+	t.tap = tap
+}
+
+// Start begins listening for TCP DNS connections on the configured address.
+func (t *TCPTransport) Start(ctx context.Context, handler resolver.DNSResponder) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.running {
+		return fmt.Errorf("TCP transport already running")
+	}
+
+	listener, err := net.Listen("tcp", t.addr)
+	if err != nil {
+		return fmt.Errorf("failed to bind TCP socket on %s: %w", t.addr, err)
+	}
+
+	t.listener = listener
+	t.running = true
+
+	t.logger.Info(map[string]any{
+		"transport": "tcp",
+		"address":   t.addr,
+	}, "DNS transport started")
+
+	go t.acceptLoop(ctx, handler)
+
+	return nil
+}
+
+// Stop closes the listener and every open client connection.
+func (t *TCPTransport) Stop() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.running {
+		return nil
+	}
+	t.running = false
+
+	var closeErr error
+	if t.listener != nil {
+		closeErr = t.listener.Close()
+		if closeErr != nil {
+			t.logger.Warn(map[string]any{
+				"error": closeErr.Error(),
+			}, "Error closing TCP listener")
+		}
+	}
+	for conn := range t.conns {
+		_ = conn.Close()
+	}
+
+	t.logger.Info(map[string]any{
+		"transport": "tcp",
+		"address":   t.addr,
+	}, "DNS transport stopped")
+
+	return closeErr
+}
+
+// Address returns the network address the transport is bound to.
+func (t *TCPTransport) Address() string {
+	return t.addr
+}
+
+// acceptLoop accepts client connections until the listener is closed.
+func (t *TCPTransport) acceptLoop(ctx context.Context, handler resolver.DNSResponder) {
+	// Closing the listener unblocks Accept when the context ends first.
+	stop := context.AfterFunc(ctx, func() { _ = t.Stop() })
+	defer stop()
+
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			t.mu.Lock()
+			running := t.running
+			t.mu.Unlock()
+
+			if !running {
+				return // Normal shutdown
+			}
+
+			t.logger.Warn(map[string]any{
+				"error": err.Error(),
+			}, "Failed to accept TCP connection")
+			continue
+		}
+
+		if !t.track(conn) {
+			t.logger.Warn(map[string]any{
+				"client": conn.RemoteAddr().String(),
+				"limit":  maxTCPConnections,
+			}, "Too many TCP connections, closing")
+			_ = conn.Close()
+			continue
+		}
+		go t.serveConn(ctx, conn, handler)
+	}
+}
+
+// track records conn as open, reporting false when the transport is stopped
+// or already serving maxTCPConnections.
+func (t *TCPTransport) track(conn net.Conn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.running || len(t.conns) >= maxTCPConnections {
+		return false
+	}
+	t.conns[conn] = struct{}{}
+	return true
+}
+
+// serveConn reads queries from conn until the client closes it, stays idle
+// longer than idleTimeout or sends a partial message. Every query is answered
+// in its own goroutine, so responses may go out in a different order than the
+// queries came in (RFC 7766 §6.2.1.1).
+func (t *TCPTransport) serveConn(ctx context.Context, conn net.Conn, handler resolver.DNSResponder) {
+	var writeMu sync.Mutex
+	var pending sync.WaitGroup
+	defer func() {
+		pending.Wait()
+		t.mu.Lock()
+		delete(t.conns, conn)
+		t.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	for {
+		if err := conn.SetReadDeadline(time.Now().Add(t.idleTimeout)); err != nil {
+			return
+		}
+		var prefix [2]byte
+		if _, err := io.ReadFull(conn, prefix[:]); err != nil {
+			return // closed by the client, idle, or shutting down
+		}
+		msg := make([]byte, binary.BigEndian.Uint16(prefix[:]))
+		if _, err := io.ReadFull(conn, msg); err != nil {
+			t.logger.Debug(map[string]any{
+				"client": conn.RemoteAddr().String(),
+				"error":  err.Error(),
+			}, "Failed to read TCP DNS message")
+			return
+		}
+
+		pending.Add(1)
+		go func() {
+			defer pending.Done()
+			t.handleMessage(ctx, conn, &writeMu, msg, handler)
+		}()
+	}
+}
+
+// handleMessage answers a single query read from conn, writing the
+// length-prefixed response under writeMu.
+func (t *TCPTransport) handleMessage(ctx context.Context, conn net.Conn, writeMu *sync.Mutex, data []byte, handler resolver.DNSResponder) {
+	start := time.Now()
+	clientAddr := conn.RemoteAddr()
+	t.tap.Tap(resolver.TapMessage{
+		Type:         resolver.TapClientQuery,
+		Protocol:     string(TransportTCP),
+		QueryAddr:    clientAddr,
+		ResponseAddr: conn.LocalAddr(),
+		QueryTime:    start,
+		Message:      data,
+	})
+
+	query, err := t.codec.DecodeQuery(data)
+	if err != nil {
+		t.logger.Warn(map[string]any{
+			"client": clientAddr.String(),
+			"error":  err.Error(),
+			"size":   len(data),
+		}, "Failed to decode DNS query")
+		t.metrics.QueryFailed(string(TransportTCP), "decode")
+		return
+	}
+
+	t.logger.Debug(map[string]any{
+		"client":   clientAddr.String(),
+		"query_id": query.ID,
+		"name":     query.Name,
+		"type":     query.Type,
+	}, "Received DNS query")
+
+	response, err := handler.HandleQuery(ctx, query, clientAddr)
+	if err != nil {
+		t.logger.Error(map[string]any{
+			"client":   clientAddr.String(),
+			"query_id": query.ID,
+			"error":    err.Error(),
+		}, "Failed to handle DNS query")
+		t.metrics.QueryFailed(string(TransportTCP), "handle")
+		return
+	}
+
+	// Over TCP the whole answer is sent, however small the client's UDP payload size.
+	responseData, err := t.codec.EncodeStreamResponse(response)
+	if err != nil {
+		t.logger.Error(map[string]any{
+			"client":   clientAddr.String(),
+			"query_id": query.ID,
+			"error":    err.Error(),
+		}, "Failed to encode DNS response")
+		t.metrics.QueryFailed(string(TransportTCP), "encode")
+		return
+	}
+
+	framed := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(responseData)), uint16(len(responseData)))
+	framed = append(framed, responseData...)
+	writeMu.Lock()
+	err = conn.SetWriteDeadline(time.Now().Add(t.idleTimeout))
+	if err == nil {
+		_, err = conn.Write(framed)
+	}
+	writeMu.Unlock()
+	if err != nil {
+		t.logger.Error(map[string]any{
+			"client":   clientAddr.String(),
+			"query_id": response.ID,
+			"error":    err.Error(),
+		}, "Failed to send DNS response")
+		t.metrics.QueryFailed(string(TransportTCP), "send")
+		return
+	}
+	t.tap.Tap(resolver.TapMessage{
+		Type:         resolver.TapClientResponse,
+		Protocol:     string(TransportTCP),
+		QueryAddr:    clientAddr,
+		ResponseAddr: conn.LocalAddr(),
+		QueryTime:    start,
+		ResponseTime: time.Now(),
+		Message:      responseData,
+	})
+	t.metrics.QueryServed(string(TransportTCP), query, response.RCode, time.Since(start))
+
+	t.logger.Debug(map[string]any{
+		"client":   clientAddr.String(),
+		"query_id": response.ID,
+		"rcode":    response.RCode,
+		"answers":  len(response.Answers),
+		"size":     len(responseData),
+	}, "Sent DNS response")
+}
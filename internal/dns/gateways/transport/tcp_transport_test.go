@@ -0,0 +1,245 @@
+package transport
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// startTCP starts transport on a loopback port and dials it.
+func startTCP(t *testing.T, transport *TCPTransport, handler resolver.DNSResponder) net.Conn {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	require.NoError(t, transport.Start(ctx, handler))
+	t.Cleanup(func() { require.NoError(t, transport.Stop()) })
+
+	conn, err := net.Dial("tcp", transport.listener.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	require.NoError(t, conn.SetDeadline(time.Now().Add(2*time.Second)))
+	return conn
+}
+
+// writeFramed sends msg with its two-byte length prefix.
+func writeFramed(t *testing.T, conn net.Conn, msg []byte) {
+	t.Helper()
+	_, err := conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(msg))), msg...))
+	require.NoError(t, err)
+}
+
+// readFramed reads one length-prefixed message.
+func readFramed(t *testing.T, conn net.Conn) []byte {
+	t.Helper()
+	var prefix [2]byte
+	_, err := io.ReadFull(conn, prefix[:])
+	require.NoError(t, err)
+	msg := make([]byte, binary.BigEndian.Uint16(prefix[:]))
+	_, err = io.ReadFull(conn, msg)
+	require.NoError(t, err)
+	return msg
+}
+
+func TestNewTCPTransport(t *testing.T) {
+	codec := &MockDNSCodec{}
+	logger := &testLogger{}
+	addr := "127.0.0.1:5053"
+
+	transport := NewTCPTransport(addr, codec, logger)
+
+	assert.Equal(t, addr, transport.Address())
+	assert.Equal(t, codec, transport.codec)
+	assert.Equal(t, logger, transport.logger)
+	assert.Equal(t, tcpIdleTimeout, transport.idleTimeout)
+	assert.IsType(t, resolver.NopMetrics{}, transport.metrics)
+	assert.False(t, transport.running)
+
+	var _ ServerTransport = transport
+}
+
+func TestTCPTransport_StartStop(t *testing.T) {
+	transport := NewTCPTransport("127.0.0.1:0", &MockDNSCodec{}, &testLogger{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	require.NoError(t, transport.Start(ctx, &MockDNSResponder{}))
+	assert.ErrorContains(t, transport.Start(ctx, &MockDNSResponder{}), "TCP transport already running")
+	addr := transport.listener.Addr().String()
+
+	require.NoError(t, transport.Stop())
+	assert.NoError(t, transport.Stop(), "stopping twice is a no-op")
+	_, err := net.Dial("tcp", addr)
+	assert.Error(t, err, "the listener is closed")
+
+	bound, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = bound.Close() }()
+	err = NewTCPTransport(bound.Addr().String(), &MockDNSCodec{}, &testLogger{}).Start(ctx, &MockDNSResponder{})
+	assert.ErrorContains(t, err, "failed to bind TCP socket")
+}
+
+func TestTCPTransport_QueryHandling(t *testing.T) {
+	codec := &MockDNSCodec{}
+	handler := &MockDNSResponder{}
+
+	first := domain.Question{ID: 1, Name: "example.com.", Type: 1, Class: 1}
+	second := domain.Question{ID: 2, Name: "example.org.", Type: 1, Class: 1}
+	codec.On("DecodeQuery", []byte{0x01}).Return(first, nil)
+	codec.On("DecodeQuery", []byte{0x02}).Return(second, nil)
+	codec.On("EncodeStreamResponse", domain.DNSResponse{ID: 1, Question: first}).Return(make([]byte, 1500), nil)
+	codec.On("EncodeStreamResponse", domain.DNSResponse{ID: 2, Question: second}).Return([]byte{0x02}, nil)
+	handler.On("HandleQuery", mock.Anything, first, mock.AnythingOfType("*net.TCPAddr")).Return(domain.DNSResponse{ID: 1, Question: first}, nil)
+	handler.On("HandleQuery", mock.Anything, second, mock.AnythingOfType("*net.TCPAddr")).Return(domain.DNSResponse{ID: 2, Question: second}, nil)
+
+	conn := startTCP(t, NewTCPTransport("127.0.0.1:0", codec, &testLogger{}), handler)
+
+	// Both queries are pipelined on one connection; answers may come in either order.
+	writeFramed(t, conn, []byte{0x01})
+	writeFramed(t, conn, []byte{0x02})
+	sizes := []int{len(readFramed(t, conn)), len(readFramed(t, conn))}
+	assert.ElementsMatch(t, []int{1500, 1}, sizes, "responses are not limited to a UDP payload")
+
+	codec.AssertExpectations(t)
+	codec.AssertNotCalled(t, "EncodeResponse", mock.Anything)
+	handler.AssertExpectations(t)
+}
+
+func TestTCPTransport_Metrics(t *testing.T) {
+	codec := &MockDNSCodec{}
+	handler := &MockDNSResponder{}
+	metrics := &MockMetrics{}
+
+	served := domain.Question{ID: 1, Name: "example.com.", Type: 1, Class: 1}
+	failing := domain.Question{ID: 2, Name: "fail.example.", Type: 1, Class: 1}
+	unencodable := domain.Question{ID: 3, Name: "big.example.", Type: 1, Class: 1}
+	codec.On("DecodeQuery", []byte{0x01}).Return(served, nil)
+	codec.On("DecodeQuery", []byte{0x02}).Return(failing, nil)
+	codec.On("DecodeQuery", []byte{0x03}).Return(unencodable, nil)
+	codec.On("DecodeQuery", []byte{0xFF}).Return(domain.Question{}, assert.AnError)
+	codec.On("EncodeStreamResponse", domain.DNSResponse{ID: 1, RCode: domain.NXDOMAIN}).Return([]byte{0x01}, nil)
+	codec.On("EncodeStreamResponse", domain.DNSResponse{ID: 3}).Return([]byte{}, assert.AnError)
+	handler.On("HandleQuery", mock.Anything, served, mock.Anything).Return(domain.DNSResponse{ID: 1, RCode: domain.NXDOMAIN}, nil)
+	handler.On("HandleQuery", mock.Anything, failing, mock.Anything).Return(domain.DNSResponse{}, assert.AnError)
+	handler.On("HandleQuery", mock.Anything, unencodable, mock.Anything).Return(domain.DNSResponse{ID: 3}, nil)
+
+	reported := make(chan string, 4)
+	metrics.On("QueryServed", "tcp", served, domain.NXDOMAIN, mock.AnythingOfType("time.Duration")).
+		Run(func(mock.Arguments) { reported <- "served" }).Once()
+	for _, stage := range []string{"decode", "handle", "encode"} {
+		metrics.On("QueryFailed", "tcp", stage).
+			Run(func(mock.Arguments) { reported <- stage }).Once()
+	}
+
+	conn := startTCP(t, NewTCPTransportWithMetrics("127.0.0.1:0", codec, &testLogger{}, metrics), handler)
+
+	// A query that fails does not close the connection.
+	for _, data := range [][]byte{{0xFF}, {0x02}, {0x03}, {0x01}} {
+		writeFramed(t, conn, data)
+		select {
+		case <-reported:
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for metrics")
+		}
+	}
+	assert.Equal(t, []byte{0x01}, readFramed(t, conn))
+	metrics.AssertExpectations(t)
+}
+
+func TestTCPTransport_IdleTimeout(t *testing.T) {
+	transport := NewTCPTransport("127.0.0.1:0", &MockDNSCodec{}, &testLogger{})
+	transport.idleTimeout = 50 * time.Millisecond
+	conn := startTCP(t, transport, &MockDNSResponder{})
+
+	_, err := conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF, "the server closes a connection that sends nothing")
+	assert.Eventually(t, func() bool {
+		transport.mu.Lock()
+		defer transport.mu.Unlock()
+		return len(transport.conns) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestTCPTransport_StopClosesConnections(t *testing.T) {
+	transport := NewTCPTransport("127.0.0.1:0", &MockDNSCodec{}, &testLogger{})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, transport.Start(ctx, &MockDNSResponder{}))
+
+	conn, err := net.Dial("tcp", transport.listener.Addr().String())
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	require.Eventually(t, func() bool {
+		transport.mu.Lock()
+		defer transport.mu.Unlock()
+		return len(transport.conns) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, transport.Stop())
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestTCPTransport_ContextCancellation(t *testing.T) {
+	transport := NewTCPTransport("127.0.0.1:0", &MockDNSCodec{}, &testLogger{})
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, transport.Start(ctx, &MockDNSResponder{}))
+
+	cancel()
+	assert.Eventually(t, func() bool {
+		transport.mu.Lock()
+		defer transport.mu.Unlock()
+		return !transport.running
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestTCPTransport_Tap(t *testing.T) {
+	codec := &MockDNSCodec{}
+	handler := &MockDNSResponder{}
+
+	testQuery := domain.Question{ID: 4242, Name: "example.com.", Type: 1, Class: 1}
+	testResponse := domain.DNSResponse{ID: 4242, RCode: domain.NOERROR, Question: testQuery}
+	queryData := []byte{0x01, 0x02, 0x03}
+	responseData := []byte{0x04, 0x05, 0x06}
+
+	codec.On("DecodeQuery", queryData).Return(testQuery, nil)
+	codec.On("EncodeStreamResponse", testResponse).Return(responseData, nil)
+	handler.On("HandleQuery", mock.Anything, testQuery, mock.Anything).Return(testResponse, nil)
+
+	tap := &recordingTap{messages: make(chan resolver.TapMessage, 2)}
+	transport := NewTCPTransport("127.0.0.1:0", codec, &testLogger{})
+	transport.SetTap(tap)
+	conn := startTCP(t, transport, handler)
+	writeFramed(t, conn, queryData)
+	assert.Equal(t, responseData, readFramed(t, conn))
+
+	var messages []resolver.TapMessage
+	for range 2 {
+		select {
+		case msg := <-tap.messages:
+			messages = append(messages, msg)
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for tapped messages")
+		}
+	}
+
+	query, response := messages[0], messages[1]
+	assert.Equal(t, resolver.TapClientQuery, query.Type)
+	assert.Equal(t, queryData, query.Message)
+	assert.Equal(t, resolver.TapClientResponse, response.Type)
+	assert.Equal(t, responseData, response.Message, "the tapped response has no length prefix")
+	for _, msg := range messages {
+		assert.Equal(t, "tcp", msg.Protocol)
+		assert.Equal(t, conn.LocalAddr().String(), msg.QueryAddr.String())
+		assert.Equal(t, conn.RemoteAddr().String(), msg.ResponseAddr.String())
+	}
+}
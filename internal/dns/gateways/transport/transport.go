@@ -10,6 +10,9 @@ const (
 	// TransportUDP represents standard DNS over UDP (RFC 1035)
 	TransportUDP TransportType = "udp"
 
+	// TransportTCP represents standard DNS over TCP (RFC 1035, RFC 7766)
+	TransportTCP TransportType = "tcp"
+
 	// TransportDoH represents DNS over HTTPS (RFC 8484) - future implementation
 	TransportDoH TransportType = "doh"
 
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"time"
 
 	"github.com/haukened/rr-dns/internal/dns/common/log"
 	"github.com/haukened/rr-dns/internal/dns/gateways/wire"
@@ -15,10 +16,12 @@ import (
 // It handles UDP socket management, packet reception/transmission, and wire format
 // conversion while delegating DNS logic to the service layer.
 type UDPTransport struct {
-	addr   string
-	conn   *net.UDPConn
-	codec  wire.DNSCodec
-	logger log.Logger
+	addr    string
+	conn    *net.UDPConn
+	codec   wire.DNSCodec
+	logger  log.Logger
+	metrics resolver.Metrics
+	tap     resolver.MessageTap
 
 	// Synchronization for graceful shutdown
 	mu      sync.RWMutex
@@ -28,14 +31,28 @@ type UDPTransport struct {
 
 // NewUDPTransport creates a new UDP transport instance.
 func NewUDPTransport(addr string, codec wire.DNSCodec, logger log.Logger) *UDPTransport {
+	return NewUDPTransportWithMetrics(addr, codec, logger, resolver.NopMetrics{})
+}
+
+// NewUDPTransportWithMetrics creates a UDP transport that reports every query
+// it serves or drops to metrics.
+func NewUDPTransportWithMetrics(addr string, codec wire.DNSCodec, logger log.Logger, metrics resolver.Metrics) *UDPTransport {
 	return &UDPTransport{
-		addr:   addr,
-		codec:  codec,
-		logger: logger,
-		stopCh: make(chan struct{}),
+		addr:    addr,
+		codec:   codec,
+		logger:  logger,
+		metrics: metrics,
+		tap:     resolver.NopTap{},
+		stopCh:  make(chan struct{}),
 	}
 }
 
+// SetTap sends a copy of every query received and every response sent to tap.
+// It must be called before Start.
+func (t *UDPTransport) SetTap(tap resolver.MessageTap) {
+	t.tap = tap
+}
+
 // Start begins listening for UDP DNS queries on the configured address.
 // It binds to the UDP socket and starts the packet handling loop.
 func (t *UDPTransport) Start(ctx context.Context, handler resolver.DNSResponder) error {
@@ -108,6 +125,14 @@ func (t *UDPTransport) Address() string {
 	return t.addr
 }
 
+// localAddr returns the address the socket is bound to, or nil before Start.
+func (t *UDPTransport) localAddr() net.Addr {
+	if t.conn == nil {
+		return nil
+	}
+	return t.conn.LocalAddr()
+}
+
 // listenLoop continuously listens for UDP packets and handles them.
 func (t *UDPTransport) listenLoop(ctx context.Context, handler resolver.DNSResponder) {
 	buffer := make([]byte, 512) // Standard DNS UDP packet size limit
@@ -148,6 +173,16 @@ func (t *UDPTransport) listenLoop(ctx context.Context, handler resolver.DNSRespo
 
 // handlePacket processes a single UDP DNS packet.
 func (t *UDPTransport) handlePacket(ctx context.Context, data []byte, clientAddr *net.UDPAddr, handler resolver.DNSResponder) {
+	start := time.Now()
+	t.tap.Tap(resolver.TapMessage{
+		Type:         resolver.TapClientQuery,
+		Protocol:     string(TransportUDP),
+		QueryAddr:    clientAddr,
+		ResponseAddr: t.localAddr(),
+		QueryTime:    start,
+		Message:      data,
+	})
+
 	// Debug log raw incoming data
 	t.logger.Debug(map[string]any{
 		"client": clientAddr.String(),
@@ -163,6 +198,7 @@ func (t *UDPTransport) handlePacket(ctx context.Context, data []byte, clientAddr
 			"error":  err.Error(),
 			"size":   len(data),
 		}, "Failed to decode DNS query")
+		t.metrics.QueryFailed(string(TransportUDP), "decode")
 		return
 	}
 
@@ -181,6 +217,7 @@ func (t *UDPTransport) handlePacket(ctx context.Context, data []byte, clientAddr
 			"query_id": query.ID,
 			"error":    err.Error(),
 		}, "Failed to handle DNS query")
+		t.metrics.QueryFailed(string(TransportUDP), "handle")
 		return
 	}
 
@@ -192,6 +229,7 @@ func (t *UDPTransport) handlePacket(ctx context.Context, data []byte, clientAddr
 			"query_id": query.ID,
 			"error":    err.Error(),
 		}, "Failed to encode DNS response")
+		t.metrics.QueryFailed(string(TransportUDP), "encode")
 		return
 	}
 
@@ -211,8 +249,19 @@ func (t *UDPTransport) handlePacket(ctx context.Context, data []byte, clientAddr
 			"query_id": response.ID,
 			"error":    err.Error(),
 		}, "Failed to send DNS response")
+		t.metrics.QueryFailed(string(TransportUDP), "send")
 		return
 	}
+	t.tap.Tap(resolver.TapMessage{
+		Type:         resolver.TapClientResponse,
+		Protocol:     string(TransportUDP),
+		QueryAddr:    clientAddr,
+		ResponseAddr: t.localAddr(),
+		QueryTime:    start,
+		ResponseTime: time.Now(),
+		Message:      responseData,
+	})
+	t.metrics.QueryServed(string(TransportUDP), query, response.RCode, time.Since(start))
 
 	t.logger.Debug(map[string]any{
 		"client":   clientAddr.String(),
@@ -173,6 +173,10 @@ func (s *StubDNSCodec) EncodeResponse(resp domain.DNSResponse) ([]byte, error) {
 	return []byte{0x04, 0x05, 0x06}, nil
 }
 
+func (s *StubDNSCodec) EncodeStreamResponse(resp domain.DNSResponse) ([]byte, error) {
+	return []byte{0x04, 0x05, 0x06}, nil
+}
+
 func (s *StubDNSCodec) DecodeResponse(_ []byte, _ uint16, _ time.Time) (domain.DNSResponse, error) {
 	return domain.DNSResponse{}, nil
 }
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -38,6 +39,11 @@ func (m *MockDNSCodec) EncodeResponse(resp domain.DNSResponse) ([]byte, error) {
 	return args.Get(0).([]byte), args.Error(1)
 }
 
+func (m *MockDNSCodec) EncodeStreamResponse(resp domain.DNSResponse) ([]byte, error) {
+	args := m.Called(resp)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
 // MockDNSResponder implements resolver.DNSResponder for testing
 type MockDNSResponder struct {
 	mock.Mock
@@ -77,6 +83,23 @@ func (m *MockLogger) Fatal(fields map[string]any, msg string) {
 	m.Called(fields, msg)
 }
 
+// MockMetrics implements resolver.Metrics for testing
+type MockMetrics struct {
+	mock.Mock
+}
+
+func (m *MockMetrics) QueryAnswered(query domain.Question, rcode domain.RCode, source resolver.AnswerSource, duration time.Duration) {
+	m.Called(query, rcode, source, duration)
+}
+
+func (m *MockMetrics) QueryServed(transport string, query domain.Question, rcode domain.RCode, duration time.Duration) {
+	m.Called(transport, query, rcode, duration)
+}
+
+func (m *MockMetrics) QueryFailed(transport string, stage string) {
+	m.Called(transport, stage)
+}
+
 // testLogger provides a no-op logger for tests that don't need to verify logging
 type testLogger struct{}
 
@@ -663,3 +686,107 @@ func TestUDPTransport_ContextCancellationInListenLoop(t *testing.T) {
 	err = transport.Stop()
 	require.NoError(t, err)
 }
+
+func TestUDPTransport_Metrics(t *testing.T) {
+	codec := &MockDNSCodec{}
+	handler := &MockDNSResponder{}
+	metrics := &MockMetrics{}
+
+	testQuery := domain.Question{ID: 4242, Name: "example.com.", Type: 1, Class: 1}
+	testResponse := domain.DNSResponse{ID: 4242, RCode: domain.NXDOMAIN, Question: testQuery}
+	queryData := []byte{0x01, 0x02, 0x03}
+	invalidData := []byte{0xFF, 0xFF, 0xFF}
+	responseData := []byte{0x04, 0x05, 0x06}
+
+	codec.On("DecodeQuery", queryData).Return(testQuery, nil)
+	codec.On("DecodeQuery", invalidData).Return(domain.Question{}, assert.AnError)
+	codec.On("EncodeResponse", testResponse).Return(responseData, nil)
+	handler.On("HandleQuery", mock.Anything, testQuery, mock.Anything).Return(testResponse, nil)
+
+	reported := make(chan string, 2)
+	metrics.On("QueryServed", "udp", testQuery, domain.NXDOMAIN, mock.AnythingOfType("time.Duration")).
+		Run(func(mock.Arguments) { reported <- "served" }).Once()
+	metrics.On("QueryFailed", "udp", "decode").
+		Run(func(mock.Arguments) { reported <- "decode" }).Once()
+
+	transport := NewUDPTransportWithMetrics("127.0.0.1:0", codec, &testLogger{}, metrics)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, transport.Start(ctx, handler))
+	defer func() { require.NoError(t, transport.Stop()) }()
+
+	clientConn, err := net.DialUDP("udp", nil, transport.conn.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, clientConn.Close()) }()
+
+	for _, data := range [][]byte{queryData, invalidData} {
+		_, err = clientConn.Write(data)
+		require.NoError(t, err)
+		select {
+		case <-reported:
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for metrics")
+		}
+	}
+	metrics.AssertExpectations(t)
+}
+
+// recordingTap collects the messages tapped by the transport.
+type recordingTap struct {
+	messages chan resolver.TapMessage
+}
+
+func (r *recordingTap) Tap(msg resolver.TapMessage) {
+	r.messages <- msg
+}
+
+func TestUDPTransport_Tap(t *testing.T) {
+	codec := &MockDNSCodec{}
+	handler := &MockDNSResponder{}
+
+	testQuery := domain.Question{ID: 4242, Name: "example.com.", Type: 1, Class: 1}
+	testResponse := domain.DNSResponse{ID: 4242, RCode: domain.NOERROR, Question: testQuery}
+	queryData := []byte{0x01, 0x02, 0x03}
+	responseData := []byte{0x04, 0x05, 0x06}
+
+	codec.On("DecodeQuery", queryData).Return(testQuery, nil)
+	codec.On("EncodeResponse", testResponse).Return(responseData, nil)
+	handler.On("HandleQuery", mock.Anything, testQuery, mock.Anything).Return(testResponse, nil)
+
+	tap := &recordingTap{messages: make(chan resolver.TapMessage, 2)}
+	transport := NewUDPTransport("127.0.0.1:0", codec, &testLogger{})
+	transport.SetTap(tap)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, transport.Start(ctx, handler))
+	defer func() { require.NoError(t, transport.Stop()) }()
+
+	clientConn, err := net.DialUDP("udp", nil, transport.conn.LocalAddr().(*net.UDPAddr))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, clientConn.Close()) }()
+	_, err = clientConn.Write(queryData)
+	require.NoError(t, err)
+
+	var messages []resolver.TapMessage
+	for range 2 {
+		select {
+		case msg := <-tap.messages:
+			messages = append(messages, msg)
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for tapped messages")
+		}
+	}
+
+	query, response := messages[0], messages[1]
+	assert.Equal(t, resolver.TapClientQuery, query.Type)
+	assert.Equal(t, queryData, query.Message)
+	assert.True(t, query.ResponseTime.IsZero())
+	assert.Equal(t, resolver.TapClientResponse, response.Type)
+	assert.Equal(t, responseData, response.Message)
+	assert.False(t, response.ResponseTime.Before(response.QueryTime))
+	for _, msg := range messages {
+		assert.Equal(t, "udp", msg.Protocol)
+		assert.Equal(t, clientConn.LocalAddr().String(), msg.QueryAddr.String())
+		assert.Equal(t, transport.conn.LocalAddr().String(), msg.ResponseAddr.String())
+	}
+}
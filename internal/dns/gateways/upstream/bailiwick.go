@@ -0,0 +1,152 @@
+package upstream
+
+import (
+	"strings"
+
+	"github.com/haukened/rr-dns/internal/dns/common/utils"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// questionMatches reports whether the question echoed in a response is the one
+// that was asked. Names compare case-insensitively (RFC 4343).
+func questionMatches(asked, echoed domain.Question) bool {
+	return utils.CanonicalDNSName(asked.Name) == utils.CanonicalDNSName(echoed.Name) &&
+		asked.Type == echoed.Type &&
+		asked.Class == echoed.Class
+}
+
+// inZone reports whether name equals zone or sits below it on a label boundary.
+// Both names must already be canonical.
+func inZone(name, zone string) bool {
+	if zone == "" || name == zone {
+		return true
+	}
+	return strings.HasSuffix(name, "."+zone)
+}
+
+// sanitizeResponse drops records that the upstream had no business sending for
+// query, the classic vector for cache poisoning (RFC 5452 §6):
+//
+//   - answers must belong to the chain of names starting at the query name and
+//     following CNAME targets;
+//   - authority records must be owned by the query name, a CNAME target, or
+//     one of their ancestors (the zones that could be authoritative for them);
+//   - NSEC, NSEC3 and RRSIG authority records, which prove that a name or type
+//     does not exist, must sit inside a zone named by another accepted
+//     authority record or by the signer of an answer RRSIG;
+//   - additional records must sit inside the zone of an accepted non-root
+//     authority record or, without one, at or below a chain name. The zone cut
+//     is unknown then, and guessing it from the last labels would admit a
+//     whole public suffix such as co.uk.
+//
+// OPT pseudo-records carry EDNS metadata rather than data and are always kept.
+// It returns the filtered response and the number of records dropped.
+func sanitizeResponse(query domain.Question, resp domain.DNSResponse) (domain.DNSResponse, int) {
+	chain := map[string]bool{utils.CanonicalDNSName(query.Name): true}
+	// CNAMEs may appear in any order, so extend the chain until it stops growing.
+	for grew := true; grew; {
+		grew = false
+		for _, rr := range resp.Answers {
+			if rr.Type != domain.RRTypeCNAME || !chain[utils.CanonicalDNSName(rr.Name)] {
+				continue
+			}
+			if target := utils.CanonicalDNSName(rr.Text); !chain[target] {
+				chain[target] = true
+				grew = true
+			}
+		}
+	}
+
+	dropped := 0
+	keep := func(records []domain.ResourceRecord, ok func(rr domain.ResourceRecord, owner string) bool) []domain.ResourceRecord {
+		var kept []domain.ResourceRecord
+		for _, rr := range records {
+			if rr.Type == domain.RRTypeOPT || ok(rr, utils.CanonicalDNSName(rr.Name)) {
+				kept = append(kept, rr)
+				continue
+			}
+			dropped++
+		}
+		return kept
+	}
+
+	resp.Answers = keep(resp.Answers, func(_ domain.ResourceRecord, owner string) bool {
+		return chain[owner]
+	})
+
+	// Zones that may hold denial proofs: answer signers, then authority owners.
+	var signedZones []string
+	for _, rr := range resp.Answers {
+		if signer, ok := rrsigSigner(rr); ok && inZone(utils.CanonicalDNSName(rr.Name), signer) {
+			signedZones = append(signedZones, signer)
+		}
+	}
+	var zones []string
+	for _, rr := range resp.Authority {
+		owner := utils.CanonicalDNSName(rr.Name)
+		if isDenialRecord(rr.Type) || !coversChain(chain, owner) {
+			continue
+		}
+		signedZones = append(signedZones, owner)
+		// A root SOA or NS covers every name, so it must not widen the additional section.
+		if owner != "" {
+			zones = append(zones, owner)
+		}
+	}
+
+	resp.Authority = keep(resp.Authority, func(rr domain.ResourceRecord, owner string) bool {
+		if !isDenialRecord(rr.Type) {
+			return coversChain(chain, owner)
+		}
+		for _, zone := range signedZones {
+			if inZone(owner, zone) {
+				return true
+			}
+		}
+		return false
+	})
+	if len(zones) == 0 {
+		for name := range chain {
+			zones = append(zones, name)
+		}
+	}
+
+	resp.Additional = keep(resp.Additional, func(_ domain.ResourceRecord, owner string) bool {
+		for _, zone := range zones {
+			if inZone(owner, zone) {
+				return true
+			}
+		}
+		return false
+	})
+	return resp, dropped
+}
+
+// coversChain reports whether owner is a chain name or one of their ancestors,
+// i.e. a zone that could be authoritative for the query.
+func coversChain(chain map[string]bool, owner string) bool {
+	for name := range chain {
+		if inZone(name, owner) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDenialRecord reports whether rrtype belongs to a DNSSEC denial-of-existence
+// proof, whose owner names are not ancestors of the query name.
+func isDenialRecord(rrtype domain.RRType) bool {
+	return rrtype == domain.RRTypeNSEC || rrtype == domain.RRTypeNSEC3 || rrtype == domain.RRTypeRRSIG
+}
+
+// rrsigSigner returns the canonical signer name of an RRSIG record.
+func rrsigSigner(rr domain.ResourceRecord) (string, bool) {
+	if rr.Type != domain.RRTypeRRSIG {
+		return "", false
+	}
+	fields := strings.Fields(rr.Text)
+	if len(fields) < 8 {
+		return "", false
+	}
+	return utils.CanonicalDNSName(fields[7]), true
+}
@@ -0,0 +1,207 @@
+package upstream
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+func testRecord(name string, rrtype domain.RRType, text string) domain.ResourceRecord {
+	return domain.ResourceRecord{Name: name, Type: rrtype, Class: domain.RRClassIN, Text: text}
+}
+
+func recordNames(records []domain.ResourceRecord) []string {
+	names := []string{}
+	for _, rr := range records {
+		names = append(names, rr.Name)
+	}
+	return names
+}
+
+func TestQuestionMatches(t *testing.T) {
+	asked := domain.Question{ID: 1, Name: "www.example.com.", Type: domain.RRTypeA, Class: domain.RRClassIN}
+
+	tests := []struct {
+		name   string
+		echoed domain.Question
+		want   bool
+	}{
+		{name: "identical", echoed: asked, want: true},
+		{name: "case and trailing dot ignored", echoed: domain.Question{Name: "WWW.Example.COM", Type: domain.RRTypeA, Class: domain.RRClassIN}, want: true},
+		{name: "different name", echoed: domain.Question{Name: "evil.example.com", Type: domain.RRTypeA, Class: domain.RRClassIN}},
+		{name: "different type", echoed: domain.Question{Name: "www.example.com", Type: domain.RRTypeAAAA, Class: domain.RRClassIN}},
+		{name: "different class", echoed: domain.Question{Name: "www.example.com", Type: domain.RRTypeA, Class: 3}},
+		{name: "missing question", echoed: domain.Question{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, questionMatches(asked, tt.echoed))
+		})
+	}
+}
+
+func TestInZone(t *testing.T) {
+	assert.True(t, inZone("example.com", "example.com"))
+	assert.True(t, inZone("www.example.com", "example.com"))
+	assert.True(t, inZone("example.com", ""))
+	assert.False(t, inZone("badexample.com", "example.com"))
+	assert.False(t, inZone("example.com", "www.example.com"))
+}
+
+func TestSanitizeResponse(t *testing.T) {
+	query := domain.Question{Name: "www.example.com.", Type: domain.RRTypeA, Class: domain.RRClassIN}
+	opt := testRecord("", domain.RRTypeOPT, "")
+
+	tests := []struct {
+		name           string
+		resp           domain.DNSResponse
+		wantAnswers    []string
+		wantAuthority  []string
+		wantAdditional []string
+		wantDropped    int
+	}{
+		{
+			name: "clean answer kept",
+			resp: domain.DNSResponse{
+				Answers:    []domain.ResourceRecord{testRecord("www.example.com", domain.RRTypeA, "192.0.2.1")},
+				Authority:  []domain.ResourceRecord{testRecord("example.com", domain.RRTypeNS, "ns1.example.com")},
+				Additional: []domain.ResourceRecord{testRecord("ns1.example.com", domain.RRTypeA, "192.0.2.53"), opt},
+			},
+			wantAnswers:    []string{"www.example.com"},
+			wantAuthority:  []string{"example.com"},
+			wantAdditional: []string{"ns1.example.com", ""},
+		},
+		{
+			name: "cname chain followed out of order",
+			resp: domain.DNSResponse{
+				Answers: []domain.ResourceRecord{
+					testRecord("edge.cdn.net", domain.RRTypeA, "192.0.2.7"),
+					testRecord("cdn.example.net", domain.RRTypeCNAME, "edge.cdn.net"),
+					testRecord("www.example.com", domain.RRTypeCNAME, "cdn.example.net."),
+				},
+			},
+			wantAnswers:    []string{"edge.cdn.net", "cdn.example.net", "www.example.com"},
+			wantAuthority:  []string{},
+			wantAdditional: []string{},
+		},
+		{
+			name: "injected answers dropped",
+			resp: domain.DNSResponse{
+				Answers: []domain.ResourceRecord{
+					testRecord("www.example.com", domain.RRTypeA, "192.0.2.1"),
+					testRecord("bank.example", domain.RRTypeA, "203.0.113.66"),
+					testRecord("unrelated.example", domain.RRTypeCNAME, "www.example.com"),
+				},
+			},
+			wantAnswers:    []string{"www.example.com"},
+			wantAuthority:  []string{},
+			wantAdditional: []string{},
+			wantDropped:    2,
+		},
+		{
+			name: "foreign authority and glue dropped",
+			resp: domain.DNSResponse{
+				Answers: []domain.ResourceRecord{testRecord("www.example.com", domain.RRTypeA, "192.0.2.1")},
+				Authority: []domain.ResourceRecord{
+					testRecord("example.com", domain.RRTypeNS, "ns1.example.com"),
+					testRecord("bank.example", domain.RRTypeNS, "ns.attacker.example"),
+				},
+				Additional: []domain.ResourceRecord{
+					testRecord("ns1.example.com", domain.RRTypeA, "192.0.2.53"),
+					testRecord("ns.attacker.example", domain.RRTypeA, "203.0.113.66"),
+				},
+			},
+			wantAnswers:    []string{"www.example.com"},
+			wantAuthority:  []string{"example.com"},
+			wantAdditional: []string{"ns1.example.com"},
+			wantDropped:    2,
+		},
+		{
+			name: "root authority does not admit arbitrary additional records",
+			resp: domain.DNSResponse{
+				Authority: []domain.ResourceRecord{testRecord("", domain.RRTypeSOA, "a.root-servers.net")},
+				Additional: []domain.ResourceRecord{
+					testRecord("www.example.com", domain.RRTypeAAAA, "2001:db8::1"),
+					testRecord("mail.example.com", domain.RRTypeA, "192.0.2.25"),
+					testRecord("bank.example", domain.RRTypeA, "203.0.113.66"),
+				},
+			},
+			wantAnswers:    []string{},
+			wantAuthority:  []string{""},
+			wantAdditional: []string{"www.example.com"},
+			wantDropped:    2,
+		},
+		{
+			name: "nsec denial proof kept inside the soa zone",
+			resp: domain.DNSResponse{
+				Authority: []domain.ResourceRecord{
+					testRecord("example.com", domain.RRTypeSOA, "ns1.example.com"),
+					testRecord("example.com", domain.RRTypeRRSIG, "SOA 13 2 3600 20250201000000 20250101000000 1 example.com AAEC"),
+					testRecord("mail.example.com", domain.RRTypeNSEC, "zzz.example.com A"),
+					testRecord("mail.example.com", domain.RRTypeRRSIG, "NSEC 13 3 3600 20250201000000 20250101000000 1 example.com AAEC"),
+					testRecord("bank.example", domain.RRTypeNSEC, "zzz.bank.example A"),
+				},
+			},
+			wantAnswers:    []string{},
+			wantAuthority:  []string{"example.com", "example.com", "mail.example.com", "mail.example.com"},
+			wantAdditional: []string{},
+			wantDropped:    1,
+		},
+		{
+			name: "nsec3 wildcard proof kept inside the answer signer zone",
+			resp: domain.DNSResponse{
+				Answers: []domain.ResourceRecord{
+					testRecord("www.example.com", domain.RRTypeA, "192.0.2.1"),
+					testRecord("www.example.com", domain.RRTypeRRSIG, "A 13 2 3600 20250201000000 20250101000000 1 example.com AAEC"),
+				},
+				Authority: []domain.ResourceRecord{
+					testRecord("2t7b4g4vsa5smi47k61mv5bv1a22bojr.example.com", domain.RRTypeNSEC3, "1 0 0 - 2T7B4G4VSA5SMI47K61MV5BV1A22BOJS A"),
+					testRecord("2t7b4g4vsa5smi47k61mv5bv1a22bojr.bank.example", domain.RRTypeNSEC3, "1 0 0 - 2T7B4G4VSA5SMI47K61MV5BV1A22BOJS A"),
+				},
+			},
+			wantAnswers:    []string{"www.example.com", "www.example.com"},
+			wantAuthority:  []string{"2t7b4g4vsa5smi47k61mv5bv1a22bojr.example.com"},
+			wantAdditional: []string{},
+			wantDropped:    1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, dropped := sanitizeResponse(query, tt.resp)
+			assert.Equal(t, tt.wantAnswers, recordNames(got.Answers))
+			assert.Equal(t, tt.wantAuthority, recordNames(got.Authority))
+			assert.Equal(t, tt.wantAdditional, recordNames(got.Additional))
+			assert.Equal(t, tt.wantDropped, dropped)
+		})
+	}
+}
+
+func TestSanitizeResponse_NoAuthorityUnderPublicSuffix(t *testing.T) {
+	query := domain.Question{Name: "www.example.co.uk.", Type: domain.RRTypeMX, Class: domain.RRClassIN}
+	resp := domain.DNSResponse{
+		Answers: []domain.ResourceRecord{testRecord("www.example.co.uk", domain.RRTypeMX, "10 mail.www.example.co.uk")},
+		Additional: []domain.ResourceRecord{
+			testRecord("mail.www.example.co.uk", domain.RRTypeA, "192.0.2.25"),
+			testRecord("bank.co.uk", domain.RRTypeA, "203.0.113.66"),
+			testRecord("example.co.uk", domain.RRTypeA, "203.0.113.67"),
+		},
+	}
+
+	got, dropped := sanitizeResponse(query, resp)
+	assert.Equal(t, []string{"www.example.co.uk"}, recordNames(got.Answers))
+	assert.Equal(t, []string{"mail.www.example.co.uk"}, recordNames(got.Additional), "co.uk is not the zone of the query")
+	assert.Equal(t, 2, dropped)
+}
+
+func TestRRSIGSigner(t *testing.T) {
+	signer, ok := rrsigSigner(testRecord("example.com", domain.RRTypeRRSIG, "A 13 2 3600 20250201000000 20250101000000 1 Example.COM. AAEC"))
+	assert.True(t, ok)
+	assert.Equal(t, "example.com", signer)
+
+	_, ok = rrsigSigner(testRecord("example.com", domain.RRTypeA, "192.0.2.1"))
+	assert.False(t, ok)
+	_, ok = rrsigSigner(testRecord("example.com", domain.RRTypeRRSIG, "A 13 2"))
+	assert.False(t, ok)
+}
@@ -0,0 +1,129 @@
+package upstream
+
+import (
+	crand "crypto/rand"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+)
+
+// DNS 0x20 fallback parameters.
+const (
+	// caseMismatchThreshold is the number of consecutive replies that echo the
+	// query name in the wrong case, but pass every other check, before a server
+	// is taken to normalise case and gets plain queries.
+	caseMismatchThreshold = 3
+	// caseBackoff is how long a server first gets plain queries before
+	// randomization is tried again. Each further fallback without an
+	// intervening case-preserving reply doubles the period.
+	caseBackoff = 10 * time.Minute
+	// caseMaxBackoff caps the growth of caseBackoff.
+	caseMaxBackoff = 6 * time.Hour
+	// caseMismatchWait is how long to keep listening for the genuine reply
+	// after a UDP reply with the wrong case, which may be forged.
+	caseMismatchWait = 500 * time.Millisecond
+)
+
+// errCaseMismatch rejects a reply that echoes the query name in a different
+// case: either the server normalises case or the reply is forged.
+var errCaseMismatch = errors.New("response does not preserve query name case")
+
+// caseRandomizer implements DNS 0x20 (draft-vixie-dnsext-dns0x20): the letters
+// of each query name are randomly upper- or lower-cased, and the response must
+// echo the name byte for byte. A reply in the wrong case is rejected, since it
+// may be forged. Only a server that keeps replying in the wrong case is taken
+// to normalise it and gets plain queries for a while, so 0x20 costs little
+// availability and a single forged reply cannot turn it off.
+type caseRandomizer struct {
+	mu      sync.Mutex
+	clock   clock.Clock
+	wait    time.Duration
+	servers map[string]*caseState
+}
+
+// caseState is the 0x20 state of one server.
+type caseState struct {
+	mismatches    int       // consecutive replies in the wrong case
+	fallbacks     int       // consecutive fallbacks, driving the backoff
+	disabledUntil time.Time // plain queries until then
+}
+
+// newCaseRandomizer returns a randomizer with every server enabled.
+func newCaseRandomizer(clk clock.Clock) *caseRandomizer {
+	return &caseRandomizer{clock: clk, wait: caseMismatchWait, servers: make(map[string]*caseState)}
+}
+
+// state returns the state of server; the caller must hold mu.
+func (c *caseRandomizer) state(server string) *caseState {
+	s, ok := c.servers[server]
+	if !ok {
+		s = &caseState{}
+		c.servers[server] = s
+	}
+	return s
+}
+
+// enabled reports whether queries to server should have their case randomized.
+// A nil randomizer means 0x20 is turned off.
+func (c *caseRandomizer) enabled(server string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.clock.Now().Before(c.state(server).disabledUntil)
+}
+
+// mismatch records a reply from server in the wrong case. It returns the
+// backoff when this reply reaches caseMismatchThreshold and randomization is
+// now off for server, and zero otherwise.
+func (c *caseRandomizer) mismatch(server string) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.state(server)
+	s.mismatches++
+	if s.mismatches < caseMismatchThreshold {
+		return 0
+	}
+	backoff := caseBackoff
+	for i := 0; i < s.fallbacks && backoff < caseMaxBackoff; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, caseMaxBackoff)
+	s.mismatches = 0
+	s.fallbacks++
+	s.disabledUntil = c.clock.Now().Add(backoff)
+	return backoff
+}
+
+// matched records a reply from server that preserved the randomized case.
+func (c *caseRandomizer) matched(server string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.state(server)
+	s.mismatches = 0
+	s.fallbacks = 0
+}
+
+// randomizeCase returns name with each ASCII letter's case chosen at random.
+func randomizeCase(name string) string {
+	bits := make([]byte, len(name))
+	_, _ = crand.Read(bits) // never fails on supported platforms
+	out := []byte(name)
+	for i, ch := range out {
+		letter := 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z'
+		if letter && bits[i]&1 == 1 {
+			out[i] ^= 0x20 // flips between upper and lower case
+		}
+	}
+	return string(out)
+}
+
+// sameCase reports whether two names are identical including letter case,
+// ignoring only the trailing root dot.
+func sameCase(a, b string) bool {
+	return strings.TrimSuffix(a, ".") == strings.TrimSuffix(b, ".")
+}
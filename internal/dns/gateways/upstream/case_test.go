@@ -0,0 +1,82 @@
+package upstream
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+)
+
+func TestRandomizeCase(t *testing.T) {
+	name := "www.example-123.com."
+	variants := make(map[string]bool)
+	for range 32 {
+		got := randomizeCase(name)
+		assert.True(t, strings.EqualFold(name, got), "only letter case may change: %q", got)
+		assert.Equal(t, ".-123..", strings.Map(func(r rune) rune {
+			if 'a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' {
+				return -1
+			}
+			return r
+		}, got), "non-letters must be untouched")
+		variants[got] = true
+	}
+	// 14 letters give 16384 spellings; 32 draws landing on one means nothing was randomized
+	assert.Greater(t, len(variants), 1)
+	assert.Equal(t, "", randomizeCase(""))
+}
+
+func TestSameCase(t *testing.T) {
+	assert.True(t, sameCase("WwW.Example.com.", "WwW.Example.com"))
+	assert.False(t, sameCase("WwW.Example.com", "www.example.com"))
+}
+
+func TestCaseRandomizer(t *testing.T) {
+	var off *caseRandomizer
+	assert.False(t, off.enabled("1.1.1.1:53"))
+
+	clk := &clock.MockClock{CurrentTime: time.Date(2099, 1, 1, 0, 0, 0, 0, time.UTC)}
+	c := newCaseRandomizer(clk)
+	assert.True(t, c.enabled("1.1.1.1:53"))
+
+	// A case-preserving reply resets the count, so isolated mismatches never disable 0x20
+	for range caseMismatchThreshold - 1 {
+		assert.Zero(t, c.mismatch("1.1.1.1:53"))
+	}
+	c.matched("1.1.1.1:53")
+	for range caseMismatchThreshold - 1 {
+		assert.Zero(t, c.mismatch("1.1.1.1:53"))
+	}
+	assert.True(t, c.enabled("1.1.1.1:53"))
+
+	assert.Equal(t, caseBackoff, c.mismatch("1.1.1.1:53"))
+	assert.False(t, c.enabled("1.1.1.1:53"))
+	assert.True(t, c.enabled("8.8.8.8:53"))
+
+	// Randomization comes back after the backoff, which doubles on the next fallback
+	clk.Advance(caseBackoff)
+	assert.True(t, c.enabled("1.1.1.1:53"))
+	for range caseMismatchThreshold - 1 {
+		c.mismatch("1.1.1.1:53")
+	}
+	assert.Equal(t, 2*caseBackoff, c.mismatch("1.1.1.1:53"))
+
+	// and is capped
+	for range 10 * caseMismatchThreshold {
+		c.mismatch("1.1.1.1:53")
+	}
+	for range caseMismatchThreshold - 1 {
+		c.mismatch("1.1.1.1:53")
+	}
+	assert.Equal(t, caseMaxBackoff, c.mismatch("1.1.1.1:53"))
+
+	// A case-preserving reply resets the backoff
+	c.matched("1.1.1.1:53")
+	for range caseMismatchThreshold - 1 {
+		c.mismatch("1.1.1.1:53")
+	}
+	assert.Equal(t, caseBackoff, c.mismatch("1.1.1.1:53"))
+}
@@ -0,0 +1,119 @@
+package upstream
+
+import (
+	"context"
+	crand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/haukened/rr-dns/internal/dns/gateways/wire"
+)
+
+const (
+	// NetworkUDP and NetworkTCP are the dial network names used for queries.
+	NetworkUDP = "udp"
+	NetworkTCP = "tcp"
+
+	// maxUDPMessageSize is the largest UDP response read: the EDNS(0) payload
+	// size advertised when DNSSEC is on. Plain queries stay within the classic
+	// 512-byte limit (RFC 1035 §4.2.1). Larger answers arrive with the TC flag
+	// set and are retried over TCP.
+	maxUDPMessageSize = wire.EDNSPayloadSize
+
+	// minSourcePort is the lowest local port chosen for UDP queries; the
+	// privileged range below it is left alone.
+	minSourcePort = 1024
+	// sourcePortAttempts bounds the retries when a random port is already in use.
+	sourcePortAttempts = 3
+)
+
+// randomUint16 returns a cryptographically random 16-bit value.
+func randomUint16() uint16 {
+	var b [2]byte
+	_, _ = crand.Read(b[:]) // never fails on supported platforms
+	return binary.BigEndian.Uint16(b[:])
+}
+
+// RandomQueryID returns an unpredictable DNS message ID, so an off-path
+// attacker has to guess it to forge a response (RFC 5452 §4.3).
+func RandomQueryID() uint16 {
+	return randomUint16()
+}
+
+// DialRandomPort is a DialFunc that binds UDP sockets to a random
+// local port so the source port adds another 16 bits an attacker must guess
+// (RFC 5452 §9.2). If the random ports are taken it falls back to the port the
+// operating system assigns. TCP uses the ordinary ephemeral port.
+func DialRandomPort(ctx context.Context, network, address string) (net.Conn, error) {
+	if network == NetworkUDP {
+		for range sourcePortAttempts {
+			port := minSourcePort + int(randomUint16())%(1<<16-minSourcePort)
+			d := net.Dialer{LocalAddr: &net.UDPAddr{Port: port}}
+			if conn, err := d.DialContext(ctx, network, address); err == nil {
+				return conn, nil
+			}
+		}
+	}
+	return (&net.Dialer{}).DialContext(ctx, network, address)
+}
+
+// Connect dials server over network and gives the connection ctx's deadline,
+// so an exchange on it cannot outlive the query.
+func Connect(ctx context.Context, dial DialFunc, network, server string) (net.Conn, error) {
+	conn, err := dial(ctx, network, server)
+	if err != nil {
+		return nil, fmt.Errorf(errFailedToConnect, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf(errConnDeadline, err)
+		}
+	}
+	return conn, nil
+}
+
+// ExchangeDatagram writes a query as a single datagram and reads one datagram back.
+func ExchangeDatagram(conn net.Conn, query []byte) ([]byte, error) {
+	if _, err := conn.Write(query); err != nil {
+		return nil, fmt.Errorf(errWriteFailed, err)
+	}
+	return readDatagram(conn)
+}
+
+// readDatagram reads one datagram from conn.
+func readDatagram(conn net.Conn) ([]byte, error) {
+	buffer := make([]byte, maxUDPMessageSize)
+	n, err := conn.Read(buffer)
+	if err != nil {
+		return nil, fmt.Errorf(errReadFailed, err)
+	}
+	return buffer[:n], nil
+}
+
+// ExchangeStream writes a query prefixed with its two-byte length and reads a
+// length-prefixed response, as required for DNS over TCP (RFC 1035 §4.2.2).
+func ExchangeStream(conn net.Conn, query []byte) ([]byte, error) {
+	if len(query) > 0xFFFF {
+		return nil, fmt.Errorf(errWriteFailed, fmt.Errorf("message too large: %d bytes", len(query)))
+	}
+	framed := make([]byte, 2+len(query))
+	//gosec:disable G115 -- length checked above
+	binary.BigEndian.PutUint16(framed, uint16(len(query)))
+	copy(framed[2:], query)
+	if _, err := conn.Write(framed); err != nil {
+		return nil, fmt.Errorf(errWriteFailed, err)
+	}
+
+	var prefix [2]byte
+	if _, err := io.ReadFull(conn, prefix[:]); err != nil {
+		return nil, fmt.Errorf(errReadFailed, err)
+	}
+	response := make([]byte, binary.BigEndian.Uint16(prefix[:]))
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return nil, fmt.Errorf(errReadFailed, err)
+	}
+	return response, nil
+}
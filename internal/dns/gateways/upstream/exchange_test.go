@@ -0,0 +1,153 @@
+package upstream
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// serveStream answers a single length-prefixed message on conn with reply,
+// returning the unframed query it received on the channel.
+func serveStream(t *testing.T, conn net.Conn, reply []byte) <-chan []byte {
+	t.Helper()
+	got := make(chan []byte, 1)
+	go func() {
+		defer func() { _ = conn.Close() }()
+		var prefix [2]byte
+		if _, err := io.ReadFull(conn, prefix[:]); err != nil {
+			close(got)
+			return
+		}
+		msg := make([]byte, binary.BigEndian.Uint16(prefix[:]))
+		if _, err := io.ReadFull(conn, msg); err != nil {
+			close(got)
+			return
+		}
+		got <- msg
+		if reply == nil {
+			return
+		}
+		framed := binary.BigEndian.AppendUint16(nil, uint16(len(reply)))
+		_, _ = conn.Write(append(framed, reply...))
+	}()
+	return got
+}
+
+func TestExchangeStream(t *testing.T) {
+	t.Run("length framed round trip", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer func() { _ = client.Close() }()
+		reply := make([]byte, 1200) // larger than a classic UDP payload
+		reply[0], reply[1199] = 0xAB, 0xCD
+		received := serveStream(t, server, reply)
+
+		resp, err := ExchangeStream(client, []byte("query"))
+		require.NoError(t, err)
+		assert.Equal(t, reply, resp)
+		assert.Equal(t, []byte("query"), <-received)
+	})
+
+	t.Run("connection closed before response", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer func() { _ = client.Close() }()
+		serveStream(t, server, nil)
+
+		_, err := ExchangeStream(client, []byte("query"))
+		assert.ErrorContains(t, err, "read failed")
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		conn := &MockConn{}
+		conn.On("Write", mock.Anything).Return(0, errors.New("broken pipe"))
+
+		_, err := ExchangeStream(conn, []byte("query"))
+		assert.ErrorContains(t, err, "write failed")
+		conn.AssertExpectations(t)
+	})
+
+	t.Run("oversized query", func(t *testing.T) {
+		_, err := ExchangeStream(&MockConn{}, make([]byte, 0x10000))
+		assert.ErrorContains(t, err, "message too large")
+	})
+}
+
+func TestExchangeDatagram(t *testing.T) {
+	conn := &MockConn{readData: []byte("response")}
+	conn.On("Write", []byte("query")).Return(5, nil)
+	conn.On("Read", mock.AnythingOfType("[]uint8")).Return(8, nil)
+
+	resp, err := ExchangeDatagram(conn, []byte("query"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("response"), resp)
+	conn.AssertExpectations(t)
+}
+
+func TestDialRandomPort(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = server.Close() }()
+
+	ports := make(map[int]bool)
+	for range 8 {
+		conn, err := DialRandomPort(context.Background(), NetworkUDP, server.LocalAddr().String())
+		require.NoError(t, err)
+		port := conn.LocalAddr().(*net.UDPAddr).Port
+		assert.GreaterOrEqual(t, port, minSourcePort)
+		ports[port] = true
+		_ = conn.Close()
+	}
+	assert.Greater(t, len(ports), 1, "source ports should vary between queries")
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = listener.Close() }()
+	conn, err := DialRandomPort(context.Background(), NetworkTCP, listener.Addr().String())
+	require.NoError(t, err)
+	_ = conn.Close()
+}
+
+func TestConnect(t *testing.T) {
+	t.Run("deadline from context", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer func() { _ = listener.Close() }()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+		defer cancel()
+
+		conn, err := Connect(ctx, DialRandomPort, NetworkTCP, listener.Addr().String())
+		require.NoError(t, err)
+		defer func() { _ = conn.Close() }()
+		// the read gives up at the context's deadline instead of blocking
+		_, err = conn.Read(make([]byte, 1))
+		assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	})
+
+	t.Run("dial error", func(t *testing.T) {
+		dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, errors.New("connection refused")
+		}
+		_, err := Connect(context.Background(), dial, NetworkUDP, "192.0.2.1:53")
+		assert.ErrorContains(t, err, "failed to connect: connection refused")
+	})
+
+	t.Run("deadline error closes the connection", func(t *testing.T) {
+		conn := &MockConn{setDeadlineError: errors.New("closed")}
+		conn.On("Close").Return(nil)
+		dial := func(ctx context.Context, network, address string) (net.Conn, error) { return conn, nil }
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		_, err := Connect(ctx, dial, NetworkUDP, "192.0.2.1:53")
+		assert.ErrorContains(t, err, "failed to set connection deadline")
+		conn.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,244 @@
+package upstream
+
+import (
+	"sync"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/common/log"
+)
+
+// Default circuit breaker and probing parameters.
+const (
+	defaultFailureThreshold = 3
+	defaultBackoff          = 5 * time.Second
+	defaultMaxBackoff       = 2 * time.Minute
+	defaultProbeInterval    = 5 * time.Second
+
+	// rttSmoothing is the weight given to a new RTT sample in the EWMA.
+	rttSmoothing = 0.3
+)
+
+// HealthOptions configures per-server health tracking and circuit breaking.
+// Zero values are replaced with sensible defaults by NewResolver.
+type HealthOptions struct {
+	// FailureThreshold is the number of consecutive failures that sidelines a server.
+	FailureThreshold int
+	// Backoff is how long a server is sidelined the first time its circuit opens.
+	// Each further trip without an intervening success doubles the period.
+	Backoff time.Duration
+	// MaxBackoff caps the exponential growth of Backoff.
+	MaxBackoff time.Duration
+	// ProbeInterval is how often background probes check sidelined servers.
+	ProbeInterval time.Duration
+}
+
+// withDefaults returns a copy of the options with zero values replaced by defaults.
+func (o HealthOptions) withDefaults() HealthOptions {
+	if o.FailureThreshold <= 0 {
+		o.FailureThreshold = defaultFailureThreshold
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = defaultBackoff
+	}
+	if o.MaxBackoff < o.Backoff {
+		o.MaxBackoff = max(defaultMaxBackoff, o.Backoff)
+	}
+	if o.ProbeInterval <= 0 {
+		o.ProbeInterval = defaultProbeInterval
+	}
+	return o
+}
+
+// ServerHealth is a point-in-time snapshot of one upstream server's health,
+// suitable for monitoring and admin endpoints.
+type ServerHealth struct {
+	Server              string        `json:"server"`
+	Healthy             bool          `json:"healthy"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+	RTT                 time.Duration `json:"rtt"`
+	Queries             uint64        `json:"queries"`
+	Failures            uint64        `json:"failures"`
+	LastError           string        `json:"last_error,omitempty"`
+	SidelinedUntil      time.Time     `json:"sidelined_until,omitempty"`
+}
+
+// serverHealth is the mutable health state for a single server.
+type serverHealth struct {
+	consecutiveFailures int
+	rtt                 time.Duration
+	queries             uint64
+	failures            uint64
+	lastError           string
+	// open is true while the circuit breaker has the server sidelined.
+	open bool
+	// trips counts consecutive circuit openings, driving exponential backoff.
+	trips          int
+	sidelinedUntil time.Time
+}
+
+// healthTracker records query outcomes per server and implements a simple
+// circuit breaker: after FailureThreshold consecutive failures a server is
+// sidelined until its backoff expires, after which it is eligible for a trial
+// query (half-open). A success closes the circuit; a failure reopens it with a
+// doubled backoff.
+type healthTracker struct {
+	mu      sync.Mutex
+	opts    HealthOptions
+	clock   clock.Clock
+	logger  log.Logger
+	order   []string
+	servers map[string]*serverHealth
+}
+
+// newHealthTracker creates a tracker for the given servers in config order.
+func newHealthTracker(servers []string, opts HealthOptions, clk clock.Clock, logger log.Logger) *healthTracker {
+	h := &healthTracker{
+		opts:    opts.withDefaults(),
+		clock:   clk,
+		logger:  logger,
+		order:   append([]string(nil), servers...),
+		servers: make(map[string]*serverHealth, len(servers)),
+	}
+	for _, s := range servers {
+		h.servers[s] = &serverHealth{}
+	}
+	return h
+}
+
+// available reports whether a server may receive queries: its circuit is
+// closed, or its backoff has elapsed and it is due a trial query.
+func (h *healthTracker) available(server string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.servers[server]
+	if !ok {
+		return true
+	}
+	return !s.open || !h.clock.Now().Before(s.sidelinedUntil)
+}
+
+// filter returns the subset of servers that are currently available, preserving order.
+// If every server is sidelined the full list is returned, since trying a
+// suspect server beats failing the query outright.
+func (h *healthTracker) filter(servers []string) []string {
+	out := make([]string, 0, len(servers))
+	for _, s := range servers {
+		if h.available(s) {
+			out = append(out, s)
+		}
+	}
+	if len(out) == 0 {
+		return servers
+	}
+	return out
+}
+
+// recordSuccess notes a successful exchange and its round-trip time, closing the circuit if open.
+func (h *healthTracker) recordSuccess(server string, rtt time.Duration) {
+	h.mu.Lock()
+	s, ok := h.servers[server]
+	if !ok {
+		h.mu.Unlock()
+		return
+	}
+	s.queries++
+	s.consecutiveFailures = 0
+	if s.rtt == 0 {
+		s.rtt = rtt
+	} else {
+		s.rtt = time.Duration(rttSmoothing*float64(rtt) + (1-rttSmoothing)*float64(s.rtt))
+	}
+	recovered := s.open
+	s.open = false
+	s.trips = 0
+	s.sidelinedUntil = time.Time{}
+	h.mu.Unlock()
+
+	if recovered {
+		h.logger.Info(map[string]any{"server": server, "rtt": rtt}, "Upstream server recovered")
+	}
+}
+
+// recordFailure notes a failed exchange, opening (or reopening) the circuit
+// once the consecutive failure threshold is reached.
+func (h *healthTracker) recordFailure(server string, err error) {
+	h.mu.Lock()
+	s, ok := h.servers[server]
+	if !ok {
+		h.mu.Unlock()
+		return
+	}
+	s.queries++
+	s.failures++
+	s.consecutiveFailures++
+	if err != nil {
+		s.lastError = err.Error()
+	}
+	if s.consecutiveFailures < h.opts.FailureThreshold {
+		h.mu.Unlock()
+		return
+	}
+	backoff := h.opts.Backoff << min(s.trips, 16)
+	if backoff > h.opts.MaxBackoff || backoff <= 0 {
+		backoff = h.opts.MaxBackoff
+	}
+	s.trips++
+	s.open = true
+	s.sidelinedUntil = h.clock.Now().Add(backoff)
+	failures := s.consecutiveFailures
+	h.mu.Unlock()
+
+	h.logger.Warn(map[string]any{
+		"server":   server,
+		"failures": failures,
+		"backoff":  backoff,
+		"error":    err,
+	}, "Upstream server sidelined")
+}
+
+// rtt returns the smoothed round-trip time of a server, or zero if it has never answered.
+func (h *healthTracker) rtt(server string) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.servers[server]; ok {
+		return s.rtt
+	}
+	return 0
+}
+
+// due returns the sidelined servers whose backoff has expired and should be probed.
+func (h *healthTracker) due() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := h.clock.Now()
+	var out []string
+	for _, server := range h.order {
+		s := h.servers[server]
+		if s.open && !now.Before(s.sidelinedUntil) {
+			out = append(out, server)
+		}
+	}
+	return out
+}
+
+// snapshot returns the health of every server in config order.
+func (h *healthTracker) snapshot() []ServerHealth {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]ServerHealth, 0, len(h.order))
+	for _, server := range h.order {
+		s := h.servers[server]
+		out = append(out, ServerHealth{
+			Server:              server,
+			Healthy:             !s.open,
+			ConsecutiveFailures: s.consecutiveFailures,
+			RTT:                 s.rtt,
+			Queries:             s.queries,
+			Failures:            s.failures,
+			LastError:           s.lastError,
+			SidelinedUntil:      s.sidelinedUntil,
+		})
+	}
+	return out
+}
@@ -0,0 +1,125 @@
+package upstream
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/common/log"
+)
+
+func newTestTracker(servers ...string) (*healthTracker, *clock.MockClock) {
+	clk := &clock.MockClock{CurrentTime: createTimeFixture()}
+	h := newHealthTracker(servers, HealthOptions{
+		FailureThreshold: 2,
+		Backoff:          10 * time.Second,
+		MaxBackoff:       30 * time.Second,
+	}, clk, log.NewNoopLogger())
+	return h, clk
+}
+
+func TestHealthOptions_withDefaults(t *testing.T) {
+	tests := []struct {
+		name string
+		in   HealthOptions
+		want HealthOptions
+	}{
+		{
+			name: "zero values",
+			in:   HealthOptions{},
+			want: HealthOptions{
+				FailureThreshold: defaultFailureThreshold,
+				Backoff:          defaultBackoff,
+				MaxBackoff:       defaultMaxBackoff,
+				ProbeInterval:    defaultProbeInterval,
+			},
+		},
+		{
+			name: "max backoff raised to backoff",
+			in:   HealthOptions{FailureThreshold: 1, Backoff: 10 * time.Minute, ProbeInterval: time.Second},
+			want: HealthOptions{FailureThreshold: 1, Backoff: 10 * time.Minute, MaxBackoff: 10 * time.Minute, ProbeInterval: time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.in.withDefaults())
+		})
+	}
+}
+
+func TestHealthTracker_CircuitBreaker(t *testing.T) {
+	h, clk := newTestTracker("a:53", "b:53")
+	failure := errors.New("timeout")
+
+	// Below threshold the server stays in rotation
+	h.recordFailure("a:53", failure)
+	assert.True(t, h.available("a:53"))
+
+	// Reaching the threshold opens the circuit
+	h.recordFailure("a:53", failure)
+	assert.False(t, h.available("a:53"))
+	assert.Equal(t, []string{"b:53"}, h.filter([]string{"a:53", "b:53"}))
+	assert.Empty(t, h.due())
+
+	// Once the backoff expires the server is due a probe / trial query
+	clk.Advance(10 * time.Second)
+	assert.True(t, h.available("a:53"))
+	assert.Equal(t, []string{"a:53"}, h.due())
+
+	// A failed trial reopens the circuit with doubled backoff
+	h.recordFailure("a:53", failure)
+	assert.False(t, h.available("a:53"))
+	clk.Advance(19 * time.Second)
+	assert.False(t, h.available("a:53"))
+	clk.Advance(time.Second)
+	assert.True(t, h.available("a:53"))
+
+	// Backoff is capped at MaxBackoff
+	h.recordFailure("a:53", failure)
+	h.recordFailure("a:53", failure)
+	snap := h.snapshot()
+	assert.Equal(t, clk.Now().Add(30*time.Second), snap[0].SidelinedUntil)
+
+	// A success closes the circuit and resets backoff
+	h.recordSuccess("a:53", 20*time.Millisecond)
+	assert.True(t, h.available("a:53"))
+	snap = h.snapshot()
+	assert.True(t, snap[0].Healthy)
+	assert.Zero(t, snap[0].ConsecutiveFailures)
+	assert.True(t, snap[0].SidelinedUntil.IsZero())
+}
+
+func TestHealthTracker_FilterAllSidelined(t *testing.T) {
+	h, _ := newTestTracker("a:53", "b:53")
+	for _, s := range []string{"a:53", "b:53"} {
+		h.recordFailure(s, nil)
+		h.recordFailure(s, nil)
+	}
+	servers := []string{"a:53", "b:53"}
+	assert.Equal(t, servers, h.filter(servers), "all sidelined servers should still be tried")
+}
+
+func TestHealthTracker_RTTAndSnapshot(t *testing.T) {
+	h, _ := newTestTracker("a:53", "b:53")
+
+	h.recordSuccess("a:53", 100*time.Millisecond)
+	h.recordSuccess("a:53", 200*time.Millisecond)
+	h.recordFailure("b:53", errors.New("refused"))
+	h.recordSuccess("unknown:53", time.Second) // ignored
+	h.recordFailure("unknown:53", nil)         // ignored
+
+	snap := h.snapshot()
+	assert.Len(t, snap, 2)
+	assert.Equal(t, "a:53", snap[0].Server)
+	assert.Equal(t, 130*time.Millisecond, snap[0].RTT, "EWMA should weight the newest sample by 0.3")
+	assert.Equal(t, uint64(2), snap[0].Queries)
+	assert.Equal(t, "b:53", snap[1].Server)
+	assert.True(t, snap[1].Healthy)
+	assert.Equal(t, 1, snap[1].ConsecutiveFailures)
+	assert.Equal(t, uint64(1), snap[1].Failures)
+	assert.Equal(t, "refused", snap[1].LastError)
+	assert.True(t, h.available("unknown:53"))
+}
@@ -2,12 +2,17 @@ package upstream
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"math/rand/v2"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/common/log"
 	"github.com/haukened/rr-dns/internal/dns/domain"
 	"github.com/haukened/rr-dns/internal/dns/gateways/wire"
 	"github.com/haukened/rr-dns/internal/dns/services/resolver"
@@ -25,17 +30,34 @@ const (
 	errEncodeFailed      = "encode failed: %w"
 	errWriteFailed       = "write failed: %w"
 	errReadFailed        = "read failed: %w"
+	errTCPFallback       = "tcp fallback failed: %w"
+	errProbeInvalid      = "invalid probe response"
+	errUnknownStrategy   = "unknown selection strategy %q"
+	errUnknownNetwork    = "unsupported upstream network %q"
+	errQuestionMismatch  = "response question %q type %d class %d does not match query"
+	errServerRCode       = "server answered %s"
 )
 
 // Resolver implements upstream DNS resolution by forwarding queries to external DNS servers.
 // It handles the low-level networking concerns of DNS over UDP while maintaining clean
 // separation from the service layer business logic.
 type Resolver struct {
-	servers  []string      // List of upstream DNS servers (e.g., "1.1.1.1:53")
-	timeout  time.Duration // Default timeout for DNS queries
-	codec    wire.DNSCodec // Codec for encoding/decoding DNS messages
-	parallel bool          // Whether to resolve queries in parallel
-	dial     DialFunc      // Dial function to create network connections
+	servers  []string            // List of upstream DNS servers (e.g., "1.1.1.1:53")
+	timeout  time.Duration       // Default timeout for DNS queries
+	codec    wire.DNSCodec       // Codec for encoding/decoding DNS messages
+	network  string              // Transport for queries: "udp" (with TCP fallback) or "tcp"
+	parallel bool                // Whether to resolve queries in parallel
+	race     int                 // Maximum number of servers raced in parallel mode (0 = all)
+	selector selector            // Orders servers for each query according to the strategy
+	dial     DialFunc            // Dial function to create network connections
+	health   *healthTracker      // Per-server health and circuit breaker state
+	clock    clock.Clock         // Time source for RTT measurement and backoff
+	queryID  func() uint16       // Generates the message ID of each upstream query
+	caseRand *caseRandomizer     // DNS 0x20 state; nil when case randomization is off
+	dnssec   bool                // Whether queries carry EDNS(0) with the DO bit
+	tracer   resolver.Tracer     // Records a span around each server attempt
+	tap      resolver.MessageTap // Receives copies of the queries sent and responses received
+	logger   log.Logger
 }
 
 // DialFunc defines a function type for establishing a network connection.
@@ -46,20 +68,54 @@ type DialFunc func(ctx context.Context, network, address string) (net.Conn, erro
 // Options defines configuration parameters for the upstream DNS resolver.
 // It includes the list of DNS servers to query, request timeout duration,
 // DNS codec for encoding/decoding messages, whether to perform parallel queries,
-// and a custom dial function for network connections.
+// the server selection strategy, health checking parameters, and a custom dial
+// function for network connections.
 type Options struct {
 	// required parameters
 	Servers  []string
 	Timeout  time.Duration
 	Parallel bool
+	Health   HealthOptions
+	// Network is the transport used for queries: "udp" (the default) retries
+	// truncated answers over TCP, "tcp" sends every query over TCP.
+	Network string
+	// Strategy orders servers for each query; empty means StrategyStrict.
+	Strategy Strategy
+	// RaceCount limits parallel mode to the first N servers chosen by the strategy; 0 races all.
+	RaceCount int
+	// Weights assigns relative weights for StrategyWeighted; unlisted servers weigh 1.
+	Weights map[string]int
+	// Exploration is the probability that StrategyFastest tries a server other
+	// than the fastest first; zero uses the default, negative disables it.
+	Exploration float64
+	// CaseRandomization enables DNS 0x20: query names are sent with random
+	// letter case and responses must echo it exactly. Servers that do not
+	// preserve case automatically get plain queries instead.
+	CaseRandomization bool
+	// DNSSEC adds an EDNS(0) OPT record with the DO bit to every query, so
+	// servers include RRSIG, NSEC and NSEC3 records. Resolve still returns only
+	// the answer section; use Exchange to get the whole response for validation.
+	DNSSEC bool
+	// Tracer records a client span around each query sent to a server.
+	// Defaults to resolver.NopTracer.
+	Tracer resolver.Tracer
+	// Tap receives a copy of every query sent to a server and every response
+	// received, but not of health probes. Defaults to resolver.NopTap.
+	Tap resolver.MessageTap
 	// options to inject for testing purposes
-	Codec wire.DNSCodec
-	Dial  DialFunc
+	Codec  wire.DNSCodec
+	Dial   DialFunc
+	Clock  clock.Clock
+	Logger log.Logger
+	Rand   *rand.Rand
+	// QueryID generates upstream message IDs; defaults to cryptographically random IDs.
+	QueryID func() uint16
 }
 
 // NewResolver creates a new upstream resolver with the specified options.
 // Returns an error if the server list is empty or the codec is not provided.
 // Sets default timeout to 5 seconds and default dial function if not provided.
+// The default dial function sends each UDP query from a random source port.
 func NewResolver(opts Options) (*Resolver, error) {
 	if len(opts.Servers) == 0 {
 		return nil, errors.New(errNoServersProvided)
@@ -70,15 +126,57 @@ func NewResolver(opts Options) (*Resolver, error) {
 	if opts.Codec == nil {
 		return nil, errors.New(errCodecRequired)
 	}
+	switch opts.Network {
+	case "":
+		opts.Network = NetworkUDP
+	case NetworkUDP, NetworkTCP:
+	default:
+		return nil, fmt.Errorf(errUnknownNetwork, opts.Network)
+	}
 	if opts.Dial == nil {
-		opts.Dial = (&net.Dialer{}).DialContext
+		opts.Dial = DialRandomPort
+	}
+	if opts.Clock == nil {
+		opts.Clock = &clock.RealClock{}
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.NewNoopLogger()
+	}
+	if opts.QueryID == nil {
+		opts.QueryID = RandomQueryID
+	}
+	if opts.Tracer == nil {
+		opts.Tracer = resolver.NopTracer{}
+	}
+	if opts.Tap == nil {
+		opts.Tap = resolver.NopTap{}
+	}
+	health := newHealthTracker(opts.Servers, opts.Health, opts.Clock, opts.Logger)
+	sel, err := newSelector(opts, health.rtt)
+	if err != nil {
+		return nil, err
+	}
+	var caseRand *caseRandomizer
+	if opts.CaseRandomization {
+		caseRand = newCaseRandomizer(opts.Clock)
 	}
 	return &Resolver{
 		servers:  opts.Servers,
 		timeout:  opts.Timeout,
 		codec:    opts.Codec,
+		network:  opts.Network,
 		parallel: opts.Parallel,
+		race:     max(opts.RaceCount, 0),
+		selector: sel,
 		dial:     opts.Dial,
+		health:   health,
+		clock:    opts.Clock,
+		queryID:  opts.QueryID,
+		caseRand: caseRand,
+		dnssec:   opts.DNSSEC,
+		tracer:   opts.Tracer,
+		tap:      opts.Tap,
+		logger:   opts.Logger,
 	}, nil
 }
 
@@ -99,10 +197,18 @@ func (r *Resolver) setTimeout(d time.Duration) {
 	}
 }
 
-// Resolve forwards a DNS query to upstream servers and returns the response.
+// Resolve forwards a DNS query to upstream servers and returns the sanitized
+// response, as Exchange does; it is the resolver.UpstreamClient method.
+func (r *Resolver) Resolve(ctx context.Context, query domain.Question, now time.Time) (domain.DNSResponse, error) {
+	return r.Exchange(ctx, query, now)
+}
+
+// Exchange forwards a DNS query to upstream servers and returns the whole
+// sanitized response: RCODE, authority and additional sections included. A
+// DNSSEC validator needs those to check denial-of-existence proofs.
 // It tries either parallel or serial resolution depending on the Resolver's parallel flag.
 // The method respects the deadline set in the context or applies the default timeout.
-func (r *Resolver) Resolve(ctx context.Context, query domain.Question, now time.Time) ([]domain.ResourceRecord, error) {
+func (r *Resolver) Exchange(ctx context.Context, query domain.Question, now time.Time) (domain.DNSResponse, error) {
 	ctx, cancel := r.ensureContextDeadline(ctx)
 	if cancel != nil {
 		defer cancel()
@@ -114,24 +220,42 @@ func (r *Resolver) Resolve(ctx context.Context, query domain.Question, now time.
 	return r.resolveSerialWithContext(ctx, query, now)
 }
 
-// resolveSerialWithContext attempts to query each server in order until one responds successfully.
-func (r *Resolver) resolveSerialWithContext(ctx context.Context, query domain.Question, now time.Time) ([]domain.ResourceRecord, error) {
+// Health returns a snapshot of every upstream server's health in configuration order.
+func (r *Resolver) Health() []ServerHealth {
+	return r.health.snapshot()
+}
+
+// candidates returns the healthy servers in the order chosen by the selection strategy.
+// Servers sidelined by the circuit breaker are dropped unless every server is sidelined.
+func (r *Resolver) candidates() []string {
+	return r.selector.order(r.health.filter(r.servers))
+}
+
+// resolveSerialWithContext attempts to query each candidate server in turn until one responds successfully.
+func (r *Resolver) resolveSerialWithContext(ctx context.Context, query domain.Question, now time.Time) (domain.DNSResponse, error) {
+	servers := r.candidates()
 	var lastErr error
-	for _, server := range r.servers {
-		answers, err := r.queryServerWithContext(ctx, server, query, now)
+	for _, server := range servers {
+		response, err := r.attempt(ctx, server, query, now)
 		if err == nil {
-			return answers, nil
+			return response, nil
 		}
 		lastErr = err
 	}
-	return nil, fmt.Errorf(errAllServersFailed+": %w", len(r.servers), lastErr)
+	return domain.DNSResponse{}, fmt.Errorf(errAllServersFailed+": %w", len(servers), lastErr)
 }
 
 // resolveWithContext forwards a DNS query using parallel server attempts for better performance.
-func (r *Resolver) resolveWithContext(ctx context.Context, query domain.Question, now time.Time) ([]domain.ResourceRecord, error) {
+// Only the first RaceCount candidates are raced when a limit is configured.
+func (r *Resolver) resolveWithContext(ctx context.Context, query domain.Question, now time.Time) (domain.DNSResponse, error) {
+	servers := r.candidates()
+	if r.race > 0 && len(servers) > r.race {
+		servers = servers[:r.race]
+	}
+
 	// Channel to receive the first successful response
-	responseChan := make(chan []domain.ResourceRecord, 1)
-	errorChan := make(chan error, len(r.servers))
+	responseChan := make(chan domain.DNSResponse, 1)
+	errorChan := make(chan error, len(servers))
 
 	// Create a child context so we can proactively cancel outstanding goroutines
 	pctx, pcancel := context.WithCancel(ctx)
@@ -140,11 +264,11 @@ func (r *Resolver) resolveWithContext(ctx context.Context, query domain.Question
 	var wg sync.WaitGroup
 
 	// Launch goroutines for each server
-	for _, server := range r.servers {
+	for _, server := range servers {
 		wg.Add(1)
 		go func(srv string) {
 			defer wg.Done()
-			response, err := r.queryServerWithContext(pctx, srv, query, now)
+			response, err := r.attempt(pctx, srv, query, now)
 			if err != nil {
 				// Avoid blocking if the main goroutine already returned
 				select {
@@ -167,7 +291,7 @@ func (r *Resolver) resolveWithContext(ctx context.Context, query domain.Question
 
 	// Wait for first success or all failures
 	var errors []error
-	for i := 0; i < len(r.servers); i++ {
+	for i := 0; i < len(servers); i++ {
 		select {
 		case response := <-responseChan:
 			// Cancel remaining work; do not wait synchronously to keep fast path
@@ -179,7 +303,7 @@ func (r *Resolver) resolveWithContext(ctx context.Context, query domain.Question
 			// Ensure all goroutines observe cancellation and close their connections
 			pcancel()
 			wg.Wait()
-			return nil, fmt.Errorf(errQueryTimeout, r.timeout)
+			return domain.DNSResponse{}, fmt.Errorf(errQueryTimeout, r.timeout)
 		}
 	}
 
@@ -187,75 +311,273 @@ func (r *Resolver) resolveWithContext(ctx context.Context, query domain.Question
 	if ctx.Err() != nil {
 		pcancel()
 		wg.Wait()
-		return nil, fmt.Errorf(errQueryTimeout, r.timeout)
+		return domain.DNSResponse{}, fmt.Errorf(errQueryTimeout, r.timeout)
 	}
 
 	// All servers failed (not due to context deadline)
-	return nil, fmt.Errorf(errAllServersFailed+": %v", len(r.servers), errors)
+	return domain.DNSResponse{}, fmt.Errorf(errAllServersFailed+": %v", len(servers), errors)
+}
+
+// attempt queries a single server within a trace span and records the outcome
+// in its health state; a server that answers is reported to the resolver for
+// the query log. An answer of SERVFAIL, REFUSED or FORMERR is a failed attempt,
+// so the next server is tried and a server that keeps refusing is sidelined.
+// Cancellation by the caller (e.g. a parallel race already won) is not held
+// against the server.
+func (r *Resolver) attempt(ctx context.Context, server string, query domain.Question, now time.Time) (domain.DNSResponse, error) {
+	ctx, span := r.tracer.Start(ctx, resolver.SpanUpstreamAttempt, resolver.SpanKindClient)
+	defer span.End()
+	span.SetAttribute(resolver.AttrServer, server)
+	span.SetAttribute(resolver.AttrQuestionName, query.Name)
+	span.SetAttribute(resolver.AttrQuestionType, query.Type.String())
+
+	start := r.clock.Now()
+	response, err := r.queryServerWithContext(ctx, server, query, now)
+	if err == nil && serverFailure(response.RCode) {
+		span.SetAttribute(resolver.AttrResponseCode, response.RCode.String())
+		err = fmt.Errorf(errServerRCode, response.RCode)
+		response = domain.DNSResponse{}
+	}
+	switch {
+	case err == nil:
+		r.health.recordSuccess(server, r.clock.Now().Sub(start))
+		resolver.ReportUpstreamServer(ctx, server)
+		span.SetAttribute(resolver.AttrResponseCode, response.RCode.String())
+		span.SetAttribute(resolver.AttrAnswerCount, len(response.Answers))
+	case errors.Is(ctx.Err(), context.Canceled):
+		// caller gave up; says nothing about the server
+		span.RecordError(err)
+	default:
+		r.health.recordFailure(server, err)
+		span.RecordError(err)
+	}
+	return response, err
+}
+
+// serverFailure reports whether rcode means the server could not answer,
+// rather than an answer about the name: another server may well succeed.
+func serverFailure(rcode domain.RCode) bool {
+	return rcode == domain.SERVFAIL || rcode == domain.REFUSED || rcode == domain.FORMERR
+}
+
+// StartHealthChecks launches a background loop that probes sidelined servers
+// once their backoff expires, bringing them back into rotation when they answer.
+// The loop waits ProbeInterval on the resolver's clock between rounds and exits
+// when ctx is cancelled.
+func (r *Resolver) StartHealthChecks(ctx context.Context) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-r.clock.After(r.health.opts.ProbeInterval):
+				r.probeDue(ctx)
+			}
+		}
+	}()
+}
+
+// probeDue sends a probe to every sidelined server whose backoff has expired.
+// Any well-formed reply counts as alive; the content of the answer is irrelevant.
+func (r *Resolver) probeDue(ctx context.Context) {
+	for _, server := range r.health.due() {
+		pctx, cancel := context.WithTimeout(ctx, r.timeout)
+		start := r.clock.Now()
+		err := r.probe(pctx, server)
+		cancel()
+		if err != nil {
+			r.health.recordFailure(server, err)
+			continue
+		}
+		r.health.recordSuccess(server, r.clock.Now().Sub(start))
+	}
+}
+
+// probe asks server for the root NS RRset and checks only the reply header.
+func (r *Resolver) probe(ctx context.Context, server string) error {
+	//gosec:disable G404 -- probe IDs only need to be distinct, not unpredictable
+	q := domain.Question{ID: uint16(rand.N(1 << 16)), Name: ".", Type: domain.RRTypeNS, Class: domain.RRClassIN}
+	_, err := r.exchange(ctx, r.network, server, q, resolver.NopTap{}, func(data []byte) (domain.DNSResponse, error) {
+		if len(data) < 12 || binary.BigEndian.Uint16(data[0:2]) != q.ID || data[2]&0x80 == 0 {
+			return domain.DNSResponse{}, errors.New(errProbeInvalid)
+		}
+		return domain.DNSResponse{ID: q.ID}, nil
+	})
+	return err
 }
 
 // queryServerWithContext performs DNS query with context cancellation support.
-func (r *Resolver) queryServerWithContext(ctx context.Context, server string, query domain.Question, now time.Time) ([]domain.ResourceRecord, error) {
-	// Create UDP connection
-	conn, err := r.dial(ctx, "udp", server)
+// Queries are sent over the configured network; over UDP, if the server sets the
+// TC flag the same query is retried against the same server over TCP (RFC 7766 §5).
+//
+// Each query carries a fresh random ID rather than the client's, the response
+// must echo the question that was asked, and out-of-bailiwick records are
+// stripped before the answers are handed back for caching (RFC 5452). With
+// case randomization on, the echoed name must also match letter for letter: a
+// reply in the wrong case is rejected and, over UDP, the genuine reply is
+// awaited a little longer. A server whose replies keep failing only that check
+// gets plain queries for a while, starting with this one.
+func (r *Resolver) queryServerWithContext(ctx context.Context, server string, query domain.Question, now time.Time) (domain.DNSResponse, error) {
+	upstreamQuery := query
+	upstreamQuery.ID = r.queryID()
+	randomized := r.caseRand.enabled(server)
+	if randomized {
+		upstreamQuery.Name = randomizeCase(query.Name)
+	}
+	var mismatched atomic.Bool
+	decode := func(data []byte) (domain.DNSResponse, error) {
+		response, err := r.codec.DecodeResponse(data, upstreamQuery.ID, now)
+		if err == nil && randomized && questionMatches(query, response.Question) &&
+			!sameCase(upstreamQuery.Name, response.Question.Name) {
+			mismatched.Store(true)
+			return domain.DNSResponse{}, errCaseMismatch
+		}
+		return response, err
+	}
+	response, err := r.exchange(ctx, r.network, server, upstreamQuery, r.tap, decode)
+	if err == nil && response.Truncated && r.network == NetworkUDP {
+		response, err = r.exchange(ctx, NetworkTCP, server, upstreamQuery, r.tap, decode)
+		if err != nil {
+			err = fmt.Errorf(errTCPFallback, err)
+		}
+	}
+	if err != nil {
+		if mismatched.Load() && !errors.Is(ctx.Err(), context.Canceled) {
+			return r.caseMismatch(ctx, server, query, now, err)
+		}
+		return domain.DNSResponse{}, err
+	}
+	if !questionMatches(query, response.Question) {
+		q := response.Question
+		return domain.DNSResponse{}, fmt.Errorf(errQuestionMismatch, q.Name, q.Type, q.Class)
+	}
+	if randomized {
+		r.caseRand.matched(server)
+		if mismatched.Load() {
+			r.logger.Warn(map[string]any{
+				"server": server,
+				"query":  query.Name,
+			}, "Ignored upstream reply with altered query case, possibly spoofed")
+		}
+	}
+	response, dropped := sanitizeResponse(query, response)
+	if dropped > 0 {
+		r.logger.Debug(map[string]any{
+			"server":  server,
+			"query":   query.Name,
+			"dropped": dropped,
+		}, "Dropped out-of-bailiwick records from upstream response")
+	}
+	return response, nil
+}
+
+// caseMismatch fails a query whose only replies echoed the name in the wrong
+// case. Once a server has done so caseMismatchThreshold times in a row, it is
+// taken to normalise case: randomization is turned off for it for a while and
+// the query is sent again in plain form.
+func (r *Resolver) caseMismatch(ctx context.Context, server string, query domain.Question, now time.Time, err error) (domain.DNSResponse, error) {
+	backoff := r.caseRand.mismatch(server)
+	if backoff == 0 {
+		return domain.DNSResponse{}, fmt.Errorf("%w: %v", errCaseMismatch, err)
+	}
+	r.logger.Info(map[string]any{
+		"server":  server,
+		"backoff": backoff.String(),
+	}, "Upstream server does not preserve query case, disabling 0x20")
+	return r.queryServerWithContext(ctx, server, query, now)
+}
+
+// decodeFunc turns a raw response message into a DNSResponse.
+type decodeFunc func(data []byte) (domain.DNSResponse, error)
+
+// exchange sends a single query to server over the given network ("udp" or "tcp")
+// and decodes the response. TCP messages use the two-byte length framing from RFC 1035 §4.2.2.
+// The query and the raw response are passed to tap as forwarder messages.
+func (r *Resolver) exchange(ctx context.Context, network, server string, query domain.Question, tap resolver.MessageTap, decode decodeFunc) (domain.DNSResponse, error) {
+	// Create connection with the context's deadline
+	conn, err := Connect(ctx, r.dial, network, server)
 	if err != nil {
-		return nil, fmt.Errorf(errFailedToConnect, err)
+		return domain.DNSResponse{}, err
 	}
 	defer func() {
 		// ignore close error but satisfy linters
 		_ = conn.Close()
 	}()
 
-	// Set deadline from context
-	if deadline, ok := ctx.Deadline(); ok {
-		err = conn.SetDeadline(deadline)
-		if err != nil {
-			return nil, fmt.Errorf(errConnDeadline, err)
-		}
-	}
-
 	// Encode and send query
 	queryBytes, err := r.codec.EncodeQuery(query)
+	if err == nil && r.dnssec {
+		queryBytes, err = wire.AppendEDNS(queryBytes, wire.EDNSPayloadSize, true)
+	}
 	if err != nil {
-		return nil, fmt.Errorf(errEncodeFailed, err)
+		return domain.DNSResponse{}, fmt.Errorf(errEncodeFailed, err)
 	}
 
 	// Use goroutine for write/read to enable context cancellation
 	type result struct {
-		answers []domain.ResourceRecord
-		err     error
+		response domain.DNSResponse
+		err      error
 	}
 
 	resultChan := make(chan result, 1)
 
+	tapped := resolver.TapMessage{
+		Type:         resolver.TapForwarderQuery,
+		Protocol:     network,
+		QueryAddr:    conn.LocalAddr(),
+		ResponseAddr: conn.RemoteAddr(),
+		QueryTime:    r.clock.Now(),
+		Message:      queryBytes,
+	}
+	tap.Tap(tapped)
+
 	go func() {
-		// Send query
-		_, err := conn.Write(queryBytes)
-		if err != nil {
-			resultChan <- result{err: fmt.Errorf(errWriteFailed, err)}
-			return
+		exchangeFn := ExchangeDatagram
+		if network == NetworkTCP {
+			exchangeFn = ExchangeStream
 		}
+		responseBytes, err := exchangeFn(conn, queryBytes)
+		for {
+			if err != nil {
+				resultChan <- result{err: err}
+				return
+			}
+			tapped.Type = resolver.TapForwarderResponse
+			tapped.ResponseTime = r.clock.Now()
+			tapped.Message = responseBytes
+			tap.Tap(tapped)
 
-		// Read response
-		buffer := make([]byte, 512)
-		n, err := conn.Read(buffer)
-		if err != nil {
-			resultChan <- result{err: fmt.Errorf(errReadFailed, err)}
-			return
+			// Decode response
+			response, err := decode(responseBytes)
+			if network == NetworkTCP || !errors.Is(err, errCaseMismatch) {
+				resultChan <- result{response: response, err: err}
+				return
+			}
+			// The reply may be forged: listen a little longer for the genuine one.
+			responseBytes, err = r.awaitDatagram(ctx, conn)
 		}
-
-		// Decode response
-		response, err := r.codec.DecodeResponse(buffer[:n], query.ID, now)
-		resultChan <- result{answers: response.Answers, err: err}
 	}()
 
 	// Wait for result or context cancellation
 	select {
 	case res := <-resultChan:
-		return res.answers, res.err
+		return res.response, res.err
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		return domain.DNSResponse{}, ctx.Err()
+	}
+}
+
+// awaitDatagram reads the next datagram on conn, waiting at most the
+// randomizer's mismatch wait.
+func (r *Resolver) awaitDatagram(ctx context.Context, conn net.Conn) ([]byte, error) {
+	deadline := r.clock.Now().Add(r.caseRand.wait)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return nil, fmt.Errorf(errConnDeadline, err)
 	}
+	return readDatagram(conn)
 }
 
 var _ resolver.UpstreamClient = (*Resolver)(nil)
@@ -4,13 +4,20 @@ import (
 	"context"
 	"errors"
 	"net"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/common/log"
 	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/gateways/wire"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
 )
 
 // MockCodec implements domain.DNSCodec for testing
@@ -38,6 +45,11 @@ func (m *MockCodec) EncodeResponse(resp domain.DNSResponse) ([]byte, error) {
 	return args.Get(0).([]byte), args.Error(1)
 }
 
+func (m *MockCodec) EncodeStreamResponse(resp domain.DNSResponse) ([]byte, error) {
+	args := m.Called(resp)
+	return args.Get(0).([]byte), args.Error(1)
+}
+
 // MockConn implements net.Conn for testing
 type MockConn struct {
 	mock.Mock
@@ -98,12 +110,19 @@ func createTestResponse() domain.DNSResponse {
 		"1.2.3.4",
 	)
 	return domain.DNSResponse{
-		ID:      12345,
-		RCode:   0, // NOERROR
-		Answers: []domain.ResourceRecord{rr},
+		ID:       12345,
+		RCode:    0, // NOERROR
+		Question: createTestQuery(),
+		Answers:  []domain.ResourceRecord{rr},
 	}
 }
 
+// testQueryID pins the upstream message ID to the one used by createTestQuery,
+// so codec mocks can match the exact query sent on the wire.
+func testQueryID() uint16 {
+	return createTestQuery().ID
+}
+
 func createTimeFixture() time.Time {
 	return time.Date(2099, 1, 1, 0, 0, 0, 0, time.UTC)
 }
@@ -137,6 +156,24 @@ func TestNewResolver(t *testing.T) {
 			},
 			wantErr: errCodecRequired,
 		},
+		{
+			name: "unknown strategy",
+			opts: Options{
+				Servers:  []string{"1.1.1.1:53"},
+				Codec:    &MockCodec{},
+				Strategy: "lowest_latency",
+			},
+			wantErr: "unknown selection strategy",
+		},
+		{
+			name: "unknown network",
+			opts: Options{
+				Servers: []string{"1.1.1.1:53"},
+				Codec:   &MockCodec{},
+				Network: "quic",
+			},
+			wantErr: "unsupported upstream network",
+		},
 		{
 			name: "default timeout applied",
 			opts: Options{
@@ -181,6 +218,7 @@ func TestResolver_ensureContextDeadline(t *testing.T) {
 		Servers: []string{"1.1.1.1:53"},
 		Timeout: 2 * time.Second,
 		Codec:   codec,
+		QueryID: testQueryID,
 	})
 	assert.NoError(t, err)
 
@@ -311,6 +349,7 @@ func TestResolver_Resolve_Serial(t *testing.T) {
 				Timeout:  time.Second,
 				Parallel: false, // Serial mode
 				Codec:    codec,
+				QueryID:  testQueryID,
 				Dial:     dial,
 			})
 			assert.NoError(t, err)
@@ -323,7 +362,7 @@ func TestResolver_Resolve_Serial(t *testing.T) {
 				assert.Contains(t, err.Error(), tt.wantErr)
 			} else {
 				assert.NoError(t, err)
-				assert.Equal(t, tt.wantResp, resp)
+				assert.Equal(t, tt.wantResp, resp.Answers)
 			}
 
 			codec.AssertExpectations(t)
@@ -414,6 +453,7 @@ func TestResolver_Resolve_Parallel(t *testing.T) {
 				Timeout:  time.Second,
 				Parallel: true, // Parallel mode
 				Codec:    codec,
+				QueryID:  testQueryID,
 				Dial:     dial,
 			})
 			assert.NoError(t, err)
@@ -433,7 +473,7 @@ func TestResolver_Resolve_Parallel(t *testing.T) {
 				assert.Contains(t, err.Error(), tt.wantErr)
 			} else {
 				assert.NoError(t, err)
-				assert.Equal(t, tt.wantResp, resp)
+				assert.Equal(t, tt.wantResp, resp.Answers)
 			}
 
 			codec.AssertExpectations(t)
@@ -465,6 +505,7 @@ func TestResolver_Resolve_ContextCancellation(t *testing.T) {
 		Timeout:  time.Second,
 		Parallel: false,
 		Codec:    codec,
+		QueryID:  testQueryID,
 		Dial:     dial,
 	})
 	assert.NoError(t, err)
@@ -486,6 +527,7 @@ func TestResolver_setTimeout(t *testing.T) {
 		Servers: []string{"1.1.1.1:53"},
 		Timeout: time.Second,
 		Codec:   codec,
+		QueryID: testQueryID,
 	})
 	assert.NoError(t, err)
 
@@ -556,6 +598,7 @@ func TestResolver_queryServerWithContext(t *testing.T) {
 				Servers: []string{"1.1.1.1:53"},
 				Timeout: time.Second,
 				Codec:   codec,
+				QueryID: testQueryID,
 				Dial:    dial,
 			})
 			assert.NoError(t, err)
@@ -568,7 +611,7 @@ func TestResolver_queryServerWithContext(t *testing.T) {
 				assert.Contains(t, err.Error(), tt.wantErr)
 			} else {
 				assert.NoError(t, err)
-				assert.Equal(t, tt.wantResp, resp)
+				assert.Equal(t, tt.wantResp, resp.Answers)
 			}
 
 			codec.AssertExpectations(t)
@@ -577,6 +620,46 @@ func TestResolver_queryServerWithContext(t *testing.T) {
 	}
 }
 
+func TestResolver_Exchange_DNSSEC(t *testing.T) {
+	query := createTestQuery()
+	tf := createTimeFixture()
+	response := createTestResponse()
+	response.RCode = domain.NXDOMAIN
+	soa, _ := domain.NewAuthoritativeResourceRecord("example.com.", domain.RRTypeSOA, domain.RRClassIN, 300, []byte{0}, "ns1.example.com")
+	response.Authority = []domain.ResourceRecord{soa}
+	queryBytes := make([]byte, 12)
+	wantBytes, err := wire.AppendEDNS(queryBytes, wire.EDNSPayloadSize, true)
+	require.NoError(t, err)
+	responseBytes := []byte("response")
+
+	codec := &MockCodec{}
+	codec.On("EncodeQuery", query).Return(queryBytes, nil)
+	codec.On("DecodeResponse", responseBytes, query.ID, tf).Return(response, nil)
+	conn := &MockConn{readData: responseBytes}
+	conn.On("Write", wantBytes).Return(len(wantBytes), nil)
+	conn.On("Read", mock.AnythingOfType("[]uint8")).Return(len(responseBytes), nil)
+	conn.On("Close").Return(nil)
+
+	r, err := NewResolver(Options{
+		Servers: []string{"1.1.1.1:53"},
+		Codec:   codec,
+		QueryID: testQueryID,
+		DNSSEC:  true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return conn, nil
+		},
+	})
+	require.NoError(t, err)
+
+	got, err := r.Exchange(context.Background(), query, tf)
+	require.NoError(t, err)
+	assert.Equal(t, domain.NXDOMAIN, got.RCode)
+	assert.Equal(t, response.Answers, got.Answers)
+	assert.Equal(t, response.Authority, got.Authority, "authority section is returned whole")
+	codec.AssertExpectations(t)
+	conn.AssertExpectations(t)
+}
+
 func TestResolver_queryServerWithContext_SetDeadlineError(t *testing.T) {
 	query := createTestQuery()
 	tf := createTimeFixture()
@@ -596,6 +679,7 @@ func TestResolver_queryServerWithContext_SetDeadlineError(t *testing.T) {
 		Servers: []string{"1.1.1.1:53"},
 		Timeout: time.Second,
 		Codec:   codec,
+		QueryID: testQueryID,
 		Dial:    dial,
 	})
 	assert.NoError(t, err)
@@ -613,6 +697,118 @@ func TestResolver_queryServerWithContext_SetDeadlineError(t *testing.T) {
 	conn.AssertExpectations(t)
 }
 
+func TestResolver_queryServerWithContext_TCPFallback(t *testing.T) {
+	query := createTestQuery()
+	tf := createTimeFixture()
+	full := createTestResponse()
+	queryBytes := []byte("query")
+	udpBytes := []byte("truncated")
+	tcpBytes := []byte("full-response")
+
+	tests := []struct {
+		name     string
+		tcpReply []byte // nil closes the stream without answering
+		wantErr  string
+		wantResp []domain.ResourceRecord
+	}{
+		{
+			name:     "truncated udp answer retried over tcp",
+			tcpReply: tcpBytes,
+			wantResp: full.Answers,
+		},
+		{
+			name:     "tcp retry fails",
+			tcpReply: nil,
+			wantErr:  "tcp fallback failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codec := &MockCodec{}
+			codec.On("EncodeQuery", query).Return(queryBytes, nil)
+			codec.On("DecodeResponse", udpBytes, query.ID, tf).Return(domain.DNSResponse{ID: query.ID, Question: query, Truncated: true}, nil)
+			if tt.tcpReply != nil {
+				codec.On("DecodeResponse", tcpBytes, query.ID, tf).Return(full, nil)
+			}
+
+			udpConn := &MockConn{readData: udpBytes}
+			udpConn.On("Write", queryBytes).Return(len(queryBytes), nil)
+			udpConn.On("Read", mock.AnythingOfType("[]uint8")).Return(len(udpBytes), nil)
+			udpConn.On("Close").Return(nil)
+
+			var networks []string
+			var received <-chan []byte
+			dial := func(ctx context.Context, network, address string) (net.Conn, error) {
+				networks = append(networks, network)
+				if network == "tcp" {
+					client, server := net.Pipe()
+					received = serveStream(t, server, tt.tcpReply)
+					return client, nil
+				}
+				return udpConn, nil
+			}
+
+			r, err := NewResolver(Options{
+				Servers: []string{"1.1.1.1:53"},
+				Timeout: time.Second,
+				Codec:   codec,
+				QueryID: testQueryID,
+				Dial:    dial,
+			})
+			assert.NoError(t, err)
+
+			resp, err := r.queryServerWithContext(context.Background(), "1.1.1.1:53", query, tf)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantResp, resp.Answers)
+			}
+			assert.Equal(t, []string{"udp", "tcp"}, networks)
+			assert.Equal(t, queryBytes, <-received, "tcp retry should resend the same query")
+
+			codec.AssertExpectations(t)
+			udpConn.AssertExpectations(t)
+		})
+	}
+}
+
+func TestResolver_queryServerWithContext_TCPOnly(t *testing.T) {
+	query := createTestQuery()
+	tf := createTimeFixture()
+	full := createTestResponse()
+	queryBytes := []byte("query")
+	tcpBytes := []byte("full-response")
+
+	codec := &MockCodec{}
+	codec.On("EncodeQuery", query).Return(queryBytes, nil)
+	codec.On("DecodeResponse", tcpBytes, query.ID, tf).Return(full, nil)
+
+	var networks []string
+	var received <-chan []byte
+	r, err := NewResolver(Options{
+		Servers: []string{"127.0.0.1:8600"},
+		Network: "tcp",
+		Codec:   codec,
+		QueryID: testQueryID,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			networks = append(networks, network)
+			client, server := net.Pipe()
+			received = serveStream(t, server, tcpBytes)
+			return client, nil
+		},
+	})
+	require.NoError(t, err)
+
+	resp, err := r.queryServerWithContext(context.Background(), "127.0.0.1:8600", query, tf)
+	require.NoError(t, err)
+	assert.Equal(t, full.Answers, resp.Answers)
+	assert.Equal(t, []string{"tcp"}, networks)
+	assert.Equal(t, queryBytes, <-received)
+	codec.AssertExpectations(t)
+}
+
 // fakeCtxErrOnly simulates a context that has an error but whose Done channel never closes.
 // This is intentionally non-compliant with context contract, but useful to deterministically
 // exercise the post-loop timeout preference in resolveWithContext.
@@ -660,6 +856,7 @@ func TestResolver_Resolve_Parallel_PostLoopTimeoutPreferred(t *testing.T) {
 		Timeout:  50 * time.Millisecond,
 		Parallel: true,
 		Codec:    codec,
+		QueryID:  testQueryID,
 		Dial:     dial,
 	})
 	assert.NoError(t, err)
@@ -676,3 +873,703 @@ func TestResolver_Resolve_Parallel_PostLoopTimeoutPreferred(t *testing.T) {
 	conn1.AssertExpectations(t)
 	conn2.AssertExpectations(t)
 }
+
+func TestResolver_Resolve_SkipsSidelinedServer(t *testing.T) {
+	tf := createTimeFixture()
+	query := createTestQuery()
+	response := createTestResponse()
+	queryBytes := []byte("query")
+	responseBytes := []byte("response")
+
+	codec := &MockCodec{}
+	codec.On("EncodeQuery", query).Return(queryBytes, nil)
+	codec.On("DecodeResponse", responseBytes, query.ID, tf).Return(response, nil)
+	conn := &MockConn{readData: responseBytes}
+	conn.On("Write", queryBytes).Return(len(queryBytes), nil)
+	conn.On("Read", mock.AnythingOfType("[]uint8")).Return(len(responseBytes), nil)
+	conn.On("Close").Return(nil)
+
+	var dialed []string
+	r, err := NewResolver(Options{
+		Servers: []string{"1.1.1.1:53", "8.8.8.8:53"},
+		Codec:   codec,
+		QueryID: testQueryID,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			dialed = append(dialed, address)
+			return conn, nil
+		},
+		Health: HealthOptions{FailureThreshold: 1},
+		Clock:  &clock.MockClock{CurrentTime: tf},
+	})
+	require.NoError(t, err)
+	r.health.recordFailure("1.1.1.1:53", errors.New("timeout"))
+
+	answer, err := r.Resolve(context.Background(), query, tf)
+	answers := answer.Answers
+	require.NoError(t, err)
+	assert.Equal(t, response.Answers, answers)
+	assert.Equal(t, []string{"8.8.8.8:53"}, dialed)
+
+	health := r.Health()
+	assert.False(t, health[0].Healthy)
+	assert.True(t, health[1].Healthy)
+	assert.Equal(t, uint64(1), health[1].Queries)
+}
+
+func TestResolver_Resolve_ServerFailureFailsOver(t *testing.T) {
+	for _, rcode := range []domain.RCode{domain.SERVFAIL, domain.REFUSED, domain.FORMERR} {
+		t.Run(rcode.String(), func(t *testing.T) {
+			tf := createTimeFixture()
+			query := createTestQuery()
+			good := createTestResponse()
+			bad := domain.NewDNSErrorResponse(query.ID, rcode)
+			bad.Question = query
+			queryBytes := []byte("query")
+
+			codec := &MockCodec{}
+			codec.On("EncodeQuery", query).Return(queryBytes, nil)
+			codec.On("DecodeResponse", []byte("bad"), query.ID, tf).Return(bad, nil)
+			codec.On("DecodeResponse", []byte("good"), query.ID, tf).Return(good, nil)
+			conns := map[string]*MockConn{
+				"1.1.1.1:53": {readData: []byte("bad")},
+				"8.8.8.8:53": {readData: []byte("good")},
+			}
+			for _, conn := range conns {
+				conn.On("Write", queryBytes).Return(len(queryBytes), nil)
+				conn.On("Read", mock.AnythingOfType("[]uint8")).Return(len(conn.readData), nil)
+				conn.On("Close").Return(nil)
+			}
+
+			var dialed []string
+			r, err := NewResolver(Options{
+				Servers: []string{"1.1.1.1:53", "8.8.8.8:53"},
+				Codec:   codec,
+				QueryID: testQueryID,
+				Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+					dialed = append(dialed, address)
+					return conns[address], nil
+				},
+				Health: HealthOptions{FailureThreshold: 2},
+				Clock:  &clock.MockClock{CurrentTime: tf},
+			})
+			require.NoError(t, err)
+
+			for range 2 {
+				answer, err := r.Resolve(context.Background(), query, tf)
+				answers := answer.Answers
+				require.NoError(t, err)
+				assert.Equal(t, good.Answers, answers)
+			}
+			assert.Equal(t, []string{"1.1.1.1:53", "8.8.8.8:53", "1.1.1.1:53", "8.8.8.8:53"}, dialed)
+
+			health := r.Health()
+			assert.False(t, health[0].Healthy, "breaker opens after repeated %s", rcode)
+			assert.Equal(t, uint64(2), health[0].Failures)
+			assert.Contains(t, health[0].LastError, rcode.String())
+			assert.True(t, health[1].Healthy)
+
+			// The sidelined server is skipped from now on
+			dialed = nil
+			_, err = r.Resolve(context.Background(), query, tf)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"8.8.8.8:53"}, dialed)
+		})
+	}
+}
+
+func TestResolver_Resolve_AllServersFail(t *testing.T) {
+	tf := createTimeFixture()
+	query := createTestQuery()
+	bad := domain.NewDNSErrorResponse(query.ID, domain.SERVFAIL)
+	bad.Question = query
+
+	codec := &MockCodec{}
+	codec.On("EncodeQuery", query).Return([]byte("query"), nil)
+	codec.On("DecodeResponse", []byte("bad"), query.ID, tf).Return(bad, nil)
+	conn := &MockConn{readData: []byte("bad")}
+	conn.On("Write", []byte("query")).Return(5, nil)
+	conn.On("Read", mock.AnythingOfType("[]uint8")).Return(3, nil)
+	conn.On("Close").Return(nil)
+
+	r, err := NewResolver(Options{
+		Servers: []string{"1.1.1.1:53"},
+		Codec:   codec,
+		QueryID: testQueryID,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return conn, nil
+		},
+		Clock: &clock.MockClock{CurrentTime: tf},
+	})
+	require.NoError(t, err)
+
+	_, err = r.Exchange(context.Background(), query, tf)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server answered SERVFAIL")
+}
+
+// testSpan records what an attempt reports about itself.
+type testSpan struct {
+	attrs map[string]any
+	err   error
+	ended bool
+}
+
+func (s *testSpan) SetAttribute(key string, value any) { s.attrs[key] = value }
+func (s *testSpan) RecordError(err error)              { s.err = err }
+func (s *testSpan) End()                               { s.ended = true }
+
+// testTracer records every span it starts.
+type testTracer struct {
+	mu    sync.Mutex
+	names []string
+	kinds []resolver.SpanKind
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, name string, kind resolver.SpanKind) (context.Context, resolver.Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span := &testSpan{attrs: make(map[string]any)}
+	t.names = append(t.names, name)
+	t.kinds = append(t.kinds, kind)
+	t.spans = append(t.spans, span)
+	return ctx, span
+}
+
+func TestResolver_Resolve_Tracing(t *testing.T) {
+	tf := createTimeFixture()
+	query := createTestQuery()
+	response := createTestResponse()
+	queryBytes := []byte("query")
+	responseBytes := []byte("response")
+
+	codec := &MockCodec{}
+	codec.On("EncodeQuery", query).Return(queryBytes, nil)
+	codec.On("DecodeResponse", responseBytes, query.ID, tf).Return(response, nil)
+	conn := &MockConn{readData: responseBytes}
+	conn.On("Write", queryBytes).Return(len(queryBytes), nil)
+	conn.On("Read", mock.AnythingOfType("[]uint8")).Return(len(responseBytes), nil)
+	conn.On("Close").Return(nil)
+
+	dialErr := errors.New("connection refused")
+	tracer := &testTracer{}
+	r, err := NewResolver(Options{
+		Servers: []string{"1.1.1.1:53", "8.8.8.8:53"},
+		Codec:   codec,
+		QueryID: testQueryID,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			if address == "1.1.1.1:53" {
+				return nil, dialErr
+			}
+			return conn, nil
+		},
+		Clock:  &clock.MockClock{CurrentTime: tf},
+		Tracer: tracer,
+	})
+	require.NoError(t, err)
+
+	_, err = r.Resolve(context.Background(), query, tf)
+	require.NoError(t, err)
+
+	require.Len(t, tracer.spans, 2)
+	assert.Equal(t, []string{resolver.SpanUpstreamAttempt, resolver.SpanUpstreamAttempt}, tracer.names)
+	assert.Equal(t, []resolver.SpanKind{resolver.SpanKindClient, resolver.SpanKindClient}, tracer.kinds)
+
+	failed, succeeded := tracer.spans[0], tracer.spans[1]
+	assert.Equal(t, "1.1.1.1:53", failed.attrs[resolver.AttrServer])
+	assert.ErrorIs(t, failed.err, dialErr)
+	assert.NotContains(t, failed.attrs, resolver.AttrResponseCode)
+
+	assert.Equal(t, map[string]any{
+		resolver.AttrServer:       "8.8.8.8:53",
+		resolver.AttrQuestionName: "example.com.",
+		resolver.AttrQuestionType: "A",
+		resolver.AttrResponseCode: "NOERROR",
+		resolver.AttrAnswerCount:  1,
+	}, succeeded.attrs)
+	assert.NoError(t, succeeded.err)
+	assert.True(t, failed.ended)
+	assert.True(t, succeeded.ended)
+}
+
+func TestResolver_Resolve_ReportsServer(t *testing.T) {
+	tf := createTimeFixture()
+	query := createTestQuery()
+	response := createTestResponse()
+	queryBytes := []byte("query")
+	responseBytes := []byte("response")
+
+	codec := &MockCodec{}
+	codec.On("EncodeQuery", query).Return(queryBytes, nil)
+	codec.On("DecodeResponse", responseBytes, query.ID, tf).Return(response, nil)
+	conn := &MockConn{readData: responseBytes}
+	conn.On("Write", queryBytes).Return(len(queryBytes), nil)
+	conn.On("Read", mock.AnythingOfType("[]uint8")).Return(len(responseBytes), nil)
+	conn.On("Close").Return(nil)
+
+	r, err := NewResolver(Options{
+		Servers: []string{"1.1.1.1:53", "8.8.8.8:53"},
+		Codec:   codec,
+		QueryID: testQueryID,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			if address == "1.1.1.1:53" {
+				return nil, errors.New("connection refused")
+			}
+			return conn, nil
+		},
+		Clock: &clock.MockClock{CurrentTime: tf},
+	})
+	require.NoError(t, err)
+
+	// The resolver learns which server answered through the query log entry
+	queryLog := &reportedServers{}
+	res := resolver.NewResolver(resolver.ResolverOptions{
+		Clock:    &clock.MockClock{CurrentTime: tf},
+		Logger:   log.NewNoopLogger(),
+		Upstream: r,
+		QueryLog: queryLog,
+	})
+	_, err = res.HandleQuery(context.Background(), query, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"8.8.8.8:53"}, queryLog.servers)
+}
+
+// reportedServers keeps the upstream server of every query log entry.
+type reportedServers struct {
+	servers []string
+}
+
+func (l *reportedServers) Record(entry resolver.QueryLogEntry) {
+	l.servers = append(l.servers, entry.Upstream)
+}
+
+// tapRecorder keeps every tapped message.
+type tapRecorder struct {
+	mu       sync.Mutex
+	messages []resolver.TapMessage
+}
+
+func (r *tapRecorder) Tap(msg resolver.TapMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, msg)
+}
+
+func (r *tapRecorder) tapped() []resolver.TapMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]resolver.TapMessage(nil), r.messages...)
+}
+
+func TestResolver_Resolve_Tap(t *testing.T) {
+	tf := createTimeFixture()
+	query := createTestQuery()
+	response := createTestResponse()
+	queryBytes := []byte("query")
+	responseBytes := []byte("response")
+
+	codec := &MockCodec{}
+	codec.On("EncodeQuery", query).Return(queryBytes, nil)
+	codec.On("DecodeResponse", responseBytes, query.ID, tf).Return(response, nil)
+	conn := &MockConn{readData: responseBytes}
+	conn.On("Write", queryBytes).Return(len(queryBytes), nil)
+	conn.On("Read", mock.AnythingOfType("[]uint8")).Return(len(responseBytes), nil)
+	conn.On("Close").Return(nil)
+
+	tap := &tapRecorder{}
+	r, err := NewResolver(Options{
+		Servers: []string{"8.8.8.8:53"},
+		Codec:   codec,
+		QueryID: testQueryID,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return conn, nil
+		},
+		Clock: &clock.MockClock{CurrentTime: tf},
+		Tap:   tap,
+	})
+	require.NoError(t, err)
+
+	_, err = r.Resolve(context.Background(), query, tf)
+	require.NoError(t, err)
+
+	messages := tap.tapped()
+	require.Len(t, messages, 2)
+	assert.Equal(t, resolver.TapMessage{
+		Type:      resolver.TapForwarderQuery,
+		Protocol:  "udp",
+		QueryTime: tf,
+		Message:   queryBytes,
+	}, messages[0])
+	assert.Equal(t, resolver.TapMessage{
+		Type:         resolver.TapForwarderResponse,
+		Protocol:     "udp",
+		QueryTime:    tf,
+		ResponseTime: tf,
+		Message:      responseBytes,
+	}, messages[1])
+}
+
+func TestResolver_probeDue(t *testing.T) {
+	tests := []struct {
+		name        string
+		setQR       bool
+		wantHealthy bool
+	}{
+		{name: "valid reply recovers server", setQR: true, wantHealthy: true},
+		{name: "reply without QR keeps server sidelined", setQR: false, wantHealthy: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := &clock.MockClock{CurrentTime: createTimeFixture()}
+			tap := &tapRecorder{}
+			r, err := NewResolver(Options{
+				Servers: []string{"1.1.1.1:53"},
+				Tap:     tap,
+				Codec:   wire.NewUDPCodec(log.NewNoopLogger()),
+				Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+					client, server := net.Pipe()
+					go func() {
+						defer func() { _ = server.Close() }()
+						buf := make([]byte, maxUDPMessageSize)
+						n, err := server.Read(buf)
+						if err != nil {
+							return
+						}
+						if tt.setQR {
+							buf[2] |= 0x80
+						}
+						_, _ = server.Write(buf[:n])
+					}()
+					return client, nil
+				},
+				Health: HealthOptions{FailureThreshold: 1, Backoff: time.Minute},
+				Clock:  clk,
+			})
+			require.NoError(t, err)
+			r.health.recordFailure("1.1.1.1:53", errors.New("timeout"))
+
+			// Not yet due: nothing is probed
+			r.probeDue(context.Background())
+			assert.Equal(t, uint64(1), r.Health()[0].Queries)
+
+			clk.Advance(time.Minute)
+			r.probeDue(context.Background())
+			health := r.Health()[0]
+			assert.Equal(t, uint64(2), health.Queries)
+			assert.Equal(t, tt.wantHealthy, health.Healthy)
+			if !tt.wantHealthy {
+				assert.Contains(t, health.LastError, errProbeInvalid)
+			}
+			assert.Empty(t, tap.tapped(), "health probes are not tapped")
+		})
+	}
+}
+
+func TestResolver_StartHealthChecks(t *testing.T) {
+	clk := &clock.MockClock{CurrentTime: createTimeFixture()}
+	r, err := NewResolver(Options{
+		Servers: []string{"1.1.1.1:53"},
+		Codec:   wire.NewUDPCodec(log.NewNoopLogger()),
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			client, server := net.Pipe()
+			go func() {
+				defer func() { _ = server.Close() }()
+				buf := make([]byte, maxUDPMessageSize)
+				n, err := server.Read(buf)
+				if err != nil {
+					return
+				}
+				buf[2] |= 0x80
+				_, _ = server.Write(buf[:n])
+			}()
+			return client, nil
+		},
+		Health: HealthOptions{FailureThreshold: 1, Backoff: time.Minute, ProbeInterval: 10 * time.Second},
+		Clock:  clk,
+	})
+	require.NoError(t, err)
+	r.health.recordFailure("1.1.1.1:53", errors.New("timeout"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r.StartHealthChecks(ctx)
+
+	// Each round waits ProbeInterval on the clock; the server is due after its backoff
+	for range 6 {
+		require.Eventually(t, func() bool { return clk.Waiting() == 1 }, time.Second, time.Millisecond)
+		assert.False(t, r.Health()[0].Healthy)
+		clk.Advance(10 * time.Second)
+	}
+	assert.Eventually(t, func() bool { return r.Health()[0].Healthy }, time.Second, time.Millisecond)
+}
+
+func TestResolver_Resolve_StrategyAndRaceCount(t *testing.T) {
+	tf := createTimeFixture()
+	query := createTestQuery()
+	response := createTestResponse()
+	queryBytes := []byte("query")
+	responseBytes := []byte("response")
+	servers := []string{"1.1.1.1:53", "8.8.8.8:53", "9.9.9.9:53"}
+
+	tests := []struct {
+		name       string
+		opts       Options
+		wantDialed [][]string // servers dialed per successive query
+	}{
+		{
+			name:       "strict serial always starts with first server",
+			opts:       Options{Strategy: StrategyStrict},
+			wantDialed: [][]string{{"1.1.1.1:53"}, {"1.1.1.1:53"}},
+		},
+		{
+			name:       "round robin serial rotates first server",
+			opts:       Options{Strategy: StrategyRoundRobin},
+			wantDialed: [][]string{{"1.1.1.1:53"}, {"8.8.8.8:53"}, {"9.9.9.9:53"}},
+		},
+		{
+			name:       "parallel race limited to top candidate",
+			opts:       Options{Strategy: StrategyRoundRobin, Parallel: true, RaceCount: 1},
+			wantDialed: [][]string{{"1.1.1.1:53"}, {"8.8.8.8:53"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codec := &MockCodec{}
+			codec.On("EncodeQuery", query).Return(queryBytes, nil)
+			codec.On("DecodeResponse", responseBytes, query.ID, tf).Return(response, nil)
+
+			var mu sync.Mutex
+			var dialed []string
+			opts := tt.opts
+			opts.Servers = servers
+			opts.Codec = codec
+			opts.QueryID = testQueryID
+			opts.Dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+				mu.Lock()
+				dialed = append(dialed, address)
+				mu.Unlock()
+				conn := &MockConn{readData: responseBytes}
+				conn.On("Write", queryBytes).Return(len(queryBytes), nil)
+				conn.On("Read", mock.AnythingOfType("[]uint8")).Return(len(responseBytes), nil)
+				conn.On("Close").Return(nil)
+				return conn, nil
+			}
+			r, err := NewResolver(opts)
+			require.NoError(t, err)
+
+			for _, want := range tt.wantDialed {
+				dialed = nil
+				_, err := r.Resolve(context.Background(), query, tf)
+				require.NoError(t, err)
+				mu.Lock()
+				assert.Equal(t, want, dialed)
+				mu.Unlock()
+			}
+		})
+	}
+}
+
+func TestResolver_queryServerWithContext_SpoofingHardening(t *testing.T) {
+	query := createTestQuery()
+	tf := createTimeFixture()
+	queryBytes := []byte("query")
+	responseBytes := []byte("response")
+	const upstreamID = 4242 // differs from the client's ID in createTestQuery
+
+	sent := query
+	sent.ID = upstreamID
+	legit := createTestResponse()
+	legit.ID = upstreamID
+	injected, _ := domain.NewAuthoritativeResourceRecord("bank.example.", 1, 1, 300, []byte{203, 0, 113, 66}, "203.0.113.66")
+
+	mismatched := legit
+	mismatched.Question.Name = "bank.example."
+	poisoned := legit
+	poisoned.Answers = append([]domain.ResourceRecord{injected}, legit.Answers...)
+
+	tests := []struct {
+		name     string
+		response domain.DNSResponse
+		wantErr  string
+		wantResp []domain.ResourceRecord
+	}{
+		{name: "matching question accepted", response: legit, wantResp: legit.Answers},
+		{name: "echoed question mismatch rejected", response: mismatched, wantErr: "does not match query"},
+		{name: "out-of-bailiwick answer stripped", response: poisoned, wantResp: legit.Answers},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codec := &MockCodec{}
+			// The client's ID must never be forwarded; the response is checked against the new one.
+			codec.On("EncodeQuery", sent).Return(queryBytes, nil)
+			codec.On("DecodeResponse", responseBytes, uint16(upstreamID), tf).Return(tt.response, nil)
+
+			conn := &MockConn{readData: responseBytes}
+			conn.On("Write", queryBytes).Return(len(queryBytes), nil)
+			conn.On("Read", mock.AnythingOfType("[]uint8")).Return(len(responseBytes), nil)
+			conn.On("Close").Return(nil)
+
+			r, err := NewResolver(Options{
+				Servers: []string{"1.1.1.1:53"},
+				Codec:   codec,
+				QueryID: func() uint16 { return upstreamID },
+				Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+					return conn, nil
+				},
+			})
+			require.NoError(t, err)
+
+			resp, err := r.queryServerWithContext(context.Background(), "1.1.1.1:53", query, tf)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tt.wantResp, resp.Answers)
+			}
+			codec.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRandomQueryID(t *testing.T) {
+	seen := make(map[uint16]bool)
+	for range 64 {
+		seen[RandomQueryID()] = true
+	}
+	// 64 draws from 65536 values collapsing to a handful would mean the IDs are not random
+	assert.Greater(t, len(seen), 60)
+}
+
+// foldCase lower-cases the question name of a DNS message in place.
+func foldCase(msg []byte) []byte {
+	for i := 12; i < len(msg)-4; i++ {
+		if 'A' <= msg[i] && msg[i] <= 'Z' {
+			msg[i] += 'a' - 'A'
+		}
+	}
+	return msg
+}
+
+// caseServer dials a fake upstream over net.Pipe that records the names it is
+// asked and answers each query with the datagrams returned by replies.
+func caseServer(codec wire.DNSCodec, sent *[]string, mu *sync.Mutex, replies func(reply []byte) [][]byte) DialFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		client, server := net.Pipe()
+		go func() {
+			defer func() { _ = server.Close() }()
+			buf := make([]byte, maxUDPMessageSize)
+			n, err := server.Read(buf)
+			if err != nil {
+				return
+			}
+			q, err := codec.DecodeQuery(buf[:n])
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			*sent = append(*sent, q.Name)
+			mu.Unlock()
+			// echo the question back as an empty NOERROR answer
+			reply := buf[:n]
+			reply[2] |= 0x80
+			for _, datagram := range replies(reply) {
+				if _, err := server.Write(datagram); err != nil {
+					return
+				}
+			}
+		}()
+		return client, nil
+	}
+}
+
+func TestResolver_queryServerWithContext_CaseRandomization(t *testing.T) {
+	query := domain.Question{ID: 1, Name: "www.example-zone.com.", Type: domain.RRTypeA, Class: domain.RRClassIN}
+
+	t.Run("case preserving server keeps 0x20", func(t *testing.T) {
+		var mu sync.Mutex
+		var sent []string
+		codec := wire.NewUDPCodec(log.NewNoopLogger())
+		r, err := NewResolver(Options{
+			Servers:           []string{"1.1.1.1:53"},
+			Codec:             codec,
+			CaseRandomization: true,
+			Dial:              caseServer(codec, &sent, &mu, func(reply []byte) [][]byte { return [][]byte{reply} }),
+		})
+		require.NoError(t, err)
+
+		for range 2 {
+			_, err = r.queryServerWithContext(context.Background(), "1.1.1.1:53", query, createTimeFixture())
+			require.NoError(t, err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		require.Len(t, sent, 2)
+		for _, name := range sent {
+			assert.True(t, strings.EqualFold(name, "www.example-zone.com"))
+		}
+		assert.True(t, r.caseRand.enabled("1.1.1.1:53"))
+	})
+
+	t.Run("case folding server falls back to plain queries after repeated mismatches", func(t *testing.T) {
+		var mu sync.Mutex
+		var sent []string
+		codec := wire.NewUDPCodec(log.NewNoopLogger())
+		clk := &clock.MockClock{CurrentTime: createTimeFixture()}
+		r, err := NewResolver(Options{
+			Servers:           []string{"1.1.1.1:53"},
+			Codec:             codec,
+			CaseRandomization: true,
+			Clock:             clk,
+			Dial:              caseServer(codec, &sent, &mu, func(reply []byte) [][]byte { return [][]byte{foldCase(reply)} }),
+		})
+		require.NoError(t, err)
+		r.caseRand.wait = 10 * time.Millisecond
+
+		// Each mismatched reply fails the attempt until the threshold is reached
+		for range caseMismatchThreshold - 1 {
+			_, err = r.queryServerWithContext(context.Background(), "1.1.1.1:53", query, createTimeFixture())
+			require.ErrorIs(t, err, errCaseMismatch)
+			assert.True(t, r.caseRand.enabled("1.1.1.1:53"))
+		}
+		// then the query is retried in plain form and 0x20 is off for the server
+		_, err = r.queryServerWithContext(context.Background(), "1.1.1.1:53", query, createTimeFixture())
+		require.NoError(t, err)
+		assert.False(t, r.caseRand.enabled("1.1.1.1:53"))
+		_, err = r.queryServerWithContext(context.Background(), "1.1.1.1:53", query, createTimeFixture())
+		require.NoError(t, err)
+
+		mu.Lock()
+		require.Len(t, sent, caseMismatchThreshold+2)
+		// after the fallback every query goes out exactly as the client asked
+		assert.Equal(t, []string{"www.example-zone.com", "www.example-zone.com"}, sent[caseMismatchThreshold:])
+		mu.Unlock()
+
+		// randomization is tried again once the backoff expires
+		clk.Advance(caseBackoff)
+		assert.True(t, r.caseRand.enabled("1.1.1.1:53"))
+	})
+
+	t.Run("forged reply in the wrong case is ignored for the genuine one", func(t *testing.T) {
+		var mu sync.Mutex
+		var sent []string
+		codec := wire.NewUDPCodec(log.NewNoopLogger())
+		r, err := NewResolver(Options{
+			Servers:           []string{"1.1.1.1:53"},
+			Codec:             codec,
+			CaseRandomization: true,
+			Dial: caseServer(codec, &sent, &mu, func(reply []byte) [][]byte {
+				forged := foldCase(append([]byte(nil), reply...))
+				return [][]byte{forged, reply}
+			}),
+		})
+		require.NoError(t, err)
+
+		for range caseMismatchThreshold + 1 {
+			_, err = r.queryServerWithContext(context.Background(), "1.1.1.1:53", query, createTimeFixture())
+			require.NoError(t, err)
+		}
+		// forged replies alone never turn 0x20 off
+		assert.True(t, r.caseRand.enabled("1.1.1.1:53"))
+	})
+}
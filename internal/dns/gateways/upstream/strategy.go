@@ -0,0 +1,187 @@
+package upstream
+
+import (
+	"cmp"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Strategy names the policy used to order upstream servers for each query.
+type Strategy string
+
+// Supported selection strategies.
+const (
+	// StrategyStrict always tries servers in configuration order.
+	StrategyStrict Strategy = "strict"
+	// StrategyRoundRobin rotates the starting server on every query.
+	StrategyRoundRobin Strategy = "round_robin"
+	// StrategyRandom shuffles the servers on every query.
+	StrategyRandom Strategy = "random"
+	// StrategyWeighted shuffles the servers, favouring those with higher weights.
+	StrategyWeighted Strategy = "weighted"
+	// StrategyFastest prefers the server with the lowest measured RTT,
+	// occasionally promoting another server to keep its measurement fresh.
+	StrategyFastest Strategy = "fastest"
+)
+
+// defaultExploration is the probability that the fastest strategy promotes
+// a random server to the front of the list instead of the fastest one.
+const defaultExploration = 0.05
+
+// newSelector builds the selector for opts.Strategy. An empty strategy means StrategyStrict.
+// rtt reports the smoothed round-trip time of a server, or zero if it has not been measured.
+func newSelector(opts Options, rtt func(server string) time.Duration) (selector, error) {
+	rng := opts.Rand
+	if rng == nil {
+		//gosec:disable G404 -- server selection needs spread, not unpredictability
+		rng = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+	locked := &lockedRand{r: rng}
+	switch opts.Strategy {
+	case "", StrategyStrict:
+		return strictSelector{}, nil
+	case StrategyRoundRobin:
+		return &roundRobinSelector{}, nil
+	case StrategyRandom:
+		return &randomSelector{rand: locked}, nil
+	case StrategyWeighted:
+		return &weightedSelector{rand: locked, weights: opts.Weights}, nil
+	case StrategyFastest:
+		exploration := opts.Exploration
+		if exploration == 0 {
+			exploration = defaultExploration
+		}
+		return &fastestSelector{rand: locked, rtt: rtt, exploration: exploration}, nil
+	default:
+		return nil, fmt.Errorf(errUnknownStrategy, opts.Strategy)
+	}
+}
+
+// selector orders the available servers for a single query. The first server
+// returned is tried first in serial mode; the first RaceCount servers are
+// raced in parallel mode. Implementations must be safe for concurrent use.
+type selector interface {
+	order(servers []string) []string
+}
+
+// lockedRand serializes access to a *rand.Rand, which is not safe for concurrent use.
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func (l *lockedRand) intN(n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.IntN(n)
+}
+
+func (l *lockedRand) float64() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Float64()
+}
+
+func (l *lockedRand) shuffle(s []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.r.Shuffle(len(s), func(i, j int) { s[i], s[j] = s[j], s[i] })
+}
+
+// strictSelector keeps configuration order.
+type strictSelector struct{}
+
+func (strictSelector) order(servers []string) []string {
+	return servers
+}
+
+// roundRobinSelector rotates the list by one position per query.
+type roundRobinSelector struct {
+	next atomic.Uint64
+}
+
+func (s *roundRobinSelector) order(servers []string) []string {
+	if len(servers) < 2 {
+		return servers
+	}
+	start := int((s.next.Add(1) - 1) % uint64(len(servers)))
+	out := make([]string, 0, len(servers))
+	out = append(out, servers[start:]...)
+	return append(out, servers[:start]...)
+}
+
+// randomSelector returns a uniformly shuffled copy of the list.
+type randomSelector struct {
+	rand *lockedRand
+}
+
+func (s *randomSelector) order(servers []string) []string {
+	out := slices.Clone(servers)
+	s.rand.shuffle(out)
+	return out
+}
+
+// weightedSelector draws servers without replacement with probability
+// proportional to their weight. Servers without a weight count as 1.
+type weightedSelector struct {
+	rand    *lockedRand
+	weights map[string]int
+}
+
+func (s *weightedSelector) weight(server string) int {
+	if w, ok := s.weights[server]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+func (s *weightedSelector) order(servers []string) []string {
+	remaining := slices.Clone(servers)
+	out := make([]string, 0, len(servers))
+	for len(remaining) > 1 {
+		total := 0
+		for _, srv := range remaining {
+			total += s.weight(srv)
+		}
+		pick := s.rand.intN(total)
+		i := 0
+		for ; pick >= s.weight(remaining[i]); i++ {
+			pick -= s.weight(remaining[i])
+		}
+		out = append(out, remaining[i])
+		remaining = slices.Delete(remaining, i, i+1)
+	}
+	return append(out, remaining...)
+}
+
+// fastestSelector orders servers by smoothed RTT, ascending. Servers that have
+// never answered sort first so they get measured. With probability exploration
+// a random other server is moved to the front so a once-slow server can prove
+// it has recovered.
+type fastestSelector struct {
+	rand        *lockedRand
+	rtt         func(server string) time.Duration
+	exploration float64
+}
+
+func (s *fastestSelector) order(servers []string) []string {
+	out := slices.Clone(servers)
+	rtts := make(map[string]time.Duration, len(out))
+	for _, srv := range out {
+		rtts[srv] = s.rtt(srv)
+	}
+	slices.SortStableFunc(out, func(a, b string) int {
+		return cmp.Compare(rtts[a], rtts[b])
+	})
+	if len(out) > 1 && s.rand.float64() < s.exploration {
+		i := 1 + s.rand.intN(len(out)-1)
+		explore := out[i]
+		copy(out[1:i+1], out[:i])
+		out[0] = explore
+	}
+	return out
+}
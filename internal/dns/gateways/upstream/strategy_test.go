@@ -0,0 +1,150 @@
+package upstream
+
+import (
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var strategyServers = []string{"a:53", "b:53", "c:53"}
+
+func seededRand() *rand.Rand {
+	return rand.New(rand.NewPCG(1, 2))
+}
+
+func noRTT(string) time.Duration { return 0 }
+
+// firstCounts runs order n times and counts which server came first.
+func firstCounts(sel selector, servers []string, n int) map[string]int {
+	counts := make(map[string]int)
+	for range n {
+		counts[sel.order(servers)[0]]++
+	}
+	return counts
+}
+
+func TestNewSelector(t *testing.T) {
+	tests := []struct {
+		strategy Strategy
+		want     selector
+		wantErr  string
+	}{
+		{strategy: "", want: strictSelector{}},
+		{strategy: StrategyStrict, want: strictSelector{}},
+		{strategy: StrategyRoundRobin, want: &roundRobinSelector{}},
+		{strategy: StrategyRandom, want: &randomSelector{}},
+		{strategy: StrategyWeighted, want: &weightedSelector{}},
+		{strategy: StrategyFastest, want: &fastestSelector{}},
+		{strategy: "lowest_latency", wantErr: `unknown selection strategy "lowest_latency"`},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			sel, err := newSelector(Options{Strategy: tt.strategy}, noRTT)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.IsType(t, tt.want, sel)
+		})
+	}
+
+	sel, err := newSelector(Options{Strategy: StrategyFastest}, noRTT)
+	require.NoError(t, err)
+	assert.Equal(t, defaultExploration, sel.(*fastestSelector).exploration)
+}
+
+func TestStrictSelector(t *testing.T) {
+	sel := strictSelector{}
+	for range 3 {
+		assert.Equal(t, strategyServers, sel.order(strategyServers))
+	}
+}
+
+func TestRoundRobinSelector(t *testing.T) {
+	sel := &roundRobinSelector{}
+	assert.Equal(t, []string{"a:53", "b:53", "c:53"}, sel.order(strategyServers))
+	assert.Equal(t, []string{"b:53", "c:53", "a:53"}, sel.order(strategyServers))
+	assert.Equal(t, []string{"c:53", "a:53", "b:53"}, sel.order(strategyServers))
+	assert.Equal(t, []string{"a:53", "b:53", "c:53"}, sel.order(strategyServers))
+	assert.Equal(t, []string{"only:53"}, sel.order([]string{"only:53"}))
+	assert.Equal(t, []string{"a:53", "b:53", "c:53"}, strategyServers, "input must not be modified")
+}
+
+func TestRandomSelector(t *testing.T) {
+	sel := &randomSelector{rand: &lockedRand{r: seededRand()}}
+	again := &randomSelector{rand: &lockedRand{r: seededRand()}}
+
+	for range 10 {
+		got := sel.order(strategyServers)
+		assert.ElementsMatch(t, strategyServers, got)
+		assert.Equal(t, got, again.order(strategyServers), "same seed should give the same order")
+	}
+	assert.Equal(t, []string{"a:53", "b:53", "c:53"}, strategyServers, "input must not be modified")
+
+	counts := firstCounts(sel, strategyServers, 3000)
+	for _, s := range strategyServers {
+		assert.InDelta(t, 1000, counts[s], 150, "server %s", s)
+	}
+}
+
+func TestWeightedSelector(t *testing.T) {
+	sel := &weightedSelector{
+		rand:    &lockedRand{r: seededRand()},
+		weights: map[string]int{"a:53": 6, "b:53": 3}, // c:53 defaults to 1
+	}
+
+	got := sel.order(strategyServers)
+	assert.ElementsMatch(t, strategyServers, got)
+	assert.Equal(t, []string{"a:53", "b:53", "c:53"}, strategyServers, "input must not be modified")
+
+	counts := firstCounts(sel, strategyServers, 10000)
+	assert.InDelta(t, 6000, counts["a:53"], 300)
+	assert.InDelta(t, 3000, counts["b:53"], 300)
+	assert.InDelta(t, 1000, counts["c:53"], 300)
+
+	// Zero or negative weights are treated as 1
+	even := &weightedSelector{
+		rand:    &lockedRand{r: seededRand()},
+		weights: map[string]int{"a:53": 0, "b:53": -4},
+	}
+	counts = firstCounts(even, strategyServers, 3000)
+	for _, s := range strategyServers {
+		assert.InDelta(t, 1000, counts[s], 150, "server %s", s)
+	}
+}
+
+func TestFastestSelector(t *testing.T) {
+	rtts := map[string]time.Duration{
+		"a:53": 40 * time.Millisecond,
+		"b:53": 10 * time.Millisecond,
+		"c:53": 0, // never measured
+	}
+	rtt := func(s string) time.Duration { return rtts[s] }
+
+	t.Run("orders by rtt with unmeasured first", func(t *testing.T) {
+		sel := &fastestSelector{rand: &lockedRand{r: seededRand()}, rtt: rtt, exploration: -1}
+		assert.Equal(t, []string{"c:53", "b:53", "a:53"}, sel.order(strategyServers))
+		assert.Equal(t, []string{"a:53", "b:53", "c:53"}, strategyServers, "input must not be modified")
+	})
+
+	t.Run("exploration always promotes another server", func(t *testing.T) {
+		sel := &fastestSelector{rand: &lockedRand{r: seededRand()}, rtt: rtt, exploration: 1}
+		for range 20 {
+			got := sel.order(strategyServers)
+			assert.NotEqual(t, "c:53", got[0])
+			assert.ElementsMatch(t, strategyServers, got)
+		}
+	})
+
+	t.Run("exploration rate", func(t *testing.T) {
+		sel := &fastestSelector{rand: &lockedRand{r: seededRand()}, rtt: rtt, exploration: 0.1}
+		counts := firstCounts(sel, strategyServers, 10000)
+		assert.InDelta(t, 9000, counts["c:53"], 200)
+		assert.InDelta(t, 500, counts["b:53"], 100)
+		assert.InDelta(t, 500, counts["a:53"], 100)
+	})
+}
@@ -16,4 +16,5 @@ type DNSCodec interface {
 	// These methods handle encoding and decoding of authoritative records for zone file management.
 	DecodeQuery(data []byte) (domain.Question, error)
 	EncodeResponse(resp domain.DNSResponse) ([]byte, error)
+	EncodeStreamResponse(resp domain.DNSResponse) ([]byte, error)
 }
@@ -0,0 +1,111 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+const (
+	// flagAD is the authentic data bit in the DNS header flags (RFC 4035 §3.2.3).
+	flagAD uint16 = 0x0020
+
+	// ednsFlagDO is the DNSSEC OK bit in the OPT record's extended flags (RFC 3225 §3).
+	ednsFlagDO uint16 = 0x8000
+
+	// EDNSPayloadSize is the UDP payload size advertised in EDNS(0) queries. 1232
+	// bytes avoids IP fragmentation on virtually every path (DNS Flag Day 2020).
+	EDNSPayloadSize = 1232
+
+	// minPayloadSize is the UDP payload every client accepts: the limit without
+	// EDNS (RFC 1035 §4.2.1), and the floor for smaller advertised sizes (RFC
+	// 6891 §6.2.5).
+	minPayloadSize = 512
+)
+
+// AppendEDNS adds an EDNS(0) OPT pseudo-record (RFC 6891 §6.1) to the
+// additional section of an encoded query, advertising payloadSize as the
+// largest UDP response the sender accepts. With dnssecOK set, the DO bit asks
+// the server to include DNSSEC records in its answer.
+func AppendEDNS(msg []byte, payloadSize uint16, dnssecOK bool) ([]byte, error) {
+	if len(msg) < 12 {
+		return nil, errors.New("query too short")
+	}
+	arCount := binary.BigEndian.Uint16(msg[10:12])
+	if arCount == 0xFFFF {
+		return nil, errors.New("too many additional records")
+	}
+	var flags uint16
+	if dnssecOK {
+		flags = ednsFlagDO
+	}
+	out := append([]byte(nil), msg...)
+	binary.BigEndian.PutUint16(out[10:12], arCount+1)
+	out = appendOPT(out, payloadSize, flags)
+	return out, nil
+}
+
+// appendOPT writes an OPT pseudo-record with no options to b.
+func appendOPT(b []byte, payloadSize, flags uint16) []byte {
+	b = append(b, 0) // root owner name
+	b = binary.BigEndian.AppendUint16(b, uint16(domain.RRTypeOPT))
+	b = binary.BigEndian.AppendUint16(b, payloadSize) // CLASS carries the payload size
+	b = append(b, 0, 0)                               // extended RCODE and version 0
+	b = binary.BigEndian.AppendUint16(b, flags)
+	return binary.BigEndian.AppendUint16(b, 0) // no options
+}
+
+// skipOPT reports whether the record at offset is an OPT pseudo-record and, if
+// so, returns the offset just past it. OPT carries transport parameters rather
+// than data, so it never becomes a ResourceRecord.
+func skipOPT(data []byte, offset int) (int, bool) {
+	_, _, next, ok := readOPT(data, offset)
+	return next, ok
+}
+
+// readOPT reports whether the record at offset is an OPT pseudo-record and, if
+// so, returns its payload size, its extended flags and the offset just past it.
+func readOPT(data []byte, offset int) (uint16, uint16, int, bool) {
+	_, pos, err := decodeName(data, offset)
+	if err != nil || pos+10 > len(data) {
+		return 0, 0, 0, false
+	}
+	if domain.RRType(binary.BigEndian.Uint16(data[pos:pos+2])) != domain.RRTypeOPT {
+		return 0, 0, 0, false
+	}
+	end := pos + 10 + int(binary.BigEndian.Uint16(data[pos+8:pos+10]))
+	if end > len(data) {
+		return 0, 0, 0, false
+	}
+	return binary.BigEndian.Uint16(data[pos+2 : pos+4]), binary.BigEndian.Uint16(data[pos+6 : pos+8]), end, true
+}
+
+// queryEDNS returns the UDP payload size a query's OPT record advertises, at
+// least minPayloadSize, and whether its DO bit is set. A query without an OPT
+// record has size 0. The records after the question start at offset; count is
+// the total of the answer, authority and additional counts. Malformed trailing
+// records are ignored, so such a query is answered as if it had no EDNS.
+func queryEDNS(data []byte, offset, count int) (uint16, bool) {
+	for range count {
+		if size, flags, _, ok := readOPT(data, offset); ok {
+			return max(size, minPayloadSize), flags&ednsFlagDO != 0
+		}
+		_, pos, err := decodeName(data, offset)
+		if err != nil || pos+10 > len(data) {
+			return 0, false
+		}
+		offset = pos + 10 + int(binary.BigEndian.Uint16(data[pos+8:pos+10]))
+	}
+	return 0, false
+}
+
+// payloadLimit returns the size a UDP response to q must fit in: the client's
+// advertised payload size, capped at our own EDNSPayloadSize to avoid IP
+// fragmentation, or minPayloadSize without EDNS.
+func payloadLimit(q domain.Question) int {
+	if q.UDPSize < minPayloadSize {
+		return minPayloadSize
+	}
+	return int(min(q.UDPSize, EDNSPayloadSize))
+}
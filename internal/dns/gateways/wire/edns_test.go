@@ -0,0 +1,286 @@
+package wire
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/common/log"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+func TestAppendEDNS(t *testing.T) {
+	codec := NewUDPCodec(log.NewNoopLogger())
+	query, err := codec.EncodeQuery(domain.Question{ID: 7, Name: "example.com", Type: domain.RRTypeA, Class: domain.RRClassIN})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		dnssecOK  bool
+		wantFlags uint16
+	}{
+		{name: "with DO", dnssecOK: true, wantFlags: 0x8000},
+		{name: "without DO", dnssecOK: false, wantFlags: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := AppendEDNS(query, EDNSPayloadSize, tt.dnssecOK)
+			require.NoError(t, err)
+			require.Len(t, out, len(query)+11)
+			assert.Equal(t, uint16(1), binary.BigEndian.Uint16(out[10:12]), "ARCOUNT")
+			opt := out[len(query):]
+			assert.Equal(t, byte(0), opt[0], "root owner")
+			assert.Equal(t, uint16(domain.RRTypeOPT), binary.BigEndian.Uint16(opt[1:3]))
+			assert.Equal(t, uint16(EDNSPayloadSize), binary.BigEndian.Uint16(opt[3:5]))
+			assert.Equal(t, tt.wantFlags, binary.BigEndian.Uint16(opt[7:9]))
+			assert.Equal(t, uint16(0), binary.BigEndian.Uint16(opt[9:11]), "RDLENGTH")
+		})
+	}
+
+	assert.Equal(t, uint16(0), binary.BigEndian.Uint16(query[10:12]), "input must not be modified")
+
+	_, err = AppendEDNS(query[:5], EDNSPayloadSize, true)
+	assert.EqualError(t, err, "query too short")
+
+	full := append([]byte(nil), query...)
+	binary.BigEndian.PutUint16(full[10:12], 0xFFFF)
+	_, err = AppendEDNS(full, EDNSPayloadSize, true)
+	assert.EqualError(t, err, "too many additional records")
+}
+
+func TestUdpCodec_DecodeResponse_DNSSEC(t *testing.T) {
+	codec := NewUDPCodec(log.NewNoopLogger())
+	now := time.Now()
+
+	key, err := domain.NewAuthoritativeResourceRecord(".", domain.RRTypeDNSKEY, domain.RRClassIN, 3600,
+		[]byte{1, 1, 3, 15, 0xAA}, "257 3 15 qg==")
+	require.NoError(t, err)
+	require.Equal(t, domain.RootName, key.Name)
+
+	data, err := codec.EncodeResponse(domain.DNSResponse{
+		ID:            9,
+		RCode:         domain.NOERROR,
+		Question:      domain.Question{Name: ".", Type: domain.RRTypeDNSKEY, Class: domain.RRClassIN},
+		Answers:       []domain.ResourceRecord{key},
+		AuthenticData: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uint16(0x81A0), binary.BigEndian.Uint16(data[2:4]), "AD must be carried in the flags")
+
+	// a server echoes an OPT record back in the additional section
+	data, err = AppendEDNS(data, EDNSPayloadSize, true)
+	require.NoError(t, err)
+
+	resp, err := codec.DecodeResponse(data, 9, now)
+	require.NoError(t, err)
+	assert.True(t, resp.AuthenticData)
+	assert.Empty(t, resp.Additional, "OPT is not a resource record")
+	require.Len(t, resp.Answers, 1)
+	assert.Equal(t, domain.RootName, resp.Answers[0].Name)
+	assert.Equal(t, domain.RRTypeDNSKEY, resp.Answers[0].Type)
+	assert.Equal(t, "257 3 15 qg==", resp.Answers[0].Text)
+}
+
+func TestSkipOPT(t *testing.T) {
+	opt := []byte{0, 0x00, 0x29, 0x04, 0xD0, 0, 0, 0x80, 0, 0, 0}
+	next, ok := skipOPT(opt, 0)
+	assert.True(t, ok)
+	assert.Equal(t, len(opt), next)
+
+	notOPT := []byte{0, 0x00, 0x01, 0x00, 0x01, 0, 0, 0, 0, 0, 0}
+	_, ok = skipOPT(notOPT, 0)
+	assert.False(t, ok)
+
+	_, ok = skipOPT(opt[:6], 0)
+	assert.False(t, ok, "truncated header")
+
+	overrun := append([]byte(nil), opt...)
+	overrun[10] = 4
+	_, ok = skipOPT(overrun, 0)
+	assert.False(t, ok, "RDATA past the end")
+}
+
+func TestReadOPT(t *testing.T) {
+	opt := []byte{0, 0x00, 0x29, 0x04, 0xD0, 0, 0, 0x80, 0, 0, 0}
+	_, flags, next, ok := readOPT(opt, 0)
+	assert.True(t, ok)
+	assert.Equal(t, ednsFlagDO, flags)
+	assert.Equal(t, len(opt), next)
+}
+
+func TestUdpCodec_DecodeQuery_DNSSECOK(t *testing.T) {
+	codec := NewUDPCodec(log.NewNoopLogger())
+	query, err := codec.EncodeQuery(domain.Question{ID: 7, Name: "example.com", Type: domain.RRTypeA, Class: domain.RRClassIN})
+	require.NoError(t, err)
+	withDO, err := AppendEDNS(query, EDNSPayloadSize, true)
+	require.NoError(t, err)
+	withoutDO, err := AppendEDNS(query, EDNSPayloadSize, false)
+	require.NoError(t, err)
+
+	// an A record in the additional section ahead of the OPT
+	extra := append([]byte(nil), query...)
+	binary.BigEndian.PutUint16(extra[10:12], 1)
+	extra = append(extra, 0, 0, 1, 0, 1, 0, 0, 0, 0, 0, 4, 192, 0, 2, 1)
+	extra, err = AppendEDNS(extra, EDNSPayloadSize, true)
+	require.NoError(t, err)
+
+	truncated := append([]byte(nil), withDO[:len(withDO)-4]...)
+
+	small, err := AppendEDNS(query, 256, false)
+	require.NoError(t, err)
+	large, err := AppendEDNS(query, 4096, true)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		want     bool
+		wantSize uint16
+	}{
+		{name: "no EDNS", data: query, want: false, wantSize: 0},
+		{name: "EDNS with DO", data: withDO, want: true, wantSize: EDNSPayloadSize},
+		{name: "EDNS without DO", data: withoutDO, want: false, wantSize: EDNSPayloadSize},
+		{name: "OPT after another record", data: extra, want: true, wantSize: EDNSPayloadSize},
+		{name: "truncated OPT", data: truncated, want: false, wantSize: 0},
+		{name: "payload below 512", data: small, want: false, wantSize: 512},
+		{name: "large payload", data: large, want: true, wantSize: 4096},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := codec.DecodeQuery(tt.data)
+			require.NoError(t, err)
+			assert.Equal(t, "example.com", q.Name)
+			assert.Equal(t, tt.want, q.DNSSECOK)
+			assert.Equal(t, tt.wantSize, q.UDPSize)
+		})
+	}
+}
+
+func TestUdpCodec_EncodeResponse_DNSSECOK(t *testing.T) {
+	codec := NewUDPCodec(log.NewNoopLogger())
+	rr, err := domain.NewAuthoritativeResourceRecord("example.com", domain.RRTypeA, domain.RRClassIN, 300, []byte{192, 0, 2, 1}, "192.0.2.1")
+	require.NoError(t, err)
+	resp := domain.DNSResponse{
+		ID:       5,
+		RCode:    domain.NOERROR,
+		Question: domain.Question{Name: "example.com", Type: domain.RRTypeA, Class: domain.RRClassIN, DNSSECOK: true},
+		Answers:  []domain.ResourceRecord{rr},
+	}
+
+	data, err := codec.EncodeResponse(resp)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(1), binary.BigEndian.Uint16(data[10:12]), "ARCOUNT counts the OPT")
+	opt := data[len(data)-11:]
+	_, flags, next, ok := readOPT(opt, 0)
+	require.True(t, ok)
+	assert.Equal(t, ednsFlagDO, flags)
+	assert.Equal(t, len(opt), next)
+	assert.Equal(t, uint16(EDNSPayloadSize), binary.BigEndian.Uint16(opt[3:5]))
+
+	decoded, err := codec.DecodeResponse(data, 5, time.Now())
+	require.NoError(t, err)
+	assert.Len(t, decoded.Answers, 1)
+	assert.Empty(t, decoded.Additional)
+
+	resp.Question.DNSSECOK = false
+	plain, err := codec.EncodeResponse(resp)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(0), binary.BigEndian.Uint16(plain[10:12]))
+	assert.Len(t, plain, len(data)-11)
+}
+
+func TestUdpCodec_DecodeQuery_AuthenticData(t *testing.T) {
+	codec := NewUDPCodec(log.NewNoopLogger())
+	query, err := codec.EncodeQuery(domain.Question{ID: 7, Name: "example.com", Type: domain.RRTypeA, Class: domain.RRClassIN})
+	require.NoError(t, err)
+
+	q, err := codec.DecodeQuery(query)
+	require.NoError(t, err)
+	assert.False(t, q.AuthenticData)
+
+	binary.BigEndian.PutUint16(query[2:4], binary.BigEndian.Uint16(query[2:4])|flagAD)
+	q, err = codec.DecodeQuery(query)
+	require.NoError(t, err)
+	assert.True(t, q.AuthenticData, "AD in the query header")
+	assert.False(t, q.DNSSECOK)
+}
+
+func TestPayloadLimit(t *testing.T) {
+	assert.Equal(t, 512, payloadLimit(domain.Question{}), "no EDNS")
+	assert.Equal(t, 512, payloadLimit(domain.Question{DNSSECOK: true}), "DO without a size")
+	assert.Equal(t, 1000, payloadLimit(domain.Question{UDPSize: 1000}))
+	assert.Equal(t, EDNSPayloadSize, payloadLimit(domain.Question{UDPSize: 65535}), "capped at our own size")
+}
+
+func TestUdpCodec_EncodeResponse_Truncation(t *testing.T) {
+	codec := NewUDPCodec(log.NewNoopLogger())
+	record := func(name string, rrtype domain.RRType, data []byte) domain.ResourceRecord {
+		rr, err := domain.NewAuthoritativeResourceRecord(name, rrtype, domain.RRClassIN, 300, data, "")
+		require.NoError(t, err)
+		return rr
+	}
+	// five A records (16 bytes each, the owner compressed) and a signature
+	// that only fits a large EDNS payload
+	var answers []domain.ResourceRecord
+	for i := range 5 {
+		answers = append(answers, record("example.com", domain.RRTypeA, []byte{192, 0, 2, byte(i)}))
+	}
+	answers = append(answers, record("example.com", domain.RRTypeRRSIG, make([]byte, 800)))
+	glue := record("ns.example.com", domain.RRTypeA, []byte{192, 0, 2, 53})
+	question := domain.Question{Name: "example.com", Type: domain.RRTypeA, Class: domain.RRClassIN}
+
+	tests := []struct {
+		name       string
+		udpSize    uint16
+		dnssecOK   bool
+		additional []domain.ResourceRecord
+		wantTC     bool
+		wantAN     uint16
+		wantAR     uint16
+	}{
+		{name: "DO response over the client's size", udpSize: 512, dnssecOK: true, wantTC: true, wantAN: 5, wantAR: 1},
+		{name: "DO response within the client's size", udpSize: 4096, dnssecOK: true, wantTC: false, wantAN: 6, wantAR: 1},
+		{name: "no EDNS", wantTC: true, wantAN: 5, wantAR: 0},
+		{name: "additional records dropped alone", udpSize: 1000, additional: []domain.ResourceRecord{glue, answers[5]}, wantTC: false, wantAN: 6, wantAR: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := question
+			q.UDPSize, q.DNSSECOK = tt.udpSize, tt.dnssecOK
+			data, err := codec.EncodeResponse(domain.DNSResponse{ID: 3, Question: q, Answers: answers, Additional: tt.additional})
+			require.NoError(t, err)
+
+			assert.LessOrEqual(t, len(data), payloadLimit(q))
+			assert.Equal(t, tt.wantTC, binary.BigEndian.Uint16(data[2:4])&flagTC != 0, "TC")
+			assert.Equal(t, tt.wantAN, binary.BigEndian.Uint16(data[6:8]), "ANCOUNT")
+			assert.Equal(t, tt.wantAR, binary.BigEndian.Uint16(data[10:12]), "ARCOUNT")
+
+			resp, err := codec.DecodeResponse(data, 3, time.Now())
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantTC, resp.Truncated)
+			if !tt.wantTC {
+				assert.Len(t, resp.Answers, int(tt.wantAN))
+			}
+		})
+	}
+
+	// an RRset is never split, even when part of it would fit
+	var many []domain.ResourceRecord
+	for i := range 40 {
+		many = append(many, record("example.com", domain.RRTypeA, []byte{192, 0, 2, byte(i)}))
+	}
+	data, err := codec.EncodeResponse(domain.DNSResponse{ID: 3, Question: question, Answers: many})
+	require.NoError(t, err)
+	assert.NotZero(t, binary.BigEndian.Uint16(data[2:4])&flagTC)
+	assert.Equal(t, uint16(0), binary.BigEndian.Uint16(data[6:8]))
+
+	// over TCP the same answer goes out whole, whatever the UDP payload size
+	data, err = codec.EncodeStreamResponse(domain.DNSResponse{ID: 3, Question: question, Answers: append(many, answers...)})
+	require.NoError(t, err)
+	assert.Greater(t, len(data), EDNSPayloadSize)
+	assert.Zero(t, binary.BigEndian.Uint16(data[2:4])&flagTC)
+	assert.Equal(t, uint16(46), binary.BigEndian.Uint16(data[6:8]))
+}
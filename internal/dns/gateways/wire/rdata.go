@@ -0,0 +1,55 @@
+package wire
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// expandRData returns a copy of the RDATA at data[offset:offset+rdLen] with any
+// compressed domain names expanded in place. RFC 1035 §4.1.4 lets a server
+// compress the names inside NS, CNAME, SOA, PTR and MX records, which only make
+// sense relative to the whole message; expanding them keeps the stored RDATA
+// self-contained. Other types are copied verbatim.
+func expandRData(data []byte, offset, rdLen int, rrtype domain.RRType) ([]byte, error) {
+	end := offset + rdLen
+	var fixed int // bytes of fixed-length fields before the first name
+	var names int // number of consecutive names
+	var trailer int
+	switch rrtype {
+	case domain.RRTypeNS, domain.RRTypeCNAME, domain.RRTypePTR:
+		names = 1
+	case domain.RRTypeMX:
+		fixed, names = 2, 1
+	case domain.RRTypeSRV:
+		// RFC 2782 forbids compression here, but some servers do it anyway.
+		fixed, names = 6, 1
+	case domain.RRTypeSOA:
+		names, trailer = 2, 20
+	default:
+		return append([]byte(nil), data[offset:end]...), nil
+	}
+
+	if offset+fixed > end {
+		return nil, errors.New("truncated rdata")
+	}
+	out := append([]byte(nil), data[offset:offset+fixed]...)
+	pos := offset + fixed
+	for range names {
+		name, next, err := decodeName(data[:end], pos)
+		if err != nil {
+			return nil, fmt.Errorf("rdata name: %w", err)
+		}
+		encoded, err := encodeDomainName(name)
+		if err != nil {
+			return nil, fmt.Errorf("rdata name: %w", err)
+		}
+		out = append(out, encoded...)
+		pos = next
+	}
+	if pos+trailer != end {
+		return nil, errors.New("rdata length mismatch")
+	}
+	return append(out, data[pos:end]...), nil
+}
@@ -0,0 +1,126 @@
+package wire
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/common/log"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+func TestExpandRData(t *testing.T) {
+	// message prefix holding "example.com" at offset 0 for pointers to refer to
+	msg := []byte{7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0}
+	exampleCom := append([]byte(nil), msg...)
+	wwwExampleCom := append([]byte{3, 'w', 'w', 'w'}, exampleCom...)
+	soaTail := make([]byte, 20)
+	for i := range soaTail {
+		soaTail[i] = byte(i)
+	}
+
+	tests := []struct {
+		name    string
+		rrtype  domain.RRType
+		rdata   []byte
+		want    []byte
+		wantErr string
+	}{
+		{
+			name:   "cname with pointer",
+			rrtype: domain.RRTypeCNAME,
+			rdata:  []byte{3, 'w', 'w', 'w', 0xC0, 0x00},
+			want:   wwwExampleCom,
+		},
+		{
+			name:   "ns fully compressed",
+			rrtype: domain.RRTypeNS,
+			rdata:  []byte{0xC0, 0x00},
+			want:   exampleCom,
+		},
+		{
+			name:   "mx keeps preference",
+			rrtype: domain.RRTypeMX,
+			rdata:  []byte{0, 10, 0xC0, 0x00},
+			want:   append([]byte{0, 10}, exampleCom...),
+		},
+		{
+			name:   "soa expands both names and keeps counters",
+			rrtype: domain.RRTypeSOA,
+			rdata:  append([]byte{0xC0, 0x00, 3, 'w', 'w', 'w', 0xC0, 0x00}, soaTail...),
+			want:   append(append(append([]byte(nil), exampleCom...), wwwExampleCom...), soaTail...),
+		},
+		{
+			name:   "other types copied verbatim",
+			rrtype: domain.RRTypeA,
+			rdata:  []byte{192, 0, 2, 1},
+			want:   []byte{192, 0, 2, 1},
+		},
+		{
+			name:    "name overruns rdata",
+			rrtype:  domain.RRTypeCNAME,
+			rdata:   []byte{3, 'w', 'w'},
+			wantErr: "rdata name",
+		},
+		{
+			name:    "trailing bytes after name",
+			rrtype:  domain.RRTypePTR,
+			rdata:   []byte{0xC0, 0x00, 0xFF},
+			wantErr: "rdata length mismatch",
+		},
+		{
+			name:    "truncated mx preference",
+			rrtype:  domain.RRTypeMX,
+			rdata:   []byte{0},
+			wantErr: "truncated rdata",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := append(append([]byte(nil), msg...), tt.rdata...)
+			got, err := expandRData(data, len(msg), len(tt.rdata), tt.rrtype)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestUdpCodec_DecodeResponse_CompressedCNAME(t *testing.T) {
+	codec := NewUDPCodec(log.NewNoopLogger())
+	now := time.Date(2099, 8, 1, 12, 0, 0, 0, time.UTC)
+
+	data := make([]byte, 0, 128)
+	data = binary.BigEndian.AppendUint16(data, 4242)
+	data = binary.BigEndian.AppendUint16(data, 0x8180)
+	data = binary.BigEndian.AppendUint16(data, 1) // QDCOUNT
+	data = binary.BigEndian.AppendUint16(data, 1) // ANCOUNT
+	data = binary.BigEndian.AppendUint16(data, 0)
+	data = binary.BigEndian.AppendUint16(data, 0)
+	// Question: www.example.com CNAME IN, name at offset 12
+	data = append(data, 3, 'w', 'w', 'w', 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0)
+	data = binary.BigEndian.AppendUint16(data, uint16(domain.RRTypeCNAME))
+	data = binary.BigEndian.AppendUint16(data, 1)
+	// Answer: www.example.com CNAME cdn.example.com, both compressed
+	data = append(data, 0xC0, 12)
+	data = binary.BigEndian.AppendUint16(data, uint16(domain.RRTypeCNAME))
+	data = binary.BigEndian.AppendUint16(data, 1)
+	data = binary.BigEndian.AppendUint32(data, 300)
+	data = binary.BigEndian.AppendUint16(data, 6)
+	data = append(data, 3, 'c', 'd', 'n', 0xC0, 16) // "cdn" + pointer to example.com
+
+	resp, err := codec.DecodeResponse(data, 4242, now)
+	require.NoError(t, err)
+	assert.Equal(t, "www.example.com", resp.Question.Name)
+	assert.Equal(t, domain.RRTypeCNAME, resp.Question.Type)
+	require.Len(t, resp.Answers, 1)
+	assert.Equal(t, "www.example.com", resp.Answers[0].Name)
+	assert.Equal(t, "cdn.example.com", resp.Answers[0].Text)
+}
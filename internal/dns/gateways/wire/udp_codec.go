@@ -10,21 +10,37 @@ import (
 	"strings"
 	"time"
 
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
 	"github.com/haukened/rr-dns/internal/dns/common/log"
 	"github.com/haukened/rr-dns/internal/dns/common/rrdata"
 	"github.com/haukened/rr-dns/internal/dns/domain"
 )
 
+// flagTC is the truncation bit in the DNS header flags (RFC 1035 §4.1.1).
+const flagTC uint16 = 0x0200
+
+// maxMessageSize is the largest message the two-byte length prefix of a TCP
+// stream can frame (RFC 1035 §4.2.2).
+const maxMessageSize = 65535
+
 // udpCodec implements the DNSCodec interface for standard DNS over UDP messages.
 type udpCodec struct {
 	logger log.Logger
+	clock  clock.Clock // Time source for the remaining TTLs of encoded records
 }
 
 // NewUDPCodec creates and returns a new instance of udpCodec using the provided logger.
 // The logger is used for logging within the codec.
 func NewUDPCodec(logger log.Logger) *udpCodec {
+	return NewUDPCodecWithClock(logger, &clock.RealClock{})
+}
+
+// NewUDPCodecWithClock creates a udpCodec that encodes the remaining TTLs of
+// cached records as of the time clk reports.
+func NewUDPCodecWithClock(logger log.Logger, clk clock.Clock) *udpCodec {
 	return &udpCodec{
 		logger: logger,
+		clock:  clk,
 	}
 }
 
@@ -60,8 +76,10 @@ func (c *udpCodec) EncodeQuery(q domain.Question) ([]byte, error) {
 }
 
 // decodeName decodes a domain name from a DNS message at the specified offset,
-// handling label compression as defined in RFC 1035.
+// handling label compression as defined in RFC 1035. Compression pointers must
+// point strictly backwards, which rules out pointer loops in hostile messages.
 func decodeName(data []byte, offset int) (string, int, error) {
+	start := offset
 	var labels []string
 	for {
 		if offset >= len(data) {
@@ -77,6 +95,9 @@ func decodeName(data []byte, offset int) (string, int, error) {
 				return "", 0, errors.New("compression pointer out of bounds")
 			}
 			ptr := int(binary.BigEndian.Uint16(data[offset:offset+2]) & 0x3FFF)
+			if ptr >= start {
+				return "", 0, errors.New("compression pointer loop")
+			}
 			suffix, _, err := decodeName(data, ptr)
 			if err != nil {
 				return "", 0, err
@@ -96,8 +117,10 @@ func decodeName(data []byte, offset int) (string, int, error) {
 }
 
 // encodeDomainName encodes a domain name into DNS wire format without compression.
+// A trailing root dot is optional.
 func encodeDomainName(name string) ([]byte, error) {
 	var buf bytes.Buffer
+	name = strings.TrimSuffix(name, ".")
 	if name == "" {
 		buf.WriteByte(0)
 		return buf.Bytes(), nil
@@ -120,103 +143,153 @@ func (c *udpCodec) DecodeQuery(data []byte) (domain.Question, error) {
 		return domain.Question{}, errors.New("query too short")
 	}
 	id := binary.BigEndian.Uint16(data[0:2])
+	flags := binary.BigEndian.Uint16(data[2:4])
 	qdCount := binary.BigEndian.Uint16(data[4:6])
 	if qdCount != 1 {
 		return domain.Question{}, errors.New("expected exactly one question")
 	}
-	name, qtype, qclass, _, err := decodeQuestion(data, 12)
+	name, qtype, qclass, offset, err := decodeQuestion(data, 12)
 	if err != nil {
 		return domain.Question{}, err
 	}
+	records := int(binary.BigEndian.Uint16(data[6:8])) + int(binary.BigEndian.Uint16(data[8:10])) + int(binary.BigEndian.Uint16(data[10:12]))
+	udpSize, dnssecOK := queryEDNS(data, offset, records)
 	return domain.Question{
-		ID:    id,
-		Name:  name,
-		Type:  domain.RRType(qtype),
-		Class: domain.RRClass(qclass),
+		ID:            id,
+		Name:          name,
+		Type:          domain.RRType(qtype),
+		Class:         domain.RRClass(qclass),
+		DNSSECOK:      dnssecOK,
+		UDPSize:       udpSize,
+		AuthenticData: flags&flagAD != 0,
 	}, nil
 }
 
 // EncodeResponse serializes a DNSResponse into a binary format suitable for sending via UDP.
+// The RCODE is carried in the header flags, and the answer, authority and additional
+// sections are written in order. When the question had EDNS(0), an OPT record
+// echoing its DO bit closes the additional section (RFC 3225 §3, RFC 6891 §7).
+//
+// The message is cut to fit the payload size the client accepts (see
+// payloadLimit), dropping whole RRsets from the end. The TC bit is set when an
+// answer or authority RRset had to go, telling the client to retry over TCP;
+// losing additional records alone does not set it (RFC 2181 §9).
 func (c *udpCodec) EncodeResponse(resp domain.DNSResponse) ([]byte, error) {
-	var buf bytes.Buffer
+	return c.encodeResponse(resp, payloadLimit(resp.Question))
+}
 
-	_ = binary.Write(&buf, binary.BigEndian, resp.ID)
-	_ = binary.Write(&buf, binary.BigEndian, uint16(0x8180)) // Flags: standard response, RA=1
-	_ = binary.Write(&buf, binary.BigEndian, uint16(1))      // QDCOUNT
+// EncodeStreamResponse serializes a DNSResponse like EncodeResponse, but for a
+// TCP stream: the message only has to fit maxMessageSize, whatever payload
+// size the client advertised for UDP (RFC 7766 §8).
+func (c *udpCodec) EncodeStreamResponse(resp domain.DNSResponse) ([]byte, error) {
+	return c.encodeResponse(resp, maxMessageSize)
+}
 
-	// Safely convert slice length to uint16 with bounds check
-	answerCount := len(resp.Answers)
-	if answerCount > 65535 {
-		return nil, fmt.Errorf("too many answer records: %d (max 65535)", answerCount)
+// encodeResponse writes resp, dropping RRsets that do not fit in limit bytes.
+func (c *udpCodec) encodeResponse(resp domain.DNSResponse, limit int) ([]byte, error) {
+	sections := [][]domain.ResourceRecord{resp.Answers, resp.Authority, resp.Additional}
+	for i, records := range sections {
+		if len(records) > 65535 {
+			return nil, fmt.Errorf("too many %s records: %d (max 65535)", sectionNames[i], len(records))
+		}
 	}
-	_ = binary.Write(&buf, binary.BigEndian, uint16(answerCount))
-
-	_ = binary.Write(&buf, binary.BigEndian, uint16(0)) // NSCOUNT
-	_ = binary.Write(&buf, binary.BigEndian, uint16(0)) // ARCOUNT
 
-	c.logger.Debug(map[string]any{
-		"step": "header_written",
-		"id":   resp.ID,
-		"qd":   1,
-		"an":   answerCount,
-	}, "Wrote DNS response header")
-
-	// Write the question section based on resp.Question (per RFC)
+	// The question section, based on resp.Question (per RFC)
 	qname, err := encodeDomainName(resp.Question.Name)
 	if err != nil {
 		return nil, err
 	}
-	buf.Write(qname)
-	_ = binary.Write(&buf, binary.BigEndian, uint16(resp.Question.Type))
-	_ = binary.Write(&buf, binary.BigEndian, uint16(resp.Question.Class))
-	qnameOffset := 12 // QNAME always starts right after the 12-byte header
+	question := binary.BigEndian.AppendUint16(qname, uint16(resp.Question.Type))
+	question = binary.BigEndian.AppendUint16(question, uint16(resp.Question.Class))
 
-	c.logger.Debug(map[string]any{
-		"step":  "question_written",
-		"name":  resp.Question.Name,
-		"type":  resp.Question.Type.String(),
-		"class": resp.Question.Class.String(),
-	}, "Wrote question section")
-
-	// Answers
-	for _, rr := range resp.Answers {
-		// Use name compression (pointer to offset where QNAME begins) when the answer name matches the original QNAME.
-		// This reduces packet size and avoids duplicate encoding.
-		if rr.Name == resp.Answers[0].Name {
-			// Use name compression: pointer to the QNAME we just wrote.
-			// This reduces packet size and avoids repeating the domain name.
-			// Format: 0b11xxxxxx xxxxxxxx (pointer to offset in message)
-			buf.Write([]byte{0xC0 | byte(qnameOffset>>8), byte(qnameOffset & 0xFF)})
-		} else {
-			name, err := encodeDomainName(rr.Name)
-			if err != nil {
-				return nil, err
-			}
-			buf.Write(name)
+	var opt []byte
+	if resp.Question.DNSSECOK || resp.Question.UDPSize > 0 {
+		if len(resp.Additional) == 65535 {
+			return nil, fmt.Errorf("too many additional records: no room for OPT")
 		}
-		_ = binary.Write(&buf, binary.BigEndian, uint16(rr.Type))
-		_ = binary.Write(&buf, binary.BigEndian, uint16(rr.Class))
-		_ = binary.Write(&buf, binary.BigEndian, uint32(rr.TTLRemaining().Seconds()))
-
-		// Safely convert data length to uint16 with bounds check
-		dataLen := len(rr.Data)
-		if dataLen > 65535 {
-			return nil, fmt.Errorf("resource record data too large: %d bytes (max 65535)", dataLen)
+		var optFlags uint16
+		if resp.Question.DNSSECOK {
+			optFlags = ednsFlagDO
 		}
-		_ = binary.Write(&buf, binary.BigEndian, uint16(dataLen))
+		opt = appendOPT(nil, EDNSPayloadSize, optFlags)
+	}
 
-		buf.Write(rr.Data)
+	var body bytes.Buffer
+	counts := make([]uint16, len(sections))
+	space := limit - 12 - len(question) - len(opt)
+	truncated := resp.Truncated
+	now := c.clock.Now()
+sections:
+	for i, records := range sections {
+		for start := 0; start < len(records); {
+			end := rrsetEnd(records, start)
+			var rrset bytes.Buffer
+			for _, rr := range records[start:end] {
+				if err := writeRecord(&rrset, rr, resp.Question.Name, now); err != nil {
+					return nil, err
+				}
+			}
+			if rrset.Len() > space {
+				truncated = truncated || i < 2
+				c.logger.Debug(map[string]any{
+					"step":    "truncated",
+					"section": sectionNames[i],
+					"name":    records[start].Name,
+					"type":    records[start].Type.String(),
+					"limit":   limit,
+				}, "Dropped records beyond the client's payload size")
+				break sections
+			}
+			space -= rrset.Len()
+			body.Write(rrset.Bytes())
+			counts[i] += uint16(end - start)
+			for _, rr := range records[start:end] {
+				c.logger.Debug(map[string]any{
+					"step":    "record_written",
+					"section": sectionNames[i],
+					"name":    rr.Name,
+					"type":    rr.Type.String(),
+					"class":   rr.Class.String(),
+					"ttl":     rr.TTLRemaining(now).Seconds(),
+					"dlen":    len(rr.Data),
+				}, "Wrote resource record")
+			}
+			start = end
+		}
+	}
+	if opt != nil {
+		counts[2]++
+	}
 
-		c.logger.Debug(map[string]any{
-			"step":  "answer_written",
-			"name":  rr.Name,
-			"type":  rr.Type.String(),
-			"class": rr.Class.String(),
-			"ttl":   rr.TTLRemaining().Seconds(),
-			"dlen":  len(rr.Data),
-		}, "Wrote answer record")
+	flags := uint16(0x8180) | uint16(resp.RCode)&0x000F // standard response, RA=1, RCODE
+	if resp.AuthenticData {
+		flags |= flagAD
+	}
+	if truncated {
+		flags |= flagTC
+	}
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.BigEndian, resp.ID)
+	_ = binary.Write(&buf, binary.BigEndian, flags)
+	_ = binary.Write(&buf, binary.BigEndian, uint16(1)) // QDCOUNT
+	for _, count := range counts {
+		_ = binary.Write(&buf, binary.BigEndian, count) // ANCOUNT, NSCOUNT, ARCOUNT
 	}
 
+	c.logger.Debug(map[string]any{
+		"step": "header_written",
+		"id":   resp.ID,
+		"qd":   1,
+		"an":   counts[0],
+		"ns":   counts[1],
+		"ar":   counts[2],
+		"tc":   truncated,
+	}, "Wrote DNS response header")
+
+	buf.Write(question)
+	buf.Write(body.Bytes())
+	buf.Write(opt)
+
 	c.logger.Debug(map[string]any{
 		"step": "final_packet",
 		"size": buf.Len(),
@@ -226,8 +299,58 @@ func (c *udpCodec) EncodeResponse(resp domain.DNSResponse) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// rrsetEnd returns the index just past the RRset that starts at records[start]:
+// the run of records sharing its owner name, type and class.
+func rrsetEnd(records []domain.ResourceRecord, start int) int {
+	first := records[start]
+	end := start + 1
+	for end < len(records) {
+		rr := records[end]
+		if rr.Type != first.Type || rr.Class != first.Class || !strings.EqualFold(rr.Name, first.Name) {
+			break
+		}
+		end++
+	}
+	return end
+}
+
+// sectionNames labels the answer, authority and additional sections for errors and logs.
+var sectionNames = [...]string{"answer", "authority", "additional"}
+
+// writeRecord appends a single resource record to buf, with its TTL as
+// remaining at now. Owner names equal to the question name are compressed to
+// a pointer at the QNAME, which always starts right after the 12-byte header
+// (RFC 1035 §4.1.4).
+func writeRecord(buf *bytes.Buffer, rr domain.ResourceRecord, qname string, now time.Time) error {
+	const qnameOffset = 12
+	if strings.EqualFold(strings.TrimSuffix(rr.Name, "."), strings.TrimSuffix(qname, ".")) {
+		// Format: 0b11xxxxxx xxxxxxxx (pointer to offset in message)
+		buf.Write([]byte{0xC0 | byte(qnameOffset>>8), byte(qnameOffset & 0xFF)})
+	} else {
+		name, err := encodeDomainName(rr.Name)
+		if err != nil {
+			return err
+		}
+		buf.Write(name)
+	}
+	_ = binary.Write(buf, binary.BigEndian, uint16(rr.Type))
+	_ = binary.Write(buf, binary.BigEndian, uint16(rr.Class))
+	_ = binary.Write(buf, binary.BigEndian, uint32(rr.TTLRemaining(now).Seconds()))
+
+	// Safely convert data length to uint16 with bounds check
+	dataLen := len(rr.Data)
+	if dataLen > 65535 {
+		return fmt.Errorf("resource record data too large: %d bytes (max 65535)", dataLen)
+	}
+	_ = binary.Write(buf, binary.BigEndian, uint16(dataLen))
+	buf.Write(rr.Data)
+	return nil
+}
+
 // DecodeResponse parses a raw DNS response from a UDP packet into a DNSResponse,
-// validating the response ID and extracting resource records.
+// validating the response ID and extracting resource records. The first entry of
+// the question section is echoed in DNSResponse.Question so callers can verify
+// that the answer belongs to the question they asked.
 func (c *udpCodec) DecodeResponse(data []byte, expectedID uint16, now time.Time) (domain.DNSResponse, error) {
 	if len(data) < 12 {
 		return domain.DNSResponse{}, errors.New("response too short")
@@ -242,26 +365,37 @@ func (c *udpCodec) DecodeResponse(data []byte, expectedID uint16, now time.Time)
 	//gosec:disable G115 -- uint16 & 0x000F always results in a uint8 value, so this is safe.
 	rcode := domain.RCode(uint8(flags & 0x000F))
 
+	// A truncated message may end mid-record, so there is nothing trustworthy
+	// to parse. Surface the TC flag and let the caller retry over TCP.
+	if flags&flagTC != 0 {
+		return domain.DNSResponse{
+			ID:        id,
+			RCode:     rcode,
+			Truncated: true,
+		}, nil
+	}
+
 	qdCount := binary.BigEndian.Uint16(data[4:6])
 	anCount := binary.BigEndian.Uint16(data[6:8])
 	nsCount := binary.BigEndian.Uint16(data[8:10])
 	arCount := binary.BigEndian.Uint16(data[10:12])
 
 	offset := 12
-	// Skip questions
+	var question domain.Question
 	for i := 0; i < int(qdCount); i++ {
-		for {
-			if offset >= len(data) {
-				return domain.DNSResponse{}, errors.New("truncated question name")
-			}
-			l := int(data[offset])
-			offset++
-			if l == 0 {
-				break
+		name, qtype, qclass, newOffset, err := decodeQuestion(data, offset)
+		if err != nil {
+			return domain.DNSResponse{}, fmt.Errorf("truncated question name: %w", err)
+		}
+		if i == 0 {
+			question = domain.Question{
+				ID:    id,
+				Name:  name,
+				Type:  domain.RRType(qtype),
+				Class: domain.RRClass(qclass),
 			}
-			offset += l
 		}
-		offset += 4 // QTYPE + QCLASS
+		offset = newOffset
 	}
 
 	// Parse answers
@@ -286,9 +420,13 @@ func (c *udpCodec) DecodeResponse(data []byte, expectedID uint16, now time.Time)
 		offset = newOffset
 	}
 
-	// Parse additional records
+	// Parse additional records, leaving out the EDNS(0) OPT pseudo-record
 	additional := []domain.ResourceRecord{}
 	for i := 0; i < int(arCount); i++ {
+		if next, ok := skipOPT(data, offset); ok {
+			offset = next
+			continue
+		}
 		rr, newOffset, err := c.parseResourceRecord(data, offset, now)
 		if err != nil {
 			return domain.DNSResponse{}, fmt.Errorf("failed to parse additional record %d: %w", i, err)
@@ -298,11 +436,13 @@ func (c *udpCodec) DecodeResponse(data []byte, expectedID uint16, now time.Time)
 	}
 
 	return domain.DNSResponse{
-		ID:         id,
-		RCode:      rcode,
-		Answers:    answers,
-		Authority:  authority,
-		Additional: additional,
+		ID:            id,
+		RCode:         rcode,
+		Question:      question,
+		Answers:       answers,
+		Authority:     authority,
+		Additional:    additional,
+		AuthenticData: flags&flagAD != 0,
 	}, nil
 }
 
@@ -316,6 +456,9 @@ func (c *udpCodec) parseResourceRecord(data []byte, offset int, now time.Time) (
 	if err != nil {
 		return domain.ResourceRecord{}, 0, fmt.Errorf("failed to decode record name: %w", err)
 	}
+	if name == "" {
+		name = domain.RootName
+	}
 	offset = newOffset
 
 	if offset+10 > len(data) {
@@ -334,11 +477,13 @@ func (c *udpCodec) parseResourceRecord(data []byte, offset int, now time.Time) (
 	if offset+int(rdLen) > len(data) {
 		return domain.ResourceRecord{}, 0, errors.New("truncated rdata")
 	}
-	rdata := make([]byte, rdLen)
-	copy(rdata, data[offset:offset+int(rdLen)])
+	rrtype := domain.RRType(typ)
+	rdata, err := expandRData(data, offset, int(rdLen), rrtype)
+	if err != nil {
+		return domain.ResourceRecord{}, 0, fmt.Errorf("failed to decode rdata: %w", err)
+	}
 	offset += int(rdLen)
 
-	rrtype := domain.RRType(typ)
 	rrclass := domain.RRClass(class)
 	text, err := rrdata.Decode(rrtype, rdata)
 	if err != nil {
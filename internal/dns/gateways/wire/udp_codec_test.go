@@ -6,7 +6,9 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
 	"github.com/haukened/rr-dns/internal/dns/common/log"
 	"github.com/haukened/rr-dns/internal/dns/domain"
 )
@@ -14,6 +16,7 @@ import (
 func TestUdpCodec_EncodeQuery(t *testing.T) {
 	codec := &udpCodec{
 		logger: log.NewNoopLogger(),
+		clock:  &clock.RealClock{},
 	}
 
 	tests := []struct {
@@ -115,6 +118,7 @@ func TestUdpCodec_EncodeQuery(t *testing.T) {
 func TestUdpCodec_DecodeQuery(t *testing.T) {
 	codec := &udpCodec{
 		logger: log.NewNoopLogger(),
+		clock:  &clock.RealClock{},
 	}
 
 	tests := []struct {
@@ -210,6 +214,7 @@ func TestUdpCodec_DecodeQuery(t *testing.T) {
 func TestUdpCodec_EncodeResponse(t *testing.T) {
 	codec := &udpCodec{
 		logger: log.NewNoopLogger(),
+		clock:  &clock.RealClock{},
 	}
 
 	// Create a test resource record
@@ -429,6 +434,7 @@ func TestUdpCodec_EncodeResponse(t *testing.T) {
 func TestUdpCodec_DecodeResponse(t *testing.T) {
 	codec := &udpCodec{
 		logger: log.NewNoopLogger(),
+		clock:  &clock.RealClock{},
 	}
 	timeFixture := time.Date(2099, 8, 1, 12, 0, 0, 0, time.UTC)
 
@@ -478,7 +484,8 @@ func TestUdpCodec_DecodeResponse(t *testing.T) {
 			}(),
 			expectedID: 12345,
 			checkResp: func(resp domain.DNSResponse) bool {
-				return resp.ID == 12345 && len(resp.Answers) == 1 &&
+				return resp.ID == 12345 && len(resp.Answers) == 1 && !resp.Truncated &&
+					resp.Question.Name == "example.com" && resp.Question.Type == 1 && resp.Question.Class == 1 &&
 					resp.Answers[0].Name == "example.com" &&
 					resp.Answers[0].Type == 1
 			},
@@ -624,6 +631,31 @@ func TestUdpCodec_DecodeResponse(t *testing.T) {
 			expectedID: 12345,
 			wantErr:    "invalid resource record",
 		},
+		{
+			name: "truncated flag skips record parsing",
+			data: func() []byte {
+				data := make([]byte, 0, 512)
+				data = binary.BigEndian.AppendUint16(data, 12345)  // ID
+				data = binary.BigEndian.AppendUint16(data, 0x8380) // Flags: response, TC=1
+				data = binary.BigEndian.AppendUint16(data, 1)      // QDCOUNT
+				data = binary.BigEndian.AppendUint16(data, 3)      // ANCOUNT (records cut off)
+				data = binary.BigEndian.AppendUint16(data, 0)      // NSCOUNT
+				data = binary.BigEndian.AppendUint16(data, 0)      // ARCOUNT
+				data = append(data, 7)
+				data = append(data, []byte("example")...)
+				data = append(data, 3)
+				data = append(data, []byte("com")...)
+				data = append(data, 0)
+				data = binary.BigEndian.AppendUint16(data, 16) // QTYPE = TXT
+				data = binary.BigEndian.AppendUint16(data, 1)  // QCLASS = IN
+				data = append(data, 0xC0, 0x0C)                // start of an answer that never finishes
+				return data
+			}(),
+			expectedID: 12345,
+			checkResp: func(resp domain.DNSResponse) bool {
+				return resp.Truncated && resp.ID == 12345 && len(resp.Answers) == 0
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -646,6 +678,7 @@ func TestUdpCodec_DecodeResponse(t *testing.T) {
 func TestUdpCodec_DecodeResponse_AuthorityRecords(t *testing.T) {
 	codec := &udpCodec{
 		logger: log.NewNoopLogger(),
+		clock:  &clock.RealClock{},
 	}
 	timeFixture := time.Unix(1234567890, 0)
 
@@ -830,6 +863,7 @@ func TestUdpCodec_DecodeResponse_AuthorityRecords(t *testing.T) {
 func TestUdpCodec_DecodeResponse_AdditionalRecords(t *testing.T) {
 	codec := &udpCodec{
 		logger: log.NewNoopLogger(),
+		clock:  &clock.RealClock{},
 	}
 	timeFixture := time.Unix(1234567890, 0)
 
@@ -1084,6 +1118,18 @@ func TestDecodeName(t *testing.T) {
 			offset:  0,
 			wantErr: "compression pointer out of bounds",
 		},
+		{
+			name:    "compression pointer loop",
+			data:    []byte{3, 'w', 'w', 'w', 0xC0, 0x00}, // pointer back to its own name
+			offset:  0,
+			wantErr: "compression pointer loop",
+		},
+		{
+			name:    "forward compression pointer",
+			data:    []byte{0xC0, 0x02, 0},
+			offset:  0,
+			wantErr: "compression pointer loop",
+		},
 		{
 			name: "compression pointer to invalid data",
 			data: func() []byte {
@@ -1142,6 +1188,20 @@ func TestEncodeDomainName(t *testing.T) {
 				return len(data) == len(expected) && string(data) == string(expected)
 			},
 		},
+		{
+			name:   "trailing dot",
+			domain: "example.com.",
+			checkBytes: func(data []byte) bool {
+				return string(data) == "\x07example\x03com\x00"
+			},
+		},
+		{
+			name:   "root",
+			domain: ".",
+			checkBytes: func(data []byte) bool {
+				return len(data) == 1 && data[0] == 0
+			},
+		},
 		{
 			name:   "empty domain",
 			domain: "",
@@ -1198,4 +1258,76 @@ func TestNewUDPCodec(t *testing.T) {
 		assert.NotSame(t, codec1, codec2)
 		assert.NotSame(t, codec1.logger, codec2.logger)
 	})
+
+	t.Run("uses the system clock", func(t *testing.T) {
+		codec := NewUDPCodec(log.NewNoopLogger())
+		assert.IsType(t, &clock.RealClock{}, codec.clock)
+	})
+}
+
+func TestUdpCodec_EncodeResponse_RemainingTTL(t *testing.T) {
+	created := time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC)
+	clk := &clock.MockClock{CurrentTime: created}
+	codec := NewUDPCodecWithClock(log.NewNoopLogger(), clk)
+
+	rr, err := domain.NewCachedResourceRecord("example.com.", domain.RRTypeA, domain.RRClassIN, 300, []byte{192, 0, 2, 1}, "192.0.2.1", created)
+	require.NoError(t, err)
+	response := domain.DNSResponse{
+		ID:       1,
+		Question: domain.Question{Name: "example.com.", Type: domain.RRTypeA, Class: domain.RRClassIN},
+		Answers:  []domain.ResourceRecord{rr},
+	}
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		wantTTL uint32
+	}{
+		{name: "fresh", advance: 0, wantTTL: 300},
+		{name: "after 2 minutes", advance: 2 * time.Minute, wantTTL: 180},
+		{name: "expired", advance: 5 * time.Minute, wantTTL: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk.CurrentTime = created.Add(tt.advance)
+			data, err := codec.EncodeResponse(response)
+			require.NoError(t, err)
+			// The answer follows the 12-byte header and the question (name + type + class),
+			// starting with a compressed owner name, type and class before its TTL.
+			ttlOffset := 12 + len("\x07example\x03com\x00") + 4 + 2 + 4
+			assert.Equal(t, tt.wantTTL, binary.BigEndian.Uint32(data[ttlOffset:ttlOffset+4]))
+		})
+	}
+}
+
+func TestUdpCodec_EncodeResponse_AllSections(t *testing.T) {
+	codec := NewUDPCodec(log.NewNoopLogger())
+	now := time.Date(2099, 8, 1, 12, 0, 0, 0, time.UTC)
+
+	ns, err := domain.NewAuthoritativeResourceRecord("example.com", domain.RRTypeNS, domain.RRClassIN, 3600,
+		[]byte("\x03ns1\x07example\x03com\x00"), "ns1.example.com")
+	require.NoError(t, err)
+	glue, err := domain.NewAuthoritativeResourceRecord("ns1.example.com", domain.RRTypeA, domain.RRClassIN, 3600,
+		[]byte{192, 0, 2, 53}, "192.0.2.53")
+	require.NoError(t, err)
+
+	data, err := codec.EncodeResponse(domain.DNSResponse{
+		ID:         77,
+		RCode:      domain.NXDOMAIN,
+		Question:   domain.Question{Name: "missing.example.com.", Type: domain.RRTypeA, Class: domain.RRClassIN},
+		Authority:  []domain.ResourceRecord{ns},
+		Additional: []domain.ResourceRecord{glue},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uint16(0x8183), binary.BigEndian.Uint16(data[2:4]), "RCODE must be carried in the flags")
+
+	resp, err := codec.DecodeResponse(data, 77, now)
+	require.NoError(t, err)
+	assert.Equal(t, domain.NXDOMAIN, resp.RCode)
+	assert.Equal(t, "missing.example.com", resp.Question.Name)
+	assert.Empty(t, resp.Answers)
+	require.Len(t, resp.Authority, 1)
+	assert.Equal(t, "ns1.example.com", resp.Authority[0].Text)
+	require.Len(t, resp.Additional, 1)
+	assert.Equal(t, "192.0.2.53", resp.Additional[0].Text)
 }
@@ -2,8 +2,12 @@ package dnscache
 
 import (
 	"errors"
+	"slices"
+	"sync"
+	"time"
 
 	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
 	"github.com/haukened/rr-dns/internal/dns/domain"
 	"github.com/haukened/rr-dns/internal/dns/services/resolver"
 )
@@ -15,17 +19,96 @@ var (
 // dnsCache is an in-memory TTL-aware cache using an LRU strategy to store DNS resource records.
 // It provides methods to add, retrieve, and automatically evict expired entries.
 // Each cache key can store multiple resource records, as DNS queries often return multiple records.
+// Empty answers (NXDOMAIN or NODATA) are kept separately as negative entries holding only an RCODE and expiry time.
 type dnsCache struct {
-	lru *lru.Cache[string, []domain.ResourceRecord]
+	lru         *lru.Cache[string, []domain.ResourceRecord]
+	negative    *lru.Cache[string, negativeAnswer]
+	staleWindow time.Duration
+	clock       clock.Clock
+	counters    counters
+	// mu serializes storing entries. Each store removes the old entry before
+	// adding the new one, so the eviction callbacks see every entry that
+	// leaves and the byte count stays exact.
+	mu sync.Mutex
+}
+
+// negativeAnswer is a cached empty answer: the RCODE it is answered with,
+// NXDOMAIN or NOERROR for NODATA, and the time it expires.
+type negativeAnswer struct {
+	rcode     domain.RCode
+	expiresAt time.Time
+}
+
+// Options defines configuration parameters for the DNS cache.
+type Options struct {
+	// Size is the maximum number of cache entries (keys), bounding positive
+	// and negative entries separately.
+	Size int
+	// StaleWindow keeps records this long after they expire so they can be
+	// served stale when upstream resolution fails (RFC 8767). 0 drops records
+	// as soon as they expire.
+	StaleWindow time.Duration
+	// Clock is the time source for expiry checks (default: the system clock).
+	Clock clock.Clock
 }
 
 // New returns a new dnsCache instance of the given size using an LRU backing store.
 func New(size int) (*dnsCache, error) {
-	cache, err := lru.New[string, []domain.ResourceRecord](size)
+	return NewWithOptions(Options{Size: size})
+}
+
+// NewWithOptions returns a new dnsCache instance configured with opts.
+func NewWithOptions(opts Options) (*dnsCache, error) {
+	if opts.StaleWindow < 0 {
+		return nil, errors.New("stale window must not be negative")
+	}
+	if opts.Clock == nil {
+		opts.Clock = &clock.RealClock{}
+	}
+	c := &dnsCache{staleWindow: opts.StaleWindow, clock: opts.Clock}
+	cache, err := lru.NewWithEvict(opts.Size, c.onEvictRecords)
+	if err != nil {
+		return nil, err
+	}
+	negative, err := lru.NewWithEvict(opts.Size, c.onEvictNegative)
 	if err != nil {
 		return nil, err
 	}
-	return &dnsCache{lru: cache}, nil
+	c.lru, c.negative = cache, negative
+	return c, nil
+}
+
+// onEvictRecords is called whenever a record set leaves the cache, whether
+// evicted, deleted, flushed or replaced, to release its bytes.
+func (c *dnsCache) onEvictRecords(key string, records []domain.ResourceRecord) {
+	c.counters.bytes.Add(-recordsSize(key, records))
+}
+
+// onEvictNegative is called whenever a negative entry leaves the cache, to release its bytes.
+func (c *dnsCache) onEvictNegative(key string, _ negativeAnswer) {
+	c.counters.bytes.Add(-negativeSize(key))
+}
+
+// store adds records under key, replacing any records cached for it.
+func (c *dnsCache) store(key string, records []domain.ResourceRecord) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Remove(key)
+	c.counters.bytes.Add(recordsSize(key, records))
+	if c.lru.Add(key, records) {
+		c.counters.evictions.Add(1)
+	}
+}
+
+// storeNegative adds a negative entry for key, replacing any cached for it.
+func (c *dnsCache) storeNegative(key string, answer negativeAnswer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.negative.Remove(key)
+	c.counters.bytes.Add(negativeSize(key))
+	if c.negative.Add(key, answer) {
+		c.counters.evictions.Add(1)
+	}
 }
 
 // Set replaces the existing records for the given key with the provided records.
@@ -41,49 +124,139 @@ func (c *dnsCache) Set(records []domain.ResourceRecord) error {
 			return ErrMultipleKeys
 		}
 	}
-	c.lru.Add(key, records)
+	c.negative.Remove(key)
+	c.store(key, records)
+	c.counters.inserts.Add(1)
 	return nil
 }
 
+// SetNegative caches an empty answer for key that expires after ttl (RFC 2308),
+// to be answered with rcode. It replaces any records cached for the key; a ttl
+// of 0 or less is ignored.
+func (c *dnsCache) SetNegative(key string, rcode domain.RCode, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	c.lru.Remove(key)
+	c.storeNegative(key, negativeAnswer{rcode: rcode, expiresAt: c.clock.Now().Add(ttl)})
+	c.counters.inserts.Add(1)
+}
+
+// GetNegative returns the RCODE of the live negative entry for key. It does
+// not change the LRU order or the lookup counters.
+func (c *dnsCache) GetNegative(key string) (domain.RCode, bool) {
+	answer, found := c.negative.Peek(key)
+	if !found || !c.clock.Now().Before(answer.expiresAt) {
+		return 0, false
+	}
+	return answer.rcode, true
+}
+
 // Get retrieves resource records from the cache if present and not expired.
-// If any records are expired, they are removed from the cache.
+// If any records are expired beyond the stale window, they are removed from the cache.
 // Returns all valid (non-expired) records for the key and a boolean indicating if any were found.
+// A live negative entry is returned as an empty, non-nil slice and true.
 func (c *dnsCache) Get(key string) ([]domain.ResourceRecord, bool) {
+	records, found := c.get(key)
+	c.counters.lookup(found)
+	return records, found
+}
+
+// get looks up key for Get, dropping expired records and entries.
+func (c *dnsCache) get(key string) ([]domain.ResourceRecord, bool) {
+	now := c.clock.Now()
+	if answer, found := c.negative.Get(key); found {
+		if now.Before(answer.expiresAt) {
+			return []domain.ResourceRecord{}, true
+		}
+		c.negative.Remove(key)
+		c.counters.expiredOnRead.Add(1)
+		return nil, false
+	}
 	if records, found := c.lru.Get(key); found {
-		var validRecords []domain.ResourceRecord
+		validRecords, keptRecords := splitExpired(records, c.staleWindow, now)
 
-		// Filter out expired records
-		for _, record := range records {
-			if !record.IsExpired() {
-				validRecords = append(validRecords, record)
+		// Update cache with only kept records or remove if none remain
+		if len(keptRecords) < len(records) {
+			if len(keptRecords) > 0 {
+				c.store(key, keptRecords)
+			} else {
+				c.lru.Remove(key)
 			}
 		}
-
-		// Update cache with only valid records or remove if none remain
 		if len(validRecords) > 0 {
-			c.lru.Add(key, validRecords)
 			return validRecords, true
-		} else {
-			c.lru.Remove(key)
 		}
+		c.counters.expiredOnRead.Add(1)
 	}
 	return nil, false
 }
 
+// GetStale retrieves records that have expired but are still within the stale
+// window. It returns false when the cache keeps no stale records for the key.
+func (c *dnsCache) GetStale(key string) ([]domain.ResourceRecord, bool) {
+	if c.staleWindow == 0 {
+		return nil, false
+	}
+	records, found := c.lru.Peek(key)
+	if !found {
+		return nil, false
+	}
+	staleRecords := expiredWithin(records, c.staleWindow, c.clock.Now())
+	return staleRecords, len(staleRecords) > 0
+}
+
+// splitExpired returns the records unexpired at now, and the records worth
+// keeping: the unexpired ones plus expired ones still within the stale window.
+// When nothing has expired, kept is records itself and valid is a copy.
+func splitExpired(records []domain.ResourceRecord, staleWindow time.Duration, now time.Time) (valid, kept []domain.ResourceRecord) {
+	expired := func(record domain.ResourceRecord) bool { return record.IsExpired(now) }
+	if !slices.ContainsFunc(records, expired) {
+		return slices.Clone(records), records
+	}
+	for _, record := range records {
+		if !expired(record) {
+			valid = append(valid, record)
+			kept = append(kept, record)
+		} else if isStale(record, staleWindow, now) {
+			kept = append(kept, record)
+		}
+	}
+	return valid, kept
+}
+
+// expiredWithin returns the records that have expired at now but are still within the stale window.
+func expiredWithin(records []domain.ResourceRecord, staleWindow time.Duration, now time.Time) []domain.ResourceRecord {
+	var stale []domain.ResourceRecord
+	for _, record := range records {
+		if record.IsExpired(now) && isStale(record, staleWindow, now) {
+			stale = append(stale, record)
+		}
+	}
+	return stale
+}
+
+// isStale reports whether an expired record is still within the stale window at now.
+func isStale(record domain.ResourceRecord, staleWindow time.Duration, now time.Time) bool {
+	return staleWindow > 0 && record.ExpiredFor(now) <= staleWindow
+}
+
 // Delete removes the entry for the given key from the cache.
 func (c *dnsCache) Delete(key string) {
 	c.lru.Remove(key)
+	c.negative.Remove(key)
 }
 
-// Len returns the number of cache entries (keys) currently stored in the cache.
+// Len returns the number of cache entries (keys) currently stored in the cache,
+// including negative entries.
 // Note: Each entry may contain multiple resource records.
 func (c *dnsCache) Len() int {
-	return c.lru.Len()
+	return c.lru.Len() + c.negative.Len()
 }
 
-// Keys returns a slice of all current cache keys.
+// Keys returns a slice of all current cache keys, including those of negative entries.
 func (c *dnsCache) Keys() []string {
-	return c.lru.Keys()
+	return append(c.lru.Keys(), c.negative.Keys()...)
 }
 
 var _ resolver.Cache = (*dnsCache)(nil)
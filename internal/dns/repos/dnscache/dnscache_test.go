@@ -1,10 +1,15 @@
 package dnscache
 
 import (
+	"context"
+	"net"
 	"testing"
 	"time"
 
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/common/log"
 	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
 )
 
 func TestInvalidCacheSize(t *testing.T) {
@@ -550,3 +555,267 @@ func TestDnsCache_FilterExpiredRecords(t *testing.T) {
 		t.Errorf("expected valid record with IP ending in .2, got %v", got[0].Data)
 	}
 }
+
+func TestNewWithOptions_NegativeStaleWindow(t *testing.T) {
+	_, err := NewWithOptions(Options{Size: 2, StaleWindow: -time.Second})
+	if err == nil {
+		t.Errorf("expected error for negative stale window, got nil")
+	}
+}
+
+func TestDnsCache_GetStale(t *testing.T) {
+	now := time.Now()
+	newRecord := func(name string, ttl uint32, created time.Time) domain.ResourceRecord {
+		rr, err := domain.NewCachedResourceRecord(name, domain.RRTypeFromString("A"), domain.RRClass(1), ttl, []byte{192, 0, 2, 1}, "192.0.2.1", created)
+		if err != nil {
+			t.Fatalf("failed to create resource record: %v", err)
+		}
+		return rr
+	}
+	fresh := newRecord("fresh.com", 60, now)
+	stale := newRecord("stale.com", 10, now.Add(-30*time.Second))      // expired 20s ago
+	tooOld := newRecord("old.com", 10, now.Add(-2*time.Hour))          // expired beyond the window
+	mixedStale := newRecord("mixed.com", 10, now.Add(-30*time.Second)) // expired 20s ago
+	mixedFresh := newRecord("mixed.com", 60, now)                      // still valid
+
+	tests := []struct {
+		name        string
+		staleWindow time.Duration
+		records     []domain.ResourceRecord
+		wantGet     int
+		wantStale   int
+		wantKept    bool
+	}{
+		{name: "fresh record is not stale", staleWindow: time.Hour, records: []domain.ResourceRecord{fresh}, wantGet: 1, wantStale: 0, wantKept: true},
+		{name: "expired record within window", staleWindow: time.Hour, records: []domain.ResourceRecord{stale}, wantGet: 0, wantStale: 1, wantKept: true},
+		{name: "expired record beyond window", staleWindow: time.Hour, records: []domain.ResourceRecord{tooOld}, wantGet: 0, wantStale: 0, wantKept: false},
+		{name: "no stale window", staleWindow: 0, records: []domain.ResourceRecord{stale}, wantGet: 0, wantStale: 0, wantKept: false},
+		{name: "mixed rrset", staleWindow: time.Hour, records: []domain.ResourceRecord{mixedStale, mixedFresh}, wantGet: 1, wantStale: 1, wantKept: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, err := NewWithOptions(Options{Size: 4, StaleWindow: tt.staleWindow})
+			if err != nil {
+				t.Fatalf("failed to create cache: %v", err)
+			}
+			if err := cache.Set(tt.records); err != nil {
+				t.Fatalf("failed to set records: %v", err)
+			}
+			key := tt.records[0].CacheKey()
+
+			got, ok := cache.Get(key)
+			if len(got) != tt.wantGet || ok != (tt.wantGet > 0) {
+				t.Errorf("Get: expected %d records, got %d (found=%v)", tt.wantGet, len(got), ok)
+			}
+			staleRecords, ok := cache.GetStale(key)
+			if len(staleRecords) != tt.wantStale || ok != (tt.wantStale > 0) {
+				t.Errorf("GetStale: expected %d records, got %d (found=%v)", tt.wantStale, len(staleRecords), ok)
+			}
+			for _, rr := range staleRecords {
+				if !rr.IsExpired(time.Now()) {
+					t.Errorf("GetStale returned unexpired record %+v", rr)
+				}
+			}
+			if kept := cache.Len() == 1; kept != tt.wantKept {
+				t.Errorf("expected entry kept=%v after Get, got %v", tt.wantKept, kept)
+			}
+		})
+	}
+}
+
+func TestDnsCache_GetStale_NotPresent(t *testing.T) {
+	cache, err := NewWithOptions(Options{Size: 2, StaleWindow: time.Hour})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	if _, ok := cache.GetStale("missing.com|missing.com|A|IN"); ok {
+		t.Errorf("expected no stale records for a missing key")
+	}
+}
+
+func TestDnsCache_SetNegative(t *testing.T) {
+	cache, err := New(2)
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	key := domain.GenerateCacheKey("nope.example.com", domain.RRTypeA, domain.RRClass(1))
+
+	cache.SetNegative(key, domain.NXDOMAIN, time.Minute)
+	got, ok := cache.Get(key)
+	if !ok {
+		t.Fatalf("expected negative entry to be found")
+	}
+	if got == nil || len(got) != 0 {
+		t.Errorf("expected empty non-nil records, got %v", got)
+	}
+	if cache.Len() != 1 || len(cache.Keys()) != 1 {
+		t.Errorf("expected negative entry to be counted, got len %d keys %v", cache.Len(), cache.Keys())
+	}
+	if _, ok := cache.GetStale(key); ok {
+		t.Errorf("negative entries are never served stale")
+	}
+	if rcode, ok := cache.GetNegative(key); !ok || rcode != domain.NXDOMAIN {
+		t.Errorf("expected NXDOMAIN negative entry, got %v (found %v)", rcode, ok)
+	}
+	cache.SetNegative(key, domain.NOERROR, time.Minute)
+	if rcode, ok := cache.GetNegative(key); !ok || rcode != domain.NOERROR {
+		t.Errorf("expected NODATA negative entry, got %v (found %v)", rcode, ok)
+	}
+
+	cache.Delete(key)
+	if _, ok := cache.Get(key); ok {
+		t.Errorf("expected negative entry to be deleted")
+	}
+	if _, ok := cache.GetNegative(key); ok {
+		t.Errorf("expected no negative entry after delete")
+	}
+
+	cache.SetNegative(key, domain.NXDOMAIN, 0)
+	if _, ok := cache.Get(key); ok {
+		t.Errorf("expected zero ttl to be ignored")
+	}
+}
+
+func TestDnsCache_SetNegative_Expired(t *testing.T) {
+	clk := &clock.MockClock{CurrentTime: time.Now()}
+	cache, err := NewWithOptions(Options{Size: 2, Clock: clk})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	key := domain.GenerateCacheKey("nope.example.com", domain.RRTypeA, domain.RRClass(1))
+
+	cache.SetNegative(key, domain.NXDOMAIN, time.Minute)
+	clk.Advance(time.Minute)
+	if _, ok := cache.GetNegative(key); ok {
+		t.Errorf("expected expired negative entry to have no RCODE")
+	}
+	if _, ok := cache.Get(key); ok {
+		t.Errorf("expected expired negative entry to be missing")
+	}
+	if cache.Len() != 0 {
+		t.Errorf("expected expired negative entry to be removed, got len %d", cache.Len())
+	}
+}
+
+func TestDnsCache_SetNegative_ReplacesRecords(t *testing.T) {
+	cache, err := New(2)
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	rr, err := domain.NewCachedResourceRecord("example.com", domain.RRTypeA, domain.RRClass(1), 60, []byte{192, 0, 2, 1}, "192.0.2.1", time.Now())
+	if err != nil {
+		t.Fatalf("failed to create resource record: %v", err)
+	}
+
+	if err := cache.Set([]domain.ResourceRecord{rr}); err != nil {
+		t.Fatalf("failed to set record: %v", err)
+	}
+	cache.SetNegative(rr.CacheKey(), domain.NXDOMAIN, time.Minute)
+	if got, ok := cache.Get(rr.CacheKey()); !ok || len(got) != 0 {
+		t.Errorf("expected negative entry to replace records, got %v", got)
+	}
+
+	if err := cache.Set([]domain.ResourceRecord{rr}); err != nil {
+		t.Fatalf("failed to set record: %v", err)
+	}
+	if got, ok := cache.Get(rr.CacheKey()); !ok || len(got) != 1 {
+		t.Errorf("expected records to replace negative entry, got %v", got)
+	}
+	if cache.Len() != 1 {
+		t.Errorf("expected 1 entry, got %d", cache.Len())
+	}
+}
+
+func TestDnsCache_Clock(t *testing.T) {
+	created := time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC)
+	clk := &clock.MockClock{CurrentTime: created}
+	cache, err := NewWithOptions(Options{Size: 2, StaleWindow: time.Minute, Clock: clk})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	rr, err := domain.NewCachedResourceRecord("example.com", domain.RRTypeA, domain.RRClass(1), 60, []byte{192, 0, 2, 1}, "192.0.2.1", created)
+	if err != nil {
+		t.Fatalf("failed to create resource record: %v", err)
+	}
+	if err := cache.Set([]domain.ResourceRecord{rr}); err != nil {
+		t.Fatalf("failed to set record: %v", err)
+	}
+	key := rr.CacheKey()
+
+	clk.Advance(59 * time.Second)
+	if got, ok := cache.Get(key); !ok || got[0].TTL(clk.Now()) != 1 {
+		t.Errorf("expected record with 1s left, got %v (found=%v)", got, ok)
+	}
+
+	clk.Advance(30 * time.Second)
+	if _, ok := cache.Get(key); ok {
+		t.Errorf("expected record to have expired")
+	}
+	if stale, ok := cache.GetStale(key); !ok || len(stale) != 1 {
+		t.Errorf("expected record to be served stale, got %v", stale)
+	}
+
+	clk.Advance(time.Minute)
+	if _, ok := cache.GetStale(key); ok {
+		t.Errorf("expected record to have left the stale window")
+	}
+	if _, ok := cache.Get(key); ok || cache.Len() != 0 {
+		t.Errorf("expected record to be removed, got len %d", cache.Len())
+	}
+}
+
+// timeTravelUpstream answers every query with one A record that has a 60s TTL,
+// counting how often it is asked.
+type timeTravelUpstream struct {
+	calls int
+}
+
+func (u *timeTravelUpstream) Resolve(_ context.Context, query domain.Question, now time.Time) (domain.DNSResponse, error) {
+	u.calls++
+	rr, err := domain.NewCachedResourceRecord(query.Name, query.Type, query.Class, 60, []byte{192, 0, 2, 1}, "192.0.2.1", now)
+	return domain.DNSResponse{RCode: domain.NOERROR, Answers: []domain.ResourceRecord{rr}}, err
+}
+
+func TestDnsCache_ResolverTimeTravel(t *testing.T) {
+	clk := &clock.MockClock{CurrentTime: time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC)}
+	cache, err := NewWithOptions(Options{Size: 10, Clock: clk})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	upstream := &timeTravelUpstream{}
+	r := resolver.NewResolver(resolver.ResolverOptions{
+		Clock:         clk,
+		Logger:        log.NewNoopLogger(),
+		Upstream:      upstream,
+		UpstreamCache: cache,
+	})
+	query, err := domain.NewQuestion(1, "example.com.", domain.RRTypeA, domain.RRClass(1))
+	if err != nil {
+		t.Fatalf("failed to create question: %v", err)
+	}
+
+	steps := []struct {
+		advance   time.Duration
+		wantCalls int
+		wantTTL   uint32
+	}{
+		{advance: 0, wantCalls: 1, wantTTL: 60},
+		{advance: 45 * time.Second, wantCalls: 1, wantTTL: 15},
+		{advance: 15 * time.Second, wantCalls: 1, wantTTL: 0},
+		{advance: time.Second, wantCalls: 2, wantTTL: 60},
+	}
+	for i, step := range steps {
+		clk.Advance(step.advance)
+		resp, err := r.HandleQuery(context.Background(), query, &net.UDPAddr{})
+		if err != nil || len(resp.Answers) != 1 {
+			t.Fatalf("step %d: expected one answer, got %v (err=%v)", i, resp.Answers, err)
+		}
+		if upstream.calls != step.wantCalls {
+			t.Errorf("step %d: expected %d upstream calls, got %d", i, step.wantCalls, upstream.calls)
+		}
+		if ttl := resp.Answers[0].TTL(clk.Now()); ttl != step.wantTTL {
+			t.Errorf("step %d: expected ttl %d, got %d", i, step.wantTTL, ttl)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package dnscache
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/common/utils"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// counters tracks cache activity for Stats. They are updated atomically, so
+// lookups never take a lock just to count.
+type counters struct {
+	hits          atomic.Uint64
+	misses        atomic.Uint64
+	expiredOnRead atomic.Uint64
+	evictions     atomic.Uint64
+	inserts       atomic.Uint64
+	// bytes is the approximate memory held by cached entries. Only dnsCache
+	// tracks it here; the sharded cache already sums it per shard.
+	bytes atomic.Int64
+}
+
+// lookup counts a Get that found a live entry, or one that did not.
+func (c *counters) lookup(found bool) {
+	if found {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+}
+
+// stats returns the counters with the given entry count and byte usage.
+func (c *counters) stats(entries int, bytes int64) resolver.CacheStats {
+	return resolver.CacheStats{
+		Entries:       entries,
+		Bytes:         bytes,
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		ExpiredOnRead: c.expiredOnRead.Load(),
+		Evictions:     c.evictions.Load(),
+		Inserts:       c.inserts.Load(),
+	}
+}
+
+// Flush removes every entry from the cache and returns how many were removed.
+func (c *dnsCache) Flush() int {
+	n := c.Len()
+	c.lru.Purge()
+	c.negative.Purge()
+	return n
+}
+
+// FlushName removes the entries for exactly name, of any type and class.
+func (c *dnsCache) FlushName(name string) int {
+	return flushMatching(c.Keys(), c.Delete, matchName(name))
+}
+
+// FlushDomain removes the entries for suffix and every name below it.
+func (c *dnsCache) FlushDomain(suffix string) int {
+	return flushMatching(c.Keys(), c.Delete, matchDomain(suffix))
+}
+
+// FlushType removes the entries of one record type.
+func (c *dnsCache) FlushType(rrtype domain.RRType) int {
+	return flushMatching(c.Keys(), c.Delete, matchType(rrtype))
+}
+
+// Dump lists every entry with its remaining TTL, least recently used first,
+// records before negative entries. It does not change the LRU order or the
+// lookup counters.
+func (c *dnsCache) Dump() []resolver.CacheEntry {
+	now := c.clock.Now()
+	var entries []resolver.CacheEntry
+	for records := range c.recordSets {
+		entries = append(entries, recordsEntry(records, now))
+	}
+	for key, answer := range c.negativeEntries {
+		entries = append(entries, negativeEntry(key, answer, now))
+	}
+	return entries
+}
+
+// Stats returns a snapshot of the entry count, byte usage and counters.
+func (c *dnsCache) Stats() resolver.CacheStats {
+	return c.counters.stats(c.Len(), c.counters.bytes.Load())
+}
+
+// Flush removes every entry from the cache and returns how many were removed.
+func (c *shardedCache) Flush() int {
+	n := 0
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		n += len(s.entries)
+		clear(s.entries)
+		s.lru.Init()
+		s.size = 0
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// FlushName removes the entries for exactly name, of any type and class.
+func (c *shardedCache) FlushName(name string) int {
+	return flushMatching(c.Keys(), c.Delete, matchName(name))
+}
+
+// FlushDomain removes the entries for suffix and every name below it.
+func (c *shardedCache) FlushDomain(suffix string) int {
+	return flushMatching(c.Keys(), c.Delete, matchDomain(suffix))
+}
+
+// FlushType removes the entries of one record type.
+func (c *shardedCache) FlushType(rrtype domain.RRType) int {
+	return flushMatching(c.Keys(), c.Delete, matchType(rrtype))
+}
+
+// Dump lists every entry with its remaining TTL, shard by shard from least to
+// most recently used. It does not change the LRU order or the lookup counters.
+func (c *shardedCache) Dump() []resolver.CacheEntry {
+	now := c.clock.Now()
+	var entries []resolver.CacheEntry
+	for i := range c.shards {
+		for _, entry := range c.shards[i].snapshot() {
+			if entry.negative {
+				entries = append(entries, negativeEntry(entry.key, entry.answer, now))
+			} else {
+				entries = append(entries, recordsEntry(entry.records, now))
+			}
+		}
+	}
+	return entries
+}
+
+// Stats returns a snapshot of the entry count, byte usage and counters.
+func (c *shardedCache) Stats() resolver.CacheStats {
+	return c.counters.stats(c.Len(), c.Bytes())
+}
+
+// keyMatcher selects cache entries by the name and type in their keys.
+type keyMatcher func(name string, rrtype domain.RRType) bool
+
+// matchName selects the entries for exactly name.
+func matchName(name string) keyMatcher {
+	name = utils.CanonicalDNSName(name)
+	return func(entry string, _ domain.RRType) bool {
+		return entry == name
+	}
+}
+
+// matchDomain selects the entries for suffix and every name below it. The
+// root domain selects every entry.
+func matchDomain(suffix string) keyMatcher {
+	suffix = utils.CanonicalDNSName(suffix)
+	return func(entry string, _ domain.RRType) bool {
+		return suffix == "" || entry == suffix || strings.HasSuffix(entry, "."+suffix)
+	}
+}
+
+// matchType selects the entries of one record type.
+func matchType(rrtype domain.RRType) keyMatcher {
+	return func(_ string, entry domain.RRType) bool {
+		return entry == rrtype
+	}
+}
+
+// flushMatching deletes the keys selected by match and returns how many it deleted.
+func flushMatching(keys []string, remove func(string), match keyMatcher) int {
+	n := 0
+	for _, key := range keys {
+		name, rrtype, _, ok := domain.ParseCacheKey(key)
+		if ok && match(name, rrtype) {
+			remove(key)
+			n++
+		}
+	}
+	return n
+}
+
+// recordsEntry describes a cached record set. Its TTL is that of the record
+// with the most time left, since the entry is served until that one expires.
+func recordsEntry(records []domain.ResourceRecord, now time.Time) resolver.CacheEntry {
+	entry := describeKey(records[0].CacheKey())
+	entry.Records = records
+	for _, record := range records {
+		entry.TTL = max(entry.TTL, record.TTLRemaining(now))
+	}
+	return entry
+}
+
+// negativeEntry describes a cached empty answer.
+func negativeEntry(key string, answer negativeAnswer, now time.Time) resolver.CacheEntry {
+	entry := describeKey(key)
+	entry.Negative = true
+	entry.RCode = answer.rcode
+	entry.TTL = max(answer.expiresAt.Sub(now), 0)
+	return entry
+}
+
+// describeKey starts a CacheEntry with the name, type and class in key.
+func describeKey(key string) resolver.CacheEntry {
+	name, rrtype, class, _ := domain.ParseCacheKey(key)
+	return resolver.CacheEntry{Key: key, Name: name, Type: rrtype, Class: class}
+}
+
+var (
+	_ resolver.CacheManager = (*dnsCache)(nil)
+	_ resolver.CacheManager = (*shardedCache)(nil)
+)
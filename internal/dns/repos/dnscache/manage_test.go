@@ -0,0 +1,295 @@
+package dnscache
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// managedCache is a cache with its management operations, as both implementations provide.
+type managedCache interface {
+	resolver.Cache
+	resolver.CacheManager
+}
+
+// managedCaches returns one cache of each implementation using clk.
+func managedCaches(t *testing.T, clk clock.Clock) map[string]managedCache {
+	t.Helper()
+	lruCache, err := NewWithOptions(Options{Size: 100, StaleWindow: time.Hour, Clock: clk})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	sharded, err := NewSharded(ShardedOptions{MaxBytes: 1 << 20, Shards: 4, StaleWindow: time.Hour, Clock: clk})
+	if err != nil {
+		t.Fatalf("failed to create sharded cache: %v", err)
+	}
+	return map[string]managedCache{"lru": lruCache, "sharded": sharded}
+}
+
+// fillManagedCache caches A and AAAA records for a few names plus one negative entry.
+func fillManagedCache(t *testing.T, cache managedCache, now time.Time) {
+	t.Helper()
+	for _, name := range []string{"example.com", "www.example.com", "a.b.example.com", "notexample.com", "example.org"} {
+		for _, rrtype := range []domain.RRType{domain.RRTypeA, domain.RRTypeAAAA} {
+			data := []byte{192, 0, 2, 1}
+			if rrtype == domain.RRTypeAAAA {
+				data = make([]byte, 16)
+			}
+			rr, err := domain.NewCachedResourceRecord(name, rrtype, domain.RRClassIN, 300, data, "", now)
+			if err != nil {
+				t.Fatalf("failed to create resource record: %v", err)
+			}
+			if err := cache.Set([]domain.ResourceRecord{rr}); err != nil {
+				t.Fatalf("failed to set record: %v", err)
+			}
+		}
+	}
+	cache.SetNegative(domain.GenerateCacheKey("nope.example.com", domain.RRTypeA, domain.RRClassIN), domain.NXDOMAIN, time.Minute)
+}
+
+// cachedNames returns the sorted names with at least one entry in the cache.
+func cachedNames(cache managedCache) []string {
+	var names []string
+	for _, key := range cache.Keys() {
+		name, _, _, _ := domain.ParseCacheKey(key)
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestCacheManager_Flush(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		flush     func(managedCache) int
+		wantN     int
+		wantNames []string
+		wantLen   int
+	}{
+		{
+			name:    "all",
+			flush:   func(c managedCache) int { return c.Flush() },
+			wantN:   11,
+			wantLen: 0,
+		},
+		{
+			name:      "exact name",
+			flush:     func(c managedCache) int { return c.FlushName("WWW.Example.com.") },
+			wantN:     2,
+			wantNames: []string{"a.b.example.com", "example.com", "example.org", "nope.example.com", "notexample.com"},
+			wantLen:   9,
+		},
+		{
+			name:      "domain suffix",
+			flush:     func(c managedCache) int { return c.FlushDomain("example.com.") },
+			wantN:     7,
+			wantNames: []string{"example.org", "notexample.com"},
+			wantLen:   4,
+		},
+		{
+			name:    "root domain",
+			flush:   func(c managedCache) int { return c.FlushDomain(".") },
+			wantN:   11,
+			wantLen: 0,
+		},
+		{
+			name:      "type",
+			flush:     func(c managedCache) int { return c.FlushType(domain.RRTypeAAAA) },
+			wantN:     5,
+			wantNames: []string{"a.b.example.com", "example.com", "example.org", "nope.example.com", "notexample.com", "www.example.com"},
+			wantLen:   6,
+		},
+		{
+			name:      "no match",
+			flush:     func(c managedCache) int { return c.FlushName("missing.example.net") },
+			wantN:     0,
+			wantNames: []string{"a.b.example.com", "example.com", "example.org", "nope.example.com", "notexample.com", "www.example.com"},
+			wantLen:   11,
+		},
+	}
+	for _, tt := range tests {
+		for impl, cache := range managedCaches(t, &clock.MockClock{CurrentTime: now}) {
+			t.Run(impl+"/"+tt.name, func(t *testing.T) {
+				fillManagedCache(t, cache, now)
+				if n := tt.flush(cache); n != tt.wantN {
+					t.Errorf("expected %d entries flushed, got %d", tt.wantN, n)
+				}
+				if cache.Len() != tt.wantLen {
+					t.Errorf("expected %d entries left, got %d", tt.wantLen, cache.Len())
+				}
+				if names := cachedNames(cache); !slices.Equal(names, tt.wantNames) {
+					t.Errorf("expected names %v left, got %v", tt.wantNames, names)
+				}
+			})
+		}
+	}
+}
+
+func TestCacheManager_Dump(t *testing.T) {
+	created := time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC)
+	for impl, cache := range managedCaches(t, &clock.MockClock{CurrentTime: created.Add(100 * time.Second)}) {
+		t.Run(impl, func(t *testing.T) {
+			short, _ := domain.NewCachedResourceRecord("example.com", domain.RRTypeA, domain.RRClassIN, 60, []byte{192, 0, 2, 1}, "192.0.2.1", created)
+			long, _ := domain.NewCachedResourceRecord("example.com", domain.RRTypeA, domain.RRClassIN, 300, []byte{192, 0, 2, 2}, "192.0.2.2", created)
+			stale, _ := domain.NewCachedResourceRecord("stale.example.com", domain.RRTypeA, domain.RRClassIN, 60, []byte{192, 0, 2, 3}, "192.0.2.3", created)
+			if err := cache.Set([]domain.ResourceRecord{short, long}); err != nil {
+				t.Fatalf("failed to set records: %v", err)
+			}
+			if err := cache.Set([]domain.ResourceRecord{stale}); err != nil {
+				t.Fatalf("failed to set records: %v", err)
+			}
+			negativeKey := domain.GenerateCacheKey("nope.example.com", domain.RRTypeMX, domain.RRClassIN)
+			cache.SetNegative(negativeKey, domain.NXDOMAIN, time.Minute)
+
+			entries := cache.Dump()
+			if len(entries) != 3 {
+				t.Fatalf("expected 3 entries, got %d: %+v", len(entries), entries)
+			}
+			byName := make(map[string]resolver.CacheEntry)
+			for _, entry := range entries {
+				byName[entry.Name] = entry
+			}
+
+			live := byName["example.com"]
+			if live.Key != short.CacheKey() || live.Type != domain.RRTypeA || live.Class != domain.RRClassIN || live.Negative {
+				t.Errorf("unexpected entry description: %+v", live)
+			}
+			if live.TTL != 200*time.Second || len(live.Records) != 2 {
+				t.Errorf("expected 2 records with 200s left on the longest, got %v and %d records", live.TTL, len(live.Records))
+			}
+			if entry := byName["stale.example.com"]; entry.TTL != 0 || len(entry.Records) != 1 {
+				t.Errorf("expected stale entry with no TTL left, got %+v", entry)
+			}
+			negative := byName["nope.example.com"]
+			if !negative.Negative || negative.RCode != domain.NXDOMAIN || negative.Type != domain.RRTypeMX || negative.TTL != time.Minute || negative.Records != nil {
+				t.Errorf("unexpected negative entry: %+v", negative)
+			}
+
+			if stats := cache.Stats(); stats.Hits != 0 || stats.Misses != 0 {
+				t.Errorf("expected Dump not to count lookups, got %+v", stats)
+			}
+		})
+	}
+}
+
+func TestCacheManager_Stats(t *testing.T) {
+	now := time.Now()
+	for impl, cache := range managedCaches(t, &clock.MockClock{CurrentTime: now}) {
+		t.Run(impl, func(t *testing.T) {
+			fillManagedCache(t, cache, now)
+			cache.Get(domain.GenerateCacheKey("example.com", domain.RRTypeA, domain.RRClassIN))
+			cache.Get(domain.GenerateCacheKey("nope.example.com", domain.RRTypeA, domain.RRClassIN))
+			cache.Get(domain.GenerateCacheKey("missing.example.com", domain.RRTypeA, domain.RRClassIN))
+			cache.GetStale(domain.GenerateCacheKey("example.com", domain.RRTypeA, domain.RRClassIN))
+
+			stats := cache.Stats()
+			if stats.Bytes <= 0 {
+				t.Errorf("expected byte usage to be tracked, got %d", stats.Bytes)
+			}
+			stats.Bytes = 0
+			want := resolver.CacheStats{Entries: 11, Hits: 2, Misses: 1, Inserts: 11}
+			if stats != want {
+				t.Errorf("expected %+v, got %+v", want, stats)
+			}
+		})
+	}
+}
+
+func TestCacheManager_Stats_ExpiredOnRead(t *testing.T) {
+	now := time.Now()
+	clk := &clock.MockClock{CurrentTime: now}
+	for impl, cache := range managedCaches(t, clk) {
+		t.Run(impl, func(t *testing.T) {
+			clk.CurrentTime = now
+			if err := cache.Set([]domain.ResourceRecord{newShardedTestRecord(t, "a.example.com.", 60, now)}); err != nil {
+				t.Fatalf("failed to set record: %v", err)
+			}
+			negativeKey := domain.GenerateCacheKey("b.example.com.", domain.RRTypeA, domain.RRClassIN)
+			cache.SetNegative(negativeKey, domain.NXDOMAIN, time.Minute)
+
+			clk.Advance(2 * time.Minute)
+			cache.Get(domain.GenerateCacheKey("a.example.com.", domain.RRTypeA, domain.RRClassIN))
+			cache.Get(negativeKey)
+			cache.Get(domain.GenerateCacheKey("missing.example.com.", domain.RRTypeA, domain.RRClassIN))
+
+			stats := cache.Stats()
+			if stats.Misses != 3 || stats.ExpiredOnRead != 2 || stats.Hits != 0 {
+				t.Errorf("expected 3 misses, 2 of them expired, got %+v", stats)
+			}
+		})
+	}
+}
+
+func TestCacheManager_Stats_Bytes(t *testing.T) {
+	now := time.Now()
+	for impl, cache := range managedCaches(t, &clock.MockClock{CurrentTime: now}) {
+		t.Run(impl, func(t *testing.T) {
+			record := newShardedTestRecord(t, "a.example.com.", 300, now)
+			key := record.CacheKey()
+			want := recordsSize(key, []domain.ResourceRecord{record})
+			for range 3 {
+				if err := cache.Set([]domain.ResourceRecord{record}); err != nil {
+					t.Fatalf("failed to set record: %v", err)
+				}
+			}
+			if bytes := cache.Stats().Bytes; bytes != want {
+				t.Errorf("expected %d bytes after replacing an entry, got %d", want, bytes)
+			}
+
+			cache.SetNegative(key, domain.NXDOMAIN, time.Minute)
+			if bytes := cache.Stats().Bytes; bytes != negativeSize(key) {
+				t.Errorf("expected %d bytes for a negative entry, got %d", negativeSize(key), bytes)
+			}
+			cache.Delete(key)
+			if bytes := cache.Stats().Bytes; bytes != 0 {
+				t.Errorf("expected 0 bytes after Delete, got %d", bytes)
+			}
+
+			fillManagedCache(t, cache, now)
+			cache.Flush()
+			if stats := cache.Stats(); stats.Bytes != 0 || stats.Inserts != 15 {
+				t.Errorf("expected 0 bytes and 15 inserts after Flush, got %+v", stats)
+			}
+		})
+	}
+}
+
+func TestCacheManager_Stats_Evictions(t *testing.T) {
+	now := time.Now()
+	lruCache, err := New(2)
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	small := newShardedTestRecord(t, "a.example.com.", 300, now)
+	sharded, err := NewSharded(ShardedOptions{MaxBytes: 2 * recordsSize(small.CacheKey(), []domain.ResourceRecord{small}), Shards: 1})
+	if err != nil {
+		t.Fatalf("failed to create sharded cache: %v", err)
+	}
+	for impl, cache := range map[string]managedCache{"lru": lruCache, "sharded": sharded} {
+		t.Run(impl, func(t *testing.T) {
+			for _, name := range []string{"a.example.com.", "b.example.com.", "c.example.com.", "a.example.com."} {
+				if err := cache.Set([]domain.ResourceRecord{newShardedTestRecord(t, name, 300, now)}); err != nil {
+					t.Fatalf("failed to set record: %v", err)
+				}
+			}
+			cache.SetNegative(domain.GenerateCacheKey("d.example.com.", domain.RRTypeA, domain.RRClassIN), domain.NXDOMAIN, time.Minute)
+			if err := cache.Set([]domain.ResourceRecord{newShardedTestRecord(t, "d.example.com.", 300, now)}); err != nil {
+				t.Fatalf("failed to set record: %v", err)
+			}
+			stats := cache.Stats()
+			if stats.Evictions != 3 || stats.Entries != 2 || stats.Inserts != 6 {
+				t.Errorf("expected 3 evictions, 2 entries and 6 inserts, got %+v", stats)
+			}
+			if want := 2 * recordsSize(small.CacheKey(), []domain.ResourceRecord{small}); stats.Bytes != want {
+				t.Errorf("expected %d bytes after evictions, got %d", want, stats.Bytes)
+			}
+		})
+	}
+}
@@ -0,0 +1,391 @@
+package dnscache
+
+import (
+	"container/list"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+const (
+	// defaultShards is the shard count when ShardedOptions leaves it unset.
+	defaultShards = 64
+
+	// entryOverhead approximates the bytes an entry costs beyond its key and
+	// records: the list element, the map slot and the entry struct.
+	entryOverhead = 128
+	// recordOverhead approximates the fixed size of a cached ResourceRecord,
+	// including its expiry time, before its name, data and text.
+	recordOverhead = 112
+)
+
+var (
+	ErrInvalidMaxBytes = errors.New("max bytes must be positive")
+	ErrInvalidShards   = errors.New("shard count must not be negative")
+)
+
+// shardedCache is a TTL-aware LRU cache of DNS resource records split into
+// independently locked shards, bounded by the approximate bytes its entries
+// use rather than by their count. Keys are spread over shards by hash, so
+// concurrent queries for different names rarely wait on the same lock.
+// Each shard evicts its own least recently used entries once it holds more
+// than its share of MaxBytes.
+type shardedCache struct {
+	shards      []cacheShard
+	staleWindow time.Duration
+	clock       clock.Clock
+	counters    counters
+}
+
+// ShardedOptions defines configuration parameters for the sharded DNS cache.
+type ShardedOptions struct {
+	// MaxBytes bounds the approximate memory used by cached entries. Each shard
+	// gets an equal share, so an RRset larger than MaxBytes/Shards is not cached.
+	MaxBytes int64
+	// Shards is the number of independently locked shards (default: 64).
+	Shards int
+	// StaleWindow keeps records this long after they expire so they can be
+	// served stale (RFC 8767). 0 drops records as soon as they expire.
+	StaleWindow time.Duration
+	// Clock is the time source for expiry checks (default: the system clock).
+	Clock clock.Clock
+}
+
+// cacheShard is one LRU list of entries under its own lock. The front of the
+// list is the most recently used entry.
+type cacheShard struct {
+	mu       sync.Mutex
+	entries  map[string]*list.Element
+	lru      list.List
+	size     int64
+	maxBytes int64
+}
+
+// shardEntry holds either the records for a key or, for a negative entry,
+// only the RCODE and expiry time of the empty answer.
+type shardEntry struct {
+	key      string
+	records  []domain.ResourceRecord
+	negative bool
+	answer   negativeAnswer
+	size     int64
+}
+
+// NewSharded returns a new sharded cache bounded by opts.MaxBytes.
+func NewSharded(opts ShardedOptions) (*shardedCache, error) {
+	if opts.MaxBytes <= 0 {
+		return nil, ErrInvalidMaxBytes
+	}
+	if opts.Shards < 0 {
+		return nil, ErrInvalidShards
+	}
+	if opts.StaleWindow < 0 {
+		return nil, errors.New("stale window must not be negative")
+	}
+	if opts.Clock == nil {
+		opts.Clock = &clock.RealClock{}
+	}
+	shards := opts.Shards
+	if shards == 0 {
+		shards = defaultShards
+	}
+	c := &shardedCache{
+		shards:      make([]cacheShard, shards),
+		staleWindow: opts.StaleWindow,
+		clock:       opts.Clock,
+	}
+	perShard := max(opts.MaxBytes/int64(shards), 1)
+	for i := range c.shards {
+		c.shards[i].entries = make(map[string]*list.Element)
+		c.shards[i].maxBytes = perShard
+	}
+	return c, nil
+}
+
+// shard returns the shard that owns key, chosen by an FNV-1a hash of the key.
+func (c *shardedCache) shard(key string) *cacheShard {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	//gosec:disable G115 -- the shard count is a positive int set by NewSharded
+	return &c.shards[hash%uint32(len(c.shards))]
+}
+
+// Set replaces the existing records for the given key with the provided records.
+// all records passed should use the same key
+func (c *shardedCache) Set(records []domain.ResourceRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	key := records[0].CacheKey()
+	for _, record := range records {
+		if record.CacheKey() != key {
+			return ErrMultipleKeys
+		}
+	}
+	c.counters.evictions.Add(c.shard(key).put(&shardEntry{key: key, records: records, size: recordsSize(key, records)}))
+	c.counters.inserts.Add(1)
+	return nil
+}
+
+// SetNegative caches an empty answer for key that expires after ttl (RFC 2308),
+// to be answered with rcode. It replaces any records cached for the key; a ttl
+// of 0 or less is ignored.
+func (c *shardedCache) SetNegative(key string, rcode domain.RCode, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	c.counters.evictions.Add(c.shard(key).put(&shardEntry{
+		key:      key,
+		negative: true,
+		answer:   negativeAnswer{rcode: rcode, expiresAt: c.clock.Now().Add(ttl)},
+		size:     negativeSize(key),
+	}))
+	c.counters.inserts.Add(1)
+}
+
+// GetNegative returns the RCODE of the live negative entry for key. It does
+// not change the LRU order or the lookup counters.
+func (c *shardedCache) GetNegative(key string) (domain.RCode, bool) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	elem, found := s.entries[key]
+	if !found {
+		return 0, false
+	}
+	entry := elem.Value.(*shardEntry)
+	if !entry.negative || !c.clock.Now().Before(entry.answer.expiresAt) {
+		return 0, false
+	}
+	return entry.answer.rcode, true
+}
+
+// Get retrieves resource records from the cache if present and not expired.
+// Records expired beyond the stale window are removed from the cache.
+// A live negative entry is returned as an empty, non-nil slice and true.
+func (c *shardedCache) Get(key string) ([]domain.ResourceRecord, bool) {
+	records, found := c.get(key)
+	c.counters.lookup(found)
+	return records, found
+}
+
+// get looks up key for Get, dropping expired records and entries.
+func (c *shardedCache) get(key string) ([]domain.ResourceRecord, bool) {
+	now := c.clock.Now()
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, found := s.entries[key]
+	if !found {
+		return nil, false
+	}
+	entry := elem.Value.(*shardEntry)
+	if entry.negative {
+		if now.Before(entry.answer.expiresAt) {
+			s.lru.MoveToFront(elem)
+			return []domain.ResourceRecord{}, true
+		}
+		s.remove(elem)
+		c.counters.expiredOnRead.Add(1)
+		return nil, false
+	}
+
+	valid, kept := splitExpired(entry.records, c.staleWindow, now)
+	if len(kept) == 0 {
+		s.remove(elem)
+		c.counters.expiredOnRead.Add(1)
+		return nil, false
+	}
+	if len(kept) < len(entry.records) {
+		entry.records = kept
+		newSize := recordsSize(key, kept)
+		s.size += newSize - entry.size
+		entry.size = newSize
+	}
+	s.lru.MoveToFront(elem)
+	if len(valid) > 0 {
+		return valid, true
+	}
+	c.counters.expiredOnRead.Add(1)
+	return nil, false
+}
+
+// GetStale retrieves records that have expired but are still within the stale
+// window, without changing the entry's position in the LRU order.
+func (c *shardedCache) GetStale(key string) ([]domain.ResourceRecord, bool) {
+	if c.staleWindow == 0 {
+		return nil, false
+	}
+	s := c.shard(key)
+	s.mu.Lock()
+	elem, found := s.entries[key]
+	var records []domain.ResourceRecord
+	if found {
+		records = elem.Value.(*shardEntry).records
+	}
+	s.mu.Unlock()
+
+	stale := expiredWithin(records, c.staleWindow, c.clock.Now())
+	return stale, len(stale) > 0
+}
+
+// Delete removes the entry for the given key from the cache.
+func (c *shardedCache) Delete(key string) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, found := s.entries[key]; found {
+		s.remove(elem)
+	}
+}
+
+// Len returns the number of cache entries (keys) across all shards,
+// including negative entries.
+func (c *shardedCache) Len() int {
+	n := 0
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		n += len(s.entries)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// Keys returns a slice of all current cache keys, shard by shard.
+func (c *shardedCache) Keys() []string {
+	var keys []string
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		for elem := s.lru.Back(); elem != nil; elem = elem.Prev() {
+			keys = append(keys, elem.Value.(*shardEntry).key)
+		}
+		s.mu.Unlock()
+	}
+	return keys
+}
+
+// Bytes returns the approximate memory used by cached entries.
+func (c *shardedCache) Bytes() int64 {
+	var total int64
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		total += s.size
+		s.mu.Unlock()
+	}
+	return total
+}
+
+// WriteSnapshot writes every unexpired cache entry to w, in the same format
+// as the entry-bounded cache.
+func (c *shardedCache) WriteSnapshot(w io.Writer) error {
+	return writeSnapshot(w, c.recordSets, c.negativeEntries, c.clock.Now())
+}
+
+// ReadSnapshot loads the entries of a snapshot into the cache and returns how
+// many it loaded; see dnsCache.ReadSnapshot.
+func (c *shardedCache) ReadSnapshot(r io.Reader) (int, error) {
+	return readSnapshot(r, c, c.clock.Now())
+}
+
+// SaveSnapshot writes the cache to a snapshot file at path; see dnsCache.SaveSnapshot.
+func (c *shardedCache) SaveSnapshot(path string) error {
+	return saveSnapshot(path, c.WriteSnapshot)
+}
+
+// LoadSnapshot loads the snapshot file at path into the cache; see dnsCache.LoadSnapshot.
+func (c *shardedCache) LoadSnapshot(path string) (int, error) {
+	return loadSnapshot(path, c.ReadSnapshot)
+}
+
+// recordSets yields the record sets of each shard from least to most recently used.
+func (c *shardedCache) recordSets(yield func([]domain.ResourceRecord) bool) {
+	for i := range c.shards {
+		for _, entry := range c.shards[i].snapshot() {
+			if !entry.negative && !yield(entry.records) {
+				return
+			}
+		}
+	}
+}
+
+// negativeEntries yields the negative entries of each shard from least to most recently used.
+func (c *shardedCache) negativeEntries(yield func(string, negativeAnswer) bool) {
+	for i := range c.shards {
+		for _, entry := range c.shards[i].snapshot() {
+			if entry.negative && !yield(entry.key, entry.answer) {
+				return
+			}
+		}
+	}
+}
+
+// snapshot copies the shard's entries from least to most recently used, so
+// they can be written out without holding the lock.
+func (s *cacheShard) snapshot() []shardEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := make([]shardEntry, 0, len(s.entries))
+	for elem := s.lru.Back(); elem != nil; elem = elem.Prev() {
+		entries = append(entries, *elem.Value.(*shardEntry))
+	}
+	return entries
+}
+
+// put stores entry in the shard, replacing any entry for the same key, and
+// evicts least recently used entries until the shard fits its budget. An
+// entry larger than the whole budget is not stored. It returns how many other
+// entries were evicted.
+func (s *cacheShard) put(entry *shardEntry) uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, found := s.entries[entry.key]; found {
+		s.remove(elem)
+	}
+	if entry.size > s.maxBytes {
+		return 0
+	}
+	s.entries[entry.key] = s.lru.PushFront(entry)
+	s.size += entry.size
+	var evicted uint64
+	for s.size > s.maxBytes {
+		s.remove(s.lru.Back())
+		evicted++
+	}
+	return evicted
+}
+
+// remove drops elem from the shard. The caller must hold s.mu.
+func (s *cacheShard) remove(elem *list.Element) {
+	entry := s.lru.Remove(elem).(*shardEntry)
+	delete(s.entries, entry.key)
+	s.size -= entry.size
+}
+
+// recordsSize approximates the memory used by an entry holding records under key.
+func recordsSize(key string, records []domain.ResourceRecord) int64 {
+	size := entryOverhead + len(key)
+	for _, record := range records {
+		size += recordOverhead + len(record.Name) + len(record.Data) + len(record.Text)
+	}
+	return int64(size)
+}
+
+// negativeSize approximates the memory used by a negative entry under key.
+func negativeSize(key string) int64 {
+	return int64(entryOverhead + len(key))
+}
+
+var _ resolver.Cache = (*shardedCache)(nil)
@@ -0,0 +1,109 @@
+package dnscache
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+const benchKeys = 4096
+
+// benchCaches builds the entry-bounded and the sharded cache with room for
+// every benchmark key, so the comparison measures locking rather than eviction.
+func benchCaches(b *testing.B) map[string]resolver.Cache {
+	b.Helper()
+	lru, err := New(benchKeys)
+	if err != nil {
+		b.Fatalf("failed to create cache: %v", err)
+	}
+	sharded, err := NewSharded(ShardedOptions{MaxBytes: 64 << 20})
+	if err != nil {
+		b.Fatalf("failed to create sharded cache: %v", err)
+	}
+	return map[string]resolver.Cache{"lru": lru, "sharded": sharded}
+}
+
+// benchRecords returns one cached A record per benchmark key.
+func benchRecords(b *testing.B) [][]domain.ResourceRecord {
+	b.Helper()
+	records := make([][]domain.ResourceRecord, benchKeys)
+	for i := range records {
+		rr, err := domain.NewCachedResourceRecord(
+			fmt.Sprintf("host%d.bench.com.", i),
+			domain.RRTypeFromString("A"),
+			domain.RRClass(1),
+			3600,
+			[]byte{192, 0, 2, byte(i)},
+			fmt.Sprintf("192.0.2.%d", byte(i)),
+			time.Now(),
+		)
+		if err != nil {
+			b.Fatalf("failed to create record: %v", err)
+		}
+		records[i] = []domain.ResourceRecord{rr}
+	}
+	return records
+}
+
+// BenchmarkCache_ParallelGet compares cache hits from many goroutines at once.
+func BenchmarkCache_ParallelGet(b *testing.B) {
+	records := benchRecords(b)
+	for _, name := range []string{"lru", "sharded"} {
+		b.Run(name, func(b *testing.B) {
+			cache := benchCaches(b)[name]
+			keys := make([]string, len(records))
+			for i, rrs := range records {
+				if err := cache.Set(rrs); err != nil {
+					b.Fatalf("failed to set records: %v", err)
+				}
+				keys[i] = rrs[0].CacheKey()
+			}
+			var next atomic.Uint64
+			b.SetParallelism(16)
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := next.Add(7919)
+				for pb.Next() {
+					_, _ = cache.Get(keys[i%benchKeys])
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkCache_ParallelMixed compares a read-mostly workload (one Set per
+// nine Gets) from many goroutines at once.
+func BenchmarkCache_ParallelMixed(b *testing.B) {
+	records := benchRecords(b)
+	for _, name := range []string{"lru", "sharded"} {
+		b.Run(name, func(b *testing.B) {
+			cache := benchCaches(b)[name]
+			keys := make([]string, len(records))
+			for i, rrs := range records {
+				keys[i] = rrs[0].CacheKey()
+			}
+			var next atomic.Uint64
+			b.SetParallelism(16)
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := next.Add(7919)
+				for pb.Next() {
+					n := i % benchKeys
+					if i%10 == 0 {
+						_ = cache.Set(records[n])
+					} else {
+						_, _ = cache.Get(keys[n])
+					}
+					i++
+				}
+			})
+		})
+	}
+}
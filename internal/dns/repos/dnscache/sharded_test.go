@@ -0,0 +1,313 @@
+package dnscache
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+func newShardedTestRecord(t testing.TB, name string, ttl uint32, created time.Time) domain.ResourceRecord {
+	t.Helper()
+	rr, err := domain.NewCachedResourceRecord(name, domain.RRTypeA, domain.RRClass(1), ttl, []byte{192, 0, 2, 1}, "192.0.2.1", created)
+	if err != nil {
+		t.Fatalf("failed to create resource record: %v", err)
+	}
+	return rr
+}
+
+func TestNewSharded_InvalidOptions(t *testing.T) {
+	tests := map[string]ShardedOptions{
+		"zero max bytes":        {},
+		"negative shards":       {MaxBytes: 1 << 20, Shards: -1},
+		"negative stale window": {MaxBytes: 1 << 20, StaleWindow: -time.Second},
+	}
+	for name, opts := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewSharded(opts); err == nil {
+				t.Errorf("expected error for %+v", opts)
+			}
+		})
+	}
+
+	cache, err := NewSharded(ShardedOptions{MaxBytes: 1 << 20})
+	if err != nil {
+		t.Fatalf("NewSharded() returned error: %v", err)
+	}
+	if len(cache.shards) != defaultShards {
+		t.Errorf("expected %d shards, got %d", defaultShards, len(cache.shards))
+	}
+}
+
+func TestShardedCache_SetGetDelete(t *testing.T) {
+	cache, err := NewSharded(ShardedOptions{MaxBytes: 1 << 20, Shards: 4})
+	if err != nil {
+		t.Fatalf("NewSharded() returned error: %v", err)
+	}
+	rr := newShardedTestRecord(t, "example.com.", 300, time.Now())
+
+	if err := cache.Set([]domain.ResourceRecord{rr}); err != nil {
+		t.Fatalf("Set() returned error: %v", err)
+	}
+	got, ok := cache.Get(rr.CacheKey())
+	if !ok || len(got) != 1 || got[0].Text != rr.Text {
+		t.Fatalf("expected cached record, got %v (found %v)", got, ok)
+	}
+	if cache.Len() != 1 || len(cache.Keys()) != 1 || cache.Bytes() != recordsSize(rr.CacheKey(), got) {
+		t.Errorf("unexpected len %d, keys %v, bytes %d", cache.Len(), cache.Keys(), cache.Bytes())
+	}
+
+	cache.Delete(rr.CacheKey())
+	if _, ok := cache.Get(rr.CacheKey()); ok {
+		t.Error("expected record to be deleted")
+	}
+	if cache.Bytes() != 0 {
+		t.Errorf("expected 0 bytes after delete, got %d", cache.Bytes())
+	}
+	cache.Delete("missing")
+
+	other := newShardedTestRecord(t, "other.com.", 300, time.Now())
+	if err := cache.Set([]domain.ResourceRecord{rr, other}); err != ErrMultipleKeys {
+		t.Errorf("expected ErrMultipleKeys, got %v", err)
+	}
+	if err := cache.Set(nil); err != nil {
+		t.Errorf("expected no error for empty set, got %v", err)
+	}
+}
+
+func TestShardedCache_Expiry(t *testing.T) {
+	cache, err := NewSharded(ShardedOptions{MaxBytes: 1 << 20, Shards: 1, StaleWindow: time.Minute})
+	if err != nil {
+		t.Fatalf("NewSharded() returned error: %v", err)
+	}
+	fresh := newShardedTestRecord(t, "example.com.", 300, time.Now())
+	stale := newShardedTestRecord(t, "example.com.", 60, time.Now().Add(-90*time.Second))
+	gone := newShardedTestRecord(t, "example.com.", 60, time.Now().Add(-time.Hour))
+	if err := cache.Set([]domain.ResourceRecord{fresh, stale, gone}); err != nil {
+		t.Fatalf("Set() returned error: %v", err)
+	}
+
+	got, ok := cache.Get(fresh.CacheKey())
+	if !ok || len(got) != 1 {
+		t.Fatalf("expected only the fresh record, got %v", got)
+	}
+	staleRecords, ok := cache.GetStale(fresh.CacheKey())
+	if !ok || len(staleRecords) != 1 {
+		t.Errorf("expected the stale record, got %v", staleRecords)
+	}
+	if want := recordsSize(fresh.CacheKey(), []domain.ResourceRecord{fresh, stale}); cache.Bytes() != want {
+		t.Errorf("expected dropped records to free their bytes: got %d, want %d", cache.Bytes(), want)
+	}
+
+	expiredOnly := newShardedTestRecord(t, "expired.com.", 60, time.Now().Add(-time.Hour))
+	if err := cache.Set([]domain.ResourceRecord{expiredOnly}); err != nil {
+		t.Fatalf("Set() returned error: %v", err)
+	}
+	if _, ok := cache.Get(expiredOnly.CacheKey()); ok {
+		t.Error("expected expired record to miss")
+	}
+	if cache.Len() != 1 {
+		t.Errorf("expected expired entry to be removed, got %d entries", cache.Len())
+	}
+
+	noStale, _ := NewSharded(ShardedOptions{MaxBytes: 1 << 20})
+	if _, ok := noStale.GetStale(fresh.CacheKey()); ok {
+		t.Error("expected no stale records without a stale window")
+	}
+}
+
+func TestShardedCache_Negative(t *testing.T) {
+	clk := &clock.MockClock{CurrentTime: time.Now()}
+	cache, err := NewSharded(ShardedOptions{MaxBytes: 1 << 20, Shards: 2, Clock: clk})
+	if err != nil {
+		t.Fatalf("NewSharded() returned error: %v", err)
+	}
+	rr := newShardedTestRecord(t, "example.com.", 300, clk.Now())
+	key := rr.CacheKey()
+
+	if err := cache.Set([]domain.ResourceRecord{rr}); err != nil {
+		t.Fatalf("Set() returned error: %v", err)
+	}
+	if _, ok := cache.GetNegative(key); ok {
+		t.Error("expected records to have no negative RCODE")
+	}
+	cache.SetNegative(key, domain.NXDOMAIN, time.Minute)
+	if got, ok := cache.Get(key); !ok || got == nil || len(got) != 0 {
+		t.Errorf("expected negative entry to replace records, got %v (found %v)", got, ok)
+	}
+	if rcode, ok := cache.GetNegative(key); !ok || rcode != domain.NXDOMAIN {
+		t.Errorf("expected NXDOMAIN negative entry, got %v (found %v)", rcode, ok)
+	}
+	if _, ok := cache.GetStale(key); ok {
+		t.Error("negative entries are never served stale")
+	}
+	if cache.Len() != 1 {
+		t.Errorf("expected 1 entry, got %d", cache.Len())
+	}
+
+	cache.SetNegative(key, domain.NXDOMAIN, 0)
+	if _, ok := cache.Get(key); !ok {
+		t.Error("expected zero ttl to be ignored")
+	}
+
+	clk.Advance(time.Minute)
+	if _, ok := cache.GetNegative(key); ok {
+		t.Error("expected expired negative entry to have no RCODE")
+	}
+	if _, ok := cache.Get(key); ok {
+		t.Error("expected expired negative entry to miss")
+	}
+	if cache.Len() != 0 {
+		t.Errorf("expected expired negative entry to be removed, got %d entries", cache.Len())
+	}
+}
+
+func TestShardedCache_Clock(t *testing.T) {
+	created := time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC)
+	clk := &clock.MockClock{CurrentTime: created}
+	cache, err := NewSharded(ShardedOptions{MaxBytes: 1 << 20, StaleWindow: time.Minute, Clock: clk})
+	if err != nil {
+		t.Fatalf("NewSharded() returned error: %v", err)
+	}
+	rr := newShardedTestRecord(t, "example.com.", 60, created)
+	if err := cache.Set([]domain.ResourceRecord{rr}); err != nil {
+		t.Fatalf("Set() returned error: %v", err)
+	}
+
+	clk.Advance(59 * time.Second)
+	if got, ok := cache.Get(rr.CacheKey()); !ok || got[0].TTL(clk.Now()) != 1 {
+		t.Errorf("expected record with 1s left, got %v (found %v)", got, ok)
+	}
+	clk.Advance(30 * time.Second)
+	if _, ok := cache.Get(rr.CacheKey()); ok {
+		t.Error("expected record to have expired")
+	}
+	if stale, ok := cache.GetStale(rr.CacheKey()); !ok || len(stale) != 1 {
+		t.Errorf("expected record to be served stale, got %v", stale)
+	}
+	clk.Advance(time.Minute)
+	if _, ok := cache.Get(rr.CacheKey()); ok || cache.Len() != 0 {
+		t.Errorf("expected record to be removed after the stale window, got %d entries", cache.Len())
+	}
+}
+
+func TestShardedCache_EvictsByBytes(t *testing.T) {
+	small := newShardedTestRecord(t, "a.example.com.", 300, time.Now())
+	entrySize := recordsSize(small.CacheKey(), []domain.ResourceRecord{small})
+	cache, err := NewSharded(ShardedOptions{MaxBytes: 3 * entrySize, Shards: 1})
+	if err != nil {
+		t.Fatalf("NewSharded() returned error: %v", err)
+	}
+
+	names := []string{"a.example.com.", "b.example.com.", "c.example.com."}
+	for _, name := range names {
+		if err := cache.Set([]domain.ResourceRecord{newShardedTestRecord(t, name, 300, time.Now())}); err != nil {
+			t.Fatalf("Set() returned error: %v", err)
+		}
+	}
+	// Touch a so b is the least recently used entry
+	cache.Get(small.CacheKey())
+	if err := cache.Set([]domain.ResourceRecord{newShardedTestRecord(t, "d.example.com.", 300, time.Now())}); err != nil {
+		t.Fatalf("Set() returned error: %v", err)
+	}
+	if cache.Len() != 3 || cache.Bytes() > 3*entrySize {
+		t.Errorf("expected 3 entries within budget, got %d using %d bytes", cache.Len(), cache.Bytes())
+	}
+	bKey := domain.GenerateCacheKey("b.example.com.", domain.RRTypeA, domain.RRClass(1))
+	if _, ok := cache.Get(bKey); ok {
+		t.Error("expected least recently used entry to be evicted")
+	}
+
+	// One large RRset counts for many small ones
+	var large []domain.ResourceRecord
+	for range 2 {
+		rr, err := domain.NewCachedResourceRecord("txt.example.com.", domain.RRTypeTXT, domain.RRClass(1), 300, bytes.Repeat([]byte{'x'}, int(entrySize)), "x", time.Now())
+		if err != nil {
+			t.Fatalf("failed to create resource record: %v", err)
+		}
+		large = append(large, rr)
+	}
+	if err := cache.Set(large); err != nil {
+		t.Fatalf("Set() returned error: %v", err)
+	}
+	if _, ok := cache.Get(large[0].CacheKey()); ok || cache.Len() != 3 {
+		t.Errorf("expected an RRset larger than the budget not to be cached, got %d entries", cache.Len())
+	}
+	if err := cache.Set(large[:1]); err != nil {
+		t.Fatalf("Set() returned error: %v", err)
+	}
+	if _, ok := cache.Get(large[0].CacheKey()); !ok || cache.Len() != 2 || cache.Bytes() > 3*entrySize {
+		t.Errorf("expected the large RRset to evict two small entries, got %d entries using %d bytes", cache.Len(), cache.Bytes())
+	}
+}
+
+func TestShardedCache_Snapshot(t *testing.T) {
+	src, err := NewSharded(ShardedOptions{MaxBytes: 1 << 20, Shards: 4})
+	if err != nil {
+		t.Fatalf("NewSharded() returned error: %v", err)
+	}
+	rr := newShardedTestRecord(t, "example.com.", 300, time.Now())
+	if err := src.Set([]domain.ResourceRecord{rr}); err != nil {
+		t.Fatalf("Set() returned error: %v", err)
+	}
+	negativeKey := domain.GenerateCacheKey("nope.example.com.", domain.RRTypeA, domain.RRClass(1))
+	src.SetNegative(negativeKey, domain.NXDOMAIN, time.Minute)
+
+	var buf bytes.Buffer
+	if err := src.WriteSnapshot(&buf); err != nil {
+		t.Fatalf("WriteSnapshot() returned error: %v", err)
+	}
+	// Snapshots move between cache implementations
+	dst, _ := New(10)
+	if loaded, err := dst.ReadSnapshot(bytes.NewReader(buf.Bytes())); err != nil || loaded != 2 {
+		t.Fatalf("expected 2 entries loaded, got %d (err %v)", loaded, err)
+	}
+	back, _ := NewSharded(ShardedOptions{MaxBytes: 1 << 20})
+	if loaded, err := back.ReadSnapshot(&buf); err != nil || loaded != 2 {
+		t.Fatalf("expected 2 entries loaded, got %d (err %v)", loaded, err)
+	}
+	if _, ok := back.Get(rr.CacheKey()); !ok {
+		t.Error("expected record from snapshot")
+	}
+
+	path := t.TempDir() + "/cache.snapshot"
+	if err := back.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot() returned error: %v", err)
+	}
+	fromFile, _ := NewSharded(ShardedOptions{MaxBytes: 1 << 20})
+	if loaded, err := fromFile.LoadSnapshot(path); err != nil || loaded != 2 {
+		t.Errorf("expected 2 entries loaded from file, got %d (err %v)", loaded, err)
+	}
+}
+
+func TestShardedCache_Concurrent(t *testing.T) {
+	cache, err := NewSharded(ShardedOptions{MaxBytes: 64 << 10, Shards: 8, StaleWindow: time.Minute})
+	if err != nil {
+		t.Fatalf("NewSharded() returned error: %v", err)
+	}
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 500 {
+				rr := newShardedTestRecord(t, fmt.Sprintf("host%d.example.com.", (g*500+i)%300), 300, time.Now())
+				_ = cache.Set([]domain.ResourceRecord{rr})
+				cache.Get(rr.CacheKey())
+				cache.GetStale(rr.CacheKey())
+				if i%50 == 0 {
+					cache.Delete(rr.CacheKey())
+					cache.Keys()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if cache.Bytes() > 64<<10 {
+		t.Errorf("expected cache to stay within its budget, got %d bytes", cache.Bytes())
+	}
+}
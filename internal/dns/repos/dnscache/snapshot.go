@@ -0,0 +1,383 @@
+package dnscache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// Snapshot file layout (fixed-size integers are big-endian):
+//
+//	magic   "RRDC"
+//	version uint16
+//	entries, each starting with a kind byte:
+//	  kindRecords:  count uvarint, then per record:
+//	                name, type uint16, class uint16, ttl uint32,
+//	                expiresAt int64 (Unix ns), flags uint8, data, text
+//	  kindNegative: key, rcode uint8, expiresAt int64 (Unix ns)
+//	  kindEnd:      end of snapshot
+//
+// Strings and byte slices are written as a uvarint length followed by the bytes.
+// Records, then negative entries, are written from least to most recently used,
+// so loading them in order restores each LRU's order.
+const (
+	snapshotMagic   = "RRDC"
+	snapshotVersion = 2
+
+	kindEnd      byte = 0
+	kindRecords  byte = 1
+	kindNegative byte = 2
+
+	flagAuthenticated byte = 1 << 0
+
+	// maxSnapshotField bounds strings and byte slices read from a snapshot, so a
+	// corrupt file cannot make the loader allocate more than a DNS message holds.
+	maxSnapshotField = 65535
+)
+
+var (
+	ErrSnapshotFormat  = errors.New("not a cache snapshot")
+	ErrSnapshotVersion = errors.New("unsupported cache snapshot version")
+)
+
+// WriteSnapshot writes every unexpired cache entry to w. Records kept only for
+// serve-stale and expired negative entries are left out.
+func (c *dnsCache) WriteSnapshot(w io.Writer) error {
+	return writeSnapshot(w, c.recordSets, c.negativeEntries, c.clock.Now())
+}
+
+// ReadSnapshot loads the entries of a snapshot written by WriteSnapshot into
+// the cache and returns how many it loaded. Remaining TTLs are recomputed from
+// the stored expiry times, and entries that have expired since are dropped.
+// Entries read before an error are kept.
+func (c *dnsCache) ReadSnapshot(r io.Reader) (int, error) {
+	return readSnapshot(r, c, c.clock.Now())
+}
+
+// SaveSnapshot writes the cache to a snapshot file at path. The file is written
+// under a temporary name and renamed into place, so a crash never leaves a
+// truncated snapshot behind.
+func (c *dnsCache) SaveSnapshot(path string) error {
+	return saveSnapshot(path, c.WriteSnapshot)
+}
+
+// LoadSnapshot loads the snapshot file at path into the cache and returns how
+// many entries it loaded. A missing file is not an error; there is simply
+// nothing to load on a first start.
+func (c *dnsCache) LoadSnapshot(path string) (int, error) {
+	return loadSnapshot(path, c.ReadSnapshot)
+}
+
+// recordSets yields the record sets of the cache from least to most recently used.
+func (c *dnsCache) recordSets(yield func([]domain.ResourceRecord) bool) {
+	for _, key := range c.lru.Keys() {
+		if records, found := c.lru.Peek(key); found && !yield(records) {
+			return
+		}
+	}
+}
+
+// negativeEntries yields the negative entries of the cache from least to most recently used.
+func (c *dnsCache) negativeEntries(yield func(string, negativeAnswer) bool) {
+	for _, key := range c.negative.Keys() {
+		if answer, found := c.negative.Peek(key); found && !yield(key, answer) {
+			return
+		}
+	}
+}
+
+// snapshotTarget is a cache that snapshot entries can be loaded into.
+type snapshotTarget interface {
+	Set(records []domain.ResourceRecord) error
+	SetNegative(key string, rcode domain.RCode, ttl time.Duration)
+}
+
+// writeSnapshot writes the record sets and negative entries unexpired at now to w.
+func writeSnapshot(w io.Writer, recordSets iter.Seq[[]domain.ResourceRecord], negatives iter.Seq2[string, negativeAnswer], now time.Time) error {
+	bw := bufio.NewWriter(w)
+	sw := snapshotWriter{w: bw}
+	sw.bytes([]byte(snapshotMagic))
+	sw.uint16(snapshotVersion)
+
+	for records := range recordSets {
+		var live []domain.ResourceRecord
+		for _, record := range records {
+			if record.ExpiresAt().After(now) {
+				live = append(live, record)
+			}
+		}
+		if len(live) == 0 {
+			continue
+		}
+		sw.byte(kindRecords)
+		sw.uvarint(uint64(len(live)))
+		for _, record := range live {
+			sw.writeRecord(record)
+		}
+	}
+	for key, answer := range negatives {
+		if !answer.expiresAt.After(now) {
+			continue
+		}
+		sw.byte(kindNegative)
+		sw.string(key)
+		sw.byte(byte(answer.rcode))
+		sw.int64(answer.expiresAt.UnixNano())
+	}
+	sw.byte(kindEnd)
+	if sw.err != nil {
+		return sw.err
+	}
+	return bw.Flush()
+}
+
+// readSnapshot loads the entries of a snapshot from r into c, dropping those
+// expired at now, and returns how many it loaded.
+func readSnapshot(r io.Reader, c snapshotTarget, now time.Time) (int, error) {
+	sr := snapshotReader{r: bufio.NewReader(r)}
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(sr.r, magic); err != nil || string(magic) != snapshotMagic {
+		return 0, ErrSnapshotFormat
+	}
+	if version := sr.uint16(); sr.err != nil {
+		return 0, ErrSnapshotFormat
+	} else if version != snapshotVersion {
+		return 0, fmt.Errorf("%w: %d", ErrSnapshotVersion, version)
+	}
+
+	loaded := 0
+	for {
+		kind := sr.byte()
+		if sr.err != nil {
+			return loaded, fmt.Errorf("%w: %v", ErrSnapshotFormat, sr.err)
+		}
+		switch kind {
+		case kindEnd:
+			return loaded, nil
+		case kindRecords:
+			count := sr.length()
+			var records []domain.ResourceRecord
+			for range count {
+				record, ok := sr.readRecord(now)
+				if ok {
+					records = append(records, record)
+				}
+			}
+			if sr.err != nil {
+				return loaded, fmt.Errorf("%w: %v", ErrSnapshotFormat, sr.err)
+			}
+			if len(records) > 0 && c.Set(records) == nil {
+				loaded++
+			}
+		case kindNegative:
+			key := sr.string()
+			rcode := domain.RCode(sr.byte())
+			expiresAt := time.Unix(0, sr.int64())
+			if sr.err != nil {
+				return loaded, fmt.Errorf("%w: %v", ErrSnapshotFormat, sr.err)
+			}
+			if ttl := expiresAt.Sub(now); ttl > 0 {
+				c.SetNegative(key, rcode, ttl)
+				loaded++
+			}
+		default:
+			return loaded, fmt.Errorf("%w: unknown entry kind %d", ErrSnapshotFormat, kind)
+		}
+	}
+}
+
+// saveSnapshot writes a snapshot with write to a temporary file next to path
+// and renames it into place.
+func saveSnapshot(path string, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if err := write(tmp); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// loadSnapshot opens the snapshot file at path and loads it with read.
+// A missing file loads nothing.
+func loadSnapshot(path string, read func(io.Reader) (int, error)) (int, error) {
+	//gosec:disable G304 -- the path comes from operator configuration
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+	return read(f)
+}
+
+// snapshotWriter encodes snapshot fields, remembering the first write error.
+type snapshotWriter struct {
+	w   *bufio.Writer
+	err error
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (sw *snapshotWriter) bytes(b []byte) {
+	if sw.err == nil {
+		_, sw.err = sw.w.Write(b)
+	}
+}
+
+func (sw *snapshotWriter) byte(b byte) {
+	if sw.err == nil {
+		sw.err = sw.w.WriteByte(b)
+	}
+}
+
+func (sw *snapshotWriter) uint16(v uint16) {
+	sw.bytes(binary.BigEndian.AppendUint16(sw.buf[:0], v))
+}
+
+func (sw *snapshotWriter) uint32(v uint32) {
+	sw.bytes(binary.BigEndian.AppendUint32(sw.buf[:0], v))
+}
+
+func (sw *snapshotWriter) int64(v int64) {
+	//gosec:disable G115 -- two's complement round trip, decoded by snapshotReader.int64
+	sw.bytes(binary.BigEndian.AppendUint64(sw.buf[:0], uint64(v)))
+}
+
+func (sw *snapshotWriter) uvarint(v uint64) {
+	sw.bytes(binary.AppendUvarint(sw.buf[:0], v))
+}
+
+func (sw *snapshotWriter) field(b []byte) {
+	sw.uvarint(uint64(len(b)))
+	sw.bytes(b)
+}
+
+func (sw *snapshotWriter) string(s string) {
+	sw.field([]byte(s))
+}
+
+func (sw *snapshotWriter) writeRecord(record domain.ResourceRecord) {
+	var flags byte
+	if record.Authenticated {
+		flags |= flagAuthenticated
+	}
+	sw.string(record.Name)
+	sw.uint16(uint16(record.Type))
+	sw.uint16(uint16(record.Class))
+	sw.uint32(record.OriginalTTL())
+	sw.int64(record.ExpiresAt().UnixNano())
+	sw.byte(flags)
+	sw.field(record.Data)
+	sw.string(record.Text)
+}
+
+// snapshotReader decodes snapshot fields, remembering the first read error.
+// Once an error occurs every further read returns a zero value.
+type snapshotReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (sr *snapshotReader) full(n int) []byte {
+	if sr.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	_, sr.err = io.ReadFull(sr.r, b)
+	return b
+}
+
+func (sr *snapshotReader) byte() byte {
+	if sr.err != nil {
+		return 0
+	}
+	var b byte
+	b, sr.err = sr.r.ReadByte()
+	return b
+}
+
+func (sr *snapshotReader) uint16() uint16 {
+	if b := sr.full(2); sr.err == nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (sr *snapshotReader) uint32() uint32 {
+	if b := sr.full(4); sr.err == nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (sr *snapshotReader) int64() int64 {
+	if b := sr.full(8); sr.err == nil {
+		//gosec:disable G115 -- two's complement round trip of snapshotWriter.int64
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+// length reads a uvarint length, rejecting lengths above maxSnapshotField.
+func (sr *snapshotReader) length() int {
+	if sr.err != nil {
+		return 0
+	}
+	n, err := binary.ReadUvarint(sr.r)
+	if err != nil {
+		sr.err = err
+		return 0
+	}
+	if n > maxSnapshotField {
+		sr.err = fmt.Errorf("field length %d exceeds %d", n, maxSnapshotField)
+		return 0
+	}
+	return int(n)
+}
+
+func (sr *snapshotReader) field() []byte {
+	return sr.full(sr.length())
+}
+
+func (sr *snapshotReader) string() string {
+	return string(sr.field())
+}
+
+// readRecord decodes one record, rebuilding it so it expires at its stored
+// expiry time. ok is false when the record has expired or cannot be rebuilt.
+func (sr *snapshotReader) readRecord(now time.Time) (domain.ResourceRecord, bool) {
+	name := sr.string()
+	rrtype := domain.RRType(sr.uint16())
+	class := domain.RRClass(sr.uint16())
+	ttl := sr.uint32()
+	expiresAt := time.Unix(0, sr.int64())
+	flags := sr.byte()
+	data := sr.field()
+	text := sr.string()
+	if sr.err != nil || !expiresAt.After(now) {
+		return domain.ResourceRecord{}, false
+	}
+	created := expiresAt.Add(-time.Duration(ttl) * time.Second)
+	record, err := domain.NewCachedResourceRecord(name, rrtype, class, ttl, data, text, created)
+	if err != nil {
+		return domain.ResourceRecord{}, false
+	}
+	record.Authenticated = flags&flagAuthenticated != 0
+	return record, true
+}
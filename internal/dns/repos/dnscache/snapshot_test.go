@@ -0,0 +1,177 @@
+package dnscache
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+func newSnapshotRecord(t *testing.T, name string, ttl uint32, created time.Time) domain.ResourceRecord {
+	t.Helper()
+	rr, err := domain.NewCachedResourceRecord(name, domain.RRTypeA, domain.RRClass(1), ttl, []byte{192, 0, 2, 1}, "192.0.2.1", created)
+	if err != nil {
+		t.Fatalf("failed to create resource record: %v", err)
+	}
+	return rr
+}
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	src, err := New(10)
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	now := time.Now()
+	first := newSnapshotRecord(t, "a.example.com.", 300, now.Add(-100*time.Second))
+	first.Authenticated = true
+	second := newSnapshotRecord(t, "b.example.com.", 60, now)
+	expired := newSnapshotRecord(t, "c.example.com.", 60, now.Add(-2*time.Minute))
+	negativeKey := domain.GenerateCacheKey("nope.example.com.", domain.RRTypeA, domain.RRClass(1))
+	for _, records := range [][]domain.ResourceRecord{{first}, {second}, {expired}} {
+		if err := src.Set(records); err != nil {
+			t.Fatalf("failed to set records: %v", err)
+		}
+	}
+	src.SetNegative(negativeKey, domain.NXDOMAIN, time.Minute)
+
+	var buf bytes.Buffer
+	if err := src.WriteSnapshot(&buf); err != nil {
+		t.Fatalf("WriteSnapshot() returned error: %v", err)
+	}
+
+	dst, err := New(10)
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	loaded, err := dst.ReadSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("ReadSnapshot() returned error: %v", err)
+	}
+	if loaded != 3 {
+		t.Errorf("expected 3 entries loaded, got %d", loaded)
+	}
+	keys := dst.Keys()
+	if len(keys) != 3 || keys[0] != first.CacheKey() || keys[1] != second.CacheKey() {
+		t.Errorf("expected least recently used order to be kept, got %v", keys)
+	}
+
+	got, ok := dst.Get(first.CacheKey())
+	if !ok || len(got) != 1 {
+		t.Fatalf("expected restored record, got %v", got)
+	}
+	if !got[0].ExpiresAt().Equal(first.ExpiresAt()) {
+		t.Errorf("expected expiry %v, got %v", first.ExpiresAt(), got[0].ExpiresAt())
+	}
+	if got[0].OriginalTTL() != 300 || got[0].TTL(time.Now()) > 200 {
+		t.Errorf("expected original ttl 300 and about 200s remaining, got %d and %d", got[0].OriginalTTL(), got[0].TTL(time.Now()))
+	}
+	if !got[0].Authenticated || got[0].Text != "192.0.2.1" || !bytes.Equal(got[0].Data, first.Data) {
+		t.Errorf("restored record differs: %+v", got[0])
+	}
+	if _, ok := dst.Get(expired.CacheKey()); ok {
+		t.Error("expected expired record to be dropped")
+	}
+	if records, ok := dst.Get(negativeKey); !ok || len(records) != 0 {
+		t.Errorf("expected restored negative entry, got %v (found %v)", records, ok)
+	}
+	if rcode, ok := dst.GetNegative(negativeKey); !ok || rcode != domain.NXDOMAIN {
+		t.Errorf("expected restored NXDOMAIN, got %v (found %v)", rcode, ok)
+	}
+}
+
+func TestSnapshot_DropsEntriesExpiredSinceWrite(t *testing.T) {
+	src, err := New(10)
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	rr := newSnapshotRecord(t, "a.example.com.", 1, time.Now().Add(-999*time.Millisecond))
+	if err := src.Set([]domain.ResourceRecord{rr}); err != nil {
+		t.Fatalf("failed to set record: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := src.WriteSnapshot(&buf); err != nil {
+		t.Fatalf("WriteSnapshot() returned error: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	dst, _ := New(10)
+	loaded, err := dst.ReadSnapshot(&buf)
+	if err != nil {
+		t.Fatalf("ReadSnapshot() returned error: %v", err)
+	}
+	if loaded != 0 || dst.Len() != 0 {
+		t.Errorf("expected nothing loaded, got %d entries", loaded)
+	}
+}
+
+func TestSnapshot_InvalidInput(t *testing.T) {
+	var valid bytes.Buffer
+	src, _ := New(10)
+	if err := src.Set([]domain.ResourceRecord{newSnapshotRecord(t, "a.example.com.", 300, time.Now())}); err != nil {
+		t.Fatalf("failed to set record: %v", err)
+	}
+	if err := src.WriteSnapshot(&valid); err != nil {
+		t.Fatalf("WriteSnapshot() returned error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{name: "empty", data: nil, wantErr: ErrSnapshotFormat},
+		{name: "wrong magic", data: []byte("XXXX\x00\x01\x00"), wantErr: ErrSnapshotFormat},
+		{name: "previous version", data: []byte("RRDC\x00\x01\x00"), wantErr: ErrSnapshotVersion},
+		{name: "future version", data: []byte("RRDC\x00\x03\x00"), wantErr: ErrSnapshotVersion},
+		{name: "truncated", data: valid.Bytes()[:valid.Len()-3], wantErr: ErrSnapshotFormat},
+		{name: "unknown entry kind", data: []byte("RRDC\x00\x02\x07"), wantErr: ErrSnapshotFormat},
+		{name: "oversized field", data: []byte("RRDC\x00\x02\x02\xff\xff\x7f"), wantErr: ErrSnapshotFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, _ := New(10)
+			if _, err := cache.ReadSnapshot(bytes.NewReader(tt.data)); !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSnapshot_SaveAndLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.snapshot")
+
+	empty, _ := New(10)
+	if loaded, err := empty.LoadSnapshot(path); err != nil || loaded != 0 {
+		t.Fatalf("expected missing snapshot to load nothing, got %d (err %v)", loaded, err)
+	}
+
+	src, _ := New(10)
+	rr := newSnapshotRecord(t, "a.example.com.", 300, time.Now())
+	if err := src.Set([]domain.ResourceRecord{rr}); err != nil {
+		t.Fatalf("failed to set record: %v", err)
+	}
+	if err := src.SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot() returned error: %v", err)
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected only the snapshot file, got %v (err %v)", entries, err)
+	}
+
+	dst, _ := New(10)
+	loaded, err := dst.LoadSnapshot(path)
+	if err != nil || loaded != 1 {
+		t.Fatalf("expected 1 entry loaded, got %d (err %v)", loaded, err)
+	}
+	if _, ok := dst.Get(rr.CacheKey()); !ok {
+		t.Error("expected record from snapshot file")
+	}
+
+	if err := src.SaveSnapshot(filepath.Join(path, "not-a-dir", "cache.snapshot")); err == nil {
+		t.Error("expected error saving to a missing directory")
+	}
+}
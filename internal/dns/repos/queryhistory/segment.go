@@ -0,0 +1,221 @@
+package queryhistory
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+const (
+	// segmentSpan is the stretch of query time each segment holds.
+	segmentSpan = time.Hour
+	// segmentPrefix, segmentLayout and segmentSuffix name segment files after
+	// the UTC hour they start at, as in "queries-2025060112.jsonl".
+	segmentPrefix = "queries-"
+	segmentLayout = "2006010215"
+	segmentSuffix = ".jsonl"
+)
+
+// segment holds the records of one segmentSpan of query time, in the order
+// they were recorded, with indexes from client, response code and blocked
+// status to their positions.
+type segment struct {
+	start    time.Time
+	records  []resolver.QueryRecord
+	byClient map[string][]int
+	byRCode  map[domain.RCode][]int
+	blocked  []int
+}
+
+// newSegment returns an empty segment for the span starting at start.
+func newSegment(start time.Time) *segment {
+	return &segment{
+		start:    start,
+		byClient: make(map[string][]int),
+		byRCode:  make(map[domain.RCode][]int),
+	}
+}
+
+// segmentStart returns the start of the segment holding records from t.
+func segmentStart(t time.Time) time.Time {
+	return t.UTC().Truncate(segmentSpan)
+}
+
+// end returns the end of the segment's span, exclusive.
+func (s *segment) end() time.Time {
+	return s.start.Add(segmentSpan)
+}
+
+// add appends r and indexes it.
+func (s *segment) add(r resolver.QueryRecord) {
+	pos := len(s.records)
+	s.records = append(s.records, r)
+	if r.Client != "" {
+		s.byClient[r.Client] = append(s.byClient[r.Client], pos)
+	}
+	s.byRCode[r.RCode] = append(s.byRCode[r.RCode], pos)
+	if r.Blocked() {
+		s.blocked = append(s.blocked, pos)
+	}
+}
+
+// overlaps reports whether the segment's span can hold records in the time
+// range of f.
+func (s *segment) overlaps(f resolver.QueryFilter) bool {
+	if !f.Since.IsZero() && !s.end().After(f.Since) {
+		return false
+	}
+	return f.Until.IsZero() || s.start.Before(f.Until)
+}
+
+// candidates returns the positions of the records that can match f, from the
+// smallest index that applies. all is true when no index applies and every
+// record has to be checked.
+func (s *segment) candidates(f resolver.QueryFilter) (positions []int, all bool) {
+	all = true
+	use := func(index []int) {
+		if all || len(index) < len(positions) {
+			positions, all = index, false
+		}
+	}
+	if f.Client != "" {
+		use(s.byClient[f.Client])
+	}
+	if f.RCode != nil {
+		use(s.byRCode[*f.RCode])
+	}
+	if f.Blocked != nil && *f.Blocked {
+		use(s.blocked)
+	}
+	return positions, all
+}
+
+// search returns the records matching f, newest first.
+func (s *segment) search(f resolver.QueryFilter) []resolver.QueryRecord {
+	var matches []resolver.QueryRecord
+	check := func(r resolver.QueryRecord) {
+		if f.Matches(r) {
+			matches = append(matches, r)
+		}
+	}
+	if positions, all := s.candidates(f); all {
+		for _, r := range s.records {
+			check(r)
+		}
+	} else {
+		for _, pos := range positions {
+			check(s.records[pos])
+		}
+	}
+	// Records are appended as queries finish, so a slow query can follow a
+	// later one; sort by the time each query started.
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Time.After(matches[j].Time)
+	})
+	return matches
+}
+
+// segmentPath returns the file of the segment starting at start in dir.
+func segmentPath(dir string, start time.Time) string {
+	return filepath.Join(dir, segmentPrefix+start.UTC().Format(segmentLayout)+segmentSuffix)
+}
+
+// parseSegmentName returns the start of the segment stored in the file name,
+// and false for files that are not segments.
+func parseSegmentName(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+		return time.Time{}, false
+	}
+	stamp := strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix)
+	start, err := time.Parse(segmentLayout, stamp)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return start, true
+}
+
+// line is the stored form of a record: one JSON object per line of a segment file.
+type line struct {
+	Time     time.Time     `json:"time"`
+	Client   string        `json:"client,omitempty"`
+	Name     string        `json:"name"`
+	Type     uint16        `json:"type"`
+	RCode    uint8         `json:"rcode"`
+	Answers  []string      `json:"answers,omitempty"`
+	Source   string        `json:"source"`
+	Upstream string        `json:"upstream,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// newLine returns the stored form of r.
+func newLine(r resolver.QueryRecord) line {
+	return line{
+		Time:     r.Time.UTC(),
+		Client:   r.Client,
+		Name:     r.Name,
+		Type:     uint16(r.Type),
+		RCode:    uint8(r.RCode),
+		Answers:  r.Answers,
+		Source:   string(r.Source),
+		Upstream: r.Upstream,
+		Duration: r.Duration,
+	}
+}
+
+// record returns the record stored as l.
+func (l line) record() resolver.QueryRecord {
+	answers := l.Answers
+	if answers == nil {
+		answers = []string{}
+	}
+	return resolver.QueryRecord{
+		Time:     l.Time,
+		Client:   l.Client,
+		Name:     l.Name,
+		Type:     domain.RRType(l.Type),
+		RCode:    domain.RCode(l.RCode),
+		Answers:  answers,
+		Source:   resolver.AnswerSource(l.Source),
+		Upstream: l.Upstream,
+		Duration: l.Duration,
+	}
+}
+
+// loadSegment reads the segment file at path into a segment starting at
+// start. Lines that cannot be decoded are skipped and counted. A partial line
+// left at the end by a crash is cut off, so records appended later start on a
+// line of their own.
+func loadSegment(path string, start time.Time) (seg *segment, skipped int, err error) {
+	//gosec:disable G304 -- path is a segment file listed from the configured history directory
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if end := bytes.LastIndexByte(data, '\n') + 1; end < len(data) {
+		if err := os.Truncate(path, int64(end)); err != nil {
+			return nil, 0, err
+		}
+		data = data[:end]
+		skipped++
+	}
+	seg = newSegment(start)
+	for _, raw := range bytes.Split(data, []byte{'\n'}) {
+		if len(raw) == 0 {
+			continue
+		}
+		var l line
+		if err := json.Unmarshal(raw, &l); err != nil {
+			skipped++
+			continue
+		}
+		seg.add(l.record())
+	}
+	return seg, skipped, nil
+}
@@ -0,0 +1,163 @@
+package queryhistory
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+var testStart = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// testRecords returns records within the hour after testStart from two clients,
+// one of them blocked.
+func testRecords() []resolver.QueryRecord {
+	return []resolver.QueryRecord{
+		{Time: testStart.Add(1 * time.Minute), Client: "192.0.2.1", Name: "www.example.com.", Type: domain.RRTypeA, RCode: domain.NOERROR, Answers: []string{"www.example.com A 192.0.2.80"}, Source: resolver.SourceUpstream, Upstream: "1.1.1.1:53", Duration: time.Millisecond},
+		{Time: testStart.Add(3 * time.Minute), Client: "192.0.2.2", Name: "ads.tracker.net.", Type: domain.RRTypeA, RCode: domain.NXDOMAIN, Answers: []string{}, Source: resolver.SourceBlocked},
+		{Time: testStart.Add(2 * time.Minute), Client: "192.0.2.1", Name: "missing.example.com.", Type: domain.RRTypeAAAA, RCode: domain.NXDOMAIN, Answers: []string{}, Source: resolver.SourceUpstream},
+	}
+}
+
+func TestSegment_Search(t *testing.T) {
+	seg := newSegment(testStart)
+	for _, r := range testRecords() {
+		seg.add(r)
+	}
+	nxdomain := domain.NXDOMAIN
+	yes, no := true, false
+
+	tests := []struct {
+		name   string
+		filter resolver.QueryFilter
+		want   []string
+	}{
+		{"all newest first", resolver.QueryFilter{}, []string{"ads.tracker.net.", "missing.example.com.", "www.example.com."}},
+		{"client", resolver.QueryFilter{Client: "192.0.2.1"}, []string{"missing.example.com.", "www.example.com."}},
+		{"unknown client", resolver.QueryFilter{Client: "192.0.2.9"}, nil},
+		{"rcode", resolver.QueryFilter{RCode: &nxdomain}, []string{"ads.tracker.net.", "missing.example.com."}},
+		{"blocked", resolver.QueryFilter{Blocked: &yes}, []string{"ads.tracker.net."}},
+		{"not blocked", resolver.QueryFilter{Blocked: &no}, []string{"missing.example.com.", "www.example.com."}},
+		{"client and rcode", resolver.QueryFilter{Client: "192.0.2.1", RCode: &nxdomain}, []string{"missing.example.com."}},
+		{"domain", resolver.QueryFilter{Domain: "EXAMPLE.com"}, []string{"missing.example.com.", "www.example.com."}},
+		{"time range", resolver.QueryFilter{Since: testStart.Add(2 * time.Minute), Until: testStart.Add(3 * time.Minute)}, []string{"missing.example.com."}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, r := range seg.search(tt.filter) {
+				got = append(got, r.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("search() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSegment_Candidates(t *testing.T) {
+	seg := newSegment(testStart)
+	for _, r := range testRecords() {
+		seg.add(r)
+	}
+	nxdomain := domain.NXDOMAIN
+	yes := true
+
+	if _, all := seg.candidates(resolver.QueryFilter{Domain: "example"}); !all {
+		t.Error("a domain filter alone should check every record")
+	}
+	positions, all := seg.candidates(resolver.QueryFilter{Client: "192.0.2.1", RCode: &nxdomain, Blocked: &yes})
+	if all || !reflect.DeepEqual(positions, []int{1}) {
+		t.Errorf("candidates() = %v, %v; want the smallest index [1]", positions, all)
+	}
+}
+
+func TestSegment_Overlaps(t *testing.T) {
+	seg := newSegment(testStart)
+	tests := []struct {
+		name   string
+		filter resolver.QueryFilter
+		want   bool
+	}{
+		{"open range", resolver.QueryFilter{}, true},
+		{"since within", resolver.QueryFilter{Since: testStart.Add(30 * time.Minute)}, true},
+		{"since at end", resolver.QueryFilter{Since: testStart.Add(segmentSpan)}, false},
+		{"until at start", resolver.QueryFilter{Until: testStart}, false},
+		{"until within", resolver.QueryFilter{Until: testStart.Add(time.Minute)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := seg.overlaps(tt.filter); got != tt.want {
+				t.Errorf("overlaps() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSegmentNames(t *testing.T) {
+	path := segmentPath("/var/lib/rr-dns", testStart.In(time.FixedZone("CEST", 2*60*60)))
+	if want := filepath.Join("/var/lib/rr-dns", "queries-2025060112.jsonl"); path != want {
+		t.Errorf("segmentPath() = %q, want %q", path, want)
+	}
+	start, ok := parseSegmentName(filepath.Base(path))
+	if !ok || !start.Equal(testStart) {
+		t.Errorf("parseSegmentName() = %v, %v; want %v", start, ok, testStart)
+	}
+	for _, name := range []string{"queries.log", "queries-2025.jsonl", "other-2025060112.jsonl", "queries-2025060112.json"} {
+		if _, ok := parseSegmentName(name); ok {
+			t.Errorf("parseSegmentName(%q) should not accept the name", name)
+		}
+	}
+	if got := segmentStart(testStart.Add(59 * time.Minute)); !got.Equal(testStart) {
+		t.Errorf("segmentStart() = %v, want %v", got, testStart)
+	}
+}
+
+func TestLine_RoundTrip(t *testing.T) {
+	for _, r := range testRecords() {
+		if got := newLine(r).record(); !reflect.DeepEqual(got, r) {
+			t.Errorf("record() = %+v, want %+v", got, r)
+		}
+	}
+}
+
+func TestLoadSegment(t *testing.T) {
+	path := segmentPath(t.TempDir(), testStart)
+	data := `{"time":"2025-06-01T12:01:00Z","client":"192.0.2.1","name":"www.example.com.","type":1,"rcode":0,"source":"zone","duration_ns":1000}
+not json
+{"time":"2025-06-01T12:02:00Z","name":"example.com.","type":28,"rcode":3,"source":"upstream","duration_ns":0}
+{"time":"2025-06-01T12:03:00Z","na`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	seg, skipped, err := loadSegment(path, testStart)
+	if err != nil {
+		t.Fatalf("loadSegment() error = %v", err)
+	}
+	if skipped != 2 {
+		t.Errorf("skipped = %d, want 2", skipped)
+	}
+	if len(seg.records) != 2 || seg.records[1].RCode != domain.NXDOMAIN || seg.records[1].Type != domain.RRTypeAAAA {
+		t.Errorf("records = %+v", seg.records)
+	}
+	if got := seg.byClient["192.0.2.1"]; !reflect.DeepEqual(got, []int{0}) {
+		t.Errorf("client index = %v, want [0]", got)
+	}
+
+	trimmed, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trimmed[len(trimmed)-1] != '\n' {
+		t.Error("the partial last line should be cut off")
+	}
+
+	if _, _, err := loadSegment(filepath.Join(t.TempDir(), "missing.jsonl"), testStart); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
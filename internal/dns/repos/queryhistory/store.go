@@ -0,0 +1,379 @@
+// Package queryhistory keeps the queries the resolver answers in an embedded
+// store on local disk, searchable by time range, client, domain, response code
+// and blocked status, and prunes them once they fall out of the retention period.
+package queryhistory
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/common/log"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+const (
+	// DefaultRetention is how long records are kept when Options.Retention is zero.
+	DefaultRetention = 7 * 24 * time.Hour
+	// DefaultQueueSize is the number of entries buffered for storing.
+	DefaultQueueSize = 4096
+	// DefaultSearchLimit is the number of records Search returns when the filter sets no limit.
+	DefaultSearchLimit = 100
+	// MaxSearchLimit caps the number of records a single Search returns.
+	MaxSearchLimit = 10000
+	// maxBatch bounds how many queued entries are stored together.
+	maxBatch = 256
+	// pruneInterval is how often expired segments are removed.
+	pruneInterval = time.Minute
+)
+
+// errDirRequired is returned by New without a Dir.
+var errDirRequired = errors.New("query history directory is required")
+
+// Options configures a Store.
+type Options struct {
+	// Dir holds the segment files. Required; it is created if missing.
+	Dir string
+	// Retention is how long records are kept; zero uses DefaultRetention.
+	Retention time.Duration
+	// QueueSize is the number of entries buffered for storing; zero uses
+	// DefaultQueueSize. Entries recorded while the queue is full are dropped.
+	QueueSize int
+	// options to inject for testing purposes
+	Clock  clock.Clock
+	Logger log.Logger
+}
+
+// Store implements resolver.QueryLog and resolver.QueryHistory. Records are
+// split by the hour of query time into segments, each an append-only file on
+// disk mirrored in memory with indexes by client, response code and blocked
+// status. Expired segments are dropped whole. Entries are queued and stored by
+// a background goroutine, so a slow disk never delays a query.
+type Store struct {
+	dir       string
+	retention time.Duration
+	clock     clock.Clock
+	logger    log.Logger
+
+	mu       sync.RWMutex // guards segments
+	segments []*segment   // ordered by start, oldest first
+
+	// files are the open segment files, by segment start. Only the background
+	// goroutine uses them until it has stopped.
+	files map[time.Time]*os.File
+
+	qmu     sync.RWMutex // guards closed against concurrent sends on queue
+	closed  bool
+	queue   chan resolver.QueryLogEntry
+	dropped atomic.Uint64
+	done    chan struct{}
+}
+
+// New opens the store in opts.Dir, loading the records still within the
+// retention period and deleting older segments, and starts storing entries.
+func New(opts Options) (*Store, error) {
+	if opts.Dir == "" {
+		return nil, errDirRequired
+	}
+	if opts.Retention <= 0 {
+		opts.Retention = DefaultRetention
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultQueueSize
+	}
+	if opts.Clock == nil {
+		opts.Clock = &clock.RealClock{}
+	}
+	if opts.Logger == nil {
+		opts.Logger = log.NewNoopLogger()
+	}
+	if err := os.MkdirAll(opts.Dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create query history directory: %w", err)
+	}
+	s := &Store{
+		dir:       opts.Dir,
+		retention: opts.Retention,
+		clock:     opts.Clock,
+		logger:    opts.Logger,
+		files:     make(map[time.Time]*os.File),
+		queue:     make(chan resolver.QueryLogEntry, opts.QueueSize),
+		done:      make(chan struct{}),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	go s.run()
+	return s, nil
+}
+
+// load reads the segment files in the directory, deleting expired ones.
+func (s *Store) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read query history directory: %w", err)
+	}
+	cutoff := s.cutoff()
+	for _, e := range entries {
+		start, ok := parseSegmentName(e.Name())
+		if !ok || e.IsDir() {
+			continue
+		}
+		path := filepath.Join(s.dir, e.Name())
+		if !start.Add(segmentSpan).After(cutoff) {
+			s.remove(path)
+			continue
+		}
+		seg, skipped, err := loadSegment(path, start)
+		if err != nil {
+			return fmt.Errorf("failed to load query history segment %s: %w", path, err)
+		}
+		if skipped > 0 {
+			s.logger.Warn(map[string]any{"file": path, "skipped": skipped}, "Skipped unreadable query history records")
+		}
+		s.segments = append(s.segments, seg)
+	}
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i].start.Before(s.segments[j].start)
+	})
+	return nil
+}
+
+// cutoff returns the time before which records have expired.
+func (s *Store) cutoff() time.Time {
+	return s.clock.Now().Add(-s.retention)
+}
+
+// Record queues entry for storing, dropping it if the queue is full or the
+// Store is closed.
+func (s *Store) Record(entry resolver.QueryLogEntry) {
+	s.qmu.RLock()
+	defer s.qmu.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- entry:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// run stores queued entries until the queue is closed, gathering whatever is
+// already waiting into a single batch, and prunes expired segments meanwhile.
+func (s *Store) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case entry, ok := <-s.queue:
+			if !ok {
+				return
+			}
+			batch := []resolver.QueryRecord{resolver.NewQueryRecord(entry)}
+		gather:
+			for len(batch) < maxBatch {
+				select {
+				case next, ok := <-s.queue:
+					if !ok {
+						break gather
+					}
+					batch = append(batch, resolver.NewQueryRecord(next))
+				default:
+					break gather
+				}
+			}
+			s.store(batch)
+		case <-ticker.C:
+			s.prune()
+		}
+	}
+}
+
+// store adds the records of batch that have not expired to their segments and
+// appends them to the segment files.
+func (s *Store) store(batch []resolver.QueryRecord) {
+	cutoff := s.cutoff()
+	pending := make(map[time.Time]*bytes.Buffer)
+	s.mu.Lock()
+	for _, r := range batch {
+		if r.Time.Before(cutoff) {
+			continue
+		}
+		seg := s.segmentFor(segmentStart(r.Time))
+		seg.add(r)
+		buf, ok := pending[seg.start]
+		if !ok {
+			buf = &bytes.Buffer{}
+			pending[seg.start] = buf
+		}
+		if err := json.NewEncoder(buf).Encode(newLine(r)); err != nil {
+			s.logger.Error(map[string]any{"error": err}, "Failed to encode query history record")
+		}
+	}
+	s.mu.Unlock()
+
+	for start, buf := range pending {
+		if err := s.write(start, buf.Bytes()); err != nil {
+			s.logger.Error(map[string]any{"error": err}, "Failed to write query history")
+		}
+	}
+}
+
+// segmentFor returns the segment starting at start, creating it if needed.
+// The caller must hold mu for writing.
+func (s *Store) segmentFor(start time.Time) *segment {
+	i := sort.Search(len(s.segments), func(i int) bool {
+		return !s.segments[i].start.Before(start)
+	})
+	if i < len(s.segments) && s.segments[i].start.Equal(start) {
+		return s.segments[i]
+	}
+	seg := newSegment(start)
+	s.segments = append(s.segments, nil)
+	copy(s.segments[i+1:], s.segments[i:])
+	s.segments[i] = seg
+	return seg
+}
+
+// write appends data to the file of the segment starting at start. Only the
+// files of the current and the previous segment are kept open.
+func (s *Store) write(start time.Time, data []byte) error {
+	f, ok := s.files[start]
+	if !ok {
+		var err error
+		//gosec:disable G304 -- the segment path is built from the configured history directory
+		f, err = os.OpenFile(segmentPath(s.dir, start), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return err
+		}
+		s.files[start] = f
+	}
+	_, err := f.Write(data)
+
+	oldest := segmentStart(s.clock.Now()).Add(-segmentSpan)
+	for st, open := range s.files {
+		if st.Before(oldest) {
+			s.closeFile(st, open)
+		}
+	}
+	return err
+}
+
+// prune drops the segments whose span has fully passed out of the retention
+// period and deletes their files.
+func (s *Store) prune() {
+	cutoff := s.cutoff()
+	s.mu.Lock()
+	n := 0
+	for n < len(s.segments) && !s.segments[n].end().After(cutoff) {
+		n++
+	}
+	expired := s.segments[:n]
+	s.segments = append([]*segment(nil), s.segments[n:]...)
+	s.mu.Unlock()
+
+	for _, seg := range expired {
+		if f, ok := s.files[seg.start]; ok {
+			s.closeFile(seg.start, f)
+		}
+		s.remove(segmentPath(s.dir, seg.start))
+	}
+}
+
+// closeFile closes the open file of the segment starting at start.
+func (s *Store) closeFile(start time.Time, f *os.File) {
+	delete(s.files, start)
+	if err := f.Close(); err != nil {
+		s.logger.Warn(map[string]any{"error": err}, "Failed to close query history segment")
+	}
+}
+
+// remove deletes an expired segment file.
+func (s *Store) remove(path string) {
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		s.logger.Warn(map[string]any{"file": path, "error": err}, "Failed to delete expired query history segment")
+	}
+}
+
+// Search returns the records matching filter, newest first. Records older than
+// the retention period are never returned, even before they are pruned.
+// Without a limit in the filter it returns at most DefaultSearchLimit records,
+// and never more than MaxSearchLimit. The returned records must not be modified.
+func (s *Store) Search(filter resolver.QueryFilter) []resolver.QueryRecord {
+	if cutoff := s.cutoff(); filter.Since.Before(cutoff) {
+		filter.Since = cutoff
+	}
+	if ip := net.ParseIP(filter.Client); ip != nil {
+		filter.Client = ip.String()
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	limit = min(limit, MaxSearchLimit)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var results []resolver.QueryRecord
+	for i := len(s.segments) - 1; i >= 0 && len(results) < limit; i-- {
+		if seg := s.segments[i]; seg.overlaps(filter) {
+			results = append(results, seg.search(filter)...)
+		}
+	}
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// Len returns the number of records held, including expired ones not yet pruned.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	n := 0
+	for _, seg := range s.segments {
+		n += len(seg.records)
+	}
+	return n
+}
+
+// Dropped returns the number of entries discarded because the queue was full.
+func (s *Store) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close stops accepting entries, stores those still queued and closes the
+// segment files. The records stay searchable.
+func (s *Store) Close() error {
+	s.qmu.Lock()
+	if s.closed {
+		s.qmu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.queue)
+	s.qmu.Unlock()
+
+	<-s.done
+	var errs []error
+	for start, f := range s.files {
+		delete(s.files, start)
+		errs = append(errs, f.Close())
+	}
+	return errors.Join(errs...)
+}
+
+var (
+	_ resolver.QueryLog     = (*Store)(nil)
+	_ resolver.QueryHistory = (*Store)(nil)
+)
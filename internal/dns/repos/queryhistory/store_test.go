@@ -0,0 +1,216 @@
+package queryhistory
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// testEntry returns a resolver entry for a query by client at t.
+func testEntry(t time.Time, client string, name string, rcode domain.RCode, source resolver.AnswerSource) resolver.QueryLogEntry {
+	return resolver.QueryLogEntry{
+		Time:     t,
+		Client:   &net.UDPAddr{IP: net.ParseIP(client), Port: 40000},
+		Question: domain.Question{Name: name, Type: domain.RRTypeA, Class: domain.RRClassIN},
+		RCode:    rcode,
+		Source:   source,
+	}
+}
+
+// names returns the names of records, in order.
+func names(records []resolver.QueryRecord) []string {
+	var out []string
+	for _, r := range records {
+		out = append(out, r.Name)
+	}
+	return out
+}
+
+func equalNames(t *testing.T, got []resolver.QueryRecord, want ...string) {
+	t.Helper()
+	gotNames := names(got)
+	if len(gotNames) != len(want) {
+		t.Fatalf("names = %v, want %v", gotNames, want)
+	}
+	for i := range want {
+		if gotNames[i] != want[i] {
+			t.Fatalf("names = %v, want %v", gotNames, want)
+		}
+	}
+}
+
+func TestStore_RecordAndSearch(t *testing.T) {
+	dir := t.TempDir()
+	clk := &clock.MockClock{CurrentTime: testStart.Add(2 * time.Hour)}
+	s, err := New(Options{Dir: dir, Retention: 24 * time.Hour, Clock: clk})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	s.Record(testEntry(testStart.Add(10*time.Minute), "192.0.2.1", "tv.example.com.", domain.NOERROR, resolver.SourceUpstream))
+	s.Record(testEntry(testStart.Add(70*time.Minute), "192.0.2.2", "ads.tracker.net.", domain.NXDOMAIN, resolver.SourceBlocked))
+	s.Record(testEntry(testStart.Add(80*time.Minute), "192.0.2.1", "video.example.com.", domain.NOERROR, resolver.SourceCache))
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	s.Record(testEntry(testStart.Add(90*time.Minute), "192.0.2.1", "late.example.com.", domain.NOERROR, resolver.SourceCache))
+
+	if s.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", s.Len())
+	}
+	equalNames(t, s.Search(resolver.QueryFilter{}), "video.example.com.", "ads.tracker.net.", "tv.example.com.")
+	equalNames(t, s.Search(resolver.QueryFilter{Client: "192.0.2.1", Domain: "tv"}), "tv.example.com.")
+	equalNames(t, s.Search(resolver.QueryFilter{Client: "::ffff:192.0.2.1"}), "video.example.com.", "tv.example.com.")
+	equalNames(t, s.Search(resolver.QueryFilter{Until: testStart.Add(time.Hour)}), "tv.example.com.")
+	equalNames(t, s.Search(resolver.QueryFilter{Limit: 2}), "video.example.com.", "ads.tracker.net.")
+	blocked := true
+	equalNames(t, s.Search(resolver.QueryFilter{Blocked: &blocked}), "ads.tracker.net.")
+
+	for _, start := range []time.Time{testStart, testStart.Add(time.Hour)} {
+		if _, err := os.Stat(segmentPath(dir, start)); err != nil {
+			t.Errorf("segment file for %v: %v", start, err)
+		}
+	}
+}
+
+func TestStore_Reopen(t *testing.T) {
+	dir := t.TempDir()
+	clk := &clock.MockClock{CurrentTime: testStart.Add(time.Hour)}
+	s, err := New(Options{Dir: dir, Clock: clk})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	s.Record(testEntry(testStart.Add(10*time.Minute), "192.0.2.1", "tv.example.com.", domain.NOERROR, resolver.SourceUpstream))
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a segment"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := New(Options{Dir: dir, Clock: clk})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer reopened.Close()
+	got := reopened.Search(resolver.QueryFilter{})
+	equalNames(t, got, "tv.example.com.")
+	if got[0].Client != "192.0.2.1" || got[0].Source != resolver.SourceUpstream {
+		t.Errorf("reloaded record = %+v", got[0])
+	}
+}
+
+func TestStore_Retention(t *testing.T) {
+	dir := t.TempDir()
+	clk := &clock.MockClock{CurrentTime: testStart.Add(30 * time.Minute)}
+	s, err := New(Options{Dir: dir, Retention: 2 * time.Hour, Clock: clk})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	s.Record(testEntry(testStart.Add(10*time.Minute), "192.0.2.1", "old.example.com.", domain.NOERROR, resolver.SourceZone))
+	s.Record(testEntry(testStart.Add(-3*time.Hour), "192.0.2.1", "expired.example.com.", domain.NOERROR, resolver.SourceZone))
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	equalNames(t, s.Search(resolver.QueryFilter{}), "old.example.com.")
+
+	// Expired records are hidden at once and pruned once their whole segment has expired
+	clk.Advance(2 * time.Hour)
+	equalNames(t, s.Search(resolver.QueryFilter{}))
+	s.prune()
+	if s.Len() != 1 {
+		t.Errorf("Len() = %d; the segment still holds records within retention", s.Len())
+	}
+	clk.Advance(time.Hour)
+	s.prune()
+	if s.Len() != 0 {
+		t.Errorf("Len() = %d after pruning, want 0", s.Len())
+	}
+	if _, err := os.Stat(segmentPath(dir, testStart)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expired segment file should be deleted, stat error = %v", err)
+	}
+}
+
+func TestNew_DeletesExpiredSegments(t *testing.T) {
+	dir := t.TempDir()
+	expired := segmentPath(dir, testStart)
+	if err := os.WriteFile(expired, []byte("{}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(Options{Dir: dir, Retention: time.Hour, Clock: &clock.MockClock{CurrentTime: testStart.Add(3 * time.Hour)}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer s.Close()
+	if _, err := os.Stat(expired); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expired segment file should be deleted, stat error = %v", err)
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	if _, err := New(Options{}); !errors.Is(err, errDirRequired) {
+		t.Errorf("New() error = %v, want %v", err, errDirRequired)
+	}
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(Options{Dir: file}); err == nil {
+		t.Error("expected an error when the directory is a file")
+	}
+}
+
+func TestNew_CreatesDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "history", "queries")
+	s, err := New(Options{Dir: dir})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	defer s.Close()
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		t.Errorf("directory not created: %v", err)
+	}
+}
+
+func TestStore_SearchLimits(t *testing.T) {
+	clk := &clock.MockClock{CurrentTime: testStart.Add(time.Hour)}
+	s, err := New(Options{Dir: t.TempDir(), Clock: clk, QueueSize: DefaultSearchLimit + 50})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for i := 0; i < DefaultSearchLimit+50; i++ {
+		s.Record(testEntry(testStart.Add(time.Duration(i)*time.Second), "192.0.2.1", "example.com.", domain.NOERROR, resolver.SourceZone))
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if got := len(s.Search(resolver.QueryFilter{})); got != DefaultSearchLimit {
+		t.Errorf("default limit returned %d records, want %d", got, DefaultSearchLimit)
+	}
+	if got := len(s.Search(resolver.QueryFilter{Limit: MaxSearchLimit + 1})); got != DefaultSearchLimit+50 {
+		t.Errorf("large limit returned %d records, want %d", got, DefaultSearchLimit+50)
+	}
+}
+
+func TestStore_CountsDroppedEntries(t *testing.T) {
+	s, err := New(Options{Dir: t.TempDir(), QueueSize: 1})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		s.Record(testEntry(time.Now(), "192.0.2.1", "example.com.", domain.NOERROR, resolver.SourceZone))
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if got := s.Dropped() + uint64(s.Len()); got != 100 {
+		t.Errorf("Dropped() + Len() = %d, want 100", got)
+	}
+}
@@ -0,0 +1,295 @@
+package zone
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/knadh/koanf"
+
+	"github.com/haukened/rr-dns/internal/dns/common/utils"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// document is a zone file parsed into its raw structure, so records can be
+// added and removed and the file written back in its own format.
+type document struct {
+	path      string
+	parser    koanf.Parser
+	mode      os.FileMode
+	root      string         // canonical zone root
+	owners    map[string]any // the parsed file, zone_root included
+	version   string
+	commented bool // the file has comments, which marshal cannot keep
+}
+
+// readDocument parses the zone file at path. It returns nil for files of an
+// unsupported type.
+func readDocument(path string) (*document, error) {
+	parser := parserFor(path)
+	if parser == nil {
+		return nil, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	//gosec:disable G304 -- zone files are read from the configured zone directory
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	owners, err := parser.Unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse zone file %s: %w", path, err)
+	}
+	if owners == nil {
+		owners = make(map[string]any)
+	}
+	root, _ := owners["zone_root"].(string)
+	if root == "" {
+		return nil, fmt.Errorf("zone file %s missing 'zone_root'", path)
+	}
+	return &document{
+		path:      path,
+		parser:    parser,
+		mode:      info.Mode().Perm(),
+		root:      utils.CanonicalDNSName(root),
+		owners:    owners,
+		version:   digest(data),
+		commented: hasComments(path, data),
+	}, nil
+}
+
+// hasComments reports whether a YAML or TOML zone file has a comment: a '#'
+// outside quoted strings that, in YAML, starts the line or follows a space.
+// It errs on the side of finding one, as in a '#' line of a YAML block
+// scalar. JSON has no comments.
+func hasComments(path string, data []byte) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext == ".json" {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		var quote rune
+		escaped := false
+		prev := ' '
+		for _, c := range line {
+			switch {
+			case escaped:
+				escaped = false
+			case quote != 0:
+				if c == quote {
+					quote = 0
+				} else if c == '\\' && quote == '"' {
+					escaped = true
+				}
+			case (c == '"' || c == '\'') && strings.ContainsRune(" \t:[{,=", prev):
+				quote = c
+			case c == '#' && (ext == ".toml" || prev == ' ' || prev == '\t'):
+				return true
+			}
+			prev = c
+		}
+	}
+	return false
+}
+
+// digest identifies the contents of a zone file.
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// ownerName returns the canonical owner name for a key of the file.
+func (d *document) ownerName(key string) string {
+	return utils.CanonicalDNSName(expandName(key, d.root))
+}
+
+// records lists the records of the file, sorted by name and type, with the
+// values of each in file order. Entries the loader skips are skipped too.
+func (d *document) records() []resolver.ZoneRecord {
+	var records []resolver.ZoneRecord
+	for key, raw := range d.owners {
+		types, ok := raw.(map[string]any)
+		if key == "zone_root" || !ok {
+			continue
+		}
+		name := d.ownerName(key)
+		for typeKey, val := range types {
+			rrtype := domain.RRTypeFromString(typeKey)
+			for _, value := range toStringValues(val) {
+				records = append(records, resolver.NewZoneRecord(name, rrtype, value))
+			}
+		}
+	}
+	slices.SortStableFunc(records, func(a, b resolver.ZoneRecord) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Type.String(), b.Type.String())
+	})
+	return records
+}
+
+// find returns the record with the given ID.
+func (d *document) find(id string) (resolver.ZoneRecord, bool) {
+	for _, r := range d.records() {
+		if r.ID == id {
+			return r, true
+		}
+	}
+	return resolver.ZoneRecord{}, false
+}
+
+// normalize validates a record for the zone and returns it with a canonical
+// name and ID. Names ending in a dot, and names at or below the zone root,
+// are absolute; "@" is the zone root and other names are relative to it.
+func (d *document) normalize(r resolver.ZoneRecord) (resolver.ZoneRecord, error) {
+	name := strings.TrimSpace(r.Name)
+	switch {
+	case name == "":
+		return r, fmt.Errorf("%w: name is required", resolver.ErrInvalidRecord)
+	case name == "@":
+		name = d.root
+	case strings.HasSuffix(name, "."):
+		name = utils.CanonicalDNSName(name)
+	default:
+		name = utils.CanonicalDNSName(name)
+		if name != d.root && !strings.HasSuffix(name, "."+d.root) {
+			name += "." + d.root
+		}
+	}
+	if name != d.root && !strings.HasSuffix(name, "."+d.root) {
+		return r, fmt.Errorf("%w: %s is outside zone %s", resolver.ErrInvalidRecord, name, d.root)
+	}
+	if !r.Type.IsValid() || r.Type == domain.RRTypeOPT || r.Type == domain.RRTypeANY {
+		return r, fmt.Errorf("%w: unsupported type %s", resolver.ErrInvalidRecord, r.Type)
+	}
+	value := strings.TrimSpace(r.Value)
+	if value == "" {
+		return r, fmt.Errorf("%w: value is required", resolver.ErrInvalidRecord)
+	}
+	if _, err := buildResourceRecord(name, r.Type.String(), []string{value}, 0); err != nil {
+		return r, fmt.Errorf("%w: %v", resolver.ErrInvalidRecord, err)
+	}
+	return resolver.NewZoneRecord(name, r.Type, value), nil
+}
+
+// ownerKey returns the key of the file holding name, or the key a new owner
+// would get: "@" for the zone root and a name relative to it otherwise.
+func (d *document) ownerKey(name string) string {
+	for key := range d.owners {
+		if key != "zone_root" && d.ownerName(key) == name {
+			return key
+		}
+	}
+	if name == d.root {
+		return "@"
+	}
+	return strings.TrimSuffix(name, "."+d.root)
+}
+
+// typeKey returns the key of types holding rrtype, or its mnemonic.
+func typeKey(types map[string]any, rrtype domain.RRType) string {
+	for key := range types {
+		if domain.RRTypeFromString(key) == rrtype {
+			return key
+		}
+	}
+	return rrtype.String()
+}
+
+// add appends a normalized record to the file.
+func (d *document) add(r resolver.ZoneRecord) {
+	key := d.ownerKey(r.Name)
+	types, ok := d.owners[key].(map[string]any)
+	if !ok {
+		types = make(map[string]any)
+		d.owners[key] = types
+	}
+	tkey := typeKey(types, r.Type)
+	setValues(types, tkey, append(toStringValues(types[tkey]), r.Value))
+}
+
+// remove deletes a record from the file, dropping its type and owner once
+// they hold nothing else.
+func (d *document) remove(r resolver.ZoneRecord) {
+	key := d.ownerKey(r.Name)
+	types, ok := d.owners[key].(map[string]any)
+	if !ok {
+		return
+	}
+	tkey := typeKey(types, r.Type)
+	values := toStringValues(types[tkey])
+	if i := slices.Index(values, r.Value); i >= 0 {
+		values = slices.Delete(values, i, i+1)
+	}
+	setValues(types, tkey, values)
+	if len(types) == 0 {
+		delete(d.owners, key)
+	}
+}
+
+// setValues stores values under key the way zone files write them: a single
+// string for one value and a list for several.
+func setValues(types map[string]any, key string, values []string) {
+	switch len(values) {
+	case 0:
+		delete(types, key)
+	case 1:
+		types[key] = values[0]
+	default:
+		list := make([]any, len(values))
+		for i, v := range values {
+			list[i] = v
+		}
+		types[key] = list
+	}
+}
+
+// marshal encodes the file in its format. JSON is indented for people to read.
+func (d *document) marshal() ([]byte, error) {
+	if strings.EqualFold(filepath.Ext(d.path), ".json") {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(d.owners); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return d.parser.Marshal(d.owners)
+}
+
+// write replaces the zone file with data, atomically, keeping its permissions.
+func (d *document) write(data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(d.path), "."+filepath.Base(d.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(d.mode); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), d.path)
+}
@@ -0,0 +1,263 @@
+package zone
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o640); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestReadDocument(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestFile(t, dir, "zone.yaml", testYAML)
+
+	doc, err := readDocument(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if doc.root != "example.com" {
+		t.Errorf("expected root example.com, got %q", doc.root)
+	}
+	if doc.mode != 0o640 {
+		t.Errorf("expected mode 0640, got %o", doc.mode)
+	}
+	if len(doc.version) != 32 {
+		t.Errorf("expected a 32 character version, got %q", doc.version)
+	}
+	if doc.commented {
+		t.Error("expected a file without comments")
+	}
+}
+
+func TestReadDocument_Errors(t *testing.T) {
+	dir := t.TempDir()
+
+	doc, err := readDocument(writeTestFile(t, dir, "zone.txt", testYAML))
+	if doc != nil || err != nil {
+		t.Errorf("expected nil document and error for unsupported file, got %v, %v", doc, err)
+	}
+	if _, err := readDocument(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("expected error for missing file")
+	}
+	if _, err := readDocument(writeTestFile(t, dir, "bad.json", "{")); err == nil {
+		t.Error("expected error for malformed file")
+	}
+	if _, err := readDocument(writeTestFile(t, dir, "noroot.yaml", "www:\n  A: 1.2.3.4\n")); err == nil {
+		t.Error("expected error for missing zone_root")
+	}
+}
+
+func TestHasComments(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		data string
+		want bool
+	}{
+		{"yaml without comments", "zone.yaml", testYAML, false},
+		{"yaml comment line", "zone.yaml", "# owner: ops\n" + testYAML, true},
+		{"yaml indented comment", "zone.yml", "zone_root: example.com\nwww:\n  # web\n  A: 1.2.3.4\n", true},
+		{"yaml trailing comment", "zone.yaml", "zone_root: example.com # main\n", true},
+		{"yaml hash in plain value", "zone.yaml", "zone_root: example.com\nwww:\n  TXT: a#b\n", false},
+		{"yaml hash in quoted value", "zone.yaml", "zone_root: example.com\nwww:\n  TXT: \"a # b\"\n", false},
+		{"yaml escaped quote", "zone.yaml", "zone_root: example.com\nwww:\n  TXT: \"say \\\" # hi\"\n", false},
+		{"yaml apostrophe in plain value", "zone.yaml", "zone_root: example.com\nwww:\n  TXT: it's # note\n", true},
+		{"toml without comments", "zone.toml", testTOML, false},
+		{"toml comment", "zone.toml", testTOML + "A = \"1.2.3.5\"#spare\n", true},
+		{"toml hash in string", "zone.toml", "zone_root = \"example.net\"\n[web]\nTXT = 'a # b'\n", false},
+		{"json", "zone.json", `{"zone_root": "example.org", "www": {"TXT": "a # b"}}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasComments(tt.path, []byte(tt.data)); got != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDigest(t *testing.T) {
+	if digest([]byte("a")) == digest([]byte("b")) {
+		t.Error("expected different digests for different contents")
+	}
+	if digest([]byte("a")) != digest([]byte("a")) {
+		t.Error("expected equal digests for equal contents")
+	}
+}
+
+func TestDocument_Records(t *testing.T) {
+	doc := &document{
+		root: "example.com",
+		owners: map[string]any{
+			"zone_root": "example.com.",
+			"www":       map[string]any{"A": []any{"10.0.0.2", "10.0.0.1"}, "AAAA": "::1"},
+			"@":         map[string]any{"MX": "10 mail.example.com."},
+			"ignored":   "not a map",
+		},
+	}
+
+	records := doc.records()
+	want := []resolver.ZoneRecord{
+		resolver.NewZoneRecord("example.com", domain.RRTypeMX, "10 mail.example.com."),
+		resolver.NewZoneRecord("www.example.com", domain.RRTypeA, "10.0.0.2"),
+		resolver.NewZoneRecord("www.example.com", domain.RRTypeA, "10.0.0.1"),
+		resolver.NewZoneRecord("www.example.com", domain.RRTypeAAAA, "::1"),
+	}
+	if len(records) != len(want) {
+		t.Fatalf("expected %d records, got %d: %v", len(want), len(records), records)
+	}
+	for i := range want {
+		if records[i] != want[i] {
+			t.Errorf("record %d: expected %v, got %v", i, want[i], records[i])
+		}
+	}
+
+	if r, ok := doc.find(want[2].ID); !ok || r != want[2] {
+		t.Errorf("expected to find %v, got %v, %v", want[2], r, ok)
+	}
+	if _, ok := doc.find("missing"); ok {
+		t.Error("expected no record for unknown ID")
+	}
+}
+
+func TestDocument_Normalize(t *testing.T) {
+	doc := &document{root: "example.com"}
+
+	tests := []struct {
+		name     string
+		record   resolver.ZoneRecord
+		wantName string
+		wantErr  bool
+	}{
+		{"apex", resolver.ZoneRecord{Name: "@", Type: domain.RRTypeA, Value: "1.2.3.4"}, "example.com", false},
+		{"relative", resolver.ZoneRecord{Name: "WWW", Type: domain.RRTypeA, Value: " 1.2.3.4 "}, "www.example.com", false},
+		{"nested relative", resolver.ZoneRecord{Name: "a.b", Type: domain.RRTypeA, Value: "1.2.3.4"}, "a.b.example.com", false},
+		{"absolute", resolver.ZoneRecord{Name: "www.example.com.", Type: domain.RRTypeA, Value: "1.2.3.4"}, "www.example.com", false},
+		{"qualified", resolver.ZoneRecord{Name: "www.example.com", Type: domain.RRTypeA, Value: "1.2.3.4"}, "www.example.com", false},
+		{"outside zone", resolver.ZoneRecord{Name: "www.example.org.", Type: domain.RRTypeA, Value: "1.2.3.4"}, "", true},
+		{"empty name", resolver.ZoneRecord{Name: " ", Type: domain.RRTypeA, Value: "1.2.3.4"}, "", true},
+		{"unknown type", resolver.ZoneRecord{Name: "www", Type: domain.RRType(65000), Value: "1.2.3.4"}, "", true},
+		{"ANY", resolver.ZoneRecord{Name: "www", Type: domain.RRTypeANY, Value: "1.2.3.4"}, "", true},
+		{"empty value", resolver.ZoneRecord{Name: "www", Type: domain.RRTypeA, Value: ""}, "", true},
+		{"bad value", resolver.ZoneRecord{Name: "www", Type: domain.RRTypeA, Value: "not-an-ip"}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := doc.normalize(tt.record)
+			if tt.wantErr {
+				if !errors.Is(err, resolver.ErrInvalidRecord) {
+					t.Errorf("expected ErrInvalidRecord, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			want := resolver.NewZoneRecord(tt.wantName, tt.record.Type, strings.TrimSpace(tt.record.Value))
+			if got != want {
+				t.Errorf("expected %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestDocument_AddRemove(t *testing.T) {
+	doc := &document{
+		root: "example.com",
+		owners: map[string]any{
+			"zone_root":         "example.com.",
+			"www":               map[string]any{"A": "10.0.0.1"},
+			"mail.example.com.": map[string]any{"A": "10.0.0.9"},
+		},
+	}
+
+	doc.add(resolver.NewZoneRecord("www.example.com", domain.RRTypeA, "10.0.0.2"))
+	doc.add(resolver.NewZoneRecord("mail.example.com", domain.RRTypeMX, "10 mail.example.com."))
+	doc.add(resolver.NewZoneRecord("example.com", domain.RRTypeA, "10.0.0.3"))
+	doc.add(resolver.NewZoneRecord("a.b.example.com", domain.RRTypeA, "10.0.0.4"))
+
+	www := doc.owners["www"].(map[string]any)
+	if values := toStringValues(www["A"]); len(values) != 2 || values[1] != "10.0.0.2" {
+		t.Errorf("expected value appended under existing type key, got %v", www)
+	}
+	if _, ok := doc.owners["mail.example.com."].(map[string]any)["MX"]; !ok {
+		t.Errorf("expected MX added under existing owner key, got %v", doc.owners)
+	}
+	if apex, ok := doc.owners["@"].(map[string]any); !ok || apex["A"] != "10.0.0.3" {
+		t.Errorf("expected new apex owner, got %v", doc.owners["@"])
+	}
+	if _, ok := doc.owners["a.b"]; !ok {
+		t.Errorf("expected new relative owner key, got %v", doc.owners)
+	}
+
+	doc.remove(resolver.NewZoneRecord("www.example.com", domain.RRTypeA, "10.0.0.1"))
+	if www["A"] != "10.0.0.2" {
+		t.Errorf("expected single value stored as string, got %v", www["A"])
+	}
+	doc.remove(resolver.NewZoneRecord("www.example.com", domain.RRTypeA, "10.0.0.2"))
+	if _, ok := doc.owners["www"]; ok {
+		t.Errorf("expected empty owner removed, got %v", doc.owners)
+	}
+	doc.remove(resolver.NewZoneRecord("nope.example.com", domain.RRTypeA, "10.0.0.2"))
+}
+
+func TestDocument_MarshalWrite(t *testing.T) {
+	for _, name := range []string{"zone.yaml", "zone.json", "zone.toml"} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			content := map[string]string{"zone.yaml": testYAML, "zone.json": testJSON, "zone.toml": testTOML}[name]
+			path := writeTestFile(t, dir, name, content)
+			doc, err := readDocument(path)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			doc.add(resolver.NewZoneRecord("new."+doc.root, domain.RRTypeA, "192.0.2.1"))
+
+			data, err := doc.marshal()
+			if err != nil {
+				t.Fatalf("marshal failed: %v", err)
+			}
+			if err := doc.write(data); err != nil {
+				t.Fatalf("write failed: %v", err)
+			}
+
+			reread, err := readDocument(path)
+			if err != nil {
+				t.Fatalf("failed to read rewritten file: %v", err)
+			}
+			if reread.version != digest(data) || reread.version == doc.version {
+				t.Errorf("expected version of the written data")
+			}
+			if reread.mode != 0o640 {
+				t.Errorf("expected mode kept, got %o", reread.mode)
+			}
+			if _, ok := reread.find(resolver.NewZoneRecord("new."+doc.root, domain.RRTypeA, "192.0.2.1").ID); !ok {
+				t.Errorf("expected added record in rewritten file, got %v", reread.records())
+			}
+			entries, _ := os.ReadDir(dir)
+			if len(entries) != 1 {
+				t.Errorf("expected temporary file removed, got %v", entries)
+			}
+		})
+	}
+}
+
+func TestDocument_WriteError(t *testing.T) {
+	doc := &document{path: filepath.Join(t.TempDir(), "missing", "zone.yaml")}
+	if err := doc.write([]byte("zone_root: example.com\n")); err == nil {
+		t.Error("expected error writing to a missing directory")
+	}
+}
@@ -0,0 +1,164 @@
+package zone
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/common/utils"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// Editor changes the records of zones defined in a zone directory. Each change
+// is validated, written back to the zone's file in its own format, and applied
+// to the ZoneCache. A zone's version is a digest of its file, so changes made
+// to the file by other means are detected as well.
+//
+// Files are found through the index built when the directory was loaded, so
+// zone files added later are not editable until a restart. Rewriting a file
+// would drop its comments, so files with comments are not editable, and YAML
+// and TOML files lose their key order. Zones whose records are spread across
+// several files are not editable either.
+type Editor struct {
+	files      ZoneFiles
+	defaultTTL time.Duration
+	zones      resolver.ZoneCache
+
+	mu sync.Mutex
+}
+
+var _ resolver.ZoneEditor = (*Editor)(nil)
+
+// NewEditor returns an Editor for the zone files indexed by LoadZoneFiles, as
+// loaded with defaultTTL into zones.
+func NewEditor(files ZoneFiles, defaultTTL time.Duration, zones resolver.ZoneCache) *Editor {
+	return &Editor{files: files, defaultTTL: defaultTTL, zones: zones}
+}
+
+// Records lists the records of a zone, sorted by name and type, and returns its version.
+func (e *Editor) Records(zone string) ([]resolver.ZoneRecord, string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	doc, err := e.find(zone)
+	if err != nil {
+		return nil, "", err
+	}
+	return doc.records(), doc.version, nil
+}
+
+// CreateRecord adds a record to a zone.
+func (e *Editor) CreateRecord(zone, version string, record resolver.ZoneRecord) (resolver.ZoneRecord, string, error) {
+	var created resolver.ZoneRecord
+	newVersion, err := e.mutate(zone, version, func(doc *document) error {
+		r, err := doc.normalize(record)
+		if err != nil {
+			return err
+		}
+		if _, ok := doc.find(r.ID); ok {
+			return resolver.ErrRecordExists
+		}
+		doc.add(r)
+		created = r
+		return nil
+	})
+	return created, newVersion, err
+}
+
+// UpdateRecord replaces the record with the given ID. The replacement gets a
+// new ID unless it is identical.
+func (e *Editor) UpdateRecord(zone, version, id string, record resolver.ZoneRecord) (resolver.ZoneRecord, string, error) {
+	var updated resolver.ZoneRecord
+	newVersion, err := e.mutate(zone, version, func(doc *document) error {
+		old, ok := doc.find(id)
+		if !ok {
+			return resolver.ErrRecordNotFound
+		}
+		r, err := doc.normalize(record)
+		if err != nil {
+			return err
+		}
+		if r.ID != old.ID {
+			if _, ok := doc.find(r.ID); ok {
+				return resolver.ErrRecordExists
+			}
+		}
+		doc.remove(old)
+		doc.add(r)
+		updated = r
+		return nil
+	})
+	return updated, newVersion, err
+}
+
+// DeleteRecord removes the record with the given ID.
+func (e *Editor) DeleteRecord(zone, version, id string) (string, error) {
+	return e.mutate(zone, version, func(doc *document) error {
+		old, ok := doc.find(id)
+		if !ok {
+			return resolver.ErrRecordNotFound
+		}
+		doc.remove(old)
+		return nil
+	})
+}
+
+// mutate applies change to the file of a zone at the given version, checks the
+// result loads, then writes the file and replaces the zone in the cache.
+func (e *Editor) mutate(zone, version string, change func(*document) error) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	doc, err := e.find(zone)
+	if err != nil {
+		return "", err
+	}
+	if doc.commented {
+		return "", fmt.Errorf("%w: %s has comments that rewriting it would drop", resolver.ErrZoneNotEditable, doc.path)
+	}
+	if version != "" && version != doc.version {
+		return "", resolver.ErrZoneVersion
+	}
+	if err := change(doc); err != nil {
+		return "", err
+	}
+
+	data, err := doc.marshal()
+	if err != nil {
+		return "", fmt.Errorf("failed to encode zone file %s: %w", doc.path, err)
+	}
+	owners, err := doc.parser.Unmarshal(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse zone file %s: %w", doc.path, err)
+	}
+	root, records, err := buildZoneRecords(doc.path, doc.root, owners, e.defaultTTL)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", resolver.ErrInvalidRecord, err)
+	}
+	if err := doc.write(data); err != nil {
+		return "", fmt.Errorf("failed to write zone file %s: %w", doc.path, err)
+	}
+	e.zones.PutZone(root, records)
+	return digest(data), nil
+}
+
+// find reads the zone file defining zone.
+func (e *Editor) find(zone string) (*document, error) {
+	zone = utils.CanonicalDNSName(zone)
+	paths := e.files[zone]
+	switch len(paths) {
+	case 0:
+		return nil, fmt.Errorf("%w: %s", resolver.ErrZoneNotFound, zone)
+	case 1:
+	default:
+		return nil, fmt.Errorf("%w: %s is defined by %d zone files", resolver.ErrZoneNotEditable, zone, len(paths))
+	}
+	doc, err := readDocument(paths[0])
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil || doc.root != zone {
+		return nil, fmt.Errorf("%w: %s no longer defines %s", resolver.ErrZoneNotFound, paths[0], zone)
+	}
+	return doc, nil
+}
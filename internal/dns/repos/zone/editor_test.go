@@ -0,0 +1,271 @@
+package zone
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+	"github.com/haukened/rr-dns/internal/dns/services/resolver"
+)
+
+// fakeZoneCache records the zones put into it.
+type fakeZoneCache struct {
+	resolver.ZoneCache
+	zones map[string][]domain.ResourceRecord
+}
+
+func (f *fakeZoneCache) PutZone(zoneRoot string, records []domain.ResourceRecord) {
+	if f.zones == nil {
+		f.zones = make(map[string][]domain.ResourceRecord)
+	}
+	f.zones[zoneRoot] = records
+}
+
+// loadTestEditor returns an Editor for the zone files in dir.
+func loadTestEditor(t *testing.T, dir string) (*Editor, *fakeZoneCache) {
+	t.Helper()
+	_, files, err := LoadZoneFiles(dir, 300*time.Second)
+	if err != nil {
+		t.Fatalf("failed to load zone files: %v", err)
+	}
+	cache := &fakeZoneCache{}
+	return NewEditor(files, 300*time.Second, cache), cache
+}
+
+func newTestEditor(t *testing.T) (*Editor, *fakeZoneCache, string) {
+	t.Helper()
+	dir := t.TempDir()
+	writeTestFile(t, dir, "example.yaml", testYAML)
+	writeTestFile(t, dir, "example.json", testJSON)
+	editor, cache := loadTestEditor(t, dir)
+	return editor, cache, dir
+}
+
+func TestEditor_Records(t *testing.T) {
+	editor, _, _ := newTestEditor(t)
+
+	records, version, err := editor.Records("Example.COM.")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if version == "" {
+		t.Error("expected a version")
+	}
+	want := resolver.NewZoneRecord("www.example.com", domain.RRTypeA, "1.2.3.4")
+	if len(records) != 1 || records[0] != want {
+		t.Errorf("expected %v, got %v", want, records)
+	}
+
+	if _, _, err := editor.Records("example.net"); !errors.Is(err, resolver.ErrZoneNotFound) {
+		t.Errorf("expected ErrZoneNotFound, got %v", err)
+	}
+}
+
+func TestEditor_Records_SplitZone(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "example.yaml", testYAML)
+	writeTestFile(t, dir, "more.yaml", "zone_root: example.com\nmail:\n  A: 1.2.3.5\n")
+	editor, _ := loadTestEditor(t, dir)
+
+	if _, _, err := editor.Records("example.com"); !errors.Is(err, resolver.ErrZoneNotEditable) {
+		t.Errorf("expected ErrZoneNotEditable, got %v", err)
+	}
+}
+
+func TestEditor_Records_Index(t *testing.T) {
+	editor, _, dir := newTestEditor(t)
+	// Files added after loading are neither read nor editable.
+	writeTestFile(t, dir, "broken.yaml", testInvalidYAML)
+	writeTestFile(t, dir, "example.toml", testTOML)
+
+	if _, _, err := editor.Records("example.com"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, _, err := editor.Records("example.net"); !errors.Is(err, resolver.ErrZoneNotFound) {
+		t.Errorf("expected ErrZoneNotFound for a file added after loading, got %v", err)
+	}
+
+	// An indexed file that now defines another zone no longer defines its own.
+	writeTestFile(t, dir, "example.json", `{"zone_root": "example.net"}`)
+	if _, _, err := editor.Records("example.org"); !errors.Is(err, resolver.ErrZoneNotFound) {
+		t.Errorf("expected ErrZoneNotFound, got %v", err)
+	}
+	if err := os.Remove(filepath.Join(dir, "example.yaml")); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	if _, _, err := editor.Records("example.com"); err == nil {
+		t.Error("expected error for a removed zone file")
+	}
+}
+func TestEditor_CreateRecord(t *testing.T) {
+	editor, cache, dir := newTestEditor(t)
+	_, version, _ := editor.Records("example.com")
+
+	created, newVersion, err := editor.CreateRecord("example.com", version, resolver.ZoneRecord{
+		Name: "mail", Type: domain.RRTypeA, Value: "10.0.0.5",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if created != resolver.NewZoneRecord("mail.example.com", domain.RRTypeA, "10.0.0.5") {
+		t.Errorf("unexpected record %v", created)
+	}
+	if newVersion == "" || newVersion == version {
+		t.Errorf("expected a new version, got %q", newVersion)
+	}
+
+	// The file and the cache hold the new record.
+	loaded, err := loadZoneFile(filepath.Join(dir, "example.yaml"), 300*time.Second)
+	if err != nil {
+		t.Fatalf("failed to load rewritten file: %v", err)
+	}
+	if len(loaded) != 2 {
+		t.Errorf("expected 2 records in file, got %v", loaded)
+	}
+	if got := cache.zones["example.com"]; len(got) != 2 || got[0].OriginalTTL() != 300 {
+		t.Errorf("expected 2 records with the default TTL in cache, got %v", got)
+	}
+
+	records, current, _ := editor.Records("example.com")
+	if current != newVersion || len(records) != 2 {
+		t.Errorf("expected version %q and 2 records, got %q and %v", newVersion, current, records)
+	}
+
+	// Creating it again, or from the old version, fails.
+	if _, _, err := editor.CreateRecord("example.com", "", created); !errors.Is(err, resolver.ErrRecordExists) {
+		t.Errorf("expected ErrRecordExists, got %v", err)
+	}
+	other := resolver.ZoneRecord{Name: "ftp", Type: domain.RRTypeA, Value: "10.0.0.6"}
+	if _, _, err := editor.CreateRecord("example.com", version, other); !errors.Is(err, resolver.ErrZoneVersion) {
+		t.Errorf("expected ErrZoneVersion, got %v", err)
+	}
+}
+
+func TestEditor_CreateRecord_Invalid(t *testing.T) {
+	editor, cache, dir := newTestEditor(t)
+	before, _ := os.ReadFile(filepath.Join(dir, "example.yaml"))
+
+	_, _, err := editor.CreateRecord("example.com", "", resolver.ZoneRecord{
+		Name: "mail", Type: domain.RRTypeMX, Value: "mail.example.com.",
+	})
+	if !errors.Is(err, resolver.ErrInvalidRecord) {
+		t.Errorf("expected ErrInvalidRecord, got %v", err)
+	}
+	after, _ := os.ReadFile(filepath.Join(dir, "example.yaml"))
+	if string(before) != string(after) || cache.zones != nil {
+		t.Error("expected file and cache unchanged")
+	}
+}
+
+func TestEditor_CreateRecord_UnwritableDirectory(t *testing.T) {
+	if os.Getuid() == 0 {
+		t.Skip("root ignores directory permissions")
+	}
+	editor, cache, dir := newTestEditor(t)
+	if err := os.Chmod(dir, 0o500); err != nil {
+		t.Fatalf("chmod failed: %v", err)
+	}
+	t.Cleanup(func() { _ = os.Chmod(dir, 0o700) })
+
+	_, _, err := editor.CreateRecord("example.com", "", resolver.ZoneRecord{
+		Name: "mail", Type: domain.RRTypeA, Value: "10.0.0.5",
+	})
+	if err == nil {
+		t.Error("expected error writing to a read-only directory")
+	}
+	if cache.zones != nil {
+		t.Error("expected cache unchanged")
+	}
+}
+
+func TestEditor_UpdateRecord(t *testing.T) {
+	editor, cache, _ := newTestEditor(t)
+	records, version, _ := editor.Records("example.org")
+
+	updated, newVersion, err := editor.UpdateRecord("example.org", version, records[0].ID, resolver.ZoneRecord{
+		Name: "api", Type: domain.RRTypeA, Value: "5.6.7.9",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if updated != resolver.NewZoneRecord("api.example.org", domain.RRTypeA, "5.6.7.9") {
+		t.Errorf("unexpected record %v", updated)
+	}
+	if got := cache.zones["example.org"]; len(got) != 1 || got[0].Text != "5.6.7.9" {
+		t.Errorf("expected updated record in cache, got %v", got)
+	}
+
+	if _, _, err := editor.UpdateRecord("example.org", newVersion, records[0].ID, updated); !errors.Is(err, resolver.ErrRecordNotFound) {
+		t.Errorf("expected ErrRecordNotFound, got %v", err)
+	}
+	// An identical replacement is allowed.
+	if _, _, err := editor.UpdateRecord("example.org", newVersion, updated.ID, updated); err != nil {
+		t.Errorf("unexpected error replacing a record with itself: %v", err)
+	}
+	if _, _, err := editor.UpdateRecord("example.org", "", updated.ID, resolver.ZoneRecord{Name: "api"}); !errors.Is(err, resolver.ErrInvalidRecord) {
+		t.Errorf("expected ErrInvalidRecord, got %v", err)
+	}
+}
+
+func TestEditor_UpdateRecord_Exists(t *testing.T) {
+	editor, _, _ := newTestEditor(t)
+	second, _, err := editor.CreateRecord("example.org", "", resolver.ZoneRecord{Name: "api", Type: domain.RRTypeA, Value: "5.6.7.9"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	first := resolver.NewZoneRecord("api.example.org", domain.RRTypeA, "5.6.7.8")
+
+	if _, _, err := editor.UpdateRecord("example.org", "", first.ID, second); !errors.Is(err, resolver.ErrRecordExists) {
+		t.Errorf("expected ErrRecordExists, got %v", err)
+	}
+}
+
+func TestEditor_DeleteRecord(t *testing.T) {
+	editor, cache, dir := newTestEditor(t)
+	records, version, _ := editor.Records("example.com")
+
+	if _, err := editor.DeleteRecord("example.com", version, "missing"); !errors.Is(err, resolver.ErrRecordNotFound) {
+		t.Errorf("expected ErrRecordNotFound, got %v", err)
+	}
+	if _, err := editor.DeleteRecord("example.com", version, records[0].ID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, ok := cache.zones["example.com"]; !ok || len(got) != 0 {
+		t.Errorf("expected empty zone in cache, got %v", got)
+	}
+	doc, err := readDocument(filepath.Join(dir, "example.yaml"))
+	if err != nil {
+		t.Fatalf("failed to read rewritten file: %v", err)
+	}
+	if len(doc.records()) != 0 || doc.root != "example.com" {
+		t.Errorf("expected zone file without records, got %v", doc.owners)
+	}
+}
+
+func TestEditor_CommentedFile(t *testing.T) {
+	dir := t.TempDir()
+	commented := "# managed by hand\n" + testYAML
+	writeTestFile(t, dir, "example.yaml", commented)
+	editor, cache := loadTestEditor(t, dir)
+
+	records, _, err := editor.Records("example.com")
+	if err != nil || len(records) != 1 {
+		t.Fatalf("expected the records of a commented file, got %v, %v", records, err)
+	}
+	_, _, err = editor.CreateRecord("example.com", "", resolver.ZoneRecord{
+		Name: "mail", Type: domain.RRTypeA, Value: "10.0.0.5",
+	})
+	if !errors.Is(err, resolver.ErrZoneNotEditable) {
+		t.Errorf("expected ErrZoneNotEditable, got %v", err)
+	}
+	if _, err := editor.DeleteRecord("example.com", "", records[0].ID); !errors.Is(err, resolver.ErrZoneNotEditable) {
+		t.Errorf("expected ErrZoneNotEditable, got %v", err)
+	}
+	after, _ := os.ReadFile(filepath.Join(dir, "example.yaml"))
+	if string(after) != commented || cache.zones != nil {
+		t.Error("expected file and cache unchanged")
+	}
+}
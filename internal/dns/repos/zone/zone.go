@@ -24,7 +24,19 @@ import (
 // and returning a map of zone roots to their records. This preserves zone organization for cache loading.
 // Returns an error if any file fails to parse.
 func LoadZoneDirectory(dir string, defaultTTL time.Duration) (map[string][]domain.ResourceRecord, error) {
+	zones, _, err := LoadZoneFiles(dir, defaultTTL)
+	return zones, err
+}
+
+// ZoneFiles maps canonical zone roots to the paths of the zone files defining them.
+type ZoneFiles map[string][]string
+
+// LoadZoneFiles loads a zone directory like LoadZoneDirectory, and also returns
+// the files defining each zone, for an Editor to change them without walking
+// the directory again.
+func LoadZoneFiles(dir string, defaultTTL time.Duration) (map[string][]domain.ResourceRecord, ZoneFiles, error) {
 	zones := make(map[string][]domain.ResourceRecord)
+	files := make(ZoneFiles)
 
 	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
 		if err != nil || d.IsDir() {
@@ -35,15 +47,18 @@ func LoadZoneDirectory(dir string, defaultTTL time.Duration) (map[string][]domai
 		if err != nil {
 			return fmt.Errorf("error parsing zone file %s: %w", path, err)
 		}
+		if zoneRoot != "" {
+			files[zoneRoot] = append(files[zoneRoot], path)
+		}
 		if zoneRoot != "" && len(zoneRecords) > 0 {
 			zones[zoneRoot] = append(zones[zoneRoot], zoneRecords...)
 		}
 		return nil
 	})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return zones, nil
+	return zones, files, nil
 }
 
 // expandName returns the fully qualified domain name for a label, expanding '@' to the root,
@@ -121,19 +136,25 @@ func buildResourceRecord(fqdn string, rrType string, values []string, defaultTTL
 	return records, nil
 }
 
-// loadZoneFileWithRoot loads and parses a single zone file, returning both the zone root and records.
-// This is used by LoadZoneDirectory to preserve zone organization.
-func loadZoneFileWithRoot(path string, defaultTTL time.Duration) (string, []domain.ResourceRecord, error) {
-	ext := strings.ToLower(filepath.Ext(path))
-	var parser koanf.Parser
-	switch ext {
+// parserFor returns the parser for a zone file's extension, or nil for unsupported files.
+func parserFor(path string) koanf.Parser {
+	switch strings.ToLower(filepath.Ext(path)) {
 	case ".yaml", ".yml":
-		parser = yaml.Parser()
+		return yaml.Parser()
 	case ".json":
-		parser = json.Parser()
+		return json.Parser()
 	case ".toml":
-		parser = toml.Parser()
+		return toml.Parser()
 	default:
+		return nil
+	}
+}
+
+// loadZoneFileWithRoot loads and parses a single zone file, returning both the zone root and records.
+// This is used by LoadZoneDirectory to preserve zone organization.
+func loadZoneFileWithRoot(path string, defaultTTL time.Duration) (string, []domain.ResourceRecord, error) {
+	parser := parserFor(path)
+	if parser == nil {
 		return "", nil, nil // unsupported file type
 	}
 
@@ -146,12 +167,17 @@ func loadZoneFileWithRoot(path string, defaultTTL time.Duration) (string, []doma
 	if root == "" {
 		return "", nil, fmt.Errorf("zone file %s missing 'zone_root'", path)
 	}
+	return buildZoneRecords(path, root, k.Raw(), defaultTTL)
+}
 
+// buildZoneRecords builds the records of a parsed zone file from its owner name
+// maps, returning them with the canonical zone root.
+func buildZoneRecords(path, root string, owners map[string]any, defaultTTL time.Duration) (string, []domain.ResourceRecord, error) {
 	// Canonicalize the zone root to ensure consistent format with trailing dot
 	root = utils.CanonicalDNSName(root)
 
 	var records []domain.ResourceRecord
-	for name, raw := range k.Raw() {
+	for name, raw := range owners {
 		if name == "zone_root" {
 			continue
 		}
@@ -76,6 +76,34 @@ func TestLoadZoneDirectory(t *testing.T) {
 	}
 }
 
+func TestLoadZoneFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	yamlFile := writeTestFile(t, tmpDir, "zone.yaml", testYAML)
+	splitFile := writeTestFile(t, tmpDir, "split.yaml", "zone_root: example.com\nmail:\n  A: 1.2.3.5\n")
+	emptyFile := writeTestFile(t, tmpDir, "empty.toml", "zone_root = \"example.net\"\n")
+	writeTestFile(t, tmpDir, "notes.txt", "not a zone file")
+
+	zones, files, err := LoadZoneFiles(tmpDir, 60*time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(zones) != 1 || len(zones["example.com"]) != 2 {
+		t.Errorf("expected example.com with 2 records, got %v", zones)
+	}
+	want := ZoneFiles{
+		"example.com": {splitFile, yamlFile},
+		"example.net": {emptyFile},
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("expected files %v, got %v", want, files)
+	}
+
+	writeTestFile(t, tmpDir, "bad.yaml", testInvalidYAML)
+	if _, files, err := LoadZoneFiles(tmpDir, 60*time.Second); err == nil || files != nil {
+		t.Errorf("expected error and no files, got %v, %v", files, err)
+	}
+}
+
 func TestLoadZoneDrirectory_Empty(t *testing.T) {
 	tmpDir := t.TempDir()
 	records, err := LoadZoneDirectory(tmpDir, 60*time.Second)
@@ -207,8 +235,8 @@ func TestLoadZoneFile_JSON(t *testing.T) {
 	if !bytes.Equal(r.Data, expected) {
 		t.Errorf("unexpected data: got %v, want %v", r.Data, expected)
 	}
-	if r.TTL() != 120 {
-		t.Errorf("unexpected TTL: %d", r.TTL())
+	if r.OriginalTTL() != 120 {
+		t.Errorf("unexpected TTL: %d", r.OriginalTTL())
 	}
 }
 
@@ -245,8 +273,8 @@ MX = ["10 mail.example.com"]
 		t.Errorf("unexpected record types: %v", types)
 	}
 	for _, r := range records {
-		if r.TTL() != 180 {
-			t.Errorf("unexpected TTL: %d", r.TTL())
+		if r.OriginalTTL() != 180 {
+			t.Errorf("unexpected TTL: %d", r.OriginalTTL())
 		}
 	}
 }
@@ -354,8 +382,8 @@ func TestBuildResourceRecord(t *testing.T) {
 	if ar.Class != 1 {
 		t.Errorf("Class = %v, want 1", ar.Class)
 	}
-	if ar.TTL() != 60 {
-		t.Errorf("TTL = %v, want 60", ar.TTL())
+	if ar.OriginalTTL() != 60 {
+		t.Errorf("TTL = %v, want 60", ar.OriginalTTL())
 	}
 	if !bytes.Equal(ar.Data, net.ParseIP(val).To4()) {
 		t.Errorf("data does not equal bytes for IP %s", val)
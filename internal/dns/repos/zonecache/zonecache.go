@@ -102,5 +102,20 @@ func (zc *ZoneCache) Count() int {
 	return count
 }
 
+// RecordCount returns the number of records in one zone, 0 when it is not cached
+func (zc *ZoneCache) RecordCount(zoneRoot string) int {
+	zoneRoot = utils.CanonicalDNSName(zoneRoot)
+
+	zc.mu.RLock()
+	defer zc.mu.RUnlock()
+
+	count := 0
+	for _, records := range zc.zones[zoneRoot] {
+		count += len(records)
+	}
+
+	return count
+}
+
 // Ensure ZoneCache implements resolver.ZoneCache at compile time
 var _ resolver.ZoneCache = (*ZoneCache)(nil)
@@ -498,3 +498,22 @@ func TestZoneCache_EdgeCases(t *testing.T) {
 		}
 	})
 }
+
+func TestZoneCache_RecordCount(t *testing.T) {
+	zc := New()
+	zc.PutZone("example.com", []domain.ResourceRecord{
+		{Name: "www.example.com", Type: 1, Class: 1, Data: []byte{192, 168, 1, 1}},
+		{Name: "www.example.com", Type: 1, Class: 1, Data: []byte{192, 168, 1, 2}},
+		{Name: "mail.example.com", Type: 1, Class: 1, Data: []byte{192, 168, 1, 3}},
+	})
+
+	if got := zc.RecordCount("example.com."); got != 3 {
+		t.Errorf("expected 3 records, got %d", got)
+	}
+	if got := zc.RecordCount("EXAMPLE.COM"); got != 3 {
+		t.Errorf("expected zone names to be case-insensitive, got %d records", got)
+	}
+	if got := zc.RecordCount("other.com"); got != 0 {
+		t.Errorf("expected 0 records for an unknown zone, got %d", got)
+	}
+}
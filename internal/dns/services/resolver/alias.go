@@ -302,14 +302,14 @@ func (a *aliasChaser) upstreamLookup(q domain.Question, target string) ([]domain
 	if a.up == nil {
 		return nil, false
 	}
-	recs, err := a.up.Resolve(context.Background(), q, a.clock.Now())
-	if err != nil || len(recs) == 0 {
+	resp, err := a.up.Resolve(context.Background(), q, a.clock.Now())
+	if err != nil || len(resp.Answers) == 0 {
 		if err != nil {
 			a.logger.Debug(map[string]any{"error": err, "target": target}, "Upstream lookup during alias chase failed")
 		}
 		return nil, false
 	}
-	return recs, true
+	return resp.Answers, true
 }
 
 // Interface assertions
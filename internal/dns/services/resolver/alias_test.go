@@ -39,7 +39,12 @@ func (f *fakeCache) Delete(string) {}
 func (f *fakeCache) Get(string) ([]domain.ResourceRecord, bool) {
 	return nil, false
 }
-func (f *fakeCache) Put(string, []domain.ResourceRecord) {}
+func (f *fakeCache) GetStale(string) ([]domain.ResourceRecord, bool) {
+	return nil, false
+}
+func (f *fakeCache) SetNegative(string, domain.RCode, time.Duration) {}
+func (f *fakeCache) GetNegative(string) (domain.RCode, bool)         { return 0, false }
+func (f *fakeCache) Put(string, []domain.ResourceRecord)             {}
 
 func (f *fakeCache) Len() int { return 0 }
 
@@ -59,6 +64,7 @@ func (f *fakeZone) PutZone(string, []domain.ResourceRecord) {}
 func (f *fakeZone) RemoveZone(string)                       {}
 func (f *fakeZone) Zones() []string                         { return nil }
 func (f *fakeZone) Count() int                              { return 0 }
+func (f *fakeZone) RecordCount(string) int                  { return 0 }
 
 // fake upstream client
 type fakeUpstream struct {
@@ -66,8 +72,8 @@ type fakeUpstream struct {
 	err  error
 }
 
-func (f *fakeUpstream) Resolve(ctx context.Context, q domain.Question, now time.Time) ([]domain.ResourceRecord, error) {
-	return f.recs, f.err
+func (f *fakeUpstream) Resolve(ctx context.Context, q domain.Question, now time.Time) (domain.DNSResponse, error) {
+	return domain.DNSResponse{Answers: f.recs}, f.err
 }
 
 // helper to create authoritative RR quickly (can bypass validation where needed)
@@ -0,0 +1,181 @@
+package resolver
+
+import (
+	"encoding/binary"
+	"strings"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/common/utils"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// CachePolicy controls how long upstream answers stay in the cache. TTLs are
+// applied when answers are stored; the zero value caches every answer with
+// the TTLs upstream sent and caches no negative answers.
+type CachePolicy struct {
+	// MinTTL raises shorter record TTLs, including TTL 0.
+	MinTTL time.Duration
+	// MaxTTL lowers longer record TTLs. 0 leaves them uncapped.
+	MaxTTL time.Duration
+	// NegativeMinTTL raises the TTL of cached empty answers (NXDOMAIN or
+	// NODATA). Their TTL is otherwise the negative TTL of the SOA record in the
+	// authority section (RFC 2308 §5); without one it is 0, and the answer is
+	// only cached when this floor is set.
+	NegativeMinTTL time.Duration
+	// NegativeMaxTTL caps NegativeMinTTL and negative TTL overrides. 0 leaves them uncapped.
+	NegativeMaxTTL time.Duration
+	// TTLOverrides caches answers for names at or below a domain suffix with a
+	// fixed TTL instead, ignoring the limits above. The most specific suffix wins.
+	TTLOverrides map[string]time.Duration
+	// NeverCache lists domain suffixes whose answers are never cached.
+	NeverCache []string
+}
+
+// cachePolicy is a CachePolicy with canonical suffixes, ready for lookups.
+type cachePolicy struct {
+	minTTL, maxTTL                 uint32
+	negativeMinTTL, negativeMaxTTL uint32
+	overrides                      map[string]uint32
+	neverCache                     map[string]struct{}
+}
+
+// newCachePolicy canonicalizes the suffixes of p and converts its durations to TTL seconds.
+func newCachePolicy(p CachePolicy) cachePolicy {
+	policy := cachePolicy{
+		minTTL:         ttlSeconds(p.MinTTL),
+		maxTTL:         ttlSeconds(p.MaxTTL),
+		negativeMinTTL: ttlSeconds(p.NegativeMinTTL),
+		negativeMaxTTL: ttlSeconds(p.NegativeMaxTTL),
+	}
+	if len(p.TTLOverrides) > 0 {
+		policy.overrides = make(map[string]uint32, len(p.TTLOverrides))
+		for suffix, ttl := range p.TTLOverrides {
+			if suffix = utils.CanonicalDNSName(suffix); suffix != "" {
+				policy.overrides[suffix] = ttlSeconds(ttl)
+			}
+		}
+	}
+	if len(p.NeverCache) > 0 {
+		policy.neverCache = make(map[string]struct{}, len(p.NeverCache))
+		for _, suffix := range p.NeverCache {
+			if suffix = utils.CanonicalDNSName(suffix); suffix != "" {
+				policy.neverCache[suffix] = struct{}{}
+			}
+		}
+	}
+	return policy
+}
+
+// ttlSeconds converts d to whole seconds, saturating at the largest TTL.
+func ttlSeconds(d time.Duration) uint32 {
+	seconds := int64(d / time.Second)
+	switch {
+	case seconds <= 0:
+		return 0
+	case seconds > int64(^uint32(0)):
+		return ^uint32(0)
+	}
+	return uint32(seconds)
+}
+
+// cacheable reports whether answers for name may be cached at all.
+func (p cachePolicy) cacheable(name string) bool {
+	_, _, never := matchSuffix(p.neverCache, name)
+	return !never
+}
+
+// ttl returns the TTL to cache a record with, given the TTL it has left.
+func (p cachePolicy) ttl(name string, ttl uint32) uint32 {
+	if override, _, ok := matchSuffix(p.overrides, name); ok {
+		return override
+	}
+	if ttl < p.minTTL {
+		ttl = p.minTTL
+	}
+	if p.maxTTL > 0 && ttl > p.maxTTL {
+		ttl = p.maxTTL
+	}
+	return ttl
+}
+
+// negativeTTL returns how long an empty answer for name is cached, given the
+// negative TTL upstream sent with it; 0 means not at all.
+func (p cachePolicy) negativeTTL(name string, ttl uint32) uint32 {
+	if override, _, ok := matchSuffix(p.overrides, name); ok {
+		ttl = override
+	} else if ttl < p.negativeMinTTL {
+		ttl = p.negativeMinTTL
+	}
+	if p.negativeMaxTTL > 0 && ttl > p.negativeMaxTTL {
+		ttl = p.negativeMaxTTL
+	}
+	return ttl
+}
+
+// soaNegativeTTL returns the negative TTL of an empty answer: the lower of the
+// TTL and the MINIMUM field of the SOA record in its authority section (RFC
+// 2308 §5), counted at now. It is 0 when there is no SOA record.
+func soaNegativeTTL(authority []domain.ResourceRecord, now time.Time) uint32 {
+	for _, rr := range authority {
+		// MINIMUM is the last of the five 32-bit fields closing the SOA RDATA.
+		if rr.Type == domain.RRTypeSOA && len(rr.Data) >= 22 {
+			return min(rr.TTL(now), binary.BigEndian.Uint32(rr.Data[len(rr.Data)-4:]))
+		}
+	}
+	return 0
+}
+
+// apply returns records with their TTLs adjusted to the policy for the query
+// name. Records whose TTL is unchanged are returned as they are; the others
+// are copied with the new TTL counted from now.
+func (p cachePolicy) apply(name string, records []domain.ResourceRecord, now time.Time) []domain.ResourceRecord {
+	var out []domain.ResourceRecord
+	for i, rr := range records {
+		ttl := p.ttl(name, rr.TTL(now))
+		if ttl == rr.TTL(now) {
+			if out != nil {
+				out = append(out, rr)
+			}
+			continue
+		}
+		adjusted, err := domain.NewCachedResourceRecord(rr.Name, rr.Type, rr.Class, ttl, rr.Data, rr.Text, now)
+		if err != nil {
+			if out != nil {
+				out = append(out, rr)
+			}
+			continue
+		}
+		adjusted.Authenticated = rr.Authenticated
+		if out == nil {
+			out = make([]domain.ResourceRecord, i, len(records))
+			copy(out, records[:i])
+		}
+		out = append(out, adjusted)
+	}
+	if out == nil {
+		return records
+	}
+	return out
+}
+
+// matchSuffix returns the value for the most specific suffix in m containing
+// name, along with that suffix. It walks from the full name towards the root,
+// so "db.prod.corp.example" prefers "prod.corp.example" over "corp.example".
+func matchSuffix[T any](m map[string]T, name string) (T, string, bool) {
+	var zero T
+	if len(m) == 0 {
+		return zero, "", false
+	}
+	name = utils.CanonicalDNSName(name)
+	for name != "" {
+		if value, ok := m[name]; ok {
+			return value, name, true
+		}
+		i := strings.IndexByte(name, '.')
+		if i < 0 {
+			break
+		}
+		name = name[i+1:]
+	}
+	return zero, "", false
+}
@@ -0,0 +1,303 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/common/rrdata"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+func TestNewCachePolicy(t *testing.T) {
+	p := newCachePolicy(CachePolicy{
+		MinTTL:       1500 * time.Millisecond,
+		MaxTTL:       200 * 365 * 24 * time.Hour,
+		TTLOverrides: map[string]time.Duration{"Corp.Example.": time.Minute, "": time.Hour},
+		NeverCache:   []string{"Dyn.Example", "."},
+	})
+	assert.Equal(t, uint32(1), p.minTTL, "durations round down to whole seconds")
+	assert.Equal(t, ^uint32(0), p.maxTTL, "durations saturate at the largest ttl")
+	assert.Equal(t, map[string]uint32{"corp.example": 60}, p.overrides)
+	assert.Equal(t, map[string]struct{}{"dyn.example": {}}, p.neverCache)
+
+	zero := newCachePolicy(CachePolicy{})
+	assert.Nil(t, zero.overrides)
+	assert.Nil(t, zero.neverCache)
+}
+
+func TestCachePolicy_TTL(t *testing.T) {
+	p := newCachePolicy(CachePolicy{
+		MinTTL:       30 * time.Second,
+		MaxTTL:       time.Hour,
+		TTLOverrides: map[string]time.Duration{"corp.example": 5 * time.Second, "static.corp.example": 48 * time.Hour},
+	})
+	tests := []struct {
+		name  string
+		qname string
+		ttl   uint32
+		want  uint32
+	}{
+		{name: "zero ttl raised", qname: "example.com.", ttl: 0, want: 30},
+		{name: "within limits", qname: "example.com.", ttl: 300, want: 300},
+		{name: "long ttl capped", qname: "example.com.", ttl: 86400 * 7, want: 3600},
+		{name: "override ignores min", qname: "db.corp.example.", ttl: 300, want: 5},
+		{name: "most specific override ignores max", qname: "cdn.static.corp.example.", ttl: 300, want: 172800},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, p.ttl(tt.qname, tt.ttl))
+		})
+	}
+
+	assert.Equal(t, uint32(86400), newCachePolicy(CachePolicy{}).ttl("example.com.", 86400), "no max leaves ttls uncapped")
+}
+
+func TestCachePolicy_NegativeTTL(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy CachePolicy
+		soa    uint32
+		want   uint32
+	}{
+		{name: "no SOA and no floor", policy: CachePolicy{}, want: 0},
+		{name: "floor", policy: CachePolicy{NegativeMinTTL: time.Minute}, want: 60},
+		{name: "floor capped", policy: CachePolicy{NegativeMinTTL: time.Hour, NegativeMaxTTL: time.Minute}, want: 60},
+		{name: "override", policy: CachePolicy{TTLOverrides: map[string]time.Duration{"example.com": 10 * time.Second}}, want: 10},
+		{name: "override capped", policy: CachePolicy{NegativeMaxTTL: 5 * time.Second, TTLOverrides: map[string]time.Duration{"example.com": time.Minute}}, want: 5},
+		{name: "SOA", policy: CachePolicy{}, soa: 900, want: 900},
+		{name: "SOA raised to floor", policy: CachePolicy{NegativeMinTTL: time.Minute}, soa: 30, want: 60},
+		{name: "SOA capped", policy: CachePolicy{NegativeMaxTTL: 3 * time.Hour}, soa: 86400, want: 10800},
+		{name: "override replaces SOA", policy: CachePolicy{TTLOverrides: map[string]time.Duration{"example.com": 10 * time.Second}}, soa: 900, want: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, newCachePolicy(tt.policy).negativeTTL("nope.example.com.", tt.soa))
+		})
+	}
+}
+
+// newTestSOA returns an SOA record for example. with the given TTL and MINIMUM field.
+func newTestSOA(t *testing.T, ttl uint32, minimum string, now time.Time) domain.ResourceRecord {
+	t.Helper()
+	data, err := rrdata.Encode(domain.RRTypeSOA, "ns1.example. hostmaster.example. 1 7200 900 1209600 "+minimum)
+	require.NoError(t, err)
+	rr, err := domain.NewCachedResourceRecord("example.", domain.RRTypeSOA, domain.RRClassIN, ttl, data, "", now)
+	require.NoError(t, err)
+	return rr
+}
+
+func TestSOANegativeTTL(t *testing.T) {
+	now := time.Now()
+	ns := createTestRecord("example.", domain.RRTypeNS, []byte{0}, "ns1.example.")
+
+	assert.Equal(t, uint32(300), soaNegativeTTL([]domain.ResourceRecord{ns, newTestSOA(t, 3600, "300", now)}, now), "MINIMUM below the TTL")
+	assert.Equal(t, uint32(60), soaNegativeTTL([]domain.ResourceRecord{newTestSOA(t, 60, "300", now)}, now), "TTL below MINIMUM")
+	assert.Equal(t, uint32(0), soaNegativeTTL([]domain.ResourceRecord{ns}, now), "no SOA")
+	assert.Equal(t, uint32(0), soaNegativeTTL(nil, now))
+}
+
+func TestCachePolicy_Cacheable(t *testing.T) {
+	p := newCachePolicy(CachePolicy{NeverCache: []string{"dyn.example"}})
+	assert.False(t, p.cacheable("dyn.example."))
+	assert.False(t, p.cacheable("Host.Dyn.Example."))
+	assert.True(t, p.cacheable("notdyn.example."))
+	assert.True(t, newCachePolicy(CachePolicy{}).cacheable("dyn.example."))
+}
+
+func TestCachePolicy_Apply(t *testing.T) {
+	now := time.Now()
+	short, _ := domain.NewCachedResourceRecord("example.com.", domain.RRTypeA, domain.RRClass(1), 0, []byte{192, 0, 2, 1}, "192.0.2.1", now)
+	short.Authenticated = true
+	ok := createTestRecord("example.com.", domain.RRTypeA, []byte{192, 0, 2, 2}, "192.0.2.2")
+	records := []domain.ResourceRecord{ok, short}
+
+	p := newCachePolicy(CachePolicy{MinTTL: time.Minute})
+	got := p.apply("example.com.", records, now)
+	if assert.Len(t, got, 2) {
+		assert.Equal(t, ok, got[0], "records within limits are kept as is")
+		assert.Equal(t, uint32(300), got[0].OriginalTTL())
+		assert.Equal(t, uint32(60), got[1].OriginalTTL())
+		assert.Equal(t, short.Data, got[1].Data)
+		assert.True(t, got[1].Authenticated)
+	}
+	assert.Equal(t, uint32(0), records[1].TTL(now), "the input is not modified")
+
+	unchanged := []domain.ResourceRecord{ok}
+	assert.Equal(t, unchanged, newCachePolicy(CachePolicy{}).apply("example.com.", unchanged, now))
+}
+
+func TestMatchSuffix(t *testing.T) {
+	m := map[string]int{"example": 1, "corp.example": 2}
+	tests := []struct {
+		name       string
+		qname      string
+		want       int
+		wantSuffix string
+		wantOK     bool
+	}{
+		{name: "exact", qname: "corp.example.", want: 2, wantSuffix: "corp.example", wantOK: true},
+		{name: "most specific", qname: "db.corp.example.", want: 2, wantSuffix: "corp.example", wantOK: true},
+		{name: "parent", qname: "www.example.", want: 1, wantSuffix: "example", wantOK: true},
+		{name: "no match", qname: "example.com.", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, suffix, ok := matchSuffix(m, tt.qname)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantSuffix, suffix)
+			assert.Equal(t, tt.wantOK, ok)
+		})
+	}
+	_, _, ok := matchSuffix(map[string]int(nil), "example.")
+	assert.False(t, ok)
+}
+
+func TestResolver_CacheUpstreamResponse_Policy(t *testing.T) {
+	record := createTestRecord("dyn.example.", domain.RRTypeA, []byte{192, 0, 2, 1}, "192.0.2.1")
+	answer := domain.DNSResponse{RCode: domain.NOERROR, Answers: []domain.ResourceRecord{record}}
+
+	t.Run("never cache", func(t *testing.T) {
+		mockCache := &MockCache{}
+		r := &Resolver{
+			clock:         &clock.MockClock{CurrentTime: time.Now()},
+			upstreamCache: mockCache,
+			cachePolicy:   newCachePolicy(CachePolicy{NeverCache: []string{"dyn.example"}, NegativeMinTTL: time.Minute}),
+		}
+		assert.NoError(t, r.cacheUpstreamResponse(createTestQuery("dyn.example.", domain.RRTypeA), answer))
+		assert.NoError(t, r.cacheUpstreamResponse(createTestQuery("host.dyn.example.", domain.RRTypeA), domain.DNSResponse{RCode: domain.NXDOMAIN}))
+		mockCache.AssertNotCalled(t, "Set", mock.Anything)
+		mockCache.AssertNotCalled(t, "SetNegative", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("negative answers", func(t *testing.T) {
+		now := time.Now()
+		soa := newTestSOA(t, 3600, "300", now)
+		tests := []struct {
+			name    string
+			policy  CachePolicy
+			resp    domain.DNSResponse
+			wantTTL time.Duration
+		}{
+			{name: "NXDOMAIN with SOA", resp: domain.DNSResponse{RCode: domain.NXDOMAIN, Authority: []domain.ResourceRecord{soa}}, wantTTL: 300 * time.Second},
+			{name: "NODATA with SOA", resp: domain.DNSResponse{RCode: domain.NOERROR, Authority: []domain.ResourceRecord{soa}}, wantTTL: 300 * time.Second},
+			{name: "NODATA without SOA raised to floor", policy: CachePolicy{NegativeMinTTL: time.Minute}, resp: domain.DNSResponse{RCode: domain.NOERROR}, wantTTL: time.Minute},
+			{name: "SOA capped", policy: CachePolicy{NegativeMaxTTL: time.Minute}, resp: domain.DNSResponse{RCode: domain.NXDOMAIN, Authority: []domain.ResourceRecord{soa}}, wantTTL: time.Minute},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				query := createTestQuery("nope.example.", domain.RRTypeA)
+				mockCache := &MockCache{}
+				mockCache.On("SetNegative", query.CacheKey(), tt.resp.RCode, tt.wantTTL).Return()
+				r := &Resolver{
+					clock:         &clock.MockClock{CurrentTime: now},
+					upstreamCache: mockCache,
+					cachePolicy:   newCachePolicy(tt.policy),
+				}
+				assert.NoError(t, r.cacheUpstreamResponse(query, tt.resp))
+				mockCache.AssertExpectations(t)
+			})
+		}
+	})
+
+	t.Run("not cached", func(t *testing.T) {
+		soa := newTestSOA(t, 3600, "300", time.Now())
+		cname := createTestRecord("nope.example.", domain.RRTypeCNAME, []byte{0}, "gone.example.")
+		tests := []struct {
+			name string
+			resp domain.DNSResponse
+		}{
+			{name: "empty answer without SOA", resp: domain.DNSResponse{RCode: domain.NOERROR}},
+			{name: "SERVFAIL", resp: domain.DNSResponse{RCode: domain.SERVFAIL, Authority: []domain.ResourceRecord{soa}}},
+			{name: "REFUSED", resp: domain.DNSResponse{RCode: domain.REFUSED}},
+			{name: "NXDOMAIN after a CNAME", resp: domain.DNSResponse{RCode: domain.NXDOMAIN, Answers: []domain.ResourceRecord{cname}, Authority: []domain.ResourceRecord{soa}}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				mockCache := &MockCache{}
+				r := &Resolver{clock: &clock.MockClock{CurrentTime: time.Now()}, upstreamCache: mockCache}
+				assert.NoError(t, r.cacheUpstreamResponse(createTestQuery("nope.example.", domain.RRTypeA), tt.resp))
+				mockCache.AssertNotCalled(t, "SetNegative", mock.Anything, mock.Anything, mock.Anything)
+				mockCache.AssertNotCalled(t, "Set", mock.Anything)
+			})
+		}
+	})
+
+	t.Run("ttl clamped", func(t *testing.T) {
+		mockCache := &MockCache{}
+		mockCache.On("Set", mock.MatchedBy(func(records []domain.ResourceRecord) bool {
+			return len(records) == 1 && records[0].OriginalTTL() == 60
+		})).Return(nil)
+		r := &Resolver{
+			clock:         &clock.MockClock{CurrentTime: time.Now()},
+			upstreamCache: mockCache,
+			cachePolicy:   newCachePolicy(CachePolicy{MaxTTL: time.Minute}),
+		}
+		assert.NoError(t, r.cacheUpstreamResponse(createTestQuery("dyn.example.", domain.RRTypeA), answer))
+		mockCache.AssertExpectations(t)
+	})
+}
+
+func TestResolver_HandleQuery_NegativeCacheHit(t *testing.T) {
+	for _, rcode := range []domain.RCode{domain.NXDOMAIN, domain.NOERROR} {
+		t.Run(rcode.String(), func(t *testing.T) {
+			query := createTestQuery("nope.example.", domain.RRTypeA)
+			mockCache := &MockCache{}
+			mockCache.On("Get", query.CacheKey()).Return([]domain.ResourceRecord{}, true)
+			mockCache.On("GetNegative", query.CacheKey()).Return(rcode, true)
+			mockUpstream := &MockUpstreamClient{}
+
+			resolver := NewResolver(ResolverOptions{
+				Clock:         &clock.MockClock{CurrentTime: time.Now()},
+				Logger:        &noopLogger{},
+				Upstream:      mockUpstream,
+				UpstreamCache: mockCache,
+			})
+			response, err := resolver.HandleQuery(context.Background(), query, &net.UDPAddr{})
+
+			assert.NoError(t, err)
+			assert.Equal(t, rcode, response.RCode)
+			assert.Empty(t, response.Answers)
+			mockUpstream.AssertNotCalled(t, "Resolve", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestResolver_HandleQuery_UpstreamRCode(t *testing.T) {
+	now := time.Now()
+	soa := newTestSOA(t, 3600, "300", now)
+	for _, rcode := range []domain.RCode{domain.NXDOMAIN, domain.SERVFAIL, domain.REFUSED} {
+		t.Run(rcode.String(), func(t *testing.T) {
+			query := createTestQuery("nope.example.", domain.RRTypeA)
+			mockCache := &MockCache{}
+			mockCache.On("Get", query.CacheKey()).Return([]domain.ResourceRecord{}, false)
+			mockCache.On("GetStale", query.CacheKey()).Return([]domain.ResourceRecord(nil), false)
+			mockCache.On("SetNegative", query.CacheKey(), domain.NXDOMAIN, 300*time.Second).Return()
+			mockUpstream := &MockUpstreamClient{}
+			mockUpstream.On("Resolve", mock.Anything, query, mock.Anything).
+				Return(domain.DNSResponse{RCode: rcode, Authority: []domain.ResourceRecord{soa}}, nil)
+
+			resolver := NewResolver(ResolverOptions{
+				Clock:         &clock.MockClock{CurrentTime: now},
+				Logger:        &noopLogger{},
+				Upstream:      mockUpstream,
+				UpstreamCache: mockCache,
+			})
+			response, err := resolver.HandleQuery(context.Background(), query, &net.UDPAddr{})
+
+			assert.NoError(t, err)
+			assert.Equal(t, rcode, response.RCode, "the upstream RCODE is passed on")
+			if rcode == domain.NXDOMAIN {
+				mockCache.AssertCalled(t, "SetNegative", query.CacheKey(), domain.NXDOMAIN, 300*time.Second)
+			} else {
+				mockCache.AssertNotCalled(t, "SetNegative", mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package resolver
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// upstreamAnswer is the outcome of one upstream exchange.
+type upstreamAnswer struct {
+	response domain.DNSResponse
+	// server is the upstream server that answered, if the client reported it.
+	server string
+}
+
+// flight is a single upstream exchange shared by every concurrent caller with the same key.
+type flight struct {
+	done   chan struct{}
+	answer upstreamAnswer
+	err    error
+	// dups counts callers that joined the flight after it started.
+	dups int
+}
+
+// inflight deduplicates concurrent upstream lookups for the same question
+// (singleflight). The first caller for a key starts the exchange in its own
+// goroutine; later callers wait for that result instead of sending another
+// query. Each caller waits on its own context, so a client that gives up
+// returns immediately without cancelling the exchange for everyone else.
+type inflight struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// do returns the result of fn for key, sharing one call of fn among all
+// concurrent callers. fn must not depend on any single caller's cancellation.
+// shared reports whether the caller joined an exchange started by someone else.
+func (g *inflight) do(ctx context.Context, key string, fn func() (upstreamAnswer, error)) (answer upstreamAnswer, shared bool, err error) {
+	g.mu.Lock()
+	if g.flights == nil {
+		g.flights = make(map[string]*flight)
+	}
+	f, shared := g.flights[key]
+	if shared {
+		f.dups++
+	} else {
+		f = &flight{done: make(chan struct{})}
+		g.flights[key] = f
+		go func() {
+			f.answer, f.err = fn()
+			g.mu.Lock()
+			delete(g.flights, key)
+			g.mu.Unlock()
+			close(f.done)
+		}()
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-f.done:
+		// Each caller gets its own slices so appends cannot leak between responses.
+		answer := f.answer
+		answer.response.Answers = slices.Clone(answer.response.Answers)
+		answer.response.Authority = slices.Clone(answer.response.Authority)
+		answer.response.Additional = slices.Clone(answer.response.Additional)
+		return answer, shared, f.err
+	case <-ctx.Done():
+		return upstreamAnswer{}, shared, ctx.Err()
+	}
+}
@@ -0,0 +1,177 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// dupsFor reports how many callers have joined the in-flight exchange for key.
+func (g *inflight) dupsFor(key string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if f, ok := g.flights[key]; ok {
+		return f.dups
+	}
+	return -1
+}
+
+func TestInflight_CoalescesConcurrentCalls(t *testing.T) {
+	var g inflight
+	var calls atomic.Int32
+	release := make(chan struct{})
+	want := []domain.ResourceRecord{createTestRecord("popular.com.", domain.RRType(1), []byte{192, 0, 2, 1}, "192.0.2.1")}
+	fn := func() (upstreamAnswer, error) {
+		calls.Add(1)
+		<-release
+		return upstreamAnswer{response: domain.DNSResponse{Answers: want}, server: "192.0.2.53:53"}, nil
+	}
+
+	const callers = 10
+	var wg sync.WaitGroup
+	results := make([][]domain.ResourceRecord, callers)
+	sharedCount := atomic.Int32{}
+	for i := range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			answer, shared, err := g.do(context.Background(), "popular.com|A|IN", fn)
+			assert.NoError(t, err)
+			assert.Equal(t, "192.0.2.53:53", answer.server)
+			if shared {
+				sharedCount.Add(1)
+			}
+			results[i] = answer.response.Answers
+		}()
+	}
+
+	require.Eventually(t, func() bool { return g.dupsFor("popular.com|A|IN") == callers-1 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load(), "only one upstream exchange should be made")
+	assert.Equal(t, int32(callers-1), sharedCount.Load())
+	for _, records := range results {
+		assert.Equal(t, want, records)
+	}
+	assert.Equal(t, -1, g.dupsFor("popular.com|A|IN"), "finished flights must be forgotten")
+}
+
+func TestInflight_CancelledWaiterDoesNotCancelOthers(t *testing.T) {
+	var g inflight
+	started := make(chan struct{})
+	release := make(chan struct{})
+	upstreamErr := errors.New("servfail")
+	fn := func() (upstreamAnswer, error) {
+		close(started)
+		<-release
+		return upstreamAnswer{}, upstreamErr
+	}
+
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	leaderDone := make(chan error, 1)
+	go func() {
+		_, _, err := g.do(leaderCtx, "key", fn)
+		leaderDone <- err
+	}()
+	<-started
+
+	followerDone := make(chan error, 1)
+	go func() {
+		_, shared, err := g.do(context.Background(), "key", fn)
+		assert.True(t, shared)
+		followerDone <- err
+	}()
+	require.Eventually(t, func() bool { return g.dupsFor("key") == 1 }, time.Second, time.Millisecond)
+
+	// The leader gives up; it returns at once but the exchange keeps running
+	cancelLeader()
+	assert.ErrorIs(t, <-leaderDone, context.Canceled)
+	select {
+	case err := <-followerDone:
+		t.Fatalf("follower returned early: %v", err)
+	default:
+	}
+
+	close(release)
+	assert.ErrorIs(t, <-followerDone, upstreamErr)
+}
+
+func TestInflight_SequentialCallsAreNotShared(t *testing.T) {
+	var g inflight
+	var calls atomic.Int32
+	fn := func() (upstreamAnswer, error) {
+		calls.Add(1)
+		return upstreamAnswer{}, nil
+	}
+	for range 3 {
+		_, shared, err := g.do(context.Background(), "key", fn)
+		require.NoError(t, err)
+		assert.False(t, shared)
+	}
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestResolver_resolveUpstream_Coalesces(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	query := createTestQuery("popular.com.", domain.RRType(1))
+	records := []domain.ResourceRecord{createTestRecord("popular.com.", domain.RRType(1), []byte{192, 0, 2, 1}, "192.0.2.1")}
+
+	release := make(chan struct{})
+	upstream := &blockingUpstream{release: release, records: records}
+	r := NewResolver(ResolverOptions{Logger: &noopLogger{}, Upstream: upstream})
+
+	// The first client's context is cancelled mid-flight; the upstream call must not see it
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	done1 := make(chan error, 1)
+	go func() {
+		_, err := r.resolveUpstream(ctx1, query, now)
+		done1 <- err
+	}()
+	done2 := make(chan []domain.ResourceRecord, 1)
+	go func() {
+		q := query
+		q.ID = 999 // different client, same question
+		got, err := r.resolveUpstream(context.Background(), q, now)
+		assert.NoError(t, err)
+		done2 <- got.Answers
+	}()
+	require.Eventually(t, func() bool { return r.inflight.dupsFor(query.CacheKey()) == 1 }, time.Second, time.Millisecond)
+
+	cancel1()
+	assert.ErrorIs(t, <-done1, context.Canceled)
+	close(release)
+	assert.Equal(t, records, <-done2)
+	assert.Equal(t, int32(1), upstream.calls.Load())
+	assert.NoError(t, upstream.ctxErr.Load().(errHolder).err, "shared exchange must not inherit a caller's cancellation")
+
+	// Already-cancelled callers do not start an exchange
+	_, err := r.resolveUpstream(ctx1, query, now)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, int32(1), upstream.calls.Load())
+}
+
+type errHolder struct{ err error }
+
+// blockingUpstream blocks every Resolve call until release is closed.
+type blockingUpstream struct {
+	release chan struct{}
+	records []domain.ResourceRecord
+	calls   atomic.Int32
+	ctxErr  atomic.Value // errHolder with ctx.Err() observed after release
+}
+
+func (b *blockingUpstream) Resolve(ctx context.Context, _ domain.Question, _ time.Time) (domain.DNSResponse, error) {
+	b.calls.Add(1)
+	<-b.release
+	b.ctxErr.Store(errHolder{ctx.Err()})
+	return domain.DNSResponse{Answers: b.records}, nil
+}
@@ -0,0 +1,31 @@
+package resolver
+
+import "github.com/haukened/rr-dns/internal/dns/common/utils"
+
+// forwardZones routes queries for configured domain suffixes to dedicated
+// upstream clients (conditional forwarding). Keys are canonical DNS names.
+type forwardZones map[string]UpstreamClient
+
+// newForwardZones canonicalizes the suffixes of the configured forward zones.
+// Entries with an empty suffix or a nil client are ignored; the default
+// upstream already covers the root.
+func newForwardZones(zones map[string]UpstreamClient) forwardZones {
+	if len(zones) == 0 {
+		return nil
+	}
+	out := make(forwardZones, len(zones))
+	for suffix, client := range zones {
+		suffix = utils.CanonicalDNSName(suffix)
+		if suffix == "" || client == nil {
+			continue
+		}
+		out[suffix] = client
+	}
+	return out
+}
+
+// match returns the client for the most specific forward zone containing name,
+// along with that zone's suffix.
+func (f forwardZones) match(name string) (UpstreamClient, string, bool) {
+	return matchSuffix(f, name)
+}
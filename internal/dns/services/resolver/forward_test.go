@@ -0,0 +1,115 @@
+package resolver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+func TestNewForwardZones(t *testing.T) {
+	corp := &MockUpstreamClient{}
+	consul := &MockUpstreamClient{}
+
+	assert.Nil(t, newForwardZones(nil))
+
+	zones := newForwardZones(map[string]UpstreamClient{
+		"Corp.Example.": corp,
+		"consul":        consul,
+		".":             &MockUpstreamClient{}, // root is the default upstream's job
+		"nil.example":   nil,
+	})
+	assert.Len(t, zones, 2)
+	assert.Same(t, corp, zones["corp.example"])
+	assert.Same(t, consul, zones["consul"])
+}
+
+func TestForwardZones_match(t *testing.T) {
+	corp := &MockUpstreamClient{}
+	prod := &MockUpstreamClient{}
+	consul := &MockUpstreamClient{}
+	zones := newForwardZones(map[string]UpstreamClient{
+		"corp.example":      corp,
+		"prod.corp.example": prod,
+		"consul":            consul,
+	})
+
+	tests := []struct {
+		name     string
+		query    string
+		want     UpstreamClient
+		wantZone string
+	}{
+		{name: "exact suffix", query: "corp.example.", want: corp, wantZone: "corp.example"},
+		{name: "subdomain", query: "wiki.corp.example.", want: corp, wantZone: "corp.example"},
+		{name: "most specific suffix wins", query: "db.prod.corp.example.", want: prod, wantZone: "prod.corp.example"},
+		{name: "case insensitive", query: "Web.Service.CONSUL.", want: consul, wantZone: "consul"},
+		{name: "label boundary respected", query: "notcorp.example.", want: nil},
+		{name: "unrelated name", query: "example.com.", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, zone, ok := zones.match(tt.query)
+			if tt.want == nil {
+				assert.False(t, ok)
+				assert.Nil(t, client)
+				return
+			}
+			require.True(t, ok)
+			assert.Same(t, tt.want, client)
+			assert.Equal(t, tt.wantZone, zone)
+		})
+	}
+
+	var empty forwardZones
+	_, _, ok := empty.match("corp.example.")
+	assert.False(t, ok)
+}
+
+func TestResolver_resolveUpstream_ForwardZones(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	defaultUpstream := &MockUpstreamClient{}
+	corp := &MockUpstreamClient{}
+
+	r := NewResolver(ResolverOptions{
+		Logger:       &noopLogger{},
+		Upstream:     defaultUpstream,
+		ForwardZones: map[string]UpstreamClient{"corp.example": corp},
+	})
+
+	corpQuery := createTestQuery("intranet.corp.example.", domain.RRType(1))
+	corpRecords := []domain.ResourceRecord{createTestRecord("intranet.corp.example.", domain.RRType(1), []byte{10, 0, 0, 1}, "10.0.0.1")}
+	corp.On("Resolve", mock.Anything, corpQuery, now).Return(corpRecords, nil)
+
+	publicQuery := createTestQuery("example.com.", domain.RRType(1))
+	publicRecords := []domain.ResourceRecord{createTestRecord("example.com.", domain.RRType(1), []byte{192, 0, 2, 1}, "192.0.2.1")}
+	defaultUpstream.On("Resolve", mock.Anything, publicQuery, now).Return(publicRecords, nil)
+
+	got, err := r.resolveUpstream(ctx, corpQuery, now)
+	require.NoError(t, err)
+	assert.Equal(t, corpRecords, got.Answers)
+
+	got, err = r.resolveUpstream(ctx, publicQuery, now)
+	require.NoError(t, err)
+	assert.Equal(t, publicRecords, got.Answers)
+
+	corp.AssertExpectations(t)
+	defaultUpstream.AssertExpectations(t)
+
+	// Forward zones work even without a default upstream
+	r = NewResolver(ResolverOptions{
+		Logger:       &noopLogger{},
+		ForwardZones: map[string]UpstreamClient{"corp.example": corp},
+	})
+	got, err = r.resolveUpstream(ctx, corpQuery, now)
+	require.NoError(t, err)
+	assert.Equal(t, corpRecords, got.Answers)
+	_, err = r.resolveUpstream(ctx, publicQuery, now)
+	assert.EqualError(t, err, "no upstream client configured")
+}
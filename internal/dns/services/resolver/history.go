@@ -0,0 +1,97 @@
+package resolver
+
+import (
+	"strings"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// QueryRecord is an answered query as kept by a QueryHistory: a QueryLogEntry
+// reduced to values that can be stored and searched.
+type QueryRecord struct {
+	Time time.Time
+	// Client is the IP address the query came from, without port; empty when unknown.
+	Client string
+	Name   string
+	Type   domain.RRType
+	RCode  domain.RCode
+	// Answers summarizes the answer records as "name TYPE data".
+	Answers  []string
+	Source   AnswerSource
+	Upstream string
+	Duration time.Duration
+}
+
+// NewQueryRecord reduces a query log entry to a QueryRecord.
+func NewQueryRecord(e QueryLogEntry) QueryRecord {
+	answers := make([]string, 0, len(e.Answers))
+	for _, rr := range e.Answers {
+		answers = append(answers, rr.Name+" "+rr.Type.String()+" "+rr.Text)
+	}
+	var client string
+	if ip := e.ClientIP(); ip != nil {
+		client = ip.String()
+	}
+	return QueryRecord{
+		Time:     e.Time,
+		Client:   client,
+		Name:     e.Question.Name,
+		Type:     e.Question.Type,
+		RCode:    e.RCode,
+		Answers:  answers,
+		Source:   e.Source,
+		Upstream: e.Upstream,
+		Duration: e.Duration,
+	}
+}
+
+// Blocked reports whether the query was answered by the blocklist.
+func (r QueryRecord) Blocked() bool {
+	return r.Source == SourceBlocked
+}
+
+// QueryFilter selects the records returned by QueryHistory.Search. Every field
+// that is set must match; the zero value matches every record.
+type QueryFilter struct {
+	// Since and Until bound the query time. Since is inclusive and Until
+	// exclusive; zero values leave the range open.
+	Since time.Time
+	Until time.Time
+	// Client matches the client IP address exactly.
+	Client string
+	// Domain matches names containing it, case-insensitively and ignoring a trailing dot.
+	Domain string
+	// RCode, when set, matches one response code.
+	RCode *domain.RCode
+	// Blocked, when set, matches queries that were (true) or were not (false) blocked.
+	Blocked *bool
+	// Limit caps the number of records returned; 0 uses the history's default.
+	Limit int
+}
+
+// Matches reports whether r passes every condition of the filter except Limit.
+func (f QueryFilter) Matches(r QueryRecord) bool {
+	if !f.Since.IsZero() && r.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !r.Time.Before(f.Until) {
+		return false
+	}
+	if f.Client != "" && r.Client != f.Client {
+		return false
+	}
+	if f.RCode != nil && r.RCode != *f.RCode {
+		return false
+	}
+	if f.Blocked != nil && r.Blocked() != *f.Blocked {
+		return false
+	}
+	if f.Domain != "" {
+		domain := strings.ToLower(strings.TrimSuffix(f.Domain, "."))
+		if !strings.Contains(strings.ToLower(r.Name), domain) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package resolver
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+func TestNewQueryRecord(t *testing.T) {
+	a, err := domain.NewAuthoritativeResourceRecord("www.example.com.", domain.RRTypeA, domain.RRClassIN, 300, []byte{192, 0, 2, 1}, "192.0.2.1")
+	require.NoError(t, err)
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	entry := QueryLogEntry{
+		Time:     now,
+		Client:   &net.UDPAddr{IP: net.ParseIP("192.0.2.10"), Port: 40000},
+		Question: domain.Question{Name: "www.example.com.", Type: domain.RRTypeA, Class: domain.RRClassIN},
+		RCode:    domain.NOERROR,
+		Answers:  []domain.ResourceRecord{a},
+		Source:   SourceUpstream,
+		Upstream: "1.1.1.1:53",
+		Duration: 5 * time.Millisecond,
+	}
+
+	assert.Equal(t, QueryRecord{
+		Time:     now,
+		Client:   "192.0.2.10",
+		Name:     "www.example.com.",
+		Type:     domain.RRTypeA,
+		RCode:    domain.NOERROR,
+		Answers:  []string{"www.example.com A 192.0.2.1"},
+		Source:   SourceUpstream,
+		Upstream: "1.1.1.1:53",
+		Duration: 5 * time.Millisecond,
+	}, NewQueryRecord(entry))
+
+	entry.Client = nil
+	entry.Answers = nil
+	r := NewQueryRecord(entry)
+	assert.Empty(t, r.Client)
+	assert.NotNil(t, r.Answers)
+	assert.Empty(t, r.Answers)
+}
+
+func TestQueryFilter_Matches(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	record := QueryRecord{
+		Time:   now,
+		Client: "192.0.2.10",
+		Name:   "Www.Example.com.",
+		Type:   domain.RRTypeA,
+		RCode:  domain.NXDOMAIN,
+		Source: SourceBlocked,
+	}
+	nxdomain, noerror := domain.NXDOMAIN, domain.NOERROR
+	yes, no := true, false
+
+	tests := []struct {
+		name   string
+		filter QueryFilter
+		want   bool
+	}{
+		{"empty filter", QueryFilter{}, true},
+		{"since inclusive", QueryFilter{Since: now}, true},
+		{"since after", QueryFilter{Since: now.Add(time.Second)}, false},
+		{"until exclusive", QueryFilter{Until: now}, false},
+		{"until after", QueryFilter{Until: now.Add(time.Second)}, true},
+		{"client", QueryFilter{Client: "192.0.2.10"}, true},
+		{"other client", QueryFilter{Client: "192.0.2.11"}, false},
+		{"domain substring", QueryFilter{Domain: "example"}, true},
+		{"domain case and trailing dot", QueryFilter{Domain: "EXAMPLE.COM."}, true},
+		{"other domain", QueryFilter{Domain: "example.org"}, false},
+		{"rcode", QueryFilter{RCode: &nxdomain}, true},
+		{"other rcode", QueryFilter{RCode: &noerror}, false},
+		{"blocked", QueryFilter{Blocked: &yes}, true},
+		{"not blocked", QueryFilter{Blocked: &no}, false},
+		{"all conditions", QueryFilter{Since: now, Until: now.Add(time.Minute), Client: "192.0.2.10", Domain: "www", RCode: &nxdomain, Blocked: &yes}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.filter.Matches(record))
+		})
+	}
+}
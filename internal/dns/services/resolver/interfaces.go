@@ -13,8 +13,11 @@ import (
 // to an upstream server and returning the corresponding DNS response.
 // The Resolve method takes a context for cancellation and timeout control,
 // as well as a Question object, and returns a DNSResponse or an error.
+// The response carries the upstream RCODE, so NXDOMAIN can be told from
+// NODATA, and its authority section, whose SOA record sets how long an empty
+// answer may be cached (RFC 2308 §5).
 type UpstreamClient interface {
-	Resolve(ctx context.Context, query domain.Question, now time.Time) ([]domain.ResourceRecord, error)
+	Resolve(ctx context.Context, query domain.Question, now time.Time) (domain.DNSResponse, error)
 }
 
 // Blocklist defines an interface for checking whether a DNS query is blocked.
@@ -33,17 +36,134 @@ type Blocklist interface {
 //   - New(size int): Creates a new cache with the specified size.
 //   - Set(record *domain.ResourceRecord): Stores a resource record in the cache.
 //   - Get(key string): Retrieves resource records by key, returning the records and a boolean indicating existence.
+//   - GetStale(key string): Retrieves expired records still kept for serve-stale (RFC 8767).
+//   - SetNegative(key string, rcode domain.RCode, ttl time.Duration): Caches an empty answer for key (RFC 2308), answered with rcode.
+//   - GetNegative(key string): Returns the RCODE of a live negative entry, NXDOMAIN or NOERROR for NODATA.
 //   - Delete(key string): Removes a resource record from the cache by key.
 //   - Len(): Returns the number of cache entries currently stored in the cache.
 //   - Keys(): Returns a slice of all keys currently stored in the cache.
 type Cache interface {
 	Set(record []domain.ResourceRecord) error
 	Get(key string) ([]domain.ResourceRecord, bool)
+	GetStale(key string) ([]domain.ResourceRecord, bool)
+	SetNegative(key string, rcode domain.RCode, ttl time.Duration)
+	GetNegative(key string) (domain.RCode, bool)
 	Delete(key string)
 	Len() int
 	Keys() []string
 }
 
+// CacheManager defines the management operations of a Cache, for purging bad
+// answers and inspecting the cache at runtime without a restart.
+// Names are matched case-insensitively, with or without a trailing dot.
+//
+// Methods:
+//   - Flush(): Removes every entry and returns how many were removed.
+//   - FlushName(name string): Removes the entries for exactly name, of any type.
+//   - FlushDomain(suffix string): Removes the entries for suffix and every name below it.
+//   - FlushType(rrtype domain.RRType): Removes the entries of one record type.
+//   - Dump(): Lists every entry with its remaining TTL, least recently used first.
+//   - Stats(): Returns a snapshot of the entry count, byte usage and activity counters.
+type CacheManager interface {
+	Flush() int
+	FlushName(name string) int
+	FlushDomain(suffix string) int
+	FlushType(rrtype domain.RRType) int
+	Dump() []CacheEntry
+	Stats() CacheStats
+}
+
+// CacheEntry describes one cache entry, as listed by CacheManager.Dump.
+type CacheEntry struct {
+	Key   string
+	Name  string
+	Type  domain.RRType
+	Class domain.RRClass
+	// Negative marks a cached empty answer (NXDOMAIN or NODATA), which has no records.
+	Negative bool
+	// RCode is the RCODE a negative entry is answered with: NXDOMAIN, or NOERROR for NODATA.
+	RCode domain.RCode
+	// TTL is how long the entry has left before it expires. It is 0 once only
+	// records kept for serve-stale remain.
+	TTL time.Duration
+	// Records are the cached records, including any kept for serve-stale.
+	Records []domain.ResourceRecord
+}
+
+// CacheStats counts cache activity since the cache was created. Comparing
+// Evictions with Inserts and Hits with Misses shows whether the cache is
+// sized right: a cache that evicts most of what it stores is too small.
+type CacheStats struct {
+	// Entries is the number of entries (keys) currently cached.
+	Entries int
+	// Bytes approximates the memory held by the cached entries.
+	Bytes int64
+	// Hits and Misses count Get lookups that did and did not find a live entry.
+	Hits   uint64
+	Misses uint64
+	// ExpiredOnRead counts the misses that found an entry holding only
+	// expired data.
+	ExpiredOnRead uint64
+	// Evictions counts entries dropped to make room for new ones.
+	Evictions uint64
+	// Inserts counts entries stored by Set and SetNegative.
+	Inserts uint64
+}
+
+// Metrics receives instrumentation from the resolver and the transports, to be
+// exported for monitoring or asserted on in tests. Implementations must be safe
+// for concurrent use and cheap, since they are called for every query.
+//
+// Methods:
+//   - QueryAnswered: The resolver answered query with rcode from source, taking duration.
+//   - QueryServed: A transport sent the answer to query, duration after receiving it.
+//   - QueryFailed: A transport dropped a query because the given stage (e.g. "decode") failed.
+type Metrics interface {
+	QueryAnswered(query domain.Question, rcode domain.RCode, source AnswerSource, duration time.Duration)
+	QueryServed(transport string, query domain.Question, rcode domain.RCode, duration time.Duration)
+	QueryFailed(transport string, stage string)
+}
+
+// QueryLog records every query the resolver answers, for auditing and
+// troubleshooting. Record is called on the query path, so implementations must
+// be safe for concurrent use and must not block on I/O.
+type QueryLog interface {
+	Record(entry QueryLogEntry)
+}
+
+// QueryHistory keeps recently answered queries searchable, to find out what a
+// client resolved and how it was answered. Search returns the records matching
+// filter, newest first.
+type QueryHistory interface {
+	Search(filter QueryFilter) []QueryRecord
+}
+
+// MessageTap receives copies of the DNS messages exchanged with clients and
+// upstream servers, in wire format, for export to analytics such as dnstap.
+// Tap is called on the query path, so implementations must be safe for
+// concurrent use and must not block on I/O.
+type MessageTap interface {
+	Tap(msg TapMessage)
+}
+
+// Tracer starts trace spans around the stages of query handling, so the time
+// spent in zone lookups, alias chasing, the cache and upstream servers can be
+// told apart. A span started from a context that carries another span becomes
+// its child, and the returned context carries the new span.
+type Tracer interface {
+	Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span)
+}
+
+// Span is one timed operation within a trace. It must be ended exactly once.
+type Span interface {
+	// SetAttribute records a string, integer, boolean or floating point value.
+	SetAttribute(key string, value any)
+	// RecordError marks the span as failed with err.
+	RecordError(err error)
+	// End finishes the span.
+	End()
+}
+
 // DNSResponder defines an interface for handling DNS queries and generating responses.
 // Implementations of this interface process DNS requests, abstracting away network protocol details.
 // The HandleQuery method receives the query, client address, and context, and returns a DNS response.
@@ -69,6 +189,47 @@ type ZoneCache interface {
 
 	// Count returns the total number of records across all zones
 	Count() int
+
+	// RecordCount returns the number of records in one zone, 0 when it is not cached
+	RecordCount(zoneRoot string) int
+}
+
+// ZoneEditor lists and changes the records of authoritative zones at runtime,
+// persisting every change and applying it to the ZoneCache. Like CacheManager,
+// the resolver does not use it; it is wired up for admin interfaces.
+//
+// Every zone has a version that changes with each change. Changes take the
+// version they are based on and fail with ErrZoneVersion when the zone has
+// changed since; an empty version skips the check. Successful calls return
+// the zone's new version.
+//
+// Methods:
+//   - Records(zone string): Lists the records of a zone and returns its version.
+//   - CreateRecord(zone, version string, record ZoneRecord): Adds a record, returning it with its ID.
+//   - UpdateRecord(zone, version, id string, record ZoneRecord): Replaces the record with the given ID.
+//   - DeleteRecord(zone, version, id string): Removes the record with the given ID.
+type ZoneEditor interface {
+	Records(zone string) (records []ZoneRecord, version string, err error)
+	CreateRecord(zone, version string, record ZoneRecord) (created ZoneRecord, newVersion string, err error)
+	UpdateRecord(zone, version, id string, record ZoneRecord) (updated ZoneRecord, newVersion string, err error)
+	DeleteRecord(zone, version, id string) (newVersion string, err error)
+}
+
+// ZoneSigner serves the DNSSEC records of signed authoritative zones. The
+// signed records themselves (DNSKEY, RRSIG, NSEC, NSEC3) live in the ZoneCache,
+// so explicit queries for them are answered like any other; the ZoneSigner adds
+// what a query with the DO bit needs on top.
+type ZoneSigner interface {
+	// Signatures returns the RRSIG records covering the RRsets of records.
+	// Records outside signed zones have none.
+	Signatures(records []domain.ResourceRecord) []domain.ResourceRecord
+
+	// Deny answers a query for a name in a signed zone that holds no records of
+	// the query type. It returns NXDOMAIN or NOERROR (NODATA) and the authority
+	// section: the SOA record, plus the NSEC or NSEC3 records proving the denial
+	// and all their signatures when the query has the DO bit. ok is false when
+	// the name is not in a signed zone.
+	Deny(query domain.Question) (rcode domain.RCode, authority []domain.ResourceRecord, ok bool)
 }
 
 // AliasResolver defines an interface for resolving CNAME (alias) chains within
@@ -0,0 +1,38 @@
+package resolver
+
+import (
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// AnswerSource identifies where the resolver found the answer to a query.
+type AnswerSource string
+
+const (
+	// SourceZone is authoritative zone data, including denials from signed zones.
+	SourceZone AnswerSource = "zone"
+	// SourceCache is a live answer from the upstream cache.
+	SourceCache AnswerSource = "cache"
+	// SourceStale is an expired answer served from the cache (RFC 8767).
+	SourceStale AnswerSource = "stale"
+	// SourceUpstream is an answer resolved upstream, or SERVFAIL when that failed.
+	SourceUpstream AnswerSource = "upstream"
+	// SourceBlocked is the NXDOMAIN answer to a query blocked by the blocklist.
+	SourceBlocked AnswerSource = "blocked"
+)
+
+// NopMetrics discards all instrumentation. The resolver and transports use it
+// when no Metrics are configured.
+type NopMetrics struct{}
+
+// QueryAnswered does nothing.
+func (NopMetrics) QueryAnswered(domain.Question, domain.RCode, AnswerSource, time.Duration) {}
+
+// QueryServed does nothing.
+func (NopMetrics) QueryServed(string, domain.Question, domain.RCode, time.Duration) {}
+
+// QueryFailed does nothing.
+func (NopMetrics) QueryFailed(string, string) {}
+
+var _ Metrics = NopMetrics{}
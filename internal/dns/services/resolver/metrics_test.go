@@ -0,0 +1,153 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// answeredQuery is one QueryAnswered call seen by recordingMetrics.
+type answeredQuery struct {
+	query    domain.Question
+	rcode    domain.RCode
+	source   AnswerSource
+	duration time.Duration
+}
+
+// recordingMetrics records the queries reported by the resolver.
+type recordingMetrics struct {
+	NopMetrics
+	mu       sync.Mutex
+	answered []answeredQuery
+}
+
+func (m *recordingMetrics) QueryAnswered(query domain.Question, rcode domain.RCode, source AnswerSource, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.answered = append(m.answered, answeredQuery{query: query, rcode: rcode, source: source, duration: duration})
+}
+
+func TestResolver_HandleQuery_Metrics(t *testing.T) {
+	query := createTestQuery("example.com.", domain.RRTypeA)
+	record := createTestRecord("example.com.", domain.RRTypeA, []byte{192, 0, 2, 1}, "192.0.2.1")
+	stale := expiredTestRecord("example.com.", []byte{192, 0, 2, 1}, "192.0.2.1", time.Second)
+
+	tests := []struct {
+		name       string
+		setup      func(zone *MockZoneCache, blocklist *MockBlocklist, cache *MockCache, upstream *MockUpstreamClient, clk *clock.MockClock)
+		wantRCode  domain.RCode
+		wantSource AnswerSource
+		wantTime   time.Duration
+	}{
+		{
+			name: "zone answer",
+			setup: func(zone *MockZoneCache, _ *MockBlocklist, _ *MockCache, _ *MockUpstreamClient, _ *clock.MockClock) {
+				zone.On("FindRecords", query).Return([]domain.ResourceRecord{record}, true)
+			},
+			wantRCode:  domain.NOERROR,
+			wantSource: SourceZone,
+		},
+		{
+			name: "blocked query",
+			setup: func(zone *MockZoneCache, blocklist *MockBlocklist, _ *MockCache, _ *MockUpstreamClient, _ *clock.MockClock) {
+				zone.On("FindRecords", query).Return([]domain.ResourceRecord(nil), false)
+				blocklist.On("IsBlocked", query).Return(true)
+			},
+			wantRCode:  domain.NXDOMAIN,
+			wantSource: SourceBlocked,
+		},
+		{
+			name: "cache hit",
+			setup: func(zone *MockZoneCache, blocklist *MockBlocklist, cache *MockCache, _ *MockUpstreamClient, _ *clock.MockClock) {
+				zone.On("FindRecords", query).Return([]domain.ResourceRecord(nil), false)
+				blocklist.On("IsBlocked", query).Return(false)
+				cache.On("Get", query.CacheKey()).Return([]domain.ResourceRecord{record}, true)
+			},
+			wantRCode:  domain.NOERROR,
+			wantSource: SourceCache,
+		},
+		{
+			name: "upstream answer is timed",
+			setup: func(zone *MockZoneCache, blocklist *MockBlocklist, cache *MockCache, upstream *MockUpstreamClient, clk *clock.MockClock) {
+				zone.On("FindRecords", query).Return([]domain.ResourceRecord(nil), false)
+				blocklist.On("IsBlocked", query).Return(false)
+				cache.On("Get", query.CacheKey()).Return([]domain.ResourceRecord(nil), false)
+				cache.On("GetStale", query.CacheKey()).Return([]domain.ResourceRecord(nil), false)
+				cache.On("Set", mock.Anything).Return(nil)
+				upstream.On("Resolve", mock.Anything, query, mock.Anything).
+					Run(func(mock.Arguments) { clk.Advance(250 * time.Millisecond) }).
+					Return([]domain.ResourceRecord{record}, nil)
+			},
+			wantRCode:  domain.NOERROR,
+			wantSource: SourceUpstream,
+			wantTime:   250 * time.Millisecond,
+		},
+		{
+			name: "upstream failure",
+			setup: func(zone *MockZoneCache, blocklist *MockBlocklist, cache *MockCache, upstream *MockUpstreamClient, _ *clock.MockClock) {
+				zone.On("FindRecords", query).Return([]domain.ResourceRecord(nil), false)
+				blocklist.On("IsBlocked", query).Return(false)
+				cache.On("Get", query.CacheKey()).Return([]domain.ResourceRecord(nil), false)
+				cache.On("GetStale", query.CacheKey()).Return([]domain.ResourceRecord(nil), false)
+				upstream.On("Resolve", mock.Anything, query, mock.Anything).Return([]domain.ResourceRecord(nil), errors.New("network unreachable"))
+			},
+			wantRCode:  domain.SERVFAIL,
+			wantSource: SourceUpstream,
+		},
+		{
+			name: "stale answer",
+			setup: func(zone *MockZoneCache, blocklist *MockBlocklist, cache *MockCache, upstream *MockUpstreamClient, _ *clock.MockClock) {
+				zone.On("FindRecords", query).Return([]domain.ResourceRecord(nil), false)
+				blocklist.On("IsBlocked", query).Return(false)
+				cache.On("Get", query.CacheKey()).Return([]domain.ResourceRecord(nil), false)
+				cache.On("GetStale", query.CacheKey()).Return([]domain.ResourceRecord{stale}, true)
+				upstream.On("Resolve", mock.Anything, query, mock.Anything).Return([]domain.ResourceRecord(nil), errors.New("network unreachable"))
+			},
+			wantRCode:  domain.NOERROR,
+			wantSource: SourceStale,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zone, blocklist, cache, upstream := &MockZoneCache{}, &MockBlocklist{}, &MockCache{}, &MockUpstreamClient{}
+			clk := &clock.MockClock{CurrentTime: time.Now()}
+			tt.setup(zone, blocklist, cache, upstream, clk)
+			metrics := &recordingMetrics{}
+			r := NewResolver(ResolverOptions{
+				Blocklist:     blocklist,
+				Clock:         clk,
+				Logger:        &noopLogger{},
+				Upstream:      upstream,
+				UpstreamCache: cache,
+				ZoneCache:     zone,
+				ServeStale:    true,
+				Metrics:       metrics,
+			})
+
+			resp, err := r.HandleQuery(context.Background(), query, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantRCode, resp.RCode)
+
+			metrics.mu.Lock()
+			defer metrics.mu.Unlock()
+			require.Len(t, metrics.answered, 1)
+			assert.Equal(t, answeredQuery{query: query, rcode: tt.wantRCode, source: tt.wantSource, duration: tt.wantTime}, metrics.answered[0])
+		})
+	}
+}
+
+func TestNewResolver_MetricsDefaults(t *testing.T) {
+	r := NewResolver(ResolverOptions{})
+	assert.Equal(t, NopMetrics{}, r.metrics)
+	assert.IsType(t, &clock.RealClock{}, r.clock)
+}
@@ -0,0 +1,106 @@
+package resolver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+const (
+	// defaultPrefetchPercent is the final share of an answer's TTL in which it is prefetched.
+	defaultPrefetchPercent = 10
+	// maxPrefetchTracked bounds the number of cache keys whose hits are counted.
+	// When it is reached the counts start over, so only names that stay popular
+	// within one counting period are prefetched.
+	maxPrefetchTracked = 10000
+)
+
+// prefetcher decides which cached answers are popular enough to refresh before
+// they expire (refresh-ahead). It counts cache hits per key; once a key has
+// been served minHits times and its answer is in the last percent of its TTL,
+// it is due for a background refresh.
+type prefetcher struct {
+	minHits int
+	percent int
+
+	mu   sync.Mutex
+	hits map[string]int
+}
+
+// newPrefetcher returns a prefetcher, or nil when minHits disables prefetching.
+func newPrefetcher(minHits, percent int) *prefetcher {
+	if minHits <= 0 {
+		return nil
+	}
+	if percent <= 0 || percent > 100 {
+		percent = defaultPrefetchPercent
+	}
+	return &prefetcher{
+		minHits: minHits,
+		percent: percent,
+		hits:    make(map[string]int),
+	}
+}
+
+// due records a cache hit for key at now and reports whether its records
+// should be refreshed. A key that is due starts counting from zero again.
+func (p *prefetcher) due(key string, records []domain.ResourceRecord, now time.Time) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	hits, tracked := p.hits[key]
+	if !tracked && len(p.hits) >= maxPrefetchTracked {
+		clear(p.hits)
+	}
+	hits++
+	if hits < p.minHits || !p.nearExpiry(records, now) {
+		p.hits[key] = hits
+		return false
+	}
+	delete(p.hits, key)
+	return true
+}
+
+// nearExpiry reports whether any record is in the last percent of its TTL at now.
+func (p *prefetcher) nearExpiry(records []domain.ResourceRecord, now time.Time) bool {
+	for _, rr := range records {
+		ttl := time.Duration(rr.OriginalTTL()) * time.Second
+		if ttl > 0 && rr.TTLRemaining(now)*100 <= ttl*time.Duration(p.percent) {
+			return true
+		}
+	}
+	return false
+}
+
+// maybePrefetch refreshes a cache hit in the background when it is popular and
+// about to expire. The refresh goes through the same coalescing path as cache
+// misses, so it never duplicates a query already in flight.
+func (r *Resolver) maybePrefetch(ctx context.Context, query domain.Question, records []domain.ResourceRecord) {
+	if r.prefetch == nil || !r.prefetch.due(query.CacheKey(), records, r.clock.Now()) {
+		return
+	}
+	refreshCtx := context.WithoutCancel(ctx)
+	go func() {
+		response, err := r.resolveUpstream(refreshCtx, query, r.clock.Now())
+		if err != nil {
+			r.logger.Debug(map[string]any{
+				"error": err,
+				"query": query,
+			}, "Prefetch failed")
+			return
+		}
+		if err := r.cacheUpstreamResponse(query, response); err != nil {
+			r.logger.Error(map[string]any{
+				"error": err,
+				"query": query,
+			}, "Failed to cache prefetched response")
+			return
+		}
+		r.logger.Debug(map[string]any{
+			"query": query.Name,
+			"type":  query.Type,
+		}, "Prefetched popular cache entry")
+	}()
+}
@@ -0,0 +1,143 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// agedTestRecord returns a cached record with the given TTL that was created age ago.
+func agedTestRecord(name string, ttl uint32, age time.Duration) domain.ResourceRecord {
+	record, _ := domain.NewCachedResourceRecord(name, domain.RRTypeA, domain.RRClass(1), ttl, []byte{192, 0, 2, 1}, "192.0.2.1", time.Now().Add(-age))
+	return record
+}
+
+func TestNewPrefetcher(t *testing.T) {
+	assert.Nil(t, newPrefetcher(0, 10), "0 hits disables prefetch")
+	assert.Equal(t, defaultPrefetchPercent, newPrefetcher(3, 0).percent)
+	assert.Equal(t, defaultPrefetchPercent, newPrefetcher(3, 101).percent)
+	assert.Equal(t, 20, newPrefetcher(3, 20).percent)
+}
+
+func TestPrefetcher_Due(t *testing.T) {
+	nearExpiry := []domain.ResourceRecord{agedTestRecord("hot.com.", 100, 95*time.Second)}
+	fresh := []domain.ResourceRecord{agedTestRecord("hot.com.", 100, 10*time.Second)}
+
+	p := newPrefetcher(3, 10)
+	assert.False(t, p.due("hot", nearExpiry, time.Now()), "first hit")
+	assert.False(t, p.due("hot", nearExpiry, time.Now()), "second hit")
+	assert.True(t, p.due("hot", nearExpiry, time.Now()), "third hit near expiry")
+	assert.False(t, p.due("hot", nearExpiry, time.Now()), "counting starts over after a prefetch")
+
+	p = newPrefetcher(1, 10)
+	assert.False(t, p.due("hot", fresh, time.Now()), "popular but not near expiry")
+	assert.True(t, p.due("hot", nearExpiry, time.Now()))
+}
+
+func TestPrefetcher_Due_BoundedTracking(t *testing.T) {
+	p := newPrefetcher(2, 10)
+	fresh := []domain.ResourceRecord{agedTestRecord("hot.com.", 100, 0)}
+	for i := range maxPrefetchTracked {
+		p.due(fmt.Sprintf("key-%d", i), fresh, time.Now())
+	}
+	assert.Len(t, p.hits, maxPrefetchTracked)
+	p.due("one-more", fresh, time.Now())
+	assert.Len(t, p.hits, 1, "counts start over when the table is full")
+}
+
+func TestPrefetcher_NearExpiry(t *testing.T) {
+	p := newPrefetcher(1, 10)
+	tests := []struct {
+		name    string
+		records []domain.ResourceRecord
+		want    bool
+	}{
+		{name: "early in ttl", records: []domain.ResourceRecord{agedTestRecord("a.com.", 300, time.Minute)}, want: false},
+		{name: "last 10 percent", records: []domain.ResourceRecord{agedTestRecord("a.com.", 300, 280*time.Second)}, want: true},
+		{name: "zero ttl", records: []domain.ResourceRecord{agedTestRecord("a.com.", 0, 0)}, want: false},
+		{name: "any record near expiry", records: []domain.ResourceRecord{
+			agedTestRecord("a.com.", 300, time.Minute),
+			agedTestRecord("a.com.", 60, 58*time.Second),
+		}, want: true},
+		{name: "no records", records: nil, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, p.nearExpiry(tt.records, time.Now()))
+		})
+	}
+}
+
+func TestResolver_HandleQuery_Prefetch(t *testing.T) {
+	query := createTestQuery("hot.com.", domain.RRTypeA)
+	cachedRecords := []domain.ResourceRecord{agedTestRecord("hot.com.", 100, 95*time.Second)}
+	refreshed := []domain.ResourceRecord{createTestRecord("hot.com.", domain.RRTypeA, []byte{192, 0, 2, 2}, "192.0.2.2")}
+
+	mockCache := &MockCache{}
+	mockCache.On("Get", query.CacheKey()).Return(cachedRecords, true)
+	cached := make(chan struct{}, 1)
+	mockCache.On("Set", refreshed).Run(func(mock.Arguments) { cached <- struct{}{} }).Return(nil)
+	mockUpstream := &MockUpstreamClient{}
+	mockUpstream.On("Resolve", mock.Anything, query, mock.Anything).Return(refreshed, nil).Once()
+
+	resolver := NewResolver(ResolverOptions{
+		Clock:           &clock.MockClock{CurrentTime: time.Now()},
+		Logger:          &noopLogger{},
+		Upstream:        mockUpstream,
+		UpstreamCache:   mockCache,
+		PrefetchMinHits: 2,
+	})
+
+	for range 2 {
+		response, err := resolver.HandleQuery(context.Background(), query, &net.UDPAddr{})
+		assert.NoError(t, err)
+		assert.Equal(t, cachedRecords, response.Answers, "the cached answer is served right away")
+	}
+
+	select {
+	case <-cached:
+	case <-time.After(time.Second):
+		t.Fatal("popular entry was not prefetched")
+	}
+	mockUpstream.AssertNumberOfCalls(t, "Resolve", 1)
+}
+
+func TestResolver_HandleQuery_PrefetchFailureKeepsCache(t *testing.T) {
+	query := createTestQuery("hot.com.", domain.RRTypeA)
+	cachedRecords := []domain.ResourceRecord{agedTestRecord("hot.com.", 100, 95*time.Second)}
+
+	mockCache := &MockCache{}
+	mockCache.On("Get", query.CacheKey()).Return(cachedRecords, true)
+	resolved := make(chan struct{}, 1)
+	mockUpstream := &MockUpstreamClient{}
+	mockUpstream.On("Resolve", mock.Anything, query, mock.Anything).
+		Run(func(mock.Arguments) { resolved <- struct{}{} }).
+		Return([]domain.ResourceRecord(nil), errors.New("network unreachable"))
+
+	resolver := NewResolver(ResolverOptions{
+		Clock:           &clock.MockClock{CurrentTime: time.Now()},
+		Logger:          &noopLogger{},
+		Upstream:        mockUpstream,
+		UpstreamCache:   mockCache,
+		PrefetchMinHits: 1,
+	})
+	response, err := resolver.HandleQuery(context.Background(), query, &net.UDPAddr{})
+	assert.NoError(t, err)
+	assert.Equal(t, cachedRecords, response.Answers)
+
+	select {
+	case <-resolved:
+	case <-time.After(time.Second):
+		t.Fatal("prefetch was not attempted")
+	}
+	mockCache.AssertNotCalled(t, "Set", mock.Anything)
+}
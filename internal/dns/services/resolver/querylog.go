@@ -0,0 +1,105 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// QueryLogEntry describes one query answered by the resolver.
+type QueryLogEntry struct {
+	// Time is when the resolver started answering the query.
+	Time time.Time
+	// Client is the address the query came from; nil when unknown.
+	Client   net.Addr
+	Question domain.Question
+	RCode    domain.RCode
+	Answers  []domain.ResourceRecord
+	Source   AnswerSource
+	// Upstream is the server that answered, for queries answered upstream by a
+	// client that reports it. Empty otherwise.
+	Upstream string
+	Duration time.Duration
+}
+
+// ClientIP returns the IP address of Client without its port, or nil when the
+// client is unknown or its address does not carry one.
+func (e QueryLogEntry) ClientIP() net.IP {
+	switch a := e.Client.(type) {
+	case nil:
+		return nil
+	case *net.UDPAddr:
+		return a.IP
+	case *net.TCPAddr:
+		return a.IP
+	}
+	host, _, err := net.SplitHostPort(e.Client.String())
+	if err != nil {
+		host = e.Client.String()
+	}
+	return net.ParseIP(host)
+}
+
+// MultiQueryLog records every entry in each of its query logs, in order.
+type MultiQueryLog []QueryLog
+
+// Record passes entry to every query log.
+func (m MultiQueryLog) Record(entry QueryLogEntry) {
+	for _, l := range m {
+		l.Record(entry)
+	}
+}
+
+// NopQueryLog discards every entry. The resolver uses it when no QueryLog is configured.
+type NopQueryLog struct{}
+
+// Record does nothing.
+func (NopQueryLog) Record(QueryLogEntry) {}
+
+// upstreamServerKey is the context key of the upstreamServer an upstream
+// client reports to.
+type upstreamServerKey struct{}
+
+// upstreamServer collects the address of the upstream server that answered a query.
+type upstreamServer struct {
+	mu   sync.Mutex
+	addr string
+}
+
+// withUpstreamServer returns a context in which upstream clients can report
+// the server that answered, and the collector they report to.
+func withUpstreamServer(ctx context.Context) (context.Context, *upstreamServer) {
+	s := &upstreamServer{}
+	return context.WithValue(ctx, upstreamServerKey{}, s), s
+}
+
+// get returns the reported server, or "" if none was reported.
+func (s *upstreamServer) get() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addr
+}
+
+// ReportUpstreamServer tells the resolver that server answered the query being
+// resolved with ctx. Upstream clients call it after a successful exchange. Only
+// the first report counts, so follow-up queries made for the same answer (such
+// as DNSSEC key lookups) do not replace it. Outside a resolver query it does nothing.
+func ReportUpstreamServer(ctx context.Context, server string) {
+	s, ok := ctx.Value(upstreamServerKey{}).(*upstreamServer)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.addr == "" {
+		s.addr = server
+	}
+}
+
+var (
+	_ QueryLog = NopQueryLog{}
+	_ QueryLog = MultiQueryLog(nil)
+)
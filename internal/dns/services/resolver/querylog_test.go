@@ -0,0 +1,145 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// recordingQueryLog keeps every entry the resolver records.
+type recordingQueryLog struct {
+	mu      sync.Mutex
+	entries []QueryLogEntry
+}
+
+func (l *recordingQueryLog) Record(entry QueryLogEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, entry)
+}
+
+// reportingUpstream answers every query and reports server as the one that answered.
+type reportingUpstream struct {
+	server  string
+	answers []domain.ResourceRecord
+}
+
+func (u *reportingUpstream) Resolve(ctx context.Context, _ domain.Question, _ time.Time) (domain.DNSResponse, error) {
+	ReportUpstreamServer(ctx, u.server)
+	return domain.DNSResponse{Answers: u.answers}, nil
+}
+
+func TestResolver_HandleQuery_QueryLog(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	client := &net.UDPAddr{IP: net.ParseIP("192.0.2.10"), Port: 5353}
+	zoneQuery := createTestQuery("www.example.com.", domain.RRTypeA)
+	zoneRecord := createTestRecord("www.example.com.", domain.RRTypeA, []byte{192, 0, 2, 1}, "192.0.2.1")
+	upstreamQuery := createTestQuery("example.org.", domain.RRTypeA)
+	upstreamRecord := createTestRecord("example.org.", domain.RRTypeA, []byte{198, 51, 100, 1}, "198.51.100.1")
+
+	zone := &MockZoneCache{}
+	zone.On("FindRecords", zoneQuery).Return([]domain.ResourceRecord{zoneRecord}, true)
+	zone.On("FindRecords", upstreamQuery).Return([]domain.ResourceRecord(nil), false)
+	queryLog := &recordingQueryLog{}
+	r := NewResolver(ResolverOptions{
+		Clock:     &clock.MockClock{CurrentTime: now},
+		Logger:    &noopLogger{},
+		ZoneCache: zone,
+		Upstream:  &reportingUpstream{server: "1.1.1.1:53", answers: []domain.ResourceRecord{upstreamRecord}},
+		QueryLog:  queryLog,
+	})
+
+	_, err := r.HandleQuery(context.Background(), zoneQuery, client)
+	require.NoError(t, err)
+	_, err = r.HandleQuery(context.Background(), upstreamQuery, client)
+	require.NoError(t, err)
+
+	require.Len(t, queryLog.entries, 2)
+	assert.Equal(t, QueryLogEntry{
+		Time:     now,
+		Client:   client,
+		Question: zoneQuery,
+		RCode:    domain.NOERROR,
+		Answers:  []domain.ResourceRecord{zoneRecord},
+		Source:   SourceZone,
+	}, queryLog.entries[0])
+	assert.Equal(t, QueryLogEntry{
+		Time:     now,
+		Client:   client,
+		Question: upstreamQuery,
+		RCode:    domain.NOERROR,
+		Answers:  []domain.ResourceRecord{upstreamRecord},
+		Source:   SourceUpstream,
+		Upstream: "1.1.1.1:53",
+	}, queryLog.entries[1])
+}
+
+func TestResolver_resolveUpstream_ReportsServer(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	query := createTestQuery("popular.com.", domain.RRTypeA)
+	r := NewResolver(ResolverOptions{
+		Clock:    &clock.MockClock{CurrentTime: now},
+		Logger:   &noopLogger{},
+		Upstream: &reportingUpstream{server: "9.9.9.9:53"},
+	})
+
+	ctx, server := withUpstreamServer(context.Background())
+	_, err := r.resolveUpstream(ctx, query, now)
+	require.NoError(t, err)
+	assert.Equal(t, "9.9.9.9:53", server.get())
+}
+
+func TestReportUpstreamServer(t *testing.T) {
+	// Outside a resolver query nothing is recorded, and nothing panics
+	ReportUpstreamServer(context.Background(), "1.1.1.1:53")
+
+	ctx, server := withUpstreamServer(context.Background())
+	assert.Empty(t, server.get())
+	ReportUpstreamServer(ctx, "1.1.1.1:53")
+	ReportUpstreamServer(ctx, "8.8.8.8:53")
+	assert.Equal(t, "1.1.1.1:53", server.get(), "the first report wins")
+}
+
+func TestNewResolver_QueryLogDefault(t *testing.T) {
+	r := NewResolver(ResolverOptions{})
+	assert.Equal(t, NopQueryLog{}, r.queryLog)
+	NopQueryLog{}.Record(QueryLogEntry{})
+}
+
+func TestQueryLogEntry_ClientIP(t *testing.T) {
+	tests := []struct {
+		name string
+		addr net.Addr
+		want string
+	}{
+		{"nil", nil, "<nil>"},
+		{"udp", &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 53}, "192.0.2.1"},
+		{"tcp", &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 53}, "2001:db8::1"},
+		{"other with port", &net.IPAddr{IP: net.ParseIP("198.51.100.7")}, "198.51.100.7"},
+		{"unix", &net.UnixAddr{Name: "/run/dns.sock", Net: "unix"}, "<nil>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, QueryLogEntry{Client: tt.addr}.ClientIP().String())
+		})
+	}
+}
+
+func TestMultiQueryLog(t *testing.T) {
+	first, second := &recordingQueryLog{}, &recordingQueryLog{}
+	entry := QueryLogEntry{Question: domain.Question{Name: "example.com.", Type: domain.RRTypeA, Class: domain.RRClassIN}}
+
+	MultiQueryLog{first, second}.Record(entry)
+	MultiQueryLog(nil).Record(entry)
+
+	assert.Equal(t, []QueryLogEntry{entry}, first.entries)
+	assert.Equal(t, []QueryLogEntry{entry}, second.entries)
+}
@@ -19,8 +19,19 @@ type Resolver struct {
 	upstream      UpstreamClient
 	upstreamCache Cache
 	zoneCache     ZoneCache
+	zoneSigner    ZoneSigner
 	maxRecursion  int
 	aliasResolver AliasResolver
+	forwardZones  forwardZones
+	inflight      inflight
+	serveStale    bool
+	staleTimeout  time.Duration
+	staleTTL      time.Duration
+	prefetch      *prefetcher
+	cachePolicy   cachePolicy
+	metrics       Metrics
+	tracer        Tracer
+	queryLog      QueryLog
 }
 
 type ResolverOptions struct {
@@ -30,11 +41,56 @@ type ResolverOptions struct {
 	Upstream      UpstreamClient
 	UpstreamCache Cache
 	ZoneCache     ZoneCache
+	// ZoneSigner adds signatures and authenticated denials for signed zones in ZoneCache.
+	ZoneSigner    ZoneSigner
 	MaxRecursion  int
 	AliasResolver AliasResolver
+	// ForwardZones maps domain suffixes to dedicated upstream clients. Queries at or
+	// below a suffix go to its client instead of Upstream; the most specific suffix wins.
+	ForwardZones map[string]UpstreamClient
+	// ServeStale answers with expired records that UpstreamCache still keeps when
+	// upstream resolution fails or is slow (RFC 8767), refreshing them in the background.
+	ServeStale bool
+	// StaleAnswerTimeout is how long a query with stale records waits for upstream
+	// before the stale answer is sent. 0 waits for upstream to succeed or fail.
+	StaleAnswerTimeout time.Duration
+	// StaleAnswerTTL is the TTL of records in a stale answer (RFC 8767 §4),
+	// rounded down to whole seconds (default: 30s).
+	StaleAnswerTTL time.Duration
+	// PrefetchMinHits refreshes a cached answer in the background once it has been
+	// served this many times and is in the last PrefetchPercent of its TTL. 0 disables prefetch.
+	PrefetchMinHits int
+	// PrefetchPercent is the final share of the TTL, in percent, in which popular
+	// answers are prefetched (default: 10).
+	PrefetchPercent int
+	// CachePolicy adjusts the TTLs of upstream answers stored in UpstreamCache
+	// and enables negative caching. The zero value stores answers as received.
+	CachePolicy CachePolicy
+	// Metrics receives a report of every answered query. Defaults to NopMetrics.
+	Metrics Metrics
+	// Tracer records spans around query handling, zone lookups, alias chasing
+	// and cache lookups. Defaults to NopTracer.
+	Tracer Tracer
+	// QueryLog receives an entry for every answered query. Defaults to NopQueryLog.
+	QueryLog QueryLog
 }
 
 func NewResolver(opts ResolverOptions) *Resolver {
+	if opts.Clock == nil {
+		opts.Clock = &clock.RealClock{}
+	}
+	if opts.Metrics == nil {
+		opts.Metrics = NopMetrics{}
+	}
+	if opts.Tracer == nil {
+		opts.Tracer = NopTracer{}
+	}
+	if opts.QueryLog == nil {
+		opts.QueryLog = NopQueryLog{}
+	}
+	if opts.StaleAnswerTTL <= 0 {
+		opts.StaleAnswerTTL = defaultStaleTTL
+	}
 	return &Resolver{
 		blocklist:     opts.Blocklist,
 		clock:         opts.Clock,
@@ -42,25 +98,74 @@ func NewResolver(opts ResolverOptions) *Resolver {
 		upstream:      opts.Upstream,
 		upstreamCache: opts.UpstreamCache,
 		zoneCache:     opts.ZoneCache,
+		zoneSigner:    opts.ZoneSigner,
 		maxRecursion:  opts.MaxRecursion,
 		aliasResolver: opts.AliasResolver,
+		forwardZones:  newForwardZones(opts.ForwardZones),
+		serveStale:    opts.ServeStale,
+		staleTimeout:  opts.StaleAnswerTimeout,
+		staleTTL:      opts.StaleAnswerTTL,
+		prefetch:      newPrefetcher(opts.PrefetchMinHits, opts.PrefetchPercent),
+		cachePolicy:   newCachePolicy(opts.CachePolicy),
+		metrics:       opts.Metrics,
+		tracer:        opts.Tracer,
+		queryLog:      opts.QueryLog,
 	}
 }
 
+// HandleQuery answers a query within a trace span and reports the answer, its
+// source and the time taken to the configured Metrics and QueryLog.
 func (r *Resolver) HandleQuery(ctx context.Context, query domain.Question, clientAddr net.Addr) (domain.DNSResponse, error) {
+	ctx, span := r.tracer.Start(ctx, SpanQuery, SpanKindServer)
+	defer span.End()
+	setQuestionAttributes(span, query)
+	ctx, server := withUpstreamServer(ctx)
+
+	start := r.clock.Now()
+	resp, source := r.answer(ctx, query, clientAddr)
+	duration := r.clock.Now().Sub(start)
+	r.metrics.QueryAnswered(query, resp.RCode, source, duration)
+
+	entry := QueryLogEntry{
+		Time:     start,
+		Client:   clientAddr,
+		Question: query,
+		RCode:    resp.RCode,
+		Answers:  resp.Answers,
+		Source:   source,
+		Duration: duration,
+	}
+	if source == SourceUpstream {
+		entry.Upstream = server.get()
+	}
+	r.queryLog.Record(entry)
+
+	span.SetAttribute(AttrResponseCode, resp.RCode.String())
+	span.SetAttribute(AttrAnswerSource, string(source))
+	span.SetAttribute(AttrAnswerCount, len(resp.Answers))
+	return resp, nil
+}
+
+// answer resolves a query and reports where the answer came from.
+func (r *Resolver) answer(ctx context.Context, query domain.Question, clientAddr net.Addr) (domain.DNSResponse, AnswerSource) {
 	// 1. Check authoritative zone cache first
-	records, found, err := r.resolveFromZone(query)
+	records, found, err := r.resolveFromZone(ctx, query)
 	if found {
 		if err != nil {
 			// Classify alias errors; fatal ones become SERVFAIL, non-fatal still return partial chain.
 			if r.isFatalAliasError(err) {
 				r.logger.Error(map[string]any{"error": err, "query": query}, "Fatal alias resolution error")
-				return buildResponse(query, domain.SERVFAIL, nil), nil
+				return buildResponse(query, domain.SERVFAIL, nil), SourceZone
 			}
 			// Non-fatal alias errors (e.g. target invalid, question build) return gathered chain with NOERROR.
 			r.logger.Warn(map[string]any{"error": err, "query": query}, "Non-fatal alias resolution error; returning partial chain")
 		}
-		return buildResponse(query, domain.NOERROR, records), nil
+		return buildResponse(query, domain.NOERROR, r.withSignatures(query, records)), SourceZone
+	}
+
+	// 1b. Names missing from a signed zone are denied there rather than forwarded
+	if resp, ok := r.denyFromSignedZone(query); ok {
+		return resp, SourceZone
 	}
 
 	// 2. Check blocklist and fast fail if blocked
@@ -70,19 +175,25 @@ func (r *Resolver) HandleQuery(ctx context.Context, query domain.Question, clien
 			"client":    clientAddr,
 			"timestamp": r.clock.Now(),
 		}, "Query blocked by blocklist")
-		return buildResponse(query, domain.NXDOMAIN, nil), nil
+		return buildResponse(query, domain.NXDOMAIN, nil), SourceBlocked
 	}
 
 	// 3. Check upstream cache for cached responses
-	if records, found := r.checkUpstreamCache(query); found {
-		return buildResponse(query, domain.NOERROR, records), nil
+	if records, rcode, found := r.checkUpstreamCache(ctx, query); found {
+		r.maybePrefetch(ctx, query, records)
+		return buildResponse(query, rcode, records), SourceCache
+	}
+
+	// 3b. Expired records still in the stale window back up the upstream query
+	if stale, found := r.checkStaleCache(ctx, query); found {
+		return r.resolveOrServeStale(ctx, query, clientAddr, stale)
 	}
 
 	// 4. If not found, resolve via upstream client
 	// if the ctx is cancelled, this will return an error
 	// This allows the resolver to respect cancellation requests from the transport layer.
 	// It also allows for timeouts to be applied at the transport level.
-	records, err = r.resolveUpstream(ctx, query, r.clock.Now())
+	resp, err := r.resolveUpstream(ctx, query, r.clock.Now())
 	if err != nil {
 		r.logger.Error(map[string]any{
 			"error":     err,
@@ -90,11 +201,11 @@ func (r *Resolver) HandleQuery(ctx context.Context, query domain.Question, clien
 			"client":    clientAddr,
 			"timestamp": r.clock.Now(),
 		}, "Failed to resolve upstream")
-		return buildResponse(query, domain.SERVFAIL, nil), nil
+		return buildResponse(query, domain.SERVFAIL, nil), SourceUpstream
 	}
 
 	// 5. Store records in upstream cache
-	if err := r.cacheUpstreamResponse(records); err != nil {
+	if err := r.cacheUpstreamResponse(query, resp); err != nil {
 		r.logger.Error(map[string]any{
 			"error":     err,
 			"query":     query,
@@ -105,15 +216,18 @@ func (r *Resolver) HandleQuery(ctx context.Context, query domain.Question, clien
 	}
 
 	// 6. Return response to client
-	return buildResponse(query, domain.NOERROR, records), nil
+	return buildResponse(query, resp.RCode, resp.Answers), SourceUpstream
 }
 
-func (r *Resolver) resolveFromZone(query domain.Question) ([]domain.ResourceRecord, bool, error) {
+func (r *Resolver) resolveFromZone(ctx context.Context, query domain.Question) ([]domain.ResourceRecord, bool, error) {
 	if r.zoneCache == nil {
 		return nil, false, nil
 	}
 	// Lookup exact match in the zone cache
+	_, span := r.tracer.Start(ctx, SpanZoneLookup, SpanKindInternal)
 	records, found := r.zoneCache.FindRecords(query)
+	span.SetAttribute(AttrAnswerCount, len(records))
+	span.End()
 	if !found || len(records) == 0 {
 		return nil, false, nil
 	}
@@ -121,11 +235,49 @@ func (r *Resolver) resolveFromZone(query domain.Question) ([]domain.ResourceReco
 	// via shouldChase to immediately return the input when chasing is not required.
 	var err error
 	if r.aliasResolver != nil {
+		_, span := r.tracer.Start(ctx, SpanAliasChase, SpanKindInternal)
 		records, err = r.aliasResolver.Chase(query, records)
+		span.SetAttribute(AttrAnswerCount, len(records))
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.End()
 	}
 	return records, true, err
 }
 
+// withSignatures appends the RRSIG records covering the answer when the query
+// has the DO bit and the answer comes from a signed zone. The zone cache slice
+// is never appended to in place.
+func (r *Resolver) withSignatures(query domain.Question, records []domain.ResourceRecord) []domain.ResourceRecord {
+	if r.zoneSigner == nil || !query.DNSSECOK || query.Type == domain.RRTypeRRSIG {
+		return records
+	}
+	sigs := r.zoneSigner.Signatures(records)
+	if len(sigs) == 0 {
+		return records
+	}
+	out := make([]domain.ResourceRecord, 0, len(records)+len(sigs))
+	out = append(out, records...)
+	return append(out, sigs...)
+}
+
+// denyFromSignedZone answers authoritatively with NXDOMAIN or NODATA when the
+// query name falls in a signed zone, so the denial can be proven with NSEC or
+// NSEC3 records instead of being forwarded upstream.
+func (r *Resolver) denyFromSignedZone(query domain.Question) (domain.DNSResponse, bool) {
+	if r.zoneSigner == nil {
+		return domain.DNSResponse{}, false
+	}
+	rcode, authority, ok := r.zoneSigner.Deny(query)
+	if !ok {
+		return domain.DNSResponse{}, false
+	}
+	resp := buildResponse(query, rcode, nil)
+	resp.Authority = authority
+	return resp, true
+}
+
 // isFatalAliasError determines if an alias expansion error should trigger SERVFAIL.
 // Policy: depth exceeded & loop detected considered fatal (operational / config issues).
 // Target / question build errors treated non-fatal (return partial chain for transparency).
@@ -147,37 +299,128 @@ func (r *Resolver) checkBlocklist(query domain.Question) bool {
 	return r.blocklist.IsBlocked(query)
 }
 
-func (r *Resolver) checkUpstreamCache(query domain.Question) ([]domain.ResourceRecord, bool) {
+func (r *Resolver) checkUpstreamCache(ctx context.Context, query domain.Question) ([]domain.ResourceRecord, domain.RCode, bool) {
 	if r.upstreamCache == nil {
-		return nil, false
+		return nil, domain.NOERROR, false
+	}
+	_, span := r.tracer.Start(ctx, SpanCacheLookup, SpanKindInternal)
+	defer span.End()
+	records, found := r.upstreamCache.Get(query.CacheKey())
+	span.SetAttribute(AttrCacheHit, found)
+	rcode := domain.NOERROR
+	if found && len(records) == 0 {
+		// A negative entry: NXDOMAIN, or NODATA answered with NOERROR
+		if negative, ok := r.upstreamCache.GetNegative(query.CacheKey()); ok {
+			rcode = negative
+		}
+	}
+	return records, rcode, found
+}
+
+// resolveUpstream resolves the query upstream, coalescing concurrent identical
+// misses into a single exchange keyed by the question's cache key. The shared
+// exchange runs detached from any one caller's cancellation (the upstream client
+// applies its own timeout), while each caller still stops waiting when its own
+// context is done.
+func (r *Resolver) resolveUpstream(ctx context.Context, query domain.Question, now time.Time) (domain.DNSResponse, error) {
+	// A caller that has already given up should not start an exchange.
+	if err := ctx.Err(); err != nil {
+		return domain.DNSResponse{}, err
+	}
+	detached := context.WithoutCancel(ctx)
+	answer, shared, err := r.inflight.do(ctx, query.CacheKey(), func() (upstreamAnswer, error) {
+		exchangeCtx, server := withUpstreamServer(detached)
+		response, err := r.forward(exchangeCtx, query, now)
+		return upstreamAnswer{response: response, server: server.get()}, err
+	})
+	if shared {
+		r.logger.Debug(map[string]any{
+			"query": query.Name,
+			"type":  query.Type,
+		}, "Coalesced upstream query with in-flight request")
 	}
-	return r.upstreamCache.Get(query.CacheKey())
+	if err == nil && answer.server != "" {
+		ReportUpstreamServer(ctx, answer.server)
+	}
+	return answer.response, err
 }
 
-func (r *Resolver) resolveUpstream(ctx context.Context, query domain.Question, now time.Time) ([]domain.ResourceRecord, error) {
+// forward sends the query to the forward zone covering its name, if any,
+// and otherwise to the default upstream client.
+func (r *Resolver) forward(ctx context.Context, query domain.Question, now time.Time) (domain.DNSResponse, error) {
+	if client, zone, ok := r.forwardZones.match(query.Name); ok {
+		r.logger.Debug(map[string]any{
+			"query": query.Name,
+			"zone":  zone,
+		}, "Forwarding query to conditional upstream")
+		return client.Resolve(ctx, query, now)
+	}
 	if r.upstream == nil {
-		return nil, fmt.Errorf("no upstream client configured")
+		return domain.DNSResponse{}, fmt.Errorf("no upstream client configured")
 	}
 	return r.upstream.Resolve(ctx, query, now)
 }
 
-func (r *Resolver) cacheUpstreamResponse(records []domain.ResourceRecord) error {
+// cacheUpstreamResponse stores an upstream answer under the cache policy.
+// Names covered by a never-cache rule are skipped and record TTLs are clamped
+// or overridden. Empty NXDOMAIN and NOERROR (NODATA) answers are cached as
+// negative entries holding their RCODE, for the TTL their SOA record gives
+// (RFC 2308 §5) as adjusted by the policy. Answers with any other RCODE, such
+// as SERVFAIL or REFUSED, are not cached.
+func (r *Resolver) cacheUpstreamResponse(query domain.Question, resp domain.DNSResponse) error {
 	if r.upstreamCache == nil {
 		return nil // No cache configured, not an error
 	}
-	return r.upstreamCache.Set(records)
+	if !r.cachePolicy.cacheable(query.Name) {
+		return nil
+	}
+	if !isAnswer(resp.RCode) {
+		return nil
+	}
+	now := r.clock.Now()
+	if len(resp.Answers) == 0 {
+		if ttl := r.cachePolicy.negativeTTL(query.Name, soaNegativeTTL(resp.Authority, now)); ttl > 0 {
+			r.upstreamCache.SetNegative(query.CacheKey(), resp.RCode, time.Duration(ttl)*time.Second)
+		}
+		return nil
+	}
+	if resp.RCode != domain.NOERROR {
+		return nil // an NXDOMAIN at the end of a CNAME chain cannot be cached as records
+	}
+	return r.upstreamCache.Set(r.cachePolicy.apply(query.Name, resp.Answers, now))
+}
+
+// isAnswer reports whether an upstream RCODE settles the query: NOERROR, or
+// NXDOMAIN for a name that does not exist. Any other RCODE, such as SERVFAIL
+// or REFUSED, means the server could not answer.
+func isAnswer(rcode domain.RCode) bool {
+	return rcode == domain.NOERROR || rcode == domain.NXDOMAIN
 }
 
-// buildResponse creates a DNS response with the specified RCode and optional records
+// buildResponse creates a DNS response with the specified RCode and optional records.
+// The AD bit is set only when every answer record passed DNSSEC validation and
+// the query asked for it with the DO or AD bit; other clients get it cleared
+// (RFC 6840 §5.8).
 func buildResponse(query domain.Question, rcode domain.RCode, records []domain.ResourceRecord) domain.DNSResponse {
 	return domain.DNSResponse{
-		ID:       query.ID,
-		RCode:    rcode,
-		Answers:  records,
-		Question: query,
+		ID:            query.ID,
+		RCode:         rcode,
+		Answers:       records,
+		Question:      query,
+		AuthenticData: (query.DNSSECOK || query.AuthenticData) && allAuthenticated(records),
 		// TODO: Set additional response fields as needed (Authority, Additional sections)
 	}
 }
 
+// allAuthenticated reports whether records is non-empty and every record is DNSSEC-authenticated.
+func allAuthenticated(records []domain.ResourceRecord) bool {
+	for _, rr := range records {
+		if !rr.Authenticated {
+			return false
+		}
+	}
+	return len(records) > 0
+}
+
 // Ensure Resolver implements DNSResponder at compile time
 var _ DNSResponder = (*Resolver)(nil)
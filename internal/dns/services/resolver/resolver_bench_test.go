@@ -32,6 +32,16 @@ func (s *stubCache) Get(key string) ([]domain.ResourceRecord, bool) {
 	return s.records, s.found
 }
 
+func (s *stubCache) GetStale(key string) ([]domain.ResourceRecord, bool) {
+	return nil, false
+}
+
+func (s *stubCache) SetNegative(key string, rcode domain.RCode, ttl time.Duration) {}
+
+func (s *stubCache) GetNegative(key string) (domain.RCode, bool) {
+	return domain.NOERROR, s.found
+}
+
 func (s *stubCache) Delete(key string) {}
 
 func (s *stubCache) Len() int {
@@ -47,8 +57,8 @@ type stubUpstreamClient struct {
 	err     error
 }
 
-func (s *stubUpstreamClient) Resolve(ctx context.Context, query domain.Question, now time.Time) ([]domain.ResourceRecord, error) {
-	return s.answers, s.err
+func (s *stubUpstreamClient) Resolve(ctx context.Context, query domain.Question, now time.Time) (domain.DNSResponse, error) {
+	return domain.DNSResponse{Answers: s.answers}, s.err
 }
 
 type stubZoneCache struct {
@@ -72,6 +82,10 @@ func (s *stubZoneCache) Count() int {
 	return 0
 }
 
+func (s *stubZoneCache) RecordCount(zoneRoot string) int {
+	return 0
+}
+
 type stubLogger struct{}
 
 func (s *stubLogger) Info(map[string]any, string)  {}
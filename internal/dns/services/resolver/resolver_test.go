@@ -107,6 +107,20 @@ func (m *MockCache) Get(key string) ([]domain.ResourceRecord, bool) {
 	return args.Get(0).([]domain.ResourceRecord), args.Bool(1)
 }
 
+func (m *MockCache) GetStale(key string) ([]domain.ResourceRecord, bool) {
+	args := m.Called(key)
+	return args.Get(0).([]domain.ResourceRecord), args.Bool(1)
+}
+
+func (m *MockCache) SetNegative(key string, rcode domain.RCode, ttl time.Duration) {
+	m.Called(key, rcode, ttl)
+}
+
+func (m *MockCache) GetNegative(key string) (domain.RCode, bool) {
+	args := m.Called(key)
+	return args.Get(0).(domain.RCode), args.Bool(1)
+}
+
 func (m *MockCache) Delete(key string) {
 	m.Called(key)
 }
@@ -125,9 +139,14 @@ type MockUpstreamClient struct {
 	mock.Mock
 }
 
-func (m *MockUpstreamClient) Resolve(ctx context.Context, query domain.Question, now time.Time) ([]domain.ResourceRecord, error) {
+// Resolve returns the response set with Return, or a NOERROR response when
+// Return was given only the answer records.
+func (m *MockUpstreamClient) Resolve(ctx context.Context, query domain.Question, now time.Time) (domain.DNSResponse, error) {
 	args := m.Called(ctx, query, now)
-	return args.Get(0).([]domain.ResourceRecord), args.Error(1)
+	if resp, ok := args.Get(0).(domain.DNSResponse); ok {
+		return resp, args.Error(1)
+	}
+	return domain.DNSResponse{RCode: domain.NOERROR, Answers: args.Get(0).([]domain.ResourceRecord)}, args.Error(1)
 }
 
 type MockZoneCache struct {
@@ -157,6 +176,25 @@ func (m *MockZoneCache) Count() int {
 	return args.Int(0)
 }
 
+func (m *MockZoneCache) RecordCount(zoneRoot string) int {
+	args := m.Called(zoneRoot)
+	return args.Int(0)
+}
+
+type MockZoneSigner struct {
+	mock.Mock
+}
+
+func (m *MockZoneSigner) Signatures(records []domain.ResourceRecord) []domain.ResourceRecord {
+	args := m.Called(records)
+	return args.Get(0).([]domain.ResourceRecord)
+}
+
+func (m *MockZoneSigner) Deny(query domain.Question) (domain.RCode, []domain.ResourceRecord, bool) {
+	args := m.Called(query)
+	return args.Get(0).(domain.RCode), args.Get(1).([]domain.ResourceRecord), args.Bool(2)
+}
+
 // Test helpers
 func createTestQuery(name string, qtype domain.RRType) domain.Question {
 	query, _ := domain.NewQuestion(1, name, qtype, domain.RRClass(1)) // IN class
@@ -536,7 +574,7 @@ func TestResolver_HandleQuery_ContextCancellation(t *testing.T) {
 	mockZoneCache.On("FindRecords", query).Return([]domain.ResourceRecord{}, false)
 	mockBlocklist.On("IsBlocked", query).Return(false)
 	mockUpstreamCache.On("Get", query.CacheKey()).Return([]domain.ResourceRecord{}, false)
-	mockUpstream.On("Resolve", mock.Anything, query, mock.Anything).Return([]domain.ResourceRecord(nil), context.Canceled)
+	// No upstream expectation: a cancelled caller must not start an upstream exchange
 
 	// Create resolver
 	resolver := NewResolver(ResolverOptions{
@@ -707,6 +745,17 @@ func TestBuildResponse(t *testing.T) {
 	records := []domain.ResourceRecord{
 		createTestRecord("test.com.", domain.RRType(1), []byte{192, 0, 2, 1}, "192.0.2.1"),
 	}
+	authenticated := []domain.ResourceRecord{
+		createTestRecord("test.com.", domain.RRType(1), []byte{192, 0, 2, 1}, "192.0.2.1"),
+		createTestRecord("test.com.", domain.RRType(1), []byte{192, 0, 2, 2}, "192.0.2.2"),
+	}
+	for i := range authenticated {
+		authenticated[i].Authenticated = true
+	}
+	doQuery := query
+	doQuery.DNSSECOK = true
+	adQuery := query
+	adQuery.AuthenticData = true
 
 	tests := []struct {
 		name          string
@@ -716,6 +765,7 @@ func TestBuildResponse(t *testing.T) {
 		expectedID    uint16
 		expectedRCode domain.RCode
 		expectedCount int
+		expectedAD    bool
 	}{
 		{
 			name:          "successful response with records",
@@ -735,6 +785,44 @@ func TestBuildResponse(t *testing.T) {
 			expectedRCode: domain.NXDOMAIN,
 			expectedCount: 0,
 		},
+		{
+			name:          "authenticated records set the AD bit for a DO query",
+			query:         doQuery,
+			rcode:         domain.NOERROR,
+			records:       authenticated,
+			expectedID:    query.ID,
+			expectedRCode: domain.NOERROR,
+			expectedCount: 2,
+			expectedAD:    true,
+		},
+		{
+			name:          "authenticated records set the AD bit for an AD query",
+			query:         adQuery,
+			rcode:         domain.NOERROR,
+			records:       authenticated,
+			expectedID:    query.ID,
+			expectedRCode: domain.NOERROR,
+			expectedCount: 2,
+			expectedAD:    true,
+		},
+		{
+			name:          "a client without DO or AD gets the AD bit cleared",
+			query:         query,
+			rcode:         domain.NOERROR,
+			records:       authenticated,
+			expectedID:    query.ID,
+			expectedRCode: domain.NOERROR,
+			expectedCount: 2,
+		},
+		{
+			name:          "one unauthenticated record clears the AD bit",
+			query:         doQuery,
+			rcode:         domain.NOERROR,
+			records:       append(authenticated[:1:1], records...),
+			expectedID:    query.ID,
+			expectedRCode: domain.NOERROR,
+			expectedCount: 2,
+		},
 	}
 
 	for _, tt := range tests {
@@ -744,6 +832,7 @@ func TestBuildResponse(t *testing.T) {
 			assert.Equal(t, tt.expectedID, response.ID)
 			assert.Equal(t, tt.expectedRCode, response.RCode)
 			assert.Equal(t, tt.expectedCount, len(response.Answers))
+			assert.Equal(t, tt.expectedAD, response.AuthenticData)
 		})
 	}
 }
@@ -782,6 +871,7 @@ func TestResolver_CacheUpstreamResponse(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			resolver := &Resolver{
+				clock:         &clock.MockClock{CurrentTime: time.Now()},
 				upstreamCache: tt.upstreamCache,
 			}
 
@@ -794,7 +884,7 @@ func TestResolver_CacheUpstreamResponse(t *testing.T) {
 				}
 			}
 
-			err := resolver.cacheUpstreamResponse(tt.records)
+			err := resolver.cacheUpstreamResponse(createTestQuery("test.com.", domain.RRType(1)), domain.DNSResponse{RCode: domain.NOERROR, Answers: tt.records})
 
 			if tt.expectError {
 				assert.Error(t, err)
@@ -855,3 +945,128 @@ func TestResolver_isFatalAliasError(t *testing.T) {
 		})
 	}
 }
+
+func TestResolver_HandleQuery_SignedZone(t *testing.T) {
+	a := createTestRecord("www.example.com.", domain.RRTypeA, []byte{192, 0, 2, 1}, "192.0.2.1")
+	sig := createTestRecord("www.example.com.", domain.RRTypeRRSIG, []byte{0, 1}, "")
+	soa := createTestRecord("example.com.", domain.RRTypeSOA, []byte{0}, "")
+	nsec := createTestRecord("example.com.", domain.RRTypeNSEC, []byte{0}, "")
+
+	withDO := func(q domain.Question) domain.Question {
+		q.DNSSECOK = true
+		return q
+	}
+
+	tests := []struct {
+		name          string
+		query         domain.Question
+		zoneRecords   []domain.ResourceRecord
+		setup         func(*MockZoneSigner, domain.Question)
+		expectedRCode domain.RCode
+		expectedAns   []domain.ResourceRecord
+		expectedAuth  []domain.ResourceRecord
+	}{
+		{
+			name:          "answer without DO has no signatures",
+			query:         createTestQuery("www.example.com.", domain.RRTypeA),
+			zoneRecords:   []domain.ResourceRecord{a},
+			setup:         func(*MockZoneSigner, domain.Question) {},
+			expectedRCode: domain.NOERROR,
+			expectedAns:   []domain.ResourceRecord{a},
+		},
+		{
+			name:        "answer with DO carries signatures",
+			query:       withDO(createTestQuery("www.example.com.", domain.RRTypeA)),
+			zoneRecords: []domain.ResourceRecord{a},
+			setup: func(m *MockZoneSigner, _ domain.Question) {
+				m.On("Signatures", []domain.ResourceRecord{a}).Return([]domain.ResourceRecord{sig})
+			},
+			expectedRCode: domain.NOERROR,
+			expectedAns:   []domain.ResourceRecord{a, sig},
+		},
+		{
+			name:        "RRSIG query is not signed again",
+			query:       withDO(createTestQuery("www.example.com.", domain.RRTypeRRSIG)),
+			zoneRecords: []domain.ResourceRecord{sig},
+			setup:       func(*MockZoneSigner, domain.Question) {},
+			expectedAns: []domain.ResourceRecord{sig},
+		},
+		{
+			name:  "missing name is denied by the signed zone",
+			query: withDO(createTestQuery("nope.example.com.", domain.RRTypeA)),
+			setup: func(m *MockZoneSigner, q domain.Question) {
+				m.On("Deny", q).Return(domain.NXDOMAIN, []domain.ResourceRecord{soa, nsec}, true)
+			},
+			expectedRCode: domain.NXDOMAIN,
+			expectedAuth:  []domain.ResourceRecord{soa, nsec},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockZoneCache := &MockZoneCache{}
+			mockSigner := &MockZoneSigner{}
+			mockZoneCache.On("FindRecords", tt.query).Return(tt.zoneRecords, len(tt.zoneRecords) > 0)
+			tt.setup(mockSigner, tt.query)
+
+			resolver := NewResolver(ResolverOptions{
+				Clock:      &clock.MockClock{CurrentTime: time.Now()},
+				Logger:     &noopLogger{},
+				ZoneCache:  mockZoneCache,
+				ZoneSigner: mockSigner,
+			})
+			response, err := resolver.HandleQuery(context.Background(), tt.query, &net.UDPAddr{})
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedRCode, response.RCode)
+			assert.Equal(t, tt.expectedAns, response.Answers)
+			assert.Equal(t, tt.expectedAuth, response.Authority)
+			assert.False(t, response.AuthenticData, "authoritative answers never carry AD")
+			mockSigner.AssertExpectations(t)
+		})
+	}
+}
+
+func TestResolver_HandleQuery_SignedZoneFallsThrough(t *testing.T) {
+	query := createTestQuery("www.other.com.", domain.RRTypeA)
+	upstreamRecord := createTestRecord("www.other.com.", domain.RRTypeA, []byte{192, 0, 2, 9}, "192.0.2.9")
+
+	mockZoneCache := &MockZoneCache{}
+	mockZoneCache.On("FindRecords", query).Return([]domain.ResourceRecord(nil), false)
+	mockSigner := &MockZoneSigner{}
+	mockSigner.On("Deny", query).Return(domain.RCode(0), []domain.ResourceRecord(nil), false)
+	mockUpstream := &MockUpstreamClient{}
+	mockUpstream.On("Resolve", mock.Anything, query, mock.Anything).Return([]domain.ResourceRecord{upstreamRecord}, nil)
+
+	resolver := NewResolver(ResolverOptions{
+		Clock:      &clock.MockClock{CurrentTime: time.Now()},
+		Logger:     &noopLogger{},
+		Upstream:   mockUpstream,
+		ZoneCache:  mockZoneCache,
+		ZoneSigner: mockSigner,
+	})
+	response, err := resolver.HandleQuery(context.Background(), query, &net.UDPAddr{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, domain.NOERROR, response.RCode)
+	assert.Equal(t, []domain.ResourceRecord{upstreamRecord}, response.Answers)
+	mockSigner.AssertExpectations(t)
+	mockUpstream.AssertExpectations(t)
+}
+
+func TestResolver_withSignatures_DoesNotAppendToZoneSlice(t *testing.T) {
+	a := createTestRecord("www.example.com.", domain.RRTypeA, []byte{192, 0, 2, 1}, "192.0.2.1")
+	sig := createTestRecord("www.example.com.", domain.RRTypeRRSIG, []byte{0, 1}, "")
+	records := make([]domain.ResourceRecord, 1, 4)
+	records[0] = a
+
+	mockSigner := &MockZoneSigner{}
+	mockSigner.On("Signatures", records).Return([]domain.ResourceRecord{sig})
+	resolver := NewResolver(ResolverOptions{ZoneSigner: mockSigner})
+
+	query := createTestQuery("www.example.com.", domain.RRTypeA)
+	query.DNSSECOK = true
+	out := resolver.withSignatures(query, records)
+	assert.Equal(t, []domain.ResourceRecord{a, sig}, out)
+	assert.Equal(t, domain.ResourceRecord{}, records[:2][1], "spare capacity of the zone slice is untouched")
+}
@@ -0,0 +1,107 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// defaultStaleTTL is the TTL of records served stale when no StaleAnswerTTL
+// is set, as recommended by RFC 8767 §4, so clients come back soon for a
+// fresh answer.
+const defaultStaleTTL = 30 * time.Second
+
+// checkStaleCache returns the expired records the upstream cache still keeps
+// for the query, if serving stale is enabled.
+func (r *Resolver) checkStaleCache(ctx context.Context, query domain.Question) ([]domain.ResourceRecord, bool) {
+	if !r.serveStale || r.upstreamCache == nil {
+		return nil, false
+	}
+	_, span := r.tracer.Start(ctx, SpanCacheLookup, SpanKindInternal)
+	defer span.End()
+	span.SetAttribute(AttrCacheStale, true)
+	records, found := r.upstreamCache.GetStale(query.CacheKey())
+	span.SetAttribute(AttrCacheHit, found)
+	return records, found
+}
+
+// upstreamResult carries the outcome of an upstream refresh to the waiting query.
+type upstreamResult struct {
+	response domain.DNSResponse
+	err      error
+}
+
+// resolveOrServeStale refreshes the query upstream and answers with the fresh
+// records if they arrive in time. If upstream fails, whether unreachable or
+// replying with an error RCODE such as SERVFAIL (RFC 8767 §4), or the stale
+// answer timeout passes first, the stale records are served with the stale
+// answer TTL. A stale answer always goes out as NOERROR: GetStale only returns
+// the records of positive answers, so expired NXDOMAIN and NODATA answers are
+// never served stale. The refresh carries on in the
+// background and caches its result when it succeeds. The source tells which
+// of the two answers was sent.
+func (r *Resolver) resolveOrServeStale(ctx context.Context, query domain.Question, clientAddr net.Addr, stale []domain.ResourceRecord) (domain.DNSResponse, AnswerSource) {
+	done := make(chan upstreamResult, 1)
+	refreshCtx := context.WithoutCancel(ctx)
+	go func() {
+		response, err := r.resolveUpstream(refreshCtx, query, r.clock.Now())
+		if err == nil {
+			if cacheErr := r.cacheUpstreamResponse(query, response); cacheErr != nil {
+				r.logger.Error(map[string]any{
+					"error": cacheErr,
+					"query": query,
+				}, "Failed to cache upstream response")
+			}
+		}
+		done <- upstreamResult{response: response, err: err}
+	}()
+
+	var timeout <-chan time.Time
+	if r.staleTimeout > 0 {
+		timeout = r.clock.After(r.staleTimeout)
+	}
+
+	select {
+	case res := <-done:
+		if res.err == nil && isAnswer(res.response.RCode) {
+			return buildResponse(query, res.response.RCode, res.response.Answers), SourceUpstream
+		}
+		r.logger.Warn(map[string]any{
+			"error":  res.err,
+			"rcode":  res.response.RCode,
+			"query":  query,
+			"client": clientAddr,
+		}, "Upstream failed; serving stale answer")
+	case <-timeout:
+		r.logger.Debug(map[string]any{
+			"query":   query,
+			"client":  clientAddr,
+			"timeout": r.staleTimeout,
+		}, "Upstream slow; serving stale answer while refreshing")
+	case <-ctx.Done():
+		r.logger.Debug(map[string]any{
+			"query":  query,
+			"client": clientAddr,
+		}, "Query cancelled; serving stale answer while refreshing")
+	}
+	return buildResponse(query, domain.NOERROR, r.staleRecords(stale)), SourceStale
+}
+
+// staleRecords copies records with their TTL reset to the stale answer TTL.
+// Records that cannot be copied are served as they are, with a TTL of 0.
+func (r *Resolver) staleRecords(records []domain.ResourceRecord) []domain.ResourceRecord {
+	now := r.clock.Now()
+	out := make([]domain.ResourceRecord, 0, len(records))
+	for _, rr := range records {
+		fresh, err := domain.NewCachedResourceRecord(rr.Name, rr.Type, rr.Class, uint32(r.staleTTL/time.Second), rr.Data, rr.Text, now)
+		if err != nil {
+			out = append(out, rr)
+			continue
+		}
+		fresh.Authenticated = rr.Authenticated
+		out = append(out, fresh)
+	}
+	return out
+}
@@ -0,0 +1,234 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// expiredTestRecord returns a cached record that expired the given duration ago.
+func expiredTestRecord(name string, data []byte, text string, ago time.Duration) domain.ResourceRecord {
+	record, _ := domain.NewCachedResourceRecord(name, domain.RRTypeA, domain.RRClass(1), 60, data, text, time.Now().Add(-60*time.Second-ago))
+	return record
+}
+
+// advanceWhenWaiting advances clk by d once something waits on it.
+func advanceWhenWaiting(clk *clock.MockClock, d time.Duration) {
+	for clk.Waiting() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(d)
+}
+
+func TestResolver_HandleQuery_ServeStale(t *testing.T) {
+	query := createTestQuery("example.com.", domain.RRTypeA)
+	stale := expiredTestRecord("example.com.", []byte{192, 0, 2, 1}, "192.0.2.1", 10*time.Second)
+	stale.Authenticated = true
+	fresh := createTestRecord("example.com.", domain.RRTypeA, []byte{192, 0, 2, 2}, "192.0.2.2")
+
+	tests := []struct {
+		name        string
+		serveStale  bool
+		timeout     time.Duration
+		staleTTL    time.Duration
+		staleFound  bool
+		upstream    func(*MockUpstreamClient, chan struct{})
+		wantRCode   domain.RCode
+		wantRecords []domain.ResourceRecord
+		wantStale   bool
+		wantCached  bool
+		// slow advances the clock past the timeout while upstream is still busy
+		slow bool
+	}{
+		{
+			name:       "fresh answer in time replaces stale one",
+			serveStale: true,
+			timeout:    time.Second,
+			staleFound: true,
+			upstream: func(m *MockUpstreamClient, _ chan struct{}) {
+				m.On("Resolve", mock.Anything, query, mock.Anything).Return([]domain.ResourceRecord{fresh}, nil)
+			},
+			wantRCode:   domain.NOERROR,
+			wantRecords: []domain.ResourceRecord{fresh},
+			wantCached:  true,
+		},
+		{
+			name:       "upstream failure serves stale",
+			serveStale: true,
+			staleFound: true,
+			upstream: func(m *MockUpstreamClient, _ chan struct{}) {
+				m.On("Resolve", mock.Anything, query, mock.Anything).Return([]domain.ResourceRecord(nil), errors.New("network unreachable"))
+			},
+			wantRCode: domain.NOERROR,
+			wantStale: true,
+		},
+		{
+			name:       "stale answer carries the configured TTL",
+			serveStale: true,
+			staleTTL:   5 * time.Minute,
+			staleFound: true,
+			upstream: func(m *MockUpstreamClient, _ chan struct{}) {
+				m.On("Resolve", mock.Anything, query, mock.Anything).Return([]domain.ResourceRecord(nil), errors.New("network unreachable"))
+			},
+			wantRCode: domain.NOERROR,
+			wantStale: true,
+		},
+		{
+			name:       "upstream SERVFAIL serves stale",
+			serveStale: true,
+			timeout:    time.Second,
+			staleFound: true,
+			upstream: func(m *MockUpstreamClient, _ chan struct{}) {
+				m.On("Resolve", mock.Anything, query, mock.Anything).Return(domain.DNSResponse{RCode: domain.SERVFAIL}, nil)
+			},
+			wantRCode: domain.NOERROR,
+			wantStale: true,
+		},
+		{
+			name:       "upstream REFUSED serves stale",
+			serveStale: true,
+			staleFound: true,
+			upstream: func(m *MockUpstreamClient, _ chan struct{}) {
+				m.On("Resolve", mock.Anything, query, mock.Anything).Return(domain.DNSResponse{RCode: domain.REFUSED}, nil)
+			},
+			wantRCode: domain.NOERROR,
+			wantStale: true,
+		},
+		{
+			name:       "upstream NXDOMAIN replaces stale answer",
+			serveStale: true,
+			timeout:    time.Second,
+			staleFound: true,
+			upstream: func(m *MockUpstreamClient, _ chan struct{}) {
+				m.On("Resolve", mock.Anything, query, mock.Anything).Return(domain.DNSResponse{RCode: domain.NXDOMAIN}, nil)
+			},
+			wantRCode: domain.NXDOMAIN,
+		},
+		{
+			name:       "slow upstream serves stale and refreshes in the background",
+			serveStale: true,
+			timeout:    time.Second,
+			staleFound: true,
+			upstream: func(m *MockUpstreamClient, release chan struct{}) {
+				m.On("Resolve", mock.Anything, query, mock.Anything).Run(func(mock.Arguments) { <-release }).Return([]domain.ResourceRecord{fresh}, nil)
+			},
+			wantRCode:  domain.NOERROR,
+			wantStale:  true,
+			wantCached: true,
+			slow:       true,
+		},
+		{
+			name:       "no stale records keeps SERVFAIL",
+			serveStale: true,
+			staleFound: false,
+			upstream: func(m *MockUpstreamClient, _ chan struct{}) {
+				m.On("Resolve", mock.Anything, query, mock.Anything).Return([]domain.ResourceRecord(nil), errors.New("network unreachable"))
+			},
+			wantRCode: domain.SERVFAIL,
+		},
+		{
+			name:       "serve stale disabled",
+			serveStale: false,
+			staleFound: true,
+			upstream: func(m *MockUpstreamClient, _ chan struct{}) {
+				m.On("Resolve", mock.Anything, query, mock.Anything).Return([]domain.ResourceRecord(nil), errors.New("network unreachable"))
+			},
+			wantRCode: domain.SERVFAIL,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release := make(chan struct{})
+			mockCache := &MockCache{}
+			mockCache.On("Get", query.CacheKey()).Return([]domain.ResourceRecord(nil), false)
+			if tt.staleFound {
+				mockCache.On("GetStale", query.CacheKey()).Return([]domain.ResourceRecord{stale}, true)
+			} else {
+				mockCache.On("GetStale", query.CacheKey()).Return([]domain.ResourceRecord(nil), false)
+			}
+			cached := make(chan struct{}, 1)
+			mockCache.On("Set", []domain.ResourceRecord{fresh}).Run(func(mock.Arguments) { cached <- struct{}{} }).Return(nil)
+			mockUpstream := &MockUpstreamClient{}
+			tt.upstream(mockUpstream, release)
+
+			now := time.Now()
+			clk := &clock.MockClock{CurrentTime: now}
+			if tt.slow {
+				go advanceWhenWaiting(clk, tt.timeout)
+			}
+			resolver := NewResolver(ResolverOptions{
+				Clock:              clk,
+				Logger:             &noopLogger{},
+				Upstream:           mockUpstream,
+				UpstreamCache:      mockCache,
+				ServeStale:         tt.serveStale,
+				StaleAnswerTimeout: tt.timeout,
+				StaleAnswerTTL:     tt.staleTTL,
+			})
+			response, err := resolver.HandleQuery(context.Background(), query, &net.UDPAddr{})
+			close(release)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantRCode, response.RCode)
+			if tt.wantStale {
+				if assert.Len(t, response.Answers, 1) {
+					got := response.Answers[0]
+					assert.Equal(t, stale.Data, got.Data)
+					assert.False(t, got.IsExpired(clk.Now()))
+					wantTTL := defaultStaleTTL
+					if tt.staleTTL > 0 {
+						wantTTL = tt.staleTTL
+					}
+					assert.Equal(t, uint32(wantTTL/time.Second), got.TTL(clk.Now()))
+					assert.True(t, got.Authenticated)
+				}
+			} else {
+				assert.Equal(t, tt.wantRecords, response.Answers)
+			}
+			if tt.wantCached {
+				select {
+				case <-cached:
+				case <-time.After(time.Second):
+					t.Error("refreshed answer was not cached")
+				}
+			}
+		})
+	}
+}
+
+func TestResolver_HandleQuery_ServeStale_ClientCancelled(t *testing.T) {
+	query := createTestQuery("example.com.", domain.RRTypeA)
+	stale := expiredTestRecord("example.com.", []byte{192, 0, 2, 1}, "192.0.2.1", time.Second)
+	release := make(chan struct{})
+	defer close(release)
+
+	mockCache := &MockCache{}
+	mockCache.On("Get", query.CacheKey()).Return([]domain.ResourceRecord(nil), false)
+	mockCache.On("GetStale", query.CacheKey()).Return([]domain.ResourceRecord{stale}, true)
+	mockUpstream := &MockUpstreamClient{}
+	mockUpstream.On("Resolve", mock.Anything, query, mock.Anything).Run(func(mock.Arguments) { <-release }).Return([]domain.ResourceRecord(nil), errors.New("timeout"))
+
+	resolver := NewResolver(ResolverOptions{
+		Clock:         &clock.MockClock{CurrentTime: time.Now()},
+		Logger:        &noopLogger{},
+		Upstream:      mockUpstream,
+		UpstreamCache: mockCache,
+		ServeStale:    true,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	response, err := resolver.HandleQuery(ctx, query, &net.UDPAddr{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, domain.NOERROR, response.RCode)
+	assert.Len(t, response.Answers, 1)
+}
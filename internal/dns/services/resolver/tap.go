@@ -0,0 +1,57 @@
+package resolver
+
+import (
+	"net"
+	"time"
+)
+
+// TapMessageType identifies which side of which exchange a TapMessage copies.
+// The values are the dnstap message type names.
+type TapMessageType string
+
+const (
+	// TapClientQuery is a query received from a client.
+	TapClientQuery TapMessageType = "CLIENT_QUERY"
+	// TapClientResponse is a response sent to a client.
+	TapClientResponse TapMessageType = "CLIENT_RESPONSE"
+	// TapForwarderQuery is a query sent to an upstream server.
+	TapForwarderQuery TapMessageType = "FORWARDER_QUERY"
+	// TapForwarderResponse is a response received from an upstream server.
+	TapForwarderResponse TapMessageType = "FORWARDER_RESPONSE"
+	// TapResolverQuery is a query sent to an authoritative server while
+	// resolving iteratively.
+	TapResolverQuery TapMessageType = "RESOLVER_QUERY"
+	// TapResolverResponse is a response received from an authoritative server
+	// while resolving iteratively.
+	TapResolverResponse TapMessageType = "RESOLVER_RESPONSE"
+)
+
+// TapMessage is a copy of one DNS message exchanged with a client or an
+// upstream server.
+type TapMessage struct {
+	Type TapMessageType
+	// Protocol is the transport the message travelled over: "udp" or "tcp".
+	Protocol string
+	// QueryAddr sent the query and ResponseAddr answered it: the client and
+	// this server for client messages, this server and the upstream or
+	// authoritative server for forwarder and resolver messages. Either is nil
+	// when unknown.
+	QueryAddr    net.Addr
+	ResponseAddr net.Addr
+	// QueryTime is when the query was received or sent. ResponseTime is when
+	// the response was sent or received, and zero for queries.
+	QueryTime    time.Time
+	ResponseTime time.Time
+	// Message is the query or response in wire format. It must not be modified
+	// once tapped.
+	Message []byte
+}
+
+// NopTap discards every message. Transports and upstream clients use it when
+// no MessageTap is configured.
+type NopTap struct{}
+
+// Tap does nothing.
+func (NopTap) Tap(TapMessage) {}
+
+var _ MessageTap = NopTap{}
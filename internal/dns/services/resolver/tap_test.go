@@ -0,0 +1,13 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNopTap(t *testing.T) {
+	assert.NotPanics(t, func() {
+		NopTap{}.Tap(TapMessage{Type: TapClientQuery, Message: []byte{0, 1}})
+	})
+}
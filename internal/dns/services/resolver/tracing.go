@@ -0,0 +1,64 @@
+package resolver
+
+import (
+	"context"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// SpanKind describes the role of a span, as in OpenTelemetry.
+type SpanKind int
+
+const (
+	// SpanKindInternal is an operation within rr-dnsd.
+	SpanKindInternal SpanKind = iota + 1
+	// SpanKindServer handles a request from a client.
+	SpanKindServer
+	// SpanKindClient sends a request to another server.
+	SpanKindClient
+)
+
+// Span names of the stages of query handling.
+const (
+	SpanQuery           = "dns.query"
+	SpanZoneLookup      = "dns.zone.lookup"
+	SpanAliasChase      = "dns.alias.chase"
+	SpanCacheLookup     = "dns.cache.lookup"
+	SpanUpstreamAttempt = "dns.upstream.attempt"
+)
+
+// Span attribute keys.
+const (
+	AttrQuestionName = "dns.question.name"
+	AttrQuestionType = "dns.question.type"
+	AttrResponseCode = "dns.response.code"
+	AttrAnswerSource = "dns.answer.source"
+	AttrAnswerCount  = "dns.answer.count"
+	AttrCacheHit     = "dns.cache.hit"
+	AttrCacheStale   = "dns.cache.stale"
+	AttrServer       = "server.address"
+)
+
+// NopTracer starts spans that record nothing. The resolver and upstream
+// clients use it when no Tracer is configured.
+type NopTracer struct{}
+
+// Start returns ctx unchanged and a span that records nothing.
+func (NopTracer) Start(ctx context.Context, _ string, _ SpanKind) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+// nopSpan discards everything recorded on it.
+type nopSpan struct{}
+
+func (nopSpan) SetAttribute(string, any) {}
+func (nopSpan) RecordError(error)        {}
+func (nopSpan) End()                     {}
+
+// setQuestionAttributes records the name and type of query on span.
+func setQuestionAttributes(span Span, query domain.Question) {
+	span.SetAttribute(AttrQuestionName, query.Name)
+	span.SetAttribute(AttrQuestionType, query.Type.String())
+}
+
+var _ Tracer = NopTracer{}
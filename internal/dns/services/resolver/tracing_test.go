@@ -0,0 +1,123 @@
+package resolver
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/haukened/rr-dns/internal/dns/common/clock"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// recordedSpan is a span started by recordingTracer.
+type recordedSpan struct {
+	name   string
+	kind   SpanKind
+	parent *recordedSpan
+	attrs  map[string]any
+	err    error
+	ended  bool
+}
+
+func (s *recordedSpan) SetAttribute(key string, value any) { s.attrs[key] = value }
+func (s *recordedSpan) RecordError(err error)              { s.err = err }
+func (s *recordedSpan) End()                               { s.ended = true }
+
+// spanKey is the context key recordingTracer stores the current span under.
+type spanKey struct{}
+
+// recordingTracer records every span it starts, in start order.
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parent, _ := ctx.Value(spanKey{}).(*recordedSpan)
+	span := &recordedSpan{name: name, kind: kind, parent: parent, attrs: make(map[string]any)}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func TestResolver_HandleQuery_Tracing_Zone(t *testing.T) {
+	cname := newTestCNAME(t, "example.com.", "target.example.")
+	zone := &stubZoneCache{records: []domain.ResourceRecord{cname}, found: true}
+	ar := &stubAliasResolver{recs: []domain.ResourceRecord{cname}, err: ErrAliasLoopDetected}
+	tracer := &recordingTracer{}
+	r := NewResolver(ResolverOptions{
+		ZoneCache:     zone,
+		AliasResolver: ar,
+		Clock:         &clock.MockClock{CurrentTime: time.Now()},
+		Logger:        &aliasTestLogger{},
+		Tracer:        tracer,
+	})
+	q, err := domain.NewQuestion(1, "example.com.", domain.RRTypeA, domain.RRClassIN)
+	require.NoError(t, err)
+
+	_, err = r.HandleQuery(context.Background(), q, nil)
+	require.NoError(t, err)
+
+	require.Len(t, tracer.spans, 3)
+	query, lookup, chase := tracer.spans[0], tracer.spans[1], tracer.spans[2]
+	assert.Equal(t, SpanQuery, query.name)
+	assert.Equal(t, SpanKindServer, query.kind)
+	assert.Nil(t, query.parent)
+	assert.Equal(t, map[string]any{
+		AttrQuestionName: "example.com.",
+		AttrQuestionType: "A",
+		AttrResponseCode: "SERVFAIL",
+		AttrAnswerSource: "zone",
+		AttrAnswerCount:  0,
+	}, query.attrs)
+
+	assert.Equal(t, SpanZoneLookup, lookup.name)
+	assert.Same(t, query, lookup.parent)
+	assert.Equal(t, 1, lookup.attrs[AttrAnswerCount])
+
+	assert.Equal(t, SpanAliasChase, chase.name)
+	assert.Same(t, query, chase.parent)
+	assert.ErrorIs(t, chase.err, ErrAliasLoopDetected)
+
+	for _, span := range tracer.spans {
+		assert.True(t, span.ended, "span %s was not ended", span.name)
+	}
+}
+
+func TestResolver_HandleQuery_Tracing_Cache(t *testing.T) {
+	query := createTestQuery("example.com.", domain.RRTypeA)
+	record := createTestRecord("example.com.", domain.RRTypeA, []byte{192, 0, 2, 1}, "192.0.2.1")
+	cache := &MockCache{}
+	cache.On("Get", query.CacheKey()).Return([]domain.ResourceRecord{record}, true)
+	tracer := &recordingTracer{}
+	r := NewResolver(ResolverOptions{
+		Clock:         &clock.MockClock{CurrentTime: time.Now()},
+		Logger:        &noopLogger{},
+		UpstreamCache: cache,
+		Tracer:        tracer,
+	})
+
+	_, err := r.HandleQuery(context.Background(), query, nil)
+	require.NoError(t, err)
+
+	require.Len(t, tracer.spans, 2)
+	lookup := tracer.spans[1]
+	assert.Equal(t, SpanCacheLookup, lookup.name)
+	assert.Same(t, tracer.spans[0], lookup.parent)
+	assert.Equal(t, true, lookup.attrs[AttrCacheHit])
+	assert.Equal(t, "cache", tracer.spans[0].attrs[AttrAnswerSource])
+}
+
+func TestNopTracer(t *testing.T) {
+	ctx := context.Background()
+	got, span := NopTracer{}.Start(ctx, SpanQuery, SpanKindServer)
+	assert.Equal(t, ctx, got)
+	span.SetAttribute(AttrQuestionName, "example.com.")
+	span.RecordError(assert.AnError)
+	span.End()
+}
@@ -0,0 +1,51 @@
+package resolver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	"github.com/haukened/rr-dns/internal/dns/common/utils"
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+// Errors returned by ZoneEditor implementations, to be told apart with errors.Is.
+var (
+	// ErrZoneNotFound means no zone file defines the zone.
+	ErrZoneNotFound = errors.New("zone not found")
+	// ErrZoneNotEditable means the zone cannot be changed safely, for example
+	// because its records are spread across several zone files.
+	ErrZoneNotEditable = errors.New("zone is not editable")
+	// ErrZoneVersion means the zone changed since the version the change was based on.
+	ErrZoneVersion = errors.New("zone version does not match")
+	// ErrRecordNotFound means the zone holds no record with the given ID.
+	ErrRecordNotFound = errors.New("record not found")
+	// ErrRecordExists means the zone already holds the same record.
+	ErrRecordExists = errors.New("record already exists")
+	// ErrInvalidRecord means the record's name, type or value is not valid for the zone.
+	ErrInvalidRecord = errors.New("invalid record")
+)
+
+// ZoneRecord is one record of a zone as it is written in a zone file: an owner
+// name, a type and a value in presentation format.
+type ZoneRecord struct {
+	// ID identifies the record within its zone. It is derived from the name,
+	// type and value, so it changes whenever the record does.
+	ID    string
+	Name  string
+	Type  domain.RRType
+	Value string
+}
+
+// NewZoneRecord returns the record with the given fully qualified owner name,
+// type and value, and its ID. The name is canonicalized.
+func NewZoneRecord(name string, rrtype domain.RRType, value string) ZoneRecord {
+	name = utils.CanonicalDNSName(name)
+	sum := sha256.Sum256([]byte(name + "\x00" + rrtype.String() + "\x00" + value))
+	return ZoneRecord{
+		ID:    hex.EncodeToString(sum[:8]),
+		Name:  name,
+		Type:  rrtype,
+		Value: value,
+	}
+}
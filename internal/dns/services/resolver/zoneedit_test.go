@@ -0,0 +1,22 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/haukened/rr-dns/internal/dns/domain"
+)
+
+func TestNewZoneRecord(t *testing.T) {
+	r := NewZoneRecord("WWW.Example.com.", domain.RRTypeA, "192.0.2.1")
+	assert.Equal(t, "www.example.com", r.Name)
+	assert.Equal(t, domain.RRTypeA, r.Type)
+	assert.Equal(t, "192.0.2.1", r.Value)
+	assert.Len(t, r.ID, 16)
+
+	assert.Equal(t, r.ID, NewZoneRecord("www.example.com", domain.RRTypeA, "192.0.2.1").ID, "IDs are stable across name spellings")
+	assert.NotEqual(t, r.ID, NewZoneRecord("www.example.com", domain.RRTypeA, "192.0.2.2").ID)
+	assert.NotEqual(t, r.ID, NewZoneRecord("www.example.com", domain.RRTypeAAAA, "192.0.2.1").ID)
+	assert.NotEqual(t, r.ID, NewZoneRecord("mail.example.com", domain.RRTypeA, "192.0.2.1").ID)
+}